@@ -0,0 +1,409 @@
+// Command beamsim stands in for a track's timing controller, sending beam
+// readings to libdragd's UDP beam source so the full stack can be tested
+// without sensors on the bench:
+//
+//	beamsim -config facility.json                  keyboard-controlled lanes
+//	beamsim -config facility.json -script run.txt  replay a script
+//
+// Channels are resolved through the facility config's hardware map, and
+// readings go to its first udp beam source unless -addr is given. They use
+// the controller wire format, "<channel> <1|0> [<unix nanoseconds>]".
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/benharold/libdrag/pkg/beam"
+	"github.com/benharold/libdrag/pkg/config"
+)
+
+// beamBreak is how long a passing car blocks a downtrack beam
+const beamBreak = 20 * time.Millisecond
+
+// facilityConfig is the part of libdragd's facility config beamsim reads
+type facilityConfig struct {
+	Hardware    config.HardwareMap  `json:"hardware"`
+	BeamSources []beam.SourceConfig `json:"beam_sources"`
+}
+
+// simulator sends the readings of the beams wired in a hardware map
+type simulator struct {
+	conn     net.Conn
+	hardware config.HardwareMap
+	layout   map[string]config.BeamConfig
+	latch    bool          // Send each reading's time as a controller latch
+	et       time.Duration // Elapsed time of a simulated run
+
+	mu     sync.Mutex
+	broken map[int]bool // Channel -> last state sent
+}
+
+func main() {
+	configPath := flag.String("config", "", "libdragd facility config file (JSON) with the hardware map")
+	addr := flag.String("addr", "", "UDP address of libdragd's beam source (defaults to the config's first udp source)")
+	script := flag.String("script", "", "script of readings to replay, one \"<at> <lane> <beam> <1|0>\" per line")
+	latch := flag.Bool("latch", false, "send each reading's time, as a controller with hardware timestamps does")
+	et := flag.Duration("et", 10*time.Second, "elapsed time of a run started from the console")
+	flag.Parse()
+
+	if *configPath == "" {
+		fail(fmt.Errorf("-config is required"))
+	}
+	facility, err := loadFacilityConfig(*configPath)
+	if err != nil {
+		fail(err)
+	}
+	if *addr == "" {
+		*addr = udpAddress(facility.BeamSources)
+	}
+	if *addr == "" {
+		fail(fmt.Errorf("the config has no udp beam source; give -addr"))
+	}
+	conn, err := net.Dial("udp", *addr)
+	if err != nil {
+		fail(err)
+	}
+	defer conn.Close()
+
+	cfg := config.NewDefaultConfig()
+	sim := &simulator{
+		conn:     conn,
+		hardware: facility.Hardware,
+		layout:   cfg.Track().BeamLayout,
+		latch:    *latch,
+		et:       *et,
+		broken:   make(map[int]bool),
+	}
+
+	if *script != "" {
+		if err := sim.replay(*script); err != nil {
+			fail(err)
+		}
+		return
+	}
+
+	fmt.Printf("📡 BEAMSIM sending to %s\n", *addr)
+	sim.printHelp()
+	scanner := bufio.NewScanner(os.Stdin)
+	for {
+		fmt.Print("beamsim> ")
+		if !scanner.Scan() {
+			return
+		}
+		if quit := sim.handle(strings.Fields(scanner.Text())); quit {
+			return
+		}
+	}
+}
+
+// loadFacilityConfig reads the hardware map and beam sources from a
+// facility config file
+func loadFacilityConfig(path string) (facilityConfig, error) {
+	var facility facilityConfig
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return facility, fmt.Errorf("failed to read facility config: %v", err)
+	}
+	if err := json.Unmarshal(data, &facility); err != nil {
+		return facility, fmt.Errorf("failed to parse facility config: %v", err)
+	}
+	if len(facility.Hardware.Channels) == 0 {
+		return facility, fmt.Errorf("the facility config has no hardware map")
+	}
+	return facility, nil
+}
+
+// udpAddress returns where the first udp beam source listens, on this host
+// when it listens on every interface
+func udpAddress(sources []beam.SourceConfig) string {
+	for _, src := range sources {
+		if src.Driver != "udp" {
+			continue
+		}
+		if strings.HasPrefix(src.Address, ":") {
+			return "localhost" + src.Address
+		}
+		return src.Address
+	}
+	return ""
+}
+
+// handle runs one console command and reports whether to quit
+func (s *simulator) handle(fields []string) bool {
+	if len(fields) == 0 {
+		s.printState()
+		return false
+	}
+
+	var err error
+	switch cmd := fields[0]; cmd {
+	case "p1", "p2", "s1", "s2":
+		id := string(beam.BeamPreStage)
+		if cmd[0] == 's' {
+			id = string(beam.BeamStage)
+		}
+		err = s.toggle(int(cmd[1]-'0'), id)
+	case "st":
+		err = s.stage(1, 2)
+	case "r1", "r2":
+		err = s.run(int(cmd[1] - '0'))
+	case "r":
+		err = s.run(1, 2)
+	case "c":
+		err = s.sendRaw(fields[1:])
+	case "h", "?":
+		s.printHelp()
+	case "q":
+		return true
+	default:
+		fmt.Printf("Unknown command %q (h for help)\n", cmd)
+	}
+
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+	}
+	return false
+}
+
+func (s *simulator) printHelp() {
+	fmt.Println("Commands (press Enter after each):")
+	fmt.Println("  p1/p2  toggle a lane's pre-stage beam    s1/s2  toggle its stage beam")
+	fmt.Println("  st     pre-stage and stage both lanes")
+	fmt.Println("  r1/r2  run a lane down the track         r      run both lanes")
+	fmt.Println("  c <channel> <1|0>  send a raw reading    (empty) show beams")
+	fmt.Println("  h      help                              q      quit")
+}
+
+// printState lists the wired beams and the state last sent for each
+func (s *simulator) printState() {
+	channels := make([]int, 0, len(s.hardware.Channels))
+	for channel, wiring := range s.hardware.Channels {
+		if wiring.Kind == config.ChannelBeam || wiring.Kind == config.ChannelBoundary {
+			channels = append(channels, channel)
+		}
+	}
+	sort.Ints(channels)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, channel := range channels {
+		wiring := s.hardware.Channels[channel]
+		state := "clear"
+		if s.broken[channel] {
+			state = "broken"
+		}
+		fmt.Printf("  %3d  lane %d %-12s %s\n", channel, wiring.Lane, wiring.ID, state)
+	}
+}
+
+// toggle flips a lane's beam
+func (s *simulator) toggle(lane int, id string) error {
+	channel, err := s.channel(lane, id)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	broken := !s.broken[channel]
+	s.mu.Unlock()
+	return s.send(channel, broken, time.Now())
+}
+
+// stage rolls lanes into pre-stage and then stage
+func (s *simulator) stage(lanes ...int) error {
+	for _, id := range []beam.BeamID{beam.BeamPreStage, beam.BeamStage} {
+		for _, lane := range lanes {
+			channel, err := s.channel(lane, string(id))
+			if err != nil {
+				return err
+			}
+			if err := s.send(channel, true, time.Now()); err != nil {
+				return err
+			}
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+	return nil
+}
+
+// run drives lanes off the line and down the track together, breaking each
+// wired downtrack beam at its distance on a constant-acceleration run of
+// the simulator's elapsed time
+func (s *simulator) run(lanes ...int) error {
+	start := time.Now()
+	var readings []scriptReading
+	for _, lane := range lanes {
+		for _, id := range []beam.BeamID{beam.BeamPreStage, beam.BeamStage} {
+			if channel, ok := s.hardware.ChannelFor(config.ChannelBeam, lane, string(id)); ok {
+				readings = append(readings, scriptReading{channel: channel})
+			}
+		}
+		finish := s.finishLine()
+		for id, beamConfig := range s.layout {
+			if id == string(beam.BeamPreStage) || id == string(beam.BeamStage) || beamConfig.Position > finish {
+				continue
+			}
+			channel, ok := s.hardware.ChannelFor(config.ChannelBeam, lane, id)
+			if !ok {
+				continue
+			}
+			at := time.Duration(float64(s.et) * math.Sqrt(beamConfig.Position/finish))
+			readings = append(readings,
+				scriptReading{at: at, channel: channel, broken: true},
+				scriptReading{at: at + beamBreak, channel: channel})
+		}
+	}
+	if len(readings) == 0 {
+		return fmt.Errorf("no beams wired in lanes %v", lanes)
+	}
+	fmt.Printf("🏁 Running lanes %v (%.3fs)\n", lanes, s.et.Seconds())
+	return s.sendAll(start, readings)
+}
+
+// finishLine is the position of the farthest timing beam in the layout
+func (s *simulator) finishLine() float64 {
+	var finish float64
+	for _, beamConfig := range s.layout {
+		if !beamConfig.Shutdown && beamConfig.Position > finish {
+			finish = beamConfig.Position
+		}
+	}
+	return finish
+}
+
+// sendRaw sends a reading by channel, wired or not
+func (s *simulator) sendRaw(args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("usage: c <channel> <1|0>")
+	}
+	channel, err := strconv.Atoi(args[0])
+	if err != nil {
+		return fmt.Errorf("invalid channel %q", args[0])
+	}
+	if args[1] != "0" && args[1] != "1" {
+		return fmt.Errorf("invalid state %q", args[1])
+	}
+	return s.send(channel, args[1] == "1", time.Now())
+}
+
+// scriptReading is a reading due at an offset from the start of a script
+// or run
+type scriptReading struct {
+	at      time.Duration
+	channel int
+	broken  bool
+}
+
+// replay sends a script's readings at their offsets. Each line is
+// "<at> <lane> <beam> <1|0>", where at is a duration from the start such
+// as 1.5s; blank lines and lines starting with # are skipped.
+func (s *simulator) replay(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var readings []scriptReading
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		r, err := s.parseScriptLine(text)
+		if err != nil {
+			return fmt.Errorf("%s:%d: %v", path, line, err)
+		}
+		readings = append(readings, r)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return s.sendAll(time.Now(), readings)
+}
+
+// parseScriptLine parses "<at> <lane> <beam> <1|0>"
+func (s *simulator) parseScriptLine(text string) (scriptReading, error) {
+	fields := strings.Fields(text)
+	if len(fields) != 4 {
+		return scriptReading{}, fmt.Errorf("expected \"<at> <lane> <beam> <1|0>\", got %q", text)
+	}
+	at, err := time.ParseDuration(fields[0])
+	if err != nil {
+		return scriptReading{}, fmt.Errorf("invalid offset %q", fields[0])
+	}
+	lane, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return scriptReading{}, fmt.Errorf("invalid lane %q", fields[1])
+	}
+	channel, err := s.channel(lane, fields[2])
+	if err != nil {
+		return scriptReading{}, err
+	}
+	if fields[3] != "0" && fields[3] != "1" {
+		return scriptReading{}, fmt.Errorf("invalid state %q", fields[3])
+	}
+	return scriptReading{at: at, channel: channel, broken: fields[3] == "1"}, nil
+}
+
+// sendAll sends readings in time order, each at its offset from start
+func (s *simulator) sendAll(start time.Time, readings []scriptReading) error {
+	sort.SliceStable(readings, func(i, j int) bool { return readings[i].at < readings[j].at })
+	for _, r := range readings {
+		at := start.Add(r.at)
+		time.Sleep(time.Until(at))
+		if err := s.send(r.channel, r.broken, at); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// channel returns the channel wired to a lane's beam or boundary sensor
+func (s *simulator) channel(lane int, id string) (int, error) {
+	kind := config.ChannelBeam
+	if id == config.BoundaryCenterline || id == config.BoundaryOutside {
+		kind = config.ChannelBoundary
+	}
+	channel, ok := s.hardware.ChannelFor(kind, lane, id)
+	if !ok {
+		return 0, fmt.Errorf("lane %d %s is not in the hardware map", lane, id)
+	}
+	return channel, nil
+}
+
+// send writes one reading in the controller wire format
+func (s *simulator) send(channel int, broken bool, at time.Time) error {
+	state := "0"
+	if broken {
+		state = "1"
+	}
+	line := fmt.Sprintf("%d %s", channel, state)
+	if s.latch {
+		line += fmt.Sprintf(" %d", at.UnixNano())
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.conn.Write([]byte(line + "\n")); err != nil {
+		return err
+	}
+	s.broken[channel] = broken
+	return nil
+}
+
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+	os.Exit(1)
+}
@@ -0,0 +1,249 @@
+// Command dragctl inspects race data, from a running libdragd or from the
+// data a track stored:
+//
+//	dragctl -server http://tower:8080 races -state complete
+//	dragctl -data /var/lib/libdrag slip 3f2a9c
+//	dragctl -data /var/lib/libdrag journal 3f2a9c
+//	dragctl -server http://tower:8080 diff 3f2a9c:1 7b41e0:1
+//	dragctl -server http://tower:8080 tail -race 3f2a9c
+//
+// Races can be named by their full ID, short ID or a unique ID prefix.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/benharold/libdrag/pkg/events"
+	"github.com/benharold/libdrag/pkg/tags"
+)
+
+func usage() {
+	fmt.Fprintln(os.Stderr, `Usage: dragctl [-server URL | -data DIR] <command> [arguments]
+
+Commands:
+  races [-class C] [-session S] [-state S] [-offset N] [-limit N]   list races
+  journal <race>                                                    dump a race's event journal
+  slip <race> [lane]                                                show a formatted time slip
+  diff <race>[:lane] <race>[:lane]                                  compare two runs split by split
+  tail [-race ID] [-type PREFIX]                                    follow live events (server only)
+
+Global flags:`)
+	flag.PrintDefaults()
+}
+
+func main() {
+	server := flag.String("server", "", "base URL of a running libdragd, e.g. http://localhost:8080")
+	dataDir := flag.String("data", "", "directory of a file store holding saved races")
+	archiveDir := flag.String("archive", "", "directory of the archive holding event journals (defaults to -data)")
+	asJSON := flag.Bool("json", false, "print JSON instead of tables")
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+	if (*server == "") == (*dataDir == "") {
+		fail(fmt.Errorf("give either -server or -data"))
+	}
+
+	var src source
+	if *server != "" {
+		src = newServerSource(*server)
+	} else {
+		if *archiveDir == "" {
+			*archiveDir = *dataDir
+		}
+		store, err := newStoreSource(*dataDir, *archiveDir)
+		if err != nil {
+			fail(err)
+		}
+		src = store
+	}
+
+	out := &printer{json: *asJSON}
+	command, args := flag.Arg(0), flag.Args()[1:]
+	var err error
+	switch command {
+	case "races":
+		err = listRaces(src, out, args)
+	case "journal":
+		err = dumpJournal(src, out, args)
+	case "slip":
+		err = showSlip(src, out, args)
+	case "diff":
+		err = diffRuns(src, out, args)
+	case "tail":
+		err = tailEvents(src, out, args)
+	default:
+		usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fail(err)
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "dragctl: %v\n", err)
+	os.Exit(1)
+}
+
+// listRaces prints a page of races
+func listRaces(src source, out *printer, args []string) error {
+	flags := flag.NewFlagSet("races", flag.ExitOnError)
+	query := raceQuery{}
+	flags.StringVar(&query.Class, "class", "", "racing class")
+	flags.StringVar(&query.SessionID, "session", "", "session ID")
+	flags.StringVar(&query.State, "state", "", "race state, e.g. complete or aborted")
+	tagList := flags.String("tag", "", "comma-separated tags the races must have, e.g. qualifying")
+	excludeList := flags.String("exclude-tag", "", "comma-separated tags the races must not have, e.g. test-pass")
+	flags.IntVar(&query.Offset, "offset", 0, "races to skip")
+	flags.IntVar(&query.Limit, "limit", 50, "races to list")
+	flags.Parse(args)
+	query.Tags = tags.Filter{Tags: tags.Split(*tagList), Exclude: tags.Split(*excludeList)}
+
+	races, err := src.Races(query)
+	if err != nil {
+		return err
+	}
+	if out.json {
+		return out.printJSON(races)
+	}
+	out.races(races)
+	return nil
+}
+
+// dumpJournal prints a race's event journal
+func dumpJournal(src source, out *printer, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("journal takes a race")
+	}
+	raceID, err := resolveRace(src, args[0])
+	if err != nil {
+		return err
+	}
+	journal, err := src.Journal(raceID)
+	if err != nil {
+		return err
+	}
+	if out.json {
+		return out.printJSON(journal)
+	}
+	for _, entry := range journal {
+		out.event(entry.Seq, entry.Event)
+	}
+	return nil
+}
+
+// showSlip prints the time slip of each lane of a race, or of one lane
+func showSlip(src source, out *printer, args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return fmt.Errorf("slip takes a race and an optional lane")
+	}
+	raceID, err := resolveRace(src, args[0])
+	if err != nil {
+		return err
+	}
+	race, err := src.Race(raceID)
+	if err != nil {
+		return err
+	}
+	lanes := race.lanes()
+	if len(args) == 2 {
+		lane, err := strconv.Atoi(args[1])
+		if err != nil || race.Runs[lane] == nil {
+			return fmt.Errorf("race %s has no run in lane %s", race.ShortID, args[1])
+		}
+		lanes = []int{lane}
+	}
+	if out.json {
+		runs := make([]*run, 0, len(lanes))
+		for _, lane := range lanes {
+			runs = append(runs, race.Runs[lane])
+		}
+		return out.printJSON(runs)
+	}
+	for i, lane := range lanes {
+		if i > 0 {
+			fmt.Println()
+		}
+		out.slip(race, race.Runs[lane])
+	}
+	return nil
+}
+
+// diffRuns compares two runs split by split
+func diffRuns(src source, out *printer, args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("diff takes two runs, as race[:lane]")
+	}
+	var runs [2]*run
+	var labels [2]string
+	for i, arg := range args {
+		name, laneArg, hasLane := strings.Cut(arg, ":")
+		raceID, err := resolveRace(src, name)
+		if err != nil {
+			return err
+		}
+		race, err := src.Race(raceID)
+		if err != nil {
+			return err
+		}
+		lanes := race.lanes()
+		if len(lanes) == 0 {
+			return fmt.Errorf("race %s has no runs", race.ShortID)
+		}
+		lane := lanes[0]
+		if hasLane {
+			if lane, err = strconv.Atoi(laneArg); err != nil {
+				return fmt.Errorf("invalid lane %q", laneArg)
+			}
+		}
+		if runs[i] = race.Runs[lane]; runs[i] == nil {
+			return fmt.Errorf("race %s has no run in lane %d", race.ShortID, lane)
+		}
+		labels[i] = fmt.Sprintf("%s:%d", race.ShortID, lane)
+	}
+	if out.json {
+		return out.printJSON(runs)
+	}
+	out.diff(labels, runs)
+	return nil
+}
+
+// tailEvents follows live events until interrupted
+func tailEvents(src source, out *printer, args []string) error {
+	flags := flag.NewFlagSet("tail", flag.ExitOnError)
+	race := flags.String("race", "", "only events of this race")
+	prefix := flags.String("type", "", "only event types starting with this, e.g. timing.")
+	flags.Parse(args)
+
+	server, ok := src.(*serverSource)
+	if !ok {
+		return fmt.Errorf("tail needs a running instance (-server)")
+	}
+	raceID := ""
+	if *race != "" {
+		var err error
+		if raceID, err = resolveRace(src, *race); err != nil {
+			return err
+		}
+	}
+	return server.Tail(raceID, func(data []byte) {
+		if out.json {
+			fmt.Println(string(data))
+			return
+		}
+		var e events.Event
+		if err := json.Unmarshal(data, &e); err != nil || !strings.HasPrefix(string(e.Type), *prefix) {
+			return
+		}
+		out.event(0, e)
+	})
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/benharold/libdrag/pkg/events"
+	"github.com/benharold/libdrag/pkg/results"
+	"github.com/benharold/libdrag/pkg/timing"
+)
+
+// split is one line of a time slip
+type split struct {
+	name  string
+	speed bool // Printed in mph rather than seconds
+	value func(r *timing.TimingResults) *float64
+}
+
+// splits are the time slip's lines, in the order a car reaches them
+var splits = []split{
+	{name: "Reaction", value: func(r *timing.TimingResults) *float64 { return r.ReactionTime }},
+	{name: "60 ft", value: func(r *timing.TimingResults) *float64 { return r.SixtyFootTime }},
+	{name: "330 ft", value: func(r *timing.TimingResults) *float64 { return r.ThreeThirtyTime }},
+	{name: "1/8 mile", value: func(r *timing.TimingResults) *float64 { return r.EighthMileTime }},
+	{name: "1/8 mph", speed: true, value: func(r *timing.TimingResults) *float64 { return r.EighthMileSpeed }},
+	{name: "1000 ft", value: func(r *timing.TimingResults) *float64 { return r.ThousandFtTime }},
+	{name: "1/4 mile", value: func(r *timing.TimingResults) *float64 { return r.QuarterMileTime }},
+	{name: "1/4 mph", speed: true, value: func(r *timing.TimingResults) *float64 { return r.TrapSpeed }},
+}
+
+func (s split) format(v float64) string {
+	if s.speed {
+		return fmt.Sprintf("%.2f", v)
+	}
+	return fmt.Sprintf("%.3f", v)
+}
+
+// printer writes command output to stdout
+type printer struct {
+	json bool
+}
+
+func (p *printer) printJSON(v interface{}) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// races prints a race listing as a table
+func (p *printer) races(page racePage) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "RACE\tSHORT\tCLASS\tSESSION\tSTATE\tCREATED\tTAGS")
+	for _, r := range page.Races {
+		created := "-"
+		if !r.CreatedAt.IsZero() {
+			created = r.CreatedAt.Local().Format("2006-01-02 15:04:05")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", r.RaceID, r.ShortID, orDash(r.Class), orDash(r.SessionID), r.State, created, orDash(strings.Join(r.Tags, ",")))
+	}
+	w.Flush()
+	fmt.Printf("%d of %d races\n", len(page.Races), page.Total)
+}
+
+// event prints an event on one line, its data as sorted key=value pairs.
+// A zero seq is left out.
+func (p *printer) event(seq int, e events.Event) {
+	var line strings.Builder
+	if seq > 0 {
+		fmt.Fprintf(&line, "%5d  ", seq)
+	}
+	fmt.Fprintf(&line, "%s  %-28s", e.Timestamp.Local().Format("15:04:05.000"), e.Type)
+	if e.RaceID != "" {
+		fmt.Fprintf(&line, "  race=%s", shortID(e.RaceID))
+	}
+	if e.Lane != 0 {
+		fmt.Fprintf(&line, "  lane=%d", e.Lane)
+	}
+	keys := make([]string, 0, len(e.Data))
+	for key := range e.Data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value, _ := json.Marshal(e.Data[key])
+		fmt.Fprintf(&line, "  %s=%s", key, value)
+	}
+	fmt.Println(line.String())
+}
+
+// slip prints a lane's time slip
+func (p *printer) slip(r *race, lane *run) {
+	fmt.Printf("Race %s  %s  %s\n", r.ShortID, orDash(r.Class), r.State)
+	fmt.Printf("Lane %d  %s  %s\n", lane.Lane, orDash(lane.Driver), orDash(lane.Result))
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	if lane.DialIn != nil {
+		fmt.Fprintf(w, "  Dial-in\t%.3f\n", *lane.DialIn)
+	}
+	for _, s := range splits {
+		if v := s.value(lane.Timing); v != nil {
+			fmt.Fprintf(w, "  %s\t%s\n", s.name, s.format(*v))
+		}
+	}
+	if lane.Package != "" {
+		fmt.Fprintf(w, "  Package\t%s\n", lane.Package)
+	}
+	if lane.Timing.IsFoul {
+		fmt.Fprintf(w, "  Foul\t%s\n", lane.Timing.FoulReason)
+	}
+	if lane.Timing.Breakout {
+		fmt.Fprintf(w, "  Breakout\tyes\n")
+	}
+	if r.Decision != nil {
+		timingResults := make(map[int]*timing.TimingResults, len(r.Runs))
+		for l, run := range r.Runs {
+			timingResults[l] = run.Timing
+		}
+		if margin := results.FormatDecisionMargin(*r.Decision, timingResults); margin != "" {
+			fmt.Fprintf(w, "  Margin\t%s\n", margin)
+		}
+	}
+	w.Flush()
+}
+
+// diff prints two runs side by side, with the second's difference from
+// the first at each split both reached
+func (p *printer) diff(labels [2]string, runs [2]*run) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(w, "\t%s\t%s\tDELTA\t\n", labels[0], labels[1])
+	for _, s := range splits {
+		a, b := s.value(runs[0].Timing), s.value(runs[1].Timing)
+		if a == nil && b == nil {
+			continue
+		}
+		delta := ""
+		if a != nil && b != nil {
+			delta = signed(s, *b-*a)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t\n", s.name, optional(s, a), optional(s, b), delta)
+	}
+	fmt.Fprintf(w, "Result\t%s\t%s\t\t\n", orDash(runs[0].Result), orDash(runs[1].Result))
+	w.Flush()
+}
+
+// signed formats a split difference with its sign
+func signed(s split, v float64) string {
+	if s.speed {
+		return fmt.Sprintf("%+.2f", v)
+	}
+	return fmt.Sprintf("%+.3f", v)
+}
+
+func optional(s split, v *float64) string {
+	if v == nil {
+		return "-"
+	}
+	return s.format(*v)
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,374 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/benharold/libdrag/pkg/export"
+	"github.com/benharold/libdrag/pkg/results"
+	"github.com/benharold/libdrag/pkg/storage"
+	"github.com/benharold/libdrag/pkg/tags"
+	"github.com/benharold/libdrag/pkg/timing"
+	"github.com/benharold/libdrag/pkg/trace"
+)
+
+// source is where dragctl reads races from: a running instance's HTTP API
+// or a track's stored data
+type source interface {
+	Races(query raceQuery) (racePage, error)
+	Race(raceID string) (*race, error)
+	Journal(raceID string) ([]trace.Entry, error)
+}
+
+// raceQuery selects races, like api.RaceQuery
+type raceQuery struct {
+	Class     string
+	SessionID string
+	State     string
+	Tags      tags.Filter
+	Offset    int
+	Limit     int
+}
+
+// racePage is a page of races, like api.RacePage
+type racePage struct {
+	Races []raceSummary `json:"races"`
+	Total int           `json:"total"`
+}
+
+// raceSummary is one race of a listing
+type raceSummary struct {
+	RaceID    string    `json:"race_id"`
+	ShortID   string    `json:"short_id"`
+	Class     string    `json:"class,omitempty"`
+	SessionID string    `json:"session_id,omitempty"`
+	Tags      []string  `json:"tags,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	State     string    `json:"state"`
+}
+
+// race is a race with its runs
+type race struct {
+	raceSummary
+	Decision *results.Decision `json:"decision,omitempty"` // Only known from stored data
+	Runs     map[int]*run      `json:"runs"`
+}
+
+// lanes returns the lanes that ran, in order
+func (r *race) lanes() []int {
+	lanes := make([]int, 0, len(r.Runs))
+	for lane := range r.Runs {
+		lanes = append(lanes, lane)
+	}
+	sort.Ints(lanes)
+	return lanes
+}
+
+// run is one lane's run
+type run struct {
+	Lane    int                   `json:"lane"`
+	Driver  string                `json:"driver,omitempty"`
+	DialIn  *float64              `json:"dial_in,omitempty"`
+	Result  string                `json:"result"` // notify.ResultWin and so on
+	Timing  *timing.TimingResults `json:"timing"`
+	Package string                `json:"package,omitempty"`
+}
+
+// resolvePageSize is how many races are listed at a time to resolve a name
+const resolvePageSize = 500
+
+// resolveRace turns a full race ID, short ID or unique ID prefix into a
+// race ID
+func resolveRace(src source, name string) (string, error) {
+	var matches []string
+	for offset := 0; ; {
+		page, err := src.Races(raceQuery{Offset: offset, Limit: resolvePageSize})
+		if err != nil {
+			return "", err
+		}
+		for _, summary := range page.Races {
+			if summary.RaceID == name || summary.ShortID == name {
+				return summary.RaceID, nil
+			}
+			if strings.HasPrefix(summary.RaceID, name) {
+				matches = append(matches, summary.RaceID)
+			}
+		}
+		offset += len(page.Races)
+		if len(page.Races) == 0 || offset >= page.Total {
+			break
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("no race %q", name)
+	case 1:
+		return matches[0], nil
+	default:
+		return "", fmt.Errorf("race %q is ambiguous: %d races match", name, len(matches))
+	}
+}
+
+// serverSource reads from a running libdragd
+type serverSource struct {
+	base   string
+	client *http.Client
+}
+
+func newServerSource(base string) *serverSource {
+	return &serverSource{base: strings.TrimRight(base, "/"), client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// get decodes the JSON at path into v
+func (s *serverSource) get(path string, v interface{}) error {
+	resp, err := s.client.Get(s.base + path)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(body, &apiErr) == nil && apiErr.Error != "" {
+			return fmt.Errorf("%s: %s", path, apiErr.Error)
+		}
+		return fmt.Errorf("%s: %s", path, resp.Status)
+	}
+	return json.Unmarshal(body, v)
+}
+
+// Races implements source
+func (s *serverSource) Races(query raceQuery) (racePage, error) {
+	params := url.Values{}
+	if query.Class != "" {
+		params.Set("class", query.Class)
+	}
+	if query.SessionID != "" {
+		params.Set("session", query.SessionID)
+	}
+	if query.State != "" {
+		params.Set("state", query.State)
+	}
+	if len(query.Tags.Tags) > 0 {
+		params.Set("tag", strings.Join(query.Tags.Tags, ","))
+	}
+	if len(query.Tags.Exclude) > 0 {
+		params.Set("exclude_tag", strings.Join(query.Tags.Exclude, ","))
+	}
+	if query.Offset > 0 {
+		params.Set("offset", strconv.Itoa(query.Offset))
+	}
+	if query.Limit > 0 {
+		params.Set("limit", strconv.Itoa(query.Limit))
+	}
+	// RaceStatus carries an error interface, so only its state is decoded
+	var page struct {
+		Races []struct {
+			raceSummary
+			Status struct {
+				State string `json:"state"`
+			} `json:"status"`
+		} `json:"races"`
+		Total int `json:"total"`
+	}
+	if err := s.get("/api/races?"+params.Encode(), &page); err != nil {
+		return racePage{}, err
+	}
+	listed := racePage{Races: make([]raceSummary, 0, len(page.Races)), Total: page.Total}
+	for _, r := range page.Races {
+		r.raceSummary.State = r.Status.State
+		listed.Races = append(listed.Races, r.raceSummary)
+	}
+	return listed, nil
+}
+
+// Race implements source. The server publishes results without drivers.
+func (s *serverSource) Race(raceID string) (*race, error) {
+	path := "/api/races/" + url.PathEscape(raceID)
+	var status struct {
+		State string `json:"state"`
+	}
+	if err := s.get(path, &status); err != nil {
+		return nil, err
+	}
+	var timingResults map[int]*timing.TimingResults
+	if err := s.get(path+"/results", &timingResults); err != nil {
+		return nil, err
+	}
+	var records []export.Record
+	if err := s.get(path+"/export", &records); err != nil {
+		return nil, err
+	}
+
+	r := &race{raceSummary: raceSummary{RaceID: raceID, ShortID: shortID(raceID), State: status.State}, Runs: make(map[int]*run)}
+	for lane, result := range timingResults {
+		if result != nil {
+			r.Runs[lane] = &run{Lane: lane, Timing: result, DialIn: result.DialIn}
+		}
+	}
+	for _, record := range records {
+		r.Class, r.SessionID = record.Class, record.SessionID
+		if lane := r.Runs[record.Lane]; lane != nil {
+			lane.Result = record.Result
+		}
+	}
+	return r, nil
+}
+
+// Journal implements source. A running instance does not serve journals.
+func (s *serverSource) Journal(string) ([]trace.Entry, error) {
+	return nil, fmt.Errorf("journals are read from stored data; use -data")
+}
+
+// storeSource reads the races a track saved with StartRaceStorage to a
+// file store, and their journals from a directory archive
+type storeSource struct {
+	store   *storage.FileStore
+	archive *storage.DirArchive
+}
+
+func newStoreSource(dataDir, archiveDir string) (*storeSource, error) {
+	// OpenFileStore creates a missing directory, which only hides a typo here
+	if _, err := os.Stat(dataDir); err != nil {
+		return nil, err
+	}
+	store, err := storage.OpenFileStore(dataDir)
+	if err != nil {
+		return nil, err
+	}
+	return &storeSource{store: store, archive: storage.NewDirArchive(archiveDir)}, nil
+}
+
+// Races implements source
+func (s *storeSource) Races(query raceQuery) (racePage, error) {
+	records, err := s.store.ListRaces(context.Background(), storage.Filter{Class: query.Class, SessionID: query.SessionID, Tags: query.Tags})
+	if err != nil {
+		return racePage{}, err
+	}
+	// Stored records are listed oldest first; the state is filtered here
+	// as the store does not index it
+	page := racePage{Races: make([]raceSummary, 0)}
+	for _, record := range records {
+		if query.State != "" && record.State != query.State {
+			continue
+		}
+		page.Total++
+		if page.Total <= query.Offset || (query.Limit > 0 && len(page.Races) >= query.Limit) {
+			continue
+		}
+		page.Races = append(page.Races, summarize(record))
+	}
+	return page, nil
+}
+
+// Race implements source
+func (s *storeSource) Race(raceID string) (*race, error) {
+	record, err := s.store.GetRace(context.Background(), raceID)
+	if err != nil {
+		return nil, err
+	}
+	r := &race{raceSummary: summarize(record), Runs: make(map[int]*run)}
+
+	// Time trial runs are stored as records of their own, keyed by run ID
+	var probe struct {
+		ID string `json:"id"`
+	}
+	if json.Unmarshal(record.Data, &probe) == nil && probe.ID != "" {
+		var solo struct {
+			Lane         int                   `json:"lane"`
+			Registration string                `json:"registration"`
+			Status       string                `json:"status"`
+			Results      *timing.TimingResults `json:"results"`
+		}
+		if err := json.Unmarshal(record.Data, &solo); err != nil {
+			return nil, err
+		}
+		if solo.Results != nil {
+			r.Runs[solo.Lane] = &run{Lane: solo.Lane, Driver: solo.Registration, Result: solo.Status, Timing: solo.Results, DialIn: solo.Results.DialIn}
+		}
+		return r, nil
+	}
+
+	var stored struct {
+		Results  map[int]*timing.TimingResults `json:"results"`
+		Decision results.Decision              `json:"decision"`
+		DialIns  map[int]float64               `json:"dial_ins"`
+		Drivers  map[int]string                `json:"drivers"`
+	}
+	if err := json.Unmarshal(record.Data, &stored); err != nil {
+		return nil, err
+	}
+	r.Decision = &stored.Decision
+	entrants := make(map[int]export.Entrant, len(stored.Drivers))
+	for lane, driver := range stored.Drivers {
+		entrants[lane] = export.Entrant{Driver: driver}
+	}
+	exported := export.Build(export.Race{
+		RaceID:   raceID,
+		Entrants: entrants,
+		Timing:   stored.Results,
+		Decision: stored.Decision,
+	}, export.Config{})
+	for _, record := range exported {
+		lane := &run{Lane: record.Lane, Driver: record.Driver, Result: record.Result, Timing: stored.Results[record.Lane]}
+		if dial, ok := stored.DialIns[record.Lane]; ok {
+			lane.DialIn = &dial
+			if lane.Timing.ReactionTime != nil && lane.Timing.QuarterMileTime != nil {
+				if total, ok := results.Package(*lane.Timing.ReactionTime, *lane.Timing.QuarterMileTime, dial); ok {
+					lane.Package = results.FormatPackage(total)
+				}
+			}
+		}
+		r.Runs[record.Lane] = lane
+	}
+	return r, nil
+}
+
+// Journal implements source
+func (s *storeSource) Journal(raceID string) ([]trace.Entry, error) {
+	data, err := s.archive.GetObject(context.Background(), "journals/"+raceID+".json")
+	if err != nil {
+		return nil, fmt.Errorf("journal of race %s: %w", raceID, err)
+	}
+	var journal []trace.Entry
+	if err := json.Unmarshal(data, &journal); err != nil {
+		return nil, err
+	}
+	return journal, nil
+}
+
+// summarize lists a stored record
+func summarize(record storage.Record) raceSummary {
+	return raceSummary{
+		RaceID:    record.RaceID,
+		ShortID:   shortID(record.RaceID),
+		Class:     record.Class,
+		SessionID: record.SessionID,
+		Tags:      record.Tags,
+		CreatedAt: record.CreatedAt,
+		State:     record.State,
+	}
+}
+
+// shortID abbreviates a race ID for display when the server's short ID is
+// not at hand
+func shortID(raceID string) string {
+	if len(raceID) > 8 {
+		return raceID[:8]
+	}
+	return raceID
+}
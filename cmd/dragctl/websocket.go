@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+)
+
+// websocketGUID is the fixed key suffix from RFC 6455
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// WebSocket opcodes used by the server
+const (
+	opText  = 0x1
+	opClose = 0x8
+	opPing  = 0x9
+	opPong  = 0xA
+)
+
+// Tail streams the server's events, of one race when raceID is set, to
+// handle until the server closes the stream or dragctl is interrupted
+func (s *serverSource) Tail(raceID string, handle func(data []byte)) error {
+	target, err := url.Parse(s.base + "/api/events")
+	if err != nil {
+		return err
+	}
+	if raceID != "" {
+		target.RawQuery = url.Values{"race_id": {raceID}}.Encode()
+	}
+	if target.Scheme != "http" {
+		return fmt.Errorf("tail supports http:// servers only")
+	}
+	host := target.Host
+	if target.Port() == "" {
+		host = net.JoinHostPort(target.Hostname(), "80")
+	}
+
+	conn, err := net.Dial("tcp", host)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	interrupted := make(chan os.Signal, 1)
+	signal.Notify(interrupted, os.Interrupt)
+	go func() {
+		<-interrupted
+		conn.Close()
+	}()
+
+	rw, err := handshake(conn, target)
+	if err != nil {
+		return err
+	}
+	for {
+		opcode, payload, err := readFrame(rw.Reader)
+		if err != nil {
+			select {
+			case <-interrupted:
+				return nil
+			default:
+			}
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		switch opcode {
+		case opText:
+			handle(payload)
+		case opPing:
+			if err := writeFrame(rw.Writer, opPong, payload); err != nil {
+				return err
+			}
+		case opClose:
+			writeFrame(rw.Writer, opClose, nil)
+			return nil
+		}
+	}
+}
+
+// handshake performs the RFC 6455 opening handshake as the client
+func handshake(conn net.Conn, target *url.URL) (*bufio.ReadWriter, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	key := base64.StdEncoding.EncodeToString(nonce)
+
+	rw := bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn))
+	fmt.Fprintf(rw, "GET %s HTTP/1.1\r\nHost: %s\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Key: %s\r\nSec-WebSocket-Version: 13\r\n\r\n", target.RequestURI(), target.Host, key)
+	if err := rw.Flush(); err != nil {
+		return nil, err
+	}
+
+	resp, err := http.ReadResponse(rw.Reader, &http.Request{Method: http.MethodGet})
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		resp.Body.Close()
+		return nil, fmt.Errorf("event stream: %s", resp.Status)
+	}
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	if resp.Header.Get("Sec-WebSocket-Accept") != base64.StdEncoding.EncodeToString(sum[:]) {
+		return nil, fmt.Errorf("event stream: bad Sec-WebSocket-Accept")
+	}
+	return rw, nil
+}
+
+// readFrame reads one frame from the server, which never masks or
+// fragments its frames
+func readFrame(r *bufio.Reader) (byte, []byte, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, nil, err
+	}
+	opcode := header[0] & 0x0F
+	length := uint64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		ext := make([]byte, 2)
+		if _, err := io.ReadFull(r, ext); err != nil {
+			return 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext))
+	case 127:
+		ext := make([]byte, 8)
+		if _, err := io.ReadFull(r, ext); err != nil {
+			return 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext)
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	return opcode, payload, nil
+}
+
+// writeFrame sends a small control frame, masked as clients must
+func writeFrame(w *bufio.Writer, opcode byte, payload []byte) error {
+	var mask [4]byte
+	if _, err := rand.Read(mask[:]); err != nil {
+		return err
+	}
+	w.Write([]byte{0x80 | opcode, 0x80 | byte(len(payload))})
+	w.Write(mask[:])
+	for i, b := range payload {
+		w.WriteByte(b ^ mask[i%4])
+	}
+	return w.Flush()
+}
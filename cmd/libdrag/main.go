@@ -1,16 +1,27 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"log/slog"
+	"os"
 	"time"
 
 	"github.com/benharold/libdrag/pkg/api"
+	"github.com/benharold/libdrag/pkg/logs"
+	"github.com/benharold/libdrag/pkg/tree"
 )
 
 func main() {
 	fmt.Println("🏁 LIBDRAG - DRAG RACING LIBRARY DEMONSTRATION")
 	fmt.Println("===============================================")
 
+	// Show the library's own progress as the race runs
+	logs.SetDefault(slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+		Level: slog.LevelDebug,
+	})))
+
 	// Create the libdrag API
 	libdragAPI := api.NewLibDragAPI()
 
@@ -36,11 +47,10 @@ func main() {
 	fmt.Println("🔄 Monitoring race progress...")
 
 	// Wait for race to complete
-	for i := 0; i < 100; i++ { // Max 10 seconds
-		if libdragAPI.IsRaceCompleteByID(raceID) {
-			break
-		}
-		time.Sleep(100 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := libdragAPI.WaitForCompletion(ctx, raceID); err != nil {
+		fmt.Printf("⚠️ Race did not complete: %v\n", err)
 	}
 
 	// Display final results
@@ -53,6 +63,11 @@ func main() {
 	treeStatusJSON := libdragAPI.GetTreeStatusJSONByID(raceID)
 	fmt.Printf("\nChristmas Tree Status JSON:\n%s\n", treeStatusJSON)
 
+	var treeStatus tree.Status
+	if err := json.Unmarshal([]byte(treeStatusJSON), &treeStatus); err == nil {
+		fmt.Printf("\nChristmas Tree:\n%s", tree.Render(&treeStatus, tree.StyleEmoji))
+	}
+
 	// Clean shutdown
 	fmt.Println("🛑 Shutting down libdrag system...")
 	libdragAPI.Stop()
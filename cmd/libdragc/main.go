@@ -0,0 +1,214 @@
+// Command libdragc builds libdrag as a C shared library for C, C# (P/Invoke)
+// and Python (ctypes/cffi) over the JSON/string surface of pkg/mobile:
+//
+//	go build -buildmode=c-shared -o libdrag.so ./cmd/libdragc
+//
+// All functions use the cdecl convention. Instances are referenced by the
+// handle libdrag_new returns. Strings returned to the caller are owned by it
+// and must be released with libdrag_free_string. Functions returning an
+// error return NULL on success and the error message otherwise.
+package main
+
+/*
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"unsafe"
+
+	"github.com/benharold/libdrag/pkg/mobile"
+)
+
+var (
+	mu         sync.Mutex
+	instances             = make(map[C.longlong]*mobile.LibDrag)
+	nextHandle C.longlong = 1
+
+	errUnknownHandle = errors.New("unknown libdrag handle")
+)
+
+// instance returns the instance for a handle, or nil
+func instance(handle C.longlong) *mobile.LibDrag {
+	mu.Lock()
+	defer mu.Unlock()
+	return instances[handle]
+}
+
+// cError converts an error to a caller-owned C string (NULL for nil)
+func cError(err error) *C.char {
+	if err == nil {
+		return nil
+	}
+	return C.CString(err.Error())
+}
+
+// errorJSON converts an error to a caller-owned {"error": "..."} C string
+func errorJSON(err error) *C.char {
+	data, _ := json.Marshal(map[string]string{"error": err.Error()})
+	return C.CString(string(data))
+}
+
+// startRaceJSON starts a race and reports its ID or the error as JSON
+func startRaceJSON(l *mobile.LibDrag, optionsJSON string) *C.char {
+	raceID, err := l.StartRaceWithOptions(optionsJSON)
+	if err != nil {
+		return errorJSON(err)
+	}
+	data, _ := json.Marshal(map[string]string{"race_id": raceID})
+	return C.CString(string(data))
+}
+
+//export libdrag_new
+func libdrag_new() C.longlong {
+	mu.Lock()
+	defer mu.Unlock()
+	handle := nextHandle
+	nextHandle++
+	instances[handle] = mobile.New()
+	return handle
+}
+
+//export libdrag_free
+func libdrag_free(handle C.longlong) *C.char {
+	mu.Lock()
+	l := instances[handle]
+	delete(instances, handle)
+	mu.Unlock()
+
+	if l == nil {
+		return cError(errUnknownHandle)
+	}
+	return cError(l.Stop())
+}
+
+//export libdrag_free_string
+func libdrag_free_string(s *C.char) {
+	C.free(unsafe.Pointer(s))
+}
+
+//export libdrag_initialize
+func libdrag_initialize(handle C.longlong) *C.char {
+	l := instance(handle)
+	if l == nil {
+		return cError(errUnknownHandle)
+	}
+	return cError(l.Initialize())
+}
+
+// libdrag_start_race starts a race from JSON race options (NULL or "" for
+// defaults) and returns {"race_id": "..."} or {"error": "..."}
+//
+//export libdrag_start_race
+func libdrag_start_race(handle C.longlong, optionsJSON *C.char) *C.char {
+	l := instance(handle)
+	if l == nil {
+		return errorJSON(errUnknownHandle)
+	}
+	options := ""
+	if optionsJSON != nil {
+		options = C.GoString(optionsJSON)
+	}
+	return startRaceJSON(l, options)
+}
+
+//export libdrag_race_status
+func libdrag_race_status(handle C.longlong, raceID *C.char) *C.char {
+	l := instance(handle)
+	if l == nil {
+		return errorJSON(errUnknownHandle)
+	}
+	return C.CString(l.RaceStatusJSON(C.GoString(raceID)))
+}
+
+//export libdrag_tree_status
+func libdrag_tree_status(handle C.longlong, raceID *C.char) *C.char {
+	l := instance(handle)
+	if l == nil {
+		return errorJSON(errUnknownHandle)
+	}
+	return C.CString(l.TreeStatusJSON(C.GoString(raceID)))
+}
+
+//export libdrag_results
+func libdrag_results(handle C.longlong, raceID *C.char) *C.char {
+	l := instance(handle)
+	if l == nil {
+		return errorJSON(errUnknownHandle)
+	}
+	return C.CString(l.ResultsJSON(C.GoString(raceID)))
+}
+
+//export libdrag_is_race_complete
+func libdrag_is_race_complete(handle C.longlong, raceID *C.char) C.int {
+	l := instance(handle)
+	if l == nil || l.IsRaceComplete(C.GoString(raceID)) {
+		return 1
+	}
+	return 0
+}
+
+// libdrag_wait_for_completion blocks until a race completes, up to
+// timeout_ms (0 = no limit)
+//
+//export libdrag_wait_for_completion
+func libdrag_wait_for_completion(handle C.longlong, raceID *C.char, timeoutMillis C.int) *C.char {
+	l := instance(handle)
+	if l == nil {
+		return cError(errUnknownHandle)
+	}
+	return cError(l.WaitForCompletion(C.GoString(raceID), int(timeoutMillis)))
+}
+
+//export libdrag_arm_tree
+func libdrag_arm_tree(handle C.longlong, raceID *C.char) *C.char {
+	l := instance(handle)
+	if l == nil {
+		return cError(errUnknownHandle)
+	}
+	return cError(l.ArmTree(C.GoString(raceID)))
+}
+
+//export libdrag_disarm_tree
+func libdrag_disarm_tree(handle C.longlong, raceID *C.char) *C.char {
+	l := instance(handle)
+	if l == nil {
+		return cError(errUnknownHandle)
+	}
+	return cError(l.DisarmTree(C.GoString(raceID)))
+}
+
+//export libdrag_abort_race
+func libdrag_abort_race(handle C.longlong, raceID *C.char, reason *C.char) *C.char {
+	l := instance(handle)
+	if l == nil {
+		return cError(errUnknownHandle)
+	}
+	return cError(l.AbortRace(C.GoString(raceID), C.GoString(reason)))
+}
+
+//export libdrag_enable_event_queue
+func libdrag_enable_event_queue(handle C.longlong, capacity C.int) *C.char {
+	l := instance(handle)
+	if l == nil {
+		return cError(errUnknownHandle)
+	}
+	return cError(l.EnableEventQueue(int(capacity)))
+}
+
+// libdrag_poll_events returns up to max queued events (0 = all) as
+// {"events": [...], "dropped": N}
+//
+//export libdrag_poll_events
+func libdrag_poll_events(handle C.longlong, max C.int) *C.char {
+	l := instance(handle)
+	if l == nil {
+		return errorJSON(errUnknownHandle)
+	}
+	return C.CString(l.PollEventsJSON(int(max)))
+}
+
+func main() {}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/benharold/libdrag/pkg/api"
+	"github.com/benharold/libdrag/pkg/beam"
+	"github.com/benharold/libdrag/pkg/config"
+	"github.com/benharold/libdrag/pkg/grpcapi"
+	"github.com/benharold/libdrag/pkg/logs"
+	"github.com/benharold/libdrag/pkg/schedule"
+	"github.com/benharold/libdrag/pkg/server"
+	"github.com/benharold/libdrag/pkg/storage"
+	"github.com/benharold/libdrag/pkg/webhook"
+)
+
+// FacilityConfig is the daemon configuration file format
+type FacilityConfig struct {
+	Facility           string `json:"facility"`
+	Listen             string `json:"listen"`
+	RacingClass        string `json:"racing_class"`
+	TreeType           string `json:"tree_type"` // "pro" or "sportsman"
+	LaneCount          int    `json:"lane_count"`
+	MaxConcurrentRaces int    `json:"max_concurrent_races"`
+	Session            string `json:"session"`            // Initial session for new races
+	DataDir            string `json:"data_dir,omitempty"` // Embedded store for autostart profiles; in memory when empty
+
+	// GRPCListen serves the gRPC API (pkg/grpcapi) on its own address.
+	// gRPC runs over HTTP/2, so it needs TLSCertFile and TLSKeyFile.
+	GRPCListen  string `json:"grpc_listen,omitempty"`
+	TLSCertFile string `json:"tls_cert_file,omitempty"`
+	TLSKeyFile  string `json:"tls_key_file,omitempty"`
+
+	// StateUDPListen serves the race state stream over UDP on its own
+	// address (see server.UDPFeed)
+	StateUDPListen string `json:"state_udp_listen,omitempty"`
+
+	// Schedule opens sessions at set times of day (local time) for races
+	// started without one; an explicit session takes precedence
+	Schedule []schedule.Session `json:"schedule,omitempty"`
+
+	// Hardware maps the timing controller's channels to lanes, beams and
+	// bulbs; a failed sensor is moved to a spare channel here
+	Hardware config.HardwareMap `json:"hardware,omitempty"`
+
+	// BeamSources are the timing controllers the hardware map's channels
+	// are read from (see beam.OpenSource). Their readings time the newest
+	// race started with live beams.
+	BeamSources []beam.SourceConfig `json:"beam_sources,omitempty"`
+
+	// Webhooks posts race results, records and incidents to event
+	// management platforms
+	Webhooks *webhook.Config `json:"webhooks,omitempty"`
+}
+
+// defaultFacilityConfig is used for any setting missing from the file
+func defaultFacilityConfig() FacilityConfig {
+	return FacilityConfig{
+		Facility:           "libdrag",
+		Listen:             ":8080",
+		RacingClass:        "Sportsman",
+		TreeType:           string(config.TreeSequencePro),
+		LaneCount:          2,
+		MaxConcurrentRaces: 10,
+	}
+}
+
+// loadFacilityConfig reads a facility config file over the defaults
+func loadFacilityConfig(path string) (FacilityConfig, error) {
+	cfg := defaultFacilityConfig()
+	if path == "" {
+		return cfg, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, fmt.Errorf("failed to read facility config: %v", err)
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("failed to parse facility config: %v", err)
+	}
+
+	switch config.TreeSequenceType(cfg.TreeType) {
+	case config.TreeSequencePro, config.TreeSequenceSportsman:
+	default:
+		return cfg, fmt.Errorf("invalid tree_type %q", cfg.TreeType)
+	}
+	if cfg.LaneCount < 1 {
+		return cfg, fmt.Errorf("lane_count must be at least 1")
+	}
+	if cfg.GRPCListen != "" && (cfg.TLSCertFile == "" || cfg.TLSKeyFile == "") {
+		return cfg, fmt.Errorf("grpc_listen requires tls_cert_file and tls_key_file")
+	}
+	if err := (schedule.Config{Sessions: cfg.Schedule}).Validate(); err != nil {
+		return cfg, fmt.Errorf("invalid schedule: %v", err)
+	}
+	if err := cfg.Hardware.Validate(cfg.libdragConfig().Track()); err != nil {
+		return cfg, fmt.Errorf("invalid hardware map: %v", err)
+	}
+	if cfg.Webhooks != nil {
+		if err := cfg.Webhooks.Validate(); err != nil {
+			return cfg, fmt.Errorf("invalid webhooks: %v", err)
+		}
+	}
+	return cfg, nil
+}
+
+// libdragConfig converts the facility config to a library configuration
+func (fc FacilityConfig) libdragConfig() *config.DefaultConfig {
+	cfg := config.NewDefaultConfig()
+	cfg.SetRacingClass(fc.RacingClass)
+	cfg.TrackConfig.LaneCount = fc.LaneCount
+	cfg.TrackConfig.Hardware = fc.Hardware
+	cfg.TreeConfig.Type = config.TreeSequenceType(fc.TreeType)
+	if cfg.TreeConfig.Type == config.TreeSequenceSportsman {
+		cfg.TreeConfig.GreenDelay = 500 * time.Millisecond
+	}
+	return cfg
+}
+
+func main() {
+	configPath := flag.String("config", "", "path to facility config file (JSON)")
+	flag.Parse()
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+		Level: slog.LevelInfo,
+	}))
+	slog.SetDefault(logger)
+	logs.SetDefault(logger) // Library records go to the same log
+
+	facility, err := loadFacilityConfig(*configPath)
+	if err != nil {
+		slog.Error("❌ Invalid configuration", "error", err)
+		os.Exit(1)
+	}
+
+	libdragAPI := api.NewLibDragAPI()
+	if err := libdragAPI.InitializeWithConfig(facility.libdragConfig()); err != nil {
+		slog.Error("❌ Failed to initialize libdrag", "error", err)
+		os.Exit(1)
+	}
+	libdragAPI.SetMaxConcurrentRaces(facility.MaxConcurrentRaces)
+	if facility.DataDir != "" {
+		store, err := storage.OpenFileStore(facility.DataDir)
+		if err != nil {
+			slog.Error("❌ Failed to open data directory", "error", err)
+			os.Exit(1)
+		}
+		libdragAPI.SetProfileStore(store)
+		if err := libdragAPI.ApplySavedCalibration(); err != nil {
+			slog.Warn("⚠️ Failed to apply saved calibration", "error", err)
+		}
+	}
+	if len(facility.Schedule) > 0 {
+		if _, err := libdragAPI.StartSessionSchedule(schedule.Config{Sessions: facility.Schedule}); err != nil {
+			slog.Error("❌ Failed to start session schedule", "error", err)
+			os.Exit(1)
+		}
+		slog.Info("📅 Session schedule started", "sessions", len(facility.Schedule))
+	}
+	if facility.Webhooks != nil {
+		if _, err := libdragAPI.StartWebhooks(*facility.Webhooks); err != nil {
+			slog.Error("❌ Failed to start webhooks", "error", err)
+			os.Exit(1)
+		}
+		slog.Info("🪝 Webhooks started", "endpoints", len(facility.Webhooks.Endpoints))
+	}
+
+	sourceCtx, stopSources := context.WithCancel(context.Background())
+	defer stopSources()
+	for _, sourceConfig := range facility.BeamSources {
+		src, err := beam.OpenSource(sourceConfig)
+		if err != nil {
+			slog.Error("❌ Failed to open beam source", "driver", sourceConfig.Driver, "address", sourceConfig.Address, "error", err)
+			os.Exit(1)
+		}
+		go func(sourceConfig beam.SourceConfig) {
+			slog.Info("📡 Beam source attached", "driver", sourceConfig.Driver, "address", sourceConfig.Address)
+			if err := libdragAPI.AttachBeamSource(sourceCtx, src); err != nil && sourceCtx.Err() == nil {
+				slog.Error("❌ Beam source failed", "driver", sourceConfig.Driver, "address", sourceConfig.Address, "error", err)
+			}
+		}(sourceConfig)
+	}
+
+	handler := server.NewServer(libdragAPI, facility.Facility)
+	handler.SetSession(facility.Session)
+
+	httpServer := &http.Server{
+		Addr:    facility.Listen,
+		Handler: handler,
+	}
+
+	go func() {
+		slog.Info("🏁 libdragd listening", "facility", facility.Facility, "addr", facility.Listen)
+		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			slog.Error("❌ HTTP server failed", "error", err)
+			os.Exit(1)
+		}
+	}()
+
+	var grpcServer *http.Server
+	if facility.GRPCListen != "" {
+		grpcServer = &http.Server{
+			Addr:    facility.GRPCListen,
+			Handler: grpcapi.NewServer(libdragAPI),
+		}
+		go func() {
+			slog.Info("🏁 libdragd gRPC listening", "addr", facility.GRPCListen)
+			if err := grpcServer.ListenAndServeTLS(facility.TLSCertFile, facility.TLSKeyFile); err != nil && err != http.ErrServerClosed {
+				slog.Error("❌ gRPC server failed", "error", err)
+				os.Exit(1)
+			}
+		}()
+	}
+
+	var udpConn net.PacketConn
+	if facility.StateUDPListen != "" {
+		udpConn, err = net.ListenPacket("udp", facility.StateUDPListen)
+		if err != nil {
+			slog.Error("❌ Failed to listen for UDP state clients", "error", err)
+			os.Exit(1)
+		}
+		feed := handler.NewUDPFeed(udpConn)
+		go func() {
+			slog.Info("🏁 libdragd UDP state feed listening", "addr", facility.StateUDPListen)
+			if err := feed.Serve(context.Background()); err != nil && !errors.Is(err, net.ErrClosed) {
+				slog.Error("❌ UDP state feed failed", "error", err)
+			}
+		}()
+	}
+
+	// Wait for shutdown signal
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	<-signals
+
+	slog.Info("🔧 Shutting down libdragd...")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := httpServer.Shutdown(ctx); err != nil {
+		slog.Error("❌ HTTP shutdown failed", "error", err)
+	}
+	if grpcServer != nil {
+		// Event streams only end when their clients cancel, so close them
+		if err := grpcServer.Close(); err != nil {
+			slog.Error("❌ gRPC shutdown failed", "error", err)
+		}
+	}
+	if udpConn != nil {
+		udpConn.Close()
+	}
+	stopSources()
+	if err := libdragAPI.Stop(); err != nil {
+		slog.Error("❌ Failed to shutdown cleanly", "error", err)
+	}
+	slog.Info("✅ libdragd shutdown complete")
+}
@@ -0,0 +1,136 @@
+//go:build js && wasm
+
+// Command libdragwasm builds libdrag for the browser, so practice trees and
+// visualizations run the same tree, timing and simulation logic as the
+// track. It exposes the JSON surface of pkg/mobile as a global `libdrag`
+// object:
+//
+//	GOOS=js GOARCH=wasm go build -o libdrag.wasm ./cmd/libdragwasm
+//
+//	const go = new Go();
+//	const { instance } = await WebAssembly.instantiateStreaming(fetch("libdrag.wasm"), go.importObject);
+//	go.run(instance);
+//	libdrag.initialize();
+//	const { race_id } = JSON.parse(libdrag.startRace('{"class": "Super Pro"}'));
+//	const unsubscribe = libdrag.subscribe("", (event) => console.log(JSON.parse(event)));
+//
+// Functions returning an error return null on success and the message
+// otherwise; data functions return JSON strings.
+package main
+
+import (
+	"encoding/json"
+	"syscall/js"
+
+	"github.com/benharold/libdrag/pkg/mobile"
+)
+
+// listener forwards events to a JS callback
+type listener struct {
+	callback js.Value
+}
+
+func (l listener) OnEvent(eventJSON string) {
+	l.callback.Invoke(eventJSON)
+}
+
+func (l listener) OnRaceDone(raceID string, errMessage string) {
+	if errMessage == "" {
+		l.callback.Invoke(raceID, js.Null())
+		return
+	}
+	l.callback.Invoke(raceID, errMessage)
+}
+
+// jsError converts an error to null or its message
+func jsError(err error) interface{} {
+	if err == nil {
+		return nil
+	}
+	return err.Error()
+}
+
+// arg returns args[i] as a string, or "" when missing
+func arg(args []js.Value, i int) string {
+	if i >= len(args) || args[i].Type() != js.TypeString {
+		return ""
+	}
+	return args[i].String()
+}
+
+func main() {
+	l := mobile.New()
+
+	api := map[string]interface{}{
+		"initialize": js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+			return jsError(l.Initialize())
+		}),
+		"stop": js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+			return jsError(l.Stop())
+		}),
+		"startRace": js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+			raceID, err := l.StartRaceWithOptions(arg(args, 0))
+			if err != nil {
+				data, _ := json.Marshal(map[string]string{"error": err.Error()})
+				return string(data)
+			}
+			data, _ := json.Marshal(map[string]string{"race_id": raceID})
+			return string(data)
+		}),
+		"raceStatus": js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+			return l.RaceStatusJSON(arg(args, 0))
+		}),
+		"treeStatus": js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+			return l.TreeStatusJSON(arg(args, 0))
+		}),
+		"treeCanvas": js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+			return l.TreeCanvasJSON(arg(args, 0))
+		}),
+		"results": js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+			return l.ResultsJSON(arg(args, 0))
+		}),
+		"isRaceComplete": js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+			return l.IsRaceComplete(arg(args, 0))
+		}),
+		// onRaceDone(raceID, callback) calls back once with the race ID and
+		// null when the race completes, or why it did not; it returns an
+		// error message, or null once waiting
+		"onRaceDone": js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+			if len(args) < 2 || args[1].Type() != js.TypeFunction {
+				return "a callback is required"
+			}
+			_, err := l.OnRaceDone(arg(args, 0), listener{callback: args[1]})
+			return jsError(err)
+		}),
+		"armTree": js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+			return jsError(l.ArmTree(arg(args, 0)))
+		}),
+		"disarmTree": js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+			return jsError(l.DisarmTree(arg(args, 0)))
+		}),
+		"abortRace": js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+			return jsError(l.AbortRace(arg(args, 0), arg(args, 1)))
+		}),
+		// subscribe(type, callback) delivers events of one type ("" for all)
+		// as JSON and returns a function that unsubscribes, or null without
+		// a callback
+		"subscribe": js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+			if len(args) < 2 || args[1].Type() != js.TypeFunction {
+				return js.Null()
+			}
+			sub := l.Subscribe(arg(args, 0), listener{callback: args[1]})
+			var unsubscribe js.Func
+			unsubscribe = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+				sub.Cancel()
+				unsubscribe.Release()
+				return nil
+			})
+			return unsubscribe
+		}),
+	}
+
+	js.Global().Set("libdrag", js.ValueOf(api))
+
+	// Keep the module alive for callbacks
+	select {}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/benharold/libdrag/pkg/api"
+	"github.com/benharold/libdrag/pkg/events"
+	"github.com/benharold/libdrag/pkg/logs"
+	"github.com/benharold/libdrag/pkg/orchestrator"
+	"github.com/benharold/libdrag/pkg/tree"
+)
+
+// betweenRounds is the longest burnout, backup and approach of a pair
+// started with "nb"
+var betweenRounds = orchestrator.PreStagingConfig{
+	Burnout:  30 * time.Second,
+	Backup:   20 * time.Second,
+	Approach: 30 * time.Second,
+}
+
+// starterConsole is a line-driven starter's console for a single lane pair
+type starterConsole struct {
+	api      *api.LibDragAPI
+	raceID   string
+	override bool
+	held     map[int]bool
+}
+
+func main() {
+	fmt.Println("🏁 LIBDRAG STARTER CONSOLE")
+	fmt.Println("==========================")
+
+	// The console shows events itself; keep only the library's warnings
+	logs.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelWarn,
+	})))
+
+	libdragAPI := api.NewLibDragAPI()
+	if err := libdragAPI.Initialize(); err != nil {
+		fmt.Printf("❌ Failed to initialize libdrag: %v\n", err)
+		os.Exit(1)
+	}
+	defer libdragAPI.Stop()
+
+	console := &starterConsole{api: libdragAPI, held: make(map[int]bool)}
+
+	// Show tree and race events for the active race as they happen
+	libdragAPI.SubscribeAll(func(e events.Event) {
+		if e.RaceID == "" || e.RaceID != console.raceID {
+			return
+		}
+		switch e.Type {
+		case events.EventTreeArmed, events.EventTreeDisarmed, events.EventTreeGreenOn,
+			events.EventTreeRedLight, events.EventRaceAbort, events.EventRaceComplete,
+			events.EventTreeDeepStageViolation, events.EventTreeStagingViolation,
+			events.EventStarterLaneHold, events.EventStarterDisqualify,
+			events.EventRaceBurnout, events.EventRaceBackup, events.EventRaceApproach:
+			fmt.Printf("📡 %s %s\n", e.Type, laneLabel(e.Lane))
+		}
+	})
+
+	console.printHelp()
+	scanner := bufio.NewScanner(os.Stdin)
+	for {
+		fmt.Print("starter> ")
+		if !scanner.Scan() {
+			return
+		}
+		if quit := console.handle(strings.TrimSpace(scanner.Text())); quit {
+			return
+		}
+	}
+}
+
+// handle runs one console command and reports whether to quit
+func (sc *starterConsole) handle(command string) bool {
+	var err error
+
+	switch command {
+	case "":
+		sc.printStatus()
+	case "n", "nb":
+		opts := api.RaceOptions{}
+		if command == "nb" {
+			opts.PreStaging = &betweenRounds
+		}
+		sc.raceID, err = sc.api.StartRaceWithOptions(opts)
+		sc.override = false
+		sc.held = make(map[int]bool)
+		if err == nil {
+			fmt.Printf("🚗 New pair on the line: %s\n", sc.api.GetShortRaceID(sc.raceID))
+		}
+	case "a":
+		err = sc.requireRace(sc.api.ArmTreeByID)
+	case "d":
+		err = sc.requireRace(sc.api.DisarmTreeByID)
+	case "o":
+		err = sc.requireRace(func(raceID string) error {
+			sc.override = !sc.override
+			return sc.api.SetStarterOverrideByID(raceID, sc.override)
+		})
+		if err == nil {
+			fmt.Printf("✋ Starter override: %v\n", sc.override)
+		}
+	case "t":
+		err = sc.requireRace(sc.api.TriggerTreeByID)
+	case "p":
+		err = sc.requireRace(sc.api.AdvancePhaseByID)
+	case "1", "2":
+		lane := int(command[0] - '0')
+		err = sc.requireRace(func(raceID string) error {
+			return sc.api.HoldLaneByID(raceID, lane, !sc.held[lane])
+		})
+		if err == nil {
+			sc.held[lane] = !sc.held[lane]
+			fmt.Printf("✋ Lane %d held: %v\n", lane, sc.held[lane])
+		}
+	case "dq1", "dq2":
+		lane := int(command[2] - '0')
+		err = sc.requireRace(func(raceID string) error {
+			return sc.api.DisqualifyLaneByID(raceID, lane, "starter disqualification")
+		})
+		if err == nil {
+			sc.held[lane] = false
+		}
+	case "x":
+		err = sc.requireRace(func(raceID string) error {
+			return sc.api.AbortRaceByID(raceID, "starter abort")
+		})
+	case "s":
+		sc.printStatus()
+	case "h", "?":
+		sc.printHelp()
+	case "q":
+		return true
+	default:
+		fmt.Printf("Unknown command %q (h for help)\n", command)
+	}
+
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+	}
+	return false
+}
+
+// requireRace runs fn against the active race
+func (sc *starterConsole) requireRace(fn func(raceID string) error) error {
+	if sc.raceID == "" {
+		return fmt.Errorf("no active race (n to start one)")
+	}
+	return fn(sc.raceID)
+}
+
+func (sc *starterConsole) printHelp() {
+	fmt.Println("Commands (press Enter after each key):")
+	fmt.Println("  n  new race        a  arm tree        d  disarm tree")
+	fmt.Println("  nb new race with burnout             p  end burnout/backup/approach")
+	fmt.Println("  o  toggle override t  fire tree (override)")
+	fmt.Println("  1  hold lane 1     2  hold lane 2     dq1/dq2  disqualify a lane")
+	fmt.Println("  x  abort race      s  status          q  quit")
+}
+
+// printStatus renders the race state and lights for each lane
+func (sc *starterConsole) printStatus() {
+	if sc.raceID == "" {
+		fmt.Println("No active race")
+		return
+	}
+
+	var race struct {
+		State        string `json:"state"`
+		HeldLanes    []int  `json:"held_lanes"`
+		Disqualified []int  `json:"disqualified"`
+	}
+	json.Unmarshal([]byte(sc.api.GetRaceStatusJSONByID(sc.raceID)), &race)
+
+	var treeStatus tree.Status
+	json.Unmarshal([]byte(sc.api.GetTreeStatusJSONByID(sc.raceID)), &treeStatus)
+
+	fmt.Printf("Race %s  state=%s  armed=%v  activated=%v  override=%v  held=%v  disqualified=%v\n",
+		sc.api.GetShortRaceID(sc.raceID), race.State, treeStatus.Armed, treeStatus.Activated, sc.override, race.HeldLanes, race.Disqualified)
+
+	for _, line := range strings.Split(strings.TrimRight(tree.Render(&treeStatus, tree.StyleEmoji), "\n"), "\n") {
+		fmt.Printf("  %s\n", line)
+	}
+}
+
+func laneLabel(lane int) string {
+	if lane == 0 {
+		return ""
+	}
+	return fmt.Sprintf("(lane %d)", lane)
+}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/benharold/libdrag/pkg/api"
 	"github.com/benharold/libdrag/pkg/events"
+	"github.com/benharold/libdrag/pkg/logs"
 )
 
 // NewLibDrag creates a new libdrag instance (for mobile bindings)
@@ -21,6 +22,7 @@ func main() {
 		Level: slog.LevelInfo,
 	}))
 	slog.SetDefault(logger)
+	logs.SetDefault(logger) // Library records go to the same log
 
 	slog.Info("🏁 LIBDRAG - DRAG RACING LIBRARY")
 	slog.Info("=================================")
@@ -107,19 +109,30 @@ func main() {
 	// Monitor race progress
 	slog.Info("🔄 Monitoring race progress...")
 
-	// Wait for race to complete
-	for i := 0; i < 100; i++ { // Max 10 seconds
-		if libdragAPI.IsRaceCompleteByID(raceID) {
-			break
-		}
-
-		// Show status updates
-		if i%10 == 0 {
+	// Wait for race to complete, showing status updates meanwhile
+	done := make(chan error, 1)
+	if _, err := libdragAPI.OnRaceDone(raceID, func(err error) { done <- err }); err != nil {
+		slog.Error("❌ Failed to watch race", "error", err)
+		os.Exit(1)
+	}
+	statusTicker := time.NewTicker(time.Second)
+	defer statusTicker.Stop()
+	timeout := time.After(10 * time.Second)
+wait:
+	for {
+		select {
+		case err := <-done:
+			if err != nil {
+				slog.Warn("⚠️ Race did not complete", "error", err)
+			}
+			break wait
+		case <-statusTicker.C:
 			status := libdragAPI.GetRaceStatusJSONByID(raceID)
 			slog.Info("📊 Race Status", "status", status)
+		case <-timeout:
+			slog.Warn("⚠️ Race did not complete within 10 seconds")
+			break wait
 		}
-
-		time.Sleep(100 * time.Millisecond)
 	}
 
 	// Display final results
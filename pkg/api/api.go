@@ -4,18 +4,40 @@ import (
 	"context"
 	"crypto/md5"
 	"encoding/binary"
-	"encoding/json"
 	"fmt"
+	"log/slog"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/benharold/libdrag/internal/vehicle"
+	"github.com/benharold/libdrag/pkg/assist"
+	"github.com/benharold/libdrag/pkg/audit"
+	"github.com/benharold/libdrag/pkg/beam"
+	"github.com/benharold/libdrag/pkg/calibration"
 	"github.com/benharold/libdrag/pkg/component"
 	"github.com/benharold/libdrag/pkg/config"
+	"github.com/benharold/libdrag/pkg/eliminations"
 	"github.com/benharold/libdrag/pkg/events"
+	"github.com/benharold/libdrag/pkg/logs"
+	"github.com/benharold/libdrag/pkg/notify"
 	"github.com/benharold/libdrag/pkg/orchestrator"
+	"github.com/benharold/libdrag/pkg/practice"
+	"github.com/benharold/libdrag/pkg/records"
+	"github.com/benharold/libdrag/pkg/results"
+	"github.com/benharold/libdrag/pkg/rules"
+	"github.com/benharold/libdrag/pkg/schedule"
+	"github.com/benharold/libdrag/pkg/scoreboard"
+	"github.com/benharold/libdrag/pkg/simulation"
+	"github.com/benharold/libdrag/pkg/slips"
+	"github.com/benharold/libdrag/pkg/stats"
+	"github.com/benharold/libdrag/pkg/storage"
+	"github.com/benharold/libdrag/pkg/tags"
+	"github.com/benharold/libdrag/pkg/timers"
+	"github.com/benharold/libdrag/pkg/timetrial"
 	"github.com/benharold/libdrag/pkg/timing"
 	"github.com/benharold/libdrag/pkg/tree"
+	"github.com/benharold/libdrag/pkg/webhook"
 	"github.com/google/uuid"
 	"github.com/speps/go-hashids/v2"
 )
@@ -23,27 +45,67 @@ import (
 // LibDragAPI provides a mobile-friendly interface
 type LibDragAPI struct {
 	orchestrators      map[string]*orchestrator.RaceOrchestrator
+	raceInfo           map[string]raceInfo
 	mu                 sync.RWMutex
 	maxConcurrentRaces int
 	globalConfig       config.Config
 	initialized        bool
 	eventBus           *events.EventBus
+	syncRecorders      []timing.SyncRecorder
+	trackClear         TrackClearStatus
+	audit              *audit.Log
+	schedule           *schedule.Scheduler
+	profiles           storage.ProfileStore
+	bracket            *eliminations.Bracket
+	records            *records.Book
+	stopRecords        func()
+	requests           map[string]startedRequest // Request ID -> race it started
+	clock              timers.Clock              // Races run on the default wheel when nil
+	rules              *rules.Engine             // Races use rules.Default when nil
+	calibration        *calibration.Wizard
+	timeTrials         *timetrial.Session
+	practice           *practice.Session
+	webhooks           *webhook.Dispatcher
+	slips              *slips.Spooler
+	stopSlips          func()
+	wrapComponent      func(component.Component) component.Component // Applied to each race's components when set
+	documents          *documentCache                                // Race documents served to pollers
+	raceStores         []*RaceStorageConfig                          // Stores saving races, for TagRaceByID
+	logger             atomic.Pointer[slog.Logger]                   // Nil logs to logs.Default; read from handlers that may hold api.mu
+	raceCleanups       map[string]map[int]func()                     // Race ID -> run when the race is removed, with api.mu held
+	nextCleanup        int
+	liveRace           string // Newest race run from live beams, fed by attached beam sources
 }
 
 func NewLibDragAPI() *LibDragAPI {
 	return &LibDragAPI{
 		orchestrators:      make(map[string]*orchestrator.RaceOrchestrator),
+		raceInfo:           make(map[string]raceInfo),
+		requests:           make(map[string]startedRequest),
 		maxConcurrentRaces: 10, // Default limit
+		audit:              audit.NewLog(maxAuditEntries),
+		profiles:           storage.NewMemoryStore(),
+		documents:          newDocumentCache(),
+		raceCleanups:       make(map[string]map[int]func()),
 	}
 }
 
 // Initialize the libdrag system
 func (api *LibDragAPI) Initialize() error {
+	return api.InitializeWithConfig(config.NewDefaultConfig())
+}
+
+// InitializeWithConfig initializes the libdrag system with a custom configuration
+func (api *LibDragAPI) InitializeWithConfig(cfg config.Config) error {
 	api.mu.Lock()
 	defer api.mu.Unlock()
 
-	// Create global configuration
-	api.globalConfig = config.NewDefaultConfig()
+	if cfg == nil {
+		return fmt.Errorf("configuration is required")
+	}
+
+	// Set global configuration
+	api.globalConfig = cfg
 
 	// Create event bus in async mode for better performance
 	api.eventBus = events.NewEventBus(true)
@@ -55,6 +117,12 @@ func (api *LibDragAPI) Initialize() error {
 
 // StartRaceWithID starts a new drag race and returns a unique race ID
 func (api *LibDragAPI) StartRaceWithID() (string, error) {
+	return api.StartRaceWithOptions(RaceOptions{})
+}
+
+// StartRaceWithOptions starts a new drag race tagged with the given class and
+// session and returns a unique race ID
+func (api *LibDragAPI) StartRaceWithOptions(opts RaceOptions) (string, error) {
 	api.mu.Lock()
 	defer api.mu.Unlock()
 
@@ -62,36 +130,150 @@ func (api *LibDragAPI) StartRaceWithID() (string, error) {
 		return "", fmt.Errorf("API not initialized")
 	}
 
+	// A retried request gets the race it already started
+	if opts.RequestID != "" {
+		api.pruneRequests()
+		if started, ok := api.requests[opts.RequestID]; ok {
+			return started.raceID, nil
+		}
+	}
+
 	// Check concurrent race limit
 	if len(api.orchestrators) >= api.maxConcurrentRaces {
 		return "", fmt.Errorf("maximum concurrent races (%d) reached", api.maxConcurrentRaces)
 	}
 
+	api.applySchedule(&opts)
+	for name, id := range opts.ExternalIDs {
+		if name == "" || id == "" {
+			return "", fmt.Errorf("external IDs need a name and an ID")
+		}
+	}
+	raceTags, err := tags.Normalize(opts.Tags)
+	if err != nil {
+		return "", err
+	}
+
+	if len(opts.Matchup) > 0 && opts.Simulator == nil {
+		matchup, err := simulation.NewMatchup(timers.Or(api.clock).Now().UnixNano(), opts.Matchup...)
+		if err != nil {
+			return "", err
+		}
+		opts.Simulator = matchup
+	}
+
 	// Generate unique race ID
 	raceID := uuid.New().String()
 
+	// The new race's tree is armed as it starts
+	if err := api.checkArmInterlock(raceID, opts.Override); err != nil {
+		return "", err
+	}
+
 	// Create new orchestrator for this race
 	raceOrchestrator := orchestrator.NewRaceOrchestrator()
 	raceOrchestrator.SetEventBus(api.eventBus)
 	raceOrchestrator.SetRaceID(raceID)
+	if api.clock != nil {
+		raceOrchestrator.SetClock(api.clock)
+	}
+	if logger := api.logger.Load(); logger != nil {
+		raceOrchestrator.SetLogger(logger)
+	}
+	if api.rules != nil {
+		raceOrchestrator.SetRules(api.rules)
+	}
+	if opts.PreStaging != nil {
+		raceOrchestrator.SetPreStaging(*opts.PreStaging)
+	}
+	if opts.LiveBeams {
+		raceOrchestrator.SetSimulator(nil)
+	} else if opts.Simulator != nil {
+		raceOrchestrator.SetSimulator(opts.Simulator)
+	}
 
 	// Create components for this race with race ID context
 	timingSystem := timing.NewTimingSystemWithRaceID(raceID)
+	for _, recorder := range api.syncRecorders {
+		timingSystem.AddSyncRecorder(recorder)
+	}
+	if len(opts.Licenses) > 0 {
+		timingSystem.SetLicenses(opts.Licenses)
+	}
 	christmasTree := tree.NewChristmasTree()
 
 	components := []component.Component{
 		timingSystem,
 		christmasTree,
 	}
+	if api.wrapComponent != nil {
+		for i, comp := range components {
+			components[i] = api.wrapComponent(comp)
+		}
+	}
+
+	// Use a per-race class when one is requested
+	raceConfig := api.globalConfig
+	if opts.Class != "" {
+		raceConfig = classConfig{Config: api.globalConfig, class: opts.Class}
+	}
+	// The class races on its tree preset, unless the track runs without a
+	// tree
+	if preset := rules.Or(api.rules).TreePreset(raceConfig.RacingClass()); preset != "" && raceConfig.Tree().Type != config.TreeSequenceStartSignal {
+		raceConfig = treeConfig{Config: raceConfig, tree: raceConfig.Tree().Override(config.TreeSequenceConfig{Preset: preset})}
+	}
+	if opts.Tree != nil {
+		switch opts.Tree.Type {
+		case "", config.TreeSequencePro, config.TreeSequenceSportsman, config.TreeSequenceStartSignal:
+		default:
+			return "", fmt.Errorf("unknown tree type %q", opts.Tree.Type)
+		}
+		if opts.Tree.Preset != "" {
+			if _, err := config.TreePresetConfig(opts.Tree.Preset); err != nil {
+				return "", err
+			}
+		}
+		raceConfig = treeConfig{Config: raceConfig, tree: raceConfig.Tree().Override(*opts.Tree)}
+	}
+
+	// Resolve the race's autostart profile, by name or by class
+	autoStart, err := resolveAutoStartConfig(api.profiles, raceConfig.RacingClass(), opts.AutoStartProfile)
+	if err != nil {
+		return "", err
+	}
+	if autoStart.TreeSequenceType == "" {
+		autoStart.TreeSequenceType = raceConfig.Tree().Type
+	}
 
 	// Initialize the race orchestrator
 	ctx := context.Background()
-	if err := raceOrchestrator.Initialize(ctx, components, api.globalConfig); err != nil {
+	if err := raceOrchestrator.Initialize(ctx, components, raceConfig); err != nil {
 		return "", fmt.Errorf("failed to initialize race orchestrator: %v", err)
 	}
+	if err := api.assignBracketPair(raceID, opts); err != nil {
+		return "", err
+	}
 
 	// Store the orchestrator
 	api.orchestrators[raceID] = raceOrchestrator
+	api.raceInfo[raceID] = raceInfo{
+		class:      raceConfig.RacingClass(),
+		sessionID:  opts.SessionID,
+		starter:    opts.Starter,
+		drivers:    copyDrivers(opts.Drivers),
+		licenses:   copyDrivers(opts.Licenses),
+		carNumbers: copyDrivers(opts.CarNumbers),
+		external:   copyExternalIDs(opts.ExternalIDs),
+		tags:       raceTags,
+		autoStart:  autoStart,
+		createdAt:  timers.Or(api.clock).Now(),
+	}
+	if opts.LiveBeams {
+		api.liveRace = raceID
+	}
+
+	// Every event of the race carries its external IDs, from race.start on
+	api.eventBus.SetExternalIDs(raceID, opts.ExternalIDs)
 
 	// Arm the race
 	leftVehicle := vehicle.NewSimpleVehicle(1)
@@ -99,22 +281,45 @@ func (api *LibDragAPI) StartRaceWithID() (string, error) {
 
 	if err := raceOrchestrator.StartRace(leftVehicle, rightVehicle); err != nil {
 		// Clean up on failure
-		delete(api.orchestrators, raceID)
+		api.removeRace(raceID)
 		return "", err
 	}
 
+	if opts.RequestID != "" {
+		api.requests[opts.RequestID] = startedRequest{raceID: raceID, at: timers.Or(api.clock).Now()}
+	}
+
 	// Arm goroutine to clean up completed races
 	go api.monitorRaceCompletion(raceID)
 
 	return raceID, nil
 }
 
+// pruneRequests forgets request IDs older than RequestIDTTL. Must be called
+// with api.mu held.
+func (api *LibDragAPI) pruneRequests() {
+	cutoff := timers.Or(api.clock).Now().Add(-RequestIDTTL)
+	for requestID, started := range api.requests {
+		if started.at.Before(cutoff) {
+			delete(api.requests, requestID)
+		}
+	}
+}
+
 // monitorRaceCompletion monitors a race and cleans up when complete
 func (api *LibDragAPI) monitorRaceCompletion(raceID string) {
-	ticker := time.NewTicker(500 * time.Millisecond)
+	api.mu.RLock()
+	wheel := timers.Or(api.clock)
+	api.mu.RUnlock()
+
+	ticker := wheel.NewTicker(500*time.Millisecond, timers.Label{Name: "api.race_monitor", RaceID: raceID})
 	defer ticker.Stop()
 
-	timeout := time.After(30 * time.Second) // Maximum race duration
+	timeout := make(chan struct{})
+	timeoutTimer := wheel.AfterFunc(30*time.Second, timers.Label{Name: "api.race_timeout", RaceID: raceID}, func() { // Maximum race duration
+		close(timeout)
+	})
+	defer timeoutTimer.Stop()
 
 	for {
 		select {
@@ -123,9 +328,12 @@ func (api *LibDragAPI) monitorRaceCompletion(raceID string) {
 			api.CompleteRace(raceID)
 			return
 		case <-ticker.C:
+			if !api.RaceExists(raceID) {
+				return // Removed, or the API stopped
+			}
 			if api.IsRaceCompleteByID(raceID) {
 				// Wait a bit longer to allow final status updates
-				time.Sleep(1 * time.Second)
+				wheel.Sleep(1*time.Second, timers.Label{Name: "api.race_settle", RaceID: raceID})
 				return // Race completed naturally
 			}
 		}
@@ -135,48 +343,95 @@ func (api *LibDragAPI) monitorRaceCompletion(raceID string) {
 // GetRaceStatusJSON returns race status as JSON (legacy method)
 // GetRaceStatusJSONByID returns race status as JSON for a specific race
 func (api *LibDragAPI) GetRaceStatusJSONByID(raceID string) string {
-	api.mu.RLock()
-	defer api.mu.RUnlock()
-
-	orchestrator, exists := api.orchestrators[raceID]
-	if !exists {
-		return "{\"error\":\"race not found\"}"
-	}
-
-	status := orchestrator.GetRaceStatus()
-	jsonData, _ := json.Marshal(status)
-	return string(jsonData)
+	return api.raceDocumentJSON(raceID, DocumentRaceStatus)
 }
 
 // GetTreeStatusJSONByID returns christmas tree status as JSON for a specific race
 func (api *LibDragAPI) GetTreeStatusJSONByID(raceID string) string {
-	api.mu.RLock()
-	defer api.mu.RUnlock()
+	return api.raceDocumentJSON(raceID, DocumentTreeStatus)
+}
 
-	orchestrator, exists := api.orchestrators[raceID]
-	if !exists {
-		return "{\"error\":\"race not found\"}"
+// GetTreeCanvasJSONByID returns a race's christmas tree laid out on a grid
+// (tree.Canvas) as JSON, for simple web UIs
+func (api *LibDragAPI) GetTreeCanvasJSONByID(raceID string) string {
+	return api.raceDocumentJSON(raceID, DocumentTreeCanvas)
+}
+
+// GetStagingMotionByID returns each lane's staging beam motions for a race
+// (entering, backing out of and re-entering stage), for officials reviewing
+// staging violations and protests
+func (api *LibDragAPI) GetStagingMotionByID(raceID string) (map[int]tree.StagingMotionState, error) {
+	orch, err := api.getOrchestrator(raceID)
+	if err != nil {
+		return nil, err
 	}
+	return orch.GetStagingMotion(), nil
+}
 
-	status := orchestrator.GetTreeStatus()
-	jsonData, _ := json.Marshal(status)
-	return string(jsonData)
+// LiveState is a race's live tree and staging state, as streamed to state
+// stream clients: the race status (its state, held lanes and pre-staging
+// phase), the tree with its bulbs, each lane's sequence phase and whether
+// auto-start is armed and has activated, and each lane's staging motion
+type LiveState struct {
+	Race    orchestrator.RaceStatus         `json:"race"`
+	Tree    *tree.Status                    `json:"tree"`
+	Staging map[int]tree.StagingMotionState `json:"staging"`
+}
+
+// GetLiveStateByID reads a race's live state from the race itself
+func (api *LibDragAPI) GetLiveStateByID(raceID string) (LiveState, error) {
+	orch, err := api.getOrchestrator(raceID)
+	if err != nil {
+		return LiveState{}, err
+	}
+	return LiveState{
+		Race:    orch.GetRaceStatus(),
+		Tree:    orch.GetTreeStatus(),
+		Staging: orch.GetStagingMotion(),
+	}, nil
 }
 
 // GetResultsJSON returns race results as JSON (legacy method)
 // GetResultsJSONByID returns race results as JSON for a specific race
 func (api *LibDragAPI) GetResultsJSONByID(raceID string) string {
-	api.mu.RLock()
-	defer api.mu.RUnlock()
+	return api.raceDocumentJSON(raceID, DocumentResults)
+}
 
-	orchestrator, exists := api.orchestrators[raceID]
-	if !exists {
-		return "{\"error\":\"race not found\"}"
+// GetRaceStatusByID returns a race's status
+func (api *LibDragAPI) GetRaceStatusByID(raceID string) (orchestrator.RaceStatus, error) {
+	raceOrchestrator, err := api.getOrchestrator(raceID)
+	if err != nil {
+		return orchestrator.RaceStatus{}, err
+	}
+	return raceOrchestrator.GetRaceStatus(), nil
+}
+
+// GetTreeStatusByID returns a snapshot of a race's Christmas tree
+func (api *LibDragAPI) GetTreeStatusByID(raceID string) (*tree.Status, error) {
+	raceOrchestrator, err := api.getOrchestrator(raceID)
+	if err != nil {
+		return nil, err
 	}
+	return raceOrchestrator.GetTreeStatus(), nil
+}
 
-	results := orchestrator.GetResults()
-	jsonData, _ := json.Marshal(results)
-	return string(jsonData)
+// GetResultsByID returns a race's timing results by lane
+func (api *LibDragAPI) GetResultsByID(raceID string) (map[int]*timing.TimingResults, error) {
+	raceOrchestrator, err := api.getOrchestrator(raceID)
+	if err != nil {
+		return nil, err
+	}
+	return raceOrchestrator.GetResults(), nil
+}
+
+// GetDecisionByID returns how a race was decided: the winner lane, the
+// reason, the margin and whether it is held for review
+func (api *LibDragAPI) GetDecisionByID(raceID string) (results.Decision, error) {
+	raceOrchestrator, err := api.getOrchestrator(raceID)
+	if err != nil {
+		return results.Decision{}, err
+	}
+	return raceOrchestrator.GetDecision(), nil
 }
 
 // IsRaceComplete checks if the current race is finished (legacy method)
@@ -194,6 +449,238 @@ func (api *LibDragAPI) IsRaceCompleteByID(raceID string) bool {
 	return status.State == orchestrator.RaceStateComplete
 }
 
+// ArmTreeByID arms the Christmas tree for a specific race. With
+// Safety().RequireTrackClear, the track must be confirmed clear first.
+func (api *LibDragAPI) ArmTreeByID(raceID string) error {
+	return api.ArmTreeWithOverrideByID(raceID, nil)
+}
+
+// DisarmTreeByID disarms the Christmas tree for a specific race
+func (api *LibDragAPI) DisarmTreeByID(raceID string) error {
+	orch, err := api.getOrchestrator(raceID)
+	if err != nil {
+		return err
+	}
+	return orch.DisarmTree()
+}
+
+// SetStarterOverrideByID holds (or releases) the automatic start for a specific race
+func (api *LibDragAPI) SetStarterOverrideByID(raceID string, enabled bool) error {
+	orch, err := api.getOrchestrator(raceID)
+	if err != nil {
+		return err
+	}
+	orch.SetStarterOverride(enabled)
+	return nil
+}
+
+// TriggerTreeByID manually fires the tree for a race held by the starter override
+func (api *LibDragAPI) TriggerTreeByID(raceID string) error {
+	orch, err := api.getOrchestrator(raceID)
+	if err != nil {
+		return err
+	}
+	return orch.TriggerTree()
+}
+
+// HoldLaneByID holds (or releases) a lane at the starting line of a race.
+// The tree waits while any lane is held.
+func (api *LibDragAPI) HoldLaneByID(raceID string, lane int, held bool) error {
+	orch, err := api.getOrchestrator(raceID)
+	if err != nil {
+		return err
+	}
+	return orch.HoldLane(lane, held)
+}
+
+// DisqualifyLaneByID disqualifies a lane of a race, before or after its run
+func (api *LibDragAPI) DisqualifyLaneByID(raceID string, lane int, reason string) error {
+	orch, err := api.getOrchestrator(raceID)
+	if err != nil {
+		return err
+	}
+	return orch.DisqualifyLane(lane, reason)
+}
+
+// AbortRaceByID aborts a specific race
+func (api *LibDragAPI) AbortRaceByID(raceID string, reason string) error {
+	orch, err := api.getOrchestrator(raceID)
+	if err != nil {
+		return err
+	}
+	return orch.Abort(reason)
+}
+
+// SetStagingBeamByID passes a lane's pre-stage or stage beam change to a
+// race's tree, for staging driven by a race-control front end
+func (api *LibDragAPI) SetStagingBeamByID(raceID string, lane int, beamID beam.BeamID, broken bool) error {
+	orch, err := api.getOrchestrator(raceID)
+	if err != nil {
+		return err
+	}
+	return orch.SetStagingBeam(lane, beamID, broken)
+}
+
+// TriggerBeamByID reports a timing beam crossing in a lane of a race run
+// from live beams, at the time the beam saw it (now when at is zero)
+func (api *LibDragAPI) TriggerBeamByID(raceID string, lane int, beamID string, at time.Time) error {
+	orch, err := api.getOrchestrator(raceID)
+	if err != nil {
+		return err
+	}
+	return orch.TriggerBeam(lane, beamID, at)
+}
+
+// AttachBeamSource feeds a timing controller's readings to the newest race
+// run from live beams until ctx is cancelled or the source fails. Readings
+// route through the track's hardware map as in ApplyReading; those that
+// arrive with no live race running are dropped.
+func (api *LibDragAPI) AttachBeamSource(ctx context.Context, src beam.BeamSource) error {
+	return src.Run(ctx, func(r beam.Reading) {
+		if err := api.ApplyReading(r); err != nil {
+			api.log("").Debug("📡 beam reading dropped", "channel", r.Channel, "error", err)
+		}
+	})
+}
+
+// ApplyReading reports a controller reading to the newest race run from
+// live beams, through the track's hardware map: staging beams light its
+// tree, timing beams time it and boundary sensors report violations
+func (api *LibDragAPI) ApplyReading(r beam.Reading) error {
+	api.mu.RLock()
+	raceID := api.liveRace
+	api.mu.RUnlock()
+	if raceID == "" {
+		return fmt.Errorf("no race is running from live beams")
+	}
+	orch, err := api.getOrchestrator(raceID)
+	if err != nil {
+		return err
+	}
+	return orch.ApplyReading(r)
+}
+
+// SetDialInByID sets or changes a lane's dial-in for a specific race
+func (api *LibDragAPI) SetDialInByID(raceID string, lane int, dial float64) error {
+	orch, err := api.getOrchestrator(raceID)
+	if err != nil {
+		return err
+	}
+	return orch.SetDialIn(lane, dial)
+}
+
+// ResolveFinishByID records an official's ruling on a photo finish held for
+// review and releases the winner's win light
+func (api *LibDragAPI) ResolveFinishByID(raceID string, winnerLane int) error {
+	raceOrchestrator, err := api.getOrchestrator(raceID)
+	if err != nil {
+		return err
+	}
+	return raceOrchestrator.ResolveFinish(winnerLane)
+}
+
+// StartSignalByID starts a no-tree race from an external start signal (arm
+// drop, flashlight, button or GPIO input) given at the time it was seen, or
+// now when at is zero
+func (api *LibDragAPI) StartSignalByID(raceID string, at time.Time) error {
+	raceOrchestrator, err := api.getOrchestrator(raceID)
+	if err != nil {
+		return err
+	}
+	return raceOrchestrator.StartSignal(at)
+}
+
+// AdvancePhaseByID ends a race's burnout, backup or approach early
+func (api *LibDragAPI) AdvancePhaseByID(raceID string) error {
+	raceOrchestrator, err := api.getOrchestrator(raceID)
+	if err != nil {
+		return err
+	}
+	return raceOrchestrator.AdvancePhase()
+}
+
+// ReportBoundaryFoulByID records a lane crossing the centerline or its
+// outside boundary. When both lanes foul, the first-or-worst ruling is
+// attached to the race's decision.
+func (api *LibDragAPI) ReportBoundaryFoulByID(raceID string, lane int) error {
+	raceOrchestrator, err := api.getOrchestrator(raceID)
+	if err != nil {
+		return err
+	}
+	return raceOrchestrator.ReportBoundaryFoul(lane)
+}
+
+// ReportBoundarySensorByID reports a boundary sensor tripped in a lane
+// (config.BoundaryCenterline or config.BoundaryOutside) at the time it was
+// seen, or now when at is zero. Only trips during the run are violations.
+func (api *LibDragAPI) ReportBoundarySensorByID(raceID string, lane int, boundary string, at time.Time) error {
+	raceOrchestrator, err := api.getOrchestrator(raceID)
+	if err != nil {
+		return err
+	}
+	return raceOrchestrator.ReportBoundarySensor(lane, boundary, at)
+}
+
+// ReportLateralPositionByID reports a lane's lateral position during the
+// run, in feet from the lane's center to the tire nearest a boundary,
+// positive toward the centerline. A position past half the track's lane
+// width is a boundary violation.
+func (api *LibDragAPI) ReportLateralPositionByID(raceID string, lane int, offset float64, at time.Time) error {
+	raceOrchestrator, err := api.getOrchestrator(raceID)
+	if err != nil {
+		return err
+	}
+	return raceOrchestrator.ReportLateralPosition(lane, offset, at)
+}
+
+// EnterManualResultByID records hand-timed or partial results for a lane
+// when beams fail, flagged as manual with the official's provenance
+func (api *LibDragAPI) EnterManualResultByID(raceID string, entry timing.ManualResult) error {
+	raceOrchestrator, err := api.getOrchestrator(raceID)
+	if err != nil {
+		return err
+	}
+	return raceOrchestrator.EnterManualResult(entry)
+}
+
+// AddSyncRecorder registers an external recorder to receive green and finish
+// sync marks on every race started after this call
+func (api *LibDragAPI) AddSyncRecorder(recorder timing.SyncRecorder) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	api.syncRecorders = append(api.syncRecorders, recorder)
+}
+
+// SetComponentWrapper wraps the timing system and tree of every race
+// started after this call, e.g. with chaos.Injector.Wrap for a fault
+// injection drill. Pass nil to start races unwrapped again.
+func (api *LibDragAPI) SetComponentWrapper(wrap func(component.Component) component.Component) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	api.wrapComponent = wrap
+}
+
+// AddSyncMarkByID stores an external recorder sync mark with a race's results
+func (api *LibDragAPI) AddSyncMarkByID(raceID string, mark timing.SyncMark) error {
+	raceOrchestrator, err := api.getOrchestrator(raceID)
+	if err != nil {
+		return err
+	}
+	return raceOrchestrator.GetTimingSystem().AddSyncMark(mark)
+}
+
+// getOrchestrator looks up the orchestrator for a race
+func (api *LibDragAPI) getOrchestrator(raceID string) (*orchestrator.RaceOrchestrator, error) {
+	api.mu.RLock()
+	defer api.mu.RUnlock()
+
+	orch, exists := api.orchestrators[raceID]
+	if !exists {
+		return nil, fmt.Errorf("race %s not found", raceID)
+	}
+	return orch, nil
+}
+
 // CompleteRace manually marks a race as complete and cleans up resources
 func (api *LibDragAPI) CompleteRace(raceID string) error {
 	api.mu.Lock()
@@ -209,10 +696,47 @@ func (api *LibDragAPI) CompleteRace(raceID string) error {
 	// You may need to implement these in the orchestrator package
 
 	// Remove from active races
-	delete(api.orchestrators, raceID)
+	api.removeRace(raceID)
 	return nil
 }
 
+// removeRace forgets a race. Must be called with api.mu held.
+func (api *LibDragAPI) removeRace(raceID string) {
+	delete(api.orchestrators, raceID)
+	delete(api.raceInfo, raceID)
+	if api.liveRace == raceID {
+		api.liveRace = ""
+	}
+	api.documents.forget(raceID)
+	if api.eventBus != nil {
+		api.eventBus.SetExternalIDs(raceID, nil)
+	}
+	for _, cleanup := range api.raceCleanups[raceID] {
+		cleanup()
+	}
+	delete(api.raceCleanups, raceID)
+}
+
+// onRaceRemoved runs cleanup, with api.mu held, when a race is removed. The
+// returned function unregisters it and must be called without api.mu held.
+// Must be called with api.mu held.
+func (api *LibDragAPI) onRaceRemoved(raceID string, cleanup func()) func() {
+	cleanups := api.raceCleanups[raceID]
+	if cleanups == nil {
+		cleanups = make(map[int]func())
+		api.raceCleanups[raceID] = cleanups
+	}
+	id := api.nextCleanup
+	api.nextCleanup++
+	cleanups[id] = cleanup
+
+	return func() {
+		api.mu.Lock()
+		defer api.mu.Unlock()
+		delete(api.raceCleanups[raceID], id)
+	}
+}
+
 // GetMaxConcurrentRaces returns the maximum number of concurrent races allowed
 func (api *LibDragAPI) GetMaxConcurrentRaces() int {
 	api.mu.RLock()
@@ -234,9 +758,43 @@ func (api *LibDragAPI) Stop() error {
 	api.mu.Lock()
 	defer api.mu.Unlock()
 
-	// EmergencyStop all active races
-	for raceID := range api.orchestrators {
-		delete(api.orchestrators, raceID)
+	// Stop every active race, so no tree sequence or timing outlives the API
+	for raceID, orch := range api.orchestrators {
+		orch.Stop()
+		api.removeRace(raceID)
+	}
+
+	if api.schedule != nil {
+		api.schedule.Stop()
+		api.schedule = nil
+	}
+	if api.bracket != nil {
+		api.bracket.Stop()
+		api.bracket = nil
+	}
+	if api.records != nil {
+		api.stopRecords()
+		api.records = nil
+	}
+	if api.calibration != nil {
+		api.calibration.Stop()
+		api.calibration = nil
+	}
+	if api.timeTrials != nil {
+		api.timeTrials.Stop()
+		api.timeTrials = nil
+	}
+	if api.practice != nil {
+		api.practice.Stop()
+		api.practice = nil
+	}
+	if api.webhooks != nil {
+		api.webhooks.Stop()
+		api.webhooks = nil
+	}
+	if api.slips != nil {
+		api.stopSlips()
+		api.slips = nil
 	}
 
 	// EmergencyStop the event bus
@@ -259,7 +817,7 @@ func (api *LibDragAPI) Reset() error {
 
 	// Clear all active races
 	for raceID := range api.orchestrators {
-		delete(api.orchestrators, raceID)
+		api.removeRace(raceID)
 	}
 
 	return nil
@@ -292,20 +850,6 @@ func (api *LibDragAPI) RaceExists(raceID string) bool {
 	return exists
 }
 
-// GetAllRaceStatuses returns status information for all active races
-func (api *LibDragAPI) GetAllRaceStatuses() map[string]string {
-	api.mu.RLock()
-	defer api.mu.RUnlock()
-
-	statuses := make(map[string]string)
-	for raceID, orchestrator := range api.orchestrators {
-		status := orchestrator.GetRaceStatus()
-		jsonData, _ := json.Marshal(status)
-		statuses[raceID] = string(jsonData)
-	}
-	return statuses
-}
-
 // GetShortRaceID returns a short identifier for logging purposes
 func (api *LibDragAPI) GetShortRaceID(raceID string) string {
 	shortID, err := encodeRaceID(raceID)
@@ -319,7 +863,37 @@ func (api *LibDragAPI) GetShortRaceID(raceID string) string {
 	return shortID
 }
 
+// SetClock runs races started afterwards on clock instead of the default
+// wheel; a virtual wheel (timers.NewVirtualWheel) runs them
+// deterministically and faster than real time
+func (api *LibDragAPI) SetClock(clock timers.Clock) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	api.clock = clock
+}
+
+// SetLogger logs races, sessions and services started afterwards, and the
+// API itself, to logger instead of logs.Default
+func (api *LibDragAPI) SetLogger(logger *slog.Logger) {
+	api.logger.Store(logger)
+}
+
+// log returns the API's logger, scoped to raceID when set
+func (api *LibDragAPI) log(raceID string) *slog.Logger {
+	return logs.For(api.logger.Load(), "api", raceID)
+}
+
+// SetRules looks class rules (deep staging, dial-ins) up in engine for
+// races started afterwards, instead of rules.Default
+func (api *LibDragAPI) SetRules(engine *rules.Engine) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	api.rules = engine
+}
+
 // SetTestMode enables fast mode for all timing systems (for testing)
+//
+// Deprecated: use SetClock with a virtual clock.
 func (api *LibDragAPI) SetTestMode(enabled bool) {
 	api.mu.Lock()
 	defer api.mu.Unlock()
@@ -356,6 +930,268 @@ func (api *LibDragAPI) SubscribeAll(handler events.EventHandler) func() {
 	return api.eventBus.SubscribeAll(handler)
 }
 
+// SubscribeWithReplay adds an event handler for one race that first
+// receives the race's events published before it subscribed, from the event
+// bus's replay buffer, then its events as they are published
+func (api *LibDragAPI) SubscribeWithReplay(raceID string, handler events.EventHandler) func() {
+	api.mu.RLock()
+	defer api.mu.RUnlock()
+
+	if api.eventBus == nil {
+		return func() {} // Return no-op unsubscribe if not initialized
+	}
+
+	return api.eventBus.SubscribeWithReplay(raceID, handler)
+}
+
+// SubscribeRace adds an event handler for one race's events of a type (""
+// for all its events). The handler is unsubscribed when the race is removed
+// (CompleteRace, Reset, Stop), or earlier by the returned function.
+func (api *LibDragAPI) SubscribeRace(raceID string, eventType events.EventType, handler events.EventHandler) (func(), error) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+
+	if _, exists := api.orchestrators[raceID]; !exists || api.eventBus == nil {
+		return nil, fmt.Errorf("race %s not found", raceID)
+	}
+
+	raceHandler := func(e events.Event) {
+		if e.RaceID == raceID {
+			handler(e)
+		}
+	}
+	var unsubscribe func()
+	if eventType == "" {
+		unsubscribe = api.eventBus.SubscribeAll(raceHandler)
+	} else {
+		unsubscribe = api.eventBus.Subscribe(eventType, raceHandler)
+	}
+	forget := api.onRaceRemoved(raceID, unsubscribe)
+	return func() {
+		unsubscribe()
+		forget()
+	}, nil
+}
+
+// DroppedEvents returns how many events the event bus has dropped because
+// its queue was full
+func (api *LibDragAPI) DroppedEvents() uint64 {
+	api.mu.RLock()
+	defer api.mu.RUnlock()
+
+	if api.eventBus == nil {
+		return 0
+	}
+	return api.eventBus.Dropped()
+}
+
+// StartSessionStats publishes a session.summary event for a session every
+// interval until the returned stop function is called
+func (api *LibDragAPI) StartSessionStats(sessionID string, interval time.Duration) (func(), error) {
+	api.mu.RLock()
+	defer api.mu.RUnlock()
+
+	if api.eventBus == nil {
+		return nil, fmt.Errorf("API not initialized")
+	}
+	if interval <= 0 {
+		return nil, fmt.Errorf("interval must be positive")
+	}
+
+	sessionStats := stats.NewSessionStats(sessionID, func(raceID string) bool {
+		api.mu.RLock()
+		defer api.mu.RUnlock()
+		return api.raceInfo[raceID].sessionID == sessionID
+	})
+	emitter := stats.NewEmitter(api.eventBus, sessionStats, interval)
+	emitter.Start()
+	return emitter.Stop, nil
+}
+
+// StartTurnaroundTimer publishes session.turnaround events as pairs change
+// for a session, and session.turnaround_alert when the next pair has not
+// staged within threshold. Call the returned function to stop it.
+func (api *LibDragAPI) StartTurnaroundTimer(sessionID string, threshold time.Duration) (func(), error) {
+	api.mu.RLock()
+	defer api.mu.RUnlock()
+
+	if api.eventBus == nil {
+		return nil, fmt.Errorf("API not initialized")
+	}
+
+	timer := stats.NewTurnaroundTimer(api.eventBus, threshold, func(raceID string) bool {
+		api.mu.RLock()
+		defer api.mu.RUnlock()
+		return api.raceInfo[raceID].sessionID == sessionID
+	})
+	timer.Start()
+	return timer.Stop, nil
+}
+
+// StartDelayBoxAnalyzer flags registered drivers in the given classes
+// (where delay boxes are prohibited) whose reaction times cluster
+// suspiciously tightly, publishing session.tech_flag. Flags are advisory
+// only. Call Stop on the analyzer when done.
+func (api *LibDragAPI) StartDelayBoxAnalyzer(classes []string, cfg stats.DelayBoxConfig) (*stats.DelayBoxAnalyzer, error) {
+	api.mu.RLock()
+	defer api.mu.RUnlock()
+
+	if api.eventBus == nil {
+		return nil, fmt.Errorf("API not initialized")
+	}
+	if len(classes) == 0 {
+		return nil, fmt.Errorf("at least one class is required")
+	}
+	prohibited := make(map[string]bool, len(classes))
+	for _, class := range classes {
+		prohibited[class] = true
+	}
+
+	analyzer := stats.NewDelayBoxAnalyzer(api.eventBus, cfg, func(raceID string, lane int) string {
+		api.mu.RLock()
+		defer api.mu.RUnlock()
+		info := api.raceInfo[raceID]
+		if !prohibited[info.class] || !cfg.Tags.Matches(info.tags) {
+			return ""
+		}
+		return info.drivers[lane]
+	})
+	analyzer.Start()
+	return analyzer, nil
+}
+
+// StartLeaderboard ranks registered drivers by their best reaction time of
+// the day and by reaction time consistency, for races in sessionID (empty
+// for every session), publishing session.leaderboard as the boards change.
+// Call Boards on the leaderboard to query them and Stop when done.
+func (api *LibDragAPI) StartLeaderboard(sessionID string, cfg stats.LeaderboardConfig) (*stats.Leaderboard, error) {
+	api.mu.RLock()
+	defer api.mu.RUnlock()
+
+	if api.eventBus == nil {
+		return nil, fmt.Errorf("API not initialized")
+	}
+
+	leaderboard := stats.NewLeaderboard(api.eventBus, sessionID, cfg, func(raceID string, lane int) string {
+		api.mu.RLock()
+		defer api.mu.RUnlock()
+		info := api.raceInfo[raceID]
+		if sessionID != "" && info.sessionID != sessionID {
+			return ""
+		}
+		if !cfg.Tags.Matches(info.tags) {
+			return ""
+		}
+		return info.drivers[lane]
+	})
+	leaderboard.Start()
+	return leaderboard, nil
+}
+
+// StartStarterAudit records the time from both cars staged to the tree
+// firing, automatically or from TriggerTreeByID, for every run in sessionID
+// (empty for every session), publishing starter.audit per run. Runs are
+// attributed to RaceOptions.Starter. Call Distributions on the auditor for
+// the delays per starter and session, and Stop when done.
+func (api *LibDragAPI) StartStarterAudit(sessionID string, cfg stats.StarterConfig) (*stats.StarterAuditor, error) {
+	api.mu.RLock()
+	defer api.mu.RUnlock()
+
+	if api.eventBus == nil {
+		return nil, fmt.Errorf("API not initialized")
+	}
+
+	auditor := stats.NewStarterAuditor(api.eventBus, cfg, func(raceID string) (string, string, bool) {
+		api.mu.RLock()
+		defer api.mu.RUnlock()
+		info, ok := api.raceInfo[raceID]
+		if !ok || (sessionID != "" && info.sessionID != sessionID) || !cfg.Tags.Matches(info.tags) {
+			return "", "", false
+		}
+		return info.starter, info.sessionID, true
+	})
+	auditor.Start()
+	return auditor, nil
+}
+
+// StartScoreboard creates a scoreboard that follows races on this API and
+// publishes scoreboard.update events, showing fouled lanes per the timing
+// config's FoulDisplay. Call Stop on it when done.
+func (api *LibDragAPI) StartScoreboard() (*scoreboard.Scoreboard, error) {
+	api.mu.RLock()
+	defer api.mu.RUnlock()
+
+	if api.eventBus == nil {
+		return nil, fmt.Errorf("API not initialized")
+	}
+
+	board := scoreboard.NewScoreboard(api.eventBus)
+	board.SetFoulDisplay(api.globalConfig.Timing().FoulDisplay)
+	board.Start()
+	return board, nil
+}
+
+// StartStagingAssist publishes staging.assist guidance for the staging
+// assist displays beside the tree, at cfg.Interval while cars are in the
+// staging beams. Call Stop on it when done.
+func (api *LibDragAPI) StartStagingAssist(cfg assist.Config) (*assist.Assist, error) {
+	api.mu.RLock()
+	defer api.mu.RUnlock()
+
+	if api.eventBus == nil {
+		return nil, fmt.Errorf("API not initialized")
+	}
+
+	staging := assist.NewAssist(api.eventBus, cfg)
+	staging.Start()
+	return staging, nil
+}
+
+// StartRunSummaries sends each registered driver a run summary through
+// notifier once their race is decided; photo finishes are sent when the
+// official resolves them. nextOpponent may be nil when no bracket is running.
+// Call the returned function to stop sending summaries.
+func (api *LibDragAPI) StartRunSummaries(notifier notify.Notifier, nextOpponent notify.OpponentLookup) (func(), error) {
+	api.mu.RLock()
+	defer api.mu.RUnlock()
+
+	if api.eventBus == nil {
+		return nil, fmt.Errorf("API not initialized")
+	}
+	if notifier == nil {
+		return nil, fmt.Errorf("notifier is required")
+	}
+
+	handler := func(event events.Event) {
+		api.mu.RLock()
+		info, ok := api.raceInfo[event.RaceID]
+		raceOrchestrator := api.orchestrators[event.RaceID]
+		foulDisplay := api.globalConfig.Timing().FoulDisplay
+		api.mu.RUnlock()
+
+		if !ok || raceOrchestrator == nil || len(info.drivers) == 0 {
+			return
+		}
+		decision := raceOrchestrator.GetDecision()
+		if decision.UnderReview {
+			return
+		}
+
+		summaries := notify.BuildRunSummaries(event.RaceID, raceOrchestrator.GetResults(), decision, raceOrchestrator.GetDialIns(), info.drivers, nextOpponent)
+		notify.ApplyFoulDisplay(summaries, foulDisplay)
+		if err := notify.Dispatch(notifier, summaries); err != nil {
+			api.log(event.RaceID).Warn("⚠️ run summary delivery failed", "error", err)
+		}
+	}
+
+	unsubscribeComplete := api.eventBus.Subscribe(events.EventRaceComplete, handler)
+	unsubscribeResolved := api.eventBus.Subscribe(events.EventFinishResolved, handler)
+	return func() {
+		unsubscribeComplete()
+		unsubscribeResolved()
+	}, nil
+}
+
 // PublishEvent publishes an event to the event bus (for testing or external components)
 func (api *LibDragAPI) PublishEvent(event events.Event) {
 	api.mu.RLock()
@@ -366,6 +1202,30 @@ func (api *LibDragAPI) PublishEvent(event events.Event) {
 	}
 }
 
+// copyDrivers copies a lane -> registration (or license, car number) map so
+// callers can reuse theirs
+func copyDrivers(drivers map[int]string) map[int]string {
+	if len(drivers) == 0 {
+		return nil
+	}
+	result := make(map[int]string, len(drivers))
+	for lane, registration := range drivers {
+		result[lane] = registration
+	}
+	return result
+}
+
+func copyExternalIDs(ids map[string]string) map[string]string {
+	if len(ids) == 0 {
+		return nil
+	}
+	result := make(map[string]string, len(ids))
+	for name, id := range ids {
+		result[name] = id
+	}
+	return result
+}
+
 // Version returns the libdrag version
 func Version() string {
 	return "libdrag v1.0.0 - Professional Drag Racing Library"
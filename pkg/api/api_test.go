@@ -1,10 +1,46 @@
 package api
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"sync"
 	"testing"
 	"time"
+
+	"github.com/benharold/libdrag/pkg/autostart"
+	"github.com/benharold/libdrag/pkg/beam"
+	"github.com/benharold/libdrag/pkg/calibration"
+	"github.com/benharold/libdrag/pkg/chaos"
+	"github.com/benharold/libdrag/pkg/config"
+	"github.com/benharold/libdrag/pkg/eliminations"
+	"github.com/benharold/libdrag/pkg/events"
+	"github.com/benharold/libdrag/pkg/export"
+	"github.com/benharold/libdrag/pkg/fouls"
+	"github.com/benharold/libdrag/pkg/logs"
+	"github.com/benharold/libdrag/pkg/orchestrator"
+	"github.com/benharold/libdrag/pkg/practice"
+	"github.com/benharold/libdrag/pkg/records"
+	"github.com/benharold/libdrag/pkg/report"
+	"github.com/benharold/libdrag/pkg/results"
+	"github.com/benharold/libdrag/pkg/rules"
+	"github.com/benharold/libdrag/pkg/schedule"
+	"github.com/benharold/libdrag/pkg/simulation"
+	"github.com/benharold/libdrag/pkg/slips"
+	"github.com/benharold/libdrag/pkg/stats"
+	"github.com/benharold/libdrag/pkg/storage"
+	"github.com/benharold/libdrag/pkg/tags"
+	"github.com/benharold/libdrag/pkg/timers"
+	"github.com/benharold/libdrag/pkg/timetrial"
+	"github.com/benharold/libdrag/pkg/timing"
+	"github.com/benharold/libdrag/pkg/tree"
+	"github.com/benharold/libdrag/pkg/webhook"
 )
 
 func TestNewLibDragAPI(t *testing.T) {
@@ -44,22 +80,13 @@ func TestBasicRaceFlow(t *testing.T) {
 	// Enable test mode for faster execution
 	api.SetTestMode(true)
 
-	// Wait for race completion (increased timeout to allow race to complete even in test mode)
-	timeout := time.After(5 * time.Second)     // Increased from 2 seconds to 5 seconds
-	ticker := time.Tick(10 * time.Millisecond) // Faster polling
-
-	for {
-		select {
-		case <-timeout:
-			t.Fatal("Race did not complete within timeout")
-		case <-ticker:
-			if api.IsRaceCompleteByID(raceID) {
-				goto raceComplete
-			}
-		}
+	// Wait for race completion
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := api.WaitForCompletion(ctx, raceID); err != nil {
+		t.Fatalf("Race did not complete: %v", err)
 	}
 
-raceComplete:
 	// Verify we can get results
 	results := api.GetResultsJSONByID(raceID)
 	if results == "" {
@@ -113,16 +140,11 @@ func TestMultipleRaces(t *testing.T) {
 			// Enable test mode for this race to run faster
 			api.SetTestMode(true)
 
-			// Wait for completion of this specific race (increased timeout for test mode)
-			for j := 0; j < 50; j++ { // Increased from 20 iterations (5 second timeout instead of 2)
-				if api.IsRaceCompleteByID(raceID) {
-					break
-				}
-				time.Sleep(100 * time.Millisecond)
-			}
-
-			if !api.IsRaceCompleteByID(raceID) {
-				results[raceIndex] = fmt.Errorf("Race %d (%s) did not complete", raceIndex+1, shortID)
+			// Wait for completion of this specific race
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := api.WaitForCompletion(ctx, raceID); err != nil {
+				results[raceIndex] = fmt.Errorf("Race %d (%s) did not complete: %v", raceIndex+1, shortID, err)
 				return
 			}
 
@@ -180,16 +202,11 @@ func TestConcurrentRaces(t *testing.T) {
 			// Enable test mode for faster execution
 			api.SetTestMode(true)
 
-			// Wait for this specific race to complete (increased timeout for test mode)
-			for j := 0; j < 50; j++ { // Increased from 20 iterations (5 second timeout instead of 2)
-				if api.IsRaceCompleteByID(raceID) {
-					break
-				}
-				time.Sleep(100 * time.Millisecond)
-			}
-
-			if !api.IsRaceCompleteByID(raceID) {
-				results[raceIndex] = fmt.Errorf("race %s did not complete", shortID)
+			// Wait for this specific race to complete
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := api.WaitForCompletion(ctx, raceID); err != nil {
+				results[raceIndex] = fmt.Errorf("race %s did not complete: %v", shortID, err)
 			} else {
 				t.Logf("Concurrent race %d (%s) completed", raceIndex, shortID)
 			}
@@ -352,3 +369,2262 @@ func TestUniqueRaceIdentifiers(t *testing.T) {
 
 	t.Logf("Successfully created %d races with short IDs: %v", numRaces, shortIDs)
 }
+
+// TestQueryRaces tests filtering and pagination of the active race list
+func TestQueryRaces(t *testing.T) {
+	api := NewLibDragAPI()
+
+	err := api.Initialize()
+	if err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	defer api.Stop()
+
+	for i := 0; i < 3; i++ {
+		if _, err := api.StartRaceWithOptions(RaceOptions{Class: "Super Gas", SessionID: "elims-1"}); err != nil {
+			t.Fatalf("Failed to start race %d: %v", i, err)
+		}
+	}
+	if _, err := api.StartRaceWithOptions(RaceOptions{Class: "Top Fuel", SessionID: "qualifying-1"}); err != nil {
+		t.Fatalf("Failed to start race: %v", err)
+	}
+
+	all := api.QueryRaces(RaceQuery{})
+	if all.Total != 4 || len(all.Races) != 4 {
+		t.Fatalf("Expected 4 races, got total=%d len=%d", all.Total, len(all.Races))
+	}
+
+	byClass := api.QueryRaces(RaceQuery{Class: "Top Fuel"})
+	if byClass.Total != 1 || byClass.Races[0].SessionID != "qualifying-1" {
+		t.Fatalf("Expected 1 Top Fuel race in qualifying-1, got %+v", byClass)
+	}
+
+	bySession := api.QueryRaces(RaceQuery{SessionID: "elims-1", Limit: 2})
+	if bySession.Total != 3 || len(bySession.Races) != 2 {
+		t.Fatalf("Expected first page of 2 out of 3, got total=%d len=%d", bySession.Total, len(bySession.Races))
+	}
+
+	nextPage := api.QueryRaces(RaceQuery{SessionID: "elims-1", Offset: 2, Limit: 2})
+	if len(nextPage.Races) != 1 || nextPage.Races[0].RaceID == bySession.Races[0].RaceID {
+		t.Fatalf("Expected a distinct final page of 1 race, got %+v", nextPage.Races)
+	}
+
+	none := api.QueryRaces(RaceQuery{States: []orchestrator.RaceState{orchestrator.RaceStateAborted}})
+	if none.Total != 0 || none.Races == nil {
+		t.Fatalf("Expected empty non-nil page for aborted races, got %+v", none)
+	}
+}
+
+// TestStarterControls tests the starter's override, manual trigger and abort controls
+func TestStarterControls(t *testing.T) {
+	api := NewLibDragAPI()
+
+	err := api.Initialize()
+	if err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	defer api.Stop()
+
+	raceID, err := api.StartRaceWithID()
+	if err != nil {
+		t.Fatalf("StartRaceWithID failed: %v", err)
+	}
+
+	if err := api.TriggerTreeByID(raceID); err == nil {
+		t.Fatal("TriggerTreeByID should fail without the starter override")
+	}
+	if err := api.SetStarterOverrideByID(raceID, true); err != nil {
+		t.Fatalf("SetStarterOverrideByID failed: %v", err)
+	}
+
+	// The override holds the race at the starting line
+	time.Sleep(2500 * time.Millisecond)
+	if api.IsRaceCompleteByID(raceID) {
+		t.Fatal("Race should be held by the starter override")
+	}
+
+	if err := api.TriggerTreeByID(raceID); err != nil {
+		t.Fatalf("TriggerTreeByID failed: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := api.WaitForCompletion(ctx, raceID); err != nil {
+		t.Fatalf("Race should complete after the tree is fired: %v", err)
+	}
+
+	abortID, err := api.StartRaceWithID()
+	if err != nil {
+		t.Fatalf("StartRaceWithID failed: %v", err)
+	}
+	if err := api.AbortRaceByID(abortID, "test"); err != nil {
+		t.Fatalf("AbortRaceByID failed: %v", err)
+	}
+	aborted := api.QueryRaces(RaceQuery{States: []orchestrator.RaceState{orchestrator.RaceStateAborted}})
+	if aborted.Total != 1 || aborted.Races[0].RaceID != abortID {
+		t.Fatalf("Expected aborted race %s, got %+v", abortID, aborted.Races)
+	}
+	if err := api.AbortRaceByID("missing", "test"); err == nil {
+		t.Fatal("AbortRaceByID should fail for unknown race")
+	}
+}
+
+// TestStarterAudit tests auditing the wait from staged to the tree firing
+func TestStarterAudit(t *testing.T) {
+	api := NewLibDragAPI()
+	if err := api.Initialize(); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	defer api.Stop()
+
+	auditor, err := api.StartStarterAudit("elims-1", stats.StarterConfig{})
+	if err != nil {
+		t.Fatalf("StartStarterAudit failed: %v", err)
+	}
+	defer auditor.Stop()
+	audits := make(chan events.Event, 4)
+	api.Subscribe(events.EventStarterAudit, func(e events.Event) { audits <- e })
+
+	auto, err := api.StartRaceWithOptions(RaceOptions{SessionID: "elims-1", Starter: "pat"})
+	if err != nil {
+		t.Fatalf("StartRaceWithOptions failed: %v", err)
+	}
+	manual, err := api.StartRaceWithOptions(RaceOptions{SessionID: "elims-1", Starter: "pat"})
+	if err != nil {
+		t.Fatalf("StartRaceWithOptions failed: %v", err)
+	}
+	if _, err := api.StartRaceWithOptions(RaceOptions{SessionID: "test-and-tune", Starter: "sam"}); err != nil {
+		t.Fatalf("StartRaceWithOptions failed: %v", err)
+	}
+	if err := api.SetStarterOverrideByID(manual, true); err != nil {
+		t.Fatalf("SetStarterOverrideByID failed: %v", err)
+	}
+	if page := api.QueryRaces(RaceQuery{SessionID: "elims-1"}); page.Total != 2 || page.Races[0].Starter != "pat" {
+		t.Errorf("Expected the starter on the race summaries, got %+v", page.Races)
+	}
+
+	// The starter holds the second pair a while after they stage
+	time.Sleep(3500 * time.Millisecond)
+	if err := api.TriggerTreeByID(manual); err != nil {
+		t.Fatalf("TriggerTreeByID failed: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case <-audits:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Expected a starter.audit for each elims-1 race, got %d", i)
+		}
+	}
+
+	runs := auditor.Runs()
+	if len(runs) != 2 || runs[0].RaceID != auto || runs[1].RaceID != manual {
+		t.Fatalf("Expected both elims-1 races audited, got %+v", runs)
+	}
+	if runs[0].Trigger != stats.TriggerAuto || runs[1].Trigger != stats.TriggerManual {
+		t.Errorf("Expected an auto and a manual run, got %+v", runs)
+	}
+	if runs[1].Delay < runs[0].Delay+time.Second {
+		t.Errorf("Expected the held pair to wait longer, got %v and %v", runs[0].Delay, runs[1].Delay)
+	}
+
+	distributions := auditor.Distributions()
+	if len(distributions) != 1 || distributions[0].Starter != "pat" || distributions[0].SessionID != "elims-1" ||
+		distributions[0].Runs != 2 || distributions[0].Manual != 1 || distributions[0].Max != runs[1].Delay {
+		t.Errorf("Unexpected distributions %+v", distributions)
+	}
+}
+
+// TestFoulDisplay tests that scoreboards follow the track's foul display
+// convention
+func TestFoulDisplay(t *testing.T) {
+	cfg := config.NewDefaultConfig()
+	cfg.TimingConfig.FoulDisplay = config.FoulDisplayBlank
+	api := NewLibDragAPI()
+	if err := api.InitializeWithConfig(cfg); err != nil {
+		t.Fatalf("InitializeWithConfig failed: %v", err)
+	}
+	defer api.Stop()
+
+	board, err := api.StartScoreboard()
+	if err != nil {
+		t.Fatalf("StartScoreboard failed: %v", err)
+	}
+	defer board.Stop()
+	updates := make(chan events.Event, 4)
+	api.Subscribe(events.EventScoreboardUpdate, func(e events.Event) { updates <- e })
+
+	api.PublishEvent(events.NewEvent(events.EventRaceStart).WithRaceID("race-1").Build())
+	api.PublishEvent(events.NewEvent(events.EventTimingReaction).WithRaceID("race-1").WithLane(1).WithData("reaction_time", -0.012).Build())
+	api.PublishEvent(events.NewEvent(events.EventRaceFoul).WithRaceID("race-1").WithLane(1).WithData("reason", "red_light").Build())
+	api.PublishEvent(events.NewEvent(events.EventTimingQuarterMile).WithRaceID("race-1").WithLane(1).WithData("time", 10.498).Build())
+	api.PublishEvent(events.NewEvent(events.EventTimingQuarterMile).WithRaceID("race-1").WithLane(2).WithData("time", 10.512).Build())
+	for i := 0; i < 2; i++ {
+		select {
+		case <-updates:
+		case <-time.After(time.Second):
+			t.Fatalf("Expected 2 scoreboard updates, got %d", i)
+		}
+	}
+
+	if d := board.Display(1); d.ElapsedTime != nil || d.ReactionTime == nil {
+		t.Errorf("Expected the red-lighting lane's ET blanked, got %+v", d)
+	}
+	if d := board.Display(2); d.ElapsedTime == nil {
+		t.Errorf("Expected the other lane's ET shown, got %+v", d)
+	}
+}
+
+// TestWaitForCompletion tests waiting on races that complete, are aborted
+// or are removed
+func TestWaitForCompletion(t *testing.T) {
+	api := NewLibDragAPI()
+	if err := api.Initialize(); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	defer api.Stop()
+
+	if err := api.WaitForCompletion(context.Background(), "no-such-race"); err == nil {
+		t.Error("Expected an unknown race to be an error")
+	}
+
+	raceID, err := api.StartRaceWithID()
+	if err != nil {
+		t.Fatalf("StartRaceWithID failed: %v", err)
+	}
+	short, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := api.WaitForCompletion(short, raceID); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the context's deadline, got %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := api.WaitForCompletion(ctx, raceID); err != nil {
+		t.Fatalf("WaitForCompletion failed: %v", err)
+	}
+	// A race already complete returns at once
+	if err := api.WaitForCompletion(ctx, raceID); err != nil {
+		t.Errorf("Expected a complete race to return nil, got %v", err)
+	}
+
+	abortID, err := api.StartRaceWithID()
+	if err != nil {
+		t.Fatalf("StartRaceWithID failed: %v", err)
+	}
+	done := make(chan error, 1)
+	if _, err := api.OnRaceDone(abortID, func(err error) { done <- err }); err != nil {
+		t.Fatalf("OnRaceDone failed: %v", err)
+	}
+	if err := api.AbortRaceByID(abortID, "oil down"); err != nil {
+		t.Fatalf("AbortRaceByID failed: %v", err)
+	}
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrRaceAborted) || !strings.Contains(err.Error(), "oil down") {
+			t.Errorf("Expected ErrRaceAborted with the reason, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected OnRaceDone called for the aborted race")
+	}
+
+	removedID, err := api.StartRaceWithID()
+	if err != nil {
+		t.Fatalf("StartRaceWithID failed: %v", err)
+	}
+	result := make(chan error, 1)
+	go func() { result <- api.WaitForCompletion(ctx, removedID) }()
+	time.Sleep(50 * time.Millisecond)
+	if err := api.CompleteRace(removedID); err != nil {
+		t.Fatalf("CompleteRace failed: %v", err)
+	}
+	if err := <-result; !errors.Is(err, ErrRaceRemoved) {
+		t.Errorf("Expected ErrRaceRemoved, got %v", err)
+	}
+}
+
+// TestSubscribeRace tests race-scoped subscriptions and their removal with
+// the race
+func TestSubscribeRace(t *testing.T) {
+	api := NewLibDragAPI()
+	if err := api.Initialize(); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	defer api.Stop()
+
+	if _, err := api.SubscribeRace("no-such-race", "", func(events.Event) {}); err == nil {
+		t.Error("Expected an unknown race to be an error")
+	}
+
+	raceID, err := api.StartRaceWithID()
+	if err != nil {
+		t.Fatalf("StartRaceWithID failed: %v", err)
+	}
+	otherID, err := api.StartRaceWithID()
+	if err != nil {
+		t.Fatalf("StartRaceWithID failed: %v", err)
+	}
+
+	var mu sync.Mutex
+	received := make(map[string]int)
+	record := func(e events.Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		received[e.RaceID]++
+	}
+	if _, err := api.SubscribeRace(raceID, events.EventRaceFoul, record); err != nil {
+		t.Fatalf("SubscribeRace failed: %v", err)
+	}
+	unsubscribe, err := api.SubscribeRace(raceID, "", func(events.Event) {})
+	if err != nil {
+		t.Fatalf("SubscribeRace failed: %v", err)
+	}
+	unsubscribe()
+
+	for _, id := range []string{raceID, otherID} {
+		api.PublishEvent(events.NewEvent(events.EventRaceFoul).WithRaceID(id).Build())
+	}
+	time.Sleep(100 * time.Millisecond)
+	mu.Lock()
+	if received[raceID] != 1 || received[otherID] != 0 {
+		t.Errorf("Expected only the race's event, got %v", received)
+	}
+	mu.Unlock()
+
+	// Removing the race unsubscribes its handlers
+	if err := api.CompleteRace(raceID); err != nil {
+		t.Fatalf("CompleteRace failed: %v", err)
+	}
+	api.PublishEvent(events.NewEvent(events.EventRaceFoul).WithRaceID(raceID).Build())
+	time.Sleep(100 * time.Millisecond)
+	mu.Lock()
+	if received[raceID] != 1 {
+		t.Errorf("Expected no events after the race was removed, got %d", received[raceID])
+	}
+	mu.Unlock()
+	api.mu.RLock()
+	if cleanups := len(api.raceCleanups); cleanups != 0 {
+		t.Errorf("Expected no cleanups left for the races, got %d", cleanups)
+	}
+	api.mu.RUnlock()
+}
+
+// TestSubscribeWithReplay tests that a late subscriber receives the race's
+// earlier events
+func TestSubscribeWithReplay(t *testing.T) {
+	api := NewLibDragAPI()
+	if err := api.Initialize(); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	defer api.Stop()
+
+	raceID, err := api.StartRaceWithID()
+	if err != nil {
+		t.Fatalf("StartRaceWithID failed: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond) // Let the bus deliver the start
+
+	replayed := make(chan events.Event, events.DefaultReplayEvents)
+	unsubscribe := api.SubscribeWithReplay(raceID, func(e events.Event) { replayed <- e })
+	defer unsubscribe()
+
+	select {
+	case e := <-replayed:
+		if e.RaceID != raceID {
+			t.Errorf("Expected race %s's events, got %+v", raceID, e)
+		}
+	default:
+		t.Fatal("Expected the race's earlier events replayed on subscribing")
+	}
+	if dropped := api.DroppedEvents(); dropped != 0 {
+		t.Errorf("Expected no dropped events, got %d", dropped)
+	}
+}
+
+// logBuffer collects a handler's output across goroutines
+type logBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+// records returns the JSON records written so far
+func (b *logBuffer) records() []map[string]any {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(b.buf.String()), "\n") {
+		var record map[string]any
+		if json.Unmarshal([]byte(line), &record) == nil {
+			records = append(records, record)
+		}
+	}
+	return records
+}
+
+// TestSetLogger tests that a race's components log to the API's logger,
+// tagged with their component and race
+func TestSetLogger(t *testing.T) {
+	api := NewLibDragAPI()
+	if err := api.Initialize(); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	defer api.Stop()
+
+	var buf logBuffer
+	api.SetLogger(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+
+	raceID, err := api.StartRaceWithID()
+	if err != nil {
+		t.Fatalf("StartRaceWithID failed: %v", err)
+	}
+	if err := api.AbortRaceByID(raceID, "test"); err != nil {
+		t.Fatalf("AbortRaceByID failed: %v", err)
+	}
+
+	components := make(map[string]bool)
+	for _, record := range buf.records() {
+		if record[logs.KeyRaceID] != raceID {
+			t.Errorf("Expected every record tagged with race %s, got %v", raceID, record)
+			continue
+		}
+		component, _ := record[logs.KeyComponent].(string)
+		components[component] = true
+	}
+	for _, component := range []string{"orchestrator", "tree"} {
+		if !components[component] {
+			t.Errorf("Expected records from %s, got components %v", component, components)
+		}
+	}
+}
+
+// TestStarterHoldAndDisqualify tests holding a lane at the line and
+// disqualifying it
+func TestStarterHoldAndDisqualify(t *testing.T) {
+	api := NewLibDragAPI()
+	if err := api.Initialize(); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	defer api.Stop()
+
+	starter := make(chan events.Event, 8)
+	api.Subscribe(events.EventStarterLaneHold, func(e events.Event) { starter <- e })
+	api.Subscribe(events.EventStarterDisqualify, func(e events.Event) { starter <- e })
+	winners := make(chan events.Event, 1)
+	api.Subscribe(events.EventRaceWinner, func(e events.Event) { winners <- e })
+
+	raceID, err := api.StartRaceWithID()
+	if err != nil {
+		t.Fatalf("StartRaceWithID failed: %v", err)
+	}
+	if err := api.HoldLaneByID(raceID, 3, true); err == nil {
+		t.Error("Expected a lane off the track to be rejected")
+	}
+	if err := api.HoldLaneByID(raceID, 1, true); err != nil {
+		t.Fatalf("HoldLaneByID failed: %v", err)
+	}
+	if event := <-starter; event.Type != events.EventStarterLaneHold || event.Lane != 1 || event.Data["held"] != true {
+		t.Errorf("Expected starter.lane_hold for lane 1, got %+v", event)
+	}
+
+	// The hold keeps the tree from starting, even when fired by hand
+	time.Sleep(2500 * time.Millisecond)
+	status, _ := api.GetRaceStatusByID(raceID)
+	if status.State == orchestrator.RaceStateRunning || api.IsRaceCompleteByID(raceID) || len(status.HeldLanes) != 1 {
+		t.Fatalf("Expected the race held for lane 1, got %+v", status)
+	}
+	api.SetStarterOverrideByID(raceID, true)
+	if err := api.TriggerTreeByID(raceID); err == nil {
+		t.Error("Expected the tree held while a lane is held")
+	}
+	api.SetStarterOverrideByID(raceID, false)
+
+	// Disqualifying the held lane releases it; lane 2 races on and wins
+	if err := api.DisqualifyLaneByID(raceID, 1, "fluid leak"); err != nil {
+		t.Fatalf("DisqualifyLaneByID failed: %v", err)
+	}
+	if event := <-starter; event.Type != events.EventStarterDisqualify || event.Data["reason"] != "fluid leak" {
+		t.Errorf("Expected starter.disqualify for lane 1, got %+v", event)
+	}
+	if err := api.HoldLaneByID(raceID, 1, true); err == nil {
+		t.Error("Expected a disqualified lane not to be held")
+	}
+	select {
+	case event := <-winners:
+		if event.Lane != 2 || event.Data["reason"] != results.ReasonDisqualified {
+			t.Errorf("Expected lane 2 to win on the disqualification, got %+v", event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("No race.winner event")
+	}
+	if err := api.DisqualifyLaneByID("missing", 1, "test"); err == nil {
+		t.Error("Expected error for an unknown race")
+	}
+}
+
+// TestDialInChanges tests that dial-ins can be changed until the race runs
+func TestDialInChanges(t *testing.T) {
+	api := NewLibDragAPI()
+
+	err := api.Initialize()
+	if err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	defer api.Stop()
+
+	raceID, err := api.StartRaceWithID()
+	if err != nil {
+		t.Fatalf("StartRaceWithID failed: %v", err)
+	}
+
+	if err := api.SetDialInByID(raceID, 1, 10.50); err != nil {
+		t.Fatalf("SetDialInByID failed: %v", err)
+	}
+	if err := api.SetDialInByID(raceID, 1, 10.45); err != nil {
+		t.Fatalf("Changing dial-in before the run failed: %v", err)
+	}
+	if err := api.SetDialInByID(raceID, 2, -1); err == nil {
+		t.Fatal("Negative dial-in should be rejected")
+	}
+
+	api.AbortRaceByID(raceID, "test")
+	if err := api.SetDialInByID(raceID, 1, 10.40); err == nil {
+		t.Fatal("Dial-in changes should be rejected once the race is over")
+	}
+}
+
+// TestClassDialInRules tests that dial-ins follow the race class's rules
+func TestClassDialInRules(t *testing.T) {
+	api := NewLibDragAPI()
+	if err := api.Initialize(); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	defer api.Stop()
+
+	superGas, err := api.StartRaceWithOptions(RaceOptions{Class: "Super Gas", LiveBeams: true})
+	if err != nil {
+		t.Fatalf("StartRaceWithOptions failed: %v", err)
+	}
+	if err := api.SetDialInByID(superGas, 1, 9.85); err == nil {
+		t.Error("Expected a dial-in off the Super Gas index to be rejected")
+	}
+	if err := api.SetDialInByID(superGas, 1, 9.90); err != nil {
+		t.Errorf("Expected the index accepted, got %v", err)
+	}
+
+	// A track's own rules replace the standard classes for later races
+	engine, err := rules.NewEngine(rules.Class{Name: "Street", Tree: config.TreeSequenceSportsman, DeepStage: rules.DeepStageAllowed, Breakout: rules.BreakoutDialIn, MaxDialIn: 17.99})
+	if err != nil {
+		t.Fatalf("NewEngine failed: %v", err)
+	}
+	api.SetRules(engine)
+	street, err := api.StartRaceWithOptions(RaceOptions{Class: "Street", LiveBeams: true})
+	if err != nil {
+		t.Fatalf("StartRaceWithOptions failed: %v", err)
+	}
+	if err := api.SetDialInByID(street, 1, 18.25); err == nil {
+		t.Error("Expected a dial-in over the class limit to be rejected")
+	}
+	if err := api.SetDialInByID(superGas, 2, 9.85); err == nil {
+		t.Error("Expected a race started earlier to keep the standard rules")
+	}
+}
+
+func TestMatchupPresets(t *testing.T) {
+	api := NewLibDragAPI()
+	if err := api.Initialize(); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	defer api.Stop()
+
+	if _, err := api.StartRaceWithOptions(RaceOptions{Matchup: []string{"top-fuel", "hovercraft"}}); err == nil {
+		t.Error("Expected an unknown preset to be rejected")
+	}
+	if _, err := api.StartRaceWithOptions(RaceOptions{Matchup: []string{"top-fuel", "funny-car"}}); err != nil {
+		t.Errorf("Expected a preset matchup to start, got %v", err)
+	}
+}
+
+// readingSource replays controller readings
+type readingSource []beam.Reading
+
+func (s readingSource) Run(ctx context.Context, emit func(beam.Reading)) error {
+	for _, r := range s {
+		emit(r)
+	}
+	return nil
+}
+
+func TestAttachBeamSource(t *testing.T) {
+	api := NewLibDragAPI()
+	cfg := config.NewDefaultConfig()
+	cfg.TrackConfig.Hardware = config.HardwareMap{Channels: map[int]config.HardwareChannel{
+		1: {Kind: config.ChannelBeam, Lane: 1, ID: "pre_stage"},
+		2: {Kind: config.ChannelBeam, Lane: 2, ID: "stage"},
+		3: {Kind: config.ChannelBeam, Lane: 1, ID: "60_foot", Offset: 2 * time.Millisecond},
+		4: {Kind: config.ChannelBeam, Lane: 2, ID: "60_foot", Offset: 2 * time.Millisecond},
+	}}
+	if err := api.InitializeWithConfig(cfg); err != nil {
+		t.Fatalf("InitializeWithConfig failed: %v", err)
+	}
+	defer api.Stop()
+
+	if err := api.ApplyReading(beam.Reading{Channel: 1, Broken: true}); err == nil {
+		t.Error("Expected a reading with no live race to be rejected")
+	}
+	if _, err := api.StartRaceWithID(); err != nil {
+		t.Fatalf("StartRaceWithID failed: %v", err)
+	}
+	raceID, err := api.StartRaceWithOptions(RaceOptions{LiveBeams: true})
+	if err != nil {
+		t.Fatalf("StartRaceWithOptions failed: %v", err)
+	}
+
+	latched := time.Unix(1_700_000_000, 0)
+	received := latched.Add(5 * time.Millisecond)
+	err = api.AttachBeamSource(context.Background(), readingSource{
+		{Channel: 1, Broken: true},
+		{Channel: 2, Broken: true},
+		{Channel: 3, Broken: true, At: latched, Accuracy: timers.AccuracyOf(timers.SourceHardware)},
+		{Channel: 4, Broken: true, At: received},
+		{Channel: 9, Broken: true}, // Spare channel
+	})
+	if err != nil {
+		t.Fatalf("AttachBeamSource failed: %v", err)
+	}
+
+	status, err := api.GetTreeStatusByID(raceID)
+	if err != nil {
+		t.Fatalf("GetTreeStatusByID failed: %v", err)
+	}
+	if status.LightStates[1][tree.LightPreStage] != tree.LightOn || status.LightStates[2][tree.LightStage] != tree.LightOn {
+		t.Errorf("Expected the wired staging beams to light the live race's tree, got %+v", status.LightStates)
+	}
+	orch, _ := api.getOrchestrator(raceID)
+	results := orch.GetResults()
+	if got := results[1].BeamTriggers["60_foot"]; !got.Equal(latched) || results[1].Timestamps["60_foot"].Source != timers.SourceHardware {
+		t.Errorf("Expected the latched time to stand, got %v (%+v)", got, results[1].Timestamps["60_foot"])
+	}
+	if got := results[2].BeamTriggers["60_foot"]; !got.Equal(received.Add(-2 * time.Millisecond)) {
+		t.Errorf("Expected the received time corrected for channel latency, got %v", got)
+	}
+}
+
+func TestDocumentPolling(t *testing.T) {
+	api := NewLibDragAPI()
+	if err := api.Initialize(); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	defer api.Stop()
+	wheel := timers.NewVirtualWheel(time.Now(), timers.DefaultTick)
+	api.SetClock(wheel)
+	api.SetPollingConfig(PollingConfig{Window: time.Second, MaxRate: 2})
+
+	raceID, err := api.StartRaceWithOptions(RaceOptions{LiveBeams: true})
+	if err != nil {
+		t.Fatalf("StartRaceWithOptions failed: %v", err)
+	}
+	if _, _, err := api.GetDocumentByID(raceID, "lights", "10.0.0.5"); err == nil {
+		t.Error("Expected an unknown document to be rejected")
+	}
+
+	first, info, err := api.GetDocumentByID(raceID, DocumentTreeStatus, "10.0.0.5")
+	if err != nil || info.Cached || info.Polls != 1 {
+		t.Fatalf("Expected the first poll marshaled, got %+v (%v)", info, err)
+	}
+	second, info, _ := api.GetDocumentByID(raceID, DocumentTreeStatus, "10.0.0.5")
+	if !info.Cached || info.Version != 1 || string(second) != string(first) || info.Stream != "" {
+		t.Errorf("Expected the unchanged tree served from the cache, got %+v", info)
+	}
+
+	// Over quota, the poller is pointed at the state stream and served the
+	// tree as last read, even when it changed
+	api.SetStagingBeamByID(raceID, 1, beam.BeamPreStage, true)
+	third, info, _ := api.GetDocumentByID(raceID, DocumentTreeStatus, "10.0.0.5")
+	if !info.Throttled || info.Stream != StreamState || string(third) != string(first) {
+		t.Errorf("Expected a throttled poll pointed at the state stream, got %+v", info)
+	}
+	if _, info, _ := api.GetDocumentByID(raceID, DocumentTreeStatus, "10.0.0.6"); info.Cached || info.Polls != 1 || info.Version != 2 {
+		t.Errorf("Expected another client to have its own quota and see the change, got %+v", info)
+	}
+
+	wheel.Advance(time.Second)
+	if _, info, _ := api.GetDocumentByID(raceID, DocumentTreeStatus, "10.0.0.5"); info.Polls != 1 || info.Stream != "" {
+		t.Errorf("Expected the quota to reset after the window, got %+v", info)
+	}
+
+	// In-process callers have no quota and always see the current state
+	for i := 0; i < 5; i++ {
+		if _, info, _ := api.GetDocumentByID(raceID, DocumentTreeStatus, ""); info.Throttled || info.Stream != "" {
+			t.Fatalf("Expected an in-process caller never throttled, got %+v", info)
+		}
+	}
+	api.SetStagingBeamByID(raceID, 2, beam.BeamPreStage, true)
+	var status tree.Status
+	if err := json.Unmarshal([]byte(api.GetTreeStatusJSONByID(raceID)), &status); err != nil || status.LightStates[2][tree.LightPreStage] != tree.LightOn {
+		t.Errorf("Expected the in-process getter to see lane 2 pre-staged, got %v (%v)", status.LightStates[2], err)
+	}
+}
+
+// TestTreeProfileOverride tests that a race can run on its own tree profile
+func TestTreeProfileOverride(t *testing.T) {
+	api := NewLibDragAPI()
+
+	cfg := config.NewDefaultConfig()
+	cfg.TreeConfig.Type = config.TreeSequenceSportsman
+	if err := api.InitializeWithConfig(cfg); err != nil {
+		t.Fatalf("InitializeWithConfig failed: %v", err)
+	}
+	defer api.Stop()
+
+	exhibitionID, err := api.StartRaceWithOptions(RaceOptions{Tree: &config.TreeSequenceConfig{Type: config.TreeSequencePro, GreenDelay: 400 * time.Millisecond}})
+	if err != nil {
+		t.Fatalf("StartRaceWithOptions failed: %v", err)
+	}
+	bracketID, err := api.StartRaceWithID()
+	if err != nil {
+		t.Fatalf("StartRaceWithID failed: %v", err)
+	}
+
+	profile := func(raceID string) *config.TreeSequenceConfig {
+		orch, err := api.getOrchestrator(raceID)
+		if err != nil {
+			t.Fatalf("getOrchestrator failed: %v", err)
+		}
+		return orch.GetResults()[1].TreeProfile
+	}
+
+	exhibition := profile(exhibitionID)
+	if exhibition == nil || exhibition.Type != config.TreeSequencePro || exhibition.GreenDelay != 400*time.Millisecond {
+		t.Fatalf("Expected a Pro .4 profile, got %+v", exhibition)
+	}
+	if exhibition.StageTimeout != cfg.TreeConfig.StageTimeout {
+		t.Errorf("Unset fields should keep the global profile, got %+v", exhibition)
+	}
+	if bracket := profile(bracketID); bracket == nil || bracket.Type != config.TreeSequenceSportsman {
+		t.Errorf("Expected the global sportsman profile, got %+v", bracket)
+	}
+	if cfg.TreeConfig.Type != config.TreeSequenceSportsman {
+		t.Error("Global tree config should not be mutated")
+	}
+
+	if _, err := api.StartRaceWithOptions(RaceOptions{Tree: &config.TreeSequenceConfig{Type: "christmas"}}); err == nil {
+		t.Error("Unknown tree type should be rejected")
+	}
+
+	// A class runs on its rules' tree preset, which a race can override
+	proStockID, err := api.StartRaceWithOptions(RaceOptions{Class: "Pro Stock"})
+	if err != nil {
+		t.Fatalf("StartRaceWithOptions failed: %v", err)
+	}
+	if proStock := profile(proStockID); proStock == nil || proStock.Preset != config.TreePresetPro400 || proStock.Type != config.TreeSequencePro || proStock.GreenDelay != 400*time.Millisecond {
+		t.Errorf("Expected Pro Stock on a Pro .400 tree, got %+v", proStock)
+	}
+	juniorID, err := api.StartRaceWithOptions(RaceOptions{Class: "Pro Stock", Tree: &config.TreeSequenceConfig{Preset: config.TreePresetJrDragster}})
+	if err != nil {
+		t.Fatalf("StartRaceWithOptions failed: %v", err)
+	}
+	if junior := profile(juniorID); junior == nil || junior.Preset != config.TreePresetJrDragster || junior.AmberDelay != 500*time.Millisecond {
+		t.Errorf("Expected the race's own preset, got %+v", junior)
+	}
+	if _, err := api.StartRaceWithOptions(RaceOptions{Tree: &config.TreeSequenceConfig{Preset: "pro_300"}}); err == nil {
+		t.Error("Unknown tree preset should be rejected")
+	}
+}
+
+// TestTrackClearInterlock tests that trees can only be armed on a clear track
+func TestTrackClearInterlock(t *testing.T) {
+	api := NewLibDragAPI()
+
+	cfg := config.NewDefaultConfig()
+	cfg.SafetyConfig.RequireTrackClear = true
+	if err := api.InitializeWithConfig(cfg); err != nil {
+		t.Fatalf("InitializeWithConfig failed: %v", err)
+	}
+	defer api.Stop()
+
+	if _, err := api.StartRaceWithID(); err == nil {
+		t.Fatal("Race should not start before the track is confirmed clear")
+	}
+	if err := api.SetTrackClear("radar", "tower"); err == nil {
+		t.Fatal("Unknown track-clear source should be rejected")
+	}
+
+	if err := api.SetTrackClear(TrackClearOfficial, "track manager"); err != nil {
+		t.Fatalf("SetTrackClear failed: %v", err)
+	}
+	raceID, err := api.StartRaceWithID()
+	if err != nil {
+		t.Fatalf("StartRaceWithID failed after track clear: %v", err)
+	}
+	if api.GetTrackClearStatus().Clear {
+		t.Fatal("Track-clear confirmation should be consumed by the pair")
+	}
+
+	// Re-arming needs a fresh confirmation or an override
+	if err := api.ArmTreeByID(raceID); err == nil {
+		t.Fatal("ArmTreeByID should be blocked without a track-clear confirmation")
+	}
+	if err := api.ArmTreeWithOverrideByID(raceID, &SafetyOverride{By: "starter"}); err == nil {
+		t.Fatal("Override without a reason should be rejected")
+	}
+	if err := api.ArmTreeWithOverrideByID(raceID, &SafetyOverride{By: "starter", Reason: "sensor fault, visually confirmed"}); err != nil {
+		t.Fatalf("ArmTreeWithOverrideByID failed: %v", err)
+	}
+
+	entries := api.GetAuditLog()
+	if len(entries) != 2 || entries[0].Action != "track_clear" || entries[1].Action != "interlock_override" || entries[1].RaceID != raceID {
+		t.Fatalf("Unexpected audit log %+v", entries)
+	}
+}
+
+// TestExportRace tests that exports apply per-field policies to entrant data
+func TestExportRace(t *testing.T) {
+	api := NewLibDragAPI()
+	if err := api.Initialize(); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	defer api.Stop()
+
+	raceID, err := api.StartRaceWithOptions(RaceOptions{
+		Class:      "Super Comp",
+		Drivers:    map[int]string{1: "SG-1234", 2: "SG-5678"},
+		CarNumbers: map[int]string{1: "1234", 2: "5678"},
+	})
+	if err != nil {
+		t.Fatalf("StartRaceWithOptions failed: %v", err)
+	}
+
+	records, err := api.ExportRaceByID(raceID, export.PublicConfig())
+	if err != nil {
+		t.Fatalf("ExportRaceByID failed: %v", err)
+	}
+	if len(records) != 2 || records[0].Driver != "" || records[0].CarNumber != "1234" || records[1].Class != "Super Comp" {
+		t.Fatalf("Unexpected public export %+v", records)
+	}
+
+	if _, err := api.ExportRaceByID(raceID, export.Config{Fields: map[string]export.Policy{"phone": export.PolicyOmit}}); err == nil {
+		t.Error("Expected error for unknown export field")
+	}
+	if _, err := api.ExportRaceByID("missing", export.PublicConfig()); err == nil {
+		t.Error("Expected error for unknown race")
+	}
+}
+
+// TestRaceStorage tests that finished races and their journals are saved
+func TestRaceStorage(t *testing.T) {
+	api := NewLibDragAPI()
+	if err := api.Initialize(); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	defer api.Stop()
+
+	if _, err := api.StartRaceStorage(RaceStorageConfig{}); err == nil {
+		t.Error("Expected error without a store")
+	}
+	store := storage.NewMemoryStore()
+	archive := storage.NewDirArchive(t.TempDir())
+	stop, err := api.StartRaceStorage(RaceStorageConfig{Track: "track-1", Store: store, Archive: archive})
+	if err != nil {
+		t.Fatalf("StartRaceStorage failed: %v", err)
+	}
+	defer stop()
+
+	raceID, err := api.StartRaceWithOptions(RaceOptions{Class: "Super Pro", SessionID: "eliminations"})
+	if err != nil {
+		t.Fatalf("StartRaceWithOptions failed: %v", err)
+	}
+	api.AbortRaceByID(raceID, "test")
+
+	ctx := context.Background()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		_, recordErr := store.GetRace(ctx, raceID)
+		_, journalErr := archive.GetObject(ctx, "journals/"+raceID+".json")
+		if recordErr == nil && journalErr == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	record, err := store.GetRace(ctx, raceID)
+	if err != nil {
+		t.Fatalf("Expected race stored, got %v", err)
+	}
+	if record.Track != "track-1" || record.Class != "Super Pro" || record.SessionID != "eliminations" || record.State != string(orchestrator.RaceStateAborted) {
+		t.Errorf("Unexpected record %+v", record)
+	}
+	if _, err := archive.GetObject(ctx, "journals/"+raceID+".json"); err != nil {
+		t.Errorf("Expected journal archived, got %v", err)
+	}
+}
+
+// TestSessionSchedule tests that races join the scheduled session's profile
+func TestSessionSchedule(t *testing.T) {
+	api := NewLibDragAPI()
+	if err := api.Initialize(); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	defer api.Stop()
+
+	if _, err := api.StartSessionSchedule(schedule.Config{Sessions: []schedule.Session{{ID: "bad", Open: "noon"}}}); err == nil {
+		t.Error("Expected error for an invalid schedule")
+	}
+	// One session all day, so whatever the time the schedule has it open
+	scheduler, err := api.StartSessionSchedule(schedule.Config{Sessions: []schedule.Session{{
+		ID:    "test-and-tune",
+		Open:  "00:00",
+		Class: "Super Gas",
+		Tree:  &config.TreeSequenceConfig{Type: config.TreeSequencePro},
+	}}})
+	if err != nil {
+		t.Fatalf("StartSessionSchedule failed: %v", err)
+	}
+	if session, ok := api.CurrentSession(); !ok || session.ID != "test-and-tune" {
+		t.Fatalf("Expected the scheduled session open, got %+v", session)
+	}
+
+	scheduledID, _ := api.StartRaceWithOptions(RaceOptions{})
+	explicitID, _ := api.StartRaceWithOptions(RaceOptions{SessionID: "exhibition"})
+	page := api.QueryRaces(RaceQuery{SessionID: "test-and-tune"})
+	if page.Total != 1 || page.Races[0].RaceID != scheduledID || page.Races[0].Class != "Super Gas" {
+		t.Errorf("Expected the unsessioned race in the scheduled session, got %+v", page.Races)
+	}
+	if page := api.QueryRaces(RaceQuery{SessionID: "exhibition"}); page.Total != 1 || page.Races[0].RaceID != explicitID {
+		t.Errorf("Expected an explicit session to take precedence, got %+v", page.Races)
+	}
+
+	scheduler.Stop()
+	if _, ok := api.CurrentSession(); ok {
+		t.Error("Expected no open session after stopping the schedule")
+	}
+}
+
+func TestAutoStartProfiles(t *testing.T) {
+	api := NewLibDragAPI()
+	if err := api.Initialize(); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	defer api.Stop()
+	store, err := storage.OpenFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("OpenFileStore failed: %v", err)
+	}
+	api.SetProfileStore(store)
+
+	bracket := autostart.ClassPreset("Sportsman")
+	bracket.StagingTimeout = 15 * time.Second
+	if err := api.PutAutoStartProfile(autostart.Profile{Name: "bracket", Classes: []string{"Super Pro"}, Config: bracket}); err != nil {
+		t.Fatalf("PutAutoStartProfile failed: %v", err)
+	}
+	exhibition := autostart.ClassPreset("ProFourTenths")
+	exhibition.RandomDelayMax = 0
+	if err := api.PutAutoStartProfile(autostart.Profile{Name: "exhibition", Config: exhibition}); err == nil {
+		t.Error("Expected a random delay range error")
+	}
+	exhibition.RandomDelayMax = exhibition.RandomDelayMin
+	if err := api.PutAutoStartProfile(autostart.Profile{Name: "exhibition", Config: exhibition}); err != nil {
+		t.Fatalf("PutAutoStartProfile failed: %v", err)
+	}
+	if err := api.PutAutoStartProfile(autostart.Profile{Name: "other", Classes: []string{"Super Pro"}, Config: bracket}); err == nil {
+		t.Error("Expected an error for a class that already has a profile")
+	}
+	if profiles, _ := api.ListAutoStartProfiles(); len(profiles) != 2 || profiles[0].Name != "bracket" {
+		t.Errorf("Expected both profiles by name, got %+v", profiles)
+	}
+
+	// Races use their class's profile unless they select one
+	byClass, err := api.StartRaceWithOptions(RaceOptions{Class: "Super Pro"})
+	if err != nil {
+		t.Fatalf("StartRaceWithOptions failed: %v", err)
+	}
+	if cfg, _ := api.GetAutoStartConfigByID(byClass); cfg.StagingTimeout != 15*time.Second {
+		t.Errorf("Expected the bracket profile for Super Pro, got %+v", cfg)
+	}
+	byName, err := api.StartRaceWithOptions(RaceOptions{Class: "Super Pro", AutoStartProfile: "exhibition"})
+	if err != nil {
+		t.Fatalf("StartRaceWithOptions failed: %v", err)
+	}
+	if cfg, _ := api.GetAutoStartConfigByID(byName); cfg.TreeSequenceType != config.TreeSequencePro || cfg.RandomDelayMax != cfg.RandomDelayMin {
+		t.Errorf("Expected the exhibition profile, got %+v", cfg)
+	}
+	preset, err := api.StartRaceWithOptions(RaceOptions{Class: "Super Gas"})
+	if err != nil {
+		t.Fatalf("StartRaceWithOptions failed: %v", err)
+	}
+	if cfg, _ := api.GetAutoStartConfigByID(preset); cfg.StagingTimeout != autostart.ClassPreset("Super Gas").StagingTimeout {
+		t.Errorf("Expected the class preset without a profile, got %+v", cfg)
+	}
+	if _, err := api.StartRaceWithOptions(RaceOptions{AutoStartProfile: "missing"}); err == nil {
+		t.Error("Expected error for an unknown profile")
+	}
+
+	if err := api.DeleteAutoStartProfile("bracket"); err != nil {
+		t.Fatalf("DeleteAutoStartProfile failed: %v", err)
+	}
+	if _, err := api.GetAutoStartProfile("bracket"); err == nil {
+		t.Error("Expected the deleted profile gone")
+	}
+	if cfg, _ := api.GetAutoStartConfigByID(byClass); cfg.StagingTimeout != 15*time.Second {
+		t.Error("Races already started should keep their profile")
+	}
+}
+
+// TestEliminations tests that bracket races advance their winners
+func TestEliminations(t *testing.T) {
+	api := NewLibDragAPI()
+	if err := api.Initialize(); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	defer api.Stop()
+
+	if _, err := api.StartRaceWithOptions(RaceOptions{BracketPair: "R1P1"}); err == nil {
+		t.Error("Expected error for a bracket pair with no bracket running")
+	}
+	if _, err := api.StartEliminations("Pro Stock", eliminations.LadderPro, []eliminations.Entry{{Registration: "PS-1"}, {Registration: "PS-2"}}); err != nil {
+		t.Fatalf("StartEliminations failed: %v", err)
+	}
+	if _, err := api.StartRaceWithOptions(RaceOptions{BracketPair: "R1P1", Drivers: map[int]string{1: "PS-1", 2: "PS-3"}}); err == nil {
+		t.Error("Expected error for a driver outside the pair")
+	}
+	raceID, err := api.StartRaceWithOptions(RaceOptions{Class: "Pro Stock", BracketPair: "R1P1", Drivers: map[int]string{1: "PS-2", 2: "PS-1"}})
+	if err != nil {
+		t.Fatalf("StartRaceWithOptions failed: %v", err)
+	}
+
+	// The simulated race is won from lane 1
+	var state eliminations.State
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) && state.Champion == "" {
+		time.Sleep(50 * time.Millisecond)
+		json.Unmarshal([]byte(api.GetBracketJSON()), &state)
+	}
+	if state.Champion != "PS-2" || state.Rounds[0].Pairs[0].RaceID != raceID {
+		t.Errorf("Expected PS-2 to win race %s, got %+v", raceID, state)
+	}
+}
+
+func TestTrackRecords(t *testing.T) {
+	api := NewLibDragAPI()
+	if err := api.Initialize(); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	defer api.Stop()
+
+	if err := api.RollbackTrackRecords("race-1"); err == nil {
+		t.Error("Expected error with track records not started")
+	}
+	if _, err := api.StartTrackRecords(); err != nil {
+		t.Fatalf("StartTrackRecords failed: %v", err)
+	}
+	raceID, err := api.StartRaceWithOptions(RaceOptions{Class: "Super Gas", Drivers: map[int]string{1: "SG-1", 2: "SG-2"}})
+	if err != nil {
+		t.Fatalf("StartRaceWithOptions failed: %v", err)
+	}
+
+	// The simulated lane 1 run sets both records
+	var current []records.Record
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) && len(current) < 2 {
+		time.Sleep(50 * time.Millisecond)
+		current, _ = api.GetTrackRecords()
+	}
+	if len(current) != 2 || current[0].Holder != "SG-1" || current[0].RaceID != raceID {
+		t.Fatalf("Expected SG-1 to hold both records, got %+v", current)
+	}
+
+	// The records are saved, and survive a restart until rolled back
+	for saved := 0; saved < 2 && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+		history, _ := loadTrackRecords(api.profileStore())
+		saved = len(history)
+	}
+	if _, err := api.StartTrackRecords(); err != nil {
+		t.Fatalf("StartTrackRecords failed: %v", err)
+	}
+	if current, _ = api.GetTrackRecords(); len(current) != 2 {
+		t.Fatalf("Expected the saved records to be loaded, got %+v", current)
+	}
+	if err := api.RollbackTrackRecords(raceID); err != nil {
+		t.Fatalf("RollbackTrackRecords failed: %v", err)
+	}
+	if current, _ = api.GetTrackRecords(); len(current) != 0 {
+		t.Errorf("Expected no records after the rollback, got %+v", current)
+	}
+	if history, _ := loadTrackRecords(api.profileStore()); len(history) != 0 {
+		t.Errorf("Expected the rollback to be saved, got %+v", history)
+	}
+}
+
+func TestEventReport(t *testing.T) {
+	api := NewLibDragAPI()
+	if _, err := api.EventReport("", nil); err == nil {
+		t.Error("Expected error before Initialize")
+	}
+	if err := api.Initialize(); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	defer api.Stop()
+
+	drivers := map[int]string{1: "PS-2", 2: "PS-1"}
+	if _, err := api.StartRaceWithOptions(RaceOptions{Class: "Pro Stock", Drivers: drivers, Tags: []string{tags.Qualifying}}); err != nil {
+		t.Fatalf("StartRaceWithOptions failed: %v", err)
+	}
+	if _, err := api.StartEliminations("Pro Stock", eliminations.LadderPro, []eliminations.Entry{{Registration: "PS-1"}, {Registration: "PS-2"}}); err != nil {
+		t.Fatalf("StartEliminations failed: %v", err)
+	}
+	if _, err := api.StartRaceWithOptions(RaceOptions{Class: "Pro Stock", BracketPair: "R1P1", Drivers: drivers}); err != nil {
+		t.Fatalf("StartRaceWithOptions failed: %v", err)
+	}
+
+	// Both simulated races are won from lane 1
+	var event report.Report
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+		var err error
+		if event, err = api.EventReport("Spring Nationals", map[string]report.Purse{"Pro Stock": {1000, 500}}); err != nil {
+			t.Fatalf("EventReport failed: %v", err)
+		}
+		if len(event.Qualifying) == 1 && event.Qualifying[0].Entries[1].BestET != nil && event.Eliminations[0].Champion != "" {
+			break
+		}
+	}
+	if len(event.Qualifying) != 1 || len(event.Qualifying[0].Entries) != 2 || event.Qualifying[0].Entries[0].Entrant != "PS-2" {
+		t.Fatalf("Expected PS-2 top qualifier, got %+v", event.Qualifying)
+	}
+	elims := event.Eliminations[0]
+	if elims.Champion != "PS-2" || elims.Rounds[0].Pairs[0].Seats[1].Run == nil || elims.Paid != 1500 {
+		t.Errorf("Expected PS-2 to win with both runs reported and the purse paid, got %+v", elims)
+	}
+}
+
+func TestExternalIDs(t *testing.T) {
+	api := NewLibDragAPI()
+	if err := api.Initialize(); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	defer api.Stop()
+
+	started := make(chan events.Event, 2)
+	api.Subscribe(events.EventRaceStart, func(e events.Event) { started <- e })
+
+	if _, err := api.StartRaceWithOptions(RaceOptions{ExternalIDs: map[string]string{"ticket": ""}}); err == nil {
+		t.Error("Expected error for an empty external ID")
+	}
+	external := map[string]string{"ems_run": "R-1042", "ticket": "T88"}
+	raceID, err := api.StartRaceWithOptions(RaceOptions{Class: "Super Gas", ExternalIDs: external})
+	if err != nil {
+		t.Fatalf("StartRaceWithOptions failed: %v", err)
+	}
+	external["ticket"] = "changed"
+	if _, err := api.StartRaceWithOptions(RaceOptions{Class: "Super Gas"}); err != nil {
+		t.Fatalf("StartRaceWithOptions failed: %v", err)
+	}
+
+	select {
+	case event := <-started:
+		if event.RaceID != raceID || event.External["ems_run"] != "R-1042" || event.External["ticket"] != "T88" {
+			t.Errorf("Expected race.start to carry the external IDs, got %+v", event)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("No race.start event")
+	}
+
+	page := api.QueryRaces(RaceQuery{External: map[string]string{"ems_run": "R-1042"}})
+	if page.Total != 1 || page.Races[0].RaceID != raceID || page.Races[0].External["ticket"] != "T88" {
+		t.Errorf("Expected to find the race by its external ID, got %+v", page)
+	}
+
+	records, err := api.ExportRaceByID(raceID, export.PublicConfig())
+	if err != nil {
+		t.Fatalf("ExportRaceByID failed: %v", err)
+	}
+	if records[0].External["ems_run"] != "R-1042" {
+		t.Errorf("Expected exports to carry the external IDs, got %+v", records[0])
+	}
+}
+
+// TestRaceTags tests that runs are tagged at start and afterward, and found
+// by their tags in queries, exports and storage
+func TestRaceTags(t *testing.T) {
+	api := NewLibDragAPI()
+	if err := api.Initialize(); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	defer api.Stop()
+
+	store := storage.NewMemoryStore()
+	stop, err := api.StartRaceStorage(RaceStorageConfig{Store: store})
+	if err != nil {
+		t.Fatalf("StartRaceStorage failed: %v", err)
+	}
+	defer stop()
+	retagged := make(chan events.Event, 4)
+	api.Subscribe(events.EventRaceTags, func(e events.Event) { retagged <- e })
+
+	if _, err := api.StartRaceWithOptions(RaceOptions{Tags: []string{"test,pass"}}); err == nil {
+		t.Error("Expected error for a tag with a comma")
+	}
+	qualifying, err := api.StartRaceWithOptions(RaceOptions{Class: "Super Gas", Tags: []string{"Qualifying"}})
+	if err != nil {
+		t.Fatalf("StartRaceWithOptions failed: %v", err)
+	}
+	testPass, err := api.StartRaceWithOptions(RaceOptions{Class: "Super Gas", Tags: []string{tags.TestPass}})
+	if err != nil {
+		t.Fatalf("StartRaceWithOptions failed: %v", err)
+	}
+
+	page := api.QueryRaces(RaceQuery{Tags: tags.Filter{Tags: []string{tags.Qualifying}}})
+	if page.Total != 1 || page.Races[0].RaceID != qualifying || page.Races[0].Tags[0] != tags.Qualifying {
+		t.Errorf("Expected the qualifying race, got %+v", page.Races)
+	}
+	records, err := api.ExportRaces(RaceQuery{Tags: tags.Filter{Exclude: []string{tags.Qualifying}}}, export.PublicConfig())
+	if err != nil {
+		t.Fatalf("ExportRaces failed: %v", err)
+	}
+	if len(records) != 2 || records[0].RaceID != testPass || records[0].Tags[0] != tags.TestPass {
+		t.Errorf("Expected the test pass's runs, got %+v", records)
+	}
+
+	// A stored race is retagged in the store once it is no longer active
+	api.AbortRaceByID(qualifying, "test")
+	ctx := context.Background()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, err := store.GetRace(ctx, qualifying); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	api.CompleteRace(qualifying)
+
+	updated, err := api.TagRaceByID(qualifying, []string{tags.RainShortened}, nil)
+	if err != nil {
+		t.Fatalf("TagRaceByID failed: %v", err)
+	}
+	if strings.Join(updated, ",") != "qualifying,rain-shortened" {
+		t.Errorf("Expected the race's tags updated, got %v", updated)
+	}
+	stored, _ := store.ListRaces(ctx, storage.Filter{Tags: tags.Filter{Tags: []string{tags.RainShortened}}})
+	if len(stored) != 1 || stored[0].RaceID != qualifying {
+		t.Errorf("Expected the stored race retagged, got %+v", stored)
+	}
+	select {
+	case event := <-retagged:
+		if event.RaceID != qualifying {
+			t.Errorf("Unexpected race.tags event %+v", event)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("No race.tags event")
+	}
+
+	if updated, err := api.TagRaceByID(testPass, nil, []string{tags.TestPass}); err != nil || updated != nil {
+		t.Errorf("Expected the test pass untagged, got %v, %v", updated, err)
+	}
+	if _, err := api.TagRaceByID("missing", []string{tags.Exhibition}, nil); err == nil {
+		t.Error("Expected error for an unknown race")
+	}
+}
+
+// TestShutdownBarrier tests that nothing of a race runs on once it is
+// aborted, or the API stopped, with its ambers lit
+func TestShutdownBarrier(t *testing.T) {
+	for _, stop := range []string{"abort", "stop"} {
+		t.Run(stop, func(t *testing.T) {
+			api := NewLibDragAPI()
+			if err := api.Initialize(); err != nil {
+				t.Fatalf("Initialize failed: %v", err)
+			}
+			wheel := timers.NewVirtualWheel(time.Now(), timers.DefaultTick)
+			api.SetClock(wheel)
+
+			var mu sync.Mutex
+			var seen []events.EventType
+			api.SubscribeAll(func(e events.Event) {
+				mu.Lock()
+				defer mu.Unlock()
+				seen = append(seen, e.Type)
+			})
+
+			raceID, err := api.StartRaceWithID()
+			if err != nil {
+				t.Fatalf("StartRaceWithID failed: %v", err)
+			}
+			orch, _ := api.getOrchestrator(raceID)
+
+			// Run the race on until its ambers light
+			deadline := time.Now().Add(5 * time.Second)
+			for orch.GetTreeStatus().LightStates[1][tree.LightAmber1] != tree.LightOn {
+				if time.Now().After(deadline) {
+					t.Fatal("Ambers never lit")
+				}
+				wheel.Advance(10 * time.Millisecond)
+				time.Sleep(time.Millisecond)
+			}
+
+			if stop == "abort" {
+				defer api.Stop()
+				if err := api.AbortRaceByID(raceID, "test"); err != nil {
+					t.Fatalf("AbortRaceByID failed: %v", err)
+				}
+			} else if err := api.Stop(); err != nil {
+				t.Fatalf("Stop failed: %v", err)
+			}
+			for _, timer := range wheel.Pending() {
+				if strings.HasPrefix(timer.Label.Name, "tree.") || strings.HasPrefix(timer.Label.Name, "orchestrator.") {
+					t.Errorf("Expected no race timers left, got %+v", timer)
+				}
+			}
+
+			wheel.Advance(10 * time.Second)
+			time.Sleep(50 * time.Millisecond)
+			if lights := orch.GetTreeStatus().LightStates[1]; lights[tree.LightGreen] != tree.LightOff {
+				t.Errorf("Expected no green once stopped, got %v", lights)
+			}
+			for lane, result := range orch.GetResults() {
+				if result.ReactionTime != nil {
+					t.Errorf("Expected lane %d untimed once stopped, got %+v", lane, result)
+				}
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			for _, eventType := range seen {
+				if eventType == events.EventTreeGreenOn || eventType == events.EventTimingReaction {
+					t.Errorf("Expected no %s once stopped, got %v", eventType, seen)
+				}
+			}
+			if stop == "abort" && seen[len(seen)-1] != events.EventRaceAbort {
+				t.Errorf("Expected race.abort last, got %v", seen)
+			}
+		})
+	}
+}
+
+// TestIdempotentStart tests that a retried start returns the original race
+func TestIdempotentStart(t *testing.T) {
+	api := NewLibDragAPI()
+	if err := api.Initialize(); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	defer api.Stop()
+
+	first, err := api.StartRaceWithOptions(RaceOptions{Class: "Pro Stock", RequestID: "req-1"})
+	if err != nil {
+		t.Fatalf("StartRaceWithOptions failed: %v", err)
+	}
+	retry, err := api.StartRaceWithOptions(RaceOptions{Class: "Pro Stock", RequestID: "req-1"})
+	if err != nil {
+		t.Fatalf("Retried StartRaceWithOptions failed: %v", err)
+	}
+	if retry != first {
+		t.Errorf("Expected retry to return %s, got %s", first, retry)
+	}
+	if active := api.GetActiveRaceCount(); active != 1 {
+		t.Errorf("Expected 1 active race after a retry, got %d", active)
+	}
+
+	other, err := api.StartRaceWithOptions(RaceOptions{Class: "Pro Stock", RequestID: "req-2"})
+	if err != nil {
+		t.Fatalf("StartRaceWithOptions failed: %v", err)
+	}
+	if other == first {
+		t.Error("Expected a new request ID to start a new race")
+	}
+
+	api.mu.Lock()
+	started := api.requests["req-1"]
+	started.at = started.at.Add(-RequestIDTTL - time.Second)
+	api.requests["req-1"] = started
+	api.mu.Unlock()
+	expired, err := api.StartRaceWithOptions(RaceOptions{Class: "Pro Stock", RequestID: "req-1"})
+	if err != nil {
+		t.Fatalf("StartRaceWithOptions failed: %v", err)
+	}
+	if expired == first {
+		t.Error("Expected an expired request ID to start a new race")
+	}
+}
+
+// TestBoundaryFoul tests that a boundary foul reported after the finish
+// reverses the decision
+func TestBoundaryFoul(t *testing.T) {
+	api := NewLibDragAPI()
+	if err := api.Initialize(); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	defer api.Stop()
+
+	if err := api.ReportBoundaryFoulByID("missing", 1); err == nil {
+		t.Error("Expected error for an unknown race")
+	}
+
+	winners := make(chan events.Event, 4)
+	api.Subscribe(events.EventRaceWinner, func(e events.Event) { winners <- e })
+	raceID, err := api.StartRaceWithID()
+	if err != nil {
+		t.Fatalf("StartRaceWithID failed: %v", err)
+	}
+	if err := api.ReportBoundaryFoulByID(raceID, 1); err == nil {
+		t.Error("Expected error before the race is running")
+	}
+
+	select {
+	case event := <-winners:
+		if event.Lane != 1 {
+			t.Fatalf("Expected the simulated lane 1 to win, got lane %d", event.Lane)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("No race.winner event")
+	}
+
+	if err := api.ReportBoundaryFoulByID(raceID, 3); err == nil {
+		t.Error("Expected error for a lane that did not race")
+	}
+	if err := api.ReportBoundaryFoulByID(raceID, 1); err != nil {
+		t.Fatalf("ReportBoundaryFoulByID failed: %v", err)
+	}
+	select {
+	case event := <-winners:
+		if event.Lane != 2 || event.Data["reason"] != results.ReasonOpponentFoul {
+			t.Errorf("Expected lane 2 to win on the boundary foul, got %+v", event)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("No race.winner event after the boundary foul")
+	}
+}
+
+// TestBoundaryViolation tests that lateral positions and boundary sensors
+// report a boundary violation during the run
+func TestBoundaryViolation(t *testing.T) {
+	api := NewLibDragAPI()
+	if err := api.Initialize(); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	defer api.Stop()
+
+	green := make(chan events.Event, 2)
+	violations := make(chan events.Event, 4)
+	winners := make(chan events.Event, 2)
+	api.Subscribe(events.EventTreeGreenOn, func(e events.Event) { green <- e })
+	api.Subscribe(events.EventRaceBoundaryViolation, func(e events.Event) { violations <- e })
+	api.Subscribe(events.EventRaceWinner, func(e events.Event) { winners <- e })
+	raceID, err := api.StartRaceWithID()
+	if err != nil {
+		t.Fatalf("StartRaceWithID failed: %v", err)
+	}
+	if err := api.ReportLateralPositionByID(raceID, 1, 8, time.Time{}); err != nil {
+		t.Errorf("Expected positions before the run to be ignored, got %v", err)
+	}
+	select {
+	case <-green:
+	case <-time.After(5 * time.Second):
+		t.Fatal("No tree.green_on event")
+	}
+
+	if err := api.ReportBoundarySensorByID(raceID, 1, "grass", time.Time{}); err == nil {
+		t.Error("Expected error for an unknown boundary")
+	}
+	if err := api.ReportLateralPositionByID(raceID, 1, 5.5, time.Time{}); err != nil {
+		t.Fatalf("ReportLateralPositionByID failed: %v", err)
+	}
+	if err := api.ReportLateralPositionByID(raceID, 1, 6.5, time.Time{}); err != nil {
+		t.Fatalf("ReportLateralPositionByID failed: %v", err)
+	}
+	if err := api.ReportBoundarySensorByID(raceID, 1, config.BoundaryOutside, time.Time{}); err != nil {
+		t.Fatalf("ReportBoundarySensorByID failed: %v", err)
+	}
+
+	select {
+	case event := <-violations:
+		if event.Lane != 1 || event.Data["boundary"] != config.BoundaryCenterline || event.Data["source"] != fouls.SourcePosition || event.Data["offset"] != 6.5 {
+			t.Errorf("Expected lane 1 over the centerline by position, got %+v", event)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("No race.boundary_violation event")
+	}
+	select {
+	case event := <-winners:
+		if event.Lane != 2 || event.Data["reason"] != results.ReasonOpponentFoul {
+			t.Errorf("Expected lane 2 to win on the boundary violation, got %+v", event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("No race.winner event")
+	}
+	select {
+	case event := <-violations:
+		t.Errorf("Expected a lane out of bounds to be reported once, got %+v", event)
+	default:
+	}
+}
+
+func TestCalibration(t *testing.T) {
+	api := NewLibDragAPI()
+	if _, err := api.StartCalibration(calibration.Config{}); err == nil {
+		t.Error("Expected error before initialization")
+	}
+
+	cfg := config.NewDefaultConfig()
+	cfg.TrackConfig.Hardware = config.HardwareMap{Channels: map[int]config.HardwareChannel{
+		1: {Kind: config.ChannelBeam, Lane: 1, ID: "stage"},
+		2: {Kind: config.ChannelBeam, Lane: 2, ID: "stage"},
+	}}
+	if err := api.InitializeWithConfig(cfg); err != nil {
+		t.Fatalf("InitializeWithConfig failed: %v", err)
+	}
+	defer api.Stop()
+	store := storage.NewMemoryStore()
+	api.SetProfileStore(store)
+	wheel := timers.NewVirtualWheel(time.Now(), timers.DefaultTick)
+	api.SetClock(wheel)
+
+	if _, err := api.GetCalibrationReport(); err == nil {
+		t.Error("Expected no report before calibrating")
+	}
+	if err := api.CalibrationSignal(1, true, time.Time{}); err == nil {
+		t.Error("Expected error before calibration starts")
+	}
+	if _, err := api.StartCalibration(calibration.Config{}); err != nil {
+		t.Fatalf("StartCalibration failed: %v", err)
+	}
+	for channel, latency := range []time.Duration{3 * time.Millisecond, 5 * time.Millisecond} {
+		if err := api.CalibrationSignal(channel+1, true, wheel.Now().Add(-latency)); err != nil {
+			t.Fatalf("CalibrationSignal failed: %v", err)
+		}
+		wheel.Advance(calibration.DefaultSettle + timers.DefaultTick)
+	}
+
+	report, err := api.GetCalibrationReport()
+	if err != nil {
+		t.Fatalf("GetCalibrationReport failed: %v", err)
+	}
+	if len(report.Measurements) != 2 {
+		t.Fatalf("Expected 2 measurements, got %d", len(report.Measurements))
+	}
+	api.mu.RLock()
+	hardware := api.globalConfig.Track().Hardware
+	api.mu.RUnlock()
+	if hardware.Channels[1].Offset != 3*time.Millisecond || hardware.Channels[2].Offset != 5*time.Millisecond {
+		t.Errorf("Expected offsets applied to the hardware map, got %+v", hardware.Channels)
+	}
+
+	// A restart applies the saved report
+	restarted := NewLibDragAPI()
+	if err := restarted.InitializeWithConfig(cfg); err != nil {
+		t.Fatalf("InitializeWithConfig failed: %v", err)
+	}
+	defer restarted.Stop()
+	restarted.SetProfileStore(store)
+	if err := restarted.ApplySavedCalibration(); err != nil {
+		t.Fatalf("ApplySavedCalibration failed: %v", err)
+	}
+	if _, err := restarted.GetCalibrationReport(); err != nil {
+		t.Errorf("Expected the saved report, got %v", err)
+	}
+	restarted.mu.RLock()
+	hardware = restarted.globalConfig.Track().Hardware
+	restarted.mu.RUnlock()
+	if hardware.Channels[2].Offset != 5*time.Millisecond {
+		t.Errorf("Expected the saved offsets applied, got %+v", hardware.Channels)
+	}
+}
+
+func TestTimeTrials(t *testing.T) {
+	api := NewLibDragAPI()
+	if _, err := api.StartTimeTrials(timetrial.Config{}); err == nil {
+		t.Error("Expected error before initialization")
+	}
+	if err := api.Initialize(); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	defer api.Stop()
+	store := storage.NewMemoryStore()
+	stop, err := api.StartRaceStorage(RaceStorageConfig{Track: "track-1", Store: store})
+	if err != nil {
+		t.Fatalf("StartRaceStorage failed: %v", err)
+	}
+	defer stop()
+
+	previous, err := api.StartTimeTrials(timetrial.Config{SessionID: "test-and-tune"})
+	if err != nil {
+		t.Fatalf("StartTimeTrials failed: %v", err)
+	}
+	previous.Stage(1, "DRV-1")
+	session, err := api.StartTimeTrials(timetrial.Config{SessionID: "test-and-tune", Class: "Super Gas"})
+	if err != nil {
+		t.Fatalf("StartTimeTrials failed: %v", err)
+	}
+	if current, ok := api.GetTimeTrials(); !ok || current != session {
+		t.Fatal("Expected the new session to replace the previous one")
+	}
+	if runs := previous.Runs(); len(runs) != 1 || runs[0].Status != timetrial.RunAborted {
+		t.Errorf("Expected the previous session's run aborted, got %+v", runs)
+	}
+
+	run, err := session.Stage(2, "DRV-2")
+	if err != nil {
+		t.Fatalf("Stage failed: %v", err)
+	}
+	green := time.Now()
+	session.Green(2, green)
+	session.TriggerBeam("stage", 2, green.Add(420*time.Millisecond))
+	session.TriggerBeam("1320_foot", 2, green.Add(8*time.Second))
+
+	ctx := context.Background()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, err := store.GetRace(ctx, run.ID); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	record, err := store.GetRace(ctx, run.ID)
+	if err != nil {
+		t.Fatalf("Expected the run stored, got %v", err)
+	}
+	if record.Track != "track-1" || record.SessionID != "test-and-tune" || record.Class != "Super Gas" || record.State != timetrial.RunComplete {
+		t.Errorf("Unexpected record %+v", record)
+	}
+	var stored timetrial.Run
+	if err := json.Unmarshal(record.Data, &stored); err != nil || stored.Results == nil || !stored.Results.IsComplete {
+		t.Errorf("Expected the run's results stored, got %+v (%v)", stored, err)
+	}
+}
+
+func TestPracticeTree(t *testing.T) {
+	api := NewLibDragAPI()
+	if _, err := api.StartPracticeTree(practice.Config{}); err == nil {
+		t.Error("Expected error before initialization")
+	}
+	if err := api.Initialize(); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	defer api.Stop()
+
+	previous, err := api.StartPracticeTree(practice.Config{})
+	if err != nil {
+		t.Fatalf("StartPracticeTree failed: %v", err)
+	}
+	session, err := api.StartPracticeTree(practice.Config{
+		Lanes:     []int{1},
+		Tree:      &config.TreeSequenceConfig{GreenDelay: 50 * time.Millisecond},
+		Simulator: simulation.Reference(),
+	})
+	if err != nil {
+		t.Fatalf("StartPracticeTree failed: %v", err)
+	}
+	if current, ok := api.GetPracticeTree(); !ok || current != session {
+		t.Fatal("Expected the new session to replace the previous one")
+	}
+	if _, err := previous.Run(); err == nil {
+		t.Error("Expected the previous session stopped")
+	}
+
+	statsReceived := make(chan practice.Stats, 1)
+	api.eventBus.Subscribe(events.EventPracticeStats, func(e events.Event) {
+		statsReceived <- e.Data["stats"].(practice.Stats)
+	})
+	if _, err := session.Run(); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	select {
+	case stats := <-statsReceived:
+		if stats.Lane != 1 || stats.Launches != 1 || stats.Best == nil || *stats.Best != 0.4 {
+			t.Errorf("Expected lane 1's simulated .400 launch, got %+v", stats)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected practice.stats after the run")
+	}
+}
+
+func TestWebhooks(t *testing.T) {
+	api := NewLibDragAPI()
+	if _, err := api.StartWebhooks(webhook.Config{}); err == nil {
+		t.Error("Expected error before initialization")
+	}
+	if err := api.Initialize(); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	defer api.Stop()
+
+	received := make(chan string, 4)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.Header.Get(webhook.HeaderEvent)
+	}))
+	defer receiver.Close()
+
+	if _, err := api.StartWebhooks(webhook.Config{Endpoints: []webhook.Endpoint{{URL: "not a url"}}}); err == nil {
+		t.Error("Expected an invalid endpoint to be rejected")
+	}
+	dispatcher, err := api.StartWebhooks(webhook.Config{Endpoints: []webhook.Endpoint{{URL: receiver.URL, Secret: "s3cret"}}})
+	if err != nil {
+		t.Fatalf("StartWebhooks failed: %v", err)
+	}
+	if current, ok := api.GetWebhooks(); !ok || current != dispatcher {
+		t.Fatal("Expected the dispatcher to be running")
+	}
+
+	raceID, err := api.StartRaceWithID()
+	if err != nil {
+		t.Fatalf("StartRaceWithID failed: %v", err)
+	}
+	if err := api.AbortRaceByID(raceID, "oil down"); err != nil {
+		t.Fatalf("AbortRaceByID failed: %v", err)
+	}
+	// The abort also emergency stops the tree; both are incidents
+	delivered := make(map[string]bool)
+	timeout := time.After(2 * time.Second)
+	for len(delivered) < 2 {
+		select {
+		case eventType := <-received:
+			delivered[eventType] = true
+		case <-timeout:
+			t.Fatalf("Expected webhooks for the abort and emergency stop, got %v", delivered)
+		}
+	}
+	if !delivered[string(events.EventRaceAbort)] || !delivered[string(events.EventTreeEmergencyStop)] {
+		t.Errorf("Expected the abort and emergency stop delivered, got %v", delivered)
+	}
+}
+
+func TestStartSignal(t *testing.T) {
+	api := NewLibDragAPI()
+	if err := api.Initialize(); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	defer api.Stop()
+
+	treeRace, err := api.StartRaceWithID()
+	if err != nil {
+		t.Fatalf("StartRaceWithID failed: %v", err)
+	}
+	if err := api.StartSignalByID(treeRace, time.Time{}); err == nil {
+		t.Error("Expected a tree race to reject a start signal")
+	}
+
+	completions := make(chan events.Event, 2)
+	api.Subscribe(events.EventRaceComplete, func(e events.Event) { completions <- e })
+	raceID, err := api.StartRaceWithOptions(RaceOptions{Tree: &config.TreeSequenceConfig{Type: config.TreeSequenceStartSignal}})
+	if err != nil {
+		t.Fatalf("StartRaceWithOptions failed: %v", err)
+	}
+	if err := api.StartSignalByID(raceID, time.Time{}); err == nil {
+		t.Error("Expected the signal to wait for both lanes to stage")
+	}
+
+	// The arm drops once both cars are staged
+	deadline := time.Now().Add(5 * time.Second)
+	for api.StartSignalByID(raceID, time.Time{}) != nil {
+		if time.Now().After(deadline) {
+			t.Fatal("Lanes never staged for the start signal")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err := api.StartSignalByID(raceID, time.Time{}); err == nil {
+		t.Error("Expected a second start signal to be rejected")
+	}
+
+	for {
+		select {
+		case event := <-completions:
+			if event.RaceID != raceID {
+				continue
+			}
+			results := event.Data["results"].(map[int]*timing.TimingResults)
+			if *results[1].ReactionTime != 0.4 || *results[2].ReactionTime != 0.45 {
+				t.Errorf("Expected reaction times from the start signal, got %.3f and %.3f",
+					*results[1].ReactionTime, *results[2].ReactionTime)
+			}
+			return
+		case <-time.After(5 * time.Second):
+			t.Fatal("No race.complete event")
+		}
+	}
+}
+
+func TestLiveBeamRace(t *testing.T) {
+	api := NewLibDragAPI()
+	if err := api.Initialize(); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	defer api.Stop()
+
+	greens := make(chan events.Event, 4)
+	completions := make(chan events.Event, 2)
+	api.Subscribe(events.EventTreeGreenOn, func(e events.Event) { greens <- e })
+	api.Subscribe(events.EventRaceComplete, func(e events.Event) { completions <- e })
+	raceID, err := api.StartRaceWithOptions(RaceOptions{LiveBeams: true})
+	if err != nil {
+		t.Fatalf("StartRaceWithOptions failed: %v", err)
+	}
+	if err := api.TriggerBeamByID(raceID, 1, "2640_foot", time.Time{}); err == nil {
+		t.Error("Expected a beam missing from the layout to be rejected")
+	}
+	if err := api.TriggerBeamByID(raceID, 3, "1320_foot", time.Time{}); err == nil {
+		t.Error("Expected an invalid lane to be rejected")
+	}
+
+	// Nothing runs until the cars stage
+	time.Sleep(100 * time.Millisecond)
+	if status, _ := api.GetRaceStatusByID(raceID); status.State != orchestrator.RaceStateStaging {
+		t.Errorf("Expected a live race to wait for staging, got %s", status.State)
+	}
+	for lane := 1; lane <= 2; lane++ {
+		api.SetStagingBeamByID(raceID, lane, beam.BeamPreStage, true)
+		api.SetStagingBeamByID(raceID, lane, beam.BeamStage, true)
+	}
+
+	var green time.Time
+	select {
+	case event := <-greens:
+		green = event.Data["green_time"].(time.Time)
+	case <-time.After(5 * time.Second):
+		t.Fatal("No tree.green_on event")
+	}
+
+	passes := map[int][]struct {
+		beamID string
+		at     time.Duration
+	}{
+		1: {{"stage", 420 * time.Millisecond}, {"60_foot", 1400 * time.Millisecond}, {"1320_foot", 8100 * time.Millisecond}},
+		2: {{"stage", 510 * time.Millisecond}, {"60_foot", 1500 * time.Millisecond}, {"1320_foot", 8400 * time.Millisecond}},
+	}
+	for lane, crossings := range passes {
+		for _, crossing := range crossings {
+			if err := api.TriggerBeamByID(raceID, lane, crossing.beamID, green.Add(crossing.at)); err != nil {
+				t.Fatalf("TriggerBeamByID failed: %v", err)
+			}
+		}
+	}
+
+	for {
+		select {
+		case event := <-completions:
+			if event.RaceID != raceID {
+				continue
+			}
+			results := event.Data["results"].(map[int]*timing.TimingResults)
+			if *results[1].QuarterMileTime != 7.68 || *results[2].QuarterMileTime != 7.89 {
+				t.Errorf("Expected elapsed times from the beams, got %.3f and %.3f",
+					*results[1].QuarterMileTime, *results[2].QuarterMileTime)
+			}
+			if event.Data["winner_lane"] != 1 {
+				t.Errorf("Expected lane 1 to win, got %v", event.Data["winner_lane"])
+			}
+			return
+		case <-time.After(5 * time.Second):
+			t.Fatal("No race.complete event")
+		}
+	}
+}
+
+// TestLiveBeamRaceFromReadings tests that controller readings run a live
+// race: staging beams light the tree, the stage beam clearing after the
+// tree starts times the launch and the finish line beam ends the run
+func TestLiveBeamRaceFromReadings(t *testing.T) {
+	api := NewLibDragAPI()
+	cfg := config.NewDefaultConfig()
+	cfg.TrackConfig.Hardware = config.HardwareMap{Channels: map[int]config.HardwareChannel{
+		0: {Kind: config.ChannelBeam, Lane: 1, ID: "pre_stage"},
+		1: {Kind: config.ChannelBeam, Lane: 1, ID: "stage"},
+		2: {Kind: config.ChannelBeam, Lane: 2, ID: "pre_stage"},
+		3: {Kind: config.ChannelBeam, Lane: 2, ID: "stage"},
+		4: {Kind: config.ChannelBeam, Lane: 1, ID: "1320_foot"},
+		5: {Kind: config.ChannelBeam, Lane: 2, ID: "1320_foot"},
+	}}
+	if err := api.InitializeWithConfig(cfg); err != nil {
+		t.Fatalf("InitializeWithConfig failed: %v", err)
+	}
+	defer api.Stop()
+
+	greens := make(chan events.Event, 4)
+	completions := make(chan events.Event, 2)
+	api.Subscribe(events.EventTreeGreenOn, func(e events.Event) { greens <- e })
+	api.Subscribe(events.EventRaceComplete, func(e events.Event) { completions <- e })
+	raceID, err := api.StartRaceWithOptions(RaceOptions{LiveBeams: true})
+	if err != nil {
+		t.Fatalf("StartRaceWithOptions failed: %v", err)
+	}
+	for _, channel := range []int{0, 2, 1, 3} {
+		if err := api.ApplyReading(beam.Reading{Channel: channel, Broken: true}); err != nil {
+			t.Fatalf("ApplyReading failed: %v", err)
+		}
+	}
+
+	var green time.Time
+	select {
+	case event := <-greens:
+		green = event.Data["green_time"].(time.Time)
+	case <-time.After(5 * time.Second):
+		t.Fatal("No tree.green_on event")
+	}
+	latched := func(channel int, broken bool, after time.Duration) beam.Reading {
+		return beam.Reading{Channel: channel, Broken: broken, At: green.Add(after), Accuracy: timers.AccuracyOf(timers.SourceHardware)}
+	}
+	for _, r := range []beam.Reading{
+		latched(0, false, 300*time.Millisecond),
+		latched(1, false, 420*time.Millisecond),
+		latched(2, false, 400*time.Millisecond),
+		latched(3, false, 510*time.Millisecond),
+		latched(4, true, 8100*time.Millisecond),
+		latched(5, true, 8400*time.Millisecond),
+	} {
+		if err := api.ApplyReading(r); err != nil {
+			t.Fatalf("ApplyReading failed: %v", err)
+		}
+	}
+
+	for {
+		select {
+		case event := <-completions:
+			if event.RaceID != raceID {
+				continue
+			}
+			results := event.Data["results"].(map[int]*timing.TimingResults)
+			if *results[1].QuarterMileTime != 7.68 || *results[2].QuarterMileTime != 7.89 {
+				t.Errorf("Expected elapsed times from the launch, got %.3f and %.3f",
+					*results[1].QuarterMileTime, *results[2].QuarterMileTime)
+			}
+			return
+		case <-time.After(5 * time.Second):
+			t.Fatal("No race.complete event")
+		}
+	}
+}
+
+// TestLiveBeamRedLight tests that a car leaving before its green lights its
+// own red bulb on the tree, leaving the other lane's green lit
+func TestLiveBeamRedLight(t *testing.T) {
+	api := NewLibDragAPI()
+	if err := api.Initialize(); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	defer api.Stop()
+
+	greens := make(chan events.Event, 4)
+	redLights := make(chan events.Event, 2)
+	api.Subscribe(events.EventTreeGreenOn, func(e events.Event) { greens <- e })
+	api.Subscribe(events.EventTreeRedLight, func(e events.Event) { redLights <- e })
+	raceID, err := api.StartRaceWithOptions(RaceOptions{LiveBeams: true})
+	if err != nil {
+		t.Fatalf("StartRaceWithOptions failed: %v", err)
+	}
+	for lane := 1; lane <= 2; lane++ {
+		api.SetStagingBeamByID(raceID, lane, beam.BeamPreStage, true)
+		api.SetStagingBeamByID(raceID, lane, beam.BeamStage, true)
+	}
+
+	var green time.Time
+	select {
+	case event := <-greens:
+		green = event.Data["green_time"].(time.Time)
+	case <-time.After(5 * time.Second):
+		t.Fatal("No tree.green_on event")
+	}
+	if err := api.TriggerBeamByID(raceID, 2, "stage", green.Add(-20*time.Millisecond)); err != nil {
+		t.Fatalf("TriggerBeamByID failed: %v", err)
+	}
+
+	select {
+	case event := <-redLights:
+		if rt, _ := event.Data["reaction_time"].(float64); event.Lane != 2 || rt >= 0 {
+			t.Errorf("Expected lane 2 red-lighted, got lane %d at %v", event.Lane, event.Data["reaction_time"])
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("No tree.red_light event")
+	}
+	status, err := api.GetTreeStatusByID(raceID)
+	if err != nil {
+		t.Fatalf("GetTreeStatusByID failed: %v", err)
+	}
+	if status.LightStates[2][tree.LightRed] != tree.LightOn || status.LightStates[2][tree.LightGreen] != tree.LightOff {
+		t.Errorf("Expected lane 2's red bulb lit instead of its green, got %v", status.LightStates[2])
+	}
+	if status.LightStates[1][tree.LightGreen] != tree.LightOn || status.LightStates[1][tree.LightRed] == tree.LightOn {
+		t.Errorf("Expected lane 1's green to stay lit, got %v", status.LightStates[1])
+	}
+}
+
+// TestPreStagingPhases tests that a car crossing the staging beams in its
+// burnout is not seen by the tree until it approaches
+func TestPreStagingPhases(t *testing.T) {
+	api := NewLibDragAPI()
+	if err := api.Initialize(); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	defer api.Stop()
+
+	phases := make(chan events.Event, 4)
+	for _, eventType := range []events.EventType{events.EventRaceBurnout, events.EventRaceBackup, events.EventRaceApproach} {
+		api.Subscribe(eventType, func(e events.Event) { phases <- e })
+	}
+	nextPhase := func(expected events.EventType) {
+		t.Helper()
+		select {
+		case event := <-phases:
+			if event.Type != expected || event.Data["duration"] != 5*time.Second {
+				t.Fatalf("Expected %s for 5s, got %+v", expected, event)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("No %s event", expected)
+		}
+	}
+
+	raceID, err := api.StartRaceWithOptions(RaceOptions{
+		LiveBeams:  true,
+		PreStaging: &orchestrator.PreStagingConfig{Burnout: 5 * time.Second, Backup: 5 * time.Second, Approach: 5 * time.Second},
+	})
+	if err != nil {
+		t.Fatalf("StartRaceWithOptions failed: %v", err)
+	}
+	defer api.AbortRaceByID(raceID, "test over")
+	nextPhase(events.EventRaceBurnout)
+	if status, _ := api.GetRaceStatusByID(raceID); status.State != orchestrator.RaceStateBurnout || status.PhaseEnds.IsZero() {
+		t.Errorf("Expected the race in its burnout, got %+v", status)
+	}
+
+	// Lane 1 burns out across both beams and backs out; lane 2 stops
+	// short in the pre-stage beam
+	for _, broken := range []bool{true, false} {
+		api.SetStagingBeamByID(raceID, 1, beam.BeamPreStage, broken)
+		api.SetStagingBeamByID(raceID, 1, beam.BeamStage, broken)
+	}
+	api.SetStagingBeamByID(raceID, 2, beam.BeamPreStage, true)
+	if treeStatus, _ := api.GetTreeStatusByID(raceID); treeStatus.LightStates[1][tree.LightStage] == tree.LightOn || treeStatus.LightStates[2][tree.LightPreStage] == tree.LightOn {
+		t.Error("Expected no staging bulbs during the burnout")
+	}
+
+	if err := api.AdvancePhaseByID(raceID); err != nil {
+		t.Fatalf("AdvancePhaseByID failed: %v", err)
+	}
+	nextPhase(events.EventRaceBackup)
+	if err := api.AdvancePhaseByID(raceID); err != nil {
+		t.Fatalf("AdvancePhaseByID failed: %v", err)
+	}
+	nextPhase(events.EventRaceApproach)
+
+	// Lane 2's pre-stage bulb ends the approach
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		status, _ := api.GetRaceStatusByID(raceID)
+		if status.State == orchestrator.RaceStateStaging {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the race to be staging, got %s", status.State)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	treeStatus, _ := api.GetTreeStatusByID(raceID)
+	if treeStatus.LightStates[1][tree.LightPreStage] == tree.LightOn || treeStatus.LightStates[2][tree.LightPreStage] != tree.LightOn {
+		t.Errorf("Expected only lane 2 pre-staged, got %+v", treeStatus.LightStates)
+	}
+	if err := api.AdvancePhaseByID(raceID); err == nil {
+		t.Error("Expected error advancing a race past pre-staging")
+	}
+}
+
+func TestComponentWrapper(t *testing.T) {
+	api := NewLibDragAPI()
+	if err := api.Initialize(); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	defer api.Stop()
+
+	injector := chaos.NewInjector(1)
+	injector.SetEventBus(api.eventBus)
+	api.SetComponentWrapper(injector.Wrap)
+
+	armFailure := errors.New("timing controller offline")
+	injector.Inject(chaos.Fault{Op: chaos.OpArm, Component: "timing_system", Err: armFailure, Count: 1})
+	faults := make(chan events.Event, 4)
+	api.Subscribe(events.EventFaultInjected, func(e events.Event) { faults <- e })
+	if _, err := api.StartRaceWithID(); err == nil || !strings.Contains(err.Error(), armFailure.Error()) {
+		t.Errorf("Expected the race to fail to arm, got %v", err)
+	}
+	select {
+	case <-faults:
+	case <-time.After(time.Second):
+		t.Error("Expected a fault.injected event")
+	}
+
+	// The wrapped timing system and tree still run a race, losing the
+	// events the drill drops
+	injector.Inject(chaos.Fault{Op: chaos.OpPublish, EventTypes: []events.EventType{events.EventTimingQuarterMile}, Lanes: []int{2}, Drop: true})
+	quarters := make(chan events.Event, 4)
+	api.Subscribe(events.EventTimingQuarterMile, func(e events.Event) { quarters <- e })
+	raceID, err := api.StartRaceWithID()
+	if err != nil {
+		t.Fatalf("StartRaceWithID failed: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := api.WaitForCompletion(ctx, raceID); err != nil {
+		t.Fatalf("Race with wrapped components never completed: %v", err)
+	}
+	if len(quarters) != 1 {
+		t.Errorf("Expected only lane 1's quarter mile event, got %d", len(quarters))
+	}
+}
+
+func TestSlipPrinting(t *testing.T) {
+	api := NewLibDragAPI()
+	if err := api.Initialize(); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	defer api.Stop()
+
+	if err := api.ReprintSlip(1); err == nil {
+		t.Error("Expected a reprint to fail before slip printing starts")
+	}
+	printed := make(chan slips.Slip, 4)
+	if _, err := api.StartSlipPrinting(slips.PrinterFunc(func(slip slips.Slip) error {
+		printed <- slip
+		return nil
+	}), slips.Config{}); err != nil {
+		t.Fatalf("StartSlipPrinting failed: %v", err)
+	}
+
+	// Lane 2 has no registered driver but still gets a slip
+	raceID, err := api.StartRaceWithOptions(RaceOptions{
+		Drivers:    map[int]string{1: "DRV-1"},
+		CarNumbers: map[int]string{1: "1234"},
+	})
+	if err != nil {
+		t.Fatalf("StartRaceWithOptions failed: %v", err)
+	}
+	next := func() slips.Slip {
+		t.Helper()
+		select {
+		case slip := <-printed:
+			return slip
+		case <-time.After(10 * time.Second):
+			t.Fatal("No slip printed")
+		}
+		return slips.Slip{}
+	}
+	lane1, lane2 := next(), next()
+	if lane1.RaceID != raceID || lane1.Registration != "DRV-1" || lane1.CarNumber != "1234" || lane1.ElapsedTime == nil {
+		t.Errorf("Unexpected lane 1 slip %+v", lane1)
+	}
+	if lane2.Lane != 2 || lane2.Registration != "" || lane2.RunNumber != 2 {
+		t.Errorf("Unexpected lane 2 slip %+v", lane2)
+	}
+
+	if err := api.ReprintSlip(lane1.RunNumber); err != nil {
+		t.Fatalf("ReprintSlip failed: %v", err)
+	}
+	if reprint := next(); !reprint.Reprint || reprint.RunNumber != lane1.RunNumber {
+		t.Errorf("Expected run %d reprinted, got %+v", lane1.RunNumber, reprint)
+	}
+}
+
+func TestForgetDriver(t *testing.T) {
+	api := NewLibDragAPI()
+	if err := api.Initialize(); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	defer api.Stop()
+
+	if _, err := api.ForgetDriver(DriverErasure{Registration: "SG-1", Mode: "shred"}); err == nil {
+		t.Error("Expected an unknown mode to be rejected")
+	}
+	erased := make(chan events.Event, 4)
+	api.Subscribe(events.EventDriverErased, func(e events.Event) { erased <- e })
+	storageCfg := RaceStorageConfig{Track: "track-1", Store: storage.NewMemoryStore(), Archive: storage.NewDirArchive(t.TempDir())}
+	stop, err := api.StartRaceStorage(storageCfg)
+	if err != nil {
+		t.Fatalf("StartRaceStorage failed: %v", err)
+	}
+	defer stop()
+	if _, err := api.StartTrackRecords(); err != nil {
+		t.Fatalf("StartTrackRecords failed: %v", err)
+	}
+	raceID, err := api.StartRaceWithOptions(RaceOptions{Class: "Super Gas", Drivers: map[int]string{1: "SG-1", 2: "SG-2"}, Licenses: map[int]string{1: "L-1"}})
+	if err != nil {
+		t.Fatalf("StartRaceWithOptions failed: %v", err)
+	}
+
+	// The simulated lane 1 run sets both records, and the race is stored
+	ctx := context.Background()
+	journalKey := "journals/" + raceID + ".json"
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		current, _ := api.GetTrackRecords()
+		_, recordErr := storageCfg.Store.GetRace(ctx, raceID)
+		_, journalErr := storageCfg.Archive.GetObject(ctx, journalKey)
+		if len(current) == 2 && recordErr == nil && journalErr == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	storedDrivers := func() storedRace {
+		t.Helper()
+		record, err := storageCfg.Store.GetRace(ctx, raceID)
+		if err != nil {
+			t.Fatalf("Expected the race stored, got %v", err)
+		}
+		var race storedRace
+		json.Unmarshal(record.Data, &race)
+		return race
+	}
+	if race := storedDrivers(); race.Drivers[1] != "SG-1" {
+		t.Fatalf("Expected SG-1 stored, got %+v", race.Drivers)
+	}
+
+	// Anonymizing keeps the run and records under a pseudonym
+	report, err := api.ForgetDriver(DriverErasure{Registration: "SG-1", Mode: ErasureAnonymize, Storage: storageCfg})
+	if err != nil {
+		t.Fatalf("ForgetDriver failed: %v", err)
+	}
+	pseudonym := report.Pseudonym
+	if !strings.HasPrefix(pseudonym, "anon-") || report.StoredRaces != 1 || report.Journals != 1 || report.Records != 2 || report.ActiveRaces != 1 {
+		t.Errorf("Unexpected report %+v", report)
+	}
+	if race := storedDrivers(); race.Drivers[1] != pseudonym || race.Drivers[2] != "SG-2" || race.Results[1] == nil {
+		t.Errorf("Expected the stored run kept under the pseudonym, got %+v", race.Drivers)
+	}
+	if journal, _ := storageCfg.Archive.GetObject(ctx, journalKey); strings.Contains(string(journal), `"SG-1"`) {
+		t.Error("Expected the registration gone from the journal")
+	}
+	if current, _ := api.GetTrackRecords(); current[0].Holder != pseudonym {
+		t.Errorf("Expected the records kept under the pseudonym, got %+v", current)
+	}
+	api.mu.RLock()
+	info := api.raceInfo[raceID]
+	api.mu.RUnlock()
+	if info.drivers[1] != pseudonym || info.licenses[1] != "" {
+		t.Errorf("Expected the active race anonymized, got %+v", info)
+	}
+	select {
+	case e := <-erased:
+		if e.Data["report"].(ErasureReport).Pseudonym != pseudonym {
+			t.Errorf("Unexpected erasure event %+v", e)
+		}
+	case <-time.After(time.Second):
+		t.Error("Expected privacy.driver_erased")
+	}
+
+	// Deleting removes the run, its journal and the records
+	report, err = api.ForgetDriver(DriverErasure{Registration: pseudonym, Mode: ErasureDelete, Storage: storageCfg})
+	if err != nil || report.StoredRaces != 1 || report.Records != 2 {
+		t.Fatalf("Unexpected report %+v, %v", report, err)
+	}
+	if race := storedDrivers(); len(race.Drivers) != 1 || race.Results[1] != nil || race.Results[2] == nil {
+		t.Errorf("Expected only the opponent's run kept, got %+v", race)
+	}
+	if _, err := storageCfg.Archive.GetObject(ctx, journalKey); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("Expected the journal deleted, got %v", err)
+	}
+	if current, _ := api.GetTrackRecords(); len(current) != 0 {
+		t.Errorf("Expected the records deleted, got %+v", current)
+	}
+
+	// Retention prunes what is left
+	storageCfg.Retention = storage.Retention{Classes: map[string]time.Duration{"Super Gas": time.Nanosecond}}
+	if pruned, err := api.PruneRaceStorage(storageCfg); err != nil || pruned != 1 {
+		t.Errorf("Expected the race pruned, got %d, %v", pruned, err)
+	}
+}
@@ -0,0 +1,150 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/benharold/libdrag/pkg/calibration"
+	"github.com/benharold/libdrag/pkg/config"
+	"github.com/benharold/libdrag/pkg/storage"
+	"github.com/benharold/libdrag/pkg/timers"
+)
+
+// The last calibration report is kept as a storage.Profile in the profile
+// store, with the facility's other settings
+const (
+	calibrationKind = "calibration"
+	calibrationName = "report"
+)
+
+// StartCalibration starts the sensor calibration wizard over the beams in
+// the configured hardware map, replacing any run in progress. The wizard
+// publishes calibration.prompt for each beam in turn; feed it the
+// controller's raw signals with CalibrationSignal. When every beam is
+// calibrated, the measured offsets are written into the hardware map races
+// use and the report is saved.
+func (api *LibDragAPI) StartCalibration(cfg calibration.Config) (*calibration.Wizard, error) {
+	api.mu.Lock()
+	if api.eventBus == nil {
+		api.mu.Unlock()
+		return nil, fmt.Errorf("API not initialized")
+	}
+	wizard, err := calibration.NewWizard(api.eventBus, api.globalConfig.Track(), cfg)
+	if err != nil {
+		api.mu.Unlock()
+		return nil, err
+	}
+	if api.clock != nil {
+		wizard.SetClock(api.clock)
+	}
+	wizard.OnComplete(func(report calibration.Report) {
+		api.applyCalibration(report)
+		if err := saveCalibrationReport(api.profileStore(), report); err != nil {
+			api.log("").Warn("⚠️ saving calibration report failed", "error", err)
+		}
+	})
+	previous := api.calibration
+	api.calibration = wizard
+	api.mu.Unlock()
+
+	if previous != nil {
+		previous.Stop()
+	}
+	wizard.Start()
+	return wizard, nil
+}
+
+// CalibrationSignal passes a raw controller channel transition to the
+// calibration wizard, with the time the sensor saw it (zero if the
+// controller cannot timestamp)
+func (api *LibDragAPI) CalibrationSignal(channel int, broken bool, at time.Time) error {
+	api.mu.RLock()
+	wizard := api.calibration
+	api.mu.RUnlock()
+
+	if wizard == nil {
+		return fmt.Errorf("calibration not started")
+	}
+	return wizard.Signal(channel, broken, at)
+}
+
+// GetCalibrationReport returns the last completed calibration report
+func (api *LibDragAPI) GetCalibrationReport() (calibration.Report, error) {
+	api.mu.RLock()
+	wizard := api.calibration
+	api.mu.RUnlock()
+
+	if wizard != nil {
+		if report, ok := wizard.Report(); ok {
+			return report, nil
+		}
+	}
+	report, ok, err := loadCalibrationReport(api.profileStore())
+	if err != nil {
+		return calibration.Report{}, err
+	}
+	if !ok {
+		return calibration.Report{}, fmt.Errorf("no calibration report")
+	}
+	return report, nil
+}
+
+// ApplySavedCalibration writes the offsets of the last saved calibration
+// report into the hardware map races use, typically at startup
+func (api *LibDragAPI) ApplySavedCalibration() error {
+	report, ok, err := loadCalibrationReport(api.profileStore())
+	if err != nil || !ok {
+		return err
+	}
+	api.applyCalibration(report)
+	return nil
+}
+
+// applyCalibration writes a report's offsets into the configured hardware
+// map. Channels rewired since the report keep their new wiring.
+func (api *LibDragAPI) applyCalibration(report calibration.Report) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+
+	current := api.globalConfig.Track().Hardware
+	hardware := current
+	hardware.Channels = make(map[int]config.HardwareChannel, len(current.Channels))
+	for channel, wiring := range current.Channels {
+		if calibrated, ok := report.Hardware.Channels[channel]; ok && calibrated.Kind == wiring.Kind && calibrated.Lane == wiring.Lane && calibrated.ID == wiring.ID {
+			wiring.Offset = calibrated.Offset
+		}
+		hardware.Channels[channel] = wiring
+	}
+	api.globalConfig = hardwareConfig{Config: api.globalConfig, hardware: hardware}
+}
+
+func loadCalibrationReport(store storage.ProfileStore) (calibration.Report, bool, error) {
+	stored, err := store.GetProfile(context.Background(), calibrationKind, calibrationName)
+	if errors.Is(err, storage.ErrNotFound) {
+		return calibration.Report{}, false, nil
+	}
+	if err != nil {
+		return calibration.Report{}, false, err
+	}
+	var report calibration.Report
+	if err := json.Unmarshal(stored.Data, &report); err != nil {
+		return calibration.Report{}, false, fmt.Errorf("stored calibration report: %w", err)
+	}
+	return report, true, nil
+}
+
+func saveCalibrationReport(store storage.ProfileStore, report calibration.Report) error {
+	data, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	return store.PutProfile(context.Background(), storage.Profile{
+		Kind:      calibrationKind,
+		Name:      calibrationName,
+		UpdatedAt: timers.Now(),
+		Data:      data,
+	})
+}
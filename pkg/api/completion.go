@@ -0,0 +1,92 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/benharold/libdrag/pkg/events"
+	"github.com/benharold/libdrag/pkg/orchestrator"
+)
+
+// Errors for races that end without completing
+var (
+	ErrRaceAborted = errors.New("race aborted")
+	ErrRaceRemoved = errors.New("race removed before it completed")
+)
+
+// WaitForCompletion blocks until a race completes, returning nil. It returns
+// ErrRaceAborted if the race is aborted, ErrRaceRemoved if it is removed
+// first (CompleteRace, Stop), or the context's error once it is done.
+func (api *LibDragAPI) WaitForCompletion(ctx context.Context, raceID string) error {
+	result := make(chan error, 1)
+	cancel, err := api.OnRaceDone(raceID, func(err error) { result <- err })
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// OnRaceDone calls done once, on its own goroutine, when a race completes
+// (nil), is aborted (ErrRaceAborted) or is removed first (ErrRaceRemoved).
+// It is WaitForCompletion for callers that cannot block, such as language
+// bindings. The returned function stops waiting without calling done.
+func (api *LibDragAPI) OnRaceDone(raceID string, done func(err error)) (func(), error) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+
+	raceOrchestrator, exists := api.orchestrators[raceID]
+	if !exists || api.eventBus == nil {
+		return nil, fmt.Errorf("race %s not found", raceID)
+	}
+
+	// Subscribed before the state is checked, so a race ending in between is
+	// seen by one or the other. ready holds finishing back until unsubscribe
+	// and forget are set.
+	var once sync.Once
+	var unsubscribe, forget func()
+	ready := make(chan struct{})
+	finish := func(err error, call bool) {
+		once.Do(func() {
+			go func() {
+				<-ready
+				unsubscribe()
+				forget()
+				if call {
+					done(err)
+				}
+			}()
+		})
+	}
+	unsubscribe = api.eventBus.SubscribeAll(func(e events.Event) {
+		if e.RaceID != raceID {
+			return
+		}
+		switch e.Type {
+		case events.EventRaceComplete:
+			finish(nil, true)
+		case events.EventRaceAbort:
+			finish(fmt.Errorf("%w: %v", ErrRaceAborted, e.Data["reason"]), true)
+		}
+	})
+	forget = api.onRaceRemoved(raceID, func() {
+		finish(ErrRaceRemoved, true)
+	})
+	close(ready)
+
+	switch raceOrchestrator.GetRaceStatus().State {
+	case orchestrator.RaceStateComplete:
+		finish(nil, true)
+	case orchestrator.RaceStateAborted, orchestrator.RaceStateError:
+		finish(ErrRaceAborted, true)
+	}
+	return func() { finish(nil, false) }, nil
+}
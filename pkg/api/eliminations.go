@@ -0,0 +1,64 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/benharold/libdrag/pkg/eliminations"
+)
+
+// StartEliminations builds a bracket from a field listed in qualifying
+// order and advances winners as its races complete. Races join the bracket
+// by starting with RaceOptions.BracketPair. Starting a bracket replaces any
+// previous one.
+func (api *LibDragAPI) StartEliminations(class string, ladder eliminations.Ladder, field []eliminations.Entry) (*eliminations.Bracket, error) {
+	api.mu.Lock()
+	if api.eventBus == nil {
+		api.mu.Unlock()
+		return nil, fmt.Errorf("API not initialized")
+	}
+	bracket, err := eliminations.NewBracket(api.eventBus, class, ladder, field)
+	if err != nil {
+		api.mu.Unlock()
+		return nil, err
+	}
+	previous := api.bracket
+	api.bracket = bracket
+	api.mu.Unlock()
+
+	if previous != nil {
+		previous.Stop()
+	}
+	bracket.Start()
+	return bracket, nil
+}
+
+// GetBracket returns the running bracket, if any
+func (api *LibDragAPI) GetBracket() (*eliminations.Bracket, bool) {
+	api.mu.RLock()
+	defer api.mu.RUnlock()
+	return api.bracket, api.bracket != nil
+}
+
+// GetBracketJSON returns the running bracket's rounds, pairs and champion
+// as JSON
+func (api *LibDragAPI) GetBracketJSON() string {
+	bracket, ok := api.GetBracket()
+	if !ok {
+		return "{\"error\":\"no bracket running\"}"
+	}
+	jsonData, _ := json.Marshal(bracket.State())
+	return string(jsonData)
+}
+
+// assignBracketPair makes a race decide its bracket pair. Must be called
+// with api.mu held.
+func (api *LibDragAPI) assignBracketPair(raceID string, opts RaceOptions) error {
+	if opts.BracketPair == "" {
+		return nil
+	}
+	if api.bracket == nil {
+		return fmt.Errorf("no bracket running")
+	}
+	return api.bracket.AssignRace(opts.BracketPair, raceID, opts.Drivers)
+}
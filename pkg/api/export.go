@@ -0,0 +1,63 @@
+package api
+
+import (
+	"github.com/benharold/libdrag/pkg/export"
+)
+
+// ExportRaceByID exports a race's runs with each field published under cfg's
+// policy. Use export.PublicConfig() for results published outside the tower.
+func (api *LibDragAPI) ExportRaceByID(raceID string, cfg export.Config) ([]export.Record, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	orch, err := api.getOrchestrator(raceID)
+	if err != nil {
+		return nil, err
+	}
+
+	api.mu.RLock()
+	info := api.raceInfo[raceID]
+	api.mu.RUnlock()
+
+	entrants := make(map[int]export.Entrant)
+	for _, lane := range []int{1, 2} {
+		entrant := export.Entrant{
+			CarNumber: info.carNumbers[lane],
+			Driver:    info.drivers[lane],
+			License:   info.licenses[lane],
+		}
+		if entrant != (export.Entrant{}) {
+			entrants[lane] = entrant
+		}
+	}
+
+	return export.Build(export.Race{
+		RaceID:    raceID,
+		Class:     info.class,
+		SessionID: info.sessionID,
+		External:  info.external,
+		Tags:      info.tags,
+		Entrants:  entrants,
+		Timing:    orch.GetResults(),
+		Decision:  orch.GetDecision(),
+	}, cfg), nil
+}
+
+// ExportRaces exports the runs of every active race matching query, say
+// tags.Filter{Tags: []string{tags.Qualifying}} for the qualifying sheet,
+// oldest race first. The query's offset and limit page through races.
+func (api *LibDragAPI) ExportRaces(query RaceQuery, cfg export.Config) ([]export.Record, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	records := make([]export.Record, 0)
+	for _, summary := range api.QueryRaces(query).Races {
+		raceRecords, err := api.ExportRaceByID(summary.RaceID, cfg)
+		if err != nil {
+			// Cleaned up since the query
+			continue
+		}
+		records = append(records, raceRecords...)
+	}
+	return records, nil
+}
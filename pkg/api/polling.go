@@ -0,0 +1,259 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/benharold/libdrag/pkg/timers"
+	"github.com/benharold/libdrag/pkg/tree"
+)
+
+// Document is one of a race's JSON documents served by the getters
+type Document string
+
+const (
+	DocumentRaceStatus Document = "race_status"
+	DocumentTreeStatus Document = "tree_status"
+	DocumentTreeCanvas Document = "tree_canvas"
+	DocumentResults    Document = "results"
+)
+
+// Streaming APIs suggested to clients polling over quota
+const (
+	StreamEvents = "events" // The race's events (Subscribe, /api/events?race_id=)
+	StreamState  = "state"  // Tree state snapshots and deltas (/api/races/{id}/state)
+)
+
+// Polling quota defaults
+const (
+	DefaultPollWindow  = time.Second
+	DefaultPollMaxRate = 5
+)
+
+// PollingConfig sets how often a client may poll a race document before it
+// is steered to a streaming API
+type PollingConfig struct {
+	Window  time.Duration `json:"window"`   // Polls are counted over this window (default 1s)
+	MaxRate int           `json:"max_rate"` // Polls of a document allowed per window (default 5)
+}
+
+// PollInfo is the metadata of a served document, for a facade to pass on
+// to its client
+type PollInfo struct {
+	Version   uint64 `json:"version"`             // The document's version, bumped each time its state changes
+	Polls     int    `json:"polls"`               // The client's polls of the document in the last window, this one included
+	Cached    bool   `json:"cached"`              // Served without marshaling, the state unchanged
+	Throttled bool   `json:"throttled,omitempty"` // Over quota: served as last marshaled, without reading the state
+	Stream    string `json:"stream,omitempty"`    // Streaming API to use instead, set once over quota
+}
+
+// documentKey identifies a race document
+type documentKey struct {
+	raceID string
+	doc    Document
+}
+
+// pollKey identifies a client's polls of a race document
+type pollKey struct {
+	documentKey
+	client string
+}
+
+// cachedDocument is a document's marshaled form and the version of the
+// race state it was marshaled from
+type cachedDocument struct {
+	data    []byte
+	version uint64
+	source  uint64
+	at      time.Time
+}
+
+// documentCache serves race documents, marshaling a document only when the
+// version of the state behind it moves, and counts each client's polls
+type documentCache struct {
+	mu        sync.Mutex
+	config    PollingConfig
+	documents map[documentKey]*cachedDocument
+	polls     map[pollKey][]time.Time
+	swept     time.Time
+}
+
+func newDocumentCache() *documentCache {
+	return &documentCache{
+		config:    PollingConfig{Window: DefaultPollWindow, MaxRate: DefaultPollMaxRate},
+		documents: make(map[documentKey]*cachedDocument),
+		polls:     make(map[pollKey][]time.Time),
+	}
+}
+
+// poll counts a client's poll of a document. Over quota, the client is
+// pointed to stream, and the document as last marshaled is returned when it
+// was marshaled or checked within the client's share of the window.
+func (c *documentCache) poll(key pollKey, stream string, now time.Time) (PollInfo, []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	window := c.config.Window
+	if now.Sub(c.swept) > window {
+		// Forget clients that stopped polling
+		for k, times := range c.polls {
+			if now.Sub(times[len(times)-1]) > window {
+				delete(c.polls, k)
+			}
+		}
+		c.swept = now
+	}
+
+	times := c.polls[key]
+	kept := times[:0]
+	for _, t := range times {
+		if now.Sub(t) < window {
+			kept = append(kept, t)
+		}
+	}
+	kept = append(kept, now)
+	c.polls[key] = kept
+
+	info := PollInfo{Polls: len(kept)}
+	if len(kept) <= c.config.MaxRate {
+		return info, nil
+	}
+	info.Stream = stream
+	interval := window / time.Duration(c.config.MaxRate)
+	if cached := c.documents[key.documentKey]; cached != nil && now.Sub(cached.at) < interval {
+		info.Version, info.Cached, info.Throttled = cached.version, true, true
+		return info, cached.data
+	}
+	return info, nil
+}
+
+// store returns a document marshaled from the state at version source,
+// marshaling snapshot only when source moved since the document was last
+// marshaled. A document whose bytes changed is given the next version; one
+// that came out the same (the state's version moved without a change in
+// this document) keeps its version.
+func (c *documentCache) store(key documentKey, source uint64, snapshot func() interface{}, now time.Time) ([]byte, uint64, bool, error) {
+	c.mu.Lock()
+	if cached := c.documents[key]; cached != nil && cached.source == source {
+		cached.at = now
+		c.mu.Unlock()
+		return cached.data, cached.version, true, nil
+	}
+	c.mu.Unlock()
+
+	data, err := json.Marshal(snapshot())
+	if err != nil {
+		return nil, 0, false, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cached := c.documents[key]
+	switch {
+	case cached == nil:
+		cached = &cachedDocument{version: 1}
+		c.documents[key] = cached
+	case cached.source > source:
+		// Another poller stored a later state meanwhile
+		return cached.data, cached.version, false, nil
+	case !bytes.Equal(cached.data, data):
+		cached.version++
+	}
+	cached.data, cached.source, cached.at = data, source, now
+	return data, cached.version, false, nil
+}
+
+// forget drops a race's documents
+func (c *documentCache) forget(raceID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key := range c.documents {
+		if key.raceID == raceID {
+			delete(c.documents, key)
+		}
+	}
+}
+
+// SetPollingConfig sets the polling quota. Zero fields keep the defaults.
+func (api *LibDragAPI) SetPollingConfig(cfg PollingConfig) {
+	if cfg.Window <= 0 {
+		cfg.Window = DefaultPollWindow
+	}
+	if cfg.MaxRate <= 0 {
+		cfg.MaxRate = DefaultPollMaxRate
+	}
+	api.documents.mu.Lock()
+	defer api.documents.mu.Unlock()
+	api.documents.config = cfg
+}
+
+// GetDocumentByID returns a race's JSON document polled by a client (a
+// remote address, a session; empty for in-process callers). A document is
+// marshaled only when the version of the race state behind it has moved
+// since it was last served, and given a new version when its bytes change; a client holding the returned version
+// can skip the bytes until it changes. A remote client polling a document
+// more than the quota allows is told which streaming API to use instead,
+// and until it slows down is served the document as last marshaled, at most
+// once per Window/MaxRate. In-process callers are never throttled.
+func (api *LibDragAPI) GetDocumentByID(raceID string, doc Document, client string) ([]byte, PollInfo, error) {
+	orch, err := api.getOrchestrator(raceID)
+	if err != nil {
+		return nil, PollInfo{}, err
+	}
+
+	// The version is taken before the state, so a change made in between
+	// is marshaled again on the next poll
+	var snapshot func() interface{}
+	var source uint64
+	stream := StreamEvents
+	switch doc {
+	case DocumentRaceStatus:
+		source = orch.StatusVersion()
+		snapshot = func() interface{} { return orch.GetRaceStatus() }
+	case DocumentTreeStatus:
+		source = orch.TreeVersion()
+		snapshot = func() interface{} { return orch.GetTreeStatus() }
+		stream = StreamState
+	case DocumentTreeCanvas:
+		source = orch.TreeVersion()
+		snapshot = func() interface{} { return tree.NewCanvas(orch.GetTreeStatus()) }
+		stream = StreamState
+	case DocumentResults:
+		source = orch.ResultsVersion()
+		snapshot = func() interface{} { return orch.GetResults() }
+	default:
+		return nil, PollInfo{}, fmt.Errorf("unknown document %q", doc)
+	}
+
+	api.mu.RLock()
+	now := timers.Or(api.clock).Now()
+	api.mu.RUnlock()
+	key := documentKey{raceID: raceID, doc: doc}
+	var info PollInfo
+	if client != "" {
+		var throttled []byte
+		info, throttled = api.documents.poll(pollKey{documentKey: key, client: client}, stream, now)
+		if throttled != nil {
+			return throttled, info, nil
+		}
+	}
+
+	data, version, hit, err := api.documents.store(key, source, snapshot, now)
+	if err != nil {
+		return nil, PollInfo{}, err
+	}
+	info.Version, info.Cached = version, hit
+	return data, info, nil
+}
+
+// raceDocumentJSON serves a document to the in-process JSON getters
+func (api *LibDragAPI) raceDocumentJSON(raceID string, doc Document) string {
+	data, _, err := api.GetDocumentByID(raceID, doc, "")
+	if err != nil {
+		return "{\"error\":\"race not found\"}"
+	}
+	return string(data)
+}
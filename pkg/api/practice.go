@@ -0,0 +1,46 @@
+package api
+
+import (
+	"fmt"
+
+	"github.com/benharold/libdrag/pkg/practice"
+)
+
+// StartPracticeTree starts a practice tree session for reaction time
+// training, outside any race. Each Run on the session brings the tree down
+// for its lanes; launches come from Launch or from cfg.Simulator. Starting
+// a practice tree replaces any previous session, aborting its run in
+// progress.
+func (api *LibDragAPI) StartPracticeTree(cfg practice.Config) (*practice.Session, error) {
+	api.mu.Lock()
+	if api.eventBus == nil {
+		api.mu.Unlock()
+		return nil, fmt.Errorf("API not initialized")
+	}
+	session, err := practice.NewSession(api.eventBus, api.globalConfig, cfg)
+	if err != nil {
+		api.mu.Unlock()
+		return nil, err
+	}
+	if api.clock != nil {
+		session.SetClock(api.clock)
+	}
+	if logger := api.logger.Load(); logger != nil {
+		session.SetLogger(logger)
+	}
+	previous := api.practice
+	api.practice = session
+	api.mu.Unlock()
+
+	if previous != nil {
+		previous.Stop()
+	}
+	return session, nil
+}
+
+// GetPracticeTree returns the running practice tree session, if any
+func (api *LibDragAPI) GetPracticeTree() (*practice.Session, bool) {
+	api.mu.RLock()
+	defer api.mu.RUnlock()
+	return api.practice, api.practice != nil
+}
@@ -0,0 +1,312 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/benharold/libdrag/pkg/events"
+	"github.com/benharold/libdrag/pkg/stats"
+	"github.com/benharold/libdrag/pkg/storage"
+	"github.com/benharold/libdrag/pkg/timers"
+	"github.com/benharold/libdrag/pkg/timetrial"
+	"github.com/google/uuid"
+)
+
+// ErasureMode is how a driver's data is erased
+type ErasureMode string
+
+const (
+	// ErasureAnonymize keeps the driver's runs, records and bracket history
+	// under a random pseudonym, and drops their license numbers
+	ErasureAnonymize ErasureMode = "anonymize"
+	// ErasureDelete removes the driver's runs, records and race journals
+	// outright. Opponents keep their side of a race, and brackets keep the
+	// driver's seats under a pseudonym so the ladder still reads through.
+	ErasureDelete ErasureMode = "delete"
+)
+
+// DriverErasure is a request to erase a driver's personal data
+type DriverErasure struct {
+	Registration string
+	Mode         ErasureMode
+	Storage      RaceStorageConfig // Where races were saved; both store and archive are optional
+
+	// Analytics started by the application that may hold the driver's runs
+	Leaderboards []*stats.Leaderboard
+	DelayBoxes   []*stats.DelayBoxAnalyzer
+}
+
+// ErasureReport counts what an erasure changed. It never carries the
+// erased registration.
+type ErasureReport struct {
+	Mode          ErasureMode `json:"mode"`
+	Pseudonym     string      `json:"pseudonym"`
+	ActiveRaces   int         `json:"active_races"`
+	StoredRaces   int         `json:"stored_races"` // Stored races and time trial runs changed or deleted
+	Journals      int         `json:"journals"`
+	Records       int         `json:"records"`
+	TimeTrialRuns int         `json:"time_trial_runs"`
+	Analytics     int         `json:"analytics"` // Leaderboards and analyzers that knew the driver
+	Bracket       bool        `json:"bracket"`
+}
+
+// ForgetDriver erases a driver's personal data for a privacy request:
+// from the races still held by the API, the stored races and their
+// journals, the track records, the running time trial session, the
+// eliminations bracket and the analytics passed in. privacy.driver_erased
+// is published with the report when done. The erasure carries on past
+// storage errors, which are returned together, so it can simply be run
+// again.
+func (api *LibDragAPI) ForgetDriver(erasure DriverErasure) (ErasureReport, error) {
+	if erasure.Registration == "" {
+		return ErasureReport{}, fmt.Errorf("registration is required")
+	}
+	if erasure.Mode != ErasureAnonymize && erasure.Mode != ErasureDelete {
+		return ErasureReport{}, fmt.Errorf("unknown erasure mode %q", erasure.Mode)
+	}
+	api.mu.RLock()
+	bus, book, bracket, timeTrials := api.eventBus, api.records, api.bracket, api.timeTrials
+	api.mu.RUnlock()
+	if bus == nil {
+		return ErasureReport{}, fmt.Errorf("API not initialized")
+	}
+
+	registration := erasure.Registration
+	pseudonym := "anon-" + strings.ReplaceAll(uuid.New().String(), "-", "")[:12]
+	report := ErasureReport{Mode: erasure.Mode, Pseudonym: pseudonym}
+	// Deleting drops the driver from modules that can lose them
+	replacement := pseudonym
+	if erasure.Mode == ErasureDelete {
+		replacement = ""
+	}
+
+	report.ActiveRaces = api.forgetActiveRaces(registration, replacement)
+	var errs []error
+	if erasure.Storage.Store != nil {
+		stored, journals, err := forgetStoredRaces(erasure.Storage, registration, replacement)
+		report.StoredRaces, report.Journals = stored, journals
+		errs = append(errs, err)
+	}
+	if book != nil {
+		if report.Records = book.Forget(registration, replacement); report.Records > 0 {
+			errs = append(errs, saveTrackRecords(api.profileStore(), book.History()))
+		}
+	}
+	if timeTrials != nil {
+		report.TimeTrialRuns = timeTrials.Forget(registration, replacement)
+	}
+	if bracket != nil {
+		report.Bracket, _ = bracket.Forget(registration, pseudonym)
+	}
+	for _, leaderboard := range erasure.Leaderboards {
+		if leaderboard.Forget(registration, replacement) {
+			report.Analytics++
+		}
+	}
+	for _, analyzer := range erasure.DelayBoxes {
+		if analyzer.Forget(registration, replacement) {
+			report.Analytics++
+		}
+	}
+
+	bus.Publish(events.NewEvent(events.EventDriverErased).WithData("report", report).Build())
+	return report, errors.Join(errs...)
+}
+
+// forgetActiveRaces erases a driver from the races the API still holds,
+// returning how many races they were in
+func (api *LibDragAPI) forgetActiveRaces(registration, replacement string) int {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+
+	changed := 0
+	for raceID, info := range api.raceInfo {
+		var lanes []int
+		for lane, driver := range info.drivers {
+			if driver == registration {
+				lanes = append(lanes, lane)
+			}
+		}
+		if len(lanes) == 0 {
+			continue
+		}
+		// Replace the maps rather than edit them, as readers use them
+		// outside the lock
+		info.drivers = copyDrivers(info.drivers)
+		info.licenses = copyDrivers(info.licenses)
+		info.carNumbers = copyDrivers(info.carNumbers)
+		for _, lane := range lanes {
+			delete(info.licenses, lane)
+			if replacement == "" {
+				delete(info.drivers, lane)
+				delete(info.carNumbers, lane)
+			} else {
+				info.drivers[lane] = replacement
+			}
+		}
+		api.raceInfo[raceID] = info
+		changed++
+	}
+	return changed
+}
+
+// erasurePageSize is how many stored races are read at a time
+const erasurePageSize = 500
+
+// storedEntrants is the part of a stored race or time trial run that
+// identifies its drivers
+type storedEntrants struct {
+	Drivers      map[int]string `json:"drivers"`
+	Registration string         `json:"registration"`
+}
+
+// forgetStoredRaces erases a driver from the stored races and time trial
+// runs on cfg's track, and from the journals of those races. It returns
+// how many records and journals changed.
+func forgetStoredRaces(cfg RaceStorageConfig, registration, replacement string) (int, int, error) {
+	ctx := context.Background()
+	var matched []storage.Record
+	for offset := 0; ; offset += erasurePageSize {
+		page, err := cfg.Store.ListRaces(ctx, storage.Filter{Track: cfg.Track, Offset: offset, Limit: erasurePageSize})
+		if err != nil {
+			return 0, 0, err
+		}
+		for _, record := range page {
+			var entrants storedEntrants
+			if json.Unmarshal(record.Data, &entrants) != nil {
+				continue
+			}
+			if entrants.Registration == registration || containsDriver(entrants.Drivers, registration) {
+				matched = append(matched, record)
+			}
+		}
+		if len(page) < erasurePageSize {
+			break
+		}
+	}
+
+	var errs []error
+	records, journals := 0, 0
+	for _, record := range matched {
+		changed, err := forgetStoredRace(ctx, cfg.Store, record, registration, replacement)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("race %s: %w", record.RaceID, err))
+			continue
+		}
+		records++
+		if !changed || cfg.Archive == nil {
+			continue
+		}
+		if ok, err := forgetJournal(ctx, cfg.Archive, record.RaceID, registration, replacement); err != nil {
+			errs = append(errs, fmt.Errorf("journal %s: %w", record.RaceID, err))
+		} else if ok {
+			journals++
+		}
+	}
+	return records, journals, errors.Join(errs...)
+}
+
+// forgetStoredRace rewrites or deletes one stored record, reporting
+// whether it was a race with a journal
+func forgetStoredRace(ctx context.Context, store storage.Store, record storage.Record, registration, replacement string) (bool, error) {
+	var run timetrial.Run
+	if err := json.Unmarshal(record.Data, &run); err == nil && run.Registration == registration {
+		if replacement == "" {
+			return false, store.DeleteRace(ctx, record.RaceID)
+		}
+		run.Registration = replacement
+		data, err := json.Marshal(run)
+		if err != nil {
+			return false, err
+		}
+		record.Data = data
+		return false, store.PutRace(ctx, record)
+	}
+
+	var race storedRace
+	if err := json.Unmarshal(record.Data, &race); err != nil {
+		return false, err
+	}
+	for lane, driver := range race.Drivers {
+		if driver != registration {
+			continue
+		}
+		if replacement != "" {
+			race.Drivers[lane] = replacement
+			continue
+		}
+		// The driver's run goes with them; the opponent keeps theirs
+		delete(race.Drivers, lane)
+		delete(race.Results, lane)
+		delete(race.DialIns, lane)
+		delete(race.StagingMotion, lane)
+	}
+	data, err := json.Marshal(race)
+	if err != nil {
+		return false, err
+	}
+	record.Data = data
+	return true, store.PutRace(ctx, record)
+}
+
+// forgetJournal erases a driver from a race's archived journal: deleted
+// outright with the driver's run, or with every mention of the
+// registration replaced. It reports whether there was a journal.
+func forgetJournal(ctx context.Context, archive storage.Archive, raceID, registration, replacement string) (bool, error) {
+	key := "journals/" + raceID + ".json"
+	if replacement == "" {
+		err := archive.DeleteObject(ctx, key)
+		if errors.Is(err, storage.ErrNotFound) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+
+	data, err := archive.GetObject(ctx, key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	// Registrations appear in the journal as JSON strings
+	quoted, _ := json.Marshal(registration)
+	pseudonym, _ := json.Marshal(replacement)
+	return true, archive.PutObject(ctx, key, bytes.ReplaceAll(data, quoted, pseudonym))
+}
+
+// containsDriver reports whether a race's drivers include registration
+func containsDriver(drivers map[int]string, registration string) bool {
+	for _, driver := range drivers {
+		if driver == registration {
+			return true
+		}
+	}
+	return false
+}
+
+// PruneRaceStorage deletes the races on cfg's track that are past cfg's
+// retention period, with their archived journals, and returns how many
+// were deleted. Run it on a schedule to keep stored history within the
+// track's data retention policy.
+func (api *LibDragAPI) PruneRaceStorage(cfg RaceStorageConfig) (int, error) {
+	if cfg.Store == nil {
+		return 0, fmt.Errorf("store is required")
+	}
+	ctx := context.Background()
+	pruned, err := storage.Prune(ctx, cfg.Store, storage.Filter{Track: cfg.Track}, cfg.Retention, timers.Now())
+	if err != nil || cfg.Archive == nil {
+		return len(pruned), err
+	}
+	for _, raceID := range pruned {
+		err := cfg.Archive.DeleteObject(ctx, "journals/"+raceID+".json")
+		if err != nil && !errors.Is(err, storage.ErrNotFound) {
+			return len(pruned), err
+		}
+	}
+	return len(pruned), nil
+}
@@ -0,0 +1,165 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/benharold/libdrag/pkg/autostart"
+	"github.com/benharold/libdrag/pkg/storage"
+	"github.com/benharold/libdrag/pkg/timers"
+)
+
+// autoStartProfileKind is the storage.Profile kind autostart profiles are
+// kept under
+const autoStartProfileKind = "autostart"
+
+// SetProfileStore keeps autostart profiles and track records in store,
+// e.g. the race Store (every storage.Store backend is also a
+// ProfileStore). Profiles are kept in memory until one is set.
+func (api *LibDragAPI) SetProfileStore(store storage.ProfileStore) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	api.profiles = store
+}
+
+// PutAutoStartProfile creates or replaces an autostart profile. A class can
+// only default to one profile.
+func (api *LibDragAPI) PutAutoStartProfile(profile autostart.Profile) error {
+	if err := profile.Validate(); err != nil {
+		return err
+	}
+	existing, err := api.ListAutoStartProfiles()
+	if err != nil {
+		return err
+	}
+	for _, other := range existing {
+		if other.Name == profile.Name {
+			continue
+		}
+		for _, class := range other.Classes {
+			for _, claimed := range profile.Classes {
+				if class == claimed {
+					return fmt.Errorf("class %s already uses profile %s", class, other.Name)
+				}
+			}
+		}
+	}
+
+	data, err := json.Marshal(profile)
+	if err != nil {
+		return err
+	}
+	return api.profileStore().PutProfile(context.Background(), storage.Profile{
+		Kind:      autoStartProfileKind,
+		Name:      profile.Name,
+		UpdatedAt: timers.Now(),
+		Data:      data,
+	})
+}
+
+// GetAutoStartProfile returns a named autostart profile
+func (api *LibDragAPI) GetAutoStartProfile(name string) (autostart.Profile, error) {
+	return getAutoStartProfile(api.profileStore(), name)
+}
+
+// ListAutoStartProfiles returns every autostart profile by name
+func (api *LibDragAPI) ListAutoStartProfiles() ([]autostart.Profile, error) {
+	return listAutoStartProfiles(api.profileStore())
+}
+
+// DeleteAutoStartProfile removes an autostart profile. Races already
+// started keep the configuration they were given.
+func (api *LibDragAPI) DeleteAutoStartProfile(name string) error {
+	err := api.profileStore().DeleteProfile(context.Background(), autoStartProfileKind, name)
+	if errors.Is(err, storage.ErrNotFound) {
+		return fmt.Errorf("autostart profile %s not found", name)
+	}
+	return err
+}
+
+// AutoStartConfigFor resolves the autostart configuration for a race: the
+// named profile when one is given, otherwise the profile for the class, or
+// the class's built-in preset when no profile claims it
+func (api *LibDragAPI) AutoStartConfigFor(class string, profileName string) (autostart.AutoStartConfig, error) {
+	return resolveAutoStartConfig(api.profileStore(), class, profileName)
+}
+
+// GetAutoStartConfigByID returns the autostart configuration a race was
+// started with, for the auto-start system driving its tree
+func (api *LibDragAPI) GetAutoStartConfigByID(raceID string) (autostart.AutoStartConfig, error) {
+	api.mu.RLock()
+	defer api.mu.RUnlock()
+
+	info, exists := api.raceInfo[raceID]
+	if !exists {
+		return autostart.AutoStartConfig{}, fmt.Errorf("race %s not found", raceID)
+	}
+	return info.autoStart, nil
+}
+
+// profileStore returns the store profiles are kept in
+func (api *LibDragAPI) profileStore() storage.ProfileStore {
+	api.mu.RLock()
+	defer api.mu.RUnlock()
+	return api.profiles
+}
+
+func getAutoStartProfile(store storage.ProfileStore, name string) (autostart.Profile, error) {
+	stored, err := store.GetProfile(context.Background(), autoStartProfileKind, name)
+	if errors.Is(err, storage.ErrNotFound) {
+		return autostart.Profile{}, fmt.Errorf("autostart profile %s not found", name)
+	}
+	if err != nil {
+		return autostart.Profile{}, err
+	}
+	return decodeAutoStartProfile(stored)
+}
+
+func listAutoStartProfiles(store storage.ProfileStore) ([]autostart.Profile, error) {
+	stored, err := store.ListProfiles(context.Background(), autoStartProfileKind)
+	if err != nil {
+		return nil, err
+	}
+	profiles := make([]autostart.Profile, 0, len(stored))
+	for _, s := range stored {
+		profile, err := decodeAutoStartProfile(s)
+		if err != nil {
+			return nil, err
+		}
+		profiles = append(profiles, profile)
+	}
+	return profiles, nil
+}
+
+func resolveAutoStartConfig(store storage.ProfileStore, class string, profileName string) (autostart.AutoStartConfig, error) {
+	if profileName != "" {
+		profile, err := getAutoStartProfile(store, profileName)
+		if err != nil {
+			return autostart.AutoStartConfig{}, err
+		}
+		return profile.Config, nil
+	}
+
+	profiles, err := listAutoStartProfiles(store)
+	if err != nil {
+		return autostart.AutoStartConfig{}, err
+	}
+	for _, profile := range profiles {
+		for _, c := range profile.Classes {
+			if c == class {
+				return profile.Config, nil
+			}
+		}
+	}
+	return autostart.ClassPreset(class), nil
+}
+
+func decodeAutoStartProfile(stored storage.Profile) (autostart.Profile, error) {
+	var profile autostart.Profile
+	if err := json.Unmarshal(stored.Data, &profile); err != nil {
+		return autostart.Profile{}, fmt.Errorf("autostart profile %s: %v", stored.Name, err)
+	}
+	return profile, nil
+}
@@ -0,0 +1,262 @@
+package api
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/benharold/libdrag/pkg/autostart"
+	"github.com/benharold/libdrag/pkg/config"
+	"github.com/benharold/libdrag/pkg/orchestrator"
+	"github.com/benharold/libdrag/pkg/simulation"
+	"github.com/benharold/libdrag/pkg/tags"
+)
+
+// DefaultQueryLimit is the page size used when a RaceQuery does not set one
+const DefaultQueryLimit = 50
+
+// RaceOptions holds optional settings for starting a race
+type RaceOptions struct {
+	Class      string         `json:"class,omitempty"`       // Racing class, defaults to the global config class
+	SessionID  string         `json:"session_id,omitempty"`  // Session (eliminations round, time trials, etc.)
+	Drivers    map[int]string `json:"drivers,omitempty"`     // Lane -> driver registration, for run summaries
+	Licenses   map[int]string `json:"licenses,omitempty"`    // Lane -> driver license category, for trap speed limits
+	CarNumbers map[int]string `json:"car_numbers,omitempty"` // Lane -> car number, for exported results
+	Starter    string         `json:"starter,omitempty"`     // Starter working the tree, for starter audits
+
+	// Tree overrides the global tree profile for this race only (e.g. an
+	// exhibition pair on a Pro .4 tree). Unset fields keep the global values.
+	Tree *config.TreeSequenceConfig `json:"tree,omitempty"`
+
+	// Override bypasses the track-clear interlock for this race
+	Override *SafetyOverride `json:"interlock_override,omitempty"`
+
+	// AutoStartProfile selects a named autostart profile for this race
+	// instead of the class's profile or preset
+	AutoStartProfile string `json:"autostart_profile,omitempty"`
+
+	// BracketPair is the pair of the running eliminations bracket this race
+	// decides (e.g. "R1P3"); Drivers must seat the pair's two entrants
+	BracketPair string `json:"bracket_pair,omitempty"`
+
+	// ExternalIDs are other systems' correlation IDs for the race by name
+	// (e.g. "ems_run": "R-1042", "ticket": "T88"). They are carried on
+	// every event of the race and on its summaries, stored record and
+	// exports.
+	ExternalIDs map[string]string `json:"external_ids,omitempty"`
+
+	// Tags label the run (e.g. tags.Qualifying, tags.TestPass) for
+	// filtering history, exports and analytics. TagRaceByID changes them
+	// afterward.
+	Tags []string `json:"tags,omitempty"`
+
+	// Simulator plays the race's vehicles instead of the reference passes
+	// (simulation.Reference), for demos and practice with varied runs
+	Simulator simulation.Simulator `json:"-"`
+
+	// Matchup plays the race's vehicles from simulation presets by name,
+	// lane 1 first (e.g. "top-fuel", "funny-car"), when no Simulator is set
+	Matchup []string `json:"matchup,omitempty"`
+
+	// PreStaging runs the burnout, backup and approach before staging, for
+	// at most the given durations each; AdvancePhaseByID ends one early
+	PreStaging *orchestrator.PreStagingConfig `json:"pre_staging,omitempty"`
+
+	// LiveBeams runs the race from real beam input instead of a simulator:
+	// staging through SetStagingBeamByID and the run through TriggerBeamByID
+	LiveBeams bool `json:"live_beams,omitempty"`
+
+	// RequestID makes the start idempotent: a retried call with the same
+	// request ID (say, over a flaky mobile connection) returns the race the
+	// first call started instead of starting another. Request IDs are
+	// remembered for RequestIDTTL.
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// RequestIDTTL is how long a RaceOptions.RequestID is remembered
+const RequestIDTTL = 10 * time.Minute
+
+// startedRequest is the race a request ID started
+type startedRequest struct {
+	raceID string
+	at     time.Time
+}
+
+// RaceQuery filters and paginates the active race list
+type RaceQuery struct {
+	States    []orchestrator.RaceState `json:"states,omitempty"`     // Match any of these states (empty = all)
+	Class     string                   `json:"class,omitempty"`      // Match racing class (empty = all)
+	SessionID string                   `json:"session_id,omitempty"` // Match session (empty = all)
+	External  map[string]string        `json:"external,omitempty"`   // Match every given external ID
+	Tags      tags.Filter              `json:"tag_filter"`           // Match tags (zero = all)
+	Offset    int                      `json:"offset"`
+	Limit     int                      `json:"limit"` // Zero uses DefaultQueryLimit
+}
+
+// RaceSummary describes a single race in a query result
+type RaceSummary struct {
+	RaceID    string                  `json:"race_id"`
+	ShortID   string                  `json:"short_id"`
+	Class     string                  `json:"class"`
+	SessionID string                  `json:"session_id,omitempty"`
+	Starter   string                  `json:"starter,omitempty"`
+	External  map[string]string       `json:"external,omitempty"`
+	Tags      []string                `json:"tags,omitempty"`
+	CreatedAt time.Time               `json:"created_at"`
+	Status    orchestrator.RaceStatus `json:"status"`
+}
+
+// RacePage is one page of races matching a RaceQuery
+type RacePage struct {
+	Races  []RaceSummary `json:"races"`
+	Total  int           `json:"total"` // Matching races before pagination
+	Offset int           `json:"offset"`
+	Limit  int           `json:"limit"`
+}
+
+// raceInfo holds per-race metadata used for querying
+type raceInfo struct {
+	class      string
+	sessionID  string
+	starter    string
+	drivers    map[int]string
+	licenses   map[int]string
+	carNumbers map[int]string
+	external   map[string]string
+	tags       []string
+	autoStart  autostart.AutoStartConfig
+	createdAt  time.Time
+}
+
+// classConfig overrides the racing class of an underlying config
+type classConfig struct {
+	config.Config
+	class string
+}
+
+func (c classConfig) RacingClass() string {
+	return c.class
+}
+
+// treeConfig overrides the tree profile of an underlying config
+type treeConfig struct {
+	config.Config
+	tree config.TreeSequenceConfig
+}
+
+func (c treeConfig) Tree() config.TreeSequenceConfig {
+	return c.tree
+}
+
+// hardwareConfig overrides the hardware map of an underlying config
+type hardwareConfig struct {
+	config.Config
+	hardware config.HardwareMap
+}
+
+func (c hardwareConfig) Track() config.TrackConfig {
+	track := c.Config.Track()
+	track.Hardware = c.hardware
+	return track
+}
+
+// QueryRaces returns active races matching the query, oldest first
+func (api *LibDragAPI) QueryRaces(query RaceQuery) RacePage {
+	api.mu.RLock()
+	defer api.mu.RUnlock()
+
+	limit := query.Limit
+	if limit <= 0 {
+		limit = DefaultQueryLimit
+	}
+	offset := query.Offset
+	if offset < 0 {
+		offset = 0
+	}
+
+	matches := make([]RaceSummary, 0, len(api.orchestrators))
+	for raceID, orch := range api.orchestrators {
+		info := api.raceInfo[raceID]
+		if query.Class != "" && info.class != query.Class {
+			continue
+		}
+		if query.SessionID != "" && info.sessionID != query.SessionID {
+			continue
+		}
+		if !matchesExternal(info.external, query.External) {
+			continue
+		}
+		if !query.Tags.Matches(info.tags) {
+			continue
+		}
+
+		status := orch.GetRaceStatus()
+		if !matchesState(status.State, query.States) {
+			continue
+		}
+
+		matches = append(matches, RaceSummary{
+			RaceID:    raceID,
+			ShortID:   api.GetShortRaceID(raceID),
+			Class:     info.class,
+			SessionID: info.sessionID,
+			Starter:   info.starter,
+			External:  info.external,
+			Tags:      info.tags,
+			CreatedAt: info.createdAt,
+			Status:    status,
+		})
+	}
+
+	// Sort for stable pagination across calls
+	sort.Slice(matches, func(i, j int) bool {
+		if !matches[i].CreatedAt.Equal(matches[j].CreatedAt) {
+			return matches[i].CreatedAt.Before(matches[j].CreatedAt)
+		}
+		return matches[i].RaceID < matches[j].RaceID
+	})
+
+	page := RacePage{
+		Races:  []RaceSummary{},
+		Total:  len(matches),
+		Offset: offset,
+		Limit:  limit,
+	}
+	if offset < len(matches) {
+		end := offset + limit
+		if end > len(matches) {
+			end = len(matches)
+		}
+		page.Races = matches[offset:end]
+	}
+	return page
+}
+
+// QueryRacesJSON returns QueryRaces results as JSON
+func (api *LibDragAPI) QueryRacesJSON(query RaceQuery) string {
+	jsonData, _ := json.Marshal(api.QueryRaces(query))
+	return string(jsonData)
+}
+
+// matchesExternal reports whether a race has every wanted external ID
+func matchesExternal(external, wanted map[string]string) bool {
+	for name, id := range wanted {
+		if external[name] != id {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesState reports whether state is in states (an empty list matches all)
+func matchesState(state orchestrator.RaceState, states []orchestrator.RaceState) bool {
+	if len(states) == 0 {
+		return true
+	}
+	for _, s := range states {
+		if s == state {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,119 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/benharold/libdrag/pkg/events"
+	"github.com/benharold/libdrag/pkg/records"
+	"github.com/benharold/libdrag/pkg/storage"
+	"github.com/benharold/libdrag/pkg/timers"
+)
+
+// Track records are kept as a single storage.Profile in the profile store
+const (
+	trackRecordsKind = "track_records"
+	trackRecordsName = "history"
+)
+
+// StartTrackRecords loads the track records from the profile store and
+// follows races for new ones, publishing records.update for the records
+// board and saving the book after every change. Runs count for their race's
+// class and registered driver. Starting the records replaces any previous
+// book.
+func (api *LibDragAPI) StartTrackRecords() (*records.Book, error) {
+	store := api.profileStore()
+	history, err := loadTrackRecords(store)
+	if err != nil {
+		return nil, err
+	}
+
+	api.mu.Lock()
+	if api.eventBus == nil {
+		api.mu.Unlock()
+		return nil, fmt.Errorf("API not initialized")
+	}
+	book := records.NewBook(api.eventBus, func(raceID string, lane int) (string, string) {
+		api.mu.RLock()
+		defer api.mu.RUnlock()
+		info := api.raceInfo[raceID]
+		return info.class, info.drivers[lane]
+	}, history)
+	unsubscribe := api.eventBus.Subscribe(events.EventRecordsUpdate, func(events.Event) {
+		if err := saveTrackRecords(store, book.History()); err != nil {
+			api.log("").Warn("⚠️ saving track records failed", "error", err)
+		}
+	})
+	previous, stopPrevious := api.records, api.stopRecords
+	api.records = book
+	api.stopRecords = func() {
+		book.Stop()
+		unsubscribe()
+	}
+	api.mu.Unlock()
+
+	if previous != nil {
+		stopPrevious()
+	}
+	book.Start()
+	return book, nil
+}
+
+// GetTrackRecords returns the current track records, by class
+func (api *LibDragAPI) GetTrackRecords() ([]records.Record, error) {
+	api.mu.RLock()
+	book := api.records
+	api.mu.RUnlock()
+
+	if book == nil {
+		return nil, fmt.Errorf("track records not started")
+	}
+	return book.Records(), nil
+}
+
+// RollbackTrackRecords removes the records set by a race that was later
+// disqualified, restoring the records it broke
+func (api *LibDragAPI) RollbackTrackRecords(raceID string) error {
+	api.mu.RLock()
+	book := api.records
+	api.mu.RUnlock()
+
+	if book == nil {
+		return fmt.Errorf("track records not started")
+	}
+	if err := book.Rollback(raceID); err != nil {
+		return err
+	}
+	// Save now, as rolling back a record already broken changes no board
+	return saveTrackRecords(api.profileStore(), book.History())
+}
+
+func loadTrackRecords(store storage.ProfileStore) ([]records.Record, error) {
+	stored, err := store.GetProfile(context.Background(), trackRecordsKind, trackRecordsName)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var history []records.Record
+	if err := json.Unmarshal(stored.Data, &history); err != nil {
+		return nil, fmt.Errorf("stored track records: %w", err)
+	}
+	return history, nil
+}
+
+func saveTrackRecords(store storage.ProfileStore, history []records.Record) error {
+	data, err := json.Marshal(history)
+	if err != nil {
+		return err
+	}
+	return store.PutProfile(context.Background(), storage.Profile{
+		Kind:      trackRecordsKind,
+		Name:      trackRecordsName,
+		UpdatedAt: timers.Now(),
+		Data:      data,
+	})
+}
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/benharold/libdrag/pkg/eliminations"
+	"github.com/benharold/libdrag/pkg/export"
+	"github.com/benharold/libdrag/pkg/report"
+	"github.com/benharold/libdrag/pkg/tags"
+)
+
+// EventReport builds the end-of-event report from the active races: the
+// qualifying sheets from races tagged tags.Qualifying, the running
+// bracket round by round with its standings paid from purses (by class;
+// nil pays nothing), the track records set and the audit log since the
+// first race. Render it with report.Render.
+func (api *LibDragAPI) EventReport(event string, purses map[string]report.Purse) (report.Report, error) {
+	api.mu.RLock()
+	initialized := api.eventBus != nil
+	api.mu.RUnlock()
+	if !initialized {
+		return report.Report{}, fmt.Errorf("API not initialized")
+	}
+
+	// Drivers are kept, as the report is the tower's own
+	cfg := export.Config{}
+	in := report.Input{Event: event, Purses: purses}
+
+	query := RaceQuery{Tags: tags.Filter{Tags: []string{tags.Qualifying}}}
+	for {
+		page := api.QueryRaces(query)
+		for _, summary := range page.Races {
+			runs, err := api.ExportRaceByID(summary.RaceID, cfg)
+			if err != nil {
+				continue // Cleaned up since the query
+			}
+			in.Qualifying = append(in.Qualifying, runs...)
+		}
+		query.Offset = page.Offset + page.Limit
+		if query.Offset >= page.Total {
+			break
+		}
+		query.Limit = page.Limit
+	}
+
+	if bracket, ok := api.GetBracket(); ok {
+		state := bracket.State()
+		in.Brackets = []eliminations.State{state}
+		for _, round := range state.Rounds {
+			for _, pair := range round.Pairs {
+				if pair.RaceID == "" {
+					continue
+				}
+				if runs, err := api.ExportRaceByID(pair.RaceID, cfg); err == nil {
+					in.Runs = append(in.Runs, runs...)
+				}
+			}
+		}
+	}
+
+	api.mu.RLock()
+	book := api.records
+	var since time.Time
+	for _, info := range api.raceInfo {
+		if since.IsZero() || info.createdAt.Before(since) {
+			since = info.createdAt
+		}
+	}
+	api.mu.RUnlock()
+
+	if book != nil {
+		in.Records = book.History()
+	}
+	in.Audit = api.GetAuditLog()
+	in.Since = since
+	return report.Build(in), nil
+}
@@ -0,0 +1,161 @@
+package api
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/benharold/libdrag/pkg/audit"
+	"github.com/benharold/libdrag/pkg/downtrack"
+	"github.com/benharold/libdrag/pkg/events"
+	"github.com/benharold/libdrag/pkg/timers"
+)
+
+// Track-clear sources
+const (
+	TrackClearOfficial = "official" // Confirmed by a track official
+	TrackClearSensor   = "sensor"   // Confirmed by downtrack sensors
+)
+
+// maxAuditEntries bounds the audit log kept in memory
+const maxAuditEntries = 10000
+
+// TrackClearStatus reports whether the track is confirmed clear for the next pair
+type TrackClearStatus struct {
+	Clear  bool      `json:"clear"`
+	Source string    `json:"source,omitempty"`
+	SetBy  string    `json:"set_by,omitempty"`
+	SetAt  time.Time `json:"set_at,omitempty"`
+}
+
+// SafetyOverride bypasses the track-clear interlock. Both fields are
+// required and the override is recorded in the audit log.
+type SafetyOverride struct {
+	By     string `json:"by"`
+	Reason string `json:"reason"`
+}
+
+// SetTrackClear confirms the racing surface is clear since the previous run.
+// With Safety().RequireTrackClear, each pair needs a fresh confirmation
+// before its tree can be armed.
+func (api *LibDragAPI) SetTrackClear(source, setBy string) error {
+	if source != TrackClearOfficial && source != TrackClearSensor {
+		return fmt.Errorf("unknown track-clear source %q", source)
+	}
+	if setBy == "" {
+		return fmt.Errorf("track-clear confirmation requires who set it")
+	}
+
+	api.mu.Lock()
+	defer api.mu.Unlock()
+
+	if !api.initialized {
+		return fmt.Errorf("API not initialized")
+	}
+
+	api.trackClear = TrackClearStatus{Clear: true, Source: source, SetBy: setBy, SetAt: timers.Now()}
+	api.audit.Record(audit.Entry{
+		At:     api.trackClear.SetAt,
+		Action: audit.ActionTrackClear,
+		Actor:  setBy,
+		Detail: source,
+	})
+	api.eventBus.Publish(
+		events.NewEvent(events.EventTrackClear).
+			WithData("source", source).
+			WithData("set_by", setBy).
+			Build(),
+	)
+	return nil
+}
+
+// StartTrackClearDetection sets the track-clear flag automatically once
+// every car of a completed race has passed the finish (or shutdown-area)
+// beam, readying the tree for the next pair. Races where a car never gets
+// there still need an official's confirmation. Call the returned function
+// to stop detecting.
+func (api *LibDragAPI) StartTrackClearDetection(cfg downtrack.Config) (func(), error) {
+	api.mu.RLock()
+	defer api.mu.RUnlock()
+
+	if api.eventBus == nil {
+		return nil, fmt.Errorf("API not initialized")
+	}
+
+	detector := downtrack.NewDetector(api.eventBus, cfg, func(raceID string) {
+		if err := api.SetTrackClear(TrackClearSensor, "downtrack"); err != nil {
+			api.log(raceID).Warn("⚠️ downtrack clear failed", "error", err)
+		}
+	})
+	detector.Start()
+	return detector.Stop, nil
+}
+
+// GetTrackClearStatus returns the current track-clear flag
+func (api *LibDragAPI) GetTrackClearStatus() TrackClearStatus {
+	api.mu.RLock()
+	defer api.mu.RUnlock()
+	return api.trackClear
+}
+
+// GetAuditLog returns the audited safety actions, oldest first
+func (api *LibDragAPI) GetAuditLog() []audit.Entry {
+	return api.audit.Entries()
+}
+
+// ArmTreeWithOverrideByID arms a race's tree, bypassing the track-clear
+// interlock when override is given
+func (api *LibDragAPI) ArmTreeWithOverrideByID(raceID string, override *SafetyOverride) error {
+	orch, err := api.getOrchestrator(raceID)
+	if err != nil {
+		return err
+	}
+
+	api.mu.Lock()
+	err = api.checkArmInterlock(raceID, override)
+	api.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return orch.ArmTree()
+}
+
+// checkArmInterlock enforces the track-clear interlock before a tree is
+// armed, consuming the confirmation. Caller holds api.mu.
+func (api *LibDragAPI) checkArmInterlock(raceID string, override *SafetyOverride) error {
+	if !api.globalConfig.Safety().RequireTrackClear {
+		return nil
+	}
+	if api.trackClear.Clear {
+		api.trackClear = TrackClearStatus{}
+		return nil
+	}
+
+	if override == nil {
+		api.eventBus.Publish(
+			events.NewEvent(events.EventArmBlocked).
+				WithRaceID(raceID).
+				WithData("reason", "track_not_clear").
+				Build(),
+		)
+		return fmt.Errorf("track not confirmed clear since the previous run")
+	}
+	if override.By == "" || override.Reason == "" {
+		return fmt.Errorf("interlock override requires who is overriding and why")
+	}
+
+	api.audit.Record(audit.Entry{
+		Action: audit.ActionInterlockOverride,
+		Actor:  override.By,
+		RaceID: raceID,
+		Detail: override.Reason,
+	})
+	api.eventBus.Publish(
+		events.NewEvent(events.EventInterlockOverride).
+			WithRaceID(raceID).
+			WithData("interlock", "track_clear").
+			WithData("by", override.By).
+			WithData("reason", override.Reason).
+			Build(),
+	)
+	return nil
+}
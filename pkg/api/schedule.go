@@ -0,0 +1,66 @@
+package api
+
+import (
+	"fmt"
+
+	"github.com/benharold/libdrag/pkg/schedule"
+)
+
+// StartSessionSchedule opens and closes sessions at the times in cfg,
+// publishing session.open and session.close. Races started without a
+// session join the open one and use its class and tree profile unless they
+// set their own. Starting a schedule replaces any previous one; call Stop
+// on the scheduler when done.
+func (api *LibDragAPI) StartSessionSchedule(cfg schedule.Config) (*schedule.Scheduler, error) {
+	api.mu.Lock()
+	if api.eventBus == nil {
+		api.mu.Unlock()
+		return nil, fmt.Errorf("API not initialized")
+	}
+	scheduler, err := schedule.NewScheduler(api.eventBus, cfg)
+	if err != nil {
+		api.mu.Unlock()
+		return nil, err
+	}
+	previous := api.schedule
+	api.schedule = scheduler
+	api.mu.Unlock()
+
+	if previous != nil {
+		previous.Stop()
+	}
+	scheduler.Start()
+	return scheduler, nil
+}
+
+// CurrentSession returns the session the schedule has open, if any
+func (api *LibDragAPI) CurrentSession() (schedule.Session, bool) {
+	api.mu.RLock()
+	scheduler := api.schedule
+	api.mu.RUnlock()
+
+	if scheduler == nil {
+		return schedule.Session{}, false
+	}
+	return scheduler.Current()
+}
+
+// applySchedule fills a race's session and profile from the open session.
+// Must be called with api.mu held.
+func (api *LibDragAPI) applySchedule(opts *RaceOptions) {
+	if opts.SessionID != "" || api.schedule == nil {
+		return
+	}
+	session, ok := api.schedule.Current()
+	if !ok {
+		return
+	}
+	opts.SessionID = session.ID
+	if opts.Class == "" {
+		opts.Class = session.Class
+	}
+	if opts.Tree == nil && session.Tree != nil {
+		tree := *session.Tree
+		opts.Tree = &tree
+	}
+}
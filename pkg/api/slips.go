@@ -0,0 +1,90 @@
+package api
+
+import (
+	"fmt"
+
+	"github.com/benharold/libdrag/pkg/events"
+	"github.com/benharold/libdrag/pkg/notify"
+	"github.com/benharold/libdrag/pkg/slips"
+)
+
+// StartSlipPrinting spools an ET slip for every lane of each race to printer
+// once the race is decided; photo finishes print when the official resolves
+// them. Starting slip printing replaces any previous spooler, dropping the
+// slips it still had queued.
+func (api *LibDragAPI) StartSlipPrinting(printer slips.Printer, cfg slips.Config) (*slips.Spooler, error) {
+	api.mu.Lock()
+	if api.eventBus == nil {
+		api.mu.Unlock()
+		return nil, fmt.Errorf("API not initialized")
+	}
+	spooler, err := slips.NewSpooler(api.eventBus, printer, cfg)
+	if err != nil {
+		api.mu.Unlock()
+		return nil, err
+	}
+	if api.clock != nil {
+		spooler.SetClock(api.clock)
+	}
+	if logger := api.logger.Load(); logger != nil {
+		spooler.SetLogger(logger)
+	}
+
+	handler := func(event events.Event) {
+		api.mu.RLock()
+		info, ok := api.raceInfo[event.RaceID]
+		raceOrchestrator := api.orchestrators[event.RaceID]
+		foulDisplay := api.globalConfig.Timing().FoulDisplay
+		api.mu.RUnlock()
+
+		if !ok || raceOrchestrator == nil {
+			return
+		}
+		decision := raceOrchestrator.GetDecision()
+		if decision.UnderReview {
+			return
+		}
+
+		// Every lane that ran gets a slip, registered or not
+		timingResults := raceOrchestrator.GetResults()
+		lanes := make(map[int]string, len(timingResults))
+		for lane := range timingResults {
+			lanes[lane] = info.drivers[lane]
+		}
+		summaries := notify.BuildRunSummaries(event.RaceID, timingResults, decision, raceOrchestrator.GetDialIns(), lanes, nil)
+		notify.ApplyFoulDisplay(summaries, foulDisplay)
+		spooler.Enqueue(summaries, info.carNumbers)
+	}
+	unsubscribeComplete := api.eventBus.Subscribe(events.EventRaceComplete, handler)
+	unsubscribeResolved := api.eventBus.Subscribe(events.EventFinishResolved, handler)
+
+	previous, stopPrevious := api.slips, api.stopSlips
+	api.slips = spooler
+	api.stopSlips = func() {
+		unsubscribeComplete()
+		unsubscribeResolved()
+		spooler.Stop()
+	}
+	api.mu.Unlock()
+
+	if previous != nil {
+		stopPrevious()
+	}
+	return spooler, nil
+}
+
+// GetSlipSpooler returns the running slip spooler, if any
+func (api *LibDragAPI) GetSlipSpooler() (*slips.Spooler, bool) {
+	api.mu.RLock()
+	defer api.mu.RUnlock()
+	return api.slips, api.slips != nil
+}
+
+// ReprintSlip queues another copy of a run's ET slip
+func (api *LibDragAPI) ReprintSlip(runNumber int) error {
+	spooler, ok := api.GetSlipSpooler()
+	if !ok {
+		return fmt.Errorf("slip printing not started")
+	}
+	return spooler.Reprint(runNumber)
+}
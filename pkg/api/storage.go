@@ -0,0 +1,176 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/benharold/libdrag/pkg/events"
+	"github.com/benharold/libdrag/pkg/orchestrator"
+	"github.com/benharold/libdrag/pkg/results"
+	"github.com/benharold/libdrag/pkg/storage"
+	"github.com/benharold/libdrag/pkg/timetrial"
+	"github.com/benharold/libdrag/pkg/timing"
+	"github.com/benharold/libdrag/pkg/trace"
+	"github.com/benharold/libdrag/pkg/tree"
+)
+
+// RaceStorageConfig selects where finished races are kept
+type RaceStorageConfig struct {
+	Track   string          // Recorded on every race, for multi-track stores
+	Store   storage.Store   // Race records; required
+	Archive storage.Archive // Event journals, under "journals/{race}.json"; optional
+
+	Retention storage.Retention // How long races are kept, by class; see PruneRaceStorage
+}
+
+// storedRace is the race document kept in a storage.Record's Data
+type storedRace struct {
+	RaceID   string                        `json:"race_id"`
+	Status   orchestrator.RaceStatus       `json:"status"`
+	Results  map[int]*timing.TimingResults `json:"results"`
+	Decision results.Decision              `json:"decision"`
+	DialIns  map[int]float64               `json:"dial_ins,omitempty"`
+	Drivers  map[int]string                `json:"drivers,omitempty"`
+	External map[string]string             `json:"external,omitempty"` // External correlation IDs
+
+	// StagingMotion keeps each lane's staging motions for protest review
+	StagingMotion map[int]tree.StagingMotionState `json:"staging_motion,omitempty"`
+}
+
+// StartRaceStorage saves every race to cfg.Store when it completes or
+// aborts, and its event journal to cfg.Archive when one is set. Time trial
+// runs are saved as records of their own, with the run as their data.
+// TagRaceByID retags races kept in the store until it is stopped. Call the
+// returned function to stop saving races.
+func (api *LibDragAPI) StartRaceStorage(cfg RaceStorageConfig) (func(), error) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+
+	if api.eventBus == nil {
+		return nil, fmt.Errorf("API not initialized")
+	}
+	if cfg.Store == nil {
+		return nil, fmt.Errorf("store is required")
+	}
+
+	handler := func(event events.Event) {
+		record, ok := api.storageRecord(cfg.Track, event)
+		if !ok {
+			return
+		}
+		if err := cfg.Store.PutRace(context.Background(), record); err != nil {
+			api.log(event.RaceID).Warn("⚠️ failed to store race", "error", err)
+		}
+	}
+
+	unsubscribeComplete := api.eventBus.Subscribe(events.EventRaceComplete, handler)
+	unsubscribeAbort := api.eventBus.Subscribe(events.EventRaceAbort, handler)
+	unsubscribeRuns := api.eventBus.Subscribe(events.EventTimeTrialComplete, func(event events.Event) {
+		run, ok := event.Data["run"].(timetrial.Run)
+		if !ok {
+			return
+		}
+		record, err := runRecord(cfg.Track, run)
+		if err == nil {
+			err = cfg.Store.PutRace(context.Background(), record)
+		}
+		if err != nil {
+			api.log("").Warn("⚠️ failed to store time trial run", "run_id", run.ID, "error", err)
+		}
+	})
+
+	var recorder *trace.Recorder
+	if cfg.Archive != nil {
+		recorder = trace.NewRecorder(api.eventBus, trace.ExporterFunc(func(t *trace.Trace) error {
+			data, err := json.Marshal(t.Journal)
+			if err != nil {
+				return err
+			}
+			return cfg.Archive.PutObject(context.Background(), "journals/"+t.RaceID+".json", data)
+		}))
+		recorder.Start()
+	}
+
+	active := &cfg
+	api.raceStores = append(api.raceStores, active)
+
+	return func() {
+		unsubscribeComplete()
+		unsubscribeAbort()
+		unsubscribeRuns()
+		if recorder != nil {
+			recorder.Stop()
+		}
+
+		api.mu.Lock()
+		defer api.mu.Unlock()
+		for i, stores := range api.raceStores {
+			if stores == active {
+				api.raceStores = append(api.raceStores[:i], api.raceStores[i+1:]...)
+				break
+			}
+		}
+	}, nil
+}
+
+// storageRecord builds the stored record for the race an event belongs to
+func (api *LibDragAPI) storageRecord(track string, event events.Event) (storage.Record, bool) {
+	api.mu.RLock()
+	info := api.raceInfo[event.RaceID]
+	raceOrchestrator := api.orchestrators[event.RaceID]
+	api.mu.RUnlock()
+
+	if raceOrchestrator == nil {
+		return storage.Record{}, false
+	}
+
+	status := raceOrchestrator.GetRaceStatus()
+	data, err := json.Marshal(storedRace{
+		RaceID:   event.RaceID,
+		Status:   status,
+		Results:  raceOrchestrator.GetResults(),
+		Decision: raceOrchestrator.GetDecision(),
+		DialIns:  raceOrchestrator.GetDialIns(),
+		Drivers:  info.drivers,
+		External: info.external,
+
+		StagingMotion: raceOrchestrator.GetStagingMotion(),
+	})
+	if err != nil {
+		api.log(event.RaceID).Warn("⚠️ failed to encode race", "error", err)
+		return storage.Record{}, false
+	}
+
+	createdAt := info.createdAt
+	if createdAt.IsZero() {
+		createdAt = event.Timestamp
+	}
+	return storage.Record{
+		RaceID:    event.RaceID,
+		Track:     track,
+		SessionID: info.sessionID,
+		Class:     info.class,
+		State:     string(status.State),
+		Tags:      info.tags,
+		CreatedAt: createdAt,
+		Data:      data,
+	}, true
+}
+
+// runRecord builds the stored record for a time trial run
+func runRecord(track string, run timetrial.Run) (storage.Record, error) {
+	data, err := json.Marshal(run)
+	if err != nil {
+		return storage.Record{}, err
+	}
+	return storage.Record{
+		RaceID:    run.ID,
+		Track:     track,
+		SessionID: run.SessionID,
+		Class:     run.Class,
+		State:     run.Status,
+		CreatedAt: run.StagedAt,
+		Data:      data,
+	}, nil
+}
@@ -0,0 +1,102 @@
+package api
+
+import (
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/benharold/libdrag/pkg/events"
+)
+
+// TestConcurrentRaceStress runs hundreds of races at once with random
+// aborts, starter controls, status polling and subscription churn. It is
+// meant to be run under the race detector (make test-race).
+func TestConcurrentRaceStress(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping stress test in short mode")
+	}
+
+	const races = 200
+	api := NewLibDragAPI()
+	if err := api.Initialize(); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	defer api.Stop()
+	api.SetMaxConcurrentRaces(races)
+
+	var delivered atomic.Int64
+	stopChurn := make(chan struct{})
+	var churn sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		churn.Add(1)
+		go func() {
+			defer churn.Done()
+			for {
+				select {
+				case <-stopChurn:
+					return
+				default:
+				}
+				unsubscribe := api.SubscribeAll(func(events.Event) { delivered.Add(1) })
+				unsubscribeTree := api.Subscribe(events.EventTreeGreenOn, func(events.Event) {})
+				time.Sleep(time.Millisecond)
+				unsubscribe()
+				unsubscribeTree()
+			}
+		}()
+	}
+
+	var wg sync.WaitGroup
+	var aborted atomic.Int64
+	for i := 0; i < races; i++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(seed))
+
+			raceID, err := api.StartRaceWithOptions(RaceOptions{Class: "Super Pro", Drivers: map[int]string{1: "SG-1", 2: "SG-2"}})
+			if err != nil {
+				t.Errorf("StartRaceWithOptions failed: %v", err)
+				return
+			}
+			_ = api.SetDialInByID(raceID, 1, 9.5)
+
+			deadline := time.Now().Add(20 * time.Second)
+			for !api.IsRaceCompleteByID(raceID) && time.Now().Before(deadline) {
+				switch rng.Intn(8) {
+				case 0:
+					if rng.Intn(50) == 0 && api.AbortRaceByID(raceID, "stress") == nil {
+						aborted.Add(1)
+						return // Aborted races wait for cleanup instead of completing
+					}
+				case 1:
+					_ = api.GetTreeStatusJSONByID(raceID)
+				case 2:
+					_ = api.GetResultsJSONByID(raceID)
+				case 3:
+					_ = api.GetActiveRaceIDs()
+				case 4:
+					_ = api.QueryRacesJSON(RaceQuery{})
+				case 5:
+					_ = api.GetTimers()
+				default:
+					_ = api.GetRaceStatusJSONByID(raceID)
+				}
+				time.Sleep(time.Duration(rng.Intn(20)) * time.Millisecond)
+			}
+			if !api.IsRaceCompleteByID(raceID) {
+				t.Errorf("Race %s never finished", raceID)
+			}
+		}(int64(i))
+	}
+	wg.Wait()
+	close(stopChurn)
+	churn.Wait()
+
+	if delivered.Load() == 0 {
+		t.Error("Expected events delivered to churning subscribers")
+	}
+	t.Logf("%d races, %d aborted, %d events delivered", races, aborted.Load(), delivered.Load())
+}
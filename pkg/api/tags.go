@@ -0,0 +1,67 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/benharold/libdrag/pkg/events"
+	"github.com/benharold/libdrag/pkg/storage"
+	"github.com/benharold/libdrag/pkg/tags"
+)
+
+// TagRaceByID adds and removes a race's tags, returning the race's tags
+// after the change. An active race is retagged in place, and the race is
+// retagged in every store saving races (see StartRaceStorage) that holds
+// it, so a run can be marked rain-shortened after it is stored. It
+// publishes race.tags.
+func (api *LibDragAPI) TagRaceByID(raceID string, add, remove []string) ([]string, error) {
+	api.mu.Lock()
+	info, active := api.raceInfo[raceID]
+	var updated []string
+	if active {
+		var err error
+		if updated, err = tags.Update(info.tags, add, remove); err != nil {
+			api.mu.Unlock()
+			return nil, err
+		}
+		info.tags = updated
+		api.raceInfo[raceID] = info
+	}
+	stores := make([]storage.Store, 0, len(api.raceStores))
+	for _, cfg := range api.raceStores {
+		stores = append(stores, cfg.Store)
+	}
+	bus := api.eventBus
+	api.mu.Unlock()
+
+	stored := false
+	for _, store := range stores {
+		record, err := storage.TagRace(context.Background(), store, raceID, add, remove)
+		if errors.Is(err, storage.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !active && !stored {
+			updated = record.Tags
+		}
+		stored = true
+	}
+	if !active && !stored {
+		return nil, fmt.Errorf("race %s not found", raceID)
+	}
+
+	if bus != nil {
+		bus.Publish(
+			events.NewEvent(events.EventRaceTags).
+				WithRaceID(raceID).
+				WithData("tags", updated).
+				WithData("added", add).
+				WithData("removed", remove).
+				Build(),
+		)
+	}
+	return updated, nil
+}
@@ -0,0 +1,19 @@
+package api
+
+import "github.com/benharold/libdrag/pkg/timers"
+
+// TimerStatus lists the pending race timers with the wheel's counters
+type TimerStatus struct {
+	Timers  []timers.Info  `json:"timers"`
+	Metrics timers.Metrics `json:"metrics"`
+}
+
+// GetTimers returns the pending timers on the shared timer wheel, soonest
+// first, for diagnosing stuck staging or autostart sequences
+func (api *LibDragAPI) GetTimers() TimerStatus {
+	wheel := timers.Default()
+	return TimerStatus{
+		Timers:  wheel.Pending(),
+		Metrics: wheel.Metrics(),
+	}
+}
@@ -0,0 +1,53 @@
+package api
+
+import (
+	"fmt"
+
+	"github.com/benharold/libdrag/pkg/timetrial"
+)
+
+// StartTimeTrials starts a time trial session of continuous solo runs, each
+// lane staging its next car as soon as its last run is done. The session
+// and class default to the scheduled session's. Starting time trials
+// replaces any previous session, aborting its runs in progress.
+func (api *LibDragAPI) StartTimeTrials(cfg timetrial.Config) (*timetrial.Session, error) {
+	api.mu.Lock()
+	if api.eventBus == nil {
+		api.mu.Unlock()
+		return nil, fmt.Errorf("API not initialized")
+	}
+	opts := RaceOptions{SessionID: cfg.SessionID, Class: cfg.Class}
+	api.applySchedule(&opts)
+	cfg.SessionID, cfg.Class = opts.SessionID, opts.Class
+
+	sessionConfig := api.globalConfig
+	if cfg.Class != "" {
+		sessionConfig = classConfig{Config: api.globalConfig, class: cfg.Class}
+	}
+	session, err := timetrial.NewSession(api.eventBus, sessionConfig, cfg)
+	if err != nil {
+		api.mu.Unlock()
+		return nil, err
+	}
+	if api.clock != nil {
+		session.SetClock(api.clock)
+	}
+	if logger := api.logger.Load(); logger != nil {
+		session.SetLogger(logger)
+	}
+	previous := api.timeTrials
+	api.timeTrials = session
+	api.mu.Unlock()
+
+	if previous != nil {
+		previous.Stop()
+	}
+	return session, nil
+}
+
+// GetTimeTrials returns the running time trial session, if any
+func (api *LibDragAPI) GetTimeTrials() (*timetrial.Session, bool) {
+	api.mu.RLock()
+	defer api.mu.RUnlock()
+	return api.timeTrials, api.timeTrials != nil
+}
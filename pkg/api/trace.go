@@ -0,0 +1,25 @@
+package api
+
+import (
+	"fmt"
+
+	"github.com/benharold/libdrag/pkg/trace"
+)
+
+// StartRaceTracing builds an OpenTelemetry-style trace for every race
+// (staging, countdown, each lane's splits, completion) when it completes or
+// aborts and hands it to exporter, which may be nil to only keep recent
+// traces for lookup with Trace. Use trace.HTTPExporter to send traces to an
+// OTLP/HTTP collector. Call Stop on the recorder when done.
+func (api *LibDragAPI) StartRaceTracing(exporter trace.Exporter) (*trace.Recorder, error) {
+	api.mu.RLock()
+	defer api.mu.RUnlock()
+
+	if api.eventBus == nil {
+		return nil, fmt.Errorf("API not initialized")
+	}
+
+	recorder := trace.NewRecorder(api.eventBus, exporter)
+	recorder.Start()
+	return recorder, nil
+}
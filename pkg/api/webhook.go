@@ -0,0 +1,45 @@
+package api
+
+import (
+	"fmt"
+
+	"github.com/benharold/libdrag/pkg/webhook"
+)
+
+// StartWebhooks posts the events each endpoint selects (by default races
+// decided, track records and incidents) to outbound webhooks, signed and
+// retried. Starting webhooks replaces any previous dispatcher, dropping the
+// deliveries it still had queued.
+func (api *LibDragAPI) StartWebhooks(cfg webhook.Config) (*webhook.Dispatcher, error) {
+	api.mu.Lock()
+	if api.eventBus == nil {
+		api.mu.Unlock()
+		return nil, fmt.Errorf("API not initialized")
+	}
+	dispatcher, err := webhook.NewDispatcher(api.eventBus, cfg)
+	if err != nil {
+		api.mu.Unlock()
+		return nil, err
+	}
+	if api.clock != nil {
+		dispatcher.SetClock(api.clock)
+	}
+	if logger := api.logger.Load(); logger != nil {
+		dispatcher.SetLogger(logger)
+	}
+	previous := api.webhooks
+	api.webhooks = dispatcher
+	api.mu.Unlock()
+
+	if previous != nil {
+		previous.Stop()
+	}
+	return dispatcher, nil
+}
+
+// GetWebhooks returns the running webhook dispatcher, if any
+func (api *LibDragAPI) GetWebhooks() (*webhook.Dispatcher, bool) {
+	api.mu.RLock()
+	defer api.mu.RUnlock()
+	return api.webhooks, api.webhooks != nil
+}
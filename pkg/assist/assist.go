@@ -0,0 +1,290 @@
+// Package assist drives the staging assist displays some tracks put beside
+// the tree for novice drivers, turning each lane's pre-stage, stage and
+// guard beam state into "inches to stage" style guidance.
+package assist
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/benharold/libdrag/pkg/events"
+	"github.com/benharold/libdrag/pkg/timers"
+)
+
+// Defaults used when Config fields are zero
+const (
+	DefaultPreStageDistance = 7.0  // Inches from the pre-stage beam to the stage beam
+	DefaultRollout          = 11.5 // Inches a tire travels from breaking the stage beam to clearing it
+	DefaultGuardBeam        = "guard"
+	DefaultInterval         = 100 * time.Millisecond
+)
+
+// Config describes the staging beam geometry and the update rate
+type Config struct {
+	PreStageDistance float64       `json:"pre_stage_distance"` // Inches between the pre-stage and stage beams
+	Rollout          float64       `json:"rollout"`            // Inches of tire travel that keep the stage beam broken
+	GuardBeam        string        `json:"guard_beam"`         // Beam ID of the guard beam
+	Interval         time.Duration `json:"interval"`           // Time between staging.assist updates
+}
+
+// Instruction is what a lane's display tells its driver
+type Instruction string
+
+const (
+	InstructionPullUp Instruction = "pull_up" // Short of the pre-stage beam
+	InstructionCreep  Instruction = "creep"   // Pre-staged, roll in to stage
+	InstructionStop   Instruction = "stop"    // Staged
+	InstructionBackUp Instruction = "back_up" // Guard beam broken, too far in
+)
+
+// Position is where a lane's front tire is relative to the staging beams
+type Position string
+
+const (
+	PositionApproach   Position = "approach"    // No staging beams broken
+	PositionPreStaged  Position = "pre_staged"  // Pre-stage beam only
+	PositionStaged     Position = "staged"      // Both staging beams
+	PositionDeepStaged Position = "deep_staged" // Stage beam only, pre-stage cleared
+	PositionGuard      Position = "guard"       // Guard beam broken
+)
+
+// LaneGuidance is one lane's staging assist output. Distances come from the
+// beam geometry and the rollout model, so they are the most the tire can
+// still travel in its current position: InchesToStage is the pre-stage to
+// stage beam gap while pre-staged, and RolloutRemaining is how far the car
+// can still roll before the stage beam clears.
+type LaneGuidance struct {
+	Lane             int         `json:"lane"`
+	Position         Position    `json:"position"`
+	Instruction      Instruction `json:"instruction"`
+	InchesToStage    *float64    `json:"inches_to_stage,omitempty"` // Unknown while approaching
+	RolloutRemaining *float64    `json:"rollout_remaining,omitempty"`
+	Updated          time.Time   `json:"updated"`
+}
+
+// laneBeams is the staging beam state of a lane
+type laneBeams struct {
+	preStage bool
+	stage    bool
+	guard    bool
+	changed  time.Time
+}
+
+// Assist follows the staging beams of the pair on the starting line and
+// publishes staging.assist for every lane with a car in the beams each
+// Interval, plus a final update when a lane backs out. Updates stop at
+// green, when the run no longer needs guidance, and start again with the
+// next race.
+type Assist struct {
+	mu          sync.Mutex
+	bus         *events.EventBus
+	config      Config
+	raceID      string
+	lanes       map[int]*laneBeams
+	published   map[int]Position // Last position published per lane
+	timer       *timers.Timer
+	running     bool
+	unsubscribe func()
+}
+
+// NewAssist creates a staging assist publishing to bus
+func NewAssist(bus *events.EventBus, config Config) *Assist {
+	if config.PreStageDistance <= 0 {
+		config.PreStageDistance = DefaultPreStageDistance
+	}
+	if config.Rollout <= 0 {
+		config.Rollout = DefaultRollout
+	}
+	if config.GuardBeam == "" {
+		config.GuardBeam = DefaultGuardBeam
+	}
+	if config.Interval <= 0 {
+		config.Interval = DefaultInterval
+	}
+	return &Assist{
+		bus:       bus,
+		config:    config,
+		lanes:     make(map[int]*laneBeams),
+		published: make(map[int]Position),
+	}
+}
+
+// Start subscribes to the bus and begins periodic updates
+func (a *Assist) Start() {
+	a.mu.Lock()
+	a.running = true
+	a.schedule()
+	a.mu.Unlock()
+
+	a.unsubscribe = a.bus.SubscribeAll(a.HandleEvent)
+}
+
+// Stop unsubscribes from the bus and stops updates
+func (a *Assist) Stop() {
+	if a.unsubscribe != nil {
+		a.unsubscribe()
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.running = false
+	if a.timer != nil {
+		a.timer.Stop()
+		a.timer = nil
+	}
+}
+
+// Guidance returns the current guidance for every lane seen in the race
+func (a *Assist) Guidance() map[int]LaneGuidance {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	result := make(map[int]LaneGuidance, len(a.lanes))
+	for lane, beams := range a.lanes {
+		result[lane] = a.guidance(lane, beams)
+	}
+	return result
+}
+
+// HandleEvent updates beam state from a single event
+func (a *Assist) HandleEvent(event events.Event) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	switch event.Type {
+	case events.EventRaceStart:
+		a.reset(event.RaceID)
+		return
+	case events.EventTreeGreenOn, events.EventRaceComplete, events.EventRaceAbort:
+		if event.RaceID == a.raceID {
+			a.reset("")
+		}
+		return
+	}
+
+	lane := event.Lane
+	if lane <= 0 {
+		return
+	}
+	broken, ok := event.Data["beam_broken"].(bool)
+	var beams *laneBeams
+	switch event.Type {
+	case events.EventTreePreStage:
+		if !ok {
+			return
+		}
+		beams = a.lane(event.RaceID, lane)
+		beams.preStage = broken
+	case events.EventTreeStage:
+		if !ok {
+			return
+		}
+		beams = a.lane(event.RaceID, lane)
+		beams.stage = broken
+	case events.EventBeamBroken, events.EventBeamRestored:
+		if id, _ := event.Data["beam_id"].(string); id != a.config.GuardBeam {
+			return
+		}
+		beams = a.lane(event.RaceID, lane)
+		beams.guard = event.Type == events.EventBeamBroken
+	default:
+		return
+	}
+
+	beams.changed = event.Timestamp
+	if beams.changed.IsZero() {
+		beams.changed = timers.Now()
+	}
+}
+
+// lane returns a lane's beams, switching to a new race if the event is from
+// one. Caller holds a.mu.
+func (a *Assist) lane(raceID string, lane int) *laneBeams {
+	if raceID != a.raceID {
+		a.reset(raceID)
+	}
+	beams, ok := a.lanes[lane]
+	if !ok {
+		beams = &laneBeams{}
+		a.lanes[lane] = beams
+	}
+	return beams
+}
+
+// reset clears the lanes for a new race. Caller holds a.mu.
+func (a *Assist) reset(raceID string) {
+	a.raceID = raceID
+	a.lanes = make(map[int]*laneBeams)
+	a.published = make(map[int]Position)
+}
+
+// guidance computes a lane's guidance. Caller holds a.mu.
+func (a *Assist) guidance(lane int, beams *laneBeams) LaneGuidance {
+	g := LaneGuidance{Lane: lane, Updated: beams.changed}
+	inches := func(v float64) *float64 { return &v }
+
+	// Each beam stays broken for Rollout inches of tire travel, so once the
+	// pre-stage beam clears the stage beam has at most PreStageDistance left
+	switch {
+	case beams.guard:
+		g.Position, g.Instruction = PositionGuard, InstructionBackUp
+	case beams.stage && beams.preStage:
+		g.Position, g.Instruction = PositionStaged, InstructionStop
+		g.InchesToStage = inches(0)
+		g.RolloutRemaining = inches(a.config.Rollout)
+	case beams.stage:
+		g.Position, g.Instruction = PositionDeepStaged, InstructionStop
+		g.InchesToStage = inches(0)
+		g.RolloutRemaining = inches(min(a.config.PreStageDistance, a.config.Rollout))
+	case beams.preStage:
+		g.Position, g.Instruction = PositionPreStaged, InstructionCreep
+		g.InchesToStage = inches(a.config.PreStageDistance)
+	default:
+		g.Position, g.Instruction = PositionApproach, InstructionPullUp
+	}
+	return g
+}
+
+// schedule arms the next update. Caller holds a.mu.
+func (a *Assist) schedule() {
+	a.timer = timers.Default().AfterFunc(a.config.Interval, timers.Label{Name: "assist.update"}, a.tick)
+}
+
+// tick publishes the lanes with a car in the beams and any lane that has
+// just backed out
+func (a *Assist) tick() {
+	a.mu.Lock()
+	if !a.running {
+		a.mu.Unlock()
+		return
+	}
+	raceID := a.raceID
+	var updates []LaneGuidance
+	for lane, beams := range a.lanes {
+		g := a.guidance(lane, beams)
+		if g.Position == PositionApproach && a.published[lane] == PositionApproach {
+			continue
+		}
+		a.published[lane] = g.Position
+		updates = append(updates, g)
+	}
+	sort.Slice(updates, func(i, j int) bool { return updates[i].Lane < updates[j].Lane })
+	a.schedule()
+	a.mu.Unlock()
+
+	// Publish outside the lock so synchronous buses can redeliver to us
+	for _, g := range updates {
+		builder := events.NewEvent(events.EventStagingAssist).
+			WithRaceID(raceID).
+			WithLane(g.Lane).
+			WithData("position", string(g.Position)).
+			WithData("instruction", string(g.Instruction))
+		if g.InchesToStage != nil {
+			builder.WithData("inches_to_stage", *g.InchesToStage)
+		}
+		if g.RolloutRemaining != nil {
+			builder.WithData("rollout_remaining", *g.RolloutRemaining)
+		}
+		a.bus.Publish(builder.Build())
+	}
+}
@@ -0,0 +1,83 @@
+package assist
+
+import (
+	"testing"
+	"time"
+
+	"github.com/benharold/libdrag/pkg/events"
+	"github.com/benharold/libdrag/pkg/timers"
+)
+
+func TestStagingGuidance(t *testing.T) {
+	wheel := timers.NewVirtualWheel(time.Date(2025, time.June, 7, 18, 0, 0, 0, time.UTC), timers.DefaultTick)
+	defer timers.SetDefault(wheel)()
+
+	bus := events.NewEventBus(false)
+	staging := NewAssist(bus, Config{Interval: 250 * time.Millisecond})
+	staging.Start()
+	defer staging.Stop()
+
+	var updates []events.Event
+	bus.Subscribe(events.EventStagingAssist, func(e events.Event) {
+		updates = append(updates, e)
+	})
+
+	beam := func(eventType events.EventType, lane int, broken bool) {
+		bus.Publish(events.NewEvent(eventType).WithRaceID("race-1").WithLane(lane).WithData("beam_broken", broken).Build())
+	}
+	expect := func(lane int, position Position, instruction Instruction, toStage, rollout float64) {
+		t.Helper()
+		g := staging.Guidance()[lane]
+		if g.Position != position || g.Instruction != instruction {
+			t.Fatalf("Lane %d: expected %s/%s, got %s/%s", lane, position, instruction, g.Position, g.Instruction)
+		}
+		if toStage >= 0 && (g.InchesToStage == nil || *g.InchesToStage != toStage) {
+			t.Errorf("Lane %d: expected %.1f inches to stage, got %v", lane, toStage, g.InchesToStage)
+		}
+		if rollout >= 0 && (g.RolloutRemaining == nil || *g.RolloutRemaining != rollout) {
+			t.Errorf("Lane %d: expected %.1f inches of rollout left, got %v", lane, rollout, g.RolloutRemaining)
+		}
+	}
+
+	bus.Publish(events.NewEvent(events.EventRaceStart).WithRaceID("race-1").Build())
+	beam(events.EventTreePreStage, 1, true)
+	expect(1, PositionPreStaged, InstructionCreep, DefaultPreStageDistance, -1)
+
+	beam(events.EventTreeStage, 1, true)
+	expect(1, PositionStaged, InstructionStop, 0, DefaultRollout)
+
+	beam(events.EventTreePreStage, 1, false)
+	expect(1, PositionDeepStaged, InstructionStop, 0, DefaultPreStageDistance)
+
+	// Guard beam trips take priority
+	bus.Publish(events.NewEvent(events.EventBeamBroken).WithRaceID("race-1").WithLane(1).WithData("beam_id", "guard").Build())
+	expect(1, PositionGuard, InstructionBackUp, -1, -1)
+	bus.Publish(events.NewEvent(events.EventBeamRestored).WithRaceID("race-1").WithLane(1).WithData("beam_id", "guard").Build())
+	expect(1, PositionDeepStaged, InstructionStop, 0, DefaultPreStageDistance)
+
+	// Updates are published at the configured rate while a car is in the beams
+	beam(events.EventTreePreStage, 2, true)
+	wheel.Advance(time.Second)
+	if len(updates) != 8 {
+		t.Fatalf("Expected 4 updates for each lane, got %d", len(updates))
+	}
+	if updates[1].Lane != 2 || updates[1].Data["instruction"] != string(InstructionCreep) || updates[1].Data["inches_to_stage"] != DefaultPreStageDistance {
+		t.Errorf("Unexpected lane 2 update %+v", updates[1])
+	}
+
+	// A lane that backs out gets one last update
+	beam(events.EventTreePreStage, 2, false)
+	updates = nil
+	wheel.Advance(time.Second)
+	if len(updates) != 5 || updates[1].Data["position"] != string(PositionApproach) {
+		t.Fatalf("Expected a final approach update for lane 2, got %d updates", len(updates))
+	}
+
+	// Guidance stops at green
+	bus.Publish(events.NewEvent(events.EventTreeGreenOn).WithRaceID("race-1").Build())
+	updates = nil
+	wheel.Advance(time.Second)
+	if len(updates) != 0 || len(staging.Guidance()) != 0 {
+		t.Errorf("Expected no guidance after green, got %d updates", len(updates))
+	}
+}
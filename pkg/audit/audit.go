@@ -0,0 +1,60 @@
+// Package audit keeps an append-only record of safety-relevant actions, such
+// as track-clear confirmations and interlock overrides, for post-event review.
+package audit
+
+import (
+	"sync"
+	"time"
+
+	"github.com/benharold/libdrag/pkg/timers"
+)
+
+// Audited actions
+const (
+	ActionTrackClear        = "track_clear"        // Track confirmed clear for the next pair
+	ActionInterlockOverride = "interlock_override" // Safety interlock bypassed by an official
+)
+
+// Entry is a single audited action
+type Entry struct {
+	At     time.Time `json:"at"`
+	Action string    `json:"action"`
+	Actor  string    `json:"actor"` // Official or sensor responsible
+	RaceID string    `json:"race_id,omitempty"`
+	Detail string    `json:"detail,omitempty"`
+}
+
+// Log is a bounded, concurrency-safe audit log
+type Log struct {
+	mu         sync.Mutex
+	entries    []Entry
+	maxEntries int
+}
+
+// NewLog creates a log keeping the newest maxEntries entries (0 = unbounded)
+func NewLog(maxEntries int) *Log {
+	return &Log{maxEntries: maxEntries}
+}
+
+// Record appends an entry, stamping it with the current time if unset
+func (l *Log) Record(entry Entry) Entry {
+	if entry.At.IsZero() {
+		entry.At = timers.Now()
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.entries = append(l.entries, entry)
+	if l.maxEntries > 0 && len(l.entries) > l.maxEntries {
+		l.entries = append([]Entry(nil), l.entries[len(l.entries)-l.maxEntries:]...)
+	}
+	return entry
+}
+
+// Entries returns the recorded entries, oldest first
+func (l *Log) Entries() []Entry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]Entry(nil), l.entries...)
+}
@@ -0,0 +1,18 @@
+package audit
+
+import "testing"
+
+func TestLogKeepsNewestEntries(t *testing.T) {
+	log := NewLog(2)
+	log.Record(Entry{Action: ActionTrackClear, Actor: "tower"})
+	log.Record(Entry{Action: ActionInterlockOverride, Actor: "starter", RaceID: "race-1"})
+	log.Record(Entry{Action: ActionTrackClear, Actor: "downtrack"})
+
+	entries := log.Entries()
+	if len(entries) != 2 || entries[0].Actor != "starter" || entries[1].Actor != "downtrack" {
+		t.Fatalf("Expected the newest two entries, got %+v", entries)
+	}
+	if entries[0].At.IsZero() {
+		t.Error("Entries should be time stamped")
+	}
+}
@@ -3,13 +3,17 @@ package autostart
 import (
 	"context"
 	"fmt"
+	"log/slog"
 	"math/rand"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/benharold/libdrag/pkg/component"
 	"github.com/benharold/libdrag/pkg/config"
 	"github.com/benharold/libdrag/pkg/events" // Added for event bus
+	"github.com/benharold/libdrag/pkg/logs"
+	"github.com/benharold/libdrag/pkg/timers"
 	"github.com/benharold/libdrag/pkg/tree"
 )
 
@@ -35,6 +39,16 @@ type StagingStatus struct {
 	Rollout    float64   `json:"rollout"`    // Distance past stage beam
 }
 
+// ActivationPolicy selects which staging bulbs activate auto-start and start
+// the staging clock
+type ActivationPolicy string
+
+const (
+	ActivationThreeBulb     ActivationPolicy = "three_bulb"     // Both pre-stage bulbs plus one stage bulb (default)
+	ActivationFirstStage    ActivationPolicy = "first_stage"    // First stage bulb, regardless of pre-stage
+	ActivationBothPreStaged ActivationPolicy = "both_prestaged" // Both pre-stage bulbs
+)
+
 // AutoStartConfig holds configuration for the auto-start system
 type AutoStartConfig struct {
 	// Core timing parameters
@@ -44,6 +58,22 @@ type AutoStartConfig struct {
 	RandomDelayMax     time.Duration `json:"random_delay_max"`     // Maximum random delay (1.4 seconds)
 	RandomVariation    time.Duration `json:"random_variation"`     // Additional random variation (0.2 seconds)
 
+	// DelayAlgorithm is how the random delay is drawn; empty draws it
+	// uniformly
+	DelayAlgorithm DelayAlgorithm `json:"delay_algorithm,omitempty"`
+	// DelayTables are the delays DelayClassTable picks from, by racing class
+	DelayTables map[string][]time.Duration `json:"delay_tables,omitempty"`
+
+	// TimeoutWarnings are the fractions of StagingTimeout, in order, at
+	// which a lane still to stage is warned before it is faulted
+	TimeoutWarnings []float64 `json:"timeout_warnings,omitempty"`
+	// StageFlashLevel is the warning level (1 for the first) from which a
+	// lane still to stage has its stage bulb flashed; 0 never flashes it
+	StageFlashLevel int `json:"stage_flash_level,omitempty"`
+	// CountdownTick is how often autostart.countdown_tick counts the
+	// staging clock down; 0 ticks every DefaultCountdownTick
+	CountdownTick time.Duration `json:"countdown_tick,omitempty"`
+
 	// Safety parameters
 	GuardBeamDistance  float64 `json:"guard_beam_distance"`  // Distance to guard beam (13.375 inches)
 	MaxRolloutDistance float64 `json:"max_rollout_distance"` // Maximum allowed rollout
@@ -53,11 +83,16 @@ type AutoStartConfig struct {
 	EnabledForElims      bool                    `json:"enabled_for_elims"`      // Auto-start for eliminations
 	EnabledForTimeTrials bool                    `json:"enabled_for_timetrials"` // Auto-start for time trials
 	TreeSequenceType     config.TreeSequenceType `json:"tree_sequence_type"`     // Pro or Sportsman tree
+	ActivationPolicy     ActivationPolicy        `json:"activation_policy"`      // Empty uses the three-bulb rule
 
 	// IHRA/NHRA class-specific settings
 	RacingClass string `json:"racing_class"` // e.g., "Top Fuel", "Pro Stock", "Bracket"
 }
 
+// DefaultCountdownTick is the staging clock's tick when the configuration
+// gives none: whole seconds, as CompuLink boards show it
+const DefaultCountdownTick = time.Second
+
 // classPresets defines preset configurations for different racing classes
 var classPresets = map[string]AutoStartConfig{
 	"Sportsman": {
@@ -66,6 +101,8 @@ var classPresets = map[string]AutoStartConfig{
 		RandomDelayMin:       600 * time.Millisecond,
 		RandomDelayMax:       1400 * time.Millisecond,
 		RandomVariation:      200 * time.Millisecond,
+		TimeoutWarnings:      []float64{0.5, 0.8},
+		StageFlashLevel:      1,
 		GuardBeamDistance:    13.375,
 		MaxRolloutDistance:   6.0,
 		PreStageDistance:     -7.0,
@@ -80,6 +117,8 @@ var classPresets = map[string]AutoStartConfig{
 		RandomDelayMin:       600 * time.Millisecond,
 		RandomDelayMax:       1100 * time.Millisecond,
 		RandomVariation:      200 * time.Millisecond,
+		TimeoutWarnings:      []float64{0.5, 0.8},
+		StageFlashLevel:      2,
 		GuardBeamDistance:    13.375,
 		MaxRolloutDistance:   6.0,
 		PreStageDistance:     -7.0,
@@ -95,6 +134,8 @@ var classPresets = map[string]AutoStartConfig{
 		RandomDelayMin:       600 * time.Millisecond,
 		RandomDelayMax:       1100 * time.Millisecond,
 		RandomVariation:      200 * time.Millisecond,
+		TimeoutWarnings:      []float64{0.5, 0.8},
+		StageFlashLevel:      2,
 		GuardBeamDistance:    13.375,
 		MaxRolloutDistance:   6.0,
 		PreStageDistance:     -7.0,
@@ -116,6 +157,7 @@ type AutoStartStatus struct {
 	BothVehiclesStaged time.Time              `json:"both_vehicles_staged,omitempty"`
 	TreeTriggerTime    time.Time              `json:"tree_trigger_time,omitempty"`
 	LastFaultReason    string                 `json:"last_fault_reason,omitempty"`
+	LastDelay          *DelayDraw             `json:"last_delay,omitempty"` // Random delay of the last run fired
 	OverrideActive     bool                   `json:"override_active"`
 	StarterControl     bool                   `json:"starter_control"`
 }
@@ -138,17 +180,24 @@ type AutoStartSystem struct {
 	onTreeTrigger func() error
 	onFault       func(reason string)
 	onStateChange func(oldState, newState AutoStartState)
+	onTimeout     func(lane int, elapsed time.Duration)
 
 	// Internal timing
-	stagingTimer *time.Timer
-	randomSeed   *rand.Rand
+	stagingTimer  *timers.Timer
+	warningTimers []*timers.Timer // Pending staging timeout warnings
+	countdown     *timers.Timer   // Next staging clock tick
+	countdownGen  int             // Bumped per countdown, so a stale tick is ignored
+	randomSeed    *rand.Rand
+	delayStrategy DelayStrategy // Nil draws by config.DelayAlgorithm
+	clock         timers.Clock  // Nil runs on the default wheel
+	logger        *slog.Logger  // Nil logs to logs.Default
 }
 
 // NewAutoStartSystem creates a new auto-start system
 func NewAutoStartSystem(eventBus *events.EventBus) *AutoStartSystem { // Added eventBus to constructor
 	return &AutoStartSystem{
 		id:         "autostart_system",
-		randomSeed: rand.New(rand.NewSource(time.Now().UnixNano())),
+		randomSeed: rand.New(rand.NewSource(timers.Now().UnixNano())),
 		eventBus:   eventBus, // Set event bus
 		status: AutoStartStatus{
 			State:          StateIdle,
@@ -182,19 +231,15 @@ func (as *AutoStartSystem) Initialize(ctx context.Context, cfg config.Config) er
 	defer as.mu.Unlock()
 
 	// Load preset based on cfg.RacingClass (default "Sportsman" if empty/invalid)
-	class := cfg.RacingClass()
-	if class == "" {
-		class = "Sportsman"
-	}
-	preset, ok := classPresets[class]
-	if !ok {
-		preset = classPresets["Sportsman"] // Fallback
-	}
-	as.config = preset
+	as.config = ClassPreset(cfg.RacingClass())
 
 	// Override TreeSequenceType from system config if specified
 	treeConfig := cfg.Tree()
 	as.config.TreeSequenceType = treeConfig.Type
+	// A tree preset's arming window is the random delay's
+	if treeConfig.ArmDelayMax > 0 {
+		as.config.RandomDelayMin, as.config.RandomDelayMax = treeConfig.ArmDelayMin, treeConfig.ArmDelayMax
+	}
 
 	// Initialize vehicle staging status for configured lanes
 	trackConfig := cfg.Track()
@@ -234,10 +279,7 @@ func (as *AutoStartSystem) Stop(ctx context.Context) error {
 	as.status.State = StateIdle
 
 	// Cancel any active timers
-	if as.stagingTimer != nil {
-		as.stagingTimer.Stop()
-		as.stagingTimer = nil
-	}
+	as.cancelStagingTimeout()
 
 	return nil
 }
@@ -287,7 +329,7 @@ func (as *AutoStartSystem) UpdateVehicleStaging(lane int, preStaged, staged bool
 
 	stagingStatus.PreStaged = preStaged
 	stagingStatus.Staged = staged
-	stagingStatus.LastUpdate = time.Now()
+	stagingStatus.LastUpdate = timers.Or(as.clock).Now()
 	stagingStatus.Rollout = position // Track rollout distance
 
 	// Check for guard beam violation (excessive rollout)
@@ -302,25 +344,24 @@ func (as *AutoStartSystem) UpdateVehicleStaging(lane int, preStaged, staged bool
 	if staged && preCount < 2 {
 		// Courtesy violation: Staged without both pre-staged
 		// Could fault or just log/warn per regs (encouraged, not enforced)
-		fmt.Println("Courtesy staging violation: Staged before both pre-staged")
+		as.log().Warn("Courtesy staging violation, staged before both pre-staged", logs.KeyLane, lane)
 		// Optional: if config.CourtesyEnforced { as.triggerFault("Courtesy staging violation") }
 	}
 
-	// Check if this triggers the three-light rule
+	// Check if this triggers the three-light rule; activating starts the
+	// timeout itself when a lane is staged
 	if as.shouldActivateAutoStartMonitoring(oldPreStaged, oldStaged, preStaged, staged) {
 		as.triggerAutoStart()
-	}
-
-	// If activated and this update caused countStaged to become 1, start timeout
-	if as.status.State == StateActivated && as.countStaged() == 1 && !oldStaged && staged {
+	} else if as.status.State == StateActivated && as.countStaged() == 1 && !oldStaged && staged && as.config.ActivationPolicy != ActivationBothPreStaged {
+		// If activated and this update caused countStaged to become 1, start timeout
 		as.startSecondStageTimeout()
 	}
 
 	return nil
 }
 
-// shouldActivateAutoStartMonitoring implements the "three-light rule"
-// Only triggers when tree is already armed
+// shouldActivateAutoStartMonitoring implements the "three-light rule", or the
+// track's alternate activation policy. Only triggers when tree is already armed
 func (as *AutoStartSystem) shouldActivateAutoStartMonitoring(oldPreStaged, oldStaged, newPreStaged, newStaged bool) bool {
 	// Auto-start can only activate if tree is already armed
 	if as.tree == nil || !as.tree.IsArmed() {
@@ -331,14 +372,21 @@ func (as *AutoStartSystem) shouldActivateAutoStartMonitoring(oldPreStaged, oldSt
 		return false
 	}
 
-	return as.countPreStaged() == 2 && as.countStaged() >= 1
+	switch as.config.ActivationPolicy {
+	case ActivationFirstStage:
+		return as.countStaged() >= 1
+	case ActivationBothPreStaged:
+		return as.countPreStaged() == 2
+	default:
+		return as.countPreStaged() == 2 && as.countStaged() >= 1
+	}
 }
 
 // triggerAutoStart activates the auto-start countdown sequence (tree must already be armed)
 func (as *AutoStartSystem) triggerAutoStart() {
 	oldState := as.status.State
 	as.status.State = StateActivated
-	as.status.CountdownStarted = time.Now()
+	as.status.CountdownStarted = timers.Or(as.clock).Now()
 
 	// Activate the auto-start system on the tree (tree must already be armed)
 	if as.tree != nil {
@@ -360,14 +408,14 @@ func (as *AutoStartSystem) triggerAutoStart() {
 
 	// Monitor for both vehicles fully staged (and start timeout if already one staged)
 	go as.monitorForFullStaging()
-	if as.countStaged() == 1 { // If activation happened on first stage
+	if as.countStaged() == 1 || as.config.ActivationPolicy == ActivationBothPreStaged { // If activation happened on first stage, or pre-stage starts the clock
 		as.startSecondStageTimeout()
 	}
 }
 
 // monitorForFullStaging watches for both vehicles to be fully staged
 func (as *AutoStartSystem) monitorForFullStaging() {
-	ticker := time.NewTicker(5 * time.Millisecond) // Very frequent checking for test reliability
+	ticker := timers.Or(as.clock).NewTicker(5*time.Millisecond, timers.Label{Name: "autostart.staging_monitor"}) // Very frequent checking for test reliability
 	defer ticker.Stop()
 
 	for {
@@ -389,17 +437,14 @@ func (as *AutoStartSystem) monitorForFullStaging() {
 
 			// Only transition to staging if we have exactly 2 staged vehicles and haven't transitioned yet
 			if stagedCount == 2 && as.status.BothVehiclesStaged.IsZero() {
-				as.status.BothVehiclesStaged = time.Now()
+				as.status.BothVehiclesStaged = timers.Or(as.clock).Now()
 				as.status.State = StateStaging
 
 				// Cancel staging timeout since both are now staged
-				if as.stagingTimer != nil {
-					as.stagingTimer.Stop()
-					as.stagingTimer = nil
-				}
+				as.cancelStagingTimeout()
 
 				// Arm minimum staging timer
-				as.stagingTimer = time.AfterFunc(as.config.MinStagingDuration, func() {
+				as.stagingTimer = timers.Or(as.clock).AfterFunc(as.config.MinStagingDuration, timers.Label{Name: "autostart.min_staging"}, func() {
 					as.mu.Lock()
 					defer as.mu.Unlock()
 					if as.status.State == StateStaging {
@@ -415,21 +460,23 @@ func (as *AutoStartSystem) monitorForFullStaging() {
 // triggerTreeSequence initiates the Christmas tree sequence with random delay
 func (as *AutoStartSystem) triggerTreeSequence() {
 	// In test mode, use minimal delay to ensure reliable testing
-	var randomDelay time.Duration
+	var draw DelayDraw
 	if as.testMode {
-		randomDelay = 1 * time.Millisecond // Very short delay for tests
+		draw = DelayDraw{Algorithm: DelayFixed, Delay: 1 * time.Millisecond} // Very short delay for tests
 	} else {
-		randomDelay = as.calculateRandomDelay()
+		draw = as.drawRandomDelay()
 	}
+	draw.DrawnAt = timers.Or(as.clock).Now()
+	as.status.LastDelay = &draw
 
 	// Schedule tree trigger
-	time.AfterFunc(randomDelay, func() {
+	timers.Or(as.clock).AfterFunc(draw.Delay, timers.Label{Name: "autostart.random_delay"}, func() {
 		as.mu.Lock()
 		defer as.mu.Unlock()
 
 		if as.status.State == StateStaging {
 			as.status.State = StateTriggered
-			as.status.TreeTriggerTime = time.Now()
+			as.status.TreeTriggerTime = timers.Or(as.clock).Now()
 
 			// Trigger the tree sequence immediately (don't use goroutine for test reliability)
 			if as.onTreeTrigger != nil {
@@ -442,11 +489,16 @@ func (as *AutoStartSystem) triggerTreeSequence() {
 
 			// Publish tree triggered event
 			if as.eventBus != nil {
-				as.eventBus.Publish(events.NewEvent(events.EventTreeSequenceTriggered).Build())
+				as.eventBus.Publish(
+					events.NewEvent(events.EventTreeSequenceTriggered).
+						WithData("delay_algorithm", string(draw.Algorithm)).
+						WithData("delay_ms", float64(draw.Delay.Microseconds())/1000).
+						Build(),
+				)
 			}
 
 			// Reset to idle after successful trigger
-			time.AfterFunc(100*time.Millisecond, func() { // Shorter delay for tests
+			timers.Or(as.clock).AfterFunc(100*time.Millisecond, timers.Label{Name: "autostart.reset"}, func() { // Shorter delay for tests
 				as.mu.Lock()
 				defer as.mu.Unlock()
 				as.resetToIdle("Race completed")
@@ -455,16 +507,27 @@ func (as *AutoStartSystem) triggerTreeSequence() {
 	})
 }
 
-// calculateRandomDelay implements CompuLink's random delay algorithm
+// calculateRandomDelay draws a random delay with the system's strategy
 func (as *AutoStartSystem) calculateRandomDelay() time.Duration {
-	// Base random delay between min and max
-	baseRange := as.config.RandomDelayMax - as.config.RandomDelayMin
-	baseDelay := as.config.RandomDelayMin + time.Duration(as.randomSeed.Float64()*float64(baseRange))
-
-	// Add additional random variation
-	variation := time.Duration(as.randomSeed.Float64() * float64(as.config.RandomVariation))
-
-	return baseDelay + variation
+	return as.drawRandomDelay().Delay
+}
+
+// drawRandomDelay draws a random delay with the strategy set by
+// SetDelayStrategy, or else the configured algorithm's. An unknown
+// algorithm, which a validated profile cannot carry, draws uniformly.
+func (as *AutoStartSystem) drawRandomDelay() DelayDraw {
+	strategy := as.delayStrategy
+	if strategy == nil {
+		var err error
+		if strategy, err = DelayStrategyFor(as.config.DelayAlgorithm); err != nil {
+			as.log().Warn("Unknown delay algorithm, drawing the random delay uniformly", "error", err)
+			strategy = UniformDelay{}
+		}
+	}
+	return DelayDraw{
+		Algorithm: strategy.Algorithm(),
+		Delay:     strategy.Draw(as.randomSeed, as.config),
+	}
 }
 
 // triggerFault handles safety violations and system faults
@@ -474,10 +537,7 @@ func (as *AutoStartSystem) triggerFault(reason string) {
 	as.status.LastFaultReason = reason
 
 	// Cancel timer
-	if as.stagingTimer != nil {
-		as.stagingTimer.Stop()
-		as.stagingTimer = nil
-	}
+	as.cancelStagingTimeout()
 
 	if as.onFault != nil {
 		go as.onFault(reason)
@@ -511,10 +571,7 @@ func (as *AutoStartSystem) resetToIdle(reason string) {
 	}
 
 	// Cancel timer
-	if as.stagingTimer != nil {
-		as.stagingTimer.Stop()
-		as.stagingTimer = nil
-	}
+	as.cancelStagingTimeout()
 
 	if as.onStateChange != nil {
 		go as.onStateChange(oldState, StateIdle)
@@ -578,6 +635,16 @@ func (as *AutoStartSystem) SetFaultHandler(handler func(reason string)) {
 	as.onFault = handler
 }
 
+// SetStagingTimeoutHandler sets the callback for each lane red-lighted for
+// failing to stage in time, with the staging time elapsed, to record the
+// foul in the race's timing results. It runs on the staging timer once the
+// lane's red bulb is lit, so it need not light it.
+func (as *AutoStartSystem) SetStagingTimeoutHandler(handler func(lane int, elapsed time.Duration)) {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	as.onTimeout = handler
+}
+
 // SetStateChangeHandler sets the callback for state changes
 func (as *AutoStartSystem) SetStateChangeHandler(handler func(oldState, newState AutoStartState)) {
 	as.mu.Lock()
@@ -585,7 +652,41 @@ func (as *AutoStartSystem) SetStateChangeHandler(handler func(oldState, newState
 	as.onStateChange = handler
 }
 
+// SetDelayStrategy draws the random delay with strategy instead of the
+// configured DelayAlgorithm's, for strategies outside the built-in ones.
+// Nil goes back to the configured algorithm.
+func (as *AutoStartSystem) SetDelayStrategy(strategy DelayStrategy) {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	as.delayStrategy = strategy
+}
+
+// SetClock runs the auto-start system on clock instead of the default
+// wheel. Call it before the system starts.
+func (as *AutoStartSystem) SetClock(clock timers.Clock) {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	as.clock = clock
+}
+
+// SetLogger logs the auto-start system's faults and warnings to logger
+// instead of logs.Default. Call it before the system starts.
+func (as *AutoStartSystem) SetLogger(logger *slog.Logger) {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	as.logger = logger
+}
+
+// log returns the auto-start system's logger. Callers need not hold as.mu,
+// as the logger is set before the system starts.
+func (as *AutoStartSystem) log() *slog.Logger {
+	return logs.For(as.logger, "autostart", "")
+}
+
 // SetTestMode enables fast execution for testing
+//
+// Deprecated: run the system on a virtual clock (SetClock with
+// timers.NewVirtualWheel) to skip the random delay deterministically.
 func (as *AutoStartSystem) SetTestMode(enabled bool) {
 	as.mu.Lock()
 	defer as.mu.Unlock()
@@ -633,24 +734,180 @@ func (as *AutoStartSystem) countStaged() int {
 
 // startSecondStageTimeout starts the timeout for the second vehicle to stage.
 func (as *AutoStartSystem) startSecondStageTimeout() {
-	as.stagingTimer = time.AfterFunc(as.config.StagingTimeout, func() {
+	as.cancelStagingTimeout() // Activation on the first stage starts it already
+	as.startTimeoutWarnings()
+	as.startCountdown()
+	as.stagingTimer = timers.Or(as.clock).AfterFunc(as.config.StagingTimeout, timers.Label{Name: "autostart.staging_timeout"}, func() {
 		as.mu.Lock()
-		defer as.mu.Unlock()
 		if as.status.State != StateActivated { // Only fault if still waiting
+			as.mu.Unlock()
 			return
 		}
-		// Find unstaged lane
-		var timedOutLane int
-		for lane, staging := range as.status.VehicleStaging {
-			if !staging.Staged {
-				timedOutLane = lane
-				break
+		lanes, elapsed := as.stagingTimedOut()
+		onTimeout := as.onTimeout
+		as.mu.Unlock()
+
+		// Record the fouls on the timer, so they are in the timing results
+		// before the clock moves on
+		if onTimeout != nil {
+			for _, lane := range lanes {
+				onTimeout(lane, elapsed)
 			}
 		}
-		as.triggerFault(fmt.Sprintf("Staging timeout for lane %d", timedOutLane))
-		// Publish staging timeout foul event
+	})
+}
+
+// stagingTimedOut red-lights each lane still to stage when the staging
+// timeout runs out: its red bulb is lit and autostart.staging_timeout_foul
+// is published with the staging time elapsed. It returns the lanes and the
+// time elapsed for the timeout handler, which the caller runs once as.mu is
+// released to record the fouls in the timing results. Must be called with
+// as.mu held.
+func (as *AutoStartSystem) stagingTimedOut() ([]int, time.Duration) {
+	lanes := as.lanesToStage()
+	if len(lanes) == 0 {
+		return nil, 0
+	}
+	elapsed := timers.Or(as.clock).Now().Sub(as.status.CountdownStarted)
+	as.triggerFault(fmt.Sprintf("Staging timeout for lane %d", lanes[0]))
+
+	for _, lane := range lanes {
+		if as.tree != nil {
+			as.tree.SetRedLight(lane)
+		}
 		if as.eventBus != nil {
-			as.eventBus.Publish(events.NewEvent(events.EventStagingTimeoutFoul).WithLane(timedOutLane).Build())
+			as.eventBus.Publish(
+				events.NewEvent(events.EventStagingTimeoutFoul).
+					WithLane(lane).
+					WithData("elapsed_ms", elapsed.Milliseconds()).
+					WithData("timeout_ms", as.config.StagingTimeout.Milliseconds()).
+					Build(),
+			)
 		}
-	})
+	}
+	return lanes, elapsed
+}
+
+// startTimeoutWarnings schedules the escalating warnings for lanes still to
+// stage, publishing autostart.staging_timeout_warning at each of the
+// configured fractions of the staging timeout
+func (as *AutoStartSystem) startTimeoutWarnings() {
+	for i, fraction := range as.config.TimeoutWarnings {
+		if fraction <= 0 || fraction >= 1 {
+			continue
+		}
+		level, fraction := i+1, fraction
+		at := time.Duration(fraction * float64(as.config.StagingTimeout))
+		remaining := as.config.StagingTimeout - at
+		flash := as.config.StageFlashLevel > 0 && level >= as.config.StageFlashLevel
+		timer := timers.Or(as.clock).AfterFunc(at, timers.Label{Name: "autostart.timeout_warning"}, func() {
+			as.mu.Lock()
+			defer as.mu.Unlock()
+			if as.status.State != StateActivated || as.eventBus == nil {
+				return
+			}
+			for lane, staging := range as.status.VehicleStaging {
+				if staging.Staged {
+					continue
+				}
+				as.eventBus.Publish(
+					events.NewEvent(events.EventStagingTimeoutWarning).
+						WithLane(lane).
+						WithData("level", level).
+						WithData("final", level == len(as.config.TimeoutWarnings)).
+						WithData("fraction", fraction).
+						WithData("remaining", remaining.Seconds()).
+						WithData("flash_stage", flash).
+						Build(),
+				)
+			}
+		})
+		as.warningTimers = append(as.warningTimers, timer)
+	}
+}
+
+// startCountdown publishes autostart.countdown_started, then
+// autostart.countdown_tick every CountdownTick with the staging clock's
+// remaining time while lanes are still to stage. Ticks are scheduled from
+// the start, so the remaining times are exact multiples of the tick.
+func (as *AutoStartSystem) startCountdown() {
+	clock := timers.Or(as.clock)
+	timeout := as.config.StagingTimeout
+	tick := as.config.CountdownTick
+	if tick <= 0 {
+		tick = DefaultCountdownTick
+	}
+	started := clock.Now()
+	as.countdownGen++
+	gen := as.countdownGen
+	as.status.CountdownStarted = started
+	as.status.CountdownRemaining = timeout
+
+	if as.eventBus != nil {
+		as.eventBus.Publish(
+			events.NewEvent(events.EventAutoStartCountdownStarted).
+				WithData("timeout_ms", timeout.Milliseconds()).
+				WithData("remaining_ms", timeout.Milliseconds()).
+				WithData("lanes", as.lanesToStage()).
+				Build(),
+		)
+	}
+
+	var next func(n int)
+	next = func(n int) {
+		elapsed := time.Duration(n) * tick
+		if elapsed >= timeout {
+			return // The staging timeout takes it from here
+		}
+		as.countdown = clock.AfterFunc(started.Add(elapsed).Sub(clock.Now()), timers.Label{Name: "autostart.countdown"}, func() {
+			as.mu.Lock()
+			defer as.mu.Unlock()
+			if as.countdownGen != gen || as.status.State != StateActivated {
+				return
+			}
+			remaining := timeout - elapsed
+			as.status.CountdownRemaining = remaining
+			if as.eventBus != nil {
+				as.eventBus.Publish(
+					events.NewEvent(events.EventAutoStartCountdownTick).
+						WithData("remaining_ms", remaining.Milliseconds()).
+						WithData("elapsed_ms", elapsed.Milliseconds()).
+						WithData("lanes", as.lanesToStage()).
+						Build(),
+				)
+			}
+			next(n + 1)
+		})
+	}
+	next(1)
+}
+
+// lanesToStage returns the lanes not yet staged, in order
+func (as *AutoStartSystem) lanesToStage() []int {
+	lanes := make([]int, 0, len(as.status.VehicleStaging))
+	for lane, staging := range as.status.VehicleStaging {
+		if !staging.Staged {
+			lanes = append(lanes, lane)
+		}
+	}
+	sort.Ints(lanes)
+	return lanes
+}
+
+// cancelStagingTimeout stops the staging timeout, its pending warnings and
+// the staging clock
+func (as *AutoStartSystem) cancelStagingTimeout() {
+	if as.stagingTimer != nil {
+		as.stagingTimer.Stop()
+		as.stagingTimer = nil
+	}
+	for _, timer := range as.warningTimers {
+		timer.Stop()
+	}
+	as.warningTimers = nil
+	if as.countdown != nil {
+		as.countdown.Stop()
+		as.countdown = nil
+	}
+	as.countdownGen++
 }
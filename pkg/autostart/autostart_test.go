@@ -2,12 +2,15 @@ package autostart
 
 import (
 	"context"
+	"math/rand"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/benharold/libdrag/pkg/config"
 	"github.com/benharold/libdrag/pkg/events"
+	"github.com/benharold/libdrag/pkg/timers"
 	"github.com/benharold/libdrag/pkg/tree"
 )
 
@@ -340,15 +343,20 @@ func TestAutoStartSystem_EventHandlers(t *testing.T) {
 		t.Fatalf("Failed to start: %v", err)
 	}
 
-	// Track events
+	// Track events; handlers run on their own goroutines
+	var mu sync.Mutex
 	var stateChanges []AutoStartState
 	var faultReasons []string
 
 	system.SetStateChangeHandler(func(oldState, newState AutoStartState) {
+		mu.Lock()
+		defer mu.Unlock()
 		stateChanges = append(stateChanges, newState)
 	})
 
 	system.SetFaultHandler(func(reason string) {
+		mu.Lock()
+		defer mu.Unlock()
 		faultReasons = append(faultReasons, reason)
 	})
 
@@ -357,6 +365,9 @@ func TestAutoStartSystem_EventHandlers(t *testing.T) {
 
 	time.Sleep(10 * time.Millisecond) // Allow event processing
 
+	mu.Lock()
+	defer mu.Unlock()
+
 	// Verify events were triggered
 	if len(stateChanges) == 0 {
 		t.Error("Expected state change events")
@@ -554,3 +565,353 @@ func TestAutoStartSystem_SecondStageTimeoutAndCancel(t *testing.T) {
 		}
 	})
 }
+
+func TestAutoStartSystem_ActivationPolicies(t *testing.T) {
+	type update struct {
+		lane              int
+		preStaged, staged bool
+	}
+	tests := []struct {
+		name       string
+		policy     ActivationPolicy
+		idle       []update // Updates that must not activate
+		activating update
+	}{
+		{
+			name:       "three bulb",
+			policy:     ActivationThreeBulb,
+			idle:       []update{{1, true, false}, {1, true, true}},
+			activating: update{2, true, false},
+		},
+		{
+			name:       "first stage",
+			policy:     ActivationFirstStage,
+			idle:       []update{{1, true, false}, {2, true, false}, {2, false, false}},
+			activating: update{1, true, true},
+		},
+		{
+			name:       "both pre-staged",
+			policy:     ActivationBothPreStaged,
+			idle:       []update{{1, true, false}, {2, false, false}},
+			activating: update{2, true, false},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			system := NewAutoStartSystem(events.NewEventBus(false))
+			christmasTree := tree.NewChristmasTree()
+			cfg := config.NewDefaultConfig()
+			if err := system.Initialize(context.Background(), cfg); err != nil {
+				t.Fatalf("Failed to initialize: %v", err)
+			}
+			if err := christmasTree.Initialize(context.Background(), cfg); err != nil {
+				t.Fatalf("Failed to initialize tree: %v", err)
+			}
+			system.SetTestMode(true)
+			autoConfig := system.GetConfiguration()
+			autoConfig.ActivationPolicy = tt.policy
+			system.UpdateConfiguration(autoConfig)
+			if err := system.Start(context.Background()); err != nil {
+				t.Fatalf("Failed to start: %v", err)
+			}
+			system.SetTreeComponent(christmasTree)
+			if err := christmasTree.Arm(context.Background()); err != nil {
+				t.Fatalf("Failed to arm tree: %v", err)
+			}
+
+			for _, u := range tt.idle {
+				system.UpdateVehicleStaging(u.lane, u.preStaged, u.staged, 0)
+				if state := system.GetAutoStartStatus().State; state != StateIdle {
+					t.Fatalf("Expected StateIdle after %+v, got %v", u, state)
+				}
+			}
+			system.UpdateVehicleStaging(tt.activating.lane, tt.activating.preStaged, tt.activating.staged, 0)
+			if state := system.GetAutoStartStatus().State; state != StateActivated {
+				t.Fatalf("Expected StateActivated after %+v, got %v", tt.activating, state)
+			}
+
+			// The staging clock runs from activation; nobody else stages in time
+			time.Sleep(80 * time.Millisecond)
+			if state := system.GetAutoStartStatus().State; state != StateFault {
+				t.Errorf("Expected staging timeout fault, got %v", state)
+			}
+		})
+	}
+}
+
+func TestAutoStartSystem_StagingTimeoutWarnings(t *testing.T) {
+	wheel := timers.NewVirtualWheel(time.Date(2025, time.June, 7, 18, 0, 0, 0, time.UTC), timers.DefaultTick)
+	defer timers.SetDefault(wheel)()
+
+	eventBus := events.NewEventBus(false)
+	var log []events.Event
+	eventBus.Subscribe(events.EventStagingTimeoutWarning, func(e events.Event) { log = append(log, e) })
+	eventBus.Subscribe(events.EventStagingTimeoutFoul, func(e events.Event) { log = append(log, e) })
+
+	system := NewAutoStartSystem(eventBus)
+	christmasTree := tree.NewChristmasTree()
+	cfg := config.NewDefaultConfig()
+	if err := system.Initialize(context.Background(), cfg); err != nil {
+		t.Fatalf("Failed to initialize: %v", err)
+	}
+	if err := christmasTree.Initialize(context.Background(), cfg); err != nil {
+		t.Fatalf("Failed to initialize tree: %v", err)
+	}
+	system.Start(context.Background())
+	system.SetTreeComponent(christmasTree)
+	christmasTree.Arm(context.Background())
+
+	// Sportsman: 10 s to stage, warned at 50% and 80%
+	system.UpdateVehicleStaging(1, true, false, 0)
+	system.UpdateVehicleStaging(2, true, false, 0)
+	system.UpdateVehicleStaging(1, true, true, 0)
+
+	wheel.Advance(4900 * time.Millisecond)
+	if len(log) != 0 {
+		t.Fatalf("Expected no warning before half the timeout, got %d events", len(log))
+	}
+	wheel.Advance(200 * time.Millisecond)
+	if len(log) != 1 || log[0].Lane != 2 || log[0].Data["level"] != 1 || log[0].Data["remaining"] != 5.0 {
+		t.Fatalf("Expected the first warning for lane 2, got %+v", log)
+	}
+	wheel.Advance(3 * time.Second)
+	if len(log) != 2 || log[1].Data["level"] != 2 || log[1].Data["final"] != true {
+		t.Fatalf("Expected the final warning at 80%%, got %+v", log)
+	}
+	wheel.Advance(2 * time.Second)
+	if len(log) != 3 || log[2].Type != events.EventStagingTimeoutFoul || log[2].Lane != 2 {
+		t.Fatalf("Expected the timeout foul after the warnings, got %+v", log)
+	}
+
+	// Staging in time cancels the warnings still to come
+	system.resetToIdle("Test reset")
+	christmasTree.DisarmTree()
+	system.Start(context.Background())
+	christmasTree.Arm(context.Background())
+	log = nil
+
+	system.UpdateVehicleStaging(1, true, false, 0)
+	system.UpdateVehicleStaging(2, true, false, 0)
+	system.UpdateVehicleStaging(1, true, true, 0)
+	wheel.Advance(6 * time.Second)
+	system.UpdateVehicleStaging(2, true, true, 0)
+	// Let the staging monitor goroutine see both lanes staged
+	for i := 0; i < 100 && system.GetAutoStartStatus().State == StateActivated; i++ {
+		wheel.Advance(5 * time.Millisecond)
+		time.Sleep(time.Millisecond)
+	}
+	wheel.Advance(5 * time.Second)
+	if len(log) != 1 {
+		t.Errorf("Expected only the first warning once lane 2 staged, got %+v", log)
+	}
+}
+
+func TestAutoStartSystem_CountdownEvents(t *testing.T) {
+	wheel := timers.NewVirtualWheel(time.Date(2025, time.June, 7, 18, 0, 0, 0, time.UTC), timers.DefaultTick)
+	defer timers.SetDefault(wheel)()
+
+	eventBus := events.NewEventBus(false)
+	var log []events.Event
+	eventBus.Subscribe(events.EventAutoStartCountdownStarted, func(e events.Event) { log = append(log, e) })
+	eventBus.Subscribe(events.EventAutoStartCountdownTick, func(e events.Event) { log = append(log, e) })
+
+	system := NewAutoStartSystem(eventBus)
+	christmasTree := tree.NewChristmasTree()
+	cfg := config.NewDefaultConfig()
+	if err := system.Initialize(context.Background(), cfg); err != nil {
+		t.Fatalf("Failed to initialize: %v", err)
+	}
+	if err := christmasTree.Initialize(context.Background(), cfg); err != nil {
+		t.Fatalf("Failed to initialize tree: %v", err)
+	}
+	system.Start(context.Background())
+	system.SetTreeComponent(christmasTree)
+	christmasTree.Arm(context.Background())
+
+	// Sportsman: a 10 s staging clock, counted down each second
+	system.UpdateVehicleStaging(1, true, false, 0)
+	system.UpdateVehicleStaging(2, true, false, 0)
+	system.UpdateVehicleStaging(1, true, true, 0)
+	if len(log) != 1 || log[0].Type != events.EventAutoStartCountdownStarted || log[0].Data["timeout_ms"] != int64(10000) {
+		t.Fatalf("Expected one countdown start with a 10 s clock, got %+v", log)
+	}
+	if lanes, _ := log[0].Data["lanes"].([]int); len(lanes) != 1 || lanes[0] != 2 {
+		t.Errorf("Expected lane 2 still to stage, got %v", log[0].Data["lanes"])
+	}
+
+	wheel.Advance(3500 * time.Millisecond)
+	if len(log) != 4 {
+		t.Fatalf("Expected 3 ticks after 3.5 s, got %+v", log)
+	}
+	for i, want := range []int64{9000, 8000, 7000} {
+		if got := log[i+1].Data["remaining_ms"]; got != want {
+			t.Errorf("Expected tick %d at %d ms remaining, got %v", i+1, want, got)
+		}
+	}
+	if system.GetAutoStartStatus().CountdownRemaining != 7*time.Second {
+		t.Errorf("Expected the status to count down too, got %v", system.GetAutoStartStatus().CountdownRemaining)
+	}
+
+	// Staging the second lane stops the clock
+	system.UpdateVehicleStaging(2, true, true, 0)
+	for i := 0; i < 100 && system.GetAutoStartStatus().State == StateActivated; i++ {
+		wheel.Advance(5 * time.Millisecond)
+		time.Sleep(time.Millisecond)
+	}
+	ticks := len(log)
+	wheel.Advance(3 * time.Second)
+	if len(log) != ticks {
+		t.Errorf("Expected no ticks once both lanes staged, got %+v", log[ticks:])
+	}
+}
+
+func TestAutoStartSystem_DelayStrategies(t *testing.T) {
+	cfg := ClassPreset("Sportsman")
+	cfg.DelayTables = map[string][]time.Duration{"Sportsman": {700 * time.Millisecond, 900 * time.Millisecond}}
+	rng := rand.New(rand.NewSource(1))
+	lo, hi := cfg.RandomDelayMin, cfg.RandomDelayMax+cfg.RandomVariation
+
+	for _, algorithm := range []DelayAlgorithm{DelayUniform, DelayTruncatedNormal, DelayClassTable, DelayFixed} {
+		strategy, err := DelayStrategyFor(algorithm)
+		if err != nil {
+			t.Fatalf("Expected a strategy for %s: %v", algorithm, err)
+		}
+		if strategy.Algorithm() != algorithm {
+			t.Errorf("Expected the %s strategy to name itself, got %s", algorithm, strategy.Algorithm())
+		}
+		for i := 0; i < 200; i++ {
+			delay := strategy.Draw(rng, cfg)
+			if delay < lo || delay > hi {
+				t.Fatalf("%s: delay %v outside %v-%v", algorithm, delay, lo, hi)
+			}
+			switch algorithm {
+			case DelayFixed:
+				if delay != cfg.RandomDelayMin {
+					t.Fatalf("Expected the fixed delay to be the minimum, got %v", delay)
+				}
+			case DelayClassTable:
+				if delay != 700*time.Millisecond && delay != 900*time.Millisecond {
+					t.Fatalf("Expected a delay from the class's table, got %v", delay)
+				}
+			}
+		}
+	}
+	if _, err := DelayStrategyFor("coin_flip"); err == nil {
+		t.Error("Expected an unknown algorithm to be rejected")
+	}
+
+	profile := Profile{Name: "Coin Flip", Config: cfg}
+	profile.Config.DelayAlgorithm = "coin_flip"
+	if err := profile.Validate(); err == nil {
+		t.Error("Expected a profile with an unknown delay algorithm to be invalid")
+	}
+}
+
+func TestAutoStartSystem_DelayRecordedPerRun(t *testing.T) {
+	wheel := timers.NewVirtualWheel(time.Date(2025, time.June, 7, 18, 0, 0, 0, time.UTC), timers.DefaultTick)
+	defer timers.SetDefault(wheel)()
+
+	eventBus := events.NewEventBus(false)
+	var triggered []events.Event
+	eventBus.Subscribe(events.EventTreeSequenceTriggered, func(e events.Event) { triggered = append(triggered, e) })
+
+	system := NewAutoStartSystem(eventBus)
+	christmasTree := tree.NewChristmasTree()
+	cfg := config.NewDefaultConfig()
+	if err := system.Initialize(context.Background(), cfg); err != nil {
+		t.Fatalf("Failed to initialize: %v", err)
+	}
+	if err := christmasTree.Initialize(context.Background(), cfg); err != nil {
+		t.Fatalf("Failed to initialize tree: %v", err)
+	}
+	autoConfig := system.GetConfiguration()
+	autoConfig.DelayAlgorithm = DelayFixed
+	autoConfig.RandomDelayMin = 800 * time.Millisecond
+	system.UpdateConfiguration(autoConfig)
+	system.Start(context.Background())
+	system.SetTreeComponent(christmasTree)
+	christmasTree.Arm(context.Background())
+
+	system.UpdateVehicleStaging(1, true, false, 0)
+	system.UpdateVehicleStaging(2, true, false, 0)
+	system.UpdateVehicleStaging(1, true, true, 0)
+	system.UpdateVehicleStaging(2, true, true, 0)
+	for i := 0; i < 500 && len(triggered) == 0; i++ {
+		wheel.Advance(5 * time.Millisecond)
+		time.Sleep(time.Millisecond)
+	}
+
+	if len(triggered) != 1 {
+		t.Fatalf("Expected the tree to be triggered once, got %d", len(triggered))
+	}
+	if triggered[0].Data["delay_algorithm"] != string(DelayFixed) || triggered[0].Data["delay_ms"] != 800.0 {
+		t.Errorf("Expected the fixed 800 ms delay on the trigger event, got %v", triggered[0].Data)
+	}
+	last := system.GetAutoStartStatus().LastDelay
+	if last == nil || last.Algorithm != DelayFixed || last.Delay != 800*time.Millisecond || last.DrawnAt.IsZero() {
+		t.Errorf("Expected the status to keep the drawn delay, got %+v", last)
+	}
+}
+
+func TestAutoStartSystem_StagingTimeoutRedLight(t *testing.T) {
+	wheel := timers.NewVirtualWheel(time.Date(2025, time.June, 7, 18, 0, 0, 0, time.UTC), timers.DefaultTick)
+	defer timers.SetDefault(wheel)()
+
+	eventBus := events.NewEventBus(false)
+	var fouls []events.Event
+	eventBus.Subscribe(events.EventStagingTimeoutFoul, func(e events.Event) { fouls = append(fouls, e) })
+
+	system := NewAutoStartSystem(eventBus)
+	christmasTree := tree.NewChristmasTree()
+	cfg := config.NewDefaultConfig()
+	if err := system.Initialize(context.Background(), cfg); err != nil {
+		t.Fatalf("Failed to initialize: %v", err)
+	}
+	if err := christmasTree.Initialize(context.Background(), cfg); err != nil {
+		t.Fatalf("Failed to initialize tree: %v", err)
+	}
+	type timeout struct {
+		lane    int
+		elapsed time.Duration
+	}
+	timeouts := make(chan timeout, 2)
+	system.SetStagingTimeoutHandler(func(lane int, elapsed time.Duration) { timeouts <- timeout{lane, elapsed} })
+	system.Start(context.Background())
+	system.SetTreeComponent(christmasTree)
+	christmasTree.Arm(context.Background())
+
+	// Sportsman: lane 2 never stages in its 10 s
+	system.UpdateVehicleStaging(1, true, false, 0)
+	system.UpdateVehicleStaging(2, true, false, 0)
+	system.UpdateVehicleStaging(1, true, true, 0)
+	wheel.Advance(10 * time.Second)
+
+	if len(fouls) != 1 || fouls[0].Lane != 2 || fouls[0].Data["elapsed_ms"] != int64(10000) || fouls[0].Data["timeout_ms"] != int64(10000) {
+		t.Fatalf("Expected a timeout foul for lane 2 after 10 s, got %+v", fouls)
+	}
+	lights := christmasTree.GetTreeStatus().LightStates
+	if lights[2][tree.LightRed] != tree.LightOn || lights[1][tree.LightRed] == tree.LightOn {
+		t.Errorf("Expected only lane 2's red bulb lit, got %v and %v", lights[1], lights[2])
+	}
+	reds := 0
+	for _, change := range christmasTree.GetTreeStatus().Lanes[2].Transitions {
+		if change.Light == tree.LightRed && change.State == tree.LightOn {
+			reds++
+		}
+	}
+	if reds != 1 {
+		t.Errorf("Expected lane 2's red bulb lit once, got %d", reds)
+	}
+
+	// The handler runs on the staging timer, so the foul is recorded by the
+	// time the wheel has advanced past it
+	select {
+	case got := <-timeouts:
+		if got.lane != 2 || got.elapsed != 10*time.Second {
+			t.Errorf("Expected the handler called for lane 2 after 10 s, got %+v", got)
+		}
+	default:
+		t.Fatal("Expected the staging timeout handler called on the timer")
+	}
+}
@@ -0,0 +1,121 @@
+package autostart
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// DelayAlgorithm names how the random delay between both cars staging and
+// the tree firing is drawn
+type DelayAlgorithm string
+
+const (
+	DelayUniform         DelayAlgorithm = "uniform"          // RandomDelayMin to RandomDelayMax, plus up to RandomVariation (default)
+	DelayTruncatedNormal DelayAlgorithm = "truncated_normal" // Bell curve centered in the uniform range, never outside it
+	DelayClassTable      DelayAlgorithm = "class_table"      // One of the racing class's DelayTables entries
+	DelayFixed           DelayAlgorithm = "fixed"            // Always RandomDelayMin, for exhibitions
+)
+
+// DelayStrategy draws the random tree delay. Draw is called with the
+// auto-start system's lock held and its random source, and must not block.
+type DelayStrategy interface {
+	Algorithm() DelayAlgorithm
+	Draw(rng *rand.Rand, cfg AutoStartConfig) time.Duration
+}
+
+// DelayDraw is the delay drawn for one run, kept for checking afterwards
+// that the tree was fired fairly
+type DelayDraw struct {
+	Algorithm DelayAlgorithm `json:"algorithm"`
+	Delay     time.Duration  `json:"delay"`
+	DrawnAt   time.Time      `json:"drawn_at"`
+}
+
+// DelayStrategyFor returns the built-in strategy for an algorithm, the
+// uniform one for ""
+func DelayStrategyFor(algorithm DelayAlgorithm) (DelayStrategy, error) {
+	switch algorithm {
+	case "", DelayUniform:
+		return UniformDelay{}, nil
+	case DelayTruncatedNormal:
+		return TruncatedNormalDelay{}, nil
+	case DelayClassTable:
+		return ClassTableDelay{}, nil
+	case DelayFixed:
+		return FixedDelay{}, nil
+	default:
+		return nil, fmt.Errorf("unknown delay algorithm %q", algorithm)
+	}
+}
+
+// UniformDelay is CompuLink's delay: uniform between RandomDelayMin and
+// RandomDelayMax, plus a uniform share of RandomVariation
+type UniformDelay struct{}
+
+// Algorithm returns DelayUniform
+func (UniformDelay) Algorithm() DelayAlgorithm { return DelayUniform }
+
+// Draw returns a uniform delay
+func (UniformDelay) Draw(rng *rand.Rand, cfg AutoStartConfig) time.Duration {
+	base := cfg.RandomDelayMin + time.Duration(rng.Float64()*float64(cfg.RandomDelayMax-cfg.RandomDelayMin))
+	return base + time.Duration(rng.Float64()*float64(cfg.RandomVariation))
+}
+
+// TruncatedNormalDelay draws from a normal distribution centered in the
+// uniform delay's range, with a quarter of the range as its standard
+// deviation, redrawing values outside the range. Delays bunch toward the
+// middle, so the ends of the range are rarely long or short enough for a
+// driver to anticipate.
+type TruncatedNormalDelay struct{}
+
+// Algorithm returns DelayTruncatedNormal
+func (TruncatedNormalDelay) Algorithm() DelayAlgorithm { return DelayTruncatedNormal }
+
+// Draw returns a normal delay within RandomDelayMin and RandomDelayMax plus
+// RandomVariation
+func (TruncatedNormalDelay) Draw(rng *rand.Rand, cfg AutoStartConfig) time.Duration {
+	lo := float64(cfg.RandomDelayMin)
+	hi := float64(cfg.RandomDelayMax + cfg.RandomVariation)
+	if hi <= lo {
+		return cfg.RandomDelayMin
+	}
+	mean, stddev := (lo+hi)/2, (hi-lo)/4
+	// Over 95% of draws land in range; give up on a freak run of misses
+	// rather than loop with the lock held
+	for i := 0; i < 16; i++ {
+		if d := mean + rng.NormFloat64()*stddev; d >= lo && d <= hi {
+			return time.Duration(d)
+		}
+	}
+	return time.Duration(mean)
+}
+
+// ClassTableDelay picks one of the delays listed for the racing class in
+// DelayTables, each equally likely. A class without a table gets the
+// uniform delay.
+type ClassTableDelay struct{}
+
+// Algorithm returns DelayClassTable
+func (ClassTableDelay) Algorithm() DelayAlgorithm { return DelayClassTable }
+
+// Draw returns an entry of the class's table
+func (ClassTableDelay) Draw(rng *rand.Rand, cfg AutoStartConfig) time.Duration {
+	table := cfg.DelayTables[cfg.RacingClass]
+	if len(table) == 0 {
+		return UniformDelay{}.Draw(rng, cfg)
+	}
+	return table[rng.Intn(len(table))]
+}
+
+// FixedDelay always waits RandomDelayMin, for exhibitions and match races
+// where every run should leave on the same delay
+type FixedDelay struct{}
+
+// Algorithm returns DelayFixed
+func (FixedDelay) Algorithm() DelayAlgorithm { return DelayFixed }
+
+// Draw returns RandomDelayMin
+func (FixedDelay) Draw(_ *rand.Rand, cfg AutoStartConfig) time.Duration {
+	return cfg.RandomDelayMin
+}
@@ -3,11 +3,15 @@ package autostart
 import (
 	"context"
 	"fmt"
+	"log/slog"
 	"sync"
 	"time"
 
 	"github.com/benharold/libdrag/pkg/config"
 	"github.com/benharold/libdrag/pkg/events"
+	"github.com/benharold/libdrag/pkg/logs"
+	"github.com/benharold/libdrag/pkg/rules"
+	"github.com/benharold/libdrag/pkg/timers"
 	"github.com/benharold/libdrag/pkg/timing"
 	"github.com/benharold/libdrag/pkg/tree"
 )
@@ -19,6 +23,7 @@ type AutoStartIntegration struct {
 	christmasTree *tree.ChristmasTree
 	mu            sync.RWMutex
 	running       bool
+	rules         *rules.Engine // Nil uses rules.Default
 
 	// Beam monitoring
 	beamStates    map[string]*BeamState
@@ -145,15 +150,40 @@ func (asi *AutoStartIntegration) setupEventHandlers() {
 		asi.handleAutoStartFault(reason)
 	})
 
+	// Red-light lanes that fail to stage in time
+	asi.autoStart.SetStagingTimeoutHandler(func(lane int, elapsed time.Duration) {
+		asi.handleStagingTimeout(lane, elapsed)
+	})
+
 	// Handle state changes
 	asi.autoStart.SetStateChangeHandler(func(oldState, newState AutoStartState) {
 		asi.handleStateChange(oldState, newState)
 	})
+
+	// Flash the stage bulb of a lane running out of staging time, until it
+	// stages or the timeout is over
+	bus := asi.autoStart.eventBus
+	bus.Subscribe(events.EventStagingTimeoutWarning, asi.handleTimeoutWarning)
+	for _, eventType := range []events.EventType{events.EventAutoStartFault, events.EventAutoStartReset} {
+		bus.Subscribe(eventType, func(events.Event) {
+			if asi.christmasTree != nil {
+				asi.christmasTree.StopStageFlash()
+			}
+		})
+	}
+}
+
+// handleTimeoutWarning flashes the stage bulb of a warned lane when the
+// class's configuration asks for it
+func (asi *AutoStartIntegration) handleTimeoutWarning(event events.Event) {
+	if flash, _ := event.Data["flash_stage"].(bool); flash && asi.christmasTree != nil {
+		asi.christmasTree.FlashStage(event.Lane)
+	}
 }
 
 // monitorTimingBeams watches for beam state changes and updates auto-start
 func (asi *AutoStartIntegration) monitorTimingBeams(ctx context.Context) {
-	ticker := time.NewTicker(10 * time.Millisecond) // High frequency monitoring
+	ticker := timers.Or(asi.autoStart.clock).NewTicker(10*time.Millisecond, timers.Label{Name: "autostart.beam_monitor"}) // High frequency monitoring
 	defer ticker.Stop()
 
 	for {
@@ -246,16 +276,25 @@ func (asi *AutoStartIntegration) triggerChristmasTree() error {
 // handleAutoStartFault processes fault conditions
 func (asi *AutoStartIntegration) handleAutoStartFault(reason string) {
 	// Log the fault
-	fmt.Printf("Auto-start fault: %s\n", reason)
+	asi.autoStart.log().Warn("Auto-start fault", "reason", reason)
+
+	// Staging timeouts are recorded in handleStagingTimeout; other faults
+	// leave the tree to the starter
+}
 
-	// Handle fault by resetting tree to safe state
-	// The existing tree interface doesn't have red light methods,
-	// so we'll handle this through state management
+// handleStagingTimeout records a staging timeout red light in the timing
+// results; the auto-start system has lit the lane's red bulb
+func (asi *AutoStartIntegration) handleStagingTimeout(lane int, elapsed time.Duration) {
+	if asi.timingSystem != nil {
+		if err := asi.timingSystem.StagingTimeoutFoul(lane, elapsed, timers.Or(asi.autoStart.clock).Now()); err != nil {
+			asi.autoStart.log().Warn("Staging timeout foul not recorded", logs.KeyLane, lane, "error", err)
+		}
+	}
 }
 
 // handleStateChange processes auto-start state transitions
 func (asi *AutoStartIntegration) handleStateChange(oldState, newState AutoStartState) {
-	fmt.Printf("Auto-start state change: %s -> %s\n", oldState, newState)
+	asi.autoStart.log().Debug("Auto-start state change", "from", oldState, "to", newState)
 
 	// The existing Christmas tree manages its own armed state
 	// based on vehicle staging, so we don't need to call SetArmed
@@ -295,32 +334,48 @@ func (asi *AutoStartIntegration) GetStatus() map[string]interface{} {
 	}
 }
 
-// UpdateRacingClass adjusts auto-start parameters for different racing classes
+// SetRules looks class rules up in engine instead of rules.Default, for
+// the integration and its tree
+func (asi *AutoStartIntegration) SetRules(engine *rules.Engine) {
+	asi.mu.Lock()
+	asi.rules = engine
+	asi.mu.Unlock()
+	if asi.christmasTree != nil {
+		asi.christmasTree.SetRules(engine)
+	}
+}
+
+// UpdateRacingClass adjusts auto-start parameters to a racing class's
+// rules. A class the rules engine does not know only changes the class.
 func (asi *AutoStartIntegration) UpdateRacingClass(class string) {
+	asi.mu.RLock()
+	engine := asi.rules
+	asi.mu.RUnlock()
 	autoConfig := asi.autoStart.GetConfiguration()
 
-	switch class {
-	case "Top Fuel", "Funny Car", "Pro Stock":
-		autoConfig.StagingTimeout = 7 * time.Second
-		autoConfig.MinStagingDuration = 500 * time.Millisecond
-		autoConfig.TreeSequenceType = config.TreeSequencePro
-		autoConfig.RandomDelayMin = 600 * time.Millisecond
-		autoConfig.RandomDelayMax = 1100 * time.Millisecond
-	case "Pro Modified", "Pro Stock Motorcycle":
-		autoConfig.StagingTimeout = 10 * time.Second
-		autoConfig.MinStagingDuration = 500 * time.Millisecond
-		autoConfig.TreeSequenceType = config.TreeSequencePro
-	case "Bracket", "Super Class":
-		autoConfig.StagingTimeout = 15 * time.Second
-		autoConfig.MinStagingDuration = 600 * time.Millisecond
-		autoConfig.TreeSequenceType = config.TreeSequenceSportsman
-		autoConfig.RandomDelayMin = 600 * time.Millisecond
-		autoConfig.RandomDelayMax = 1400 * time.Millisecond
-	case "Junior Dragster":
-		autoConfig.StagingTimeout = 15 * time.Second
-		autoConfig.MinStagingDuration = 1000 * time.Millisecond
-		autoConfig.TreeSequenceType = config.TreeSequenceSportsman
-		autoConfig.EnabledForTimeTrials = true // More forgiving for learning
+	if classRules, ok := rules.Or(engine).Class(class); ok {
+		autoConfig.TreeSequenceType = classRules.Tree
+		// The class's tree preset sets the random delay window, unless the
+		// class's auto-start timing gives its own
+		if preset, err := config.TreePresetConfig(classRules.TreePreset); err == nil && preset.ArmDelayMax > 0 {
+			autoConfig.RandomDelayMin, autoConfig.RandomDelayMax = preset.ArmDelayMin, preset.ArmDelayMax
+		}
+		timing := classRules.AutoStart
+		if timing.StagingTimeout > 0 {
+			autoConfig.StagingTimeout = timing.StagingTimeout
+		}
+		if timing.MinStagingDuration > 0 {
+			autoConfig.MinStagingDuration = timing.MinStagingDuration
+		}
+		if timing.RandomDelayMin > 0 {
+			autoConfig.RandomDelayMin = timing.RandomDelayMin
+		}
+		if timing.RandomDelayMax > 0 {
+			autoConfig.RandomDelayMax = timing.RandomDelayMax
+		}
+		if timing.EnabledForTimeTrials {
+			autoConfig.EnabledForTimeTrials = true
+		}
 	}
 
 	autoConfig.RacingClass = class
@@ -334,11 +389,23 @@ func (asi *AutoStartIntegration) SimulateBeamTrigger(beamID string, triggered bo
 
 	if beamState, exists := asi.beamStates[beamID]; exists {
 		beamState.IsTriggered = triggered
-		beamState.LastChange = time.Now()
+		beamState.LastChange = timers.Or(asi.autoStart.clock).Now()
 	}
 }
 
+// SetClock runs the auto-start system on clock instead of the default wheel
+func (asi *AutoStartIntegration) SetClock(clock timers.Clock) {
+	asi.autoStart.SetClock(clock)
+}
+
+// SetLogger logs the auto-start system to logger instead of logs.Default
+func (asi *AutoStartIntegration) SetLogger(logger *slog.Logger) {
+	asi.autoStart.SetLogger(logger)
+}
+
 // SetTestMode enables test mode for accelerated timing
+//
+// Deprecated: use SetClock with a virtual clock.
 func (asi *AutoStartIntegration) SetTestMode(enabled bool) {
 	asi.autoStart.SetTestMode(enabled)
 }
@@ -7,6 +7,8 @@ import (
 
 	"github.com/benharold/libdrag/pkg/config"
 	"github.com/benharold/libdrag/pkg/events"
+	"github.com/benharold/libdrag/pkg/rules"
+	"github.com/benharold/libdrag/pkg/timers"
 	"github.com/benharold/libdrag/pkg/tree"
 )
 
@@ -108,3 +110,128 @@ func TestThreeBeamAutomaticArming(t *testing.T) {
 	t.Logf("   • Auto-start state: %v", status.State)
 	t.Logf("   • Tree armed: %v", christmasTree.IsArmed())
 }
+
+func TestStageBulbFlashOnTimeoutWarning(t *testing.T) {
+	wheel := timers.NewVirtualWheel(time.Date(2025, time.June, 7, 18, 0, 0, 0, time.UTC), timers.DefaultTick)
+	defer timers.SetDefault(wheel)()
+
+	christmasTree := tree.NewChristmasTree()
+	integration := NewAutoStartIntegration(nil, christmasTree)
+	autoStart := integration.GetAutoStartSystem()
+	cfg := config.NewDefaultConfig()
+	if err := integration.Initialize(context.Background(), cfg); err != nil {
+		t.Fatalf("Failed to initialize: %v", err)
+	}
+	if err := christmasTree.Initialize(context.Background(), cfg); err != nil {
+		t.Fatalf("Failed to initialize tree: %v", err)
+	}
+	autoStart.Start(context.Background())
+	autoStart.SetTreeComponent(christmasTree)
+	christmasTree.Arm(context.Background())
+
+	stageBulb := func(lane int) tree.LightState {
+		return christmasTree.GetTreeStatus().LightStates[lane][tree.LightStage]
+	}
+	stage := func(lane int, preStaged, staged bool) {
+		christmasTree.SetPreStage(lane, preStaged)
+		christmasTree.SetStage(lane, staged)
+		autoStart.UpdateVehicleStaging(lane, preStaged, staged, 0)
+	}
+
+	// Sportsman flashes from the first warning, at half the 10 s timeout
+	stage(1, true, false)
+	stage(2, true, false)
+	stage(1, true, true)
+	wheel.Advance(4900 * time.Millisecond)
+	if stageBulb(2) != tree.LightOff {
+		t.Fatalf("Expected lane 2's stage bulb dark before the warning, got %s", stageBulb(2))
+	}
+	wheel.Advance(200 * time.Millisecond)
+	if stageBulb(2) != tree.LightBlink || stageBulb(1) != tree.LightOn {
+		t.Fatalf("Expected only lane 2's stage bulb to flash, got %s and %s", stageBulb(1), stageBulb(2))
+	}
+
+	// The timeout foul ends the flash
+	wheel.Advance(5 * time.Second)
+	if autoStart.GetAutoStartStatus().State != StateFault || stageBulb(2) != tree.LightOff {
+		t.Fatalf("Expected the flash to stop at the timeout foul, got %s", stageBulb(2))
+	}
+
+	// Staging lights the bulb steady
+	autoStart.resetToIdle("Test reset")
+	christmasTree.DisarmTree()
+	autoStart.Start(context.Background())
+	christmasTree.Arm(context.Background())
+	stage(1, true, false)
+	stage(2, true, false)
+	stage(1, true, true)
+	wheel.Advance(6 * time.Second)
+	if stageBulb(2) != tree.LightBlink {
+		t.Fatalf("Expected lane 2's stage bulb to flash, got %s", stageBulb(2))
+	}
+	christmasTree.SetStage(2, true)
+	if stageBulb(2) != tree.LightOn {
+		t.Errorf("Expected lane 2's stage bulb lit once staged, got %s", stageBulb(2))
+	}
+
+	// Classes can turn the flash off
+	autoStart.resetToIdle("Test reset")
+	christmasTree.DisarmTree()
+	stage(2, true, false)
+	noFlash := autoStart.GetConfiguration()
+	noFlash.StageFlashLevel = 0
+	autoStart.UpdateConfiguration(noFlash)
+	autoStart.Start(context.Background())
+	christmasTree.Arm(context.Background())
+	stage(1, true, false)
+	stage(2, true, false)
+	stage(1, true, true)
+	wheel.Advance(9 * time.Second)
+	if stageBulb(2) != tree.LightOff {
+		t.Errorf("Expected no flash with the stage flash off, got %s", stageBulb(2))
+	}
+}
+
+func TestUpdateRacingClassFromRules(t *testing.T) {
+	integration := NewAutoStartIntegration(nil, tree.NewChristmasTree())
+	if err := integration.Initialize(context.Background(), config.NewDefaultConfig()); err != nil {
+		t.Fatalf("Failed to initialize: %v", err)
+	}
+	autoStart := integration.GetAutoStartSystem()
+
+	integration.UpdateRacingClass("Top Fuel")
+	cfg := autoStart.GetConfiguration()
+	if cfg.StagingTimeout != 7*time.Second || cfg.TreeSequenceType != config.TreeSequencePro || cfg.RandomDelayMax != 1100*time.Millisecond {
+		t.Errorf("Expected Top Fuel timing from the standard rules, got %+v", cfg)
+	}
+
+	// Pro Modified's rules leave the random delay to its tree preset
+	integration.UpdateRacingClass("Pro Modified")
+	if cfg = autoStart.GetConfiguration(); cfg.RandomDelayMin != 600*time.Millisecond || cfg.RandomDelayMax != 1400*time.Millisecond {
+		t.Errorf("Expected the Pro Mod .400 arming window, got %+v", cfg)
+	}
+
+	// A track's own class, with the timing it leaves zero kept
+	engine, err := rules.NewEngine(rules.Class{
+		Name:      "Outlaw 10.5",
+		Tree:      config.TreeSequencePro,
+		DeepStage: rules.DeepStageAllowed,
+		Breakout:  rules.BreakoutNone,
+		AutoStart: rules.AutoStart{StagingTimeout: 20 * time.Second},
+	})
+	if err != nil {
+		t.Fatalf("NewEngine failed: %v", err)
+	}
+	integration.SetRules(engine)
+	integration.UpdateRacingClass("Outlaw 10.5")
+	cfg = autoStart.GetConfiguration()
+	if cfg.StagingTimeout != 20*time.Second || cfg.MinStagingDuration != 500*time.Millisecond || cfg.RacingClass != "Outlaw 10.5" {
+		t.Errorf("Expected the custom class's timeout over Top Fuel's, got %+v", cfg)
+	}
+
+	// The standard classes are not in the custom engine
+	integration.UpdateRacingClass("Junior Dragster")
+	if cfg = autoStart.GetConfiguration(); cfg.StagingTimeout != 20*time.Second || cfg.RacingClass != "Junior Dragster" {
+		t.Errorf("Expected an unknown class to only change the class, got %+v", cfg)
+	}
+}
@@ -0,0 +1,76 @@
+package autostart
+
+import (
+	"fmt"
+
+	"github.com/benharold/libdrag/pkg/config"
+)
+
+// Profile is a named auto-start configuration that race directors edit
+// instead of changing presets in code. It applies to races in its Classes,
+// or to any race that selects it by name.
+type Profile struct {
+	Name    string          `json:"name"`
+	Classes []string        `json:"classes,omitempty"` // Racing classes using this profile by default
+	Config  AutoStartConfig `json:"config"`
+}
+
+// Validate checks that a profile is named and its timing is usable
+func (p Profile) Validate() error {
+	if p.Name == "" {
+		return fmt.Errorf("profile name is required")
+	}
+	c := p.Config
+	if c.StagingTimeout <= 0 {
+		return fmt.Errorf("profile %s: staging timeout must be positive", p.Name)
+	}
+	if c.MinStagingDuration < 0 || c.RandomDelayMin < 0 || c.RandomVariation < 0 {
+		return fmt.Errorf("profile %s: durations cannot be negative", p.Name)
+	}
+	if c.MinStagingDuration > c.StagingTimeout {
+		return fmt.Errorf("profile %s: minimum staging duration exceeds the staging timeout", p.Name)
+	}
+	if c.RandomDelayMax < c.RandomDelayMin {
+		return fmt.Errorf("profile %s: random delay maximum is below the minimum", p.Name)
+	}
+	previous := 0.0
+	for _, fraction := range c.TimeoutWarnings {
+		if fraction <= previous || fraction >= 1 {
+			return fmt.Errorf("profile %s: timeout warnings must be increasing fractions of the timeout", p.Name)
+		}
+		previous = fraction
+	}
+	if c.StageFlashLevel < 0 || c.StageFlashLevel > len(c.TimeoutWarnings) {
+		return fmt.Errorf("profile %s: stage flash level must be one of the timeout warnings", p.Name)
+	}
+	switch c.ActivationPolicy {
+	case "", ActivationThreeBulb, ActivationFirstStage, ActivationBothPreStaged:
+	default:
+		return fmt.Errorf("profile %s: unknown activation policy %q", p.Name, c.ActivationPolicy)
+	}
+	if _, err := DelayStrategyFor(c.DelayAlgorithm); err != nil {
+		return fmt.Errorf("profile %s: %w", p.Name, err)
+	}
+	for class, table := range c.DelayTables {
+		for _, delay := range table {
+			if delay < 0 {
+				return fmt.Errorf("profile %s: delay table for %q has a negative delay", p.Name, class)
+			}
+		}
+	}
+	switch c.TreeSequenceType {
+	case "", config.TreeSequencePro, config.TreeSequenceSportsman:
+	default:
+		return fmt.Errorf("profile %s: unknown tree type %q", p.Name, c.TreeSequenceType)
+	}
+	return nil
+}
+
+// ClassPreset returns the built-in configuration for a racing class, or the
+// Sportsman preset for classes without one
+func ClassPreset(class string) AutoStartConfig {
+	if preset, ok := classPresets[class]; ok {
+		return preset
+	}
+	return classPresets["Sportsman"]
+}
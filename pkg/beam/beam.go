@@ -9,6 +9,7 @@ import (
 	"github.com/benharold/libdrag/pkg/component"
 	"github.com/benharold/libdrag/pkg/config"
 	"github.com/benharold/libdrag/pkg/events"
+	"github.com/benharold/libdrag/pkg/timers"
 )
 
 // BeamID represents a specific beam identifier
@@ -16,14 +17,18 @@ type BeamID string
 
 // Standard beam identifiers
 const (
-	BeamPreStage  BeamID = "pre_stage"
-	BeamStage     BeamID = "stage"
-	Beam60Foot    BeamID = "60_foot"
-	Beam330Foot   BeamID = "330_foot"
-	Beam660Foot   BeamID = "660_foot"   // 1/8 mile
-	Beam1000Foot  BeamID = "1000_foot"  // 1/8 mile speed
-	Beam1320Foot  BeamID = "1320_foot"  // 1/4 mile
-	BeamSpeedTrap BeamID = "speed_trap" // 1/4 mile speed
+	BeamPreStage   BeamID = "pre_stage"
+	BeamStage      BeamID = "stage"
+	BeamGuard      BeamID = "guard" // 13 3/8" past stage; broken before green is a red light
+	Beam60Foot     BeamID = "60_foot"
+	Beam330Foot    BeamID = "330_foot"
+	BeamEighthTrap BeamID = "eighth_trap" // 66' before the 1/8 mile; 1/8 mile speed
+	Beam660Foot    BeamID = "660_foot"    // 1/8 mile
+	Beam1000Foot   BeamID = "1000_foot"
+	Beam1320Foot   BeamID = "1320_foot"  // 1/4 mile
+	BeamSpeedTrap  BeamID = "speed_trap" // 66' before the 1/4 mile; 1/4 mile speed
+	BeamShutdown   BeamID = "shutdown"   // Shutdown area past the finish line
+	BeamTurnout    BeamID = "turnout"    // Turnout at the end of the shutdown area
 )
 
 // BeamState represents the current state of a beam
@@ -33,6 +38,19 @@ type BeamState struct {
 	Position   float64   `json:"position"`
 	IsBroken   bool      `json:"is_broken"`
 	LastChange time.Time `json:"last_change"`
+
+	pendingSince    time.Time       // Start of a break not yet long enough to count
+	pendingAccuracy timers.Accuracy // Label of pendingSince
+	idValue         interface{}     // BeamID boxed once for event data
+}
+
+// RejectedBreak records a beam break shorter than the class minimum
+type RejectedBreak struct {
+	BeamID   BeamID        `json:"beam_id"`
+	Lane     int           `json:"lane"`
+	At       time.Time     `json:"at"`
+	Duration time.Duration `json:"duration"`
+	Minimum  time.Duration `json:"minimum"`
 }
 
 // BeamSystem manages all timing beams on the track
@@ -44,6 +62,11 @@ type BeamSystem struct {
 	eventBus *events.EventBus
 	raceID   string
 	status   component.ComponentStatus
+	rejected []RejectedBreak
+	clock    timers.Clock // Nil runs on the default wheel
+	source   timers.Accuracy
+
+	crossTalk *crossTalkDetector // Nil when not detecting
 }
 
 // NewBeamSystem creates a new beam system
@@ -52,6 +75,7 @@ func NewBeamSystem(eventBus *events.EventBus) *BeamSystem {
 		id:       "beam_system",
 		beams:    make(map[int]map[BeamID]*BeamState),
 		eventBus: eventBus,
+		source:   timers.AccuracyOf(timers.SourceHost),
 		status: component.ComponentStatus{
 			ID:       "beam_system",
 			Status:   "stopped",
@@ -86,6 +110,20 @@ func (bs *BeamSystem) Initialize(ctx context.Context, cfg config.Config) error {
 				Lane:     lane,
 				Position: beamConfig.Position,
 				IsBroken: false,
+				idValue:  string(bid),
+			}
+		}
+
+		// Model the guard beam past the stage beam even when the layout
+		// predates it
+		if stage, ok := bs.beams[lane][BeamStage]; ok {
+			if _, ok := bs.beams[lane][BeamGuard]; !ok {
+				bs.beams[lane][BeamGuard] = &BeamState{
+					BeamID:   BeamGuard,
+					Lane:     lane,
+					Position: stage.Position + config.GuardBeamOffset,
+					idValue:  string(BeamGuard),
+				}
 			}
 		}
 	}
@@ -126,6 +164,21 @@ func (bs *BeamSystem) SetEventBus(eventBus *events.EventBus) {
 	bs.eventBus = eventBus
 }
 
+// SetClock runs break debouncing on clock instead of the default wheel
+func (bs *BeamSystem) SetClock(clock timers.Clock) {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	bs.clock = clock
+}
+
+// SetTimestampSource labels the times of beam changes, which are read from
+// the clock as inputs arrive (host clock by default)
+func (bs *BeamSystem) SetTimestampSource(accuracy timers.Accuracy) {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	bs.source = accuracy
+}
+
 // SetRaceID sets the race ID for event context
 func (bs *BeamSystem) SetRaceID(raceID string) {
 	bs.mu.Lock()
@@ -133,11 +186,25 @@ func (bs *BeamSystem) SetRaceID(raceID string) {
 	bs.raceID = raceID
 }
 
-// TriggerBeam updates the state of a specific beam
+// TriggerBeam updates the state of a specific beam. When the racing class
+// has a minimum break duration, a break is reported only once it has lasted
+// that long; a beam restored sooner is recorded as a rejected break.
 func (bs *BeamSystem) TriggerBeam(lane int, beamID BeamID, isBroken bool) error {
 	bs.mu.Lock()
 	defer bs.mu.Unlock()
+	return bs.triggerBeam(lane, beamID, isBroken, timers.Or(bs.clock).Now(), bs.source)
+}
 
+// TriggerBeamAt updates a beam with a change that happened at at, as
+// timestamped by a hardware driver
+func (bs *BeamSystem) TriggerBeamAt(lane int, beamID BeamID, isBroken bool, at time.Time, accuracy timers.Accuracy) error {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	return bs.triggerBeam(lane, beamID, isBroken, at, accuracy)
+}
+
+// triggerBeam applies a beam change. Caller holds bs.mu.
+func (bs *BeamSystem) triggerBeam(lane int, beamID BeamID, isBroken bool, at time.Time, accuracy timers.Accuracy) error {
 	// Validate lane exists
 	laneBeams, exists := bs.beams[lane]
 	if !exists {
@@ -150,36 +217,152 @@ func (bs *BeamSystem) TriggerBeam(lane int, beamID BeamID, isBroken bool) error
 		return fmt.Errorf("beam %s does not exist in lane %d", beamID, lane)
 	}
 
-	// Check if state actually changed
-	if beam.IsBroken == isBroken {
+	pending := !beam.pendingSince.IsZero()
+	if isBroken != (beam.IsBroken || pending) {
+		bs.observeChange(beam, isBroken, at, accuracy)
+	}
+
+	if isBroken {
+		if beam.IsBroken || pending {
+			return nil // No change
+		}
+		minimum := bs.minBreak()
+		if minimum <= 0 {
+			bs.setBroken(beam, true, at, accuracy)
+			return nil
+		}
+		beam.pendingSince = at
+		beam.pendingAccuracy = accuracy
+		// A driver timestamp may be a little behind the clock, so the
+		// minimum is measured from the break itself
+		wait := minimum - timers.Or(bs.clock).Now().Sub(at)
+		timers.Or(bs.clock).AfterFunc(max(wait, 0), timers.Label{Name: "beam.min_break", RaceID: bs.raceID}, func() {
+			bs.confirmBreak(lane, beamID, at)
+		})
+		return nil
+	}
+
+	if pending {
+		bs.rejectBreak(beam, at.Sub(beam.pendingSince))
+		return nil
+	}
+	if !beam.IsBroken {
 		return nil // No change
 	}
+	bs.setBroken(beam, false, at, accuracy)
+	return nil
+}
+
+// TriggerChannel updates the beam wired to a controller channel in the
+// track's hardware map
+func (bs *BeamSystem) TriggerChannel(channel int, isBroken bool) error {
+	bs.mu.RLock()
+	cfg := bs.config
+	bs.mu.RUnlock()
+
+	if cfg == nil {
+		return fmt.Errorf("beam system not initialized")
+	}
+	wiring, ok := cfg.Track().Hardware.Lookup(channel)
+	if !ok || wiring.Kind != config.ChannelBeam {
+		return fmt.Errorf("channel %d is not wired to a beam", channel)
+	}
+	return bs.TriggerBeam(wiring.Lane, BeamID(wiring.ID), isBroken)
+}
 
-	// Update beam state
+// minBreak returns the minimum valid break for the configured racing class
+func (bs *BeamSystem) minBreak() time.Duration {
+	if bs.config == nil {
+		return 0
+	}
+	return bs.config.Timing().MinBeamBreakFor(bs.config.RacingClass())
+}
+
+// confirmBreak reports a pending break that has lasted the minimum duration
+func (bs *BeamSystem) confirmBreak(lane int, beamID BeamID, start time.Time) {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+
+	beam, exists := bs.beams[lane][beamID]
+	if !exists || !beam.pendingSince.Equal(start) {
+		return // Restored (rejected) or reset in the meantime
+	}
+	beam.pendingSince = time.Time{}
+	bs.setBroken(beam, true, start, beam.pendingAccuracy)
+}
+
+// rejectBreak records a break shorter than the minimum. Caller holds bs.mu.
+func (bs *BeamSystem) rejectBreak(beam *BeamState, duration time.Duration) {
+	rejected := RejectedBreak{
+		BeamID:   beam.BeamID,
+		Lane:     beam.Lane,
+		At:       beam.pendingSince,
+		Duration: duration,
+		Minimum:  bs.minBreak(),
+	}
+	beam.pendingSince = time.Time{}
+	bs.rejected = append(bs.rejected, rejected)
+
+	if bs.eventBus != nil {
+		bs.eventBus.Publish(
+			events.NewEvent(events.EventBeamBreakRejected).
+				WithRaceID(bs.raceID).
+				WithLane(beam.Lane).
+				WithData("beam_id", string(beam.BeamID)).
+				WithData("duration", duration.Seconds()).
+				WithData("minimum", rejected.Minimum.Seconds()).
+				Build(),
+		)
+	}
+}
+
+// setBroken changes a beam's state and publishes it. Caller holds bs.mu.
+func (bs *BeamSystem) setBroken(beam *BeamState, isBroken bool, at time.Time, accuracy timers.Accuracy) {
 	previousState := beam.IsBroken
 	beam.IsBroken = isBroken
-	beam.LastChange = time.Now()
+	beam.LastChange = at
 
 	// Publish appropriate event
-	if bs.eventBus != nil {
-		eventType := events.EventBeamRestored
-		if isBroken {
-			eventType = events.EventBeamBroken
-		}
-
+	eventType := events.EventBeamRestored
+	if isBroken {
+		eventType = events.EventBeamBroken
+	}
+	if bs.eventBus != nil && bs.eventBus.HasSubscribers(eventType) {
 		bs.eventBus.Publish(
 			events.NewEvent(eventType).
 				WithRaceID(bs.raceID).
-				WithLane(lane).
-				WithData("beam_id", string(beamID)).
+				WithLane(beam.Lane).
+				WithData("beam_id", beam.idValue).
 				WithData("position", beam.Position).
 				WithData("previous_state", previousState).
 				WithData("timestamp", beam.LastChange).
+				WithData("timestamp_source", string(accuracy.Source)).
+				WithData("uncertainty", accuracy.Uncertainty).
 				Build(),
 		)
 	}
 
-	return nil
+	// A guard trip is reported on its own so fault handling need not watch
+	// every beam break
+	if isBroken && beam.BeamID == BeamGuard && bs.eventBus != nil {
+		bs.eventBus.Publish(
+			events.NewEvent(events.EventBeamGuardTrip).
+				WithRaceID(bs.raceID).
+				WithLane(beam.Lane).
+				WithData("position", beam.Position).
+				WithData("timestamp", at).
+				WithData("timestamp_source", string(accuracy.Source)).
+				WithData("uncertainty", accuracy.Uncertainty).
+				Build(),
+		)
+	}
+}
+
+// GetRejectedBreaks returns the beam breaks rejected as too short
+func (bs *BeamSystem) GetRejectedBreaks() []RejectedBreak {
+	bs.mu.RLock()
+	defer bs.mu.RUnlock()
+	return append([]RejectedBreak(nil), bs.rejected...)
 }
 
 // GetBeamState returns the current state of a specific beam
@@ -247,9 +430,10 @@ func (bs *BeamSystem) ResetBeams() {
 
 	for _, laneBeams := range bs.beams {
 		for _, beam := range laneBeams {
+			beam.pendingSince = time.Time{}
 			if beam.IsBroken {
 				beam.IsBroken = false
-				beam.LastChange = time.Now()
+				beam.LastChange = timers.Or(bs.clock).Now()
 			}
 		}
 	}
@@ -1,9 +1,15 @@
 package beam
 
 import (
+	"context"
+	"net"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/benharold/libdrag/pkg/config"
 	"github.com/benharold/libdrag/pkg/events"
+	"github.com/benharold/libdrag/pkg/timers"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -19,3 +25,271 @@ func TestNewBeamSystem(t *testing.T) {
 	assert.NotNil(t, beamSystem.beams)
 	assert.Equal(t, eventBus, beamSystem.eventBus)
 }
+
+func TestMinimumBeamBreak(t *testing.T) {
+	// Arrange
+	cfg := config.NewDefaultConfig()
+	cfg.TimingConfig.MinBeamBreak = 20 * time.Millisecond
+	cfg.TimingConfig.ClassMinBeamBreak = map[string]time.Duration{"Pro Stock Motorcycle": 0}
+	beamSystem := NewBeamSystem(events.NewEventBus(false))
+	assert.NoError(t, beamSystem.Initialize(context.Background(), cfg))
+
+	// Act: a flicker shorter than the minimum is rejected
+	assert.NoError(t, beamSystem.TriggerBeam(1, BeamStage, true))
+	assert.NoError(t, beamSystem.TriggerBeam(1, BeamStage, false))
+
+	// Assert
+	state, _ := beamSystem.GetBeamState(1, BeamStage)
+	assert.False(t, state.IsBroken)
+	rejected := beamSystem.GetRejectedBreaks()
+	assert.Len(t, rejected, 1)
+	assert.Equal(t, BeamStage, rejected[0].BeamID)
+	assert.Equal(t, 20*time.Millisecond, rejected[0].Minimum)
+
+	// Act: a break held past the minimum counts from when it started
+	assert.NoError(t, beamSystem.TriggerBeam(2, BeamStage, true))
+	time.Sleep(40 * time.Millisecond)
+
+	// Assert
+	state, _ = beamSystem.GetBeamState(2, BeamStage)
+	assert.True(t, state.IsBroken)
+
+	// Act: motorcycles accept even the briefest wheel break
+	cfg.SetRacingClass("Pro Stock Motorcycle")
+	assert.NoError(t, beamSystem.TriggerBeam(1, BeamPreStage, true))
+
+	// Assert
+	state, _ = beamSystem.GetBeamState(1, BeamPreStage)
+	assert.True(t, state.IsBroken)
+	assert.Len(t, beamSystem.GetRejectedBreaks(), 1)
+}
+
+func TestTriggerChannel(t *testing.T) {
+	// Arrange
+	cfg := config.NewDefaultConfig()
+	cfg.TrackConfig.Hardware = config.HardwareMap{Channels: map[int]config.HardwareChannel{
+		3:  {Kind: config.ChannelBeam, Lane: 2, ID: "stage"},
+		16: {Kind: config.ChannelBulb, Lane: 1, ID: "green"},
+	}}
+	beamSystem := NewBeamSystem(events.NewEventBus(false))
+	assert.Error(t, beamSystem.TriggerChannel(3, true))
+	assert.NoError(t, beamSystem.Initialize(context.Background(), cfg))
+
+	// Act
+	assert.NoError(t, beamSystem.TriggerChannel(3, true))
+
+	// Assert
+	state, _ := beamSystem.GetBeamState(2, BeamStage)
+	assert.True(t, state.IsBroken)
+	assert.Error(t, beamSystem.TriggerChannel(16, true), "bulb channels are outputs")
+	assert.Error(t, beamSystem.TriggerChannel(99, true), "unmapped channel")
+}
+
+func TestGuardBeam(t *testing.T) {
+	// Arrange: a layout without a guard beam still gets one past stage
+	cfg := config.NewDefaultConfig()
+	delete(cfg.TrackConfig.BeamLayout, "guard")
+	eventBus := events.NewEventBus(false)
+	var trips []events.Event
+	eventBus.Subscribe(events.EventBeamGuardTrip, func(e events.Event) { trips = append(trips, e) })
+	beamSystem := NewBeamSystem(eventBus)
+	assert.NoError(t, beamSystem.Initialize(context.Background(), cfg))
+
+	// Act
+	assert.NoError(t, beamSystem.TriggerBeam(2, BeamStage, true))
+	assert.NoError(t, beamSystem.TriggerBeam(2, BeamGuard, true))
+
+	// Assert
+	state, err := beamSystem.GetBeamState(2, BeamGuard)
+	assert.NoError(t, err)
+	assert.Equal(t, config.GuardBeamOffset, state.Position)
+	assert.True(t, state.IsBroken)
+	assert.Len(t, trips, 1)
+	assert.Equal(t, 2, trips[0].Lane)
+}
+
+// replaySource is a beam source that replays fixed readings
+type replaySource []Reading
+
+func (s replaySource) Run(ctx context.Context, emit func(Reading)) error {
+	for _, r := range s {
+		emit(r)
+	}
+	return nil
+}
+
+func TestCrossTalkDetection(t *testing.T) {
+	// Arrange
+	eventBus := events.NewEventBus(false)
+	var reports []events.Event
+	eventBus.Subscribe(events.EventBeamCrossTalk, func(e events.Event) { reports = append(reports, e) })
+	beamSystem := NewBeamSystem(eventBus)
+	assert.NoError(t, beamSystem.Initialize(context.Background(), config.NewDefaultConfig()))
+	beamSystem.SetCrossTalkDetection(&CrossTalkConfig{})
+	latched := timers.AccuracyOf(timers.SourceHardware)
+	start := time.Unix(1_700_000_000, 0)
+
+	// Act: the stage beams change within 2µs of each other on every pass,
+	// while the pre-stage beams are a normal 80ms apart
+	for pass := 0; pass < 3; pass++ {
+		at := start.Add(time.Duration(pass) * time.Minute)
+		beamSystem.TriggerBeamAt(1, BeamPreStage, true, at, latched)
+		beamSystem.TriggerBeamAt(2, BeamPreStage, true, at.Add(80*time.Millisecond), latched)
+		at = at.Add(time.Second)
+		beamSystem.TriggerBeamAt(1, BeamStage, true, at, latched)
+		beamSystem.TriggerBeamAt(2, BeamStage, true, at.Add(2*time.Microsecond), latched)
+		at = at.Add(time.Second)
+		beamSystem.TriggerBeamAt(2, BeamStage, false, at, latched)
+		beamSystem.TriggerBeamAt(1, BeamStage, false, at.Add(time.Microsecond), latched)
+		beamSystem.TriggerBeamAt(1, BeamPreStage, false, at.Add(300*time.Millisecond), latched)
+		beamSystem.TriggerBeamAt(2, BeamPreStage, false, at.Add(390*time.Millisecond), latched)
+	}
+
+	// Assert: the stage pair is reported once, on its third coincidence
+	assert.Len(t, reports, 1)
+	assert.Equal(t, 1, reports[0].Lane)
+	assert.Equal(t, "stage", reports[0].Data["beam_id"])
+	assert.Equal(t, 2, reports[0].Data["paired_lane"])
+	assert.Equal(t, "stage", reports[0].Data["paired_beam_id"])
+	assert.Equal(t, 3, reports[0].Data["coincidences"])
+	suspects := beamSystem.CrossTalkSuspects()
+	assert.Len(t, suspects, 1)
+	assert.Equal(t, [2]BeamRef{{1, BeamStage}, {2, BeamStage}}, suspects[0].Beams)
+	assert.Equal(t, 2*time.Microsecond, suspects[0].MaxSkew)
+	assert.Equal(t, 1.0, suspects[0].Correlation)
+
+	// Act: host timestamps of readings that arrive together are not compared
+	hostSystem := NewBeamSystem(eventBus)
+	assert.NoError(t, hostSystem.Initialize(context.Background(), config.NewDefaultConfig()))
+	hostSystem.SetCrossTalkDetection(&CrossTalkConfig{Threshold: 1})
+	received := timers.AccuracyOf(timers.SourceHost)
+	hostSystem.TriggerBeamAt(1, BeamStage, true, start, received)
+	hostSystem.TriggerBeamAt(2, BeamStage, true, start, received)
+
+	// Assert
+	assert.Empty(t, hostSystem.CrossTalkSuspects())
+	assert.Len(t, reports, 1)
+}
+
+func TestAttachSource(t *testing.T) {
+	// Arrange
+	cfg := config.NewDefaultConfig()
+	cfg.TrackConfig.Hardware = config.HardwareMap{Channels: map[int]config.HardwareChannel{
+		3: {Kind: config.ChannelBeam, Lane: 2, ID: "stage", Offset: 2 * time.Millisecond},
+		4: {Kind: config.ChannelBeam, Lane: 1, ID: "stage", Offset: 2 * time.Millisecond},
+	}}
+	eventBus := events.NewEventBus(false)
+	var broken []events.Event
+	eventBus.Subscribe(events.EventBeamBroken, func(e events.Event) { broken = append(broken, e) })
+	beamSystem := NewBeamSystem(eventBus)
+	assert.NoError(t, beamSystem.Initialize(context.Background(), cfg))
+	latched := time.Unix(1_700_000_000, 0)
+	received := latched.Add(5 * time.Millisecond)
+
+	// Act
+	err := beamSystem.Attach(context.Background(), replaySource{
+		{Channel: 3, Broken: true, At: latched, Accuracy: timers.AccuracyOf(timers.SourceHardware)},
+		{Channel: 4, Broken: true, At: received},
+		{Channel: 9, Broken: true}, // Spare channel
+	})
+
+	// Assert: latched times stand, received times lose the channel latency
+	assert.NoError(t, err)
+	state, _ := beamSystem.GetBeamState(2, BeamStage)
+	assert.True(t, state.IsBroken)
+	assert.Equal(t, latched, state.LastChange)
+	state, _ = beamSystem.GetBeamState(1, BeamStage)
+	assert.Equal(t, received.Add(-2*time.Millisecond), state.LastChange)
+	assert.Len(t, broken, 2)
+	assert.Equal(t, "hardware", broken[0].Data["timestamp_source"])
+	assert.Equal(t, "host", broken[1].Data["timestamp_source"])
+}
+
+// heldSource replays readings and then stays open for a while
+type heldSource struct {
+	readings replaySource
+	hold     time.Duration
+}
+
+func (s heldSource) Run(ctx context.Context, emit func(Reading)) error {
+	s.readings.Run(ctx, emit)
+	time.Sleep(s.hold)
+	return nil
+}
+
+func TestDebounce(t *testing.T) {
+	// Arrange: a break that chatters, and a restore that settles inside the window
+	start := time.Unix(1_700_000_000, 0)
+	at := func(ms int) time.Time { return start.Add(time.Duration(ms) * time.Millisecond) }
+	src := Debounce(heldSource{readings: replaySource{
+		{Channel: 1, Broken: true, At: at(0)},
+		{Channel: 1, Broken: false, At: at(1)},
+		{Channel: 1, Broken: true, At: at(2)},
+		{Channel: 1, Broken: false, At: at(200)},
+		{Channel: 1, Broken: true, At: at(201)},
+		{Channel: 1, Broken: false, At: at(202)},
+		{Channel: 2, Broken: true, At: at(0)},
+		{Channel: 2, Broken: false, At: at(1)},
+	}, hold: 150 * time.Millisecond}, 50*time.Millisecond)
+
+	// Act
+	var mu sync.Mutex
+	var got []Reading
+	assert.NoError(t, src.Run(context.Background(), func(r Reading) {
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, r)
+	}))
+
+	// Assert: first edges keep their timestamps; chatter is dropped, and a
+	// channel that settled inside the window is caught up
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Len(t, got, 4)
+	assert.Equal(t, Reading{Channel: 1, Broken: true, At: at(0)}, got[0])
+	assert.Equal(t, Reading{Channel: 1, Broken: false, At: at(200)}, got[1])
+	assert.Equal(t, Reading{Channel: 2, Broken: true, At: at(0)}, got[2])
+	assert.Equal(t, Reading{Channel: 2, Broken: false, At: at(1)}, got[3])
+}
+
+func TestUDPSource(t *testing.T) {
+	// Arrange
+	reserved, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	address := reserved.LocalAddr().String()
+	reserved.Close()
+	src, err := OpenSource(SourceConfig{Driver: "udp", Address: address})
+	assert.NoError(t, err)
+	_, err = OpenSource(SourceConfig{Driver: "carrier-pigeon"})
+	assert.Error(t, err)
+	assert.Contains(t, Drivers(), "serial")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	readings := make(chan Reading, 4)
+	done := make(chan error, 1)
+	go func() { done <- src.Run(ctx, func(r Reading) { readings <- r }) }()
+
+	// Act: resend until the listener is up
+	conn, err := net.Dial("udp", address)
+	assert.NoError(t, err)
+	defer conn.Close()
+	var r Reading
+	for r.Channel == 0 {
+		conn.Write([]byte("garbage\n7 1 1700000000000000123\n"))
+		select {
+		case r = <-readings:
+		case <-time.After(20 * time.Millisecond):
+		case <-ctx.Done():
+			t.Fatal("no reading received")
+		}
+	}
+	cancel()
+
+	// Assert
+	assert.Equal(t, 7, r.Channel)
+	assert.True(t, r.Broken)
+	assert.Equal(t, time.Unix(0, 1700000000000000123), r.At)
+	assert.Equal(t, timers.SourceHardware, r.Accuracy.Source)
+	assert.NoError(t, <-done)
+}
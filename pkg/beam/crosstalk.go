@@ -0,0 +1,189 @@
+package beam
+
+import (
+	"math"
+	"time"
+
+	"github.com/benharold/libdrag/pkg/events"
+	"github.com/benharold/libdrag/pkg/timers"
+)
+
+// Cross-talk detection defaults
+const (
+	DefaultCrossTalkWindow      = 10 * time.Microsecond
+	DefaultCrossTalkThreshold   = 3
+	DefaultCrossTalkCorrelation = 0.5
+)
+
+// CrossTalkConfig tunes cross-talk detection. Zero fields use the defaults.
+type CrossTalkConfig struct {
+	// Window is how close two lanes' beam changes must be to count as
+	// coincident. Two cars are all but never that close: a margin of a
+	// ten-thousandth of a second is 100 microseconds.
+	Window time.Duration `json:"window,omitempty"`
+	// Threshold is how many coincident changes a beam pair must show before
+	// it is reported
+	Threshold int `json:"threshold,omitempty"`
+	// Correlation is the share of the quieter beam's changes that must
+	// coincide with the other's, so a busy beam meeting another now and
+	// then is not reported
+	Correlation float64 `json:"correlation,omitempty"`
+}
+
+// withDefaults fills in zero fields
+func (c CrossTalkConfig) withDefaults() CrossTalkConfig {
+	if c.Window <= 0 {
+		c.Window = DefaultCrossTalkWindow
+	}
+	if c.Threshold <= 0 {
+		c.Threshold = DefaultCrossTalkThreshold
+	}
+	if c.Correlation <= 0 {
+		c.Correlation = DefaultCrossTalkCorrelation
+	}
+	return c
+}
+
+// BeamRef names one lane's beam
+type BeamRef struct {
+	Lane   int    `json:"lane"`
+	BeamID BeamID `json:"beam_id"`
+}
+
+// CrossTalkSuspect is a pair of beams in different lanes that keep changing
+// together, most likely from cross-talk in their wiring or controller
+// inputs
+type CrossTalkSuspect struct {
+	Beams        [2]BeamRef    `json:"beams"`        // Lower lane first
+	Coincidences int           `json:"coincidences"` // Changes within the window of each other
+	Correlation  float64       `json:"correlation"`  // Coincidences over the quieter beam's changes
+	MaxSkew      time.Duration `json:"max_skew"`     // Widest gap between coincident changes
+	DetectedAt   time.Time     `json:"detected_at"`
+}
+
+// change is a beam's raw change, kept to match against other lanes'
+type change struct {
+	beam   BeamRef
+	broken bool
+	at     time.Time
+}
+
+// pairKey orders a beam pair, lower lane first
+type pairKey [2]BeamRef
+
+func newPairKey(a, b BeamRef) pairKey {
+	if b.Lane < a.Lane || (b.Lane == a.Lane && b.BeamID < a.BeamID) {
+		a, b = b, a
+	}
+	return pairKey{a, b}
+}
+
+// crossTalkDetector correlates the timing controller's beam changes across
+// lanes
+type crossTalkDetector struct {
+	cfg      CrossTalkConfig
+	changes  map[BeamRef]int // Changes seen per beam
+	pairs    map[pairKey]*CrossTalkSuspect
+	recent   []change // Latest changes, for matching
+	suspects []CrossTalkSuspect
+}
+
+// maxRecent bounds the changes matched against, as only the last few can
+// be within microseconds of a new one
+const maxRecent = 16
+
+// SetCrossTalkDetection watches the beams for cross-talk: beams in
+// different lanes whose changes repeatedly land within microseconds of each
+// other, which no two cars can do. A suspect pair is reported once with
+// beam.crosstalk and kept in CrossTalkSuspects. Only changes timestamped by
+// the controller are compared, as host timestamps of readings that arrive
+// together are equal anyway. Pass nil to stop detecting.
+func (bs *BeamSystem) SetCrossTalkDetection(cfg *CrossTalkConfig) {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	if cfg == nil {
+		bs.crossTalk = nil
+		return
+	}
+	bs.crossTalk = &crossTalkDetector{
+		cfg:     cfg.withDefaults(),
+		changes: make(map[BeamRef]int),
+		pairs:   make(map[pairKey]*CrossTalkSuspect),
+	}
+}
+
+// CrossTalkSuspects returns the beam pairs reported for cross-talk, in the
+// order detected
+func (bs *BeamSystem) CrossTalkSuspects() []CrossTalkSuspect {
+	bs.mu.RLock()
+	defer bs.mu.RUnlock()
+	if bs.crossTalk == nil {
+		return nil
+	}
+	return append([]CrossTalkSuspect(nil), bs.crossTalk.suspects...)
+}
+
+// observeChange feeds a raw beam change to cross-talk detection. Caller
+// holds bs.mu.
+func (bs *BeamSystem) observeChange(beam *BeamState, broken bool, at time.Time, accuracy timers.Accuracy) {
+	if bs.crossTalk == nil || accuracy.Source != timers.SourceHardware {
+		return
+	}
+	detected := bs.crossTalk.observe(change{beam: BeamRef{Lane: beam.Lane, BeamID: beam.BeamID}, broken: broken, at: at})
+	if bs.eventBus == nil {
+		return
+	}
+	for _, suspect := range detected {
+		bs.eventBus.Publish(
+			events.NewEvent(events.EventBeamCrossTalk).
+				WithRaceID(bs.raceID).
+				WithLane(suspect.Beams[0].Lane).
+				WithData("beam_id", string(suspect.Beams[0].BeamID)).
+				WithData("paired_lane", suspect.Beams[1].Lane).
+				WithData("paired_beam_id", string(suspect.Beams[1].BeamID)).
+				WithData("coincidences", suspect.Coincidences).
+				WithData("correlation", suspect.Correlation).
+				WithData("max_skew", suspect.MaxSkew.Seconds()).
+				Build(),
+		)
+	}
+}
+
+// observe records a change and returns the beam pairs it has just taken
+// over the reporting threshold
+func (d *crossTalkDetector) observe(c change) []CrossTalkSuspect {
+	d.changes[c.beam]++
+
+	var detected []CrossTalkSuspect
+	for _, r := range d.recent {
+		skew := c.at.Sub(r.at)
+		if skew < 0 {
+			skew = -skew
+		}
+		if r.beam.Lane == c.beam.Lane || r.broken != c.broken || skew > d.cfg.Window {
+			continue
+		}
+		key := newPairKey(r.beam, c.beam)
+		pair, ok := d.pairs[key]
+		if !ok {
+			pair = &CrossTalkSuspect{Beams: key}
+			d.pairs[key] = pair
+		}
+		pair.Coincidences++
+		pair.MaxSkew = max(pair.MaxSkew, skew)
+		quieter := min(d.changes[key[0]], d.changes[key[1]])
+		pair.Correlation = math.Min(1, float64(pair.Coincidences)/float64(quieter))
+
+		if pair.DetectedAt.IsZero() && pair.Coincidences >= d.cfg.Threshold && pair.Correlation >= d.cfg.Correlation {
+			pair.DetectedAt = c.at
+			d.suspects = append(d.suspects, *pair)
+			detected = append(detected, *pair)
+		}
+	}
+
+	d.recent = append(d.recent, c)
+	if len(d.recent) > maxRecent {
+		d.recent = d.recent[len(d.recent)-maxRecent:]
+	}
+	return detected
+}
@@ -0,0 +1,78 @@
+package beam_test
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/benharold/libdrag/pkg/beam"
+	"github.com/benharold/libdrag/pkg/config"
+	"github.com/benharold/libdrag/pkg/events"
+)
+
+// lineSource is a driver for a controller that writes one protocol line
+// per input change, such as a vendor board behind a USB serial adapter
+type lineSource struct {
+	r io.Reader
+}
+
+func (s lineSource) Run(ctx context.Context, emit func(beam.Reading)) error {
+	scanner := bufio.NewScanner(s.r)
+	for scanner.Scan() && ctx.Err() == nil {
+		reading, err := beam.ParseReading(scanner.Text(), time.Now())
+		if err != nil {
+			return err
+		}
+		emit(reading)
+	}
+	return scanner.Err()
+}
+
+// This example registers a driver for a controller libdrag has no built-in
+// support for, opens it from a source configuration and feeds its readings
+// to a beam system, which resolves the controller's channels to lanes and
+// beams through the track's hardware map.
+func ExampleRegisterDriver() {
+	beam.RegisterDriver("example-lines", func(cfg beam.SourceConfig) (beam.BeamSource, error) {
+		// A real driver would open cfg.Address; this one reads a capture
+		return lineSource{r: strings.NewReader(cfg.Options["capture"])}, nil
+	})
+
+	cfg := config.NewDefaultConfig()
+	cfg.TrackConfig.Hardware = config.HardwareMap{Channels: map[int]config.HardwareChannel{
+		1: {Kind: config.ChannelBeam, Lane: 1, ID: "pre_stage"},
+		2: {Kind: config.ChannelBeam, Lane: 1, ID: "stage"},
+		5: {Kind: config.ChannelBeam, Lane: 2, ID: "pre_stage"},
+	}}
+
+	bus := events.NewEventBus(false)
+	bus.Subscribe(events.EventBeamBroken, func(e events.Event) {
+		fmt.Printf("lane %d %s broken\n", e.Lane, e.Data["beam_id"])
+	})
+	beams := beam.NewBeamSystem(bus)
+	if err := beams.Initialize(context.Background(), cfg); err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	src, err := beam.OpenSource(beam.SourceConfig{
+		Driver:  "example-lines",
+		Options: map[string]string{"capture": "1 1\n5 1\n2 1\n"},
+	})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	if err := beams.Attach(context.Background(), src); err != nil {
+		fmt.Println(err)
+	}
+	fmt.Println(beam.Drivers())
+	// Output:
+	// lane 1 pre_stage broken
+	// lane 2 pre_stage broken
+	// lane 1 stage broken
+	// [example-lines serial udp]
+}
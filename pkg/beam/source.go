@@ -0,0 +1,328 @@
+package beam
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/benharold/libdrag/pkg/config"
+	"github.com/benharold/libdrag/pkg/timers"
+)
+
+// Reading is a change on one of the timing controller's input channels
+type Reading struct {
+	Channel int
+	Broken  bool
+
+	// At is when the input changed, taken as close to the sensor as the
+	// driver can: latched by the controller, or read in the interrupt or
+	// receive path before anything else is done with the input. Zero means
+	// when the beam system gets the reading.
+	At time.Time
+
+	// Accuracy labels At. Zero uses the beam system's timestamp source.
+	Accuracy timers.Accuracy
+}
+
+// BeamSource is a driver for the controller the track's sensors are wired to
+// (GPIO pins, an RS-485 serial controller, UDP photocell units, ...)
+type BeamSource interface {
+	// Run sends each input change to emit until ctx is cancelled, when it
+	// returns nil, or the controller fails. Drivers call emit from one
+	// goroutine at a time.
+	Run(ctx context.Context, emit func(Reading)) error
+}
+
+// SourceConfig selects and configures a beam source driver
+type SourceConfig struct {
+	Driver   string            `json:"driver"`
+	Address  string            `json:"address"`            // Device path, serial port or listen address
+	Debounce time.Duration     `json:"debounce,omitempty"` // Contact bounce to suppress; zero passes every change
+	Options  map[string]string `json:"options,omitempty"`  // Driver-specific settings
+}
+
+// Driver opens a beam source from its configuration
+type Driver func(cfg SourceConfig) (BeamSource, error)
+
+var (
+	driversMu sync.RWMutex
+	drivers   = map[string]Driver{
+		"udp":    openUDP,
+		"serial": openSerial,
+	}
+)
+
+// RegisterDriver makes a driver available to OpenSource by name, so
+// controllers that need their own libraries (GPIO character devices, vendor
+// SDKs) can be supported without libdrag depending on them. It panics if the
+// name is already registered.
+func RegisterDriver(name string, driver Driver) {
+	driversMu.Lock()
+	defer driversMu.Unlock()
+	if driver == nil {
+		panic("beam: RegisterDriver driver is nil")
+	}
+	if _, exists := drivers[name]; exists {
+		panic("beam: RegisterDriver called twice for driver " + name)
+	}
+	drivers[name] = driver
+}
+
+// Drivers returns the names of the registered drivers, sorted
+func Drivers() []string {
+	driversMu.RLock()
+	defer driversMu.RUnlock()
+	names := make([]string, 0, len(drivers))
+	for name := range drivers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// OpenSource opens a beam source with the configured driver, debounced when
+// the configuration asks for it
+func OpenSource(cfg SourceConfig) (BeamSource, error) {
+	driversMu.RLock()
+	driver, ok := drivers[cfg.Driver]
+	driversMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown beam source driver %q", cfg.Driver)
+	}
+	src, err := driver(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("beam source %s: %w", cfg.Driver, err)
+	}
+	if cfg.Debounce > 0 {
+		src = Debounce(src, cfg.Debounce)
+	}
+	return src, nil
+}
+
+// Attach feeds a source's readings into the beam system until ctx is
+// cancelled or the source fails. Channels resolve through the track's
+// hardware map; changes on channels not wired to a beam are dropped.
+func (bs *BeamSystem) Attach(ctx context.Context, src BeamSource) error {
+	return src.Run(ctx, bs.applyReading)
+}
+
+// applyReading updates the beam wired to a reading's channel
+func (bs *BeamSystem) applyReading(r Reading) {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+
+	if bs.config == nil {
+		return
+	}
+	wiring, ok := bs.config.Track().Hardware.Lookup(r.Channel)
+	if !ok || wiring.Kind != config.ChannelBeam {
+		return
+	}
+	at, accuracy := r.At, r.Accuracy
+	if at.IsZero() {
+		at = timers.Or(bs.clock).Now()
+	}
+	if accuracy.Source == "" {
+		accuracy = bs.source
+	}
+	// A controller latch is taken at the sensor; anything later carries
+	// the channel's calibrated latency
+	if accuracy.Source != timers.SourceHardware {
+		at = wiring.Correct(at)
+	}
+	bs.triggerBeam(wiring.Lane, BeamID(wiring.ID), r.Broken, at, accuracy)
+}
+
+// Debounce wraps a source to suppress contact bounce. The first edge on a
+// channel is passed on with its own timestamp and later edges within window
+// of it are dropped; if the channel has settled in the other state when the
+// window closes, that change is passed on too.
+func Debounce(src BeamSource, window time.Duration) BeamSource {
+	return &debounced{src: src, window: window}
+}
+
+type debounced struct {
+	src    BeamSource
+	window time.Duration
+}
+
+// debounceChannel tracks one channel of a debounced source
+type debounceChannel struct {
+	accepted Reading // Last change passed on
+	latest   Reading // Last change seen
+	settling bool    // A settle check is scheduled
+}
+
+// Run runs the wrapped source, debouncing its readings
+func (d *debounced) Run(ctx context.Context, emit func(Reading)) error {
+	var mu sync.Mutex
+	channels := make(map[int]*debounceChannel)
+	done := false
+
+	settle := func(ch *debounceChannel) {
+		mu.Lock()
+		defer mu.Unlock()
+		ch.settling = false
+		if !done && ch.latest.Broken != ch.accepted.Broken {
+			ch.accepted = ch.latest
+			emit(ch.latest)
+		}
+	}
+
+	err := d.src.Run(ctx, func(r Reading) {
+		if r.At.IsZero() {
+			r.At = timers.Now()
+		}
+		mu.Lock()
+		defer mu.Unlock()
+
+		ch, seen := channels[r.Channel]
+		if !seen {
+			channels[r.Channel] = &debounceChannel{accepted: r, latest: r}
+			emit(r)
+			return
+		}
+		ch.latest = r
+		if r.At.Sub(ch.accepted.At) >= d.window {
+			if r.Broken != ch.accepted.Broken {
+				ch.accepted = r
+				emit(r)
+			}
+			return
+		}
+		if !ch.settling {
+			ch.settling = true
+			wait := d.window - r.At.Sub(ch.accepted.At)
+			timers.Or(nil).AfterFunc(wait, timers.Label{Name: "beam.debounce"}, func() { settle(ch) })
+		}
+	})
+
+	mu.Lock()
+	done = true
+	mu.Unlock()
+	return err
+}
+
+// ParseReading parses a line of the text protocol spoken by the built-in
+// drivers: "<channel> <1|0> [<unix nanoseconds>]", where 1 is broken. A
+// timestamp is the controller's latch time on a clock synchronised with the
+// host; without one the reading is timestamped at received.
+func ParseReading(line string, received time.Time) (Reading, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 || len(fields) > 3 {
+		return Reading{}, fmt.Errorf("malformed reading %q", line)
+	}
+	channel, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return Reading{}, fmt.Errorf("malformed channel in %q", line)
+	}
+	r := Reading{Channel: channel, At: received}
+	switch fields[1] {
+	case "1":
+		r.Broken = true
+	case "0":
+	default:
+		return Reading{}, fmt.Errorf("malformed state in %q", line)
+	}
+	if len(fields) == 3 {
+		nanos, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			return Reading{}, fmt.Errorf("malformed timestamp in %q", line)
+		}
+		r.At = time.Unix(0, nanos)
+		r.Accuracy = timers.AccuracyOf(timers.SourceHardware)
+	}
+	return r, nil
+}
+
+// udpSource receives readings from photocell controllers that send one
+// datagram of protocol lines per change
+type udpSource struct {
+	address string
+}
+
+func openUDP(cfg SourceConfig) (BeamSource, error) {
+	if cfg.Address == "" {
+		return nil, errors.New("no listen address")
+	}
+	return &udpSource{address: cfg.Address}, nil
+}
+
+// Run listens for datagrams until ctx is cancelled
+func (s *udpSource) Run(ctx context.Context, emit func(Reading)) error {
+	conn, err := net.ListenPacket("udp", s.address)
+	if err != nil {
+		return err
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	buf := make([]byte, 1500)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		received := timers.Now()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			conn.Close()
+			return err
+		}
+		for _, line := range strings.Split(string(buf[:n]), "\n") {
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			if r, err := ParseReading(line, received); err == nil {
+				emit(r) // Malformed lines are line noise; drop them
+			}
+		}
+	}
+}
+
+// serialSource reads protocol lines from an RS-485 (or RS-232) controller.
+// The port's speed and framing are set up by the OS (e.g. with stty), so
+// the driver needs no serial library.
+type serialSource struct {
+	port string
+}
+
+func openSerial(cfg SourceConfig) (BeamSource, error) {
+	if cfg.Address == "" {
+		return nil, errors.New("no serial port")
+	}
+	return &serialSource{port: cfg.Address}, nil
+}
+
+// Run reads lines from the port until ctx is cancelled
+func (s *serialSource) Run(ctx context.Context, emit func(Reading)) error {
+	port, err := os.Open(s.port)
+	if err != nil {
+		return err
+	}
+	stop := context.AfterFunc(ctx, func() { port.Close() })
+	defer stop()
+	defer port.Close()
+
+	scanner := bufio.NewScanner(port)
+	for scanner.Scan() {
+		received := timers.Now()
+		if r, err := ParseReading(scanner.Text(), received); err == nil {
+			emit(r)
+		}
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return errors.New("serial port closed")
+}
@@ -0,0 +1,269 @@
+// Package calibration runs the sensor calibration wizard. It prompts a
+// technician to block each wired beam in turn, measures each channel's
+// response latency and noise, and reports the offsets to write into the
+// facility hardware map.
+package calibration
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/benharold/libdrag/pkg/config"
+	"github.com/benharold/libdrag/pkg/events"
+	"github.com/benharold/libdrag/pkg/timers"
+)
+
+// DefaultSettle is how long a blocked channel is watched for chatter
+const DefaultSettle = 500 * time.Millisecond
+
+// Config configures a calibration run
+type Config struct {
+	Settle time.Duration `json:"settle"` // Chatter window after each block (0 = DefaultSettle)
+}
+
+// Step is a beam the technician is asked to block
+type Step struct {
+	Channel int    `json:"channel"`
+	Lane    int    `json:"lane"`
+	Beam    string `json:"beam"`
+}
+
+// Measurement is a channel's calibration result
+type Measurement struct {
+	Step
+	Latency time.Duration `json:"latency"` // Sensor timestamp to receipt
+	Noise   int           `json:"noise"`   // Transitions while settling, plus signals during other steps
+}
+
+// Report is the outcome of a calibration run
+type Report struct {
+	StartedAt    time.Time          `json:"started_at"`
+	CompletedAt  time.Time          `json:"completed_at"`
+	Measurements []Measurement      `json:"measurements"`
+	Hardware     config.HardwareMap `json:"hardware"` // The hardware map with the measured offsets written
+}
+
+// Wizard walks through every beam channel in the hardware map, nearest the
+// starting line first. Drivers feed it raw channel signals with Signal; a
+// channel's first block measures its latency, and further transitions while
+// it settles, or signals while another beam is being calibrated, count as
+// noise.
+type Wizard struct {
+	mu           sync.Mutex
+	bus          *events.EventBus
+	clock        timers.Clock // Nil runs on the default wheel
+	settle       time.Duration
+	hardware     config.HardwareMap
+	steps        []Step
+	current      int
+	blocked      bool // Current step's beam has been blocked
+	latency      time.Duration
+	noise        map[int]int // Channel -> noise count
+	measurements []Measurement
+	startedAt    time.Time
+	report       *Report
+	timer        *timers.Timer
+	onComplete   func(Report)
+}
+
+// NewWizard creates a wizard for the beams wired in the track's hardware map
+func NewWizard(bus *events.EventBus, track config.TrackConfig, cfg Config) (*Wizard, error) {
+	if err := track.Hardware.Validate(track); err != nil {
+		return nil, err
+	}
+	var steps []Step
+	for channel, wiring := range track.Hardware.Channels {
+		if wiring.Kind == config.ChannelBeam {
+			steps = append(steps, Step{Channel: channel, Lane: wiring.Lane, Beam: wiring.ID})
+		}
+	}
+	if len(steps) == 0 {
+		return nil, fmt.Errorf("no beams wired in the hardware map")
+	}
+	sort.Slice(steps, func(i, j int) bool {
+		pi, pj := track.BeamLayout[steps[i].Beam].Position, track.BeamLayout[steps[j].Beam].Position
+		if pi != pj {
+			return pi < pj
+		}
+		return steps[i].Lane < steps[j].Lane
+	})
+
+	settle := cfg.Settle
+	if settle <= 0 {
+		settle = DefaultSettle
+	}
+	return &Wizard{
+		bus:      bus,
+		settle:   settle,
+		hardware: track.Hardware,
+		steps:    steps,
+		noise:    make(map[int]int),
+	}, nil
+}
+
+// SetClock runs the wizard on clock instead of the default wheel
+func (w *Wizard) SetClock(clock timers.Clock) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.clock = clock
+}
+
+// OnComplete sets a function called with the report when every beam has
+// been calibrated
+func (w *Wizard) OnComplete(f func(Report)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.onComplete = f
+}
+
+// Start prompts for the first beam
+func (w *Wizard) Start() {
+	w.mu.Lock()
+	w.startedAt = timers.Or(w.clock).Now()
+	prompt := w.promptEvent()
+	w.mu.Unlock()
+
+	w.bus.Publish(prompt)
+}
+
+// Stop abandons the run
+func (w *Wizard) Stop() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+}
+
+// Current returns the beam the technician should block, or false once the
+// run is complete
+func (w *Wizard) Current() (Step, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.report != nil {
+		return Step{}, false
+	}
+	return w.steps[w.current], true
+}
+
+// Report returns the completed run's report
+func (w *Wizard) Report() (Report, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.report == nil {
+		return Report{}, false
+	}
+	return *w.report, true
+}
+
+// Signal reports a raw channel transition, at the time the sensor saw it.
+// A zero time means the driver cannot timestamp at the sensor, so the
+// channel's latency cannot be measured.
+func (w *Wizard) Signal(channel int, broken bool, at time.Time) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.report != nil {
+		return fmt.Errorf("calibration is complete")
+	}
+	if _, ok := w.hardware.Lookup(channel); !ok {
+		return fmt.Errorf("channel %d is not in the hardware map", channel)
+	}
+
+	step := w.steps[w.current]
+	switch {
+	case channel != step.Channel || w.blocked:
+		w.noise[channel]++
+	case broken:
+		clock := timers.Or(w.clock)
+		w.blocked = true
+		if !at.IsZero() {
+			w.latency = clock.Now().Sub(at)
+		}
+		w.timer = clock.AfterFunc(w.settle, timers.Label{Name: "calibration.settle"}, w.finishStep)
+	}
+	return nil
+}
+
+// finishStep records the current beam's measurement and moves on once it
+// has settled
+func (w *Wizard) finishStep() {
+	w.mu.Lock()
+	step := w.steps[w.current]
+	measurement := Measurement{Step: step, Latency: w.latency, Noise: w.noise[step.Channel]}
+	w.measurements = append(w.measurements, measurement)
+	w.current++
+	w.blocked = false
+	w.latency = 0
+
+	published := []events.Event{
+		events.NewEvent(events.EventCalibrationMeasured).
+			WithLane(step.Lane).
+			WithData("measurement", measurement).
+			Build(),
+	}
+	if w.current < len(w.steps) {
+		published = append(published, w.promptEvent())
+		w.mu.Unlock()
+		w.publish(published)
+		return
+	}
+
+	report := w.complete()
+	published = append(published, events.NewEvent(events.EventCalibrationComplete).
+		WithData("report", report).
+		Build())
+	onComplete := w.onComplete
+	w.mu.Unlock()
+
+	w.publish(published)
+	if onComplete != nil {
+		onComplete(report)
+	}
+}
+
+// complete builds the report, writing each channel's latency into a copy
+// of the hardware map. Must be called with w.mu held.
+func (w *Wizard) complete() Report {
+	hardware := config.HardwareMap{Channels: make(map[int]config.HardwareChannel, len(w.hardware.Channels))}
+	for channel, wiring := range w.hardware.Channels {
+		hardware.Channels[channel] = wiring
+	}
+	// Noise seen after a channel was calibrated still counts against it
+	measurements := make([]Measurement, len(w.measurements))
+	for i, measurement := range w.measurements {
+		measurement.Noise = w.noise[measurement.Channel]
+		measurements[i] = measurement
+		wiring := hardware.Channels[measurement.Channel]
+		wiring.Offset = measurement.Latency
+		hardware.Channels[measurement.Channel] = wiring
+	}
+
+	w.report = &Report{
+		StartedAt:    w.startedAt,
+		CompletedAt:  timers.Or(w.clock).Now(),
+		Measurements: measurements,
+		Hardware:     hardware,
+	}
+	return *w.report
+}
+
+// promptEvent asks for the current beam. Must be called with w.mu held.
+func (w *Wizard) promptEvent() events.Event {
+	step := w.steps[w.current]
+	return events.NewEvent(events.EventCalibrationPrompt).
+		WithLane(step.Lane).
+		WithData("channel", step.Channel).
+		WithData("beam", step.Beam).
+		WithData("step", w.current+1).
+		WithData("steps", len(w.steps)).
+		Build()
+}
+
+func (w *Wizard) publish(published []events.Event) {
+	for _, event := range published {
+		w.bus.Publish(event)
+	}
+}
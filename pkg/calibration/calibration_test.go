@@ -0,0 +1,128 @@
+package calibration
+
+import (
+	"testing"
+	"time"
+
+	"github.com/benharold/libdrag/pkg/config"
+	"github.com/benharold/libdrag/pkg/events"
+	"github.com/benharold/libdrag/pkg/timers"
+)
+
+func testTrack() config.TrackConfig {
+	track := config.NewDefaultConfig().Track()
+	track.Hardware = config.HardwareMap{Channels: map[int]config.HardwareChannel{
+		1: {Kind: config.ChannelBeam, Lane: 1, ID: "60_foot"},
+		2: {Kind: config.ChannelBeam, Lane: 1, ID: "stage"},
+		3: {Kind: config.ChannelBeam, Lane: 2, ID: "stage"},
+		9: {Kind: config.ChannelBulb, Lane: 1, ID: "green"},
+	}}
+	return track
+}
+
+func TestNewWizard(t *testing.T) {
+	wizard, err := NewWizard(events.NewEventBus(false), testTrack(), Config{})
+	if err != nil {
+		t.Fatalf("NewWizard failed: %v", err)
+	}
+	if step, ok := wizard.Current(); !ok || step.Channel != 2 {
+		t.Errorf("Expected lane 1 stage (channel 2) first, got %+v", step)
+	}
+
+	track := testTrack()
+	track.Hardware.Channels = map[int]config.HardwareChannel{9: {Kind: config.ChannelBulb, Lane: 1, ID: "green"}}
+	if _, err := NewWizard(events.NewEventBus(false), track, Config{}); err == nil {
+		t.Error("Expected an error with no beams wired")
+	}
+
+	track.Hardware.Channels[4] = config.HardwareChannel{Kind: config.ChannelBeam, Lane: 3, ID: "stage"}
+	if _, err := NewWizard(events.NewEventBus(false), track, Config{}); err == nil {
+		t.Error("Expected an invalid hardware map to be rejected")
+	}
+}
+
+func TestWizardRun(t *testing.T) {
+	bus := events.NewEventBus(false)
+	wheel := timers.NewVirtualWheel(time.Now(), timers.DefaultTick)
+	wizard, err := NewWizard(bus, testTrack(), Config{})
+	if err != nil {
+		t.Fatalf("NewWizard failed: %v", err)
+	}
+	wizard.SetClock(wheel)
+
+	var prompts []int
+	var measured []Measurement
+	bus.Subscribe(events.EventCalibrationPrompt, func(e events.Event) {
+		prompts = append(prompts, e.Data["channel"].(int))
+	})
+	bus.Subscribe(events.EventCalibrationMeasured, func(e events.Event) {
+		measured = append(measured, e.Data["measurement"].(Measurement))
+	})
+	var completed *Report
+	wizard.OnComplete(func(report Report) { completed = &report })
+	wizard.Start()
+
+	block := func(channel int, latency time.Duration) {
+		t.Helper()
+		if err := wizard.Signal(channel, true, wheel.Now().Add(-latency)); err != nil {
+			t.Fatalf("Signal(%d) failed: %v", channel, err)
+		}
+	}
+
+	// Lane 1 stage, with chatter while settling and a stray lane 2 signal
+	block(2, 4*time.Millisecond)
+	block(2, 0)
+	if err := wizard.Signal(2, false, time.Time{}); err != nil {
+		t.Fatalf("Signal failed: %v", err)
+	}
+	if err := wizard.Signal(3, true, time.Time{}); err != nil {
+		t.Fatalf("Signal failed: %v", err)
+	}
+	wheel.Advance(DefaultSettle + timers.DefaultTick)
+
+	block(3, 7*time.Millisecond)
+	wheel.Advance(DefaultSettle + timers.DefaultTick)
+
+	// A driver that cannot timestamp leaves the latency unmeasured
+	if err := wizard.Signal(1, true, time.Time{}); err != nil {
+		t.Fatalf("Signal failed: %v", err)
+	}
+	wheel.Advance(DefaultSettle + timers.DefaultTick)
+
+	if len(prompts) != 3 || prompts[0] != 2 || prompts[1] != 3 || prompts[2] != 1 {
+		t.Errorf("Expected prompts for channels 2, 3, 1, got %v", prompts)
+	}
+	if len(measured) != 3 || measured[0].Latency != 4*time.Millisecond || measured[0].Noise != 2 {
+		t.Fatalf("Unexpected measurements %+v", measured)
+	}
+	if completed == nil {
+		t.Fatal("Expected OnComplete to be called")
+	}
+	if _, ok := wizard.Current(); ok {
+		t.Error("Expected no current step after completion")
+	}
+
+	offsets := map[int]time.Duration{2: 4 * time.Millisecond, 3: 7 * time.Millisecond, 1: 0}
+	for channel, offset := range offsets {
+		if got := completed.Hardware.Channels[channel].Offset; got != offset {
+			t.Errorf("Channel %d: expected offset %v, got %v", channel, offset, got)
+		}
+	}
+	if n := completed.Measurements[1].Noise; n != 1 {
+		t.Errorf("Expected the stray lane 2 signal to count as channel 3 noise, got %d", n)
+	}
+	if err := wizard.Signal(2, true, time.Time{}); err == nil {
+		t.Error("Expected signals after completion to be rejected")
+	}
+}
+
+func TestWizardUnknownChannel(t *testing.T) {
+	wizard, err := NewWizard(events.NewEventBus(false), testTrack(), Config{})
+	if err != nil {
+		t.Fatalf("NewWizard failed: %v", err)
+	}
+	wizard.Start()
+	if err := wizard.Signal(42, true, time.Time{}); err == nil {
+		t.Error("Expected an unmapped channel to be rejected")
+	}
+}
@@ -0,0 +1,498 @@
+// Package chaos injects faults into libdrag components, beam sources and
+// simulated passes: slow or failing lifecycle calls, late or lost events,
+// and beams that miss a car. Integrators use it in tests and chaos drills
+// to rehearse how their front ends and procedures cope with a timing system
+// failing the way real ones do.
+package chaos
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/benharold/libdrag/pkg/beam"
+	"github.com/benharold/libdrag/pkg/component"
+	"github.com/benharold/libdrag/pkg/config"
+	"github.com/benharold/libdrag/pkg/events"
+	"github.com/benharold/libdrag/pkg/simulation"
+	"github.com/benharold/libdrag/pkg/timers"
+)
+
+// Op is an operation a fault can be injected into
+type Op string
+
+const (
+	OpInitialize    Op = "initialize"
+	OpArm           Op = "arm"
+	OpEmergencyStop Op = "emergency_stop"
+	OpPublish       Op = "publish" // An event published by a wrapped component
+	OpReading       Op = "reading" // A reading from a wrapped beam source
+	OpSplit         Op = "split"   // A beam crossing of a wrapped simulator's pass
+)
+
+// Fault describes a failure to inject. Filters left empty match everything.
+type Fault struct {
+	Op Op `json:"op"`
+
+	// Component is the ID of the component faulted (e.g. "timing_system");
+	// empty faults every wrapped component
+	Component string `json:"component,omitempty"`
+
+	// Delay holds up the operation: a lifecycle call returns late, an event
+	// or reading is delivered late, a beam sees the car late
+	Delay time.Duration `json:"delay,omitempty"`
+
+	// Err fails a lifecycle call without running it
+	Err error `json:"-"`
+
+	// Drop loses an event, reading or beam crossing altogether
+	Drop bool `json:"drop,omitempty"`
+
+	EventTypes []events.EventType `json:"event_types,omitempty"` // Events faulted (OpPublish)
+	Lanes      []int              `json:"lanes,omitempty"`       // Lanes faulted (OpPublish, OpSplit)
+	Channels   []int              `json:"channels,omitempty"`    // Source channels faulted (OpReading)
+	BeamIDs    []string           `json:"beam_ids,omitempty"`    // Beams faulted (OpSplit)
+
+	Probability float64 `json:"probability,omitempty"` // Chance a matching operation is faulted; zero faults every one
+	Count       int     `json:"count,omitempty"`       // Operations faulted before the fault clears; zero until removed
+}
+
+// validate checks a fault can be injected into its operation
+func (f Fault) validate() error {
+	switch f.Op {
+	case OpInitialize, OpArm, OpEmergencyStop:
+		if f.Drop {
+			return fmt.Errorf("%s calls cannot be dropped", f.Op)
+		}
+	case OpPublish, OpReading, OpSplit:
+		if f.Err != nil {
+			return fmt.Errorf("%s faults cannot return errors", f.Op)
+		}
+	default:
+		return fmt.Errorf("unknown operation %q", f.Op)
+	}
+	if f.Delay < 0 || f.Count < 0 || f.Probability < 0 || f.Probability > 1 {
+		return errors.New("delay, count and probability must be in range")
+	}
+	if f.Delay == 0 && f.Err == nil && !f.Drop {
+		return errors.New("fault needs a delay, an error or a drop")
+	}
+	return nil
+}
+
+// injected is a fault in effect
+type injected struct {
+	id        int
+	fault     Fault
+	remaining int // Operations left to fault; zero is unlimited
+}
+
+// Injector holds the faults in effect for everything it wraps. Faults can
+// be injected and removed at any time, so a drill can break a running race.
+type Injector struct {
+	mu     sync.Mutex
+	faults []*injected
+	nextID int
+	rng    *rand.Rand
+	bus    *events.EventBus // fault.injected reports; nil reports nothing
+	clock  timers.Clock     // Nil runs on the default wheel
+}
+
+// NewInjector creates an injector with no faults. Probabilistic faults are
+// drawn from a source seeded with seed, so a seed replays the same drill.
+func NewInjector(seed int64) *Injector {
+	return &Injector{rng: rand.New(rand.NewSource(seed))}
+}
+
+// SetEventBus publishes a fault.injected event each time a fault strikes
+func (inj *Injector) SetEventBus(bus *events.EventBus) {
+	inj.mu.Lock()
+	defer inj.mu.Unlock()
+	inj.bus = bus
+}
+
+// SetClock times delays on clock instead of the default wheel
+func (inj *Injector) SetClock(clock timers.Clock) {
+	inj.mu.Lock()
+	defer inj.mu.Unlock()
+	inj.clock = clock
+}
+
+// Inject puts a fault into effect and returns a function removing it
+func (inj *Injector) Inject(f Fault) (func(), error) {
+	if err := f.validate(); err != nil {
+		return nil, err
+	}
+	inj.mu.Lock()
+	defer inj.mu.Unlock()
+	inj.nextID++
+	id := inj.nextID
+	inj.faults = append(inj.faults, &injected{id: id, fault: f, remaining: f.Count})
+	return func() { inj.remove(id) }, nil
+}
+
+// remove takes a fault out of effect
+func (inj *Injector) remove(id int) {
+	inj.mu.Lock()
+	defer inj.mu.Unlock()
+	for i, in := range inj.faults {
+		if in.id == id {
+			inj.faults = append(inj.faults[:i:i], inj.faults[i+1:]...)
+			return
+		}
+	}
+}
+
+// Clear removes every fault
+func (inj *Injector) Clear() {
+	inj.mu.Lock()
+	defer inj.mu.Unlock()
+	inj.faults = nil
+}
+
+// Faults returns the faults in effect, in the order injected, each with
+// the operations it has left to fault as its Count
+func (inj *Injector) Faults() []Fault {
+	inj.mu.Lock()
+	defer inj.mu.Unlock()
+	faults := make([]Fault, 0, len(inj.faults))
+	for _, in := range inj.faults {
+		f := in.fault
+		f.Count = in.remaining
+		faults = append(faults, f)
+	}
+	return faults
+}
+
+// strike returns the first fault in effect for op that matches and wins
+// its roll, using up one of its operations
+func (inj *Injector) strike(op Op, matches func(Fault) bool) (Fault, bool) {
+	inj.mu.Lock()
+	defer inj.mu.Unlock()
+	for i, in := range inj.faults {
+		if in.fault.Op != op || !matches(in.fault) {
+			continue
+		}
+		if in.fault.Probability > 0 && inj.rng.Float64() >= in.fault.Probability {
+			continue
+		}
+		if in.remaining > 0 {
+			if in.remaining--; in.remaining == 0 {
+				inj.faults = append(inj.faults[:i:i], inj.faults[i+1:]...)
+			}
+		}
+		return in.fault, true
+	}
+	return Fault{}, false
+}
+
+// report publishes a fault striking
+func (inj *Injector) report(f Fault, raceID string, lane int, data map[string]interface{}) {
+	inj.mu.Lock()
+	bus := inj.bus
+	inj.mu.Unlock()
+	if bus == nil {
+		return
+	}
+	builder := events.NewEvent(events.EventFaultInjected).
+		WithRaceID(raceID).
+		WithLane(lane).
+		WithData("op", f.Op).
+		WithData("dropped", f.Drop)
+	if f.Delay > 0 {
+		builder.WithData("delay", f.Delay.Seconds())
+	}
+	if f.Err != nil {
+		builder.WithData("error", f.Err.Error())
+	}
+	for key, value := range data {
+		builder.WithData(key, value)
+	}
+	bus.Publish(builder.Build())
+}
+
+// later runs f after a fault's delay
+func (inj *Injector) later(delay time.Duration, raceID string, f func()) {
+	inj.mu.Lock()
+	clock := inj.clock
+	inj.mu.Unlock()
+	timers.Or(clock).AfterFunc(delay, timers.Label{Name: "chaos.delay", RaceID: raceID}, f)
+}
+
+// Wrap returns c with the injector's faults for its ID. The wrapper passes
+// everything else through, and the orchestrator sees through it (see
+// component.Unwrap), so a wrapped timing system or tree can run a race.
+func (inj *Injector) Wrap(c component.Component) component.Component {
+	return &faultyComponent{inj: inj, inner: c}
+}
+
+// faultyComponent is a component wrapped by an injector
+type faultyComponent struct {
+	inj   *Injector
+	inner component.Component
+
+	mu      sync.Mutex
+	raceID  string
+	bus     *events.EventBus // Where the component's events go
+	private *events.EventBus // What the component publishes to
+	clock   timers.Clock
+}
+
+// Unwrap returns the wrapped component
+func (w *faultyComponent) Unwrap() component.Component {
+	return w.inner
+}
+
+func (w *faultyComponent) GetID() string {
+	return w.inner.GetID()
+}
+
+func (w *faultyComponent) GetStatus() component.ComponentStatus {
+	return w.inner.GetStatus()
+}
+
+func (w *faultyComponent) Initialize(ctx context.Context, cfg config.Config) error {
+	if err := w.lifecycle(OpInitialize); err != nil {
+		return err
+	}
+	return w.inner.Initialize(ctx, cfg)
+}
+
+func (w *faultyComponent) Arm(ctx context.Context) error {
+	if err := w.lifecycle(OpArm); err != nil {
+		return err
+	}
+	return w.inner.Arm(ctx)
+}
+
+func (w *faultyComponent) EmergencyStop() error {
+	if err := w.lifecycle(OpEmergencyStop); err != nil {
+		return err
+	}
+	return w.inner.EmergencyStop()
+}
+
+// lifecycle applies a fault to a lifecycle call: it waits out the delay,
+// then returns the fault's error, if any, in place of the call
+func (w *faultyComponent) lifecycle(op Op) error {
+	f, ok := w.inj.strike(op, w.applies)
+	if !ok {
+		return nil
+	}
+	w.mu.Lock()
+	raceID, clock := w.raceID, w.clock
+	w.mu.Unlock()
+
+	w.inj.report(f, raceID, 0, map[string]interface{}{"component": w.inner.GetID()})
+	if f.Delay > 0 {
+		timers.Or(clock).Sleep(f.Delay, timers.Label{Name: "chaos.delay", RaceID: raceID})
+	}
+	return f.Err
+}
+
+// applies reports whether a fault is for this component
+func (w *faultyComponent) applies(f Fault) bool {
+	return f.Component == "" || f.Component == w.inner.GetID()
+}
+
+// SetEventBus gives the component a bus of its own, whose events are
+// passed on to bus unless a fault holds them up or drops them
+func (w *faultyComponent) SetEventBus(bus *events.EventBus) {
+	eventAware, ok := w.inner.(component.EventAwareComponent)
+	if !ok {
+		return
+	}
+	w.mu.Lock()
+	w.bus = bus
+	if w.private == nil {
+		w.private = events.NewEventBus(false)
+		w.private.SubscribeAll(w.forward)
+	}
+	private := w.private
+	w.mu.Unlock()
+	eventAware.SetEventBus(private)
+}
+
+// forward passes on an event the component published
+func (w *faultyComponent) forward(e events.Event) {
+	w.mu.Lock()
+	bus := w.bus
+	w.mu.Unlock()
+	if bus == nil {
+		return
+	}
+
+	f, ok := w.inj.strike(OpPublish, func(f Fault) bool {
+		return w.applies(f) && containsType(f.EventTypes, e.Type) && containsInt(f.Lanes, e.Lane)
+	})
+	if !ok {
+		bus.Publish(e)
+		return
+	}
+	w.inj.report(f, e.RaceID, e.Lane, map[string]interface{}{"component": w.inner.GetID(), "event_type": e.Type})
+	if f.Drop {
+		return
+	}
+	// The event keeps the time it was published at, as a late delivery would
+	w.inj.later(f.Delay, e.RaceID, func() { bus.Publish(e) })
+}
+
+func (w *faultyComponent) SetRaceID(raceID string) {
+	w.mu.Lock()
+	w.raceID = raceID
+	w.mu.Unlock()
+	if eventAware, ok := w.inner.(component.EventAwareComponent); ok {
+		eventAware.SetRaceID(raceID)
+	}
+}
+
+func (w *faultyComponent) SetClock(clock timers.Clock) {
+	w.mu.Lock()
+	w.clock = clock
+	w.mu.Unlock()
+	if clockAware, ok := w.inner.(component.ClockAwareComponent); ok {
+		clockAware.SetClock(clock)
+	}
+}
+
+func (w *faultyComponent) SetLogger(logger *slog.Logger) {
+	if loggerAware, ok := w.inner.(component.LoggerAwareComponent); ok {
+		loggerAware.SetLogger(logger)
+	}
+}
+
+// Source returns src with the injector's reading faults: readings on a
+// faulted channel are lost or arrive late, as from a failing sensor or a
+// congested link. A late reading keeps the time the driver stamped it with.
+func (inj *Injector) Source(src beam.BeamSource) beam.BeamSource {
+	return &faultySource{inj: inj, src: src}
+}
+
+type faultySource struct {
+	inj *Injector
+	src beam.BeamSource
+}
+
+// Run runs the wrapped source, faulting its readings
+func (s *faultySource) Run(ctx context.Context, emit func(beam.Reading)) error {
+	// Late readings are emitted from the wheel, so emits are serialized
+	// here to keep the one-at-a-time promise
+	var mu sync.Mutex
+	done := false
+	send := func(r beam.Reading) {
+		mu.Lock()
+		defer mu.Unlock()
+		if !done {
+			emit(r)
+		}
+	}
+
+	err := s.src.Run(ctx, func(r beam.Reading) {
+		f, ok := s.inj.strike(OpReading, func(f Fault) bool { return containsInt(f.Channels, r.Channel) })
+		if !ok {
+			send(r)
+			return
+		}
+		s.inj.report(f, "", 0, map[string]interface{}{"channel": r.Channel, "broken": r.Broken})
+		if !f.Drop {
+			s.inj.later(f.Delay, "", func() { send(r) })
+		}
+	})
+
+	mu.Lock()
+	done = true
+	mu.Unlock()
+	return err
+}
+
+// Simulator returns sim with the injector's split faults: a dropped beam
+// misses the car (a quarter mile drop also loses the speed trap, which is
+// placed from it) and a late one sees it late
+func (inj *Injector) Simulator(sim simulation.Simulator) simulation.Simulator {
+	return &faultySimulator{inj: inj, sim: sim}
+}
+
+type faultySimulator struct {
+	inj *Injector
+	sim simulation.Simulator
+}
+
+func (s *faultySimulator) Staging(lane int) simulation.Staging {
+	return s.sim.Staging(lane)
+}
+
+// Pass faults the splits of the wrapped simulator's pass
+func (s *faultySimulator) Pass(lane int) simulation.Pass {
+	pass := s.sim.Pass(lane)
+	splits := []struct {
+		beamID string
+		at     *time.Duration
+	}{
+		{simulation.BeamSixtyFoot, &pass.SixtyFoot},
+		{simulation.BeamThreeThirty, &pass.ThreeThirty},
+		{simulation.BeamEighthMile, &pass.EighthMile},
+		{simulation.BeamThousandFoot, &pass.ThousandFoot},
+		{simulation.BeamQuarterMile, &pass.QuarterMile},
+	}
+	for _, split := range splits {
+		if *split.at == 0 {
+			continue
+		}
+		f, ok := s.inj.strike(OpSplit, func(f Fault) bool {
+			return containsInt(f.Lanes, lane) && containsString(f.BeamIDs, split.beamID)
+		})
+		if !ok {
+			continue
+		}
+		s.inj.report(f, "", lane, map[string]interface{}{"beam_id": split.beamID})
+		if f.Drop {
+			*split.at = 0
+		} else {
+			*split.at += f.Delay
+		}
+	}
+	return pass
+}
+
+// containsType reports whether types is empty or holds t
+func containsType(types []events.EventType, t events.EventType) bool {
+	if len(types) == 0 {
+		return true
+	}
+	for _, candidate := range types {
+		if candidate == t {
+			return true
+		}
+	}
+	return false
+}
+
+// containsInt reports whether values is empty or holds v
+func containsInt(values []int, v int) bool {
+	if len(values) == 0 {
+		return true
+	}
+	for _, candidate := range values {
+		if candidate == v {
+			return true
+		}
+	}
+	return false
+}
+
+// containsString reports whether values is empty or holds v
+func containsString(values []string, v string) bool {
+	if len(values) == 0 {
+		return true
+	}
+	for _, candidate := range values {
+		if candidate == v {
+			return true
+		}
+	}
+	return false
+}
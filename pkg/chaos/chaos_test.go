@@ -0,0 +1,271 @@
+package chaos
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/benharold/libdrag/pkg/beam"
+	"github.com/benharold/libdrag/pkg/component"
+	"github.com/benharold/libdrag/pkg/config"
+	"github.com/benharold/libdrag/pkg/events"
+	"github.com/benharold/libdrag/pkg/simulation"
+	"github.com/benharold/libdrag/pkg/tree"
+)
+
+// publisher is an event-aware component that publishes on demand
+type publisher struct {
+	mu     sync.Mutex
+	bus    *events.EventBus
+	raceID string
+	armed  int
+}
+
+func (p *publisher) GetID() string                                   { return "publisher" }
+func (p *publisher) Initialize(context.Context, config.Config) error { return nil }
+func (p *publisher) EmergencyStop() error                            { return nil }
+func (p *publisher) GetStatus() component.ComponentStatus {
+	return component.ComponentStatus{ID: "publisher"}
+}
+func (p *publisher) SetRaceID(raceID string) { p.raceID = raceID }
+
+func (p *publisher) Arm(context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.armed++
+	return nil
+}
+
+func (p *publisher) SetEventBus(bus *events.EventBus) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.bus = bus
+}
+
+func (p *publisher) publish(eventType events.EventType, lane int) {
+	p.mu.Lock()
+	bus := p.bus
+	p.mu.Unlock()
+	bus.Publish(events.NewEvent(eventType).WithRaceID(p.raceID).WithLane(lane).Build())
+}
+
+// replaySource emits its readings, then waits to be cancelled
+type replaySource struct {
+	readings []beam.Reading
+}
+
+func (s *replaySource) Run(ctx context.Context, emit func(beam.Reading)) error {
+	for _, r := range s.readings {
+		emit(r)
+	}
+	<-ctx.Done()
+	return nil
+}
+
+func TestLifecycleFaults(t *testing.T) {
+	inj := NewInjector(1)
+	bus := events.NewEventBus(false)
+	inj.SetEventBus(bus)
+	var reports []events.Event
+	bus.Subscribe(events.EventFaultInjected, func(e events.Event) { reports = append(reports, e) })
+
+	inner := &publisher{}
+	wrapped := inj.Wrap(inner)
+	if component.Unwrap(wrapped) != inner {
+		t.Fatal("Expected Unwrap to find the wrapped component")
+	}
+
+	armFailure := errors.New("controller not responding")
+	if _, err := inj.Inject(Fault{Op: OpArm, Component: "publisher", Err: armFailure, Delay: 30 * time.Millisecond, Count: 1}); err != nil {
+		t.Fatalf("Inject failed: %v", err)
+	}
+	if _, err := inj.Inject(Fault{Op: OpArm, Component: "timing_system", Err: armFailure}); err != nil {
+		t.Fatalf("Inject failed: %v", err)
+	}
+
+	start := time.Now()
+	if err := wrapped.Arm(context.Background()); err != armFailure {
+		t.Errorf("Expected the injected error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 30*time.Millisecond {
+		t.Errorf("Expected Arm to be delayed 30ms, took %v", elapsed)
+	}
+	if inner.armed != 0 {
+		t.Error("Expected a failed Arm not to reach the component")
+	}
+	if err := wrapped.Arm(context.Background()); err != nil {
+		t.Errorf("Expected the fault to clear after one call, got %v", err)
+	}
+	if inner.armed != 1 {
+		t.Errorf("Expected the component to be armed once, got %d", inner.armed)
+	}
+	if faults := inj.Faults(); len(faults) != 1 || faults[0].Component != "timing_system" {
+		t.Errorf("Expected only the timing system fault left, got %+v", faults)
+	}
+
+	if len(reports) != 1 || reports[0].Data["component"] != "publisher" || reports[0].Data["error"] != armFailure.Error() {
+		t.Errorf("Expected one fault.injected report for the arm, got %+v", reports)
+	}
+}
+
+func TestPublishFaults(t *testing.T) {
+	inj := NewInjector(1)
+	bus := events.NewEventBus(false)
+	var mu sync.Mutex
+	var delivered []events.Event
+	bus.SubscribeAll(func(e events.Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		delivered = append(delivered, e)
+	})
+
+	inner := &publisher{}
+	wrapped := inj.Wrap(inner).(component.EventAwareComponent)
+	wrapped.SetEventBus(bus)
+	wrapped.SetRaceID("race-1")
+
+	inj.Inject(Fault{Op: OpPublish, EventTypes: []events.EventType{events.EventBeamBroken}, Lanes: []int{1}, Drop: true})
+	inj.Inject(Fault{Op: OpPublish, EventTypes: []events.EventType{events.EventBeamRestored}, Delay: 30 * time.Millisecond})
+
+	inner.publish(events.EventBeamBroken, 1)
+	inner.publish(events.EventBeamBroken, 2)
+	inner.publish(events.EventBeamRestored, 2)
+	inner.publish(events.EventTreeStage, 1)
+
+	mu.Lock()
+	if len(delivered) != 2 || delivered[0].Lane != 2 || delivered[1].Type != events.EventTreeStage {
+		t.Errorf("Expected the lane 1 break dropped and the restore held back, got %+v", delivered)
+	}
+	mu.Unlock()
+
+	time.Sleep(100 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	if len(delivered) != 3 || delivered[2].Type != events.EventBeamRestored {
+		t.Fatalf("Expected the restore delivered late, got %+v", delivered)
+	}
+	if late := delivered[2]; late.RaceID != "race-1" || late.Timestamp.After(delivered[1].Timestamp) {
+		t.Errorf("Expected the late event to keep its race and publish time, got %+v", late)
+	}
+}
+
+func TestSourceFaults(t *testing.T) {
+	inj := NewInjector(1)
+	inj.Inject(Fault{Op: OpReading, Channels: []int{3}, Drop: true})
+	inj.Inject(Fault{Op: OpReading, Channels: []int{4}, Delay: 20 * time.Millisecond, Count: 1})
+
+	src := inj.Source(&replaySource{readings: []beam.Reading{
+		{Channel: 3, Broken: true},
+		{Channel: 4, Broken: true},
+		{Channel: 5, Broken: true},
+		{Channel: 4, Broken: false},
+	}})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	var mu sync.Mutex
+	var got []beam.Reading
+	src.Run(ctx, func(r beam.Reading) {
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, r)
+	})
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(got) != 3 {
+		t.Fatalf("Expected channel 3 dropped, got %+v", got)
+	}
+	if got[0].Channel != 5 || got[1].Channel != 4 || got[1].Broken || got[2].Channel != 4 || !got[2].Broken {
+		t.Errorf("Expected the first channel 4 reading to arrive last, got %+v", got)
+	}
+}
+
+func TestSimulatorFaults(t *testing.T) {
+	inj := NewInjector(1)
+	inj.Inject(Fault{Op: OpSplit, Lanes: []int{2}, BeamIDs: []string{simulation.BeamQuarterMile}, Drop: true})
+	inj.Inject(Fault{Op: OpSplit, Lanes: []int{1}, BeamIDs: []string{simulation.BeamSixtyFoot}, Delay: 100 * time.Millisecond})
+
+	sim := inj.Simulator(simulation.Reference())
+	left, right := sim.Pass(1), sim.Pass(2)
+	if left.SixtyFoot != 1050*time.Millisecond || left.QuarterMile != 7300*time.Millisecond {
+		t.Errorf("Expected lane 1's 60 foot beam late, got %+v", left)
+	}
+	if right.QuarterMile != 0 || right.EighthMile != 4350*time.Millisecond {
+		t.Errorf("Expected lane 2's finish beam to miss, got %+v", right)
+	}
+}
+
+func TestProbability(t *testing.T) {
+	run := func() []bool {
+		inj := NewInjector(7)
+		inj.Inject(Fault{Op: OpSplit, Drop: true, Probability: 0.5})
+		sim := inj.Simulator(simulation.Reference())
+		var missed []bool
+		for i := 0; i < 20; i++ {
+			missed = append(missed, sim.Pass(1).QuarterMile == 0)
+		}
+		return missed
+	}
+	first, second := run(), run()
+	some, all := false, true
+	for i := range first {
+		if first[i] != second[i] {
+			t.Fatal("Expected a seed to replay the same faults")
+		}
+		some = some || first[i]
+		all = all && first[i]
+	}
+	if !some || all {
+		t.Errorf("Expected about half the finishes missed, got %v", first)
+	}
+}
+
+func TestInjectValidation(t *testing.T) {
+	invalid := map[string]Fault{
+		"unknown operation": {Op: "reboot", Drop: true},
+		"dropped arm":       {Op: OpArm, Drop: true},
+		"failing publish":   {Op: OpPublish, Err: errors.New("x")},
+		"no effect":         {Op: OpReading},
+		"probability":       {Op: OpSplit, Drop: true, Probability: 1.5},
+	}
+	inj := NewInjector(1)
+	for name, f := range invalid {
+		if _, err := inj.Inject(f); err == nil {
+			t.Errorf("Expected %s to be rejected", name)
+		}
+	}
+
+	remove, err := inj.Inject(Fault{Op: OpArm, Err: errors.New("x")})
+	if err != nil {
+		t.Fatalf("Inject failed: %v", err)
+	}
+	inj.Inject(Fault{Op: OpSplit, Drop: true})
+	remove()
+	if faults := inj.Faults(); len(faults) != 1 || faults[0].Op != OpSplit {
+		t.Errorf("Expected only the split fault left, got %+v", faults)
+	}
+	inj.Clear()
+	if len(inj.Faults()) != 0 {
+		t.Error("Expected Clear to remove every fault")
+	}
+}
+
+func TestWrappedTree(t *testing.T) {
+	inj := NewInjector(1)
+	christmasTree := tree.NewChristmasTree()
+	wrapped := inj.Wrap(christmasTree)
+	if err := wrapped.Initialize(context.Background(), config.NewDefaultConfig()); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	stopFailure := errors.New("relay stuck")
+	inj.Inject(Fault{Op: OpEmergencyStop, Component: wrapped.GetID(), Err: stopFailure})
+	if err := wrapped.EmergencyStop(); err != stopFailure {
+		t.Errorf("Expected the tree's emergency stop to fail, got %v", err)
+	}
+	if wrapped.GetStatus().Status == "emergency_stopped" {
+		t.Error("Expected the failed emergency stop not to reach the tree")
+	}
+}
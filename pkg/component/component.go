@@ -2,9 +2,11 @@ package component
 
 import (
 	"context"
+	"log/slog"
 
 	"github.com/benharold/libdrag/pkg/config"
 	"github.com/benharold/libdrag/pkg/events"
+	"github.com/benharold/libdrag/pkg/timers"
 )
 
 // ComponentStatus represents the current state of a component
@@ -30,3 +32,36 @@ type EventAwareComponent interface {
 	SetEventBus(eventBus *events.EventBus)
 	SetRaceID(raceID string)
 }
+
+// ClockAwareComponent extends Component with an injectable clock. Without
+// one, components run on the default timer wheel.
+type ClockAwareComponent interface {
+	Component
+	SetClock(clock timers.Clock)
+}
+
+// LoggerAwareComponent extends Component with an injectable logger.
+// Without one, components log to logs.Default.
+type LoggerAwareComponent interface {
+	Component
+	SetLogger(logger *slog.Logger)
+}
+
+// Wrapper is a component decorating another, such as a fault injector. The
+// orchestrator recognizes the timing system and tree through wrappers.
+type Wrapper interface {
+	Component
+	Unwrap() Component
+}
+
+// Unwrap returns the component c wraps, through any number of wrappers, or
+// c itself when it is not a wrapper
+func Unwrap(c Component) Component {
+	for {
+		wrapper, ok := c.(Wrapper)
+		if !ok {
+			return c
+		}
+		c = wrapper.Unwrap()
+	}
+}
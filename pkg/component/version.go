@@ -0,0 +1,28 @@
+package component
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// VersionedMutex is a sync.RWMutex that counts its write locks. A component
+// guarding its state with one changes state only under the write lock, so
+// the count is a version of that state: a reader that took the version
+// before reading the state can skip re-serializing it until the version
+// moves. A write lock that leaves the state as it was still bumps the
+// version, which only costs the reader one unneeded read.
+type VersionedMutex struct {
+	sync.RWMutex
+	version atomic.Uint64
+}
+
+// Lock locks for writing and bumps the version
+func (m *VersionedMutex) Lock() {
+	m.RWMutex.Lock()
+	m.version.Add(1)
+}
+
+// Version returns the number of write locks taken
+func (m *VersionedMutex) Version() uint64 {
+	return m.version.Load()
+}
@@ -1,6 +1,10 @@
 package config
 
-import "time"
+import (
+	"fmt"
+	"sort"
+	"time"
+)
 
 // Config holds system-wide configuration
 type Config interface {
@@ -17,21 +21,75 @@ type TrackConfig struct {
 	LaneCount  int                   `json:"lane_count"`  // Number of lanes
 	LaneWidth  float64               `json:"lane_width"`  // Width of each lane
 	BeamLayout map[string]BeamConfig `json:"beam_layout"` // Beam positions
+	Hardware   HardwareMap           `json:"hardware"`    // Controller channel wiring
 }
 
+// GuardBeamOffset is the distance of the guard beam past the stage beam in
+// feet (13 3/8 inches). A car that breaks it before green has rolled in too
+// deep and red-lights.
+const GuardBeamOffset = 13.375 / 12
+
 // BeamConfig defines timing beam specifications
 type BeamConfig struct {
 	Name     string  `json:"name"`
 	Position float64 `json:"position"` // Distance from starting line
 	Height   float64 `json:"height"`   // Height above track
 	Lane     int     `json:"lane"`     // Which lane (0 = both)
+
+	// Shutdown marks optional beams past the finish line, used for
+	// track-clear detection and over-run alerts
+	Shutdown bool    `json:"shutdown,omitempty"`
+	MaxSpeed float64 `json:"max_speed,omitempty"` // Over-run alert when a car reaches a shutdown beam faster than this (mph)
 }
 
 // TimingConfig defines timing system parameters
 type TimingConfig struct {
-	Precision       time.Duration `json:"precision"`         // Timing precision
-	SpeedTrapLength float64       `json:"speed_trap_length"` // Speed trap distance
-	AutoStart       bool          `json:"auto_start"`        // Auto-start timing on stage
+	Precision         time.Duration `json:"precision"`           // Timing precision
+	SpeedTrapLength   float64       `json:"speed_trap_length"`   // Speed trap distance
+	AutoStart         bool          `json:"auto_start"`          // Auto-start timing on stage
+	PhotoFinishWindow time.Duration `json:"photo_finish_window"` // Finishes this close go to official review (0 = never)
+	FoulPrecedence    []string      `json:"foul_precedence"`     // Order fouls are ruled in (empty = sanctioning default)
+	FinalizeTimeout   time.Duration `json:"finalize_timeout"`    // Longest completion waits for every lane's finish (0 = no wait)
+	FoulDisplay       FoulDisplay   `json:"foul_display"`        // What scoreboards, slips and run summaries show for a fouled lane (empty = show)
+
+	// MinBeamBreak is the shortest beam break accepted as a trigger; shorter
+	// breaks (debris, noise) are rejected. Low front splitters and motorcycle
+	// wheels break beams only briefly, so classes can lower it.
+	MinBeamBreak      time.Duration            `json:"min_beam_break"`
+	ClassMinBeamBreak map[string]time.Duration `json:"class_min_beam_break"` // Racing class -> minimum
+
+	// Trap speeds above these limits (mph) send the run to tech review, to
+	// catch cars faster than their class or the driver's license allows
+	ClassMaxTrapSpeed   map[string]float64 `json:"class_max_trap_speed,omitempty"`   // Racing class -> maximum expected
+	LicenseMaxTrapSpeed map[string]float64 `json:"license_max_trap_speed,omitempty"` // License category -> maximum allowed
+}
+
+// MinBeamBreakFor returns the minimum valid beam break for a racing class
+func (c TimingConfig) MinBeamBreakFor(class string) time.Duration {
+	if minimum, ok := c.ClassMinBeamBreak[class]; ok {
+		return minimum
+	}
+	return c.MinBeamBreak
+}
+
+// MaxTrapSpeedFor returns the maximum expected trap speed for a racing
+// class, or 0 when the class has no limit
+func (c TimingConfig) MaxTrapSpeedFor(class string) float64 {
+	return c.ClassMaxTrapSpeed[class]
+}
+
+// FoulDisplay is a track's convention for a lane that fouled: some tracks
+// show its ET as run, others blank it since it does not count
+type FoulDisplay string
+
+const (
+	FoulDisplayShow  FoulDisplay = "show"  // Show the lane's times
+	FoulDisplayBlank FoulDisplay = "blank" // Blank the lane's ET, speed and package; the reaction time still shows a red light
+)
+
+// Blanks reports whether a fouled lane's ET is blanked
+func (d FoulDisplay) Blanks() bool {
+	return d == FoulDisplayBlank
 }
 
 // TreeSequenceType defines different starting sequences
@@ -40,15 +98,123 @@ type TreeSequenceType string
 const (
 	TreeSequencePro       TreeSequenceType = "pro"       // All ambers simultaneously
 	TreeSequenceSportsman TreeSequenceType = "sportsman" // Sequential ambers
+
+	// TreeSequenceStartSignal races without a tree, started by an external
+	// signal (arm drop, flashlight, button) for outlaw events
+	TreeSequenceStartSignal TreeSequenceType = "start_signal"
 )
 
 // TreeSequenceConfig defines timing for tree sequences
 type TreeSequenceConfig struct {
 	Type            TreeSequenceType `json:"type"`
-	AmberDelay      time.Duration    `json:"amber_delay"` // Time between ambers (sportsman)
-	GreenDelay      time.Duration    `json:"green_delay"` // Time from last amber to green
+	Preset          TreePreset       `json:"preset,omitempty"` // Preset the timing came from; cleared when it is changed
+	AmberDelay      time.Duration    `json:"amber_delay"`      // Time between ambers (sportsman)
+	GreenDelay      time.Duration    `json:"green_delay"`      // Time from last amber to green
 	PreStageTimeout time.Duration    `json:"pre_stage_timeout"`
 	StageTimeout    time.Duration    `json:"stage_timeout"`
+
+	// ArmDelayMin and ArmDelayMax are the window the auto-start system
+	// draws its random delay from both cars staged to the ambers in. Zero
+	// keeps the auto-start system's own setting.
+	ArmDelayMin time.Duration `json:"arm_delay_min,omitempty"`
+	ArmDelayMax time.Duration `json:"arm_delay_max,omitempty"`
+}
+
+// TreePreset names a standard tree timing
+type TreePreset string
+
+const (
+	TreePresetPro400       TreePreset = "pro_400"       // Pro tree: all three ambers, green 0.400 s later
+	TreePresetSportsman500 TreePreset = "sportsman_500" // Full tree: ambers 0.500 s apart, green 0.500 s after the last
+	TreePresetJrDragster   TreePreset = "jr_dragster"   // Full .500 tree, on the sportsman arming window
+	TreePresetProMod400    TreePreset = "pro_mod_400"   // Pro .400, all three ambers flashing together, on the sportsman arming window
+)
+
+// treePresets are the presets' timing, per the NHRA rulebook. Timeouts are
+// not part of a preset and keep the track's.
+var treePresets = map[TreePreset]TreeSequenceConfig{
+	TreePresetPro400: {
+		Type:        TreeSequencePro,
+		GreenDelay:  400 * time.Millisecond,
+		ArmDelayMin: 600 * time.Millisecond,
+		ArmDelayMax: 1100 * time.Millisecond,
+	},
+	TreePresetSportsman500: {
+		Type:        TreeSequenceSportsman,
+		AmberDelay:  500 * time.Millisecond,
+		GreenDelay:  500 * time.Millisecond,
+		ArmDelayMin: 600 * time.Millisecond,
+		ArmDelayMax: 1400 * time.Millisecond,
+	},
+	TreePresetJrDragster: {
+		Type:        TreeSequenceSportsman,
+		AmberDelay:  500 * time.Millisecond,
+		GreenDelay:  500 * time.Millisecond,
+		ArmDelayMin: 600 * time.Millisecond,
+		ArmDelayMax: 1400 * time.Millisecond,
+	},
+	TreePresetProMod400: {
+		Type:        TreeSequencePro,
+		GreenDelay:  400 * time.Millisecond,
+		ArmDelayMin: 600 * time.Millisecond,
+		ArmDelayMax: 1400 * time.Millisecond,
+	},
+}
+
+// TreePresetConfig returns a preset's tree timing
+func TreePresetConfig(preset TreePreset) (TreeSequenceConfig, error) {
+	cfg, ok := treePresets[preset]
+	if !ok {
+		return TreeSequenceConfig{}, fmt.Errorf("unknown tree preset %q", preset)
+	}
+	cfg.Preset = preset
+	return cfg, nil
+}
+
+// TreePresets returns the preset names, sorted
+func TreePresets() []TreePreset {
+	presets := make([]TreePreset, 0, len(treePresets))
+	for preset := range treePresets {
+		presets = append(presets, preset)
+	}
+	sort.Slice(presets, func(i, j int) bool { return presets[i] < presets[j] })
+	return presets
+}
+
+// Override returns the tree profile with every set field of override
+// applied. An override naming a preset applies the preset's timing first,
+// then its other set fields; an unknown preset is ignored.
+func (c TreeSequenceConfig) Override(override TreeSequenceConfig) TreeSequenceConfig {
+	if preset, err := TreePresetConfig(override.Preset); err == nil {
+		c.Type, c.Preset, c.AmberDelay, c.GreenDelay = preset.Type, preset.Preset, preset.AmberDelay, preset.GreenDelay
+		c.ArmDelayMin, c.ArmDelayMax = preset.ArmDelayMin, preset.ArmDelayMax
+	}
+	before := c
+	if override.Type != "" {
+		c.Type = override.Type
+	}
+	if override.AmberDelay != 0 {
+		c.AmberDelay = override.AmberDelay
+	}
+	if override.GreenDelay != 0 {
+		c.GreenDelay = override.GreenDelay
+	}
+	if c.Type != before.Type || c.AmberDelay != before.AmberDelay || c.GreenDelay != before.GreenDelay {
+		c.Preset = ""
+	}
+	if override.PreStageTimeout != 0 {
+		c.PreStageTimeout = override.PreStageTimeout
+	}
+	if override.StageTimeout != 0 {
+		c.StageTimeout = override.StageTimeout
+	}
+	if override.ArmDelayMin != 0 {
+		c.ArmDelayMin = override.ArmDelayMin
+	}
+	if override.ArmDelayMax != 0 {
+		c.ArmDelayMax = override.ArmDelayMax
+	}
+	return c
 }
 
 // SafetyConfig defines safety system parameters
@@ -56,6 +222,8 @@ type SafetyConfig struct {
 	EmergencyStopEnabled bool          `json:"emergency_stop_enabled"`
 	MaxReactionTime      time.Duration `json:"max_reaction_time"`
 	MinStagingTime       time.Duration `json:"min_staging_time"`
+	RequireTrackClear    bool          `json:"require_track_clear"`  // Tree cannot be armed until the track is confirmed clear
+	MotionHistoryLimit   int           `json:"motion_history_limit"` // Staging motions kept per lane for review (0 = tree default)
 }
 
 // DefaultConfig implements Config interface
@@ -107,6 +275,12 @@ func NewDefaultConfig() *DefaultConfig {
 					Height:   8, // 8 inches above track
 					Lane:     0, // Both lanes
 				},
+				"guard": {
+					Name:     "Guard",
+					Position: GuardBeamOffset, // 13 3/8 inches past the stage beam
+					Height:   8,
+					Lane:     0,
+				},
 				"60_foot": {
 					Name:     "60 Foot",
 					Position: 60,
@@ -119,6 +293,12 @@ func NewDefaultConfig() *DefaultConfig {
 					Height:   8,
 					Lane:     0,
 				},
+				"eighth_trap": {
+					Name:     "Eighth Mile Speed Trap",
+					Position: 594, // 66 feet before the eighth mile
+					Height:   8,
+					Lane:     0,
+				},
 				"660_foot": {
 					Name:     "660 Foot (Eighth Mile)",
 					Position: 660,
@@ -131,18 +311,42 @@ func NewDefaultConfig() *DefaultConfig {
 					Height:   8,
 					Lane:     0,
 				},
+				"speed_trap": {
+					Name:     "Quarter Mile Speed Trap",
+					Position: 1254, // 66 feet before the finish line
+					Height:   8,
+					Lane:     0,
+				},
 				"1320_foot": {
 					Name:     "1320 Foot (Quarter Mile)",
 					Position: 1320,
 					Height:   8,
 					Lane:     0,
 				},
+				"shutdown": {
+					Name:     "Shutdown Area",
+					Position: 2320, // 1000 feet past the finish line
+					Height:   8,
+					Lane:     0,
+					Shutdown: true,
+					MaxSpeed: 100,
+				},
+				"turnout": {
+					Name:     "Turnout",
+					Position: 2820,
+					Height:   8,
+					Lane:     0,
+					Shutdown: true,
+					MaxSpeed: 40,
+				},
 			},
 		},
 		TimingConfig: TimingConfig{
-			Precision:       time.Microsecond,
-			SpeedTrapLength: 66, // 66 feet for speed trap calculation
-			AutoStart:       true,
+			Precision:         time.Microsecond,
+			SpeedTrapLength:   66, // 66 feet for speed trap calculation
+			AutoStart:         true,
+			PhotoFinishWindow: 500 * time.Microsecond, // 0.0005 seconds
+			FinalizeTimeout:   2 * time.Second,
 		},
 		TreeConfig: TreeSequenceConfig{
 			Type:            TreeSequencePro,        // Default to Pro tree
@@ -1,6 +1,10 @@
 package config
 
 import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
@@ -46,6 +50,40 @@ func TestTreeConfig(t *testing.T) {
 	}
 }
 
+// TestTreePresets tests applying tree presets over a track's tree
+func TestTreePresets(t *testing.T) {
+	track := NewDefaultConfig().Tree()
+
+	sportsman := track.Override(TreeSequenceConfig{Preset: TreePresetSportsman500})
+	if sportsman.Type != TreeSequenceSportsman || sportsman.AmberDelay != 500*time.Millisecond || sportsman.GreenDelay != 500*time.Millisecond {
+		t.Errorf("Expected a full .500 tree, got %+v", sportsman)
+	}
+	if sportsman.Preset != TreePresetSportsman500 || sportsman.ArmDelayMin != 600*time.Millisecond || sportsman.ArmDelayMax != 1400*time.Millisecond {
+		t.Errorf("Expected the preset's arming window, got %+v", sportsman)
+	}
+	if sportsman.StageTimeout != track.StageTimeout {
+		t.Error("Expected the track's timeouts kept")
+	}
+
+	// Changing the preset's timing no longer runs the preset
+	if custom := sportsman.Override(TreeSequenceConfig{GreenDelay: 400 * time.Millisecond}); custom.Preset != "" {
+		t.Errorf("Expected a changed green delay to clear the preset, got %+v", custom)
+	}
+	if longer := sportsman.Override(TreeSequenceConfig{StageTimeout: time.Minute}); longer.Preset != TreePresetSportsman500 {
+		t.Errorf("Expected a timeout change to keep the preset, got %+v", longer)
+	}
+	if proMod := track.Override(TreeSequenceConfig{Preset: TreePresetProMod400}); proMod.Type != TreeSequencePro || proMod.GreenDelay != 400*time.Millisecond {
+		t.Errorf("Expected a pro .400 tree, got %+v", proMod)
+	}
+
+	if _, err := TreePresetConfig("pro_300"); err == nil {
+		t.Error("Expected an unknown preset to be rejected")
+	}
+	if len(TreePresets()) != 4 {
+		t.Errorf("Expected four presets, got %v", TreePresets())
+	}
+}
+
 func TestBeamConfigValidation(t *testing.T) {
 	cfg := NewDefaultConfig()
 	trackConfig := cfg.Track()
@@ -68,3 +106,210 @@ func TestBeamConfigValidation(t *testing.T) {
 		t.Fatal("Quarter mile beam should be at 1320 feet")
 	}
 }
+
+func TestHardwareMap(t *testing.T) {
+	track := NewDefaultConfig().Track()
+	hardware := HardwareMap{Channels: map[int]HardwareChannel{
+		0:  {Kind: ChannelBeam, Lane: 1, ID: "stage"},
+		1:  {Kind: ChannelBeam, Lane: 2, ID: "stage"},
+		16: {Kind: ChannelBulb, Lane: 1, ID: "green"},
+	}}
+	if err := hardware.Validate(track); err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+	if wiring, ok := hardware.Lookup(1); !ok || wiring.Lane != 2 || wiring.ID != "stage" {
+		t.Errorf("Expected channel 1 to be lane 2's stage beam, got %+v", wiring)
+	}
+	if channel, ok := hardware.ChannelFor(ChannelBulb, 1, "green"); !ok || channel != 16 {
+		t.Errorf("Expected lane 1's green on channel 16, got %d", channel)
+	}
+
+	// Swapping a failed sensor to a spare channel
+	delete(hardware.Channels, 0)
+	hardware.Channels[7] = HardwareChannel{Kind: ChannelBeam, Lane: 1, ID: "stage"}
+	if channel, _ := hardware.ChannelFor(ChannelBeam, 1, "stage"); channel != 7 {
+		t.Errorf("Expected lane 1's stage beam on channel 7, got %d", channel)
+	}
+
+	// Sensors along the track watch the same boundary
+	hardware.Channels[24] = HardwareChannel{Kind: ChannelBoundary, Lane: 1, ID: BoundaryCenterline}
+	hardware.Channels[25] = HardwareChannel{Kind: ChannelBoundary, Lane: 1, ID: BoundaryCenterline}
+	if err := hardware.Validate(track); err != nil {
+		t.Errorf("Expected a boundary watched by two sensors, got %v", err)
+	}
+
+	for name, bad := range map[string]HardwareChannel{
+		"lane off the track": {Kind: ChannelBeam, Lane: 3, ID: "stage"},
+		"unknown beam":       {Kind: ChannelBeam, Lane: 1, ID: "500_foot"},
+		"unnamed bulb":       {Kind: ChannelBulb, Lane: 1},
+		"unknown boundary":   {Kind: ChannelBoundary, Lane: 1, ID: "grass"},
+		"unknown kind":       {Kind: "relay", Lane: 1, ID: "stage"},
+		"wired twice":        {Kind: ChannelBeam, Lane: 2, ID: "stage"},
+	} {
+		invalid := HardwareMap{Channels: map[int]HardwareChannel{1: {Kind: ChannelBeam, Lane: 2, ID: "stage"}, 9: bad}}
+		if err := invalid.Validate(track); err == nil {
+			t.Errorf("%s: expected a validation error", name)
+		}
+	}
+}
+
+func TestLoadFromFile(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	cfg, err := LoadFromFile(write("track.json", `{
+		"racing_class": "Super Gas",
+		"track": {"lane_count": 4},
+		"tree": {"type": "sportsman", "green_delay": "500ms"},
+		"timing": {"class_min_beam_break": {"Motorcycle": "2ms"}, "foul_display": "blank"}
+	}`))
+	if err != nil {
+		t.Fatalf("LoadFromFile failed: %v", err)
+	}
+	if cfg.RacingClass() != "Super Gas" || cfg.Track().LaneCount != 4 || cfg.Tree().GreenDelay != 500*time.Millisecond {
+		t.Errorf("Expected the file's settings, got %+v", cfg)
+	}
+	if cfg.Tree().StageTimeout != 10*time.Second || len(cfg.Track().BeamLayout) != len(NewDefaultConfig().Track().BeamLayout) {
+		t.Error("Expected settings the file leaves out to keep their defaults")
+	}
+	if cfg.Timing().MinBeamBreakFor("Motorcycle") != 2*time.Millisecond {
+		t.Errorf("Expected the class beam break parsed, got %v", cfg.Timing().ClassMinBeamBreak)
+	}
+	if !cfg.Timing().FoulDisplay.Blanks() {
+		t.Errorf("Expected fouled lanes blanked, got %q", cfg.Timing().FoulDisplay)
+	}
+
+	// An eighth-mile track describes its own beams
+	cfg, err = LoadFromFile(write("eighth.yaml", `
+track:
+  length: 660
+  lane_count: 2
+  beam_layout:
+    pre_stage: {name: Pre-Stage, position: -7}
+    stage: {name: Stage, position: 0}
+    60_foot: {name: 60 Foot, position: 60}
+    660_foot: {name: Finish, position: 660}
+  hardware:
+    channels:
+      0: {kind: beam, lane: 1, id: stage, offset: 150us}
+tree:
+  green_delay: 400000000
+`))
+	if err != nil {
+		t.Fatalf("LoadFromFile failed: %v", err)
+	}
+	if len(cfg.Track().BeamLayout) != 4 || cfg.Track().Length != 660 {
+		t.Errorf("Expected the file's beam layout to replace the default, got %+v", cfg.Track().BeamLayout)
+	}
+	if wiring, ok := cfg.Track().Hardware.Lookup(0); !ok || wiring.Offset != 150*time.Microsecond {
+		t.Errorf("Expected channel 0 wired with its offset, got %+v", wiring)
+	}
+
+	_, err = LoadFromFile(write("bad.yml", `
+track:
+  lane_count: 1
+  beam_layout:
+    stage: {position: 0}
+    60_foot: {position: 330}
+    330_foot: {position: 60}
+tree:
+  green_delay: 0s
+`))
+	if err == nil {
+		t.Fatal("Expected an invalid track to be rejected")
+	}
+	for _, want := range []string{"track.lane_count", "330_foot at 60 ft must be past 60_foot", "tree.green_delay"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected %q in %v", want, err)
+		}
+	}
+
+	for name, content := range map[string]string{
+		"typo.json":     `{"track": {"lane_cont": 2}}`,
+		"duration.json": `{"tree": {"green_delay": "soon"}}`,
+		"display.json":  `{"timing": {"foul_display": "hide"}}`,
+		"track.toml":    `lane_count = 2`,
+	} {
+		if _, err := LoadFromFile(write(name, content)); err == nil {
+			t.Errorf("Expected %s to be rejected", name)
+		}
+	}
+	if err := NewDefaultConfig().Validate(); err != nil {
+		t.Errorf("Expected the default config to be valid, got %v", err)
+	}
+
+	// A tree preset is applied under the file's own tree settings
+	cfg, err = LoadFromFile(write("preset.json", `{"tree": {"preset": "jr_dragster", "arm_delay_max": "1.6s"}}`))
+	if err != nil {
+		t.Fatalf("LoadFromFile failed: %v", err)
+	}
+	if tree := cfg.Tree(); tree.Preset != TreePresetJrDragster || tree.Type != TreeSequenceSportsman || tree.GreenDelay != 500*time.Millisecond || tree.ArmDelayMax != 1600*time.Millisecond {
+		t.Errorf("Expected the Jr. Dragster tree with a longer arming window, got %+v", tree)
+	}
+	for name, content := range map[string]string{
+		"preset.yaml": "tree:\n  preset: pro_300\n",
+		"window.json": `{"tree": {"arm_delay_min": "2s", "arm_delay_max": "1s"}}`,
+	} {
+		if _, err := LoadFromFile(write(name, content)); err == nil {
+			t.Errorf("Expected %s to be rejected", name)
+		}
+	}
+}
+
+func TestRenderLayout(t *testing.T) {
+	track := NewDefaultConfig().Track()
+	track.BeamLayout["lane_2_stop"] = BeamConfig{Name: "Stop <2>", Position: 1320, Lane: 2, Shutdown: true}
+
+	layout := track.Layout()
+	if len(layout.Beams) != len(track.BeamLayout) {
+		t.Fatalf("Expected %d beams, got %d", len(track.BeamLayout), len(layout.Beams))
+	}
+	if first := layout.Beams[0]; first.ID != "pre_stage" || first.FromPrevious != 0 || len(first.Lanes) != 2 {
+		t.Errorf("Expected the pre-stage beam first across both lanes, got %+v", first)
+	}
+	for i, beam := range layout.Beams {
+		if beam.ID == "60_foot" && beam.FromPrevious != 60-GuardBeamOffset {
+			t.Errorf("Expected 60 foot measured from the guard beam, got %v", beam.FromPrevious)
+		}
+		if beam.ID == "lane_2_stop" && (layout.Beams[i-1].ID != "1320_foot" || len(beam.Lanes) != 1 || beam.Lanes[0] != 2) {
+			t.Errorf("Expected the lane 2 beam after the finish beam at the same position, got %+v", beam)
+		}
+	}
+
+	data, err := RenderLayout(track, LayoutJSON)
+	if err != nil {
+		t.Fatalf("RenderLayout failed: %v", err)
+	}
+	var decoded Layout
+	if err := json.Unmarshal(data, &decoded); err != nil || len(decoded.Beams) != len(layout.Beams) {
+		t.Errorf("Expected the layout as JSON, got %s: %v", data, err)
+	}
+
+	data, err = RenderLayout(track, LayoutSVG)
+	if err != nil {
+		t.Fatalf("RenderLayout failed: %v", err)
+	}
+	svg := string(data)
+	if !strings.HasPrefix(svg, "<svg") || !strings.HasSuffix(svg, "</svg>\n") {
+		t.Errorf("Expected an SVG document, got %s", svg)
+	}
+	// One line per lane each beam crosses: two for most, one for lane 2's
+	if lines := strings.Count(svg, `class="beam"`); lines != 2*(len(track.BeamLayout)-1)+1 {
+		t.Errorf("Expected %d beam lines, got %d", 2*(len(track.BeamLayout)-1)+1, lines)
+	}
+	for _, want := range []string{"Guard 1.11 ft", "Stop &lt;2&gt; 1320 ft", "Lane 2"} {
+		if !strings.Contains(svg, want) {
+			t.Errorf("Expected %q in the diagram", want)
+		}
+	}
+
+	if _, err := RenderLayout(track, "png"); err == nil {
+		t.Error("Expected an unknown format to be rejected")
+	}
+}
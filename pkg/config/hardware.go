@@ -0,0 +1,103 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// Hardware channel kinds
+const (
+	ChannelBeam     = "beam"     // Sensor input
+	ChannelBulb     = "bulb"     // Tree light output
+	ChannelBoundary = "boundary" // Boundary sensor input
+)
+
+// Boundaries a car can cross out of its lane, the IDs of boundary channels
+const (
+	BoundaryCenterline = "centerline"
+	BoundaryOutside    = "outside" // The lane's outside boundary (guard wall side)
+)
+
+// HardwareChannel is what a controller channel is wired to
+type HardwareChannel struct {
+	Kind string `json:"kind"` // ChannelBeam, ChannelBulb or ChannelBoundary
+	Lane int    `json:"lane"`
+	ID   string `json:"id"` // Beam ID from the beam layout, tree light ("pre_stage", "amber_1", "green", ...) or boundary
+
+	// Offset is the channel's calibrated response latency, from the sensor
+	// seeing a beam to the driver receiving it
+	Offset time.Duration `json:"offset,omitempty"`
+}
+
+// Correct returns when the sensor saw a signal the driver received at
+// received, removing the channel's calibrated latency
+func (c HardwareChannel) Correct(received time.Time) time.Time {
+	return received.Add(-c.Offset)
+}
+
+// HardwareMap maps the timing controller's channels to lanes, beams and
+// bulbs. Hardware drivers resolve channels through it, so moving a failed
+// sensor to a spare channel is a config change rather than a code change.
+type HardwareMap struct {
+	Channels map[int]HardwareChannel `json:"channels,omitempty"` // Controller channel -> wiring
+}
+
+// Lookup returns what a controller channel is wired to
+func (m HardwareMap) Lookup(channel int) (HardwareChannel, bool) {
+	wiring, ok := m.Channels[channel]
+	return wiring, ok
+}
+
+// ChannelFor returns the controller channel wired to a lane's beam or bulb
+func (m HardwareMap) ChannelFor(kind string, lane int, id string) (int, bool) {
+	for channel, wiring := range m.Channels {
+		if wiring.Kind == kind && wiring.Lane == lane && wiring.ID == id {
+			return channel, true
+		}
+	}
+	return 0, false
+}
+
+// Validate checks the map against the track: every channel is wired to a
+// lane on the track and a beam in its layout (or a named bulb or
+// boundary), and no beam or bulb is wired to two channels. A boundary runs
+// the length of the track, so any number of sensors may watch it.
+func (m HardwareMap) Validate(track TrackConfig) error {
+	type target struct {
+		kind string
+		lane int
+		id   string
+	}
+	seen := make(map[target]int, len(m.Channels))
+	for channel, wiring := range m.Channels {
+		if channel < 0 {
+			return fmt.Errorf("channel %d: channels cannot be negative", channel)
+		}
+		if wiring.Lane < 1 || wiring.Lane > track.LaneCount {
+			return fmt.Errorf("channel %d: lane %d is not on the track", channel, wiring.Lane)
+		}
+		switch wiring.Kind {
+		case ChannelBeam:
+			if _, ok := track.BeamLayout[wiring.ID]; !ok {
+				return fmt.Errorf("channel %d: unknown beam %q", channel, wiring.ID)
+			}
+		case ChannelBulb:
+			if wiring.ID == "" {
+				return fmt.Errorf("channel %d: bulb has no light", channel)
+			}
+		case ChannelBoundary:
+			if wiring.ID != BoundaryCenterline && wiring.ID != BoundaryOutside {
+				return fmt.Errorf("channel %d: unknown boundary %q", channel, wiring.ID)
+			}
+			continue
+		default:
+			return fmt.Errorf("channel %d: unknown kind %q", channel, wiring.Kind)
+		}
+		key := target{wiring.Kind, wiring.Lane, wiring.ID}
+		if other, ok := seen[key]; ok {
+			return fmt.Errorf("lane %d %s %q is wired to channels %d and %d", wiring.Lane, wiring.Kind, wiring.ID, min(other, channel), max(other, channel))
+		}
+		seen[key] = channel
+	}
+	return nil
+}
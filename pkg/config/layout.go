@@ -0,0 +1,193 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// LayoutFormat is a format RenderLayout draws a track in
+type LayoutFormat string
+
+const (
+	LayoutJSON LayoutFormat = "json" // The Layout, for UIs drawing their own
+	LayoutSVG  LayoutFormat = "svg"  // A to-scale diagram
+)
+
+// Layout is a track's lanes and beams in track order, as RenderLayout draws
+// them
+type Layout struct {
+	Length    float64      `json:"length"` // Finish line, feet from the starting line
+	LaneCount int          `json:"lane_count"`
+	LaneWidth float64      `json:"lane_width"`
+	Beams     []LayoutBeam `json:"beams"` // By position, then ID
+}
+
+// LayoutBeam is one beam of a Layout
+type LayoutBeam struct {
+	ID           string  `json:"id"`
+	Name         string  `json:"name"`
+	Position     float64 `json:"position"`      // Feet from the starting line
+	FromPrevious float64 `json:"from_previous"` // Feet from the beam before it (0 for the first)
+	Height       float64 `json:"height"`
+	Lanes        []int   `json:"lanes"` // Lanes the beam crosses
+	Shutdown     bool    `json:"shutdown,omitempty"`
+}
+
+// Layout returns the track's beams in track order with the distances
+// between them
+func (c TrackConfig) Layout() Layout {
+	layout := Layout{
+		Length:    c.Length,
+		LaneCount: c.LaneCount,
+		LaneWidth: c.LaneWidth,
+		Beams:     make([]LayoutBeam, 0, len(c.BeamLayout)),
+	}
+	for id, beam := range c.BeamLayout {
+		lanes := []int{beam.Lane}
+		if beam.Lane == 0 {
+			lanes = lanes[:0]
+			for lane := 1; lane <= c.LaneCount; lane++ {
+				lanes = append(lanes, lane)
+			}
+		}
+		layout.Beams = append(layout.Beams, LayoutBeam{
+			ID:       id,
+			Name:     beam.Name,
+			Position: beam.Position,
+			Height:   beam.Height,
+			Lanes:    lanes,
+			Shutdown: beam.Shutdown,
+		})
+	}
+	sort.Slice(layout.Beams, func(i, j int) bool {
+		if layout.Beams[i].Position != layout.Beams[j].Position {
+			return layout.Beams[i].Position < layout.Beams[j].Position
+		}
+		return layout.Beams[i].ID < layout.Beams[j].ID
+	})
+	for i := 1; i < len(layout.Beams); i++ {
+		layout.Beams[i].FromPrevious = layout.Beams[i].Position - layout.Beams[i-1].Position
+	}
+	return layout
+}
+
+// Diagram dimensions in pixels
+const (
+	layoutWidth     = 1200 // Drawn track, starting area to the last beam
+	layoutMargin    = 20
+	layoutLane      = 30 // Height of a lane
+	layoutLabelRow  = 14 // Height of a row of beam labels
+	layoutCharWidth = 6  // Rough width of a label character, to keep labels apart
+)
+
+// RenderLayout draws the track's beam layout as JSON (the track's Layout)
+// or as an SVG diagram to scale: the lanes down the track with the starting
+// and finish lines, and each beam across the lanes it covers, labeled with
+// its name and position. Beams too close to label on one row are staggered
+// onto rows above the track, so a misplaced beam in a custom layout stands
+// out.
+func RenderLayout(track TrackConfig, format LayoutFormat) ([]byte, error) {
+	layout := track.Layout()
+	switch format {
+	case LayoutJSON:
+		return json.MarshalIndent(layout, "", "  ")
+	case LayoutSVG:
+		return renderLayoutSVG(layout), nil
+	default:
+		return nil, fmt.Errorf("unknown layout format %q", format)
+	}
+}
+
+// renderLayoutSVG draws a layout as SVG
+func renderLayoutSVG(layout Layout) []byte {
+	// The drawing runs from the starting line or the first beam behind it to
+	// the finish line or the last beam past it
+	start, end := 0.0, layout.Length
+	for _, beam := range layout.Beams {
+		start = min(start, beam.Position)
+		end = max(end, beam.Position)
+	}
+	if end <= start {
+		end = start + 1
+	}
+	scale := layoutWidth / (end - start)
+	x := func(position float64) float64 {
+		return layoutMargin + (position-start)*scale
+	}
+
+	// Give each label the lowest row where it clears the label before it
+	type label struct {
+		text string
+		x    float64
+		row  int
+	}
+	var labels []label
+	var rowEnds []float64
+	for _, beam := range layout.Beams {
+		text := fmt.Sprintf("%s %s ft", beam.Name, strconv.FormatFloat(math.Round(beam.Position*100)/100, 'f', -1, 64))
+		left := x(beam.Position)
+		row := 0
+		for row < len(rowEnds) && left < rowEnds[row] {
+			row++
+		}
+		if row == len(rowEnds) {
+			rowEnds = append(rowEnds, 0)
+		}
+		rowEnds[row] = left + float64(len(text)*layoutCharWidth) + layoutCharWidth
+		labels = append(labels, label{text: text, x: left, row: row})
+	}
+
+	top := float64(layoutMargin + len(rowEnds)*layoutLabelRow)
+	bottom := top + float64(layout.LaneCount*layoutLane)
+	width := float64(layoutWidth + 2*layoutMargin)
+	for _, end := range rowEnds {
+		width = max(width, end+layoutMargin)
+	}
+	height := bottom + layoutMargin
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%.0f" height="%.0f" viewBox="0 0 %.0f %.0f" font-family="monospace" font-size="10">`+"\n", width, height, width, height)
+	fmt.Fprintf(&buf, `<rect width="100%%" height="100%%" fill="#ffffff"/>`+"\n")
+	for lane := 1; lane <= layout.LaneCount; lane++ {
+		y := top + float64((lane-1)*layoutLane)
+		fmt.Fprintf(&buf, `<rect class="lane" x="%.1f" y="%.1f" width="%.1f" height="%d" fill="#3a3a3a" stroke="#ffffff"/>`+"\n", x(start), y, x(end)-x(start), layoutLane)
+		fmt.Fprintf(&buf, `<text x="%.1f" y="%.1f" fill="#ffffff">Lane %d</text>`+"\n", x(start)+4, y+float64(layoutLane)/2+3, lane)
+	}
+	for _, line := range []float64{0, layout.Length} {
+		fmt.Fprintf(&buf, `<line class="line" x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="#ffffff" stroke-width="2"/>`+"\n", x(line), top, x(line), bottom)
+	}
+
+	for i, beam := range layout.Beams {
+		color, dash := "#e03030", ""
+		if beam.Shutdown {
+			color, dash = "#f09020", ` stroke-dasharray="4 2"`
+		}
+		bx := x(beam.Position)
+		for _, lane := range beam.Lanes {
+			if lane < 1 || lane > layout.LaneCount {
+				continue // Validate reports beams off the track
+			}
+			y := top + float64((lane-1)*layoutLane)
+			fmt.Fprintf(&buf, `<line class="beam" x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="%s" stroke-width="2"%s/>`+"\n", bx, y, bx, y+layoutLane, color, dash)
+		}
+
+		l := labels[i]
+		ly := top - 4 - float64(l.row*layoutLabelRow)
+		fmt.Fprintf(&buf, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="#999999"/>`+"\n", bx, ly+2, bx, top)
+		fmt.Fprintf(&buf, `<text x="%.1f" y="%.1f" fill="%s">%s</text>`+"\n", l.x+2, ly, color, escapeXML(l.text))
+	}
+	buf.WriteString("</svg>\n")
+	return buf.Bytes()
+}
+
+// escapeXML escapes text for an SVG text element
+func escapeXML(text string) string {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(text))
+	return buf.String()
+}
@@ -0,0 +1,308 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// durationFields are the duration settings of each section. Files may give
+// them as Go duration strings ("400ms", "1.5s") or as nanoseconds.
+var durationFields = map[string][]string{
+	"timing": {"precision", "photo_finish_window", "finalize_timeout", "min_beam_break"},
+	"tree":   {"amber_delay", "green_delay", "pre_stage_timeout", "stage_timeout", "arm_delay_min", "arm_delay_max"},
+	"safety": {"max_reaction_time", "min_staging_time"},
+}
+
+// beamOrder is the track order of the standard beams. Beams a layout has
+// must be placed in this order down the track.
+var beamOrder = []string{
+	"pre_stage", "stage", "guard", "60_foot", "330_foot", "eighth_trap",
+	"660_foot", "1000_foot", "speed_trap", "1320_foot",
+}
+
+// configFile is the file layout: the configuration's sections plus the
+// racing class
+type configFile struct {
+	RacingClass string `json:"racing_class"`
+	*DefaultConfig
+}
+
+// LoadFromFile loads a configuration from a JSON (.json) or YAML (.yaml,
+// .yml) file and validates it. Sections and settings the file leaves out
+// keep their NewDefaultConfig values, except the beam layout, which a file
+// that gives one replaces whole. Durations are Go duration strings or
+// nanoseconds. Unknown settings are errors, so a misspelled one is not
+// silently ignored.
+func LoadFromFile(path string) (*DefaultConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %v", err)
+	}
+
+	var doc interface{}
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".json":
+		err = json.Unmarshal(data, &doc)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &doc)
+		if err == nil {
+			doc, err = stringKeys(doc)
+		}
+	default:
+		return nil, fmt.Errorf("%s: unsupported config format %q (use .json, .yaml or .yml)", path, ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	cfg, err := decodeConfig(doc)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: invalid config:\n%v", path, err)
+	}
+	return cfg, nil
+}
+
+// decodeConfig applies a parsed file over the default configuration
+func decodeConfig(doc interface{}) (*DefaultConfig, error) {
+	root, ok := doc.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("config must be an object of sections")
+	}
+	if err := parseDurations(root); err != nil {
+		return nil, err
+	}
+
+	cfg := NewDefaultConfig()
+	if track, ok := root["track"].(map[string]interface{}); ok {
+		if _, ok := track["beam_layout"]; ok {
+			cfg.TrackConfig.BeamLayout = nil
+		}
+	}
+	// A tree preset is the starting point for the file's own tree settings
+	if tree, ok := root["tree"].(map[string]interface{}); ok {
+		if preset, ok := tree["preset"].(string); ok {
+			if _, err := TreePresetConfig(TreePreset(preset)); err != nil {
+				return nil, fmt.Errorf("tree.preset: %v", err)
+			}
+			cfg.TreeConfig = cfg.TreeConfig.Override(TreeSequenceConfig{Preset: TreePreset(preset)})
+		}
+	}
+	normalized, err := json.Marshal(root)
+	if err != nil {
+		return nil, err
+	}
+	file := configFile{RacingClass: cfg.RacingClass(), DefaultConfig: cfg}
+	decoder := json.NewDecoder(strings.NewReader(string(normalized)))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&file); err != nil {
+		return nil, err
+	}
+	cfg.SetRacingClass(file.RacingClass)
+	return cfg, nil
+}
+
+// parseDurations converts the duration strings in a parsed file to
+// nanoseconds
+func parseDurations(root map[string]interface{}) error {
+	parse := func(field string, value interface{}) (interface{}, error) {
+		text, ok := value.(string)
+		if !ok {
+			return value, nil
+		}
+		d, err := time.ParseDuration(text)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid duration %q", field, text)
+		}
+		return int64(d), nil
+	}
+
+	for section, fields := range durationFields {
+		settings, ok := root[section].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for _, field := range fields {
+			if value, ok := settings[field]; ok {
+				parsed, err := parse(section+"."+field, value)
+				if err != nil {
+					return err
+				}
+				settings[field] = parsed
+			}
+		}
+	}
+
+	if timing, ok := root["timing"].(map[string]interface{}); ok {
+		if classes, ok := timing["class_min_beam_break"].(map[string]interface{}); ok {
+			for class, value := range classes {
+				parsed, err := parse("timing.class_min_beam_break."+class, value)
+				if err != nil {
+					return err
+				}
+				classes[class] = parsed
+			}
+		}
+	}
+	if track, ok := root["track"].(map[string]interface{}); ok {
+		hardware, _ := track["hardware"].(map[string]interface{})
+		channels, _ := hardware["channels"].(map[string]interface{})
+		for channel, wiring := range channels {
+			settings, ok := wiring.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if value, ok := settings["offset"]; ok {
+				parsed, err := parse("track.hardware.channels."+channel+".offset", value)
+				if err != nil {
+					return err
+				}
+				settings["offset"] = parsed
+			}
+		}
+	}
+	return nil
+}
+
+// stringKeys converts YAML mappings to the string-keyed maps JSON has, so
+// numbered keys such as hardware channels decode the same from either
+func stringKeys(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			converted, err := stringKeys(item)
+			if err != nil {
+				return nil, err
+			}
+			v[key] = converted
+		}
+		return v, nil
+	case map[interface{}]interface{}:
+		converted := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			switch key.(type) {
+			case string, int, int64, uint64, float64, bool:
+			default:
+				return nil, fmt.Errorf("unsupported key %v", key)
+			}
+			item, err := stringKeys(item)
+			if err != nil {
+				return nil, err
+			}
+			converted[fmt.Sprint(key)] = item
+		}
+		return converted, nil
+	case []interface{}:
+		for i, item := range v {
+			converted, err := stringKeys(item)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = converted
+		}
+		return v, nil
+	}
+	return value, nil
+}
+
+// Validate checks the configuration describes a track libdrag can race: at
+// least two lanes, a stage beam, the standard beams in track order and
+// within the track (shutdown beams past it), positive tree delays, and
+// hardware wired to the layout. Every problem found is reported, one per
+// line.
+func (c *DefaultConfig) Validate() error {
+	var problems []error
+	fail := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Errorf(format, args...))
+	}
+
+	track := c.TrackConfig
+	if track.LaneCount < 2 {
+		fail("track.lane_count: must be at least 2, got %d", track.LaneCount)
+	}
+	if track.Length <= 0 {
+		fail("track.length: must be positive, got %g", track.Length)
+	}
+	if _, ok := track.BeamLayout["stage"]; !ok {
+		fail("track.beam_layout: missing the stage beam")
+	}
+	previous := ""
+	for _, id := range beamOrder {
+		beam, ok := track.BeamLayout[id]
+		if !ok {
+			continue
+		}
+		if previous != "" && beam.Position <= track.BeamLayout[previous].Position {
+			fail("track.beam_layout: %s at %g ft must be past %s at %g ft", id, beam.Position, previous, track.BeamLayout[previous].Position)
+		}
+		previous = id
+	}
+	ids := make([]string, 0, len(track.BeamLayout))
+	for id := range track.BeamLayout {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		beam := track.BeamLayout[id]
+		switch {
+		case beam.Lane < 0 || beam.Lane > track.LaneCount:
+			fail("track.beam_layout.%s: lane %d is not on the track", id, beam.Lane)
+		case beam.Shutdown && beam.Position <= track.Length:
+			fail("track.beam_layout.%s: shutdown beam at %g ft must be past the finish line at %g ft", id, beam.Position, track.Length)
+		case !beam.Shutdown && beam.Position > track.Length:
+			fail("track.beam_layout.%s: at %g ft is past the finish line at %g ft; mark it shutdown if it is in the shutdown area", id, beam.Position, track.Length)
+		}
+	}
+	if err := track.Hardware.Validate(track); err != nil {
+		fail("track.hardware: %v", err)
+	}
+
+	tree := c.TreeConfig
+	switch tree.Type {
+	case TreeSequencePro, TreeSequenceSportsman:
+		if tree.GreenDelay <= 0 {
+			fail("tree.green_delay: must be positive, got %v", tree.GreenDelay)
+		}
+	case TreeSequenceStartSignal:
+	default:
+		fail("tree.type: must be %q, %q or %q, got %q", TreeSequencePro, TreeSequenceSportsman, TreeSequenceStartSignal, tree.Type)
+	}
+	if tree.Type == TreeSequenceSportsman && tree.AmberDelay <= 0 {
+		fail("tree.amber_delay: must be positive on a sportsman tree, got %v", tree.AmberDelay)
+	}
+	if tree.AmberDelay < 0 || tree.PreStageTimeout < 0 || tree.StageTimeout < 0 || tree.ArmDelayMin < 0 || tree.ArmDelayMax < 0 {
+		fail("tree: delays and timeouts cannot be negative")
+	}
+	if tree.ArmDelayMax > 0 && tree.ArmDelayMin > tree.ArmDelayMax {
+		fail("tree.arm_delay_min: %v is over arm_delay_max %v", tree.ArmDelayMin, tree.ArmDelayMax)
+	}
+	if tree.Preset != "" {
+		if _, err := TreePresetConfig(tree.Preset); err != nil {
+			fail("tree.preset: %v", err)
+		}
+	}
+
+	timing := c.TimingConfig
+	if timing.SpeedTrapLength < 0 || timing.PhotoFinishWindow < 0 || timing.FinalizeTimeout < 0 || timing.MinBeamBreak < 0 {
+		fail("timing: lengths and durations cannot be negative")
+	}
+	switch timing.FoulDisplay {
+	case "", FoulDisplayShow, FoulDisplayBlank:
+	default:
+		fail("timing.foul_display: must be %q or %q, got %q", FoulDisplayShow, FoulDisplayBlank, timing.FoulDisplay)
+	}
+	if c.SafetyConfig.MaxReactionTime < 0 || c.SafetyConfig.MinStagingTime < 0 {
+		fail("safety: durations cannot be negative")
+	}
+	return errors.Join(problems...)
+}
@@ -0,0 +1,163 @@
+// Package downtrack detects when the previous pair has cleared the racing
+// surface from finish-line and shutdown-area beam activity.
+package downtrack
+
+import (
+	"sync"
+	"time"
+
+	"github.com/benharold/libdrag/pkg/events"
+	"github.com/benharold/libdrag/pkg/timers"
+)
+
+// Config selects the beams that show a car has left the racing surface
+type Config struct {
+	FinishBeam   string        `json:"finish_beam"`   // Defaults to "1320_foot"
+	ShutdownBeam string        `json:"shutdown_beam"` // Optional beam in the shutdown area; when set, cars must pass it
+	ClearDelay   time.Duration `json:"clear_delay"`   // Time after the last car passes before the surface counts as clear
+}
+
+// DefaultFinishBeam is the finish-line beam
+const DefaultFinishBeam = "1320_foot"
+
+// runState tracks the lanes of one race
+type runState struct {
+	started  map[int]bool // Lanes that left the starting line
+	passed   map[int]bool // Lanes past the clearing beam
+	complete bool
+}
+
+// Detector watches timing beam activity and calls onClear once every car
+// that left the starting line has passed the clearing beam of a completed
+// race. A car that never reaches it (broken, stopped on track) holds the
+// track until an official confirms it clear.
+type Detector struct {
+	mu          sync.Mutex
+	bus         *events.EventBus
+	config      Config
+	onClear     func(raceID string)
+	runs        map[string]*runState
+	timers      map[string]*timers.Timer
+	unsubscribe func()
+}
+
+// NewDetector creates a detector. onClear is called without locks held.
+func NewDetector(bus *events.EventBus, config Config, onClear func(raceID string)) *Detector {
+	if config.FinishBeam == "" {
+		config.FinishBeam = DefaultFinishBeam
+	}
+	return &Detector{
+		bus:     bus,
+		config:  config,
+		onClear: onClear,
+		runs:    make(map[string]*runState),
+		timers:  make(map[string]*timers.Timer),
+	}
+}
+
+// Start subscribes the detector to the bus
+func (d *Detector) Start() {
+	d.unsubscribe = d.bus.SubscribeAll(d.HandleEvent)
+}
+
+// Stop unsubscribes from the bus and cancels pending clears
+func (d *Detector) Stop() {
+	if d.unsubscribe != nil {
+		d.unsubscribe()
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for raceID, timer := range d.timers {
+		timer.Stop()
+		delete(d.timers, raceID)
+	}
+}
+
+// HandleEvent updates the detector from a single event
+func (d *Detector) HandleEvent(event events.Event) {
+	d.mu.Lock()
+	clear := d.record(event)
+	d.mu.Unlock()
+
+	if clear {
+		d.scheduleClear(event.RaceID)
+	}
+}
+
+// record updates a race's lanes and reports whether it just cleared
+func (d *Detector) record(event events.Event) bool {
+	if event.RaceID == "" {
+		return false
+	}
+
+	switch event.Type {
+	case events.EventRaceStart:
+		d.runs[event.RaceID] = &runState{started: make(map[int]bool), passed: make(map[int]bool)}
+		return false
+
+	case events.EventRaceAbort:
+		// Cars may still be anywhere on the track
+		delete(d.runs, event.RaceID)
+		return false
+	}
+
+	run, ok := d.runs[event.RaceID]
+	if !ok {
+		return false
+	}
+
+	switch event.Type {
+	case events.EventTimingBeamTrigger:
+		beamID, _ := event.Data["beam_id"].(string)
+		switch beamID {
+		case "stage":
+			run.started[event.Lane] = true
+		case d.clearingBeam():
+			run.passed[event.Lane] = true
+		}
+	case events.EventRaceComplete:
+		run.complete = true
+	default:
+		return false
+	}
+
+	if !run.complete || len(run.started) == 0 {
+		return false
+	}
+	for lane := range run.started {
+		if !run.passed[lane] {
+			return false
+		}
+	}
+	delete(d.runs, event.RaceID)
+	return true
+}
+
+// clearingBeam returns the beam every car must pass
+func (d *Detector) clearingBeam() string {
+	if d.config.ShutdownBeam != "" {
+		return d.config.ShutdownBeam
+	}
+	return d.config.FinishBeam
+}
+
+// scheduleClear reports the race clear after the configured delay
+func (d *Detector) scheduleClear(raceID string) {
+	if d.config.ClearDelay <= 0 {
+		d.onClear(raceID)
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.timers[raceID] = timers.Default().AfterFunc(d.config.ClearDelay, timers.Label{Name: "downtrack.clear", RaceID: raceID}, func() {
+		d.mu.Lock()
+		_, pending := d.timers[raceID]
+		delete(d.timers, raceID)
+		d.mu.Unlock()
+
+		if pending {
+			d.onClear(raceID)
+		}
+	})
+}
@@ -0,0 +1,93 @@
+package downtrack
+
+import (
+	"testing"
+	"time"
+
+	"github.com/benharold/libdrag/pkg/events"
+)
+
+func TestDetector(t *testing.T) {
+	cleared := make(chan string, 10)
+	detector := NewDetector(events.NewEventBus(false), Config{ShutdownBeam: "shutdown"}, func(raceID string) {
+		cleared <- raceID
+	})
+
+	publish := func(eventType events.EventType, raceID string, lane int, beamID string) {
+		builder := events.NewEvent(eventType).WithRaceID(raceID).WithLane(lane)
+		if beamID != "" {
+			builder.WithData("beam_id", beamID)
+		}
+		detector.HandleEvent(builder.Build())
+	}
+	expectClear := func(raceID string) {
+		t.Helper()
+		select {
+		case got := <-cleared:
+			if got != raceID {
+				t.Fatalf("Expected %s to clear, got %s", raceID, got)
+			}
+		default:
+			t.Fatalf("Expected %s to clear", raceID)
+		}
+	}
+	expectHeld := func() {
+		t.Helper()
+		select {
+		case got := <-cleared:
+			t.Fatalf("Unexpected clear for %s", got)
+		default:
+		}
+	}
+
+	// Both cars pass the finish, then the shutdown beam
+	publish(events.EventRaceStart, "race-1", 0, "")
+	for lane := 1; lane <= 2; lane++ {
+		publish(events.EventTimingBeamTrigger, "race-1", lane, "stage")
+		publish(events.EventTimingBeamTrigger, "race-1", lane, "1320_foot")
+	}
+	publish(events.EventRaceComplete, "race-1", 0, "")
+	publish(events.EventTimingBeamTrigger, "race-1", 1, "shutdown")
+	expectHeld()
+	publish(events.EventTimingBeamTrigger, "race-1", 2, "shutdown")
+	expectClear("race-1")
+
+	// A car that stops on track holds the track
+	publish(events.EventRaceStart, "race-2", 0, "")
+	publish(events.EventTimingBeamTrigger, "race-2", 1, "stage")
+	publish(events.EventTimingBeamTrigger, "race-2", 2, "stage")
+	publish(events.EventTimingBeamTrigger, "race-2", 1, "shutdown")
+	publish(events.EventRaceComplete, "race-2", 0, "")
+	expectHeld()
+
+	// Aborted races are never cleared automatically
+	publish(events.EventRaceStart, "race-3", 0, "")
+	publish(events.EventTimingBeamTrigger, "race-3", 1, "stage")
+	publish(events.EventRaceAbort, "race-3", 0, "")
+	publish(events.EventTimingBeamTrigger, "race-3", 1, "shutdown")
+	publish(events.EventRaceComplete, "race-3", 0, "")
+	expectHeld()
+}
+
+func TestDetectorClearDelay(t *testing.T) {
+	cleared := make(chan string, 1)
+	detector := NewDetector(events.NewEventBus(false), Config{ClearDelay: 20 * time.Millisecond}, func(raceID string) {
+		cleared <- raceID
+	})
+
+	detector.HandleEvent(events.NewEvent(events.EventRaceStart).WithRaceID("race-1").Build())
+	detector.HandleEvent(events.NewEvent(events.EventTimingBeamTrigger).WithRaceID("race-1").WithLane(1).WithData("beam_id", "stage").Build())
+	detector.HandleEvent(events.NewEvent(events.EventTimingBeamTrigger).WithRaceID("race-1").WithLane(1).WithData("beam_id", "1320_foot").Build())
+	detector.HandleEvent(events.NewEvent(events.EventRaceComplete).WithRaceID("race-1").Build())
+
+	select {
+	case <-cleared:
+		t.Fatal("Track should not clear before the delay")
+	default:
+	}
+	select {
+	case <-cleared:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the track to clear after the delay")
+	}
+}
@@ -0,0 +1,391 @@
+// Package eliminations runs single-elimination brackets: it builds an
+// NHRA-style ladder from a qualified field, follows each pair's race and
+// moves winners through the rounds as races complete.
+package eliminations
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/benharold/libdrag/pkg/events"
+	"github.com/benharold/libdrag/pkg/logs"
+)
+
+// Ladder is how qualifiers are paired in the first round
+type Ladder string
+
+const (
+	// LadderPro pairs the quickest qualifier with the slowest (1 v 16,
+	// 8 v 9, 4 v 13, ...), placed so the top two can only meet in the final
+	LadderPro Ladder = "pro"
+	// LadderSportsman pairs the top half of the field with the bottom half
+	// in qualifying order (1 v 9, 8 v 16, 4 v 12, ... for sixteen)
+	LadderSportsman Ladder = "sportsman"
+)
+
+// Pair statuses
+const (
+	PairWaiting = "waiting" // A seat is still to be filled by an earlier round
+	PairReady   = "ready"   // Both seats filled, no race assigned
+	PairRacing  = "racing"  // A race is deciding the pair
+	PairDecided = "decided"
+	PairBye     = "bye" // One entrant, who advances without racing
+)
+
+// Entry is a qualified entrant, listed in qualifying order
+type Entry struct {
+	Registration string `json:"registration"`   // Matches the race's driver registration
+	Name         string `json:"name,omitempty"` // Display name
+}
+
+// Seat is an entrant's place in a pair. An empty registration is a seat
+// still to be filled, or the missing opponent of a bye.
+type Seat struct {
+	Seed         int    `json:"seed,omitempty"` // Qualifying position
+	Registration string `json:"registration,omitempty"`
+	Name         string `json:"name,omitempty"`
+}
+
+// Pair is one race of a round
+type Pair struct {
+	ID     string  `json:"id"` // "R1P1" for round 1's first pair
+	Round  int     `json:"round"`
+	Seats  [2]Seat `json:"seats"`
+	Status string  `json:"status"`
+	RaceID string  `json:"race_id,omitempty"`
+	Winner string  `json:"winner,omitempty"` // Registration of the winner
+
+	index int            // Position in the round
+	lanes map[int]string // Lane -> registration in the assigned race
+}
+
+// Round is a round of the bracket, pairs in ladder order
+type Round struct {
+	Number int    `json:"number"`
+	Pairs  []Pair `json:"pairs"`
+}
+
+// State is a snapshot of a bracket
+type State struct {
+	Class    string  `json:"class,omitempty"`
+	Ladder   Ladder  `json:"ladder"`
+	Rounds   []Round `json:"rounds"`
+	Champion string  `json:"champion,omitempty"`
+}
+
+// Bracket tracks a single-elimination bracket. Races are assigned to pairs
+// with AssignRace; when one completes (or a photo finish is resolved) its
+// winner moves into the next round and eliminations.advance is published.
+// An aborted race frees its pair to be run again.
+type Bracket struct {
+	mu          sync.Mutex
+	bus         *events.EventBus
+	state       State
+	races       map[string]*Pair // Race ID -> pair it decides
+	unsubscribe []func()
+}
+
+// NewBracket builds a bracket for a field listed in qualifying order. Fields
+// that do not fill the ladder give byes to the top qualifiers.
+func NewBracket(bus *events.EventBus, class string, ladder Ladder, field []Entry) (*Bracket, error) {
+	if len(field) < 2 {
+		return nil, fmt.Errorf("eliminations need at least 2 entrants, got %d", len(field))
+	}
+	registrations := make(map[string]bool, len(field))
+	for i, entry := range field {
+		if entry.Registration == "" {
+			return nil, fmt.Errorf("entrant %d has no registration", i+1)
+		}
+		if registrations[entry.Registration] {
+			return nil, fmt.Errorf("%s is entered twice", entry.Registration)
+		}
+		registrations[entry.Registration] = true
+	}
+
+	size := 2
+	for size < len(field) {
+		size *= 2
+	}
+	var seeds [][2]int
+	switch ladder {
+	case LadderPro:
+		order := seedOrder(size)
+		for i := 0; i < len(order); i += 2 {
+			seeds = append(seeds, [2]int{order[i], order[i+1]})
+		}
+	case LadderSportsman:
+		for _, seed := range seedOrder(size / 2) {
+			seeds = append(seeds, [2]int{seed, seed + size/2})
+		}
+	default:
+		return nil, fmt.Errorf("unknown ladder %q", ladder)
+	}
+
+	b := &Bracket{
+		bus:   bus,
+		state: State{Class: class, Ladder: ladder},
+		races: make(map[string]*Pair),
+	}
+	for round, pairs := 1, len(seeds); pairs >= 1; round, pairs = round+1, pairs/2 {
+		r := Round{Number: round, Pairs: make([]Pair, pairs)}
+		for i := range r.Pairs {
+			r.Pairs[i] = Pair{ID: fmt.Sprintf("R%dP%d", round, i+1), Round: round, Status: PairWaiting, index: i}
+		}
+		b.state.Rounds = append(b.state.Rounds, r)
+	}
+
+	first := b.state.Rounds[0].Pairs
+	for i, pair := range seeds {
+		for seat, seed := range pair {
+			if seed <= len(field) {
+				entry := field[seed-1]
+				first[i].Seats[seat] = Seat{Seed: seed, Registration: entry.Registration, Name: entry.Name}
+			}
+		}
+		// Missing qualifiers are always the bottom seed of a pair
+		if first[i].Seats[1].Registration == "" {
+			first[i].Status = PairBye
+			b.advance(&first[i], first[i].Seats[0])
+		} else {
+			first[i].Status = PairReady
+		}
+	}
+	return b, nil
+}
+
+// seedOrder returns seeds 1..size in ladder order, so that seed 1 meets
+// size, and the top two seeds can only meet in the last round
+func seedOrder(size int) []int {
+	order := []int{1}
+	for n := 2; n <= size; n *= 2 {
+		next := make([]int, 0, n)
+		for _, seed := range order {
+			next = append(next, seed, n+1-seed)
+		}
+		order = next
+	}
+	return order
+}
+
+// Start follows race results on the bus
+func (b *Bracket) Start() {
+	b.unsubscribe = []func(){
+		b.bus.Subscribe(events.EventRaceComplete, b.HandleEvent),
+		b.bus.Subscribe(events.EventFinishResolved, b.HandleEvent),
+		b.bus.Subscribe(events.EventRaceAbort, b.HandleEvent),
+	}
+}
+
+// Stop stops following race results
+func (b *Bracket) Stop() {
+	for _, unsubscribe := range b.unsubscribe {
+		unsubscribe()
+	}
+	b.unsubscribe = nil
+}
+
+// AssignRace makes raceID the race that decides a pair. drivers maps each
+// lane to its driver's registration and must seat the pair's two entrants.
+func (b *Bracket) AssignRace(pairID string, raceID string, drivers map[int]string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	pair := b.pair(pairID)
+	if pair == nil {
+		return fmt.Errorf("pair %s not found", pairID)
+	}
+	if pair.Status != PairReady {
+		return fmt.Errorf("pair %s is %s", pairID, pair.Status)
+	}
+	seated := map[string]bool{pair.Seats[0].Registration: true, pair.Seats[1].Registration: true}
+	lanes := make(map[int]string, len(drivers))
+	for lane, registration := range drivers {
+		if !seated[registration] {
+			return fmt.Errorf("%s is not in pair %s", registration, pairID)
+		}
+		delete(seated, registration)
+		lanes[lane] = registration
+	}
+	if len(seated) > 0 {
+		return fmt.Errorf("race must seat both entrants of pair %s", pairID)
+	}
+
+	pair.Status = PairRacing
+	pair.RaceID = raceID
+	pair.lanes = lanes
+	b.races[raceID] = pair
+	return nil
+}
+
+// HandleEvent advances the winner of a completed or resolved race, and frees
+// the pair of an aborted one
+func (b *Bracket) HandleEvent(event events.Event) {
+	b.mu.Lock()
+	pair, ok := b.races[event.RaceID]
+	if !ok {
+		b.mu.Unlock()
+		return
+	}
+
+	var winnerLane int
+	switch event.Type {
+	case events.EventRaceComplete:
+		if underReview, _ := event.Data["under_review"].(bool); underReview {
+			b.mu.Unlock()
+			return // Decided when the finish is resolved
+		}
+		winnerLane, _ = event.Data["winner_lane"].(int)
+	case events.EventFinishResolved:
+		winnerLane = event.Lane
+	case events.EventRaceAbort:
+		b.release(pair)
+		b.mu.Unlock()
+		return
+	}
+
+	registration, ok := pair.lanes[winnerLane]
+	if !ok {
+		logs.For(nil, "eliminations", event.RaceID).Warn("⚠️ No winner, the pair can be run again", "pair", pair.ID)
+		b.release(pair)
+		b.mu.Unlock()
+		return
+	}
+	winner := pair.Seats[0]
+	if pair.Seats[1].Registration == registration {
+		winner = pair.Seats[1]
+	}
+	delete(b.races, event.RaceID)
+	pair.Status = PairDecided
+	next := b.advance(pair, winner)
+	advanced := b.advanceEvent(pair, winner, next)
+	b.mu.Unlock()
+
+	if b.bus != nil {
+		b.bus.Publish(advanced)
+	}
+}
+
+// release frees a pair to be assigned another race. Caller holds b.mu.
+func (b *Bracket) release(pair *Pair) {
+	delete(b.races, pair.RaceID)
+	pair.Status = PairReady
+	pair.RaceID = ""
+	pair.lanes = nil
+}
+
+// advance records a pair's winner and seats them in the next round,
+// returning that pair, or nil when the pair was the final. Caller holds
+// b.mu.
+func (b *Bracket) advance(pair *Pair, winner Seat) *Pair {
+	pair.Winner = winner.Registration
+	if pair.Round == len(b.state.Rounds) {
+		b.state.Champion = winner.Registration
+		return nil
+	}
+
+	next := &b.state.Rounds[pair.Round].Pairs[pair.index/2]
+	next.Seats[pair.index%2] = winner
+	if next.Seats[0].Registration != "" && next.Seats[1].Registration != "" {
+		next.Status = PairReady
+	}
+	return next
+}
+
+// advanceEvent builds eliminations.advance for a pair's winner
+func (b *Bracket) advanceEvent(pair *Pair, winner Seat, next *Pair) events.Event {
+	builder := events.NewEvent(events.EventEliminationsAdvance).
+		WithRaceID(pair.RaceID).
+		WithData("pair", pair.ID).
+		WithData("round", pair.Round).
+		WithData("winner", winner.Registration).
+		WithData("seed", winner.Seed)
+	if next != nil {
+		builder.WithData("next_pair", next.ID)
+	} else {
+		builder.WithData("champion", true)
+	}
+	return builder.Build()
+}
+
+// pair returns a pair by ID. Caller holds b.mu.
+func (b *Bracket) pair(id string) *Pair {
+	for r := range b.state.Rounds {
+		for p := range b.state.Rounds[r].Pairs {
+			if b.state.Rounds[r].Pairs[p].ID == id {
+				return &b.state.Rounds[r].Pairs[p]
+			}
+		}
+	}
+	return nil
+}
+
+// NextOpponent returns the registration of the next-round opponent of a
+// driver who won raceID, or "" while it is not known. It can be passed to
+// LibDragAPI.StartRunSummaries as a notify.OpponentLookup.
+func (b *Bracket) NextOpponent(raceID string, registration string) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for r := range b.state.Rounds {
+		for _, pair := range b.state.Rounds[r].Pairs {
+			if pair.RaceID != raceID || pair.Winner != registration || r+1 == len(b.state.Rounds) {
+				continue
+			}
+			next := b.state.Rounds[r+1].Pairs[pair.index/2]
+			return next.Seats[1-pair.index%2].Registration
+		}
+	}
+	return ""
+}
+
+// Forget replaces an entrant's registration with pseudonym throughout the
+// bracket's history for a privacy request, and clears their display name.
+// The entrant keeps their seats, wins and any title, so the ladder still
+// reads through; races in progress still advance them. It reports whether
+// the entrant was in the bracket.
+func (b *Bracket) Forget(registration, pseudonym string) (bool, error) {
+	if registration == "" || pseudonym == "" {
+		return false, fmt.Errorf("registration and pseudonym are required")
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	found := false
+	for r := range b.state.Rounds {
+		for p := range b.state.Rounds[r].Pairs {
+			pair := &b.state.Rounds[r].Pairs[p]
+			for s := range pair.Seats {
+				if pair.Seats[s].Registration == registration {
+					pair.Seats[s].Registration = pseudonym
+					pair.Seats[s].Name = ""
+					found = true
+				}
+			}
+			if pair.Winner == registration {
+				pair.Winner = pseudonym
+			}
+			for lane, seated := range pair.lanes {
+				if seated == registration {
+					pair.lanes[lane] = pseudonym
+				}
+			}
+		}
+	}
+	if b.state.Champion == registration {
+		b.state.Champion = pseudonym
+	}
+	return found, nil
+}
+
+// State returns a snapshot of the bracket
+func (b *Bracket) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	state := b.state
+	state.Rounds = make([]Round, len(b.state.Rounds))
+	for i, round := range b.state.Rounds {
+		state.Rounds[i] = Round{Number: round.Number, Pairs: append([]Pair(nil), round.Pairs...)}
+	}
+	return state
+}
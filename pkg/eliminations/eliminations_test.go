@@ -0,0 +1,168 @@
+package eliminations
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/benharold/libdrag/pkg/events"
+)
+
+func field(n int) []Entry {
+	entries := make([]Entry, n)
+	for i := range entries {
+		entries[i] = Entry{Registration: fmt.Sprintf("Q%d", i+1)}
+	}
+	return entries
+}
+
+func firstRound(t *testing.T, b *Bracket) [][2]int {
+	t.Helper()
+	var seeds [][2]int
+	for _, pair := range b.State().Rounds[0].Pairs {
+		seeds = append(seeds, [2]int{pair.Seats[0].Seed, pair.Seats[1].Seed})
+	}
+	return seeds
+}
+
+func TestLadders(t *testing.T) {
+	pro, err := NewBracket(nil, "Top Fuel", LadderPro, field(16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := [][2]int{{1, 16}, {8, 9}, {4, 13}, {5, 12}, {2, 15}, {7, 10}, {3, 14}, {6, 11}}
+	if got := firstRound(t, pro); fmt.Sprint(got) != fmt.Sprint(expected) {
+		t.Errorf("Expected the pro ladder %v, got %v", expected, got)
+	}
+	if rounds := len(pro.State().Rounds); rounds != 4 {
+		t.Errorf("Expected 4 rounds for 16 cars, got %d", rounds)
+	}
+
+	sportsman, err := NewBracket(nil, "Super Gas", LadderSportsman, field(16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = [][2]int{{1, 9}, {8, 16}, {4, 12}, {5, 13}, {2, 10}, {7, 15}, {3, 11}, {6, 14}}
+	if got := firstRound(t, sportsman); fmt.Sprint(got) != fmt.Sprint(expected) {
+		t.Errorf("Expected the sportsman ladder %v, got %v", expected, got)
+	}
+
+	// Six cars fill an eight-car ladder with byes for the top two
+	short, err := NewBracket(nil, "Pro Stock", LadderPro, field(6))
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := short.State()
+	if state.Rounds[0].Pairs[0].Status != PairBye || state.Rounds[0].Pairs[2].Status != PairBye {
+		t.Fatalf("Expected byes for the top two qualifiers, got %+v", state.Rounds[0].Pairs)
+	}
+	if state.Rounds[1].Pairs[0].Seats[0].Registration != "Q1" || state.Rounds[1].Pairs[0].Status != PairWaiting {
+		t.Errorf("Expected Q1 waiting in round 2, got %+v", state.Rounds[1].Pairs[0])
+	}
+
+	if _, err := NewBracket(nil, "", LadderPro, field(1)); err == nil {
+		t.Error("Expected a single entrant to be rejected")
+	}
+	if _, err := NewBracket(nil, "", LadderPro, append(field(2), Entry{Registration: "Q1"})); err == nil {
+		t.Error("Expected a duplicate entrant to be rejected")
+	}
+}
+
+func TestAdvanceFromRaceResults(t *testing.T) {
+	bus := events.NewEventBus(false)
+	var advanced []events.Event
+	bus.Subscribe(events.EventEliminationsAdvance, func(e events.Event) { advanced = append(advanced, e) })
+
+	bracket, err := NewBracket(bus, "Pro Stock", LadderPro, field(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bracket.Start()
+	defer bracket.Stop()
+
+	complete := func(raceID string, winnerLane int, underReview bool) {
+		bus.Publish(events.NewEvent(events.EventRaceComplete).WithRaceID(raceID).
+			WithData("winner_lane", winnerLane).WithData("under_review", underReview).Build())
+	}
+
+	if err := bracket.AssignRace("R1P1", "race-1", map[int]string{1: "Q1", 2: "Q3"}); err == nil {
+		t.Fatal("Expected a driver outside the pair to be rejected")
+	}
+	if err := bracket.AssignRace("R2P1", "race-1", map[int]string{1: "Q1", 2: "Q4"}); err == nil {
+		t.Fatal("Expected the final to wait for its entrants")
+	}
+
+	// Q4 upsets Q1 from lane 2
+	if err := bracket.AssignRace("R1P1", "race-1", map[int]string{1: "Q1", 2: "Q4"}); err != nil {
+		t.Fatal(err)
+	}
+	complete("race-1", 2, false)
+	if len(advanced) != 1 || advanced[0].Data["winner"] != "Q4" || advanced[0].Data["next_pair"] != "R2P1" {
+		t.Fatalf("Expected Q4 to advance to the final, got %+v", advanced)
+	}
+
+	// An aborted race can be run again, and a photo finish waits for a ruling
+	bracket.AssignRace("R1P2", "race-2", map[int]string{1: "Q3", 2: "Q2"})
+	bus.Publish(events.NewEvent(events.EventRaceAbort).WithRaceID("race-2").Build())
+	if err := bracket.AssignRace("R1P2", "race-3", map[int]string{1: "Q2", 2: "Q3"}); err != nil {
+		t.Fatalf("Expected the aborted pair to be run again, got %v", err)
+	}
+	complete("race-3", 0, true)
+	if len(advanced) != 1 {
+		t.Fatal("Expected a finish under review not to advance anyone")
+	}
+	bus.Publish(events.NewEvent(events.EventFinishResolved).WithRaceID("race-3").WithLane(1).Build())
+	if bracket.NextOpponent("race-3", "Q2") != "Q4" || bracket.NextOpponent("race-1", "Q4") != "Q2" {
+		t.Errorf("Expected Q2 and Q4 to meet in the final")
+	}
+
+	if err := bracket.AssignRace("R2P1", "race-4", map[int]string{1: "Q2", 2: "Q4"}); err != nil {
+		t.Fatal(err)
+	}
+	complete("race-4", 1, false)
+	state := bracket.State()
+	if state.Champion != "Q2" || state.Rounds[1].Pairs[0].Status != PairDecided || advanced[2].Data["champion"] != true {
+		t.Errorf("Expected Q2 to win the event, got %+v", state)
+	}
+}
+
+func TestForget(t *testing.T) {
+	bus := events.NewEventBus(false)
+	var advanced []events.Event
+	bus.Subscribe(events.EventEliminationsAdvance, func(e events.Event) { advanced = append(advanced, e) })
+
+	entries := field(4)
+	entries[3].Name = "Fourth Qualifier"
+	bracket, err := NewBracket(bus, "Pro Stock", LadderPro, entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bracket.Start()
+	defer bracket.Stop()
+
+	// Q4 wins round one, and is forgotten while racing the final
+	bracket.AssignRace("R1P1", "race-1", map[int]string{1: "Q1", 2: "Q4"})
+	bus.Publish(events.NewEvent(events.EventRaceComplete).WithRaceID("race-1").WithData("winner_lane", 2).Build())
+	bracket.AssignRace("R1P2", "race-2", map[int]string{1: "Q2", 2: "Q3"})
+	bus.Publish(events.NewEvent(events.EventRaceComplete).WithRaceID("race-2").WithData("winner_lane", 1).Build())
+	bracket.AssignRace("R2P1", "race-3", map[int]string{1: "Q2", 2: "Q4"})
+
+	if found, err := bracket.Forget("Q4", "anon-4"); err != nil || !found {
+		t.Fatalf("Expected Q4 forgotten, got %v, %v", found, err)
+	}
+	bus.Publish(events.NewEvent(events.EventRaceComplete).WithRaceID("race-3").WithData("winner_lane", 2).Build())
+
+	state := bracket.State()
+	seat := state.Rounds[0].Pairs[0].Seats[1]
+	if seat.Registration != "anon-4" || seat.Name != "" || seat.Seed != 4 || state.Rounds[0].Pairs[0].Winner != "anon-4" {
+		t.Errorf("Expected the first round kept under the pseudonym, got %+v", state.Rounds[0].Pairs[0])
+	}
+	if state.Champion != "anon-4" || advanced[2].Data["winner"] != "anon-4" {
+		t.Errorf("Expected the race in progress to advance the pseudonym, got %+v", state)
+	}
+	if found, _ := bracket.Forget("Q4", "anon-4"); found {
+		t.Error("Expected Q4 no longer in the bracket")
+	}
+	if _, err := bracket.Forget("Q1", ""); err == nil {
+		t.Error("Expected a pseudonym to be required")
+	}
+}
@@ -2,7 +2,10 @@ package events
 
 import (
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/benharold/libdrag/pkg/timers"
 )
 
 // EventType defines the type of events in the system
@@ -30,25 +33,63 @@ const (
 	EventTiming60Foot      EventType = "timing.60_foot"
 	EventTiming330Foot     EventType = "timing.330_foot"
 	EventTimingEighthMile  EventType = "timing.eighth_mile"
+	EventTiming1000Foot    EventType = "timing.1000_foot"
+	EventTimingDelta       EventType = "timing.delta"
 	EventTimingQuarterMile EventType = "timing.quarter_mile"
 	EventTimingTrapSpeed   EventType = "timing.trap_speed"
+	EventTimingSyncMark    EventType = "timing.sync_mark"
+	EventTimingManualEntry EventType = "timing.manual_entry"
+	EventTimingTechReview  EventType = "timing.tech_review"
+	EventTimingBreakout    EventType = "timing.breakout"
+	EventTimingGuardTrip   EventType = "timing.guard_trip"
 
 	// EventAutoStartActivated Auto-start events
 	EventAutoStartActivated    EventType = "autostart.activated"
 	EventStagingTimeoutFoul    EventType = "autostart.staging_timeout_foul"
+	EventStagingTimeoutWarning EventType = "autostart.staging_timeout_warning"
 	EventTreeSequenceTriggered EventType = "autostart.tree_sequence_triggered"
 	EventAutoStartFault        EventType = "autostart.fault"
 	EventAutoStartReset        EventType = "autostart.reset"
 
+	// EventAutoStartCountdownStarted The staging clock, for tower displays
+	EventAutoStartCountdownStarted EventType = "autostart.countdown_started"
+	EventAutoStartCountdownTick    EventType = "autostart.countdown_tick"
+
 	// EventRaceStart Race events
-	EventRaceStart    EventType = "race.start"
-	EventRaceComplete EventType = "race.complete"
-	EventRaceAbort    EventType = "race.abort"
-	EventRaceFoul     EventType = "race.foul"
+	EventRaceStart             EventType = "race.start"
+	EventRaceComplete          EventType = "race.complete"
+	EventRaceAbort             EventType = "race.abort"
+	EventRaceFoul              EventType = "race.foul"
+	EventRaceDialIn            EventType = "race.dial_in"
+	EventRaceWinner            EventType = "race.winner"
+	EventRaceSignal            EventType = "race.start_signal"
+	EventRaceBoundaryViolation EventType = "race.boundary_violation"
+	EventRaceTags              EventType = "race.tags"
+
+	// EventRaceBurnout Pre-staging phase events
+	EventRaceBurnout  EventType = "race.burnout"
+	EventRaceBackup   EventType = "race.backup"
+	EventRaceApproach EventType = "race.approach"
+
+	// EventStarterOverride Starter console events
+	EventStarterOverride   EventType = "starter.override"
+	EventStarterTrigger    EventType = "starter.trigger"
+	EventStarterLaneHold   EventType = "starter.lane_hold"
+	EventStarterDisqualify EventType = "starter.disqualify"
+	EventStarterAudit      EventType = "starter.audit"
+
+	// EventFinishUnderReview Photo-finish events
+	EventFinishUnderReview EventType = "race.finish_under_review"
+	EventFinishResolved    EventType = "race.finish_resolved"
 
 	// EventBeamBroken Beam events
-	EventBeamBroken   EventType = "beam.broken"
-	EventBeamRestored EventType = "beam.restored"
+	EventBeamBroken        EventType = "beam.broken"
+	EventBeamRestored      EventType = "beam.restored"
+	EventBeamBreakRejected EventType = "beam.break_rejected"
+	EventBeamGuardTrip     EventType = "beam.guard_trip"
+
+	// EventBeamCrossTalk Hardware diagnostics
+	EventBeamCrossTalk EventType = "beam.crosstalk"
 
 	// Deep staging events
 	EventTreeDeepStage          EventType = "tree.deep_stage"
@@ -56,6 +97,59 @@ const (
 	
 	// Staging motion violation events
 	EventTreeStagingViolation   EventType = "tree.staging_violation"
+
+	// EventSessionSummary Session events
+	EventSessionSummary  EventType = "session.summary"
+	EventTurnaround      EventType = "session.turnaround"
+	EventTurnaroundAlert EventType = "session.turnaround_alert"
+	EventTechFlag        EventType = "session.tech_flag"
+	EventSessionOpen     EventType = "session.open"
+	EventSessionClose    EventType = "session.close"
+	EventLeaderboardUpdate EventType = "session.leaderboard"
+
+	// EventTrackClear Safety interlock events
+	EventTrackClear        EventType = "safety.track_clear"
+	EventArmBlocked        EventType = "safety.arm_blocked"
+	EventInterlockOverride EventType = "safety.interlock_override"
+	EventShutdownOverrun   EventType = "safety.shutdown_overrun"
+
+	// EventScoreboardUpdate Scoreboard events
+	EventScoreboardUpdate EventType = "scoreboard.update"
+
+	// EventStagingAssist Staging assist display events
+	EventStagingAssist EventType = "staging.assist"
+
+	// EventEliminationsAdvance Eliminations bracket events
+	EventEliminationsAdvance EventType = "eliminations.advance"
+
+	// EventRecordsUpdate Track records board events
+	EventRecordsUpdate EventType = "records.update"
+
+	// EventCalibrationPrompt Sensor calibration events
+	EventCalibrationPrompt   EventType = "calibration.prompt"
+	EventCalibrationMeasured EventType = "calibration.measured"
+	EventCalibrationComplete EventType = "calibration.complete"
+
+	// EventTimeTrialStaged Time trial solo run events
+	EventTimeTrialStaged   EventType = "timetrial.staged"
+	EventTimeTrialComplete EventType = "timetrial.complete"
+
+	// EventSlipPrinted ET slip printer events
+	EventSlipPrinted EventType = "slips.printed"
+	EventSlipFailed  EventType = "slips.failed"
+
+	// EventFaultInjected Fault injection (chaos drill) events
+	EventFaultInjected EventType = "fault.injected"
+
+	// EventPracticeAttempt Practice tree (reaction time training) events
+	EventPracticeAttempt EventType = "practice.attempt"
+	EventPracticeStats   EventType = "practice.stats"
+
+	// EventWebhookFailed Outbound webhook events
+	EventWebhookFailed EventType = "webhook.failed"
+
+	// EventDriverErased Privacy (driver data erasure) events
+	EventDriverErased EventType = "privacy.driver_erased"
 )
 
 // Event represents a racing event
@@ -65,6 +159,11 @@ type Event struct {
 	RaceID    string                 `json:"race_id"`
 	Lane      int                    `json:"lane,omitempty"`
 	Data      map[string]interface{} `json:"data"`
+
+	// External holds the correlation IDs other systems gave the race (an
+	// event management system's run ID, a ticket number), by name. The bus
+	// attaches them to every event of a race registered with SetExternalIDs.
+	External map[string]string `json:"external,omitempty"`
 }
 
 // EventHandler is a function that handles events
@@ -76,7 +175,16 @@ type subscription struct {
 	handler EventHandler
 }
 
-// EventBus manages event subscriptions and publishing
+// Replay buffer defaults: the latest events kept per race, and the races
+// kept, most recently started first
+const (
+	DefaultReplayEvents = 256
+	DefaultReplayRaces  = 16
+)
+
+// EventBus manages event subscriptions and publishing. It keeps each race's
+// latest events so SubscribeWithReplay can hand a late subscriber what it
+// missed, and counts the events an async bus drops when its queue is full.
 type EventBus struct {
 	mu          sync.RWMutex
 	handlers    map[EventType][]subscription
@@ -86,6 +194,13 @@ type EventBus struct {
 	done        chan struct{}
 	wg          sync.WaitGroup
 	nextID      int
+	external    map[string]map[string]string // Race ID -> external correlation IDs
+
+	replayEvents int                // Events kept per race (0 = no replay)
+	replayRaces  int                // Races kept
+	replay       map[string][]Event // Race ID -> latest events, oldest first
+	replayOrder  []string           // Races in replay, oldest first
+	dropped      atomic.Uint64      // Events dropped on a full queue
 }
 
 // NewEventBus creates a new event bus
@@ -96,6 +211,10 @@ func NewEventBus(asyncMode bool) *EventBus {
 		asyncMode:   asyncMode,
 		done:        make(chan struct{}),
 		nextID:      1,
+
+		replayEvents: DefaultReplayEvents,
+		replayRaces:  DefaultReplayRaces,
+		replay:       make(map[string][]Event),
 	}
 
 	if asyncMode {
@@ -147,36 +266,192 @@ func (eb *EventBus) SubscribeAll(handler EventHandler) func() {
 	}
 }
 
+// SubscribeWithReplay adds a handler for one race's events that first
+// receives the race's events already published, from the replay buffer,
+// then its events as they are published, in order and without gaps. A
+// scoreboard reconnecting mid-race catches up on the staging and tree events
+// it missed. Only the latest events of recent races are kept (see
+// SetReplayLimits), so a long race's earliest events may be gone.
+func (eb *EventBus) SubscribeWithReplay(raceID string, handler EventHandler) func() {
+	r := &replayer{handler: handler, replaying: true}
+
+	// Taking the buffer and subscribing under one lock leaves no gap: deliver
+	// records each event and reads the handlers under the same lock
+	eb.mu.Lock()
+	missed := append([]Event(nil), eb.replay[raceID]...)
+	sub := subscription{
+		id: eb.nextID,
+		handler: func(event Event) {
+			if event.RaceID == raceID {
+				r.live(event)
+			}
+		},
+	}
+	eb.nextID++
+	eb.allHandlers = append(eb.allHandlers, sub)
+	eb.mu.Unlock()
+
+	r.catchUp(missed)
+	return func() {
+		eb.unsubscribeByID("", sub.id, true)
+	}
+}
+
+// replayer delivers a replay, holding back live events until it is done
+type replayer struct {
+	handler   EventHandler
+	mu        sync.Mutex
+	replaying bool
+	pending   []Event // Live events received during the replay
+}
+
+// live delivers a live event, or holds it until the replay is done
+func (r *replayer) live(event Event) {
+	r.mu.Lock()
+	if r.replaying {
+		r.pending = append(r.pending, event)
+		r.mu.Unlock()
+		return
+	}
+	r.mu.Unlock()
+	r.handler(event)
+}
+
+// catchUp delivers the missed events, then any held back meanwhile
+func (r *replayer) catchUp(missed []Event) {
+	for {
+		for _, event := range missed {
+			r.handler(event)
+		}
+		r.mu.Lock()
+		if len(r.pending) == 0 {
+			r.replaying = false
+			r.mu.Unlock()
+			return
+		}
+		missed, r.pending = r.pending, nil
+		r.mu.Unlock()
+	}
+}
+
+// SetReplayLimits sets how many of each race's latest events are kept for
+// SubscribeWithReplay, and for how many races, the most recent. Zero events
+// turns the replay buffer off and empties it.
+func (eb *EventBus) SetReplayLimits(events, races int) {
+	eb.mu.Lock()
+	defer eb.mu.Unlock()
+
+	eb.replayEvents, eb.replayRaces = events, races
+	if events <= 0 || races <= 0 {
+		eb.replay = make(map[string][]Event)
+		eb.replayOrder = nil
+		return
+	}
+	for raceID, buffered := range eb.replay {
+		if len(buffered) > events {
+			eb.replay[raceID] = append([]Event(nil), buffered[len(buffered)-events:]...)
+		}
+	}
+	eb.evictReplays()
+}
+
+// record adds an event to its race's replay buffer. Must be called with
+// eb.mu held.
+func (eb *EventBus) record(event Event) {
+	buffered, ok := eb.replay[event.RaceID]
+	if !ok {
+		eb.replayOrder = append(eb.replayOrder, event.RaceID)
+	}
+	if len(buffered) == eb.replayEvents {
+		copy(buffered, buffered[1:])
+		buffered = buffered[:len(buffered)-1]
+	}
+	eb.replay[event.RaceID] = append(buffered, event)
+	if !ok {
+		eb.evictReplays()
+	}
+}
+
+// evictReplays drops the oldest races' buffers beyond the race limit. Must
+// be called with eb.mu held.
+func (eb *EventBus) evictReplays() {
+	for len(eb.replayOrder) > eb.replayRaces {
+		delete(eb.replay, eb.replayOrder[0])
+		eb.replayOrder = eb.replayOrder[1:]
+	}
+}
+
+// Dropped returns how many events an async bus has dropped because its
+// queue was full. Neither handlers nor the replay buffer saw them.
+func (eb *EventBus) Dropped() uint64 {
+	return eb.dropped.Load()
+}
+
 // unsubscribeByID removes a subscription by ID
 func (eb *EventBus) unsubscribeByID(eventType EventType, id int, allEvents bool) {
 	eb.mu.Lock()
 	defer eb.mu.Unlock()
 
 	if allEvents {
-		// Remove from all-event handlers
-		for i, sub := range eb.allHandlers {
-			if sub.id == id {
-				eb.allHandlers = append(eb.allHandlers[:i], eb.allHandlers[i+1:]...)
-				break
-			}
-		}
+		eb.allHandlers = without(eb.allHandlers, id)
 	} else {
-		// Remove from specific event handlers
-		handlers := eb.handlers[eventType]
-		for i, sub := range handlers {
-			if sub.id == id {
-				eb.handlers[eventType] = append(handlers[:i], handlers[i+1:]...)
-				break
-			}
+		eb.handlers[eventType] = without(eb.handlers[eventType], id)
+	}
+}
+
+// without returns subs minus the subscription with the given ID. Handler
+// lists are copy-on-write so deliver can iterate them without copying; the
+// list is never modified in place.
+func without(subs []subscription, id int) []subscription {
+	for i, sub := range subs {
+		if sub.id == id {
+			result := make([]subscription, 0, len(subs)-1)
+			result = append(result, subs[:i]...)
+			return append(result, subs[i+1:]...)
 		}
 	}
+	return subs
+}
+
+// HasSubscribers reports whether any handler would receive an event of the
+// given type, so hot paths can skip building events nobody listens to
+func (eb *EventBus) HasSubscribers(eventType EventType) bool {
+	eb.mu.RLock()
+	defer eb.mu.RUnlock()
+	return len(eb.allHandlers) > 0 || len(eb.handlers[eventType]) > 0
+}
+
+// SetExternalIDs attaches external correlation IDs to every event
+// published for a race from now on. Pass nil to stop once the race is done.
+func (eb *EventBus) SetExternalIDs(raceID string, ids map[string]string) {
+	eb.mu.Lock()
+	defer eb.mu.Unlock()
+
+	if len(ids) == 0 {
+		delete(eb.external, raceID)
+		return
+	}
+	if eb.external == nil {
+		eb.external = make(map[string]map[string]string)
+	}
+	// Copied once here, so published events can share the map read-only
+	copied := make(map[string]string, len(ids))
+	for name, id := range ids {
+		copied[name] = id
+	}
+	eb.external[raceID] = copied
 }
 
 // Publish sends an event to all registered handlers
 func (eb *EventBus) Publish(event Event) {
 	// Set timestamp if not already set
 	if event.Timestamp.IsZero() {
-		event.Timestamp = time.Now()
+		event.Timestamp = timers.Now()
+	}
+	if event.RaceID != "" && event.External == nil {
+		eb.mu.RLock()
+		event.External = eb.external[event.RaceID]
+		eb.mu.RUnlock()
 	}
 
 	if eb.asyncMode {
@@ -184,8 +459,9 @@ func (eb *EventBus) Publish(event Event) {
 		case eb.eventQueue <- event:
 			// Event queued successfully
 		default:
-			// Queue full, drop event (or handle differently)
-			// In production, you might want to log this
+			// Queue full: drop the event rather than block the publisher,
+			// counted for Dropped
+			eb.dropped.Add(1)
 		}
 	} else {
 		eb.deliver(event)
@@ -194,12 +470,23 @@ func (eb *EventBus) Publish(event Event) {
 
 // deliver sends the event to handlers
 func (eb *EventBus) deliver(event Event) {
-	eb.mu.RLock()
-	handlers := make([]subscription, len(eb.handlers[event.Type]))
-	copy(handlers, eb.handlers[event.Type])
-	allHandlers := make([]subscription, len(eb.allHandlers))
-	copy(allHandlers, eb.allHandlers)
-	eb.mu.RUnlock()
+	// Handler lists are copy-on-write, so the slices taken here are stable.
+	// A race's events are recorded for replay under the same lock.
+	var handlers, allHandlers []subscription
+	if event.RaceID != "" {
+		eb.mu.Lock()
+		if eb.replayEvents > 0 && eb.replayRaces > 0 {
+			eb.record(event)
+		}
+		handlers = eb.handlers[event.Type]
+		allHandlers = eb.allHandlers
+		eb.mu.Unlock()
+	} else {
+		eb.mu.RLock()
+		handlers = eb.handlers[event.Type]
+		allHandlers = eb.allHandlers
+		eb.mu.RUnlock()
+	}
 
 	// Deliver to specific handlers
 	for _, sub := range handlers {
@@ -256,13 +543,17 @@ type EventBuilder struct {
 	event Event
 }
 
+// eventDataHint sizes event data up front; most events carry a few fields,
+// and sizing the map once is cheaper than growing it on the first WithData
+const eventDataHint = 4
+
 // NewEvent creates a new event builder
 func NewEvent(eventType EventType) *EventBuilder {
 	return &EventBuilder{
 		event: Event{
 			Type:      eventType,
-			Timestamp: time.Now(),
-			Data:      make(map[string]interface{}),
+			Timestamp: timers.Now(),
+			Data:      make(map[string]interface{}, eventDataHint),
 		},
 	}
 }
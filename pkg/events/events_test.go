@@ -151,6 +151,7 @@ func TestEventBusStop(t *testing.T) {
 }
 
 func BenchmarkEventBusSync(b *testing.B) {
+	b.ReportAllocs()
 	eb := NewEventBus(false)
 	eb.Subscribe(EventTimingBeamTrigger, func(event Event) {
 		// Do nothing
@@ -270,3 +271,117 @@ func TestMultipleUnsubscribe(t *testing.T) {
 		t.Errorf("Expected counts to remain 1 and 2, got %d and %d", count1, count2)
 	}
 }
+
+// Test that handlers can unsubscribe during delivery without skipping others
+func TestUnsubscribeDuringDelivery(t *testing.T) {
+	eb := NewEventBus(false)
+
+	if eb.HasSubscribers(EventTreeGreenOn) {
+		t.Error("Expected no subscribers on a new bus")
+	}
+
+	calls := make([]int, 3)
+	var unsubscribeFirst func()
+	unsubscribeFirst = eb.Subscribe(EventTreeGreenOn, func(event Event) {
+		calls[0]++
+		unsubscribeFirst()
+	})
+	eb.Subscribe(EventTreeGreenOn, func(event Event) { calls[1]++ })
+	eb.Subscribe(EventTreeGreenOn, func(event Event) { calls[2]++ })
+
+	if !eb.HasSubscribers(EventTreeGreenOn) || eb.HasSubscribers(EventRaceStart) {
+		t.Error("HasSubscribers should report only subscribed event types")
+	}
+
+	eb.Publish(NewEvent(EventTreeGreenOn).Build())
+	eb.Publish(NewEvent(EventTreeGreenOn).Build())
+	if calls[0] != 1 || calls[1] != 2 || calls[2] != 2 {
+		t.Errorf("Expected every remaining handler called on each publish, got %v", calls)
+	}
+
+	unsubscribeAll := eb.SubscribeAll(func(event Event) {})
+	if !eb.HasSubscribers(EventRaceStart) {
+		t.Error("All-event handlers should count as subscribers of every type")
+	}
+	unsubscribeAll()
+}
+
+func TestExternalIDs(t *testing.T) {
+	eb := NewEventBus(false)
+	var received []Event
+	eb.SubscribeAll(func(event Event) { received = append(received, event) })
+
+	eb.SetExternalIDs("race-1", map[string]string{"ems_run": "R-1042"})
+	eb.Publish(NewEvent(EventRaceStart).WithRaceID("race-1").Build())
+	eb.Publish(NewEvent(EventRaceStart).WithRaceID("race-2").Build())
+	eb.SetExternalIDs("race-1", nil)
+	eb.Publish(NewEvent(EventRaceComplete).WithRaceID("race-1").Build())
+
+	if received[0].External["ems_run"] != "R-1042" {
+		t.Errorf("Expected the race's external ID attached, got %v", received[0].External)
+	}
+	if received[1].External != nil || received[2].External != nil {
+		t.Errorf("Expected no external IDs on other races or after clearing, got %v and %v", received[1].External, received[2].External)
+	}
+}
+
+func TestSubscribeWithReplay(t *testing.T) {
+	eb := NewEventBus(false)
+	eb.SetReplayLimits(3, 2)
+
+	for lane := 1; lane <= 4; lane++ {
+		eb.Publish(NewEvent(EventTreeStage).WithRaceID("race-1").WithLane(lane).Build())
+	}
+	eb.Publish(NewEvent(EventTreeStage).WithRaceID("race-2").WithLane(1).Build())
+
+	var lanes []int
+	unsubscribe := eb.SubscribeWithReplay("race-1", func(event Event) {
+		lanes = append(lanes, event.Lane)
+		if event.Lane == 2 {
+			// Published mid-replay, so it comes after the replay
+			eb.Publish(NewEvent(EventTreeGreenOn).WithRaceID("race-1").WithLane(9).Build())
+		}
+	})
+	defer unsubscribe()
+	eb.Publish(NewEvent(EventTreeGreenOn).WithRaceID("race-2").WithLane(1).Build())
+	eb.Publish(NewEvent(EventTreeGreenOn).WithRaceID("race-1").WithLane(5).Build())
+
+	want := []int{2, 3, 4, 9, 5}
+	if len(lanes) != len(want) {
+		t.Fatalf("Expected lanes %v, got %v", want, lanes)
+	}
+	for i := range want {
+		if lanes[i] != want[i] {
+			t.Fatalf("Expected lanes %v, got %v", want, lanes)
+		}
+	}
+
+	// A third race evicts the oldest
+	eb.Publish(NewEvent(EventTreeStage).WithRaceID("race-3").Build())
+	replayed := 0
+	eb.SubscribeWithReplay("race-1", func(Event) { replayed++ })()
+	if replayed != 0 {
+		t.Errorf("Expected race-1 evicted, replayed %d events", replayed)
+	}
+	eb.SubscribeWithReplay("race-3", func(Event) { replayed++ })()
+	if replayed != 1 {
+		t.Errorf("Expected race-3 replayed, got %d events", replayed)
+	}
+}
+
+func TestDropped(t *testing.T) {
+	eb := NewEventBus(true)
+	release := make(chan struct{})
+	eb.Subscribe(EventRaceStart, func(Event) { <-release })
+
+	// The first event blocks the delivery goroutine, the queue holds 1000
+	for i := 0; i < 1100; i++ {
+		eb.Publish(NewEvent(EventRaceStart).Build())
+	}
+	close(release)
+	eb.Stop()
+
+	if dropped := eb.Dropped(); dropped < 99 {
+		t.Errorf("Expected at least 99 dropped events, got %d", dropped)
+	}
+}
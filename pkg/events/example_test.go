@@ -0,0 +1,28 @@
+package events_test
+
+import (
+	"fmt"
+
+	"github.com/benharold/libdrag/pkg/events"
+)
+
+// This example connects a scoreboard after its race has started. The
+// subscription first replays the staging it missed, then follows the race
+// live; another race's events are left out.
+func ExampleEventBus_SubscribeWithReplay() {
+	bus := events.NewEventBus(false)
+	bus.Publish(events.NewEvent(events.EventTreePreStage).WithRaceID("race-1").WithLane(1).Build())
+	bus.Publish(events.NewEvent(events.EventTreePreStage).WithRaceID("race-2").WithLane(1).Build())
+	bus.Publish(events.NewEvent(events.EventTreeStage).WithRaceID("race-1").WithLane(1).Build())
+
+	unsubscribe := bus.SubscribeWithReplay("race-1", func(e events.Event) {
+		fmt.Println(e.Type, e.Lane)
+	})
+	defer unsubscribe()
+
+	bus.Publish(events.NewEvent(events.EventTreeStage).WithRaceID("race-1").WithLane(2).Build())
+	// Output:
+	// tree.pre_stage 1
+	// tree.stage 1
+	// tree.stage 2
+}
@@ -0,0 +1,172 @@
+// Package export builds run records for publishing results outside the
+// tower, with per-field control over personal driver data so public feeds
+// can keep car numbers, classes and times without identifying drivers.
+package export
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+
+	"github.com/benharold/libdrag/pkg/notify"
+	"github.com/benharold/libdrag/pkg/results"
+	"github.com/benharold/libdrag/pkg/timers"
+	"github.com/benharold/libdrag/pkg/timing"
+)
+
+// Policy controls how an exported field is published
+type Policy string
+
+const (
+	PolicyKeep         Policy = "keep"         // Publish as recorded
+	PolicyOmit         Policy = "omit"         // Leave out of the export
+	PolicyPseudonymize Policy = "pseudonymize" // Replace with a stable token, so runs still group by entrant
+)
+
+// Fields a policy can be set for
+const (
+	FieldDriver    = "driver"
+	FieldLicense   = "license"
+	FieldCarNumber = "car_number"
+	FieldClass     = "class"
+	FieldSessionID = "session_id"
+)
+
+// Config sets the policy for each field. Unlisted fields are kept.
+type Config struct {
+	Fields map[string]Policy `json:"fields"`
+	Salt   string            `json:"salt,omitempty"` // Keys pseudonyms so they cannot be matched by hashing known registrations
+}
+
+// PublicConfig strips personal driver data, keeping car number, class and times
+func PublicConfig() Config {
+	return Config{Fields: map[string]Policy{
+		FieldDriver:  PolicyOmit,
+		FieldLicense: PolicyOmit,
+	}}
+}
+
+// Validate reports unknown fields or policies
+func (c Config) Validate() error {
+	for field, policy := range c.Fields {
+		switch field {
+		case FieldDriver, FieldLicense, FieldCarNumber, FieldClass, FieldSessionID:
+		default:
+			return fmt.Errorf("unknown export field %q", field)
+		}
+		switch policy {
+		case PolicyKeep, PolicyOmit, PolicyPseudonymize:
+		default:
+			return fmt.Errorf("unknown policy %q for export field %q", policy, field)
+		}
+	}
+	return nil
+}
+
+// apply returns value as published under the field's policy
+func (c Config) apply(field, value string) string {
+	if value == "" {
+		return ""
+	}
+	switch c.Fields[field] {
+	case PolicyOmit:
+		return ""
+	case PolicyPseudonymize:
+		mac := hmac.New(sha256.New, []byte(c.Salt))
+		mac.Write([]byte(field + ":" + value))
+		return hex.EncodeToString(mac.Sum(nil))[:16]
+	default:
+		return value
+	}
+}
+
+// Entrant identifies the car and driver in a lane
+type Entrant struct {
+	CarNumber string `json:"car_number,omitempty"`
+	Driver    string `json:"driver,omitempty"` // Driver registration
+	License   string `json:"license,omitempty"`
+}
+
+// Race is the recorded outcome of a race to export
+type Race struct {
+	RaceID    string
+	Class     string
+	SessionID string
+	External  map[string]string // External correlation IDs
+	Tags      []string          // Run tags
+	Entrants  map[int]Entrant
+	Timing    map[int]*timing.TimingResults
+	Decision  results.Decision
+}
+
+// Record is one lane's exported run
+type Record struct {
+	RaceID       string            `json:"race_id"`
+	Class        string            `json:"class,omitempty"`
+	SessionID    string            `json:"session_id,omitempty"`
+	External     map[string]string `json:"external,omitempty"` // Race's external correlation IDs, always kept
+	Tags         []string          `json:"tags,omitempty"`     // Race's run tags, always kept
+	Lane         int               `json:"lane"`
+	CarNumber    string            `json:"car_number,omitempty"`
+	Driver       string            `json:"driver,omitempty"`
+	License      string            `json:"license,omitempty"`
+	ReactionTime *float64          `json:"reaction_time,omitempty"`
+	SixtyFoot    *float64          `json:"sixty_foot,omitempty"`
+	EighthMile   *float64          `json:"eighth_mile,omitempty"`
+	ElapsedTime  *float64          `json:"elapsed_time,omitempty"`
+	Speed        *float64          `json:"speed,omitempty"`
+	Result       string            `json:"result"` // notify.ResultWin, ResultLoss, ResultFoul or ResultSingle
+	FoulReason   string            `json:"foul_reason,omitempty"`
+
+	// TimingAccuracy discloses times of degraded accuracy (hand-timed, say)
+	TimingAccuracy *timers.Accuracy `json:"timing_accuracy,omitempty"`
+}
+
+// Build exports every lane that ran, ordered by lane
+func Build(race Race, cfg Config) []Record {
+	lanes := make([]int, 0, len(race.Timing))
+	for lane := range race.Timing {
+		lanes = append(lanes, lane)
+	}
+	sort.Ints(lanes)
+
+	records := make([]Record, 0, len(lanes))
+	for _, lane := range lanes {
+		result := race.Timing[lane]
+		entrant := race.Entrants[lane]
+		record := Record{
+			RaceID:       race.RaceID,
+			Class:        cfg.apply(FieldClass, race.Class),
+			SessionID:    cfg.apply(FieldSessionID, race.SessionID),
+			External:     race.External,
+			Tags:         race.Tags,
+			Lane:         lane,
+			CarNumber:    cfg.apply(FieldCarNumber, entrant.CarNumber),
+			Driver:       cfg.apply(FieldDriver, entrant.Driver),
+			License:      cfg.apply(FieldLicense, entrant.License),
+			ReactionTime: result.ReactionTime,
+			SixtyFoot:    result.SixtyFootTime,
+			EighthMile:   result.EighthMileTime,
+			ElapsedTime:  result.QuarterMileTime,
+			Speed:        result.TrapSpeed,
+			Result:       notify.ResultLoss,
+		}
+		if accuracy := result.Accuracy(); accuracy.Degraded() {
+			record.TimingAccuracy = &accuracy
+		}
+		if result.IsFoul {
+			record.Result = notify.ResultFoul
+			record.FoulReason = result.FoulReason
+		}
+		if lane == race.Decision.WinnerLane {
+			record.Result = notify.ResultWin
+			if race.Decision.Reason == results.ReasonSingle {
+				record.Result = notify.ResultSingle
+			}
+		}
+		records = append(records, record)
+	}
+	return records
+}
@@ -0,0 +1,91 @@
+package export
+
+import (
+	"testing"
+	"time"
+
+	"github.com/benharold/libdrag/pkg/notify"
+	"github.com/benharold/libdrag/pkg/results"
+	"github.com/benharold/libdrag/pkg/timing"
+)
+
+func finished(lane int, et float64, finish time.Time) *timing.TimingResults {
+	rt := 0.5
+	return &timing.TimingResults{
+		Lane:            lane,
+		ReactionTime:    &rt,
+		QuarterMileTime: &et,
+		IsComplete:      true,
+		BeamTriggers:    map[string]time.Time{"1320_foot": finish},
+	}
+}
+
+func race() Race {
+	now := time.Now()
+	runs := map[int]*timing.TimingResults{
+		1: finished(1, 7.30, now.Add(20*time.Millisecond)),
+		2: finished(2, 7.40, now),
+	}
+	return Race{
+		RaceID:    "race-1",
+		Class:     "Super Pro",
+		SessionID: "E1",
+		Entrants: map[int]Entrant{
+			1: {CarNumber: "1234", Driver: "SG-1234", License: "A"},
+			2: {CarNumber: "5678", Driver: "SG-5678"},
+		},
+		Timing:   runs,
+		Decision: results.Decide(runs, 0),
+	}
+}
+
+func TestBuildPublic(t *testing.T) {
+	records := Build(race(), PublicConfig())
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 records, got %d", len(records))
+	}
+	for _, record := range records {
+		if record.Driver != "" || record.License != "" {
+			t.Errorf("Public export should strip driver data, got %+v", record)
+		}
+	}
+	if records[0].CarNumber != "1234" || records[0].Class != "Super Pro" || *records[0].ElapsedTime != 7.30 || records[0].Result != notify.ResultLoss {
+		t.Errorf("Unexpected lane 1 record %+v", records[0])
+	}
+	if records[1].CarNumber != "5678" || records[1].Result != notify.ResultWin {
+		t.Errorf("Unexpected lane 2 record %+v", records[1])
+	}
+}
+
+func TestBuildPseudonymize(t *testing.T) {
+	cfg := Config{Fields: map[string]Policy{FieldDriver: PolicyPseudonymize, FieldCarNumber: PolicyOmit}, Salt: "event-42"}
+	first := Build(race(), cfg)
+	second := Build(race(), cfg)
+
+	if first[0].Driver == "" || first[0].Driver == "SG-1234" || first[0].Driver == first[1].Driver {
+		t.Errorf("Expected distinct pseudonyms, got %q and %q", first[0].Driver, first[1].Driver)
+	}
+	if first[0].Driver != second[0].Driver {
+		t.Error("Pseudonyms should be stable across exports")
+	}
+	if first[0].CarNumber != "" || first[0].License != "A" {
+		t.Errorf("Unexpected per-field policies applied %+v", first[0])
+	}
+
+	cfg.Salt = "event-43"
+	if Build(race(), cfg)[0].Driver == first[0].Driver {
+		t.Error("Pseudonyms should depend on the salt")
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	if err := PublicConfig().Validate(); err != nil {
+		t.Errorf("PublicConfig should be valid: %v", err)
+	}
+	if err := (Config{Fields: map[string]Policy{"email": PolicyOmit}}).Validate(); err == nil {
+		t.Error("Expected error for unknown field")
+	}
+	if err := (Config{Fields: map[string]Policy{FieldDriver: "redact"}}).Validate(); err == nil {
+		t.Error("Expected error for unknown policy")
+	}
+}
@@ -0,0 +1,168 @@
+// Package fouls adjudicates fouls across lanes. When more than one lane
+// fouls, the NHRA "first or worst" rule decides which one loses: a boundary
+// foul (crossing the centerline or outside boundary) is the worst foul and
+// loses over any red light; otherwise the first foul committed loses and the
+// other lane's foul is forgiven. The rule itself is in pkg/handicap; this
+// package collects a race's fouls from its events.
+package fouls
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/benharold/libdrag/pkg/config"
+	"github.com/benharold/libdrag/pkg/events"
+	"github.com/benharold/libdrag/pkg/handicap"
+	"github.com/benharold/libdrag/pkg/timers"
+)
+
+// Foul kinds
+const (
+	KindRedLight = handicap.KindRedLight
+	KindBoundary = handicap.KindBoundary
+	KindOther    = handicap.KindOther
+)
+
+// Ruling rules
+const (
+	RuleFirst = handicap.RuleFirst
+	RuleWorst = handicap.RuleWorst
+)
+
+// Foul is a foul committed in a lane
+type Foul = handicap.Foul
+
+// Ruling is the official ruling on a race in which more than one lane fouled
+type Ruling = handicap.Ruling
+
+// Adjudicator collects a race's fouls from timing and tree events
+type Adjudicator struct {
+	mu          sync.Mutex
+	raceID      string
+	fouls       []Foul
+	unsubscribe []func()
+}
+
+// NewAdjudicator creates an adjudicator for a race
+func NewAdjudicator(raceID string) *Adjudicator {
+	return &Adjudicator{raceID: raceID}
+}
+
+// Start watches the bus for the race's fouls
+func (a *Adjudicator) Start(bus *events.EventBus) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, eventType := range []events.EventType{events.EventRaceFoul, events.EventTreeRedLight} {
+		a.unsubscribe = append(a.unsubscribe, bus.Subscribe(eventType, a.HandleEvent))
+	}
+}
+
+// Stop stops watching the bus. Fouls already collected are kept.
+func (a *Adjudicator) Stop() {
+	a.mu.Lock()
+	unsubscribe := a.unsubscribe
+	a.unsubscribe = nil
+	a.mu.Unlock()
+
+	for _, fn := range unsubscribe {
+		fn()
+	}
+}
+
+// HandleEvent records a foul event for the race
+func (a *Adjudicator) HandleEvent(event events.Event) {
+	if event.RaceID != a.raceID || event.Lane == 0 {
+		return
+	}
+
+	kind := KindRedLight
+	if event.Type == events.EventRaceFoul {
+		reason, _ := event.Data["reason"].(string)
+		kind = Kind(reason)
+	}
+	at, ok := event.Data["at"].(time.Time)
+	if !ok {
+		at = event.Timestamp
+	}
+	a.Record(Foul{Lane: event.Lane, Kind: kind, At: at})
+}
+
+// Record adds a foul. A lane's repeated foul of the same kind keeps the
+// earliest time, so a foul seen both directly and on the bus counts once.
+func (a *Adjudicator) Record(foul Foul) {
+	if foul.At.IsZero() {
+		foul.At = timers.Now()
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for i, existing := range a.fouls {
+		if existing.Lane == foul.Lane && existing.Kind == foul.Kind {
+			if foul.At.Before(existing.At) {
+				a.fouls[i].At = foul.At
+			}
+			return
+		}
+	}
+	a.fouls = append(a.fouls, foul)
+}
+
+// Fouls returns the race's fouls in the order committed
+func (a *Adjudicator) Fouls() []Foul {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	fouls := append([]Foul(nil), a.fouls...)
+	sort.SliceStable(fouls, func(i, j int) bool { return fouls[i].At.Before(fouls[j].At) })
+	return fouls
+}
+
+// Ruling applies first or worst to the race's fouls. It returns nil unless
+// more than one lane fouled, since a single foul needs no adjudication.
+func (a *Adjudicator) Ruling() *Ruling {
+	return Adjudicate(a.Fouls())
+}
+
+// Adjudicate applies first or worst to fouls, returning nil unless more
+// than one lane fouled
+func Adjudicate(fouls []Foul) *Ruling {
+	return handicap.FirstOrWorst(fouls)
+}
+
+// Kind classifies a timing foul reason
+func Kind(reason string) string {
+	return handicap.FoulKind(reason)
+}
+
+// Sources of a boundary violation
+const (
+	SourceSensor   = "sensor"   // A boundary sensor (centerline or guard wall beam, timing-block pad)
+	SourcePosition = "position" // A lateral position past the lane's boundary
+	SourceOfficial = "official" // A starter or official's report, video review
+)
+
+// BoundaryViolation is a lane crossing the centerline or its outside
+// boundary
+type BoundaryViolation struct {
+	Lane     int       `json:"lane"`
+	Boundary string    `json:"boundary,omitempty"` // config.BoundaryCenterline or config.BoundaryOutside; empty when unknown
+	Source   string    `json:"source"`
+	Offset   *float64  `json:"offset,omitempty"` // Lateral position that crossed, for SourcePosition
+	At       time.Time `json:"at"`
+}
+
+// CrossedBoundary reports whether a lateral position crosses out of the
+// lane, and which boundary it crosses. offset is the position in feet of
+// the car's tire nearest the boundary, measured from the lane's center,
+// positive toward the centerline and negative toward the outside.
+func CrossedBoundary(offset, laneWidth float64) (string, bool) {
+	half := laneWidth / 2
+	switch {
+	case offset > half:
+		return config.BoundaryCenterline, true
+	case offset < -half:
+		return config.BoundaryOutside, true
+	}
+	return "", false
+}
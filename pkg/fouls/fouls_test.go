@@ -0,0 +1,123 @@
+package fouls
+
+import (
+	"testing"
+	"time"
+
+	"github.com/benharold/libdrag/pkg/config"
+	"github.com/benharold/libdrag/pkg/events"
+)
+
+func TestAdjudicate(t *testing.T) {
+	green := time.Now()
+	at := func(ms int) time.Time { return green.Add(time.Duration(ms) * time.Millisecond) }
+
+	tests := []struct {
+		name   string
+		fouls  []Foul
+		loser  int
+		rule   string
+		noRule bool
+	}{
+		{
+			name:   "single foul needs no ruling",
+			fouls:  []Foul{{Lane: 1, Kind: KindRedLight, At: at(-20)}},
+			noRule: true,
+		},
+		{
+			name:  "first red light loses",
+			fouls: []Foul{{Lane: 2, Kind: KindRedLight, At: at(-5)}, {Lane: 1, Kind: KindRedLight, At: at(-20)}},
+			loser: 1,
+			rule:  RuleFirst,
+		},
+		{
+			name:  "boundary trumps an earlier red light",
+			fouls: []Foul{{Lane: 1, Kind: KindRedLight, At: at(-20)}, {Lane: 2, Kind: KindBoundary, At: at(3200)}},
+			loser: 2,
+			rule:  RuleWorst,
+		},
+		{
+			name:  "first boundary loses",
+			fouls: []Foul{{Lane: 2, Kind: KindBoundary, At: at(4100)}, {Lane: 1, Kind: KindBoundary, At: at(2500)}},
+			loser: 1,
+			rule:  RuleFirst,
+		},
+		{
+			name:  "first foul loses without a boundary",
+			fouls: []Foul{{Lane: 1, Kind: KindOther, At: at(-900)}, {Lane: 2, Kind: KindRedLight, At: at(-10)}},
+			loser: 1,
+			rule:  RuleFirst,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ruling := Adjudicate(tt.fouls)
+			if tt.noRule {
+				if ruling != nil {
+					t.Errorf("Expected no ruling, got %+v", ruling)
+				}
+				return
+			}
+			if ruling == nil || ruling.LosingLane != tt.loser || ruling.Rule != tt.rule {
+				t.Errorf("Expected lane %d to lose on %s, got %+v", tt.loser, tt.rule, ruling)
+			}
+		})
+	}
+}
+
+func TestAdjudicatorEvents(t *testing.T) {
+	bus := events.NewEventBus(false)
+	adjudicator := NewAdjudicator("race-1")
+	adjudicator.Start(bus)
+
+	green := time.Now()
+	redLight := func(raceID string, lane int, at time.Time) {
+		bus.Publish(events.NewEvent(events.EventTreeRedLight).WithRaceID(raceID).WithLane(lane).WithData("at", at).Build())
+		bus.Publish(events.NewEvent(events.EventRaceFoul).WithRaceID(raceID).WithLane(lane).
+			WithData("reason", "red_light").WithData("at", at).Build())
+	}
+	redLight("race-1", 2, green.Add(-15*time.Millisecond))
+	redLight("race-2", 1, green.Add(-30*time.Millisecond)) // Another race
+	redLight("race-1", 1, green.Add(-5*time.Millisecond))
+
+	if fouls := adjudicator.Fouls(); len(fouls) != 2 || fouls[0].Lane != 2 {
+		t.Fatalf("Expected one red light per lane, lane 2 first, got %+v", fouls)
+	}
+	if ruling := adjudicator.Ruling(); ruling == nil || ruling.LosingLane != 2 {
+		t.Errorf("Expected lane 2's earlier red light to lose, got %+v", ruling)
+	}
+
+	bus.Publish(events.NewEvent(events.EventRaceFoul).WithRaceID("race-1").WithLane(2).
+		WithData("reason", "centerline").WithData("at", green.Add(3*time.Second)).Build())
+	if ruling := adjudicator.Ruling(); ruling == nil || ruling.LosingLane != 2 || ruling.Rule != RuleFirst {
+		t.Errorf("Expected lane 2 to still lose, got %+v", ruling)
+	}
+
+	adjudicator.Stop()
+	bus.Publish(events.NewEvent(events.EventRaceFoul).WithRaceID("race-1").WithLane(1).
+		WithData("reason", "boundary").Build())
+	if n := len(adjudicator.Fouls()); n != 3 {
+		t.Errorf("Expected no fouls recorded after Stop, got %d", n)
+	}
+}
+
+func TestCrossedBoundary(t *testing.T) {
+	tests := []struct {
+		offset   float64
+		boundary string
+		crossed  bool
+	}{
+		{0, "", false},
+		{5.9, "", false},
+		{6, "", false}, // On the line is still in the lane
+		{6.2, config.BoundaryCenterline, true},
+		{-6.2, config.BoundaryOutside, true},
+	}
+	for _, test := range tests {
+		boundary, crossed := CrossedBoundary(test.offset, 12)
+		if boundary != test.boundary || crossed != test.crossed {
+			t.Errorf("Offset %.1f: expected %q/%v, got %q/%v", test.offset, test.boundary, test.crossed, boundary, crossed)
+		}
+	}
+}
@@ -0,0 +1,429 @@
+// Package grpcapi serves a LibDragAPI as the gRPC service libdrag.v1.LibDrag
+// defined in proto/libdrag/v1/service.proto, so race-control front ends in
+// any language can drive races with generated gRPC clients.
+//
+// Like pkg/pb, it is written by hand against the gRPC HTTP/2 wire protocol
+// to keep the library free of gRPC dependencies. Server is an http.Handler;
+// gRPC needs HTTP/2, so serve it with TLS (net/http negotiates HTTP/2
+// itself) or behind an h2c handler:
+//
+//	srv := &http.Server{Addr: ":8443", Handler: grpcapi.NewServer(libdragAPI)}
+//	srv.ListenAndServeTLS(certFile, keyFile)
+package grpcapi
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/benharold/libdrag/pkg/api"
+	"github.com/benharold/libdrag/pkg/beam"
+	"github.com/benharold/libdrag/pkg/events"
+	"github.com/benharold/libdrag/pkg/orchestrator"
+	"github.com/benharold/libdrag/pkg/pb"
+)
+
+// ServiceName is the fully qualified gRPC service name
+const ServiceName = "libdrag.v1.LibDrag"
+
+// maxMessageSize bounds request messages, as gRPC's default does
+const maxMessageSize = 4 << 20
+
+// Code is a gRPC status code
+type Code int
+
+// gRPC status codes returned by the server
+const (
+	CodeOK                 Code = 0
+	CodeInvalidArgument    Code = 3
+	CodeNotFound           Code = 5
+	CodeFailedPrecondition Code = 9
+	CodeUnimplemented      Code = 12
+	CodeInternal           Code = 13
+)
+
+// Status is an error carrying a gRPC status code
+type Status struct {
+	Code    Code
+	Message string
+}
+
+func (s *Status) Error() string {
+	return fmt.Sprintf("grpc status %d: %s", s.Code, s.Message)
+}
+
+// statusf builds a Status error
+func statusf(code Code, format string, args ...interface{}) error {
+	return &Status{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// message is a wire message of the service
+type message interface {
+	Marshal() []byte
+	Unmarshal(b []byte) error
+}
+
+// unaryMethod decodes a request, calls the API and returns the response
+type unaryMethod func(s *Server, request []byte) (message, error)
+
+// Server serves the libdrag gRPC service
+type Server struct {
+	api   *api.LibDragAPI
+	unary map[string]unaryMethod
+}
+
+// NewServer creates a gRPC server for an initialized API
+func NewServer(libdragAPI *api.LibDragAPI) *Server {
+	return &Server{
+		api: libdragAPI,
+		unary: map[string]unaryMethod{
+			"StartRace":          (*Server).startRace,
+			"GetRaceStatus":      (*Server).getRaceStatus,
+			"GetResults":         (*Server).getResults,
+			"GetTreeStatus":      (*Server).getTreeStatus,
+			"SetStagingBeam":     (*Server).setStagingBeam,
+			"ArmTree":            (*Server).armTree,
+			"DisarmTree":         (*Server).disarmTree,
+			"SetStarterOverride": (*Server).setStarterOverride,
+			"TriggerTree":        (*Server).triggerTree,
+			"AbortRace":          (*Server).abortRace,
+		},
+	}
+}
+
+// ServeHTTP implements http.Handler for gRPC calls on
+// /libdrag.v1.LibDrag/{method}
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || !strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+		http.Error(w, "gRPC requests only", http.StatusUnsupportedMediaType)
+		return
+	}
+	if r.ProtoMajor != 2 {
+		http.Error(w, "gRPC requires HTTP/2", http.StatusHTTPVersionNotSupported)
+		return
+	}
+
+	service, method, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+	w.WriteHeader(http.StatusOK)
+
+	if !ok || service != ServiceName {
+		writeStatus(w, statusf(CodeUnimplemented, "unknown service %s", service))
+		return
+	}
+	request, err := readMessage(r.Body)
+	if err != nil {
+		writeStatus(w, err)
+		return
+	}
+
+	if method == "StreamEvents" {
+		writeStatus(w, s.streamEvents(w, r, request))
+		return
+	}
+	call, ok := s.unary[method]
+	if !ok {
+		writeStatus(w, statusf(CodeUnimplemented, "unknown method %s", method))
+		return
+	}
+	response, err := call(s, request)
+	if err == nil {
+		err = writeMessage(w, response)
+	}
+	writeStatus(w, err)
+}
+
+func (s *Server) startRace(request []byte) (message, error) {
+	var req pb.StartRaceRequest
+	if err := decode(&req, request); err != nil {
+		return nil, err
+	}
+	opts := api.RaceOptions{
+		Class:            req.Class,
+		SessionID:        req.SessionID,
+		RequestID:        req.RequestID,
+		ExternalIDs:      req.ExternalIDs,
+		AutoStartProfile: req.AutoStartProfile,
+	}
+	if len(req.Drivers) > 0 {
+		opts.Drivers = make(map[int]string, len(req.Drivers))
+		for lane, driver := range req.Drivers {
+			opts.Drivers[int(lane)] = driver
+		}
+	}
+	raceID, err := s.api.StartRaceWithOptions(opts)
+	if err != nil {
+		return nil, statusf(CodeFailedPrecondition, "%v", err)
+	}
+	return &pb.StartRaceResponse{RaceID: raceID, ShortID: s.api.GetShortRaceID(raceID)}, nil
+}
+
+func (s *Server) getRaceStatus(request []byte) (message, error) {
+	raceID, err := s.raceID(request)
+	if err != nil {
+		return nil, err
+	}
+	status, err := s.api.GetRaceStatusByID(raceID)
+	if err != nil {
+		return nil, statusf(CodeNotFound, "%v", err)
+	}
+	m, err := pb.FromRaceStatus(status)
+	if err != nil {
+		return nil, statusf(CodeInternal, "%v", err)
+	}
+	return m, nil
+}
+
+func (s *Server) getResults(request []byte) (message, error) {
+	raceID, err := s.raceID(request)
+	if err != nil {
+		return nil, err
+	}
+	results, err := s.api.GetResultsByID(raceID)
+	if err != nil {
+		return nil, statusf(CodeNotFound, "%v", err)
+	}
+	status, err := s.api.GetRaceStatusByID(raceID)
+	if err != nil {
+		return nil, statusf(CodeNotFound, "%v", err)
+	}
+	decision, err := s.api.GetDecisionByID(raceID)
+	if err != nil {
+		return nil, statusf(CodeNotFound, "%v", err)
+	}
+
+	m := &pb.RaceResults{
+		RaceID:   raceID,
+		Complete: status.State == orchestrator.RaceStateComplete,
+		Decision: pb.FromDecision(decision),
+	}
+	lanes := make([]int, 0, len(results))
+	for lane := range results {
+		lanes = append(lanes, lane)
+	}
+	sort.Ints(lanes)
+	for _, lane := range lanes {
+		m.Lanes = append(m.Lanes, *pb.FromTimingResults(results[lane]))
+	}
+	return m, nil
+}
+
+func (s *Server) getTreeStatus(request []byte) (message, error) {
+	raceID, err := s.raceID(request)
+	if err != nil {
+		return nil, err
+	}
+	status, err := s.api.GetTreeStatusByID(raceID)
+	if err != nil {
+		return nil, statusf(CodeNotFound, "%v", err)
+	}
+	if status == nil {
+		return nil, statusf(CodeFailedPrecondition, "race %s has no tree", raceID)
+	}
+	return pb.FromTreeStatus(status), nil
+}
+
+func (s *Server) setStagingBeam(request []byte) (message, error) {
+	var req pb.StagingBeamRequest
+	if err := decode(&req, request); err != nil {
+		return nil, err
+	}
+	return s.control(req.RaceID, func() error {
+		return s.api.SetStagingBeamByID(req.RaceID, int(req.Lane), beam.BeamID(req.BeamID), req.Broken)
+	})
+}
+
+func (s *Server) armTree(request []byte) (message, error) {
+	var req pb.ArmTreeRequest
+	if err := decode(&req, request); err != nil {
+		return nil, err
+	}
+	var override *api.SafetyOverride
+	if req.OverrideBy != "" {
+		override = &api.SafetyOverride{By: req.OverrideBy, Reason: req.OverrideReason}
+	}
+	return s.control(req.RaceID, func() error {
+		return s.api.ArmTreeWithOverrideByID(req.RaceID, override)
+	})
+}
+
+func (s *Server) disarmTree(request []byte) (message, error) {
+	raceID, err := s.raceID(request)
+	if err != nil {
+		return nil, err
+	}
+	return s.control(raceID, func() error {
+		return s.api.DisarmTreeByID(raceID)
+	})
+}
+
+func (s *Server) setStarterOverride(request []byte) (message, error) {
+	var req pb.StarterOverrideRequest
+	if err := decode(&req, request); err != nil {
+		return nil, err
+	}
+	return s.control(req.RaceID, func() error {
+		return s.api.SetStarterOverrideByID(req.RaceID, req.Enabled)
+	})
+}
+
+func (s *Server) triggerTree(request []byte) (message, error) {
+	raceID, err := s.raceID(request)
+	if err != nil {
+		return nil, err
+	}
+	return s.control(raceID, func() error {
+		return s.api.TriggerTreeByID(raceID)
+	})
+}
+
+func (s *Server) abortRace(request []byte) (message, error) {
+	var req pb.AbortRaceRequest
+	if err := decode(&req, request); err != nil {
+		return nil, err
+	}
+	if req.Reason == "" {
+		req.Reason = "aborted via gRPC"
+	}
+	return s.control(req.RaceID, func() error {
+		return s.api.AbortRaceByID(req.RaceID, req.Reason)
+	})
+}
+
+// control runs a starter or staging control on an existing race. Refused
+// controls fail with FailedPrecondition.
+func (s *Server) control(raceID string, apply func() error) (message, error) {
+	if !s.api.RaceExists(raceID) {
+		return nil, statusf(CodeNotFound, "race %s not found", raceID)
+	}
+	if err := apply(); err != nil {
+		return nil, statusf(CodeFailedPrecondition, "%v", err)
+	}
+	return &pb.Empty{}, nil
+}
+
+// raceID decodes a RaceRequest
+func (s *Server) raceID(request []byte) (string, error) {
+	var req pb.RaceRequest
+	if err := decode(&req, request); err != nil {
+		return "", err
+	}
+	return req.RaceID, nil
+}
+
+// streamEvents writes events matching the request until the client cancels
+// the call. Events a slow client cannot keep up with are dropped rather
+// than blocking the event bus.
+func (s *Server) streamEvents(w http.ResponseWriter, r *http.Request, request []byte) error {
+	var req pb.StreamEventsRequest
+	if err := decode(&req, request); err != nil {
+		return err
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return statusf(CodeInternal, "response does not support streaming")
+	}
+	types := make(map[events.EventType]bool, len(req.Types))
+	for _, eventType := range req.Types {
+		types[events.EventType(eventType)] = true
+	}
+
+	outbox := make(chan []byte, 256)
+	unsubscribe := s.api.SubscribeAll(func(e events.Event) {
+		if req.RaceID != "" && e.RaceID != req.RaceID {
+			return
+		}
+		if len(types) > 0 && !types[e.Type] {
+			return
+		}
+		m, err := pb.FromEvent(e)
+		if err != nil {
+			return
+		}
+		select {
+		case outbox <- m.Marshal():
+		default:
+		}
+	})
+	defer unsubscribe()
+	flusher.Flush() // Send the response headers before the first event
+
+	for {
+		select {
+		case data := <-outbox:
+			if err := writeFrame(w, data); err != nil {
+				return err
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return nil
+		}
+	}
+}
+
+// decode unmarshals a request, failing with InvalidArgument
+func decode(m message, request []byte) error {
+	if err := m.Unmarshal(request); err != nil {
+		return statusf(CodeInvalidArgument, "invalid request: %v", err)
+	}
+	return nil
+}
+
+// readMessage reads the single length-prefixed request message of a call
+func readMessage(body io.Reader) ([]byte, error) {
+	var prefix [5]byte
+	if _, err := io.ReadFull(body, prefix[:]); err != nil {
+		return nil, statusf(CodeInvalidArgument, "missing request message: %v", err)
+	}
+	if prefix[0] != 0 {
+		return nil, statusf(CodeUnimplemented, "compressed messages are not supported")
+	}
+	size := binary.BigEndian.Uint32(prefix[1:])
+	if size > maxMessageSize {
+		return nil, statusf(CodeInvalidArgument, "request message of %d bytes exceeds %d", size, maxMessageSize)
+	}
+	request := make([]byte, size)
+	if _, err := io.ReadFull(body, request); err != nil {
+		return nil, statusf(CodeInvalidArgument, "truncated request message: %v", err)
+	}
+	return request, nil
+}
+
+// writeMessage writes a response message
+func writeMessage(w io.Writer, m message) error {
+	if err := writeFrame(w, m.Marshal()); err != nil {
+		return statusf(CodeInternal, "%v", err)
+	}
+	return nil
+}
+
+// writeFrame writes one uncompressed length-prefixed message
+func writeFrame(w io.Writer, data []byte) error {
+	frame := make([]byte, 5, 5+len(data))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(data)))
+	_, err := w.Write(append(frame, data...))
+	return err
+}
+
+// writeStatus sets the call's status trailers from err (nil is OK)
+func writeStatus(w http.ResponseWriter, err error) {
+	code, msg := CodeOK, ""
+	if err != nil {
+		var status *Status
+		if !errors.As(err, &status) {
+			status = &Status{Code: CodeInternal, Message: err.Error()}
+		}
+		code, msg = status.Code, status.Message
+	}
+	w.Header().Set("Grpc-Status", strconv.Itoa(int(code)))
+	if msg != "" {
+		w.Header().Set("Grpc-Message", url.PathEscape(msg))
+	}
+}
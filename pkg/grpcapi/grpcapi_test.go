@@ -0,0 +1,183 @@
+package grpcapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/benharold/libdrag/pkg/api"
+	"github.com/benharold/libdrag/pkg/events"
+	"github.com/benharold/libdrag/pkg/pb"
+)
+
+func newTestServer(t *testing.T) (*api.LibDragAPI, *httptest.Server) {
+	libdragAPI := api.NewLibDragAPI()
+	if err := libdragAPI.Initialize(); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	srv := httptest.NewUnstartedServer(NewServer(libdragAPI))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	t.Cleanup(func() {
+		srv.Close()
+		libdragAPI.Stop()
+	})
+	return libdragAPI, srv
+}
+
+// open starts a call and returns the response once its headers arrive
+func open(ctx context.Context, t *testing.T, srv *httptest.Server, method string, req message) *http.Response {
+	t.Helper()
+	var body bytes.Buffer
+	if err := writeFrame(&body, req.Marshal()); err != nil {
+		t.Fatalf("writeFrame failed: %v", err)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, srv.URL+"/"+ServiceName+"/"+method, &body)
+	if err != nil {
+		t.Fatalf("NewRequest failed: %v", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/grpc")
+	resp, err := srv.Client().Do(httpReq)
+	if err != nil {
+		t.Fatalf("%s failed: %v", method, err)
+	}
+	if resp.ProtoMajor != 2 {
+		t.Fatalf("Expected HTTP/2, got %s", resp.Proto)
+	}
+	return resp
+}
+
+// readFrame reads one length-prefixed response message
+func readFrame(r io.Reader) ([]byte, error) {
+	var prefix [5]byte
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		return nil, err
+	}
+	data := make([]byte, binary.BigEndian.Uint32(prefix[1:]))
+	_, err := io.ReadFull(r, data)
+	return data, err
+}
+
+// invoke makes a unary call and returns its status code
+func invoke(t *testing.T, srv *httptest.Server, method string, req, reply message) Code {
+	t.Helper()
+	resp := open(context.Background(), t, srv, method, req)
+	defer resp.Body.Close()
+
+	data, err := readFrame(resp.Body)
+	if err == nil && reply != nil {
+		if err := reply.Unmarshal(data); err != nil {
+			t.Fatalf("%s reply: %v", method, err)
+		}
+	}
+	io.Copy(io.Discard, resp.Body) // Trailers arrive after the body
+	code, err := strconv.Atoi(resp.Trailer.Get("Grpc-Status"))
+	if err != nil {
+		t.Fatalf("%s: missing grpc-status trailer: %v", method, err)
+	}
+	return Code(code)
+}
+
+func TestUnaryCalls(t *testing.T) {
+	libdragAPI, srv := newTestServer(t)
+
+	var started pb.StartRaceResponse
+	req := &pb.StartRaceRequest{Class: "Super Gas", Drivers: map[int32]string{1: "SG-101", 2: "SG-202"}}
+	if code := invoke(t, srv, "StartRace", req, &started); code != CodeOK || started.RaceID == "" {
+		t.Fatalf("StartRace returned %d, %+v", code, started)
+	}
+
+	var status pb.RaceStatus
+	if code := invoke(t, srv, "GetRaceStatus", &pb.RaceRequest{RaceID: started.RaceID}, &status); code != CodeOK || status.State == "" {
+		t.Fatalf("GetRaceStatus returned %d, %+v", code, status)
+	}
+
+	staging := &pb.StagingBeamRequest{RaceID: started.RaceID, Lane: 1, BeamID: "pre_stage", Broken: true}
+	if code := invoke(t, srv, "SetStagingBeam", staging, &pb.Empty{}); code != CodeOK {
+		t.Fatalf("SetStagingBeam returned %d", code)
+	}
+	var tree pb.TreeStatus
+	if code := invoke(t, srv, "GetTreeStatus", &pb.RaceRequest{RaceID: started.RaceID}, &tree); code != CodeOK {
+		t.Fatalf("GetTreeStatus returned %d", code)
+	}
+	if len(tree.Lanes) == 0 || tree.Lanes[0].Lights["pre_stage"] != "on" {
+		t.Errorf("Expected lane 1 pre-stage on, got %+v", tree.Lanes)
+	}
+
+	staging.BeamID = "60_foot"
+	if code := invoke(t, srv, "SetStagingBeam", staging, nil); code != CodeFailedPrecondition {
+		t.Errorf("Expected FailedPrecondition for a non-staging beam, got %d", code)
+	}
+
+	if code := invoke(t, srv, "AbortRace", &pb.AbortRaceRequest{RaceID: started.RaceID}, &pb.Empty{}); code != CodeOK {
+		t.Fatalf("AbortRace returned %d", code)
+	}
+	var results pb.RaceResults
+	if code := invoke(t, srv, "GetResults", &pb.RaceRequest{RaceID: started.RaceID}, &results); code != CodeOK {
+		t.Fatalf("GetResults returned %d", code)
+	}
+	if results.RaceID != started.RaceID || results.Complete {
+		t.Errorf("Expected incomplete results of the aborted race, got %+v", results)
+	}
+	decision, _ := libdragAPI.GetDecisionByID(started.RaceID)
+	if results.Decision == nil || results.Decision.Reason != decision.Reason || results.Decision.WinnerLane != int32(decision.WinnerLane) {
+		t.Errorf("Expected the race's decision %+v, got %+v", decision, results.Decision)
+	}
+
+	if code := invoke(t, srv, "ArmTree", &pb.ArmTreeRequest{RaceID: "missing"}, nil); code != CodeNotFound {
+		t.Errorf("Expected NotFound for a missing race, got %d", code)
+	}
+	if code := invoke(t, srv, "Launch", &pb.Empty{}, nil); code != CodeUnimplemented {
+		t.Errorf("Expected Unimplemented for an unknown method, got %d", code)
+	}
+}
+
+func TestStreamEvents(t *testing.T) {
+	libdragAPI, srv := newTestServer(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req := &pb.StreamEventsRequest{RaceID: "race-1", Types: []string{string(events.EventRaceAbort)}}
+	resp := open(ctx, t, srv, "StreamEvents", req)
+	defer resp.Body.Close()
+
+	// The subscription is in place once the headers are flushed
+	libdragAPI.PublishEvent(events.NewEvent(events.EventRaceStart).WithRaceID("race-1").Build())
+	libdragAPI.PublishEvent(events.NewEvent(events.EventRaceAbort).WithRaceID("race-2").Build())
+	libdragAPI.PublishEvent(events.NewEvent(events.EventRaceAbort).WithRaceID("race-1").WithData("reason", "oil down").Build())
+
+	data, err := readFrame(resp.Body)
+	if err != nil {
+		t.Fatalf("readFrame failed: %v", err)
+	}
+	var m pb.Event
+	if err := m.Unmarshal(data); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	event, err := m.ToEvent()
+	if err != nil {
+		t.Fatalf("ToEvent failed: %v", err)
+	}
+	if event.Type != events.EventRaceAbort || event.RaceID != "race-1" || event.Data["reason"] != "oil down" {
+		t.Errorf("Expected race-1's abort, got %+v", event)
+	}
+}
+
+func TestRejectsNonGRPCRequests(t *testing.T) {
+	_, srv := newTestServer(t)
+
+	resp, err := srv.Client().Post(srv.URL+"/"+ServiceName+"/StartRace", "application/json", bytes.NewReader(nil))
+	if err != nil {
+		t.Fatalf("Post failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnsupportedMediaType {
+		t.Errorf("Expected status 415, got %d", resp.StatusCode)
+	}
+}
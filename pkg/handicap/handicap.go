@@ -0,0 +1,122 @@
+// Package handicap holds the bracket racing math as pure functions: the
+// handicap start from the difference in dial-ins, breakouts and package
+// totals, and the NHRA "first or worst" ruling when more than one lane
+// fouls. It depends only on the standard library, so it can be reused and
+// verified on its own.
+package handicap
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// StartDelays returns each lane's start delay for a bracket race: the lane
+// with the slowest dial-in gets the tree's green and every other lane waits
+// out the difference, rounded to the nanosecond. It returns nil unless
+// there are at least two lanes and every lane has a dial-in.
+func StartDelays(dialIns map[int]float64, lanes []int) map[int]time.Duration {
+	slowest := 0.0
+	for _, lane := range lanes {
+		dial, ok := dialIns[lane]
+		if !ok {
+			return nil
+		}
+		slowest = math.Max(slowest, dial)
+	}
+	if len(lanes) < 2 {
+		return nil
+	}
+
+	delays := make(map[int]time.Duration, len(lanes))
+	for _, lane := range lanes {
+		delays[lane] = time.Duration(math.Round((slowest - dialIns[lane]) * float64(time.Second)))
+	}
+	return delays
+}
+
+// Breakout reports whether an elapsed time broke out (ran quicker than the
+// dial-in) and by how much. Running exactly on the dial is not a breakout.
+func Breakout(elapsed float64, dial float64) (by float64, broke bool) {
+	if elapsed >= dial {
+		return 0, false
+	}
+	return dial - elapsed, true
+}
+
+// Package is a bracket run's total: reaction time plus how far the elapsed
+// time was over the dial-in. A red light or a breakout (elapsed under the
+// dial) has no package, and ok is false.
+func Package(reaction float64, elapsed float64, dial float64) (total float64, ok bool) {
+	if _, broke := Breakout(elapsed, dial); reaction < 0 || broke {
+		return 0, false
+	}
+	return reaction + elapsed - dial, true
+}
+
+// Foul kinds
+const (
+	KindRedLight = "red_light" // Left before green
+	KindBoundary = "boundary"  // Crossed the centerline or lane boundary
+	KindOther    = "foul"      // Any other foul reported by timing
+)
+
+// Ruling rules
+const (
+	RuleFirst = "first" // The first foul committed loses
+	RuleWorst = "worst" // A boundary foul loses over an earlier red light
+)
+
+// Foul is a foul committed in a lane
+type Foul struct {
+	Lane int       `json:"lane"`
+	Kind string    `json:"kind"`
+	At   time.Time `json:"at"`
+}
+
+// Ruling is the official ruling on a race in which more than one lane fouled
+type Ruling struct {
+	LosingLane int    `json:"losing_lane"`
+	Rule       string `json:"rule"`
+	Fouls      []Foul `json:"fouls"` // In the order committed
+}
+
+// FirstOrWorst applies the "first or worst" rule to fouls: a boundary foul
+// is the worst foul and loses over any red light; otherwise the first foul
+// committed loses. It returns nil unless more than one lane fouled, since a
+// single foul needs no ruling.
+func FirstOrWorst(fouls []Foul) *Ruling {
+	sorted := append([]Foul(nil), fouls...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].At.Before(sorted[j].At) })
+
+	lanes := make(map[int]bool)
+	for _, foul := range sorted {
+		lanes[foul.Lane] = true
+	}
+	if len(lanes) < 2 {
+		return nil
+	}
+
+	ruling := &Ruling{LosingLane: sorted[0].Lane, Rule: RuleFirst, Fouls: sorted}
+	for _, foul := range sorted {
+		if foul.Kind == KindBoundary {
+			if foul.Lane != ruling.LosingLane {
+				ruling.Rule = RuleWorst
+			}
+			ruling.LosingLane = foul.Lane
+			break
+		}
+	}
+	return ruling
+}
+
+// FoulKind classifies a timing foul reason
+func FoulKind(reason string) string {
+	switch reason {
+	case KindRedLight:
+		return KindRedLight
+	case KindBoundary, "centerline":
+		return KindBoundary
+	}
+	return KindOther
+}
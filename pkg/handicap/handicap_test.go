@@ -0,0 +1,244 @@
+package handicap
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestStartDelays(t *testing.T) {
+	tests := []struct {
+		name   string
+		dials  map[int]float64
+		lanes  []int
+		delays map[int]time.Duration // Nil expects no handicap
+	}{
+		{
+			name:   "slower dial leaves first",
+			dials:  map[int]float64{1: 10.50, 2: 8.90},
+			lanes:  []int{1, 2},
+			delays: map[int]time.Duration{1: 0, 2: 1600 * time.Millisecond},
+		},
+		{
+			name:   "lane order does not matter",
+			dials:  map[int]float64{1: 7.25, 2: 9.00},
+			lanes:  []int{2, 1},
+			delays: map[int]time.Duration{1: 1750 * time.Millisecond, 2: 0},
+		},
+		{
+			name:   "equal dials start together",
+			dials:  map[int]float64{1: 9.99, 2: 9.99},
+			lanes:  []int{1, 2},
+			delays: map[int]time.Duration{1: 0, 2: 0},
+		},
+		{
+			name:   "thousandths round to the nanosecond",
+			dials:  map[int]float64{1: 12.345, 2: 11.111},
+			lanes:  []int{1, 2},
+			delays: map[int]time.Duration{1: 0, 2: 1234 * time.Millisecond},
+		},
+		{
+			name:   "every lane against the slowest",
+			dials:  map[int]float64{1: 10.0, 2: 11.5, 3: 9.25},
+			lanes:  []int{1, 2, 3},
+			delays: map[int]time.Duration{1: 1500 * time.Millisecond, 2: 0, 3: 2250 * time.Millisecond},
+		},
+		{
+			name:  "missing dial",
+			dials: map[int]float64{1: 10.50},
+			lanes: []int{1, 2},
+		},
+		{
+			name:  "single lane",
+			dials: map[int]float64{1: 10.50},
+			lanes: []int{1},
+		},
+		{
+			name:  "no lanes",
+			dials: map[int]float64{1: 10.50, 2: 8.90},
+		},
+		{
+			name:  "dial for a lane not racing is ignored",
+			dials: map[int]float64{1: 10.50, 3: 8.90},
+			lanes: []int{1, 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			delays := StartDelays(tt.dials, tt.lanes)
+			if tt.delays == nil {
+				if delays != nil {
+					t.Errorf("Expected no handicap, got %v", delays)
+				}
+				return
+			}
+			if len(delays) != len(tt.delays) {
+				t.Fatalf("Expected %v, got %v", tt.delays, delays)
+			}
+			for lane, want := range tt.delays {
+				if got, ok := delays[lane]; !ok || got != want {
+					t.Errorf("Lane %d: expected %v, got %v", lane, want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestBreakout(t *testing.T) {
+	tests := []struct {
+		name    string
+		elapsed float64
+		dial    float64
+		by      float64
+		broke   bool
+	}{
+		{name: "over the dial", elapsed: 10.512, dial: 10.50},
+		{name: "dead on the dial", elapsed: 10.50, dial: 10.50},
+		{name: "under by a thousandth", elapsed: 10.499, dial: 10.50, by: 0.001, broke: true},
+		{name: "well under", elapsed: 9.87, dial: 10.50, by: 0.63, broke: true},
+		{name: "way over", elapsed: 15.0, dial: 10.50},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			by, broke := Breakout(tt.elapsed, tt.dial)
+			if broke != tt.broke || math.Abs(by-tt.by) > 1e-9 {
+				t.Errorf("Expected (%.3f, %v), got (%.3f, %v)", tt.by, tt.broke, by, broke)
+			}
+		})
+	}
+}
+
+func TestPackage(t *testing.T) {
+	tests := []struct {
+		name     string
+		reaction float64
+		elapsed  float64
+		dial     float64
+		total    float64
+		ok       bool
+	}{
+		{name: "perfect light on the dial", reaction: 0, elapsed: 10.50, dial: 10.50, total: 0, ok: true},
+		{name: "light plus over the dial", reaction: 0.012, elapsed: 10.515, dial: 10.50, total: 0.027, ok: true},
+		{name: "slow light on the dial", reaction: 0.250, elapsed: 10.50, dial: 10.50, total: 0.25, ok: true},
+		{name: "red light", reaction: -0.004, elapsed: 10.52, dial: 10.50},
+		{name: "breakout", reaction: 0.010, elapsed: 10.49, dial: 10.50},
+		{name: "red light and breakout", reaction: -0.1, elapsed: 10.0, dial: 10.50},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			total, ok := Package(tt.reaction, tt.elapsed, tt.dial)
+			if ok != tt.ok || math.Abs(total-tt.total) > 1e-9 {
+				t.Errorf("Expected (%.3f, %v), got (%.3f, %v)", tt.total, tt.ok, total, ok)
+			}
+		})
+	}
+}
+
+func TestFirstOrWorst(t *testing.T) {
+	green := time.Now()
+	at := func(ms int) time.Time { return green.Add(time.Duration(ms) * time.Millisecond) }
+
+	tests := []struct {
+		name   string
+		fouls  []Foul
+		loser  int
+		rule   string
+		noRule bool
+	}{
+		{
+			name:   "no fouls",
+			noRule: true,
+		},
+		{
+			name:   "single foul needs no ruling",
+			fouls:  []Foul{{Lane: 1, Kind: KindRedLight, At: at(-20)}},
+			noRule: true,
+		},
+		{
+			name:   "two fouls in one lane need no ruling",
+			fouls:  []Foul{{Lane: 2, Kind: KindRedLight, At: at(-20)}, {Lane: 2, Kind: KindBoundary, At: at(3000)}},
+			noRule: true,
+		},
+		{
+			name:  "first red light loses",
+			fouls: []Foul{{Lane: 2, Kind: KindRedLight, At: at(-5)}, {Lane: 1, Kind: KindRedLight, At: at(-20)}},
+			loser: 1,
+			rule:  RuleFirst,
+		},
+		{
+			name:  "boundary trumps an earlier red light",
+			fouls: []Foul{{Lane: 1, Kind: KindRedLight, At: at(-20)}, {Lane: 2, Kind: KindBoundary, At: at(3200)}},
+			loser: 2,
+			rule:  RuleWorst,
+		},
+		{
+			name:  "boundary trumps an earlier other foul",
+			fouls: []Foul{{Lane: 2, Kind: KindOther, At: at(-900)}, {Lane: 1, Kind: KindBoundary, At: at(1500)}},
+			loser: 1,
+			rule:  RuleWorst,
+		},
+		{
+			name:  "first boundary loses",
+			fouls: []Foul{{Lane: 2, Kind: KindBoundary, At: at(4100)}, {Lane: 1, Kind: KindBoundary, At: at(2500)}},
+			loser: 1,
+			rule:  RuleFirst,
+		},
+		{
+			name:  "boundary by the first offender is still first",
+			fouls: []Foul{{Lane: 1, Kind: KindRedLight, At: at(-30)}, {Lane: 2, Kind: KindRedLight, At: at(-10)}, {Lane: 1, Kind: KindBoundary, At: at(2800)}},
+			loser: 1,
+			rule:  RuleFirst,
+		},
+		{
+			name:  "first foul loses without a boundary",
+			fouls: []Foul{{Lane: 1, Kind: KindOther, At: at(-900)}, {Lane: 2, Kind: KindRedLight, At: at(-10)}},
+			loser: 1,
+			rule:  RuleFirst,
+		},
+		{
+			name:  "simultaneous fouls keep the order given",
+			fouls: []Foul{{Lane: 2, Kind: KindRedLight, At: at(-10)}, {Lane: 1, Kind: KindRedLight, At: at(-10)}},
+			loser: 2,
+			rule:  RuleFirst,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ruling := FirstOrWorst(tt.fouls)
+			if tt.noRule {
+				if ruling != nil {
+					t.Errorf("Expected no ruling, got %+v", ruling)
+				}
+				return
+			}
+			if ruling == nil || ruling.LosingLane != tt.loser || ruling.Rule != tt.rule {
+				t.Fatalf("Expected lane %d to lose on %s, got %+v", tt.loser, tt.rule, ruling)
+			}
+			for i := 1; i < len(ruling.Fouls); i++ {
+				if ruling.Fouls[i].At.Before(ruling.Fouls[i-1].At) {
+					t.Errorf("Expected fouls in the order committed, got %+v", ruling.Fouls)
+				}
+			}
+		})
+	}
+}
+
+func TestFoulKind(t *testing.T) {
+	tests := map[string]string{
+		"red_light":       KindRedLight,
+		"boundary":        KindBoundary,
+		"centerline":      KindBoundary,
+		"deep_stage":      KindOther,
+		"staging_timeout": KindOther,
+		"":                KindOther,
+	}
+	for reason, want := range tests {
+		if got := FoulKind(reason); got != want {
+			t.Errorf("FoulKind(%q): expected %q, got %q", reason, want, got)
+		}
+	}
+}
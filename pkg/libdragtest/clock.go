@@ -0,0 +1,45 @@
+package libdragtest
+
+import (
+	"sync"
+	"time"
+)
+
+// Epoch is the fixed time fake clocks and virtual time start at by default
+var Epoch = time.Date(2025, time.January, 1, 12, 0, 0, 0, time.UTC)
+
+// FakeClock is a manually advanced clock for deterministic timestamps
+type FakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewFakeClock creates a fake clock starting at start (or a fixed epoch if zero)
+func NewFakeClock(start time.Time) *FakeClock {
+	if start.IsZero() {
+		start = Epoch
+	}
+	return &FakeClock{now: start}
+}
+
+// Now returns the current fake time
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Advance moves the clock forward and returns the new time
+func (c *FakeClock) Advance(d time.Duration) time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	return c.now
+}
+
+// Set moves the clock to an absolute time
+func (c *FakeClock) Set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = t
+}
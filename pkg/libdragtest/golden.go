@@ -0,0 +1,199 @@
+package libdragtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/benharold/libdrag/pkg/events"
+	"github.com/benharold/libdrag/pkg/timing"
+)
+
+var updateGolden = flag.Bool("libdragtest.update", false, "rewrite golden event streams with the current output")
+
+// GoldenOptions selects what a golden event stream holds
+type GoldenOptions struct {
+	Start       time.Time          // Offsets are from Start, or from the first event when zero
+	IgnoreTypes []events.EventType // Event types left out, such as chatty status updates
+	IgnoreData  []string           // Data keys left out, such as IDs that change every run
+}
+
+// FormatEvents renders an event stream for a golden file, one event per
+// line in delivery order: its time as an offset, its type and lane, and its
+// data as JSON with keys sorted and every timestamp in it made an offset
+// too. Race IDs are left out, so a stream compares across runs.
+func FormatEvents(evs []events.Event, opts GoldenOptions) string {
+	ignoreType := make(map[events.EventType]bool, len(opts.IgnoreTypes))
+	for _, eventType := range opts.IgnoreTypes {
+		ignoreType[eventType] = true
+	}
+	ignoreData := make(map[string]bool, len(opts.IgnoreData))
+	for _, key := range opts.IgnoreData {
+		ignoreData[key] = true
+	}
+
+	start := opts.Start
+	if start.IsZero() && len(evs) > 0 {
+		start = evs[0].Timestamp
+	}
+
+	var b strings.Builder
+	for _, e := range evs {
+		if ignoreType[e.Type] {
+			continue
+		}
+		fmt.Fprintf(&b, "%s %s", offset(e.Timestamp, start), e.Type)
+		if e.Lane != 0 {
+			fmt.Fprintf(&b, " lane=%d", e.Lane)
+		}
+		data := make(map[string]interface{}, len(e.Data))
+		for key, value := range e.Data {
+			if !ignoreData[key] {
+				data[key] = normalizeValue(value, start)
+			}
+		}
+		if len(data) > 0 {
+			encoded, _ := json.Marshal(data) // Normalized values always encode
+			fmt.Fprintf(&b, " %s", encoded)
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// offset formats t as seconds from start
+func offset(t, start time.Time) string {
+	return fmt.Sprintf("%+.3fs", t.Sub(start).Seconds())
+}
+
+// normalizeValue returns a JSON-ready copy of an event data value with its
+// timestamps, however deeply nested, replaced by offsets from start
+func normalizeValue(value interface{}, start time.Time) interface{} {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.UseNumber() // Keep numbers exactly as encoded
+	var decoded interface{}
+	if err := decoder.Decode(&decoded); err != nil {
+		return fmt.Sprint(value)
+	}
+	return relativeTimes(decoded, start)
+}
+
+// relativeTimes replaces RFC 3339 timestamps in decoded JSON with offsets
+func relativeTimes(value interface{}, start time.Time) interface{} {
+	switch v := value.(type) {
+	case string:
+		if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+			if t.IsZero() {
+				return "zero"
+			}
+			return offset(t, start)
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = relativeTimes(v[i], start)
+		}
+	case map[string]interface{}:
+		for key := range v {
+			v[key] = relativeTimes(v[key], start)
+		}
+	}
+	return value
+}
+
+// CompareGolden compares a formatted event stream with the golden file at
+// path, describing the first line that differs. Run the test with
+// -libdragtest.update to write the file from got instead.
+func CompareGolden(path, got string) error {
+	if *updateGolden {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return err
+		}
+		return os.WriteFile(path, []byte(got), 0o644)
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("%v (run with -libdragtest.update to create it)", err)
+	}
+	if string(want) == got {
+		return nil
+	}
+	wantLines := strings.Split(string(want), "\n")
+	gotLines := strings.Split(got, "\n")
+	for i := 0; i < len(wantLines) || i < len(gotLines); i++ {
+		var wantLine, gotLine string
+		if i < len(wantLines) {
+			wantLine = wantLines[i]
+		}
+		if i < len(gotLines) {
+			gotLine = gotLines[i]
+		}
+		if wantLine != gotLine {
+			return fmt.Errorf("%s:%d differs\nwant: %s\n got: %s", path, i+1, wantLine, gotLine)
+		}
+	}
+	return nil
+}
+
+// CheckRaceSequence checks an event stream for the sequencing every race
+// must keep, whatever components produced it: the green comes on only once
+// every lane on the tree has staged, a race completes only after each lane
+// it reports as finished has crossed the finish line (or had its result
+// entered), and the winner follows the completion.
+func CheckRaceSequence(evs []events.Event) error {
+	staged := make(map[int]bool)
+	finished := make(map[int]bool)
+	complete := false
+
+	for i, e := range evs {
+		switch e.Type {
+		case events.EventTreePreStage:
+			if _, seen := staged[e.Lane]; !seen {
+				staged[e.Lane] = false
+			}
+		case events.EventTreeStage:
+			staged[e.Lane], _ = e.Data["beam_broken"].(bool)
+		case events.EventTreeGreenOn:
+			lanes, ok := e.Data["lanes"].([]int)
+			if !ok {
+				for lane := range staged {
+					lanes = append(lanes, lane)
+				}
+				sort.Ints(lanes)
+			}
+			for _, lane := range lanes {
+				if !staged[lane] {
+					return fmt.Errorf("event %d: green on before lane %d staged", i, lane)
+				}
+			}
+			for _, lane := range lanes {
+				delete(staged, lane) // Leaving the line clears the stage beam
+			}
+		case events.EventTimingQuarterMile, events.EventTimingEighthMile, events.EventTimingManualEntry:
+			finished[e.Lane] = true
+		case events.EventRaceComplete:
+			results, _ := e.Data["results"].(map[int]*timing.TimingResults)
+			for lane, result := range results {
+				if result.IsComplete && !finished[lane] {
+					return fmt.Errorf("event %d: race complete before lane %d finished", i, lane)
+				}
+			}
+			complete = true
+		case events.EventRaceWinner:
+			if !complete {
+				return fmt.Errorf("event %d: winner declared before the race completed", i)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+// Package libdragtest provides fixtures for writing fast, deterministic tests
+// against libdrag: a fake clock, event recorders, prebuilt configurations and
+// a scripted race runner that drives the tree and timing system directly.
+package libdragtest
+
+import (
+	"time"
+
+	"github.com/benharold/libdrag/pkg/config"
+)
+
+// NewConfig returns a default configuration for the given class and tree type
+func NewConfig(class string, sequence config.TreeSequenceType) *config.DefaultConfig {
+	cfg := config.NewDefaultConfig()
+	cfg.SetRacingClass(class)
+	cfg.TreeConfig.Type = sequence
+	if sequence == config.TreeSequenceSportsman {
+		cfg.TreeConfig.GreenDelay = 500 * time.Millisecond
+	}
+	return cfg
+}
+
+// ProConfig returns a Pro tree (.400) configuration for a professional class
+func ProConfig() *config.DefaultConfig {
+	return NewConfig("Top Fuel", config.TreeSequencePro)
+}
+
+// SportsmanConfig returns a Sportsman tree (.500) configuration
+func SportsmanConfig() *config.DefaultConfig {
+	return NewConfig("Sportsman", config.TreeSequenceSportsman)
+}
+
+// FastConfig returns a configuration with shortened tree delays so tree
+// sequences complete in a few milliseconds of wall time
+func FastConfig() *config.DefaultConfig {
+	cfg := config.NewDefaultConfig()
+	cfg.TreeConfig.AmberDelay = time.Millisecond
+	cfg.TreeConfig.GreenDelay = time.Millisecond
+	cfg.SafetyConfig.MinStagingTime = time.Millisecond
+	return cfg
+}
@@ -0,0 +1,450 @@
+package libdragtest
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/benharold/libdrag/internal/vehicle"
+	"github.com/benharold/libdrag/pkg/autostart"
+	"github.com/benharold/libdrag/pkg/component"
+	"github.com/benharold/libdrag/pkg/events"
+	"github.com/benharold/libdrag/pkg/orchestrator"
+	"github.com/benharold/libdrag/pkg/simulation"
+	"github.com/benharold/libdrag/pkg/timers"
+	"github.com/benharold/libdrag/pkg/timing"
+	"github.com/benharold/libdrag/pkg/tree"
+)
+
+func TestFakeClock(t *testing.T) {
+	clock := NewFakeClock(time.Time{})
+	start := clock.Now()
+
+	clock.Advance(400 * time.Millisecond)
+	if got := clock.Now().Sub(start); got != 400*time.Millisecond {
+		t.Fatalf("Expected clock to advance 400ms, got %v", got)
+	}
+}
+
+func TestScriptedRace(t *testing.T) {
+	race, err := NewRace(ProConfig())
+	if err != nil {
+		t.Fatalf("NewRace failed: %v", err)
+	}
+	defer race.Close()
+
+	results := race.Run(
+		LaneRun{Lane: 1, ReactionTime: 50 * time.Millisecond, SixtyFoot: 850 * time.Millisecond, QuarterMile: 3700 * time.Millisecond},
+		LaneRun{Lane: 2, ReactionTime: -20 * time.Millisecond, SixtyFoot: 900 * time.Millisecond, QuarterMile: 3800 * time.Millisecond},
+	)
+
+	lane1 := results[1]
+	if lane1 == nil || lane1.ReactionTime == nil || *lane1.ReactionTime != 0.05 {
+		t.Fatalf("Expected lane 1 reaction time 0.050, got %+v", lane1)
+	}
+	if lane1.QuarterMileTime == nil || *lane1.QuarterMileTime != 3.7 {
+		t.Fatalf("Expected lane 1 ET 3.700, got %v", lane1.QuarterMileTime)
+	}
+	if !results[2].IsFoul || results[2].FoulReason != "red_light" {
+		t.Fatalf("Expected lane 2 red light foul, got %+v", results[2])
+	}
+	if lights := race.Tree.GetTreeStatus().LightStates; lights[2][tree.LightRed] != tree.LightOn || lights[1][tree.LightRed] == tree.LightOn {
+		t.Fatalf("Expected only lane 2's red bulb lit, got %v", lights)
+	}
+
+	// Each lane stages and then clears the stage beam when it leaves
+	if race.Recorder.Count(events.EventTreeStage) != 4 {
+		t.Fatalf("Expected 4 stage events, got %d", race.Recorder.Count(events.EventTreeStage))
+	}
+	if race.Recorder.Count(events.EventTimingQuarterMile) != 2 {
+		t.Fatalf("Expected 2 quarter mile events, got %d", race.Recorder.Count(events.EventTimingQuarterMile))
+	}
+}
+
+func TestEventRecorderWaitFor(t *testing.T) {
+	bus := events.NewEventBus(true)
+	defer bus.Stop()
+	recorder := NewEventRecorder(bus)
+	defer recorder.Stop()
+
+	bus.Publish(events.NewEvent(events.EventRaceStart).Build())
+
+	if _, ok := recorder.WaitFor(events.EventRaceStart, time.Second); !ok {
+		t.Fatal("Expected race start event to be recorded")
+	}
+	if _, ok := recorder.WaitFor(events.EventRaceComplete, 10*time.Millisecond); ok {
+		t.Fatal("Did not expect race complete event")
+	}
+}
+
+func TestVirtualTimePipeline(t *testing.T) {
+	wheel, restore := UseVirtualTime()
+	defer restore()
+
+	bus := events.NewEventBus(false)
+	recorder := NewEventRecorder(bus)
+	defer recorder.Stop()
+
+	cfg := ProConfig()
+	race := orchestrator.NewRaceOrchestrator()
+	race.SetEventBus(bus)
+	race.SetRaceID("race-1")
+	components := []component.Component{timing.NewTimingSystemWithRaceID("race-1"), tree.NewChristmasTree()}
+	if err := race.Initialize(context.Background(), components, cfg); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+
+	realStart := time.Now()
+	if err := race.StartRace(vehicle.NewSimpleVehicle(1), vehicle.NewSimpleVehicle(2)); err != nil {
+		t.Fatalf("StartRace failed: %v", err)
+	}
+
+	// Pre-stage and stage both lanes, then wait before starting the tree
+	for i := 0; i < 5; i++ {
+		wheel.BlockUntil(1)
+		wheel.Step()
+	}
+	// The tree's green delay and the orchestrator's wait run together. Woken
+	// goroutines run on their own, so let the tree go green before moving on.
+	wheel.BlockUntil(2)
+	wheel.Step()
+	if _, ok := recorder.WaitFor(events.EventTreeGreenOn, time.Second); !ok {
+		t.Fatal("Tree never went green")
+	}
+	wheel.Step()
+	// Three simulated beam passes
+	for i := 0; i < 3; i++ {
+		wheel.BlockUntil(1)
+		wheel.Step()
+	}
+
+	complete, ok := recorder.WaitFor(events.EventRaceComplete, time.Second)
+	if !ok {
+		t.Fatalf("Expected race complete, state %s", race.GetRaceStatus().State)
+	}
+	if final, _ := complete.Data["results"].(map[int]*timing.TimingResults); len(final) != 2 || !final[2].IsComplete {
+		t.Errorf("Expected the final results in race.complete, got %+v", complete.Data["results"])
+	}
+	if complete.Data["winner_lane"] != 1 || complete.Data["margin"] != race.GetDecision().Margin {
+		t.Errorf("Expected lane 1's win in race.complete, got %+v", complete.Data)
+	}
+	if elapsed := time.Since(realStart); elapsed > time.Second {
+		t.Errorf("Virtual race took %v of real time", elapsed)
+	}
+	if got := wheel.Now().Sub(Epoch); got != 2650*time.Millisecond {
+		t.Errorf("Expected 2.65s of virtual time, got %v", got)
+	}
+
+	green := recorder.OfType(events.EventTreeGreenOn)
+	if len(green) != 1 || green[0].Timestamp != Epoch.Add(2000*time.Millisecond+cfg.Tree().GreenDelay) {
+		t.Fatalf("Expected green at a fixed virtual time, got %+v", green)
+	}
+	results := race.GetResults()
+	if results[1].ReactionTime == nil || *results[1].ReactionTime != 0.4 {
+		t.Errorf("Expected lane 1 reaction time 0.400, got %+v", results[1])
+	}
+}
+
+func TestInjectedClock(t *testing.T) {
+	wheel := timers.NewVirtualWheel(Epoch, timers.DefaultTick)
+
+	bus := events.NewEventBus(false)
+	recorder := NewEventRecorder(bus)
+	defer recorder.Stop()
+
+	race := orchestrator.NewRaceOrchestrator()
+	race.SetEventBus(bus)
+	race.SetRaceID("race-clock")
+	race.SetClock(wheel)
+	components := []component.Component{timing.NewTimingSystemWithRaceID("race-clock"), tree.NewChristmasTree()}
+	if err := race.Initialize(context.Background(), components, ProConfig()); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	if err := race.StartRace(vehicle.NewSimpleVehicle(1), vehicle.NewSimpleVehicle(2)); err != nil {
+		t.Fatalf("StartRace failed: %v", err)
+	}
+	if status := race.GetRaceStatus(); !status.StartTime.Equal(Epoch) {
+		t.Errorf("Expected the race to start at the injected clock's time, got %v", status.StartTime)
+	}
+
+	// The same steps as on the default wheel, without replacing it
+	for i := 0; i < 5; i++ {
+		wheel.BlockUntil(1)
+		wheel.Step()
+	}
+	wheel.BlockUntil(2)
+	wheel.Step()
+	if _, ok := recorder.WaitFor(events.EventTreeGreenOn, time.Second); !ok {
+		t.Fatal("Tree never went green")
+	}
+	wheel.Step()
+	for i := 0; i < 3; i++ {
+		wheel.BlockUntil(1)
+		wheel.Step()
+	}
+	if _, ok := recorder.WaitFor(events.EventRaceComplete, time.Second); !ok {
+		t.Fatalf("Expected race complete, state %s", race.GetRaceStatus().State)
+	}
+
+	if got := wheel.Now().Sub(Epoch); got != 2650*time.Millisecond {
+		t.Errorf("Expected 2.65s of virtual time, got %v", got)
+	}
+	for _, info := range timers.Default().Pending() {
+		if info.Label.RaceID == "race-clock" {
+			t.Errorf("Expected no timers on the default wheel, found %+v", info)
+		}
+	}
+	if results := race.GetResults(); results[1].ReactionTime == nil || *results[1].ReactionTime != 0.4 {
+		t.Errorf("Expected lane 1 reaction time 0.400, got %+v", results[1])
+	}
+}
+
+func TestGoldenRaceStreams(t *testing.T) {
+	street := simulation.Vehicle{
+		Name:            "street",
+		Weight:          3600,
+		TorqueCurve:     []simulation.TorquePoint{{RPM: 1000, Torque: 300}, {RPM: 4000, Torque: 420}, {RPM: 6500, Torque: 330}},
+		LaunchRPM:       2500,
+		ShiftRPM:        6200,
+		ShiftTime:       150 * time.Millisecond,
+		Gears:           []float64{2.66, 1.78, 1.30, 1.0},
+		FinalDrive:      3.73,
+		TireDiameter:    27,
+		Traction:        0.9,
+		DrivenWeight:    0.55,
+		DragCoefficient: 0.35,
+		FrontalArea:     22,
+		ReactionTime:    200 * time.Millisecond,
+	}
+	lighter := street
+	lighter.Weight = 3300
+	physics, err := simulation.NewPhysicsSimulator(map[int]simulation.Vehicle{2: lighter}, street, 1)
+	if err != nil {
+		t.Fatalf("NewPhysicsSimulator failed: %v", err)
+	}
+
+	for name, setup := range map[string]func(*SimulatedRace){
+		"pro":       func(*SimulatedRace) {},
+		"sportsman": func(*SimulatedRace) {},
+		"bracket": func(race *SimulatedRace) {
+			race.Orchestrator.SetDialIn(1, 10.90)
+			race.Orchestrator.SetDialIn(2, 11.25)
+		},
+		"physics": func(race *SimulatedRace) {
+			race.Orchestrator.SetSimulator(physics)
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			cfg := ProConfig()
+			if name != "pro" {
+				cfg = SportsmanConfig()
+			}
+			race, err := NewSimulatedRace(cfg)
+			if err != nil {
+				t.Fatalf("NewSimulatedRace failed: %v", err)
+			}
+			defer race.Close()
+			setup(race)
+
+			stream, err := race.Run()
+			if err != nil {
+				t.Fatalf("Run failed: %v", err)
+			}
+			if err := CheckRaceSequence(stream); err != nil {
+				t.Errorf("Sequence check failed: %v", err)
+			}
+			got := FormatEvents(stream, GoldenOptions{Start: Epoch})
+			if err := CompareGolden(filepath.Join("testdata", name+".golden"), got); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestCheckRaceSequence(t *testing.T) {
+	stage := func(lane int) events.Event {
+		return events.NewEvent(events.EventTreeStage).WithLane(lane).WithData("beam_broken", true).Build()
+	}
+	preStage := events.NewEvent(events.EventTreePreStage).WithLane(2).WithData("beam_broken", true).Build()
+	green := events.NewEvent(events.EventTreeGreenOn).Build()
+	quarter := events.NewEvent(events.EventTimingQuarterMile).WithLane(1).Build()
+	complete := events.NewEvent(events.EventRaceComplete).
+		WithData("results", map[int]*timing.TimingResults{1: {Lane: 1, IsComplete: true}}).
+		Build()
+	winner := events.NewEvent(events.EventRaceWinner).WithLane(1).Build()
+
+	if err := CheckRaceSequence([]events.Event{stage(1), stage(2), green, quarter, complete, winner}); err != nil {
+		t.Errorf("Expected a good sequence to pass, got %v", err)
+	}
+	for name, stream := range map[string][]events.Event{
+		"green before all staged":  {stage(1), preStage, green},
+		"results before finish":    {stage(1), stage(2), green, complete, quarter},
+		"winner before completion": {stage(1), stage(2), green, quarter, winner, complete},
+	} {
+		if err := CheckRaceSequence(stream); err == nil {
+			t.Errorf("Expected %s to fail the sequence check", name)
+		}
+	}
+}
+
+func TestPairGroup(t *testing.T) {
+	wheel, restore := UseVirtualTime()
+	defer restore()
+
+	bus := events.NewEventBus(false)
+	recorder := NewEventRecorder(bus)
+	defer recorder.Stop()
+
+	cfg := ProConfig()
+	cfg.TrackConfig.LaneCount = 4
+	group := orchestrator.NewPairGroup(nil)
+	group.SetEventBus(bus)
+	group.SetRaceID("quad")
+	group.SetAutoStart(&autostart.AutoStartConfig{
+		StagingTimeout:     10 * time.Second,
+		MinStagingDuration: 100 * time.Millisecond,
+		RandomDelayMin:     100 * time.Millisecond,
+		RandomDelayMax:     200 * time.Millisecond,
+		MaxRolloutDistance: 20,
+	})
+	if err := group.Initialize(context.Background(), cfg); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	defer group.Stop()
+	if err := group.StartRace(); err != nil {
+		t.Fatalf("StartRace failed: %v", err)
+	}
+
+	// Move virtual time a timer at a time, letting the pairs settle after each
+	for {
+		last := recorder.Len()
+		for quiet := 0; quiet < 10; quiet++ {
+			time.Sleep(time.Millisecond)
+			if now := recorder.Len(); now != last {
+				last, quiet = now, 0
+			}
+		}
+		if group.IsComplete() {
+			break
+		}
+		if wheel.Now().Sub(Epoch) > time.Minute || !wheel.Step() {
+			t.Fatalf("Pairs stalled at %v", wheel.Now().Sub(Epoch))
+		}
+	}
+
+	complete := recorder.OfType(events.EventRaceComplete)
+	if len(complete) != 2 {
+		t.Fatalf("Expected a race.complete per pair, got %d", len(complete))
+	}
+	for _, e := range complete {
+		pair, _ := e.Data["pair"].(string)
+		if e.RaceID != orchestrator.PairRaceID("quad", pair) {
+			t.Errorf("Expected pair %q's race ID, got %s", pair, e.RaceID)
+		}
+		final, _ := e.Data["results"].(map[int]*timing.TimingResults)
+		lanes := map[string][2]int{"A": {1, 2}, "B": {3, 4}}[pair]
+		if final[lanes[0]] == nil || final[lanes[1]] == nil || final[lanes[0]].Lane != lanes[0] {
+			t.Errorf("Expected pair %q's results by track lane, got %+v", pair, final)
+		}
+		if winner := e.Data["winner_lane"]; winner != lanes[0] && winner != lanes[1] {
+			t.Errorf("Expected pair %q's winner in its lanes, got %v", pair, winner)
+		}
+	}
+	if got := len(group.Results()); got != 4 {
+		t.Errorf("Expected results for all 4 lanes, got %d", got)
+	}
+	if activated := recorder.OfType(events.EventAutoStartActivated); len(activated) != 2 || activated[0].RaceID == activated[1].RaceID {
+		t.Errorf("Expected each pair's auto-start to activate, got %+v", activated)
+	}
+	for _, e := range recorder.OfType(events.EventTreeStage) {
+		if pr, _, ok := group.RaceForLane(e.Lane); !ok || pr.Pair.ID != e.Data["pair"] {
+			t.Errorf("Expected lane %d's stage event from its pair, got %v", e.Lane, e.Data["pair"])
+		}
+	}
+}
+
+func TestPairGroupValidation(t *testing.T) {
+	cfg := ProConfig()
+	cfg.TrackConfig.LaneCount = 4
+	for name, pairs := range map[string][]orchestrator.Pair{
+		"shared lane":  {{ID: "A", Lanes: [2]int{1, 2}}, {ID: "B", Lanes: [2]int{2, 3}}},
+		"off track":    {{ID: "A", Lanes: [2]int{4, 5}}},
+		"duplicate ID": {{ID: "A", Lanes: [2]int{1, 2}}, {ID: "A", Lanes: [2]int{3, 4}}},
+		"same lane":    {{ID: "A", Lanes: [2]int{1, 1}}},
+	} {
+		group := orchestrator.NewPairGroup(pairs)
+		if err := group.Initialize(context.Background(), cfg); err == nil {
+			t.Errorf("Expected %s to be rejected", name)
+		}
+		group.Stop()
+	}
+}
+
+func TestPairGroupAbortStopsAutoStart(t *testing.T) {
+	wheel, restore := UseVirtualTime()
+	defer restore()
+
+	bus := events.NewEventBus(false)
+	recorder := NewEventRecorder(bus)
+	defer recorder.Stop()
+
+	cfg := ProConfig()
+	cfg.TrackConfig.LaneCount = 4
+	group := orchestrator.NewPairGroup(nil)
+	group.SetEventBus(bus)
+	group.SetRaceID("quad")
+	group.SetAutoStart(&autostart.AutoStartConfig{
+		StagingTimeout:     10 * time.Second,
+		MinStagingDuration: 100 * time.Millisecond,
+		RandomDelayMin:     100 * time.Millisecond,
+		RandomDelayMax:     200 * time.Millisecond,
+		MaxRolloutDistance: 20,
+	})
+	if err := group.Initialize(context.Background(), cfg); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	defer group.Stop()
+	if err := group.StartRace(); err != nil {
+		t.Fatalf("StartRace failed: %v", err)
+	}
+
+	settle := func() {
+		last := recorder.Len()
+		for quiet := 0; quiet < 10; quiet++ {
+			time.Sleep(time.Millisecond)
+			if now := recorder.Len(); now != last {
+				last, quiet = now, 0
+			}
+		}
+	}
+
+	// Abort once both pairs' staging clocks are running
+	for {
+		settle()
+		if recorder.Count(events.EventAutoStartCountdownStarted) == 2 {
+			break
+		}
+		if wheel.Now().Sub(Epoch) > time.Minute || !wheel.Step() {
+			t.Fatalf("Auto-start never counted down, saw %v", recorder.Types())
+		}
+	}
+	group.Abort("test abort")
+	settle()
+	aborted := recorder.Len()
+
+	for wheel.Now().Sub(Epoch) < 2*time.Minute && wheel.Step() {
+		settle()
+	}
+	for _, e := range recorder.Events()[aborted:] {
+		if strings.HasPrefix(string(e.Type), "autostart.") || strings.HasPrefix(string(e.Type), "tree.") {
+			t.Errorf("Expected no auto-start or tree events after Abort, got %s on lane %d", e.Type, e.Lane)
+		}
+	}
+	for _, pr := range group.Races() {
+		if status := pr.AutoStart().GetStatus(); status.Status != "stopped" {
+			t.Errorf("Expected pair %s's auto-start stopped by Abort", pr.Pair.ID)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package libdragtest
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/benharold/libdrag/pkg/config"
+	"github.com/benharold/libdrag/pkg/events"
+	"github.com/benharold/libdrag/pkg/timing"
+	"github.com/benharold/libdrag/pkg/tree"
+)
+
+// FakeBeams drives staging and timing beams for a tree and timing system,
+// stamping every trigger with the fake clock
+type FakeBeams struct {
+	tree   *tree.ChristmasTree
+	timing *timing.TimingSystem
+	clock  *FakeClock
+}
+
+// NewFakeBeams creates beam drivers for the given components
+func NewFakeBeams(christmasTree *tree.ChristmasTree, timingSystem *timing.TimingSystem, clock *FakeClock) *FakeBeams {
+	return &FakeBeams{
+		tree:   christmasTree,
+		timing: timingSystem,
+		clock:  clock,
+	}
+}
+
+// PreStage breaks the pre-stage beam in a lane
+func (fb *FakeBeams) PreStage(lane int) {
+	fb.tree.SetPreStage(lane, true)
+}
+
+// Stage breaks the pre-stage and stage beams in a lane
+func (fb *FakeBeams) Stage(lane int) {
+	fb.tree.SetPreStage(lane, true)
+	fb.tree.SetStage(lane, true)
+}
+
+// DeepStage breaks the stage beam and clears the pre-stage beam in a lane
+func (fb *FakeBeams) DeepStage(lane int) {
+	fb.tree.SetStage(lane, true)
+	fb.tree.SetPreStage(lane, false)
+}
+
+// BackOut clears both staging beams in a lane
+func (fb *FakeBeams) BackOut(lane int) {
+	fb.tree.SetStage(lane, false)
+	fb.tree.SetPreStage(lane, false)
+}
+
+// Leave clears the staging beams and reports the vehicle leaving the
+// starting line at the current fake time
+func (fb *FakeBeams) Leave(lane int) {
+	fb.BackOut(lane)
+	fb.timing.TriggerBeam("stage", lane, fb.clock.Now())
+}
+
+// Cross reports a downtrack beam trigger at the current fake time
+func (fb *FakeBeams) Cross(beamID string, lane int) {
+	fb.timing.TriggerBeam(beamID, lane, fb.clock.Now())
+}
+
+// LaneRun scripts a single lane's run relative to the green light. A negative
+// ReactionTime produces a red light; zero downtrack splits are skipped.
+type LaneRun struct {
+	Lane         int
+	ReactionTime time.Duration
+	SixtyFoot    time.Duration // Elapsed from leaving the starting line
+	EighthMile   time.Duration
+	QuarterMile  time.Duration
+}
+
+// Race bundles a tree, timing system and synchronous event bus with a fake
+// clock so a complete run can be scripted without real sleeps
+type Race struct {
+	ID       string
+	Config   config.Config
+	Bus      *events.EventBus
+	Clock    *FakeClock
+	Tree     *tree.ChristmasTree
+	Timing   *timing.TimingSystem
+	Beams    *FakeBeams
+	Recorder *EventRecorder
+}
+
+// NewRace initializes and arms a tree and timing system for two lanes
+func NewRace(cfg config.Config) (*Race, error) {
+	if cfg == nil {
+		cfg = config.NewDefaultConfig()
+	}
+
+	r := &Race{
+		ID:     "libdragtest-race",
+		Config: cfg,
+		Bus:    events.NewEventBus(false),
+		Clock:  NewFakeClock(time.Time{}),
+		Tree:   tree.NewChristmasTree(),
+		Timing: timing.NewTimingSystem(),
+	}
+	r.Recorder = NewEventRecorder(r.Bus)
+	r.Beams = NewFakeBeams(r.Tree, r.Timing, r.Clock)
+
+	ctx := context.Background()
+	for _, c := range []interface {
+		Initialize(context.Context, config.Config) error
+		SetEventBus(*events.EventBus)
+		SetRaceID(string)
+	}{r.Timing, r.Tree} {
+		if err := c.Initialize(ctx, cfg); err != nil {
+			return nil, fmt.Errorf("failed to initialize race fixture: %v", err)
+		}
+		c.SetEventBus(r.Bus)
+		c.SetRaceID(r.ID)
+	}
+	r.Timing.SetRedLightHandler(func(lane int, _ float64) {
+		r.Tree.SetRedLight(lane)
+	})
+	if err := r.Timing.Arm(ctx); err != nil {
+		return nil, err
+	}
+	if err := r.Tree.Arm(ctx); err != nil {
+		return nil, err
+	}
+
+	r.Timing.StartRace()
+	r.Timing.AddVehicles([]int{1, 2})
+	return r, nil
+}
+
+// StageAll pre-stages and stages every lane
+func (r *Race) StageAll() {
+	for lane := 1; lane <= r.Config.Track().LaneCount; lane++ {
+		r.Beams.PreStage(lane)
+	}
+	for lane := 1; lane <= r.Config.Track().LaneCount; lane++ {
+		r.Beams.Stage(lane)
+	}
+}
+
+// Run stages both lanes, turns the green on at the current fake time and
+// plays each lane's script in time order. It returns the timing results.
+func (r *Race) Run(runs ...LaneRun) map[int]*timing.TimingResults {
+	r.StageAll()
+
+	green := r.Clock.Now()
+	type trigger struct {
+		at   time.Time
+		lane int
+		beam string
+	}
+	triggers := make([]trigger, 0)
+	for _, run := range runs {
+		start := green.Add(run.ReactionTime)
+		triggers = append(triggers, trigger{start, run.Lane, "stage"})
+		for beamID, split := range map[string]time.Duration{
+			"60_foot":   run.SixtyFoot,
+			"660_foot":  run.EighthMile,
+			"1320_foot": run.QuarterMile,
+		} {
+			if split > 0 {
+				triggers = append(triggers, trigger{start.Add(split), run.Lane, beamID})
+			}
+		}
+	}
+
+	// Red lights leave before the green, so they are played first
+	greenSet := false
+	for len(triggers) > 0 {
+		next := 0
+		for i, t := range triggers {
+			if t.at.Before(triggers[next].at) {
+				next = i
+			}
+		}
+		t := triggers[next]
+		triggers = append(triggers[:next], triggers[next+1:]...)
+
+		if !greenSet && !t.at.Before(green) {
+			r.Clock.Set(green)
+			r.Timing.SetGreenLight(green)
+			greenSet = true
+		}
+		r.Clock.Set(t.at)
+		if t.beam == "stage" {
+			r.Beams.Leave(t.lane)
+		} else {
+			r.Beams.Cross(t.beam, t.lane)
+		}
+	}
+	if !greenSet {
+		r.Timing.SetGreenLight(green)
+	}
+
+	return r.Timing.GetAllResults()
+}
+
+// Close unsubscribes the recorder and stops the event bus
+func (r *Race) Close() {
+	r.Recorder.Stop()
+	r.Bus.Stop()
+}
@@ -0,0 +1,117 @@
+package libdragtest
+
+import (
+	"sync"
+	"time"
+
+	"github.com/benharold/libdrag/pkg/events"
+)
+
+// EventRecorder captures every event published on a bus
+type EventRecorder struct {
+	mu          sync.Mutex
+	events      []events.Event
+	notify      chan struct{}
+	unsubscribe func()
+}
+
+// NewEventRecorder subscribes a recorder to all events on the bus
+func NewEventRecorder(bus *events.EventBus) *EventRecorder {
+	r := &EventRecorder{
+		events: make([]events.Event, 0),
+		notify: make(chan struct{}),
+	}
+	r.unsubscribe = bus.SubscribeAll(r.record)
+	return r
+}
+
+// record stores an event and wakes any waiters
+func (r *EventRecorder) record(event events.Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+	close(r.notify)
+	r.notify = make(chan struct{})
+}
+
+// Events returns a copy of all recorded events in delivery order
+func (r *EventRecorder) Events() []events.Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	result := make([]events.Event, len(r.events))
+	copy(result, r.events)
+	return result
+}
+
+// Len returns the number of recorded events
+func (r *EventRecorder) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.events)
+}
+
+// OfType returns recorded events of the given type
+func (r *EventRecorder) OfType(eventType events.EventType) []events.Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	result := make([]events.Event, 0)
+	for _, e := range r.events {
+		if e.Type == eventType {
+			result = append(result, e)
+		}
+	}
+	return result
+}
+
+// Count returns the number of recorded events of the given type
+func (r *EventRecorder) Count(eventType events.EventType) int {
+	return len(r.OfType(eventType))
+}
+
+// Types returns the recorded event types in delivery order
+func (r *EventRecorder) Types() []events.EventType {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	result := make([]events.EventType, len(r.events))
+	for i, e := range r.events {
+		result[i] = e.Type
+	}
+	return result
+}
+
+// WaitFor blocks until an event of the given type is recorded or the timeout
+// elapses. Events recorded before the call also satisfy the wait.
+func (r *EventRecorder) WaitFor(eventType events.EventType, timeout time.Duration) (events.Event, bool) {
+	deadline := time.After(timeout)
+	for {
+		r.mu.Lock()
+		for _, e := range r.events {
+			if e.Type == eventType {
+				r.mu.Unlock()
+				return e, true
+			}
+		}
+		notify := r.notify
+		r.mu.Unlock()
+
+		select {
+		case <-notify:
+		case <-deadline:
+			return events.Event{}, false
+		}
+	}
+}
+
+// Reset discards all recorded events
+func (r *EventRecorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = make([]events.Event, 0)
+}
+
+// Stop unsubscribes the recorder from the bus
+func (r *EventRecorder) Stop() {
+	if r.unsubscribe != nil {
+		r.unsubscribe()
+	}
+}
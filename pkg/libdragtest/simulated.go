@@ -0,0 +1,126 @@
+package libdragtest
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/benharold/libdrag/internal/vehicle"
+	"github.com/benharold/libdrag/pkg/component"
+	"github.com/benharold/libdrag/pkg/config"
+	"github.com/benharold/libdrag/pkg/events"
+	"github.com/benharold/libdrag/pkg/orchestrator"
+	"github.com/benharold/libdrag/pkg/timers"
+	"github.com/benharold/libdrag/pkg/timing"
+	"github.com/benharold/libdrag/pkg/tree"
+)
+
+// settle is how long a simulated race must be quiet, in real time, before
+// virtual time moves on: long enough for the goroutines a step woke to
+// publish what they will and reach their next sleep
+const settle = 20 * time.Millisecond
+
+// maxVirtualRace is the most virtual time a simulated race may take
+const maxVirtualRace = 10 * time.Minute
+
+// SimulatedRace runs a complete orchestrated race (staging, tree, the
+// orchestrator's simulated vehicles and the decision) on virtual time,
+// recording every event, for integration tests and golden event streams
+type SimulatedRace struct {
+	ID           string
+	Config       config.Config
+	Bus          *events.EventBus
+	Orchestrator *orchestrator.RaceOrchestrator
+	Recorder     *EventRecorder
+	Wheel        *timers.Wheel
+
+	restore func()
+}
+
+// NewSimulatedRace initializes an orchestrator with a timing system, a tree
+// and any extra components, such as custom ones under test, on a virtual
+// wheel installed as the default. Close restores the previous wheel, so
+// simulated races must not run in parallel.
+func NewSimulatedRace(cfg config.Config, extra ...component.Component) (*SimulatedRace, error) {
+	if cfg == nil {
+		cfg = config.NewDefaultConfig()
+	}
+	wheel, restore := UseVirtualTime()
+
+	r := &SimulatedRace{
+		ID:           "libdragtest-race",
+		Config:       cfg,
+		Bus:          events.NewEventBus(false),
+		Orchestrator: orchestrator.NewRaceOrchestrator(),
+		Wheel:        wheel,
+		restore:      restore,
+	}
+	r.Recorder = NewEventRecorder(r.Bus)
+	wheel.SetFireHook(func(timers.Label) { r.quiesce() })
+	r.Orchestrator.SetEventBus(r.Bus)
+	r.Orchestrator.SetRaceID(r.ID)
+
+	components := append([]component.Component{timing.NewTimingSystemWithRaceID(r.ID), tree.NewChristmasTree()}, extra...)
+	if err := r.Orchestrator.Initialize(context.Background(), components, cfg); err != nil {
+		r.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// Run starts the race and moves virtual time one timer at a time, letting
+// the race settle after each (even timers due together), until it completes
+// or is aborted. It returns the recorded events.
+func (r *SimulatedRace) Run() ([]events.Event, error) {
+	if err := r.Orchestrator.StartRace(vehicle.NewSimpleVehicle(1), vehicle.NewSimpleVehicle(2)); err != nil {
+		return nil, err
+	}
+	for {
+		r.quiesce()
+		if r.finished() {
+			return r.Recorder.Events(), nil
+		}
+		if r.Wheel.Now().Sub(Epoch) > maxVirtualRace {
+			return r.Recorder.Events(), fmt.Errorf("race still %s after %v", r.Orchestrator.GetRaceStatus().State, maxVirtualRace)
+		}
+		if !r.Wheel.Step() {
+			return r.Recorder.Events(), fmt.Errorf("race stalled while %s", r.Orchestrator.GetRaceStatus().State)
+		}
+	}
+}
+
+// finished reports whether the race has completed or been aborted
+func (r *SimulatedRace) finished() bool {
+	switch r.Orchestrator.GetRaceStatus().State {
+	case orchestrator.RaceStateComplete, orchestrator.RaceStateAborted:
+		return true
+	}
+	return false
+}
+
+// quiesce waits until no events have been published and no timers
+// scheduled or fired for the settle time
+func (r *SimulatedRace) quiesce() {
+	activity := func() uint64 {
+		metrics := r.Wheel.Metrics()
+		return uint64(r.Recorder.Len()) + metrics.Scheduled + metrics.Fired
+	}
+	last := activity()
+	for quiet := time.Duration(0); quiet < settle; {
+		time.Sleep(time.Millisecond)
+		if now := activity(); now != last {
+			last, quiet = now, 0
+			continue
+		}
+		quiet += time.Millisecond
+	}
+}
+
+// Close stops the race, unsubscribes the recorder and restores the
+// previous default wheel
+func (r *SimulatedRace) Close() {
+	r.Orchestrator.Stop()
+	r.Recorder.Stop()
+	r.Bus.Stop()
+	r.restore()
+}
@@ -0,0 +1,13 @@
+package libdragtest
+
+import "github.com/benharold/libdrag/pkg/timers"
+
+// UseVirtualTime installs a virtual timer wheel starting at Epoch as the
+// process-wide wheel. Every component's clock, timers and sleeps then move
+// only when the test calls Advance or Step on the returned wheel, so the
+// staging, tree and timing flow runs without real sleeps. Call restore when
+// the test ends; tests using virtual time must not run in parallel.
+func UseVirtualTime() (wheel *timers.Wheel, restore func()) {
+	wheel = timers.NewVirtualWheel(Epoch, timers.DefaultTick)
+	return wheel, timers.SetDefault(wheel)
+}
@@ -0,0 +1,69 @@
+// Package logs holds the logger libdrag's packages write to. The library
+// never prints: components take an injectable *slog.Logger with SetLogger
+// and fall back to the package default, which discards everything until an
+// embedder sets one with SetDefault.
+package logs
+
+import (
+	"context"
+	"log/slog"
+	"sync/atomic"
+)
+
+// Attribute keys carried by library log records
+const (
+	KeyComponent = "component" // Package logging the record, "tree", "timing", ...
+	KeyRaceID    = "race_id"
+	KeyLane      = "lane"
+)
+
+var defaultLogger atomic.Pointer[slog.Logger]
+
+func init() {
+	defaultLogger.Store(Discard())
+}
+
+// Default returns the logger components use when none is set
+func Default() *slog.Logger {
+	return defaultLogger.Load()
+}
+
+// SetDefault sets the logger components use when none is set, say
+// slog.Default() to send library records wherever the application's go.
+// A nil logger restores the no-op default.
+func SetDefault(logger *slog.Logger) {
+	if logger == nil {
+		logger = Discard()
+	}
+	defaultLogger.Store(logger)
+}
+
+// Or returns logger, or the default logger when logger is nil
+func Or(logger *slog.Logger) *slog.Logger {
+	if logger != nil {
+		return logger
+	}
+	return Default()
+}
+
+// For returns logger (or the default) with a component's attributes, and
+// its race when raceID is set
+func For(logger *slog.Logger, component, raceID string) *slog.Logger {
+	logger = Or(logger).With(KeyComponent, component)
+	if raceID != "" {
+		logger = logger.With(KeyRaceID, raceID)
+	}
+	return logger
+}
+
+// Discard returns a logger that drops every record
+func Discard() *slog.Logger {
+	return slog.New(discardHandler{})
+}
+
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
@@ -0,0 +1,57 @@
+package logs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+)
+
+// TestFor tests that For tags records with the component and race
+func TestFor(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+
+	For(logger, "tree", "race-1").Info("armed", KeyLane, 2)
+
+	var record map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("Expected a JSON record, got %q: %v", buf.String(), err)
+	}
+	if record[KeyComponent] != "tree" || record[KeyRaceID] != "race-1" || record[KeyLane] != float64(2) {
+		t.Errorf("Expected component, race and lane attributes, got %v", record)
+	}
+
+	buf.Reset()
+	record = nil
+	For(logger, "records", "").Info("saved")
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("Expected a JSON record, got %q: %v", buf.String(), err)
+	}
+	if _, ok := record[KeyRaceID]; ok {
+		t.Errorf("Expected no race attribute without a race, got %v", record)
+	}
+}
+
+// TestSetDefault tests the default logger is used when none is set, and
+// that nil restores the no-op default
+func TestSetDefault(t *testing.T) {
+	defer SetDefault(nil)
+
+	if Default().Enabled(context.Background(), slog.LevelError) {
+		t.Error("Expected the default logger to discard records")
+	}
+
+	var buf bytes.Buffer
+	SetDefault(slog.New(slog.NewTextHandler(&buf, nil)))
+	For(nil, "timing", "race-1").Warn("late beam")
+	if buf.Len() == 0 {
+		t.Error("Expected a record on the logger set with SetDefault")
+	}
+
+	SetDefault(nil)
+	if Default().Enabled(context.Background(), slog.LevelError) {
+		t.Error("Expected SetDefault(nil) to restore the no-op default")
+	}
+}
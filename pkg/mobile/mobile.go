@@ -0,0 +1,239 @@
+// Package mobile is the binding surface of libdrag for other languages. It
+// uses only types gomobile can bind (strings, ints, bools, errors and
+// interfaces of those), passing structured data as JSON, and backs the
+// C-compatible exports in cmd/libdragc.
+//
+//	gomobile bind -target=ios ./pkg/mobile
+//	gomobile bind -target=android ./pkg/mobile
+package mobile
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/benharold/libdrag/pkg/api"
+	"github.com/benharold/libdrag/pkg/events"
+)
+
+// EventListener receives events as JSON. Implement it in Swift, Kotlin or
+// Java and pass it to Subscribe.
+type EventListener interface {
+	OnEvent(eventJSON string)
+}
+
+// CompletionListener is told when a race is done. Implement it in Swift,
+// Kotlin or Java and pass it to OnRaceDone.
+type CompletionListener interface {
+	// OnRaceDone receives the race's ID and "" when it completed, or why it
+	// did not (aborted, removed)
+	OnRaceDone(raceID string, errMessage string)
+}
+
+// Subscription is returned by Subscribe; Cancel stops delivery
+type Subscription struct {
+	cancel func()
+}
+
+// Cancel stops delivering events to the listener
+func (s *Subscription) Cancel() {
+	if s.cancel != nil {
+		s.cancel()
+		s.cancel = nil
+	}
+}
+
+// LibDrag wraps a LibDragAPI for bindings
+type LibDrag struct {
+	api *api.LibDragAPI
+
+	mu        sync.Mutex
+	queue     []string // Events waiting for PollEventsJSON
+	queueSize int
+	stopQueue func()
+	dropped   int
+}
+
+// New creates an uninitialized libdrag instance
+func New() *LibDrag {
+	return &LibDrag{api: api.NewLibDragAPI()}
+}
+
+// Initialize sets the instance up with the default configuration
+func (l *LibDrag) Initialize() error {
+	return l.api.Initialize()
+}
+
+// Stop shuts the instance down
+func (l *LibDrag) Stop() error {
+	l.mu.Lock()
+	if l.stopQueue != nil {
+		l.stopQueue()
+		l.stopQueue = nil
+	}
+	l.mu.Unlock()
+	return l.api.Stop()
+}
+
+// StartRace starts a race with default options and returns its ID
+func (l *LibDrag) StartRace() (string, error) {
+	return l.api.StartRaceWithID()
+}
+
+// StartRaceWithOptions starts a race from JSON-encoded api.RaceOptions
+func (l *LibDrag) StartRaceWithOptions(optionsJSON string) (string, error) {
+	var opts api.RaceOptions
+	if optionsJSON != "" {
+		if err := json.Unmarshal([]byte(optionsJSON), &opts); err != nil {
+			return "", fmt.Errorf("invalid race options: %v", err)
+		}
+	}
+	return l.api.StartRaceWithOptions(opts)
+}
+
+// RaceStatusJSON returns a race's status as JSON
+func (l *LibDrag) RaceStatusJSON(raceID string) string {
+	return l.api.GetRaceStatusJSONByID(raceID)
+}
+
+// TreeStatusJSON returns a race's Christmas tree state as JSON
+func (l *LibDrag) TreeStatusJSON(raceID string) string {
+	return l.api.GetTreeStatusJSONByID(raceID)
+}
+
+// TreeCanvasJSON returns a race's Christmas tree laid out on a grid as JSON,
+// one bulb per lane column and tree row
+func (l *LibDrag) TreeCanvasJSON(raceID string) string {
+	return l.api.GetTreeCanvasJSONByID(raceID)
+}
+
+// ResultsJSON returns a race's timing results as JSON
+func (l *LibDrag) ResultsJSON(raceID string) string {
+	return l.api.GetResultsJSONByID(raceID)
+}
+
+// IsRaceComplete reports whether a race has finished
+func (l *LibDrag) IsRaceComplete(raceID string) bool {
+	return l.api.IsRaceCompleteByID(raceID)
+}
+
+// WaitForCompletion blocks until a race completes, up to timeoutMillis
+// (0 = no limit). It returns an error if the race is aborted or removed
+// first, or the time runs out. Call it off the UI thread.
+func (l *LibDrag) WaitForCompletion(raceID string, timeoutMillis int) error {
+	ctx := context.Background()
+	if timeoutMillis > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(timeoutMillis)*time.Millisecond)
+		defer cancel()
+	}
+	return l.api.WaitForCompletion(ctx, raceID)
+}
+
+// OnRaceDone tells listener once when a race is done, without blocking.
+// Cancel the subscription to stop waiting.
+func (l *LibDrag) OnRaceDone(raceID string, listener CompletionListener) (*Subscription, error) {
+	cancel, err := l.api.OnRaceDone(raceID, func(err error) {
+		message := ""
+		if err != nil {
+			message = err.Error()
+		}
+		listener.OnRaceDone(raceID, message)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Subscription{cancel: cancel}, nil
+}
+
+// ArmTree arms a race's tree
+func (l *LibDrag) ArmTree(raceID string) error {
+	return l.api.ArmTreeByID(raceID)
+}
+
+// DisarmTree disarms a race's tree
+func (l *LibDrag) DisarmTree(raceID string) error {
+	return l.api.DisarmTreeByID(raceID)
+}
+
+// AbortRace aborts a race
+func (l *LibDrag) AbortRace(raceID string, reason string) error {
+	return l.api.AbortRaceByID(raceID, reason)
+}
+
+// Subscribe delivers events of one type ("" for all events) to listener
+func (l *LibDrag) Subscribe(eventType string, listener EventListener) *Subscription {
+	handler := func(event events.Event) {
+		if data, err := json.Marshal(event); err == nil {
+			listener.OnEvent(string(data))
+		}
+	}
+	if eventType == "" {
+		return &Subscription{cancel: l.api.SubscribeAll(handler)}
+	}
+	return &Subscription{cancel: l.api.Subscribe(events.EventType(eventType), handler)}
+}
+
+// EnableEventQueue buffers up to capacity events for PollEventsJSON, for
+// callers that cannot receive callbacks (such as C). When full, the oldest
+// events are dropped.
+func (l *LibDrag) EnableEventQueue(capacity int) error {
+	if capacity <= 0 {
+		return fmt.Errorf("event queue capacity must be positive")
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.stopQueue != nil {
+		l.stopQueue()
+	}
+	l.queue = nil
+	l.queueSize = capacity
+	l.stopQueue = l.api.SubscribeAll(l.enqueue)
+	return nil
+}
+
+// enqueue buffers an event for polling
+func (l *LibDrag) enqueue(event events.Event) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.queue = append(l.queue, string(data))
+	if len(l.queue) > l.queueSize {
+		l.dropped += len(l.queue) - l.queueSize
+		l.queue = l.queue[len(l.queue)-l.queueSize:]
+	}
+}
+
+// PollEventsJSON removes up to max queued events (0 = all) and returns them
+// as {"events": [...], "dropped": N}, where dropped counts events lost to a
+// full queue since the previous poll
+func (l *LibDrag) PollEventsJSON(max int) string {
+	l.mu.Lock()
+	n := len(l.queue)
+	if max > 0 && max < n {
+		n = max
+	}
+	polled := make([]json.RawMessage, n)
+	for i, event := range l.queue[:n] {
+		polled[i] = json.RawMessage(event)
+	}
+	l.queue = l.queue[n:]
+	dropped := l.dropped
+	l.dropped = 0
+	l.mu.Unlock()
+
+	data, _ := json.Marshal(struct {
+		Events  []json.RawMessage `json:"events"`
+		Dropped int               `json:"dropped"`
+	}{polled, dropped})
+	return string(data)
+}
@@ -0,0 +1,111 @@
+package mobile
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type listener struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (l *listener) OnEvent(eventJSON string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.events = append(l.events, eventJSON)
+}
+
+func (l *listener) count() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.events)
+}
+
+func TestLibDrag(t *testing.T) {
+	l := New()
+	if err := l.Initialize(); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	defer l.Stop()
+
+	starts := &listener{}
+	sub := l.Subscribe("race.start", starts)
+	if err := l.EnableEventQueue(2); err != nil {
+		t.Fatalf("EnableEventQueue failed: %v", err)
+	}
+
+	if _, err := l.StartRaceWithOptions(`{"class":`); err == nil {
+		t.Error("Expected error for malformed options")
+	}
+	raceID, err := l.StartRaceWithOptions(`{"class":"Super Pro","drivers":{"1":"SG-1234"}}`)
+	if err != nil {
+		t.Fatalf("StartRaceWithOptions failed: %v", err)
+	}
+	if status := l.RaceStatusJSON(raceID); !strings.Contains(status, `"state"`) {
+		t.Errorf("Expected race status for %s, got %s", raceID, status)
+	}
+	if status := l.RaceStatusJSON("missing"); !strings.Contains(status, "error") {
+		t.Errorf("Expected error for unknown race, got %s", status)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for starts.count() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if starts.count() == 0 {
+		t.Fatal("Expected race.start delivered to the listener")
+	}
+	sub.Cancel()
+
+	var polled struct {
+		Events  []map[string]interface{} `json:"events"`
+		Dropped int                      `json:"dropped"`
+	}
+	if err := json.Unmarshal([]byte(l.PollEventsJSON(1)), &polled); err != nil {
+		t.Fatalf("PollEventsJSON returned invalid JSON: %v", err)
+	}
+	if len(polled.Events) != 1 || polled.Events[0]["type"] == nil {
+		t.Errorf("Expected one queued event, got %+v", polled)
+	}
+	if err := l.EnableEventQueue(0); err == nil {
+		t.Error("Expected error for zero capacity")
+	}
+}
+
+type completionListener chan string
+
+func (c completionListener) OnRaceDone(raceID string, errMessage string) {
+	c <- errMessage
+}
+
+func TestRaceCompletion(t *testing.T) {
+	l := New()
+	if err := l.Initialize(); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	defer l.Stop()
+
+	raceID, err := l.StartRace()
+	if err != nil {
+		t.Fatalf("StartRace failed: %v", err)
+	}
+	done := make(completionListener, 1)
+	if _, err := l.OnRaceDone(raceID, done); err != nil {
+		t.Fatalf("OnRaceDone failed: %v", err)
+	}
+	if err := l.WaitForCompletion(raceID, 10000); err != nil {
+		t.Fatalf("WaitForCompletion failed: %v", err)
+	}
+	select {
+	case message := <-done:
+		if message != "" {
+			t.Errorf("Expected the race to complete, got %q", message)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the listener told the race is done")
+	}
+}
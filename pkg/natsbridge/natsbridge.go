@@ -0,0 +1,273 @@
+// Package natsbridge mirrors the libdrag event stream to NATS subjects of the
+// form libdrag.{facility}.{race}.{type}.
+//
+// The bridge does not import a NATS client. Any connection with a
+// Publish(subject, data) method works, so a *nats.Conn can be passed straight
+// in from a Dialer:
+//
+//	dial := func() (natsbridge.Conn, error) {
+//		nc, err := nats.Connect(url, nats.NoReconnect())
+//		if err != nil {
+//			return nil, err
+//		}
+//		return nc, nil
+//	}
+//	bridge := natsbridge.NewBridge(bus, dial, natsbridge.Config{Facility: "Mountain Dragway"})
+//	bridge.Start()
+package natsbridge
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/benharold/libdrag/pkg/events"
+)
+
+// Defaults used when Config fields are zero
+const (
+	DefaultPrefix        = "libdrag"
+	DefaultBufferSize    = 1024
+	DefaultReconnectWait = 2 * time.Second
+)
+
+// noRace is the subject token used for events not tied to a race
+const noRace = "_"
+
+// Conn is the subset of a NATS connection the bridge uses
+type Conn interface {
+	Publish(subject string, data []byte) error
+}
+
+// Dialer opens a new connection. It is called on start and after a publish fails.
+type Dialer func() (Conn, error)
+
+// Config configures a Bridge
+type Config struct {
+	Facility      string        // Facility subject token
+	Prefix        string        // Root subject token, defaults to "libdrag"
+	BufferSize    int           // Events held while disconnected; oldest are dropped first
+	ReconnectWait time.Duration // Delay between reconnect attempts
+}
+
+// Stats reports bridge throughput
+type Stats struct {
+	Published  int  `json:"published"`
+	Buffered   int  `json:"buffered"`
+	Dropped    int  `json:"dropped"`
+	Reconnects int  `json:"reconnects"`
+	Connected  bool `json:"connected"`
+}
+
+// Bridge publishes every bus event to NATS, buffering while disconnected
+type Bridge struct {
+	mu          sync.Mutex
+	bus         *events.EventBus
+	dial        Dialer
+	config      Config
+	conn        Conn
+	dialed      bool // A connection has been made before
+	queue       []events.Event
+	stats       Stats
+	wake        chan struct{}
+	done        chan struct{}
+	wg          sync.WaitGroup
+	stopOnce    sync.Once
+	unsubscribe func()
+}
+
+// NewBridge creates a bridge from bus to the connections returned by dial
+func NewBridge(bus *events.EventBus, dial Dialer, cfg Config) *Bridge {
+	if cfg.Prefix == "" {
+		cfg.Prefix = DefaultPrefix
+	}
+	if cfg.BufferSize <= 0 {
+		cfg.BufferSize = DefaultBufferSize
+	}
+	if cfg.ReconnectWait <= 0 {
+		cfg.ReconnectWait = DefaultReconnectWait
+	}
+	return &Bridge{
+		bus:    bus,
+		dial:   dial,
+		config: cfg,
+		wake:   make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+}
+
+// Start subscribes to the bus and begins publishing in the background
+func (b *Bridge) Start() {
+	b.unsubscribe = b.bus.SubscribeAll(b.HandleEvent)
+
+	b.wg.Add(1)
+	go b.run()
+}
+
+// Stop unsubscribes from the bus, stops publishing and closes the connection.
+// Events still buffered are discarded.
+func (b *Bridge) Stop() {
+	b.stopOnce.Do(func() {
+		if b.unsubscribe != nil {
+			b.unsubscribe()
+		}
+		close(b.done)
+		b.wg.Wait()
+
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.disconnect()
+	})
+}
+
+// Stats returns the bridge's counters
+func (b *Bridge) Stats() Stats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	stats := b.stats
+	stats.Buffered = len(b.queue)
+	stats.Connected = b.conn != nil
+	return stats
+}
+
+// Subject returns the NATS subject an event is published to
+func (b *Bridge) Subject(event events.Event) string {
+	race := noRace
+	if event.RaceID != "" {
+		race = token(event.RaceID)
+	}
+	return strings.Join([]string{b.config.Prefix, token(b.config.Facility), race, string(event.Type)}, ".")
+}
+
+// HandleEvent queues a single event for publishing
+func (b *Bridge) HandleEvent(event events.Event) {
+	b.mu.Lock()
+	if len(b.queue) >= b.config.BufferSize {
+		b.queue = b.queue[1:]
+		b.stats.Dropped++
+	}
+	b.queue = append(b.queue, event)
+	b.mu.Unlock()
+
+	select {
+	case b.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run publishes queued events until the bridge is stopped
+func (b *Bridge) run() {
+	defer b.wg.Done()
+
+	for {
+		if !b.flush() {
+			// Connection lost; wait before reconnecting
+			select {
+			case <-time.After(b.config.ReconnectWait):
+			case <-b.done:
+				return
+			}
+			continue
+		}
+
+		select {
+		case <-b.wake:
+		case <-b.done:
+			return
+		}
+	}
+}
+
+// flush publishes queued events in order and reports whether it drained the
+// queue. The lock is released while dialing and publishing so a slow broker
+// never blocks the event bus; unpublished events go back on the queue.
+func (b *Bridge) flush() bool {
+	for {
+		b.mu.Lock()
+		pending := b.queue
+		b.queue = nil
+		conn := b.conn
+		b.mu.Unlock()
+
+		if len(pending) == 0 {
+			return true
+		}
+
+		if conn == nil {
+			var err error
+			if conn, err = b.dial(); err != nil || conn == nil {
+				b.requeue(pending, 0)
+				return false
+			}
+			b.mu.Lock()
+			if b.dialed {
+				b.stats.Reconnects++
+			}
+			b.dialed = true
+			b.conn = conn
+			b.mu.Unlock()
+		}
+
+		for i, event := range pending {
+			data, err := json.Marshal(event)
+			if err != nil {
+				// Unserializable event data can never be published
+				b.requeue(nil, 1)
+				continue
+			}
+			if err := conn.Publish(b.Subject(event), data); err != nil {
+				b.mu.Lock()
+				b.disconnect()
+				b.mu.Unlock()
+				b.requeue(pending[i:], 0)
+				return false
+			}
+			b.mu.Lock()
+			b.stats.Published++
+			b.mu.Unlock()
+		}
+	}
+}
+
+// requeue puts unpublished events back ahead of newer ones, dropping the
+// oldest if the buffer overflows. dropped counts events discarded outright.
+func (b *Bridge) requeue(pending []events.Event, dropped int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.stats.Dropped += dropped
+	queue := append(pending[:len(pending):len(pending)], b.queue...)
+	if overflow := len(queue) - b.config.BufferSize; overflow > 0 {
+		queue = queue[overflow:]
+		b.stats.Dropped += overflow
+	}
+	b.queue = queue
+}
+
+// disconnect drops the current connection, closing it if possible
+func (b *Bridge) disconnect() {
+	switch conn := b.conn.(type) {
+	case io.Closer:
+		conn.Close()
+	case interface{ Close() }: // *nats.Conn
+		conn.Close()
+	}
+	b.conn = nil
+}
+
+// token makes s safe to use as a single NATS subject token
+func token(s string) string {
+	if s == "" {
+		return noRace
+	}
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '.', '*', '>', ' ', '\t', '\r', '\n':
+			return '_'
+		}
+		return r
+	}, s)
+}
@@ -0,0 +1,115 @@
+package natsbridge
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/benharold/libdrag/pkg/events"
+)
+
+// fakeConn records published subjects and fails while down is set
+type fakeConn struct {
+	mu       sync.Mutex
+	down     bool
+	subjects []string
+}
+
+func (c *fakeConn) Publish(subject string, data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.down {
+		return errors.New("connection lost")
+	}
+	c.subjects = append(c.subjects, subject)
+	return nil
+}
+
+func (c *fakeConn) setDown(down bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.down = down
+}
+
+func (c *fakeConn) published() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.subjects...)
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for condition")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestSubject(t *testing.T) {
+	b := NewBridge(events.NewEventBus(false), nil, Config{Facility: "Mountain Dragway"})
+
+	event := events.NewEvent(events.EventRaceStart).WithRaceID("race-1").Build()
+	if got := b.Subject(event); got != "libdrag.Mountain_Dragway.race-1.race.start" {
+		t.Errorf("Unexpected subject %q", got)
+	}
+	if got := b.Subject(events.NewEvent(events.EventSessionSummary).Build()); got != "libdrag.Mountain_Dragway._.session.summary" {
+		t.Errorf("Unexpected subject %q", got)
+	}
+}
+
+func TestBridgeReconnectsAndFlushesBuffer(t *testing.T) {
+	bus := events.NewEventBus(false)
+	conn := &fakeConn{}
+	dials := 0
+	var dialMu sync.Mutex
+	dial := func() (Conn, error) {
+		dialMu.Lock()
+		defer dialMu.Unlock()
+		dials++
+		if dials == 2 {
+			return nil, errors.New("broker unavailable")
+		}
+		return conn, nil
+	}
+
+	b := NewBridge(bus, dial, Config{Facility: "test", ReconnectWait: 10 * time.Millisecond})
+	b.Start()
+	defer b.Stop()
+
+	bus.Publish(events.NewEvent(events.EventRaceStart).WithRaceID("r1").Build())
+	waitFor(t, func() bool { return len(conn.published()) == 1 })
+
+	// Events published while the broker is down are buffered and sent in order
+	conn.setDown(true)
+	bus.Publish(events.NewEvent(events.EventTreeStage).WithRaceID("r1").Build())
+	bus.Publish(events.NewEvent(events.EventRaceComplete).WithRaceID("r1").Build())
+	waitFor(t, func() bool { return !b.Stats().Connected })
+	conn.setDown(false)
+
+	waitFor(t, func() bool { return len(conn.published()) == 3 })
+	subjects := conn.published()
+	if subjects[1] != "libdrag.test.r1.tree.stage" || subjects[2] != "libdrag.test.r1.race.complete" {
+		t.Errorf("Events out of order: %v", subjects)
+	}
+	if stats := b.Stats(); stats.Reconnects != 1 || stats.Dropped != 0 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+}
+
+func TestBridgeDropsOldestWhenFull(t *testing.T) {
+	b := NewBridge(events.NewEventBus(false), nil, Config{BufferSize: 2})
+
+	for _, raceID := range []string{"r1", "r2", "r3"} {
+		b.HandleEvent(events.NewEvent(events.EventRaceStart).WithRaceID(raceID).Build())
+	}
+	if stats := b.Stats(); stats.Buffered != 2 || stats.Dropped != 1 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+	if b.queue[0].RaceID != "r2" {
+		t.Errorf("Expected oldest event to be dropped, queue starts with %s", b.queue[0].RaceID)
+	}
+}
@@ -0,0 +1,140 @@
+// Package notify builds driver-facing run summaries and dispatches them to
+// notification channels (SMS, push, email) supplied by the application.
+package notify
+
+import (
+	"sort"
+
+	"github.com/benharold/libdrag/pkg/config"
+	"github.com/benharold/libdrag/pkg/results"
+	"github.com/benharold/libdrag/pkg/timers"
+	"github.com/benharold/libdrag/pkg/timing"
+)
+
+// Run results
+const (
+	ResultWin    = "win"
+	ResultLoss   = "loss"
+	ResultFoul   = "foul"
+	ResultSingle = "single" // Solo run or bye
+)
+
+// RunSummary is the digital time slip sent to a driver after a run
+type RunSummary struct {
+	RaceID       string   `json:"race_id"`
+	Registration string   `json:"registration"` // Driver registration the summary is keyed by
+	Lane         int      `json:"lane"`
+	ReactionTime *float64 `json:"reaction_time,omitempty"`
+	SixtyFoot    *float64 `json:"sixty_foot,omitempty"`
+	ElapsedTime  *float64 `json:"elapsed_time,omitempty"`
+	Speed        *float64 `json:"speed,omitempty"`
+	DialIn       *float64 `json:"dial_in,omitempty"`
+	Package      string   `json:"package,omitempty"` // Bracket total, "0.012 total"
+	Result       string   `json:"result"`
+	Margin       string   `json:"margin,omitempty"` // Margin of victory, on both drivers' slips
+	FoulReason   string   `json:"foul_reason,omitempty"`
+	NextOpponent string   `json:"next_opponent,omitempty"`
+
+	// TimingAccuracy discloses times of degraded accuracy (hand-timed, say)
+	TimingAccuracy *timers.Accuracy `json:"timing_accuracy,omitempty"`
+}
+
+// Notifier delivers a run summary to a driver
+type Notifier interface {
+	Notify(summary RunSummary) error
+}
+
+// NotifierFunc adapts a function to the Notifier interface
+type NotifierFunc func(summary RunSummary) error
+
+// Notify calls f(summary)
+func (f NotifierFunc) Notify(summary RunSummary) error {
+	return f(summary)
+}
+
+// OpponentLookup returns the registration of a driver's next-round opponent,
+// or "" if there is none (or no bracket is running)
+type OpponentLookup func(raceID string, registration string) string
+
+// BuildRunSummaries builds a summary for every lane with a registered driver
+// from the race's timing results, decision and dial-ins (nil for heads-up
+// racing)
+func BuildRunSummaries(raceID string, timingResults map[int]*timing.TimingResults, decision results.Decision, dialIns map[int]float64, drivers map[int]string, nextOpponent OpponentLookup) []RunSummary {
+	lanes := make([]int, 0, len(drivers))
+	for lane := range drivers {
+		lanes = append(lanes, lane)
+	}
+	sort.Ints(lanes)
+
+	margin := results.FormatDecisionMargin(decision, timingResults)
+	summaries := make([]RunSummary, 0, len(lanes))
+	for _, lane := range lanes {
+		registration := drivers[lane]
+		summary := RunSummary{
+			RaceID:       raceID,
+			Registration: registration,
+			Lane:         lane,
+			Result:       ResultLoss,
+			Margin:       margin,
+		}
+		if dial, ok := dialIns[lane]; ok {
+			summary.DialIn = &dial
+		}
+
+		if result, ok := timingResults[lane]; ok {
+			summary.ReactionTime = result.ReactionTime
+			summary.SixtyFoot = result.SixtyFootTime
+			summary.ElapsedTime = result.QuarterMileTime
+			summary.Speed = result.TrapSpeed
+			if accuracy := result.Accuracy(); accuracy.Degraded() {
+				summary.TimingAccuracy = &accuracy
+			}
+			if result.IsFoul {
+				summary.Result = ResultFoul
+				summary.FoulReason = result.FoulReason
+			}
+			if summary.DialIn != nil && result.ReactionTime != nil && result.QuarterMileTime != nil {
+				if total, ok := results.Package(*result.ReactionTime, *result.QuarterMileTime, *summary.DialIn); ok {
+					summary.Package = results.FormatPackage(total)
+				}
+			}
+		}
+		if lane == decision.WinnerLane {
+			summary.Result = ResultWin
+			if decision.Reason == results.ReasonSingle {
+				summary.Result = ResultSingle
+			}
+		}
+
+		if nextOpponent != nil && (summary.Result == ResultWin || summary.Result == ResultSingle) {
+			summary.NextOpponent = nextOpponent(raceID, registration)
+		}
+		summaries = append(summaries, summary)
+	}
+	return summaries
+}
+
+// ApplyFoulDisplay blanks the ET, speed and package of summaries for runs
+// that fouled when the track's convention is config.FoulDisplayBlank, so
+// slips and notifications match the scoreboards
+func ApplyFoulDisplay(summaries []RunSummary, display config.FoulDisplay) {
+	if !display.Blanks() {
+		return
+	}
+	for i := range summaries {
+		if summaries[i].FoulReason != "" {
+			summaries[i].ElapsedTime, summaries[i].Speed, summaries[i].Package = nil, nil, ""
+		}
+	}
+}
+
+// Dispatch sends each summary and returns the first delivery error, if any
+func Dispatch(notifier Notifier, summaries []RunSummary) error {
+	var firstErr error
+	for _, summary := range summaries {
+		if err := notifier.Notify(summary); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
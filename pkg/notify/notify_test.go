@@ -0,0 +1,104 @@
+package notify
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/benharold/libdrag/pkg/config"
+	"github.com/benharold/libdrag/pkg/results"
+	"github.com/benharold/libdrag/pkg/timing"
+)
+
+func finished(lane int, et float64, finish time.Time) *timing.TimingResults {
+	rt := 0.5
+	return &timing.TimingResults{
+		Lane:            lane,
+		ReactionTime:    &rt,
+		QuarterMileTime: &et,
+		IsComplete:      true,
+		BeamTriggers:    map[string]time.Time{"1320_foot": finish},
+	}
+}
+
+func decide(timingResults map[int]*timing.TimingResults) results.Decision {
+	return results.Decide(timingResults, 0)
+}
+
+func TestBuildRunSummaries(t *testing.T) {
+	now := time.Now()
+	runs := map[int]*timing.TimingResults{
+		1: finished(1, 7.30, now.Add(20*time.Millisecond)), // Quicker ET, later to the stripe
+		2: finished(2, 7.40, now),
+	}
+	drivers := map[int]string{1: "SG-1234", 2: "SG-5678"}
+	lookup := func(raceID, registration string) string { return "SG-9999" }
+
+	summaries := BuildRunSummaries("race-1", runs, decide(runs), nil, drivers, lookup)
+	if len(summaries) != 2 {
+		t.Fatalf("Expected 2 summaries, got %d", len(summaries))
+	}
+	if summaries[0].Registration != "SG-1234" || summaries[0].Result != ResultLoss || summaries[0].NextOpponent != "" {
+		t.Errorf("Unexpected lane 1 summary %+v", summaries[0])
+	}
+	if summaries[1].Result != ResultWin || summaries[1].NextOpponent != "SG-9999" {
+		t.Errorf("Unexpected lane 2 summary %+v", summaries[1])
+	}
+	if *summaries[1].ElapsedTime != 7.40 {
+		t.Errorf("Expected ET 7.40, got %v", *summaries[1].ElapsedTime)
+	}
+
+	// A foul hands the win to the other lane regardless of finish order
+	runs[2].IsFoul = true
+	runs[2].FoulReason = "red_light"
+	summaries = BuildRunSummaries("race-1", runs, decide(runs), nil, drivers, nil)
+	if summaries[0].Result != ResultWin || summaries[1].Result != ResultFoul || summaries[1].FoulReason != "red_light" {
+		t.Errorf("Unexpected foul summaries %+v", summaries)
+	}
+	ApplyFoulDisplay(summaries, config.FoulDisplayShow)
+	if summaries[1].ElapsedTime == nil {
+		t.Error("Expected the fouled run's ET shown by default")
+	}
+	ApplyFoulDisplay(summaries, config.FoulDisplayBlank)
+	if summaries[1].ElapsedTime != nil || summaries[1].Speed != nil || summaries[1].ReactionTime == nil || summaries[0].ElapsedTime == nil {
+		t.Errorf("Expected only the fouled run's ET blanked, got %+v", summaries)
+	}
+
+	// Unregistered lanes get no summary; solo runs are singles
+	single := map[int]*timing.TimingResults{1: finished(1, 7.5, now)}
+	summaries = BuildRunSummaries("race-2", single, decide(single), nil, map[int]string{1: "SG-1234"}, nil)
+	if len(summaries) != 1 || summaries[0].Result != ResultSingle {
+		t.Errorf("Unexpected single summaries %+v", summaries)
+	}
+	// Bracket slips carry the package, and both carry the margin
+	runs = map[int]*timing.TimingResults{
+		1: finished(1, 10.51, now),
+		2: finished(2, 10.49, now.Add(20*time.Millisecond)),
+	}
+	summaries = BuildRunSummaries("race-3", runs, decide(runs), map[int]float64{1: 10.50, 2: 10.40}, drivers, nil)
+	if summaries[0].Package != "0.510 total" || summaries[1].Package != "0.590 total" {
+		t.Errorf("Unexpected packages %q and %q", summaries[0].Package, summaries[1].Package)
+	}
+	if summaries[0].Margin != "0.0200 sec" || summaries[1].Margin != summaries[0].Margin {
+		t.Errorf("Expected both slips to show the margin, got %q and %q", summaries[0].Margin, summaries[1].Margin)
+	}
+}
+
+func TestDispatch(t *testing.T) {
+	var sent []string
+	notifier := NotifierFunc(func(summary RunSummary) error {
+		sent = append(sent, summary.Registration)
+		if summary.Registration == "bad" {
+			return errors.New("no device")
+		}
+		return nil
+	})
+
+	err := Dispatch(notifier, []RunSummary{{Registration: "bad"}, {Registration: "good"}})
+	if err == nil {
+		t.Error("Expected delivery error")
+	}
+	if len(sent) != 2 {
+		t.Errorf("Expected delivery to continue after a failure, sent %v", sent)
+	}
+}
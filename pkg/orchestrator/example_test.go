@@ -0,0 +1,107 @@
+package orchestrator_test
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/benharold/libdrag/pkg/component"
+	"github.com/benharold/libdrag/pkg/config"
+	"github.com/benharold/libdrag/pkg/events"
+	"github.com/benharold/libdrag/pkg/libdragtest"
+	"github.com/benharold/libdrag/pkg/orchestrator"
+	"github.com/benharold/libdrag/pkg/timing"
+	"github.com/benharold/libdrag/pkg/tree"
+)
+
+// weatherStation is a custom component reporting track conditions. It is
+// event aware, so the orchestrator gives it the race's bus and ID.
+type weatherStation struct {
+	bus    *events.EventBus
+	raceID string
+}
+
+func (w *weatherStation) GetID() string { return "weather_station" }
+
+func (w *weatherStation) Initialize(ctx context.Context, cfg config.Config) error { return nil }
+
+func (w *weatherStation) Arm(ctx context.Context) error {
+	// Publish the conditions the race starts in
+	w.bus.Publish(
+		events.NewEvent("weather.reading").
+			WithRaceID(w.raceID).
+			WithData("track_temp_f", 104).
+			Build(),
+	)
+	return nil
+}
+
+func (w *weatherStation) EmergencyStop() error { return nil }
+
+func (w *weatherStation) GetStatus() component.ComponentStatus {
+	return component.ComponentStatus{ID: w.GetID(), Status: "ready"}
+}
+
+func (w *weatherStation) SetEventBus(bus *events.EventBus) { w.bus = bus }
+func (w *weatherStation) SetRaceID(raceID string)          { w.raceID = raceID }
+
+// This example registers a custom component with a race alongside the
+// required timing system and tree. The orchestrator initializes and arms it
+// with the others and reports its status with the race's.
+func ExampleRaceOrchestrator_Initialize() {
+	bus := events.NewEventBus(false)
+	bus.Subscribe("weather.reading", func(e events.Event) {
+		fmt.Printf("%s: track %v°F\n", e.RaceID, e.Data["track_temp_f"])
+	})
+
+	race := orchestrator.NewRaceOrchestrator()
+	race.SetEventBus(bus)
+	race.SetRaceID("race-1")
+	defer race.Stop()
+
+	components := []component.Component{
+		timing.NewTimingSystemWithRaceID("race-1"),
+		tree.NewChristmasTree(),
+		&weatherStation{},
+	}
+	if err := race.Initialize(context.Background(), components, config.NewDefaultConfig()); err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	station := race.GetRaceStatus().Components["weather_station"]
+	fmt.Println(station.ID, station.Status)
+	// Output:
+	// race-1: track 104°F
+	// weather_station ready
+}
+
+// This example runs a bracket race to completion on virtual time with the
+// libdragtest harness. The slower dial-in gets the head start, and lane 1
+// loses by running quicker than its dial-in.
+func ExampleRaceOrchestrator_SetDialIn() {
+	race, err := libdragtest.NewSimulatedRace(libdragtest.SportsmanConfig())
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer race.Close()
+
+	race.Orchestrator.SetDialIn(1, 7.35)
+	race.Orchestrator.SetDialIn(2, 7.45)
+	if _, err := race.Run(); err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	results := race.Orchestrator.GetResults()
+	for _, lane := range []int{1, 2} {
+		result := results[lane]
+		fmt.Printf("lane %d: dial %.2f, ran %.3f, breakout %t\n", lane, *result.DialIn, *result.QuarterMileTime, result.Breakout)
+	}
+	decision := race.Orchestrator.GetDecision()
+	fmt.Printf("lane %d wins (%s)\n", decision.WinnerLane, decision.Reason)
+	// Output:
+	// lane 1: dial 7.35, ran 7.300, breakout true
+	// lane 2: dial 7.45, ran 7.500, breakout false
+	// lane 2 wins (opponent_breakout)
+}
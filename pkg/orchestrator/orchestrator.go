@@ -3,13 +3,22 @@ package orchestrator
 import (
 	"context"
 	"fmt"
+	"log/slog"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/benharold/libdrag/internal/vehicle"
+	"github.com/benharold/libdrag/pkg/beam"
 	"github.com/benharold/libdrag/pkg/component"
 	"github.com/benharold/libdrag/pkg/config"
 	"github.com/benharold/libdrag/pkg/events"
+	"github.com/benharold/libdrag/pkg/fouls"
+	"github.com/benharold/libdrag/pkg/logs"
+	"github.com/benharold/libdrag/pkg/results"
+	"github.com/benharold/libdrag/pkg/rules"
+	"github.com/benharold/libdrag/pkg/simulation"
+	"github.com/benharold/libdrag/pkg/timers"
 	"github.com/benharold/libdrag/pkg/timing"
 	"github.com/benharold/libdrag/pkg/tree"
 )
@@ -20,6 +29,9 @@ type RaceState string
 const (
 	RaceStateIdle      RaceState = "idle"
 	RaceStatePreparing RaceState = "preparing"
+	RaceStateBurnout   RaceState = "burnout"  // Pre-staging: the burnout
+	RaceStateBackup    RaceState = "backup"   // Pre-staging: backing up to the starting line
+	RaceStateApproach  RaceState = "approach" // Pre-staging: pulling up to the staging beams
 	RaceStateStaging   RaceState = "staging"
 	RaceStateArmed     RaceState = "armed"
 	RaceStateRunning   RaceState = "running"
@@ -35,19 +47,53 @@ type RaceStatus struct {
 	Components  map[string]component.ComponentStatus `json:"components"`
 	ActiveLanes []int                                `json:"active_lanes"`
 	LastError   error                                `json:"last_error,omitempty"`
+
+	// HeldLanes are lanes the starter is holding; the tree waits for them
+	HeldLanes []int `json:"held_lanes,omitempty"`
+	// Disqualified are lanes the starter disqualified
+	Disqualified []int `json:"disqualified,omitempty"`
+	// PhaseEnds is when the current pre-staging phase runs out
+	PhaseEnds time.Time `json:"phase_ends,omitempty"`
 }
 
 // RaceOrchestrator coordinates all race components using direct method calls
 type RaceOrchestrator struct {
-	mu            sync.RWMutex
+	mu            component.VersionedMutex
 	config        config.Config
 	status        RaceStatus
 	timingSystem  *timing.TimingSystem
 	christmasTree *tree.ChristmasTree
+	treeComponent component.Component // The tree as given, through any wrapper
 	leftVehicle   *vehicle.SimpleVehicle
 	rightVehicle  *vehicle.SimpleVehicle
 	eventBus      *events.EventBus
 	raceID        string
+
+	// Starter override holds the automatic start until the tree is fired manually
+	starterOverride bool
+	manualTrigger   bool
+
+	// startSignal starts a no-tree race (TreeSequenceStartSignal)
+	startSignal time.Time
+
+	// Pre-staging phases (burnout, backup, approach) run before staging
+	preStaging   PreStagingConfig
+	advancePhase bool                         // The starter ended the current phase
+	heldStaging  map[int]map[beam.BeamID]bool // Staging beams seen during the burnout or backup
+
+	dialIns map[int]float64 // lane -> dial-in (seconds)
+
+	decision    results.Decision   // Outcome, set when the race completes
+	adjudicator *fouls.Adjudicator // First-or-worst ruling when both lanes foul
+	clock       timers.Clock       // Nil runs on the default wheel
+	logger      *slog.Logger       // Nil logs to logs.Default
+	rules       *rules.Engine      // Nil uses rules.Default
+
+	simulator simulation.Simulator // Nil runs from real beam input
+
+	halt    chan struct{}  // Closed when the race is aborted or stopped
+	halted  bool           // halt is closed
+	running sync.WaitGroup // The race's goroutine, waited out by Abort and Stop
 }
 
 func NewRaceOrchestrator() *RaceOrchestrator {
@@ -57,6 +103,9 @@ func NewRaceOrchestrator() *RaceOrchestrator {
 			Components:  make(map[string]component.ComponentStatus),
 			ActiveLanes: []int{},
 		},
+		dialIns:   make(map[int]float64),
+		simulator: simulation.Reference(),
+		halt:      make(chan struct{}),
 	}
 }
 
@@ -73,11 +122,15 @@ func (ro *RaceOrchestrator) Initialize(ctx context.Context, components []compone
 		}
 
 		// Type-assert to get specific component references
-		switch c := comp.(type) {
+		switch c := component.Unwrap(comp).(type) {
 		case *timing.TimingSystem:
 			ro.timingSystem = c
 		case *tree.ChristmasTree:
 			ro.christmasTree = c
+			ro.treeComponent = comp
+			if ro.rules != nil {
+				c.SetRules(ro.rules)
+			}
 		}
 
 		// If component supports events, set event bus and race ID
@@ -89,6 +142,12 @@ func (ro *RaceOrchestrator) Initialize(ctx context.Context, components []compone
 				eventAware.SetRaceID(ro.raceID)
 			}
 		}
+		if clockAware, ok := comp.(component.ClockAwareComponent); ok && ro.clock != nil {
+			clockAware.SetClock(ro.clock)
+		}
+		if loggerAware, ok := comp.(component.LoggerAwareComponent); ok && ro.logger != nil {
+			loggerAware.SetLogger(ro.logger)
+		}
 
 		ro.status.Components[comp.GetID()] = comp.GetStatus()
 	}
@@ -101,6 +160,13 @@ func (ro *RaceOrchestrator) Initialize(ctx context.Context, components []compone
 		return fmt.Errorf("christmas tree component is required")
 	}
 
+	// A lane that leaves before its green lights its red bulb as soon as
+	// timing sees it
+	christmasTree := ro.christmasTree
+	ro.timingSystem.SetRedLightHandler(func(lane int, _ float64) {
+		christmasTree.SetRedLight(lane)
+	})
+
 	// Arm components
 	for _, comp := range components {
 		if err := comp.Arm(ctx); err != nil {
@@ -116,13 +182,25 @@ func (ro *RaceOrchestrator) StartRace(leftVehicle, rightVehicle *vehicle.SimpleV
 	ro.mu.Lock()
 	defer ro.mu.Unlock()
 
-	fmt.Println("🏁 libdrag Race Orchestrator: Starting new race")
+	ro.log().Info("🏁 Starting new race")
 
 	ro.leftVehicle = leftVehicle
 	ro.rightVehicle = rightVehicle
 	ro.status.ActiveLanes = []int{1, 2}
-	ro.status.StartTime = time.Now()
-	ro.status.State = RaceStateStaging
+	ro.status.StartTime = timers.Or(ro.clock).Now()
+	ro.status.State = ro.firstState()
+	ro.status.HeldLanes = nil
+	ro.status.Disqualified = nil
+	ro.status.PhaseEnds = time.Time{}
+	ro.startSignal = time.Time{}
+	ro.heldStaging = nil
+	ro.halt = make(chan struct{})
+	ro.halted = false
+
+	ro.adjudicator = fouls.NewAdjudicator(ro.raceID)
+	if ro.eventBus != nil {
+		ro.adjudicator.Start(ro.eventBus)
+	}
 
 	// Publish race start event
 	if ro.eventBus != nil {
@@ -137,90 +215,331 @@ func (ro *RaceOrchestrator) StartRace(leftVehicle, rightVehicle *vehicle.SimpleV
 	ro.timingSystem.StartRace()
 	ro.timingSystem.AddVehicles([]int{1, 2})
 
-	// Simulate staging process
-	go ro.simulateRaceSequence()
+	ro.running.Add(1)
+	go func() {
+		defer ro.running.Done()
+		ro.runRace()
+	}()
 
 	return nil
 }
 
-func (ro *RaceOrchestrator) simulateRaceSequence() {
-	// Simulate vehicles entering pre-stage
-	time.Sleep(500 * time.Millisecond)
-	ro.christmasTree.SetPreStage(1, true)
-
-	time.Sleep(200 * time.Millisecond)
-	ro.christmasTree.SetPreStage(2, true)
-
-	// Update state to armed
-	ro.mu.Lock()
-	ro.status.State = RaceStateArmed
-	ro.mu.Unlock()
+// runRace stages the race, starts it from the tree or start signal and
+// times it to completion, from the simulator or from real beam input
+func (ro *RaceOrchestrator) runRace() {
+	ro.mu.RLock()
+	sim := ro.simulator
+	ro.mu.RUnlock()
 
-	// Simulate vehicles entering stage
-	time.Sleep(500 * time.Millisecond)
-	ro.christmasTree.SetStage(1, true)
+	if !ro.runPreStaging() {
+		return
+	}
+	if sim != nil {
+		if !ro.simulateStaging(sim) {
+			return
+		}
+		// Wait briefly, then start the tree sequence
+		if !ro.sleep(500*time.Millisecond, "orchestrator.start_delay") {
+			return
+		}
+	} else if !ro.awaitStaging() {
+		return
+	}
 
-	time.Sleep(300 * time.Millisecond)
-	ro.christmasTree.SetStage(2, true)
+	if !ro.waitForStartRelease() {
+		return
+	}
 
-	// Wait briefly, then start the tree sequence
-	time.Sleep(500 * time.Millisecond)
+	if ro.config.Tree().Type == config.TreeSequenceStartSignal {
+		ro.runFromStartSignal(sim)
+		return
+	}
 
 	if ro.christmasTree.AllStaged() {
 		ro.mu.Lock()
 		ro.status.State = RaceStateRunning
 		ro.mu.Unlock()
 
+		// Bracket dial-ins hold back the quicker lane's countdown
+		delays := ro.timingSystem.SetDialIns(ro.GetDialIns())
+		ro.christmasTree.SetStartDelays(delays)
+
 		// Arm the Christmas tree sequence and get green light time
-		err := ro.christmasTree.StartSequence(config.TreeSequencePro)
+		err := ro.christmasTree.StartSequence(ro.config.Tree().Type)
 		if err != nil {
-			fmt.Printf("❌ Failed to start tree sequence: %v\n", err)
+			ro.log().Error("❌ Failed to start tree sequence", "error", err)
 			return
 		}
 
 		// Wait for sequence to complete and get green light time
 		// In a real implementation, the tree would return the green light time
-		time.Sleep(500 * time.Millisecond) // Wait for sequence
-		greenTime := time.Now()
+		if !ro.sleep(500*time.Millisecond, "orchestrator.tree_sequence") { // Wait for sequence
+			return
+		}
+		greenTime := timers.Or(ro.clock).Now()
 
 		ro.timingSystem.SetGreenLight(greenTime)
+		ro.finishRace(sim, greenTime, delays)
+	}
+}
+
+// simulateStaging plays the simulator's staging in time order, arming the
+// race once every lane has pre-staged. It returns false if the race was
+// aborted meanwhile.
+func (ro *RaceOrchestrator) simulateStaging(sim simulation.Simulator) bool {
+	type step struct {
+		at    time.Duration
+		lane  int
+		stage bool
+		name  string
+	}
+	var steps []step
+	for _, lane := range ro.status.ActiveLanes {
+		staging := sim.Staging(lane)
+		steps = append(steps,
+			step{at: staging.PreStage, lane: lane, name: "orchestrator.pre_stage"},
+			step{at: staging.Stage, lane: lane, stage: true, name: "orchestrator.stage"})
+	}
+	sort.SliceStable(steps, func(i, j int) bool { return steps[i].at < steps[j].at })
+
+	preStaged, elapsed := 0, time.Duration(0)
+	for _, s := range steps {
+		if !ro.sleep(s.at-elapsed, s.name) {
+			return false
+		}
+		elapsed = s.at
+		if s.stage {
+			ro.christmasTree.SetStage(s.lane, true)
+			continue
+		}
+		ro.christmasTree.SetPreStage(s.lane, true)
+		if preStaged++; preStaged < len(ro.status.ActiveLanes) {
+			continue
+		}
+
+		// Update state to armed
+		ro.mu.Lock()
+		if ro.status.State == RaceStateAborted {
+			ro.mu.Unlock()
+			return false
+		}
+		ro.status.State = RaceStateArmed
+		ro.mu.Unlock()
+	}
+	return true
+}
+
+// awaitStaging waits for every lane to stage from real beam input, arming
+// the race once they have. It returns false if the race was aborted first.
+func (ro *RaceOrchestrator) awaitStaging() bool {
+	for {
+		ro.mu.Lock()
+		if ro.status.State == RaceStateAborted {
+			ro.mu.Unlock()
+			return false
+		}
+		if ro.christmasTree.AllStaged() {
+			ro.status.State = RaceStateArmed
+			ro.mu.Unlock()
+			return true
+		}
+		ro.mu.Unlock()
+		if !ro.sleep(10*time.Millisecond, "orchestrator.staging") {
+			return false
+		}
+	}
+}
+
+// finishRace times the race from its green: simulated passes, or real beam
+// input until a lane finishes
+func (ro *RaceOrchestrator) finishRace(sim simulation.Simulator, greenTime time.Time, delays map[int]time.Duration) {
+	if sim != nil {
+		ro.simulateVehicleRun(sim, greenTime, delays)
+		return
+	}
+	if ro.awaitFinish() {
+		ro.completeRace()
+	}
+}
+
+// awaitFinish waits on real beam input until a lane finishes or every lane
+// has finished or fouled. It returns false if the race stopped running.
+func (ro *RaceOrchestrator) awaitFinish() bool {
+	for {
+		ro.mu.RLock()
+		running := ro.status.State == RaceStateRunning
+		ro.mu.RUnlock()
 
-		// Simulate vehicle race
-		ro.simulateVehicleRun(greenTime)
+		if !running {
+			return false
+		}
+		if ro.timingSystem.Settled() {
+			return true
+		}
+		for _, result := range ro.timingSystem.GetAllResults() {
+			if result.IsComplete {
+				return true // completeRace waits out the other lanes
+			}
+		}
+		if !ro.sleep(10*time.Millisecond, "orchestrator.await_finish") {
+			return false
+		}
 	}
 }
 
-func (ro *RaceOrchestrator) simulateVehicleRun(greenTime time.Time) {
-	// Simulate realistic reaction times and race progression
+// runFromStartSignal races without a tree: both lanes are timed from the
+// external start signal, so reaction times run from the signal to each
+// car's first movement, and a car that moves before it red-lights. Dial-ins
+// are not applied, since there is no tree to hold a lane back.
+func (ro *RaceOrchestrator) runFromStartSignal(sim simulation.Simulator) {
+	signal, ok := ro.waitForStartSignal()
+	if !ok {
+		return
+	}
+	ro.mu.Lock()
+	ro.status.State = RaceStateRunning
+	ro.mu.Unlock()
 
-	// Lane 1 vehicle starts (good reaction time)
-	reactionTime1 := 400 * time.Millisecond
-	startTime1 := greenTime.Add(reactionTime1)
-	ro.timingSystem.TriggerBeam("stage", 1, startTime1)
+	ro.timingSystem.SetGreenLight(signal)
+	ro.finishRace(sim, signal, nil)
+}
 
-	// Lane 2 vehicle starts (slightly slower)
-	reactionTime2 := 450 * time.Millisecond
-	startTime2 := greenTime.Add(reactionTime2)
-	ro.timingSystem.TriggerBeam("stage", 2, startTime2)
+// waitForStartSignal blocks until StartSignal is called. It returns false
+// if the race was aborted while waiting.
+func (ro *RaceOrchestrator) waitForStartSignal() (time.Time, bool) {
+	for {
+		ro.mu.RLock()
+		aborted := ro.status.State == RaceStateAborted
+		signal := ro.startSignal
+		ro.mu.RUnlock()
 
-	// Simulate 60-foot times
-	time.Sleep(50 * time.Millisecond) // Fast simulation
-	ro.timingSystem.TriggerBeam("60_foot", 1, startTime1.Add(950*time.Millisecond))
-	ro.timingSystem.TriggerBeam("60_foot", 2, startTime2.Add(980*time.Millisecond))
+		if aborted {
+			return time.Time{}, false
+		}
+		if !signal.IsZero() {
+			return signal, true
+		}
+		if !ro.sleep(10*time.Millisecond, "orchestrator.start_signal") {
+			return time.Time{}, false
+		}
+	}
+}
 
-	// Simulate eighth-mile times
-	time.Sleep(50 * time.Millisecond)
-	ro.timingSystem.TriggerBeam("660_foot", 1, startTime1.Add(4200*time.Millisecond))
-	ro.timingSystem.TriggerBeam("660_foot", 2, startTime2.Add(4350*time.Millisecond))
+// StartSignal starts a race run without a tree (TreeSequenceStartSignal)
+// from an external start signal, timestamped when the signal was seen, or
+// now when at is zero. Both lanes are timed from it, so both must be staged.
+func (ro *RaceOrchestrator) StartSignal(at time.Time) error {
+	if ro.christmasTree != nil && !ro.christmasTree.AllStaged() {
+		return fmt.Errorf("both lanes must be staged")
+	}
 
-	// Simulate quarter-mile finish
-	time.Sleep(50 * time.Millisecond)
-	ro.timingSystem.TriggerBeam("1320_foot", 1, startTime1.Add(7300*time.Millisecond))
-	ro.timingSystem.TriggerBeam("1320_foot", 2, startTime2.Add(7500*time.Millisecond))
+	ro.mu.Lock()
+	if ro.config == nil || ro.config.Tree().Type != config.TreeSequenceStartSignal {
+		ro.mu.Unlock()
+		return fmt.Errorf("race is started by the tree")
+	}
+	switch ro.status.State {
+	case RaceStateRunning, RaceStateComplete, RaceStateAborted:
+		ro.mu.Unlock()
+		return fmt.Errorf("race already %s", ro.status.State)
+	}
+	if !ro.startSignal.IsZero() {
+		ro.mu.Unlock()
+		return fmt.Errorf("start signal already given")
+	}
+	if at.IsZero() {
+		at = timers.Or(ro.clock).Now()
+	}
+	ro.startSignal = at
+	ro.mu.Unlock()
+
+	if ro.eventBus != nil {
+		ro.eventBus.Publish(
+			events.NewEvent(events.EventRaceSignal).
+				WithRaceID(ro.raceID).
+				WithData("at", at).
+				Build(),
+		)
+	}
+	ro.log().Info("🏴 Start signal")
+	return nil
+}
+
+// simulateVehicleRun plays the simulator's passes, each lane leaving on its
+// own green: every lane's launch, then each downtrack beam in turn
+func (ro *RaceOrchestrator) simulateVehicleRun(sim simulation.Simulator, greenTime time.Time, delays map[int]time.Duration) {
+	ro.timingSystem.SetTimestampSource(timers.AccuracyOf(timers.SourceSimulated))
+
+	trapLength := 0.0
+	if _, ok := ro.config.Track().BeamLayout[simulation.BeamSpeedTrap]; ok {
+		trapLength = ro.config.Timing().SpeedTrapLength
+	}
+	lanes := ro.status.ActiveLanes
+	starts := make(map[int]time.Time, len(lanes))
+	crossings := make(map[string]map[int]time.Time)
+	var order []string
+	for _, lane := range lanes {
+		pass := sim.Pass(lane)
+		starts[lane] = greenTime.Add(delays[lane] + pass.ReactionTime)
+		for _, split := range pass.Splits(trapLength) {
+			if crossings[split.BeamID] == nil {
+				crossings[split.BeamID] = make(map[int]time.Time)
+				order = append(order, split.BeamID)
+			}
+			crossings[split.BeamID][lane] = starts[lane].Add(split.At)
+		}
+	}
+	sort.SliceStable(order, func(i, j int) bool { return beamOrder[order[i]] < beamOrder[order[j]] })
+
+	for _, lane := range lanes {
+		ro.timingSystem.TriggerBeam(simulation.BeamStage, lane, starts[lane])
+	}
+
+	for _, beamID := range order {
+		if !ro.sleep(50*time.Millisecond, "orchestrator.vehicle_run") { // Fast simulation
+			return
+		}
+		for _, lane := range lanes {
+			if at, ok := crossings[beamID][lane]; ok {
+				ro.timingSystem.TriggerBeam(beamID, lane, at)
+			}
+		}
+	}
+
+	ro.completeRace()
+}
+
+// beamOrder ranks the beams a simulated pass crosses down the track
+var beamOrder = map[string]int{
+	simulation.BeamSixtyFoot:    1,
+	simulation.BeamThreeThirty:  2,
+	simulation.BeamEighthTrap:   3,
+	simulation.BeamEighthMile:   4,
+	simulation.BeamThousandFoot: 5,
+	simulation.BeamSpeedTrap:    6,
+	simulation.BeamQuarterMile:  7,
+}
+
+// completeRace finalizes the results, decides the race and publishes its
+// completion with everything consumers need to report it: the final
+// results, decision, winner and margin. A photo finish is held for review, so
+// no winner (and no win light) is published until ResolveFinish is called.
+func (ro *RaceOrchestrator) completeRace() {
+	if !ro.awaitResults() {
+		return
+	}
+	ro.timingSystem.Finalize()
+	decision := ro.decide()
+	ro.adjudicator.Stop()
 
-	// Race complete
 	ro.mu.Lock()
+	if ro.status.State != RaceStateRunning {
+		// Aborted, or already completed from manual results
+		ro.mu.Unlock()
+		return
+	}
 	ro.status.State = RaceStateComplete
+	ro.decision = decision
 	ro.mu.Unlock()
 
 	// Publish race complete event
@@ -228,11 +547,676 @@ func (ro *RaceOrchestrator) simulateVehicleRun(greenTime time.Time) {
 		ro.eventBus.Publish(
 			events.NewEvent(events.EventRaceComplete).
 				WithRaceID(ro.raceID).
+				WithData("decision", decision).
+				WithData("results", ro.timingSystem.GetAllResults()).
+				WithData("winner_lane", decision.WinnerLane).
+				WithData("margin", decision.Margin).
+				WithData("margin_display", results.FormatDecisionMargin(decision, ro.timingSystem.GetAllResults())).
+				WithData("under_review", decision.UnderReview).
 				Build(),
 		)
+		ro.publishDecision(decision)
 	}
 
-	fmt.Println("🏁 libdrag Race Orchestrator: Race complete!")
+	ro.log().Info("🏁 Race complete")
+}
+
+// awaitResults is the finalization barrier: it waits until timing has every
+// lane's finish, or Timing().FinalizeTimeout has passed, so splits still
+// being processed are not left out of the decision. It returns false if the
+// race stopped running while waiting.
+func (ro *RaceOrchestrator) awaitResults() bool {
+	deadline := timers.Or(ro.clock).Now().Add(ro.config.Timing().FinalizeTimeout)
+	for {
+		ro.mu.RLock()
+		running := ro.status.State == RaceStateRunning
+		ro.mu.RUnlock()
+
+		if !running {
+			return false
+		}
+		if ro.timingSystem.Settled() {
+			return true
+		}
+		if !timers.Or(ro.clock).Now().Before(deadline) {
+			ro.log().Warn("⚠️ Finalizing without every lane's finish")
+			return true
+		}
+		if !ro.sleep(10*time.Millisecond, "orchestrator.finalize") {
+			return false
+		}
+	}
+}
+
+// decide applies the configured foul precedence to the race's results
+func (ro *RaceOrchestrator) decide() results.Decision {
+	timingConfig := ro.config.Timing()
+	precedence, err := results.ParsePrecedence(timingConfig.FoulPrecedence)
+	if err != nil {
+		ro.log().Warn("⚠️ Using default foul precedence", "error", err)
+		precedence = nil
+	}
+	rules := results.Rules{
+		Precedence:        precedence,
+		PhotoFinishWindow: timingConfig.PhotoFinishWindow,
+		DialIns:           ro.GetDialIns(),
+		Disqualified:      ro.GetRaceStatus().Disqualified,
+	}
+	if ro.adjudicator != nil {
+		rules.Ruling = ro.adjudicator.Ruling()
+	}
+	return results.DecideWithRules(ro.timingSystem.GetAllResults(), rules)
+}
+
+// EnterManualResult records hand-timed or partial results for a lane whose
+// beams failed. A running race completes once every lane has finished or
+// fouled; a completed race is decided again unless an official has ruled.
+func (ro *RaceOrchestrator) EnterManualResult(entry timing.ManualResult) error {
+	ro.mu.RLock()
+	state := ro.status.State
+	ro.mu.RUnlock()
+
+	if state != RaceStateRunning && state != RaceStateComplete {
+		return fmt.Errorf("cannot enter manual results while the race is %s", state)
+	}
+	if err := ro.timingSystem.EnterManualResult(entry); err != nil {
+		return err
+	}
+
+	if state == RaceStateRunning {
+		for _, result := range ro.timingSystem.GetAllResults() {
+			if !result.IsComplete && !result.IsFoul {
+				return nil
+			}
+		}
+		ro.completeRace()
+		return nil
+	}
+	ro.redecide()
+	return nil
+}
+
+// ReportBoundaryFoul records a lane crossing the centerline or its outside
+// boundary. Reported after the finish (say, from video review), it decides
+// a completed race again unless an official has ruled.
+func (ro *RaceOrchestrator) ReportBoundaryFoul(lane int) error {
+	return ro.ReportBoundaryViolation(fouls.BoundaryViolation{Lane: lane, Source: fouls.SourceOfficial})
+}
+
+// ReportBoundaryViolation records a lane crossing out of its lane, from a
+// boundary sensor, a lateral position or an official, and publishes
+// race.boundary_violation. The lane loses as a boundary foul, the worst foul
+// under first or worst. A lane already out of bounds is not reported again.
+func (ro *RaceOrchestrator) ReportBoundaryViolation(v fouls.BoundaryViolation) error {
+	ro.mu.RLock()
+	state := ro.status.State
+	raceID := ro.raceID
+	bus := ro.eventBus
+	ro.mu.RUnlock()
+
+	if state != RaceStateRunning && state != RaceStateComplete {
+		return fmt.Errorf("cannot report a boundary foul while the race is %s", state)
+	}
+	if v.At.IsZero() {
+		v.At = timers.Or(ro.clock).Now()
+	}
+	if result := ro.timingSystem.GetResults(v.Lane); result != nil && result.IsFoul && result.FoulReason == "boundary" {
+		return nil
+	}
+	if bus != nil {
+		event := events.NewEvent(events.EventRaceBoundaryViolation).
+			WithRaceID(raceID).
+			WithLane(v.Lane).
+			WithData("boundary", v.Boundary).
+			WithData("source", v.Source).
+			WithData("at", v.At)
+		if v.Offset != nil {
+			event = event.WithData("offset", *v.Offset)
+		}
+		bus.Publish(event.Build())
+	}
+	if err := ro.timingSystem.ReportBoundaryFoul(v.Lane, v.At); err != nil {
+		return err
+	}
+	ro.adjudicator.Record(fouls.Foul{Lane: v.Lane, Kind: fouls.KindBoundary, At: v.At})
+
+	if state == RaceStateComplete {
+		ro.redecide()
+	}
+	return nil
+}
+
+// ReportBoundarySensor reports a boundary sensor tripped in a lane while
+// the race runs. boundary is config.BoundaryCenterline or
+// config.BoundaryOutside.
+func (ro *RaceOrchestrator) ReportBoundarySensor(lane int, boundary string, at time.Time) error {
+	ro.mu.RLock()
+	state := ro.status.State
+	cfg := ro.config
+	ro.mu.RUnlock()
+
+	if boundary != config.BoundaryCenterline && boundary != config.BoundaryOutside {
+		return fmt.Errorf("unknown boundary %q", boundary)
+	}
+	if state != RaceStateRunning {
+		return nil // Cars pulling in or on the return road trip sensors too
+	}
+	if lane < 1 || lane > cfg.Track().LaneCount {
+		return fmt.Errorf("invalid lane %d", lane)
+	}
+	return ro.ReportBoundaryViolation(fouls.BoundaryViolation{
+		Lane:     lane,
+		Boundary: boundary,
+		Source:   fouls.SourceSensor,
+		At:       at,
+	})
+}
+
+// ReportLateralPosition reports a lane's lateral position while the race
+// runs, as the offset in feet of the tire nearest a boundary from the lane's
+// center (positive toward the centerline). A position past half the lane
+// width is a boundary violation.
+func (ro *RaceOrchestrator) ReportLateralPosition(lane int, offset float64, at time.Time) error {
+	ro.mu.RLock()
+	state := ro.status.State
+	cfg := ro.config
+	ro.mu.RUnlock()
+
+	if state != RaceStateRunning {
+		return nil // Positions outside a run (staging, the return road) are not policed
+	}
+	if lane < 1 || lane > cfg.Track().LaneCount {
+		return fmt.Errorf("invalid lane %d", lane)
+	}
+	boundary, crossed := fouls.CrossedBoundary(offset, cfg.Track().LaneWidth)
+	if !crossed {
+		return nil
+	}
+	return ro.ReportBoundaryViolation(fouls.BoundaryViolation{
+		Lane:     lane,
+		Boundary: boundary,
+		Source:   fouls.SourcePosition,
+		Offset:   &offset,
+		At:       at,
+	})
+}
+
+// redecide decides a completed race again after its results changed,
+// publishing the new outcome unless an official has ruled
+func (ro *RaceOrchestrator) redecide() {
+	decision := ro.decide()
+	ro.mu.Lock()
+	if ro.decision.Reason == results.ReasonOfficial {
+		ro.mu.Unlock()
+		return
+	}
+	same := ro.decision.Same(decision)
+	ro.decision = decision
+	ro.mu.Unlock()
+
+	if ro.eventBus != nil && !same {
+		ro.publishDecision(decision)
+	}
+}
+
+// ResolveFinish records an official's ruling on a finish under review and
+// releases the win light
+func (ro *RaceOrchestrator) ResolveFinish(winnerLane int) error {
+	ro.mu.Lock()
+	if !ro.decision.UnderReview {
+		ro.mu.Unlock()
+		return fmt.Errorf("finish is not under review")
+	}
+	if _, ok := ro.timingSystem.GetAllResults()[winnerLane]; !ok {
+		ro.mu.Unlock()
+		return fmt.Errorf("lane %d did not race", winnerLane)
+	}
+	ro.decision = ro.decision.Resolve(winnerLane)
+	decision := ro.decision
+	ro.mu.Unlock()
+
+	if ro.eventBus != nil {
+		ro.eventBus.Publish(
+			events.NewEvent(events.EventFinishResolved).
+				WithRaceID(ro.raceID).
+				WithLane(winnerLane).
+				WithData("decision", decision).
+				Build(),
+		)
+		ro.publishWinner(decision)
+	}
+	return nil
+}
+
+// GetDecision returns the race outcome
+func (ro *RaceOrchestrator) GetDecision() results.Decision {
+	ro.mu.RLock()
+	defer ro.mu.RUnlock()
+	return ro.decision
+}
+
+// publishDecision holds a finish for review or lights the winner
+func (ro *RaceOrchestrator) publishDecision(decision results.Decision) {
+	if decision.UnderReview {
+		ro.eventBus.Publish(
+			events.NewEvent(events.EventFinishUnderReview).
+				WithRaceID(ro.raceID).
+				WithData("reason", decision.Reason).
+				WithData("margin", decision.Margin).
+				Build(),
+		)
+		return
+	}
+	ro.publishWinner(decision)
+}
+
+// publishWinner lights the winner's win light
+func (ro *RaceOrchestrator) publishWinner(decision results.Decision) {
+	if decision.WinnerLane == 0 {
+		return
+	}
+	ro.eventBus.Publish(
+		events.NewEvent(events.EventRaceWinner).
+			WithRaceID(ro.raceID).
+			WithLane(decision.WinnerLane).
+			WithData("reason", decision.Reason).
+			WithData("margin", decision.Margin).
+			WithData("margin_display", results.FormatDecisionMargin(decision, ro.timingSystem.GetAllResults())).
+			Build(),
+	)
+}
+
+// sleep pauses the simulated race on the shared timer wheel. It returns
+// false, cut short, once the race is aborted or stopped.
+func (ro *RaceOrchestrator) sleep(d time.Duration, name string) bool {
+	ro.mu.RLock()
+	halt := ro.halt
+	ro.mu.RUnlock()
+	return timers.SleepOrDone(timers.Or(ro.clock), d, timers.Label{Name: name, RaceID: ro.raceID}, halt)
+}
+
+// haltRace ends the race's goroutine at its next pause. Caller holds ro.mu.
+func (ro *RaceOrchestrator) haltRace() {
+	if !ro.halted {
+		ro.halted = true
+		close(ro.halt)
+	}
+}
+
+// waitForStartRelease blocks while the starter override or a held lane is
+// holding the start. It returns false if the race was aborted while waiting.
+func (ro *RaceOrchestrator) waitForStartRelease() bool {
+	for {
+		ro.mu.RLock()
+		aborted := ro.status.State == RaceStateAborted
+		released := (!ro.starterOverride || ro.manualTrigger) && len(ro.status.HeldLanes) == 0
+		ro.mu.RUnlock()
+
+		if aborted {
+			return false
+		}
+		if released {
+			return true
+		}
+		if !ro.sleep(10*time.Millisecond, "orchestrator.start_release") {
+			return false
+		}
+	}
+}
+
+// SetDialIn sets or changes a lane's dial-in. Dials can be changed by an
+// official until the tree starts.
+func (ro *RaceOrchestrator) SetDialIn(lane int, dial float64) error {
+	ro.mu.Lock()
+	switch ro.status.State {
+	case RaceStateRunning, RaceStateComplete, RaceStateAborted:
+		ro.mu.Unlock()
+		return fmt.Errorf("cannot change dial-in once the race is %s", ro.status.State)
+	}
+	if dial <= 0 {
+		ro.mu.Unlock()
+		return fmt.Errorf("dial-in must be positive")
+	}
+	if ro.config != nil {
+		if err := rules.Or(ro.rules).ValidateDialIn(ro.config.RacingClass(), dial); err != nil {
+			ro.mu.Unlock()
+			return err
+		}
+	}
+	previous, changed := ro.dialIns[lane]
+	ro.dialIns[lane] = dial
+	ro.mu.Unlock()
+
+	if ro.eventBus != nil {
+		builder := events.NewEvent(events.EventRaceDialIn).
+			WithRaceID(ro.raceID).
+			WithLane(lane).
+			WithData("dial_in", dial).
+			WithData("changed", changed)
+		if changed {
+			builder.WithData("previous_dial_in", previous)
+		}
+		ro.eventBus.Publish(builder.Build())
+	}
+	return nil
+}
+
+// GetDialIns returns the dial-ins by lane
+func (ro *RaceOrchestrator) GetDialIns() map[int]float64 {
+	ro.mu.RLock()
+	defer ro.mu.RUnlock()
+
+	dialIns := make(map[int]float64, len(ro.dialIns))
+	for lane, dial := range ro.dialIns {
+		dialIns[lane] = dial
+	}
+	return dialIns
+}
+
+// ArmTree arms the Christmas tree (starter control)
+func (ro *RaceOrchestrator) ArmTree() error {
+	if ro.christmasTree == nil {
+		return fmt.Errorf("christmas tree component is required")
+	}
+	return ro.christmasTree.Arm(context.Background())
+}
+
+// DisarmTree disarms the Christmas tree (starter control)
+func (ro *RaceOrchestrator) DisarmTree() error {
+	if ro.christmasTree == nil {
+		return fmt.Errorf("christmas tree component is required")
+	}
+	ro.christmasTree.DisarmTree()
+	return nil
+}
+
+// SetStagingBeam passes a pre-stage or stage beam change in a lane to the
+// tree, for staging driven from outside the race simulation (a race-control
+// front end or real staging beams). During the burnout and backup the tree
+// is not told: a car crossing the beams then is not approaching them.
+func (ro *RaceOrchestrator) SetStagingBeam(lane int, beamID beam.BeamID, broken bool) error {
+	if ro.christmasTree == nil {
+		return fmt.Errorf("christmas tree component is required")
+	}
+	if beamID != beam.BeamPreStage && beamID != beam.BeamStage {
+		return fmt.Errorf("%s is not a staging beam", beamID)
+	}
+	ro.mu.Lock()
+	laneCount := ro.config.Track().LaneCount
+	if lane < 1 || lane > laneCount {
+		ro.mu.Unlock()
+		return fmt.Errorf("invalid lane %d", lane)
+	}
+	if inBurnout(ro.status.State) {
+		ro.holdStaging(lane, beamID, broken)
+		ro.mu.Unlock()
+		return nil
+	}
+	ro.mu.Unlock()
+
+	ro.setStagingBulb(lane, beamID, broken)
+	return nil
+}
+
+// setStagingBulb passes a staging beam change to the tree
+func (ro *RaceOrchestrator) setStagingBulb(lane int, beamID beam.BeamID, broken bool) {
+	switch beamID {
+	case beam.BeamPreStage:
+		ro.christmasTree.SetPreStage(lane, broken)
+	case beam.BeamStage:
+		ro.christmasTree.SetStage(lane, broken)
+	}
+}
+
+// SetStarterOverride enables or disables the starter override. While enabled
+// the race holds at the starting line until TriggerTree is called.
+func (ro *RaceOrchestrator) SetStarterOverride(enabled bool) {
+	ro.mu.Lock()
+	ro.starterOverride = enabled
+	if !enabled {
+		ro.manualTrigger = false
+	}
+	ro.mu.Unlock()
+
+	if ro.eventBus != nil {
+		ro.eventBus.Publish(
+			events.NewEvent(events.EventStarterOverride).
+				WithRaceID(ro.raceID).
+				WithData("enabled", enabled).
+				Build(),
+		)
+	}
+}
+
+// IsStarterOverride reports whether the starter override is active
+func (ro *RaceOrchestrator) IsStarterOverride() bool {
+	ro.mu.RLock()
+	defer ro.mu.RUnlock()
+	return ro.starterOverride
+}
+
+// TriggerTree releases a race held by the starter override
+func (ro *RaceOrchestrator) TriggerTree() error {
+	ro.mu.Lock()
+	if !ro.starterOverride {
+		ro.mu.Unlock()
+		return fmt.Errorf("starter override is not active")
+	}
+	if len(ro.status.HeldLanes) > 0 {
+		ro.mu.Unlock()
+		return fmt.Errorf("lane %d is held", ro.status.HeldLanes[0])
+	}
+	ro.manualTrigger = true
+	ro.mu.Unlock()
+
+	if ro.eventBus != nil {
+		ro.eventBus.Publish(
+			events.NewEvent(events.EventStarterTrigger).
+				WithRaceID(ro.raceID).
+				Build(),
+		)
+	}
+	return nil
+}
+
+// HoldLane holds (or releases) a lane at the starting line, say for a car
+// with a leak or a driver not ready. The tree does not start, automatically
+// or from TriggerTree, while any lane is held.
+func (ro *RaceOrchestrator) HoldLane(lane int, held bool) error {
+	ro.mu.Lock()
+	switch ro.status.State {
+	case RaceStateRunning, RaceStateComplete, RaceStateAborted:
+		ro.mu.Unlock()
+		return fmt.Errorf("cannot hold a lane once the race is %s", ro.status.State)
+	}
+	if lane < 1 || ro.config == nil || lane > ro.config.Track().LaneCount {
+		ro.mu.Unlock()
+		return fmt.Errorf("invalid lane %d", lane)
+	}
+	if containsLane(ro.status.Disqualified, lane) {
+		ro.mu.Unlock()
+		return fmt.Errorf("lane %d is disqualified", lane)
+	}
+	wasHeld := containsLane(ro.status.HeldLanes, lane)
+	if held == wasHeld {
+		ro.mu.Unlock()
+		return nil
+	}
+	if held {
+		ro.status.HeldLanes = withLane(ro.status.HeldLanes, lane)
+	} else {
+		ro.status.HeldLanes = withoutLane(ro.status.HeldLanes, lane)
+	}
+	ro.mu.Unlock()
+
+	if ro.eventBus != nil {
+		ro.eventBus.Publish(
+			events.NewEvent(events.EventStarterLaneHold).
+				WithRaceID(ro.raceID).
+				WithLane(lane).
+				WithData("held", held).
+				Build(),
+		)
+	}
+	return nil
+}
+
+// DisqualifyLane disqualifies a lane, before or after its run. The lane
+// loses whatever else happens in the race, and a hold on it is released. A
+// completed race is decided again unless an official has ruled.
+func (ro *RaceOrchestrator) DisqualifyLane(lane int, reason string) error {
+	ro.mu.Lock()
+	state := ro.status.State
+	switch state {
+	case RaceStateIdle, RaceStateAborted:
+		ro.mu.Unlock()
+		return fmt.Errorf("cannot disqualify a lane while the race is %s", state)
+	}
+	if containsLane(ro.status.Disqualified, lane) {
+		ro.mu.Unlock()
+		return nil
+	}
+	ro.mu.Unlock()
+
+	at := timers.Or(ro.clock).Now()
+	if err := ro.timingSystem.Disqualify(lane, reason, at); err != nil {
+		return err
+	}
+
+	ro.mu.Lock()
+	ro.status.Disqualified = withLane(ro.status.Disqualified, lane)
+	ro.status.HeldLanes = withoutLane(ro.status.HeldLanes, lane)
+	ro.mu.Unlock()
+
+	if ro.eventBus != nil {
+		ro.eventBus.Publish(
+			events.NewEvent(events.EventStarterDisqualify).
+				WithRaceID(ro.raceID).
+				WithLane(lane).
+				WithData("reason", reason).
+				WithData("at", at).
+				Build(),
+		)
+	}
+	if state == RaceStateComplete {
+		ro.redecide()
+	}
+	return nil
+}
+
+// StagingTimeoutFoul records the foul of a lane that failed to stage before
+// the auto-start staging timeout, elapsed after the staging clock started,
+// in the timing results. The auto-start system that timed the lane out has
+// lit its red bulb. A completed race is decided again unless an official
+// has ruled.
+func (ro *RaceOrchestrator) StagingTimeoutFoul(lane int, elapsed time.Duration) error {
+	ro.mu.RLock()
+	state := ro.status.State
+	ro.mu.RUnlock()
+	switch state {
+	case RaceStateIdle, RaceStateAborted:
+		return fmt.Errorf("cannot foul a lane while the race is %s", state)
+	}
+
+	if err := ro.timingSystem.StagingTimeoutFoul(lane, elapsed, timers.Or(ro.clock).Now()); err != nil {
+		return err
+	}
+	if state == RaceStateComplete {
+		ro.redecide()
+	}
+	return nil
+}
+
+// withLane returns a copy of lanes with lane added, in order. Status lane
+// lists are copied on change since GetRaceStatus hands them out.
+func withLane(lanes []int, lane int) []int {
+	added := append(append([]int(nil), lanes...), lane)
+	sort.Ints(added)
+	return added
+}
+
+// withoutLane returns a copy of lanes without lane
+func withoutLane(lanes []int, lane int) []int {
+	var kept []int
+	for _, l := range lanes {
+		if l != lane {
+			kept = append(kept, l)
+		}
+	}
+	return kept
+}
+
+func containsLane(lanes []int, lane int) bool {
+	for _, l := range lanes {
+		if l == lane {
+			return true
+		}
+	}
+	return false
+}
+
+// Abort stops the race and puts the tree into its emergency state. Once it
+// returns, the race changes no bulb and times nothing more: a tree sequence
+// in flight is cut short before its next step and the race's goroutine has
+// exited, so race.abort is the race's last event.
+func (ro *RaceOrchestrator) Abort(reason string) error {
+	ro.mu.Lock()
+	switch ro.status.State {
+	case RaceStateComplete, RaceStateAborted:
+		ro.mu.Unlock()
+		return fmt.Errorf("race already %s", ro.status.State)
+	}
+	ro.status.State = RaceStateAborted
+	ro.haltRace()
+	adjudicator := ro.adjudicator
+	ro.mu.Unlock()
+
+	if adjudicator != nil {
+		adjudicator.Stop()
+	}
+
+	if ro.treeComponent != nil {
+		if err := ro.treeComponent.EmergencyStop(); err != nil {
+			ro.log().Error("⚠️ Tree emergency stop failed", "error", err)
+		}
+	}
+	ro.running.Wait()
+
+	if ro.eventBus != nil {
+		ro.eventBus.Publish(
+			events.NewEvent(events.EventRaceAbort).
+				WithRaceID(ro.raceID).
+				WithData("reason", reason).
+				Build(),
+		)
+	}
+
+	ro.log().Warn("🛑 Race aborted", "reason", reason)
+	return nil
+}
+
+// StatusVersion returns the version of the race status, which moves
+// whenever it may have changed. Take it before GetRaceStatus.
+func (ro *RaceOrchestrator) StatusVersion() uint64 {
+	return ro.mu.Version()
+}
+
+// TreeVersion returns the version of the tree status (see
+// tree.ChristmasTree.Version)
+func (ro *RaceOrchestrator) TreeVersion() uint64 {
+	if ro.christmasTree == nil {
+		return 0
+	}
+	return ro.christmasTree.Version()
+}
+
+// ResultsVersion returns the version of the timing results (see
+// timing.TimingSystem.Version)
+func (ro *RaceOrchestrator) ResultsVersion() uint64 {
+	if ro.timingSystem == nil {
+		return 0
+	}
+	return ro.timingSystem.Version()
 }
 
 func (ro *RaceOrchestrator) GetRaceStatus() RaceStatus {
@@ -260,11 +1244,32 @@ func (ro *RaceOrchestrator) GetTreeStatus() *tree.Status {
 	return &status
 }
 
+// GetStagingMotion returns each lane's staging motion history
+func (ro *RaceOrchestrator) GetStagingMotion() map[int]tree.StagingMotionState {
+	if ro.christmasTree == nil {
+		return nil
+	}
+	return ro.christmasTree.GetStagingMotion()
+}
+
+// Stop ends the race without aborting it, as when the API shuts down: like
+// Abort, no bulb changes and no timing runs once it returns, but the lights
+// are left as they are and no event is published
 func (ro *RaceOrchestrator) Stop() error {
 	ro.mu.Lock()
-	defer ro.mu.Unlock()
-
 	ro.status.State = RaceStateIdle
+	ro.haltRace()
+	adjudicator := ro.adjudicator
+	christmasTree := ro.christmasTree
+	ro.mu.Unlock()
+
+	if adjudicator != nil {
+		adjudicator.Stop()
+	}
+	if christmasTree != nil {
+		christmasTree.Halt()
+	}
+	ro.running.Wait()
 	return nil
 }
 
@@ -281,6 +1286,130 @@ func (ro *RaceOrchestrator) SetEventBus(eventBus *events.EventBus) {
 	ro.eventBus = eventBus
 }
 
+// SetClock runs the race, and the components it is initialized with, on
+// clock instead of the default wheel. Call it before Initialize.
+func (ro *RaceOrchestrator) SetClock(clock timers.Clock) {
+	ro.mu.Lock()
+	defer ro.mu.Unlock()
+	ro.clock = clock
+}
+
+// SetLogger logs the race, and the components it is initialized with, to
+// logger instead of logs.Default. Call it before Initialize.
+func (ro *RaceOrchestrator) SetLogger(logger *slog.Logger) {
+	ro.mu.Lock()
+	defer ro.mu.Unlock()
+	ro.logger = logger
+}
+
+// log returns the orchestrator's logger for its race. Callers need not
+// hold ro.mu, as the logger and race are set before the race runs.
+func (ro *RaceOrchestrator) log() *slog.Logger {
+	return logs.For(ro.logger, "orchestrator", ro.raceID)
+}
+
+// SetRules looks class rules up in engine instead of rules.Default, for
+// the race and its tree. Call it before Initialize.
+func (ro *RaceOrchestrator) SetRules(engine *rules.Engine) {
+	ro.mu.Lock()
+	defer ro.mu.Unlock()
+	ro.rules = engine
+}
+
+// SetSimulator chooses how the race's vehicles stage and run: from sim, or
+// from real beam input when sim is nil (staging through SetStagingBeam and
+// the run through the timing system's beams). Races use
+// simulation.Reference by default. Call it before StartRace.
+func (ro *RaceOrchestrator) SetSimulator(sim simulation.Simulator) {
+	ro.mu.Lock()
+	defer ro.mu.Unlock()
+	ro.simulator = sim
+}
+
+// TriggerBeam reports a timing beam crossing in a lane from real beam
+// input, at the time the beam saw it, or now when at is zero
+func (ro *RaceOrchestrator) TriggerBeam(lane int, beamID string, at time.Time) error {
+	return ro.triggerBeam(lane, beamID, at, timers.Accuracy{})
+}
+
+// triggerBeam reports a timing beam crossing timed by accuracy's source, or
+// by the timing system's own when it has none
+func (ro *RaceOrchestrator) triggerBeam(lane int, beamID string, at time.Time, accuracy timers.Accuracy) error {
+	if ro.timingSystem == nil {
+		return fmt.Errorf("timing system component is required")
+	}
+	ro.mu.RLock()
+	track := ro.config.Track()
+	ro.mu.RUnlock()
+	if lane < 1 || lane > track.LaneCount {
+		return fmt.Errorf("invalid lane %d", lane)
+	}
+	if _, ok := track.BeamLayout[beamID]; !ok {
+		return fmt.Errorf("unknown beam %q", beamID)
+	}
+	if at.IsZero() {
+		at = timers.Or(ro.clock).Now()
+	}
+	if accuracy.Source == "" {
+		ro.timingSystem.TriggerBeam(beamID, lane, at)
+	} else {
+		ro.timingSystem.TriggerBeamFrom(beamID, lane, at, accuracy)
+	}
+	return nil
+}
+
+// ApplyReading reports a controller reading through the track's hardware
+// map. Staging beams light the tree, and the stage beam clearing once the
+// race runs times the car leaving the line; the others time the race when
+// broken, and a tripped boundary sensor reports a boundary violation. A time
+// latched by the controller is kept; any other is corrected for the
+// channel's calibrated latency.
+func (ro *RaceOrchestrator) ApplyReading(r beam.Reading) error {
+	ro.mu.RLock()
+	cfg := ro.config
+	ro.mu.RUnlock()
+	if cfg == nil {
+		return fmt.Errorf("orchestrator is not initialized")
+	}
+	wiring, ok := cfg.Track().Hardware.Lookup(r.Channel)
+	if !ok || (wiring.Kind != config.ChannelBeam && wiring.Kind != config.ChannelBoundary) {
+		return fmt.Errorf("channel %d is not wired to a beam or boundary sensor", r.Channel)
+	}
+	at := r.At
+	if at.IsZero() {
+		at = timers.Or(ro.clock).Now()
+	}
+	if r.Accuracy.Source != timers.SourceHardware {
+		at = wiring.Correct(at)
+	}
+
+	if wiring.Kind == config.ChannelBoundary {
+		if !r.Broken {
+			return nil
+		}
+		return ro.ReportBoundarySensor(wiring.Lane, wiring.ID, at)
+	}
+	switch beam.BeamID(wiring.ID) {
+	case beam.BeamPreStage:
+		return ro.SetStagingBeam(wiring.Lane, beam.BeamPreStage, r.Broken)
+	case beam.BeamStage:
+		if err := ro.SetStagingBeam(wiring.Lane, beam.BeamStage, r.Broken); err != nil {
+			return err
+		}
+		ro.mu.RLock()
+		running := ro.status.State == RaceStateRunning
+		ro.mu.RUnlock()
+		if r.Broken || !running {
+			return nil
+		}
+		return ro.triggerBeam(wiring.Lane, wiring.ID, at, r.Accuracy) // Leaving the line
+	}
+	if !r.Broken {
+		return nil
+	}
+	return ro.triggerBeam(wiring.Lane, wiring.ID, at, r.Accuracy)
+}
+
 // SetRaceID sets the race ID for the orchestrator
 func (ro *RaceOrchestrator) SetRaceID(raceID string) {
 	ro.mu.Lock()
@@ -0,0 +1,561 @@
+package orchestrator
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/benharold/libdrag/internal/vehicle"
+	"github.com/benharold/libdrag/pkg/autostart"
+	"github.com/benharold/libdrag/pkg/beam"
+	"github.com/benharold/libdrag/pkg/component"
+	"github.com/benharold/libdrag/pkg/config"
+	"github.com/benharold/libdrag/pkg/events"
+	"github.com/benharold/libdrag/pkg/logs"
+	"github.com/benharold/libdrag/pkg/results"
+	"github.com/benharold/libdrag/pkg/simulation"
+	"github.com/benharold/libdrag/pkg/timers"
+	"github.com/benharold/libdrag/pkg/timing"
+	"github.com/benharold/libdrag/pkg/tree"
+)
+
+// Pair is two lanes of a multi-lane track raced against each other on
+// their own tree
+type Pair struct {
+	ID    string `json:"id"`
+	Lanes [2]int `json:"lanes"` // Track lanes raced as the pair's left and right lane
+}
+
+// DefaultPairs pairs a track's lanes in order: lanes 1 and 2 are pair "A",
+// lanes 3 and 4 pair "B", and so on
+func DefaultPairs(laneCount int) []Pair {
+	var pairs []Pair
+	for lane := 1; lane+1 <= laneCount; lane += 2 {
+		pairs = append(pairs, Pair{ID: string(rune('A' + len(pairs))), Lanes: [2]int{lane, lane + 1}})
+	}
+	return pairs
+}
+
+// PairRaceID returns the race ID of a pair's race in a group race
+func PairRaceID(raceID, pairID string) string {
+	return raceID + "-" + pairID
+}
+
+// PairRace is one pair's race in a group: its own tree, timing system,
+// auto-start and orchestrator, working in pair lanes 1 and 2. Its events
+// reach the group's bus with the pair's race ID, track lanes and a "pair"
+// data field.
+type PairRace struct {
+	Pair         Pair
+	RaceID       string
+	orchestrator *RaceOrchestrator
+	tree         *tree.ChristmasTree
+	timing       *timing.TimingSystem
+	autoStart    *autostart.AutoStartSystem // Nil without auto-start
+	eventBus     *events.EventBus           // The group's bus
+}
+
+// Orchestrator returns the pair's race orchestrator. It works in pair
+// lanes: 1 is the pair's left lane and 2 its right.
+func (pr *PairRace) Orchestrator() *RaceOrchestrator {
+	return pr.orchestrator
+}
+
+// AutoStart returns the pair's auto-start system, nil when the group runs
+// without auto-start
+func (pr *PairRace) AutoStart() *autostart.AutoStartSystem {
+	return pr.autoStart
+}
+
+// TrackLane returns the track lane of a pair lane (1 or 2), or 0
+func (pr *PairRace) TrackLane(pairLane int) int {
+	if pairLane < 1 || pairLane > 2 {
+		return 0
+	}
+	return pr.Pair.Lanes[pairLane-1]
+}
+
+// pairLane returns the pair lane of a track lane, or 0
+func (pr *PairRace) pairLane(trackLane int) int {
+	for i, lane := range pr.Pair.Lanes {
+		if lane == trackLane {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// Results returns the pair's timing results by track lane
+func (pr *PairRace) Results() map[int]*timing.TimingResults {
+	return pr.trackResults(pr.orchestrator.GetResults())
+}
+
+// Decision returns the pair's decision with its winner's track lane
+func (pr *PairRace) Decision() results.Decision {
+	return pr.trackDecision(pr.orchestrator.GetDecision())
+}
+
+func (pr *PairRace) trackResults(byPairLane map[int]*timing.TimingResults) map[int]*timing.TimingResults {
+	byTrackLane := make(map[int]*timing.TimingResults, len(byPairLane))
+	for lane, result := range byPairLane {
+		if result == nil {
+			continue
+		}
+		copied := *result
+		copied.Lane = pr.TrackLane(lane)
+		byTrackLane[copied.Lane] = &copied
+	}
+	return byTrackLane
+}
+
+func (pr *PairRace) trackDecision(decision results.Decision) results.Decision {
+	decision.WinnerLane = pr.TrackLane(decision.WinnerLane)
+	degraded := make([]results.DegradedRun, len(decision.Degraded))
+	for i, run := range decision.Degraded {
+		run.Lane = pr.TrackLane(run.Lane)
+		degraded[i] = run
+	}
+	if decision.Degraded != nil {
+		decision.Degraded = degraded
+	}
+	return decision
+}
+
+// PairGroup races a track of four (or more) lanes as pairs run at the same
+// time, each on its own tree sequence with its own auto-start, under one
+// coordinator. The pairs share the track's hardware map: beams and bulbs
+// are wired by track lane, and the group routes each channel to its pair.
+type PairGroup struct {
+	mu        sync.RWMutex
+	pairs     []Pair
+	config    config.Config
+	eventBus  *events.EventBus
+	raceID    string
+	clock     timers.Clock         // Nil runs on the default wheel
+	logger    *slog.Logger         // Nil logs to logs.Default
+	simulator simulation.Simulator // Nil runs from real beam input
+
+	// autoStart configures each pair's auto-start; nil races without it,
+	// starting each tree once its pair is staged
+	autoStart *autostart.AutoStartConfig
+
+	preStaging PreStagingConfig // Each pair's burnout, backup and approach
+
+	races  []*PairRace
+	byLane map[int]*PairRace // Track lane -> pair
+}
+
+// NewPairGroup creates a group racing pairs, DefaultPairs of the track's
+// lanes when pairs is empty
+func NewPairGroup(pairs []Pair) *PairGroup {
+	return &PairGroup{
+		pairs:     pairs,
+		simulator: simulation.Reference(),
+		byLane:    make(map[int]*PairRace),
+	}
+}
+
+// SetEventBus sets the bus the pairs' events are published on
+func (g *PairGroup) SetEventBus(eventBus *events.EventBus) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.eventBus = eventBus
+}
+
+// SetRaceID sets the group's race ID; each pair races as PairRaceID
+func (g *PairGroup) SetRaceID(raceID string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.raceID = raceID
+}
+
+// SetClock runs the pairs on clock instead of the default wheel. Call it
+// before Initialize.
+func (g *PairGroup) SetClock(clock timers.Clock) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.clock = clock
+}
+
+// SetLogger logs the pairs to logger instead of logs.Default. Call it
+// before Initialize.
+func (g *PairGroup) SetLogger(logger *slog.Logger) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.logger = logger
+}
+
+// SetSimulator chooses how the pairs' vehicles stage and run, as
+// RaceOrchestrator.SetSimulator. Lanes are the pair lanes 1 and 2. Call it
+// before Initialize.
+func (g *PairGroup) SetSimulator(sim simulation.Simulator) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.simulator = sim
+}
+
+// SetAutoStart gives each pair an auto-start system with cfg, which holds
+// the pair's tree until its pair has staged, waited out cfg's minimum
+// staging time and random delay. Pass nil to start trees as soon as their
+// pair is staged. Call it before Initialize.
+func (g *PairGroup) SetAutoStart(cfg *autostart.AutoStartConfig) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.autoStart = cfg
+}
+
+// SetPreStaging sets the burnout, backup and approach each pair runs
+// before staging. Auto-start does not see a car crossing the staging beams
+// in its burnout. Call it before Initialize.
+func (g *PairGroup) SetPreStaging(cfg PreStagingConfig) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.preStaging = cfg
+}
+
+// Initialize builds each pair's components on cfg's track
+func (g *PairGroup) Initialize(ctx context.Context, cfg config.Config) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	laneCount := cfg.Track().LaneCount
+	pairs := g.pairs
+	if len(pairs) == 0 {
+		pairs = DefaultPairs(laneCount)
+	}
+	if len(pairs) == 0 {
+		return fmt.Errorf("a %d lane track has no pairs", laneCount)
+	}
+	seen := make(map[string]bool, len(pairs))
+	for _, pair := range pairs {
+		if pair.ID == "" || seen[pair.ID] {
+			return fmt.Errorf("pair IDs must be set and unique, got %q", pair.ID)
+		}
+		seen[pair.ID] = true
+		for _, lane := range pair.Lanes {
+			if lane < 1 || lane > laneCount {
+				return fmt.Errorf("pair %s: lane %d is not on the track", pair.ID, lane)
+			}
+			if _, taken := g.byLane[lane]; taken {
+				return fmt.Errorf("pair %s: lane %d is already in a pair", pair.ID, lane)
+			}
+		}
+		if pair.Lanes[0] == pair.Lanes[1] {
+			return fmt.Errorf("pair %s: lanes must differ", pair.ID)
+		}
+
+		pr, err := g.newPairRace(ctx, cfg, pair)
+		if err != nil {
+			return fmt.Errorf("pair %s: %v", pair.ID, err)
+		}
+		g.races = append(g.races, pr)
+		for _, lane := range pair.Lanes {
+			g.byLane[lane] = pr
+		}
+	}
+	g.pairs = pairs
+	g.config = cfg
+	return nil
+}
+
+// newPairRace builds a pair's components on a private bus forwarding to
+// the group's. Must be called with g.mu held.
+func (g *PairGroup) newPairRace(ctx context.Context, cfg config.Config, pair Pair) (*PairRace, error) {
+	pr := &PairRace{
+		Pair:     pair,
+		RaceID:   PairRaceID(g.raceID, pair.ID),
+		tree:     tree.NewChristmasTree(),
+		timing:   timing.NewTimingSystemWithRaceID(""),
+		eventBus: g.eventBus,
+	}
+	private := events.NewEventBus(false)
+	private.SubscribeAll(pr.forward)
+
+	pr.orchestrator = NewRaceOrchestrator()
+	pr.orchestrator.SetEventBus(private)
+	pr.orchestrator.SetRaceID(pr.RaceID)
+	pr.orchestrator.SetSimulator(g.simulator)
+	pr.orchestrator.SetPreStaging(g.preStaging)
+	if g.clock != nil {
+		pr.orchestrator.SetClock(g.clock)
+	}
+	if g.logger != nil {
+		pr.orchestrator.SetLogger(g.logger)
+	}
+	pairConfig := pairConfig{Config: cfg, pair: pair}
+	if err := pr.orchestrator.Initialize(ctx, []component.Component{pr.timing, pr.tree}, pairConfig); err != nil {
+		return nil, err
+	}
+
+	if g.autoStart != nil {
+		pr.autoStart = autostart.NewAutoStartSystem(private)
+		if g.clock != nil {
+			pr.autoStart.SetClock(g.clock)
+		}
+		if g.logger != nil {
+			pr.autoStart.SetLogger(g.logger)
+		}
+		if err := pr.autoStart.Initialize(ctx, pairConfig); err != nil {
+			return nil, err
+		}
+		pr.autoStart.UpdateConfiguration(*g.autoStart)
+		pr.autoStart.SetTreeComponent(pr.tree)
+		pr.autoStart.SetTreeTriggerHandler(pr.orchestrator.TriggerTree)
+		pr.autoStart.SetStagingTimeoutHandler(func(lane int, elapsed time.Duration) {
+			if err := pr.orchestrator.StagingTimeoutFoul(lane, elapsed); err != nil {
+				pr.orchestrator.log().Warn("⚠️ Staging timeout foul not recorded", logs.KeyLane, lane, "error", err)
+			}
+		})
+		if err := pr.autoStart.Start(ctx); err != nil {
+			return nil, err
+		}
+		pr.orchestrator.SetStarterOverride(true)
+
+		// The tree publishes its staging bulbs holding its lock, and
+		// auto-start reads the tree, so follow them off the bus
+		update := func(e events.Event) { go pr.updateAutoStart() }
+		private.Subscribe(events.EventTreePreStage, update)
+		private.Subscribe(events.EventTreeStage, update)
+	}
+	return pr, nil
+}
+
+// updateAutoStart passes the pair's staging bulbs to its auto-start
+func (pr *PairRace) updateAutoStart() {
+	status := pr.tree.GetTreeStatus()
+	for lane := 1; lane <= 2; lane++ {
+		lights := status.LightStates[lane]
+		pr.autoStart.UpdateVehicleStaging(lane, lights[tree.LightPreStage] == tree.LightOn, lights[tree.LightStage] == tree.LightOn, 0)
+	}
+}
+
+// forward publishes a pair's event on the group's bus in track lanes
+func (pr *PairRace) forward(e events.Event) {
+	if pr.eventBus == nil {
+		return
+	}
+
+	if e.RaceID == "" {
+		e.RaceID = pr.RaceID // Auto-start events carry no race
+	}
+	e.Lane = pr.TrackLane(e.Lane)
+	data := make(map[string]interface{}, len(e.Data)+1)
+	for key, value := range e.Data {
+		switch v := value.(type) {
+		case []int:
+			if key == "lanes" {
+				lanes := make([]int, len(v))
+				for i, lane := range v {
+					lanes[i] = pr.TrackLane(lane)
+				}
+				value = lanes
+			}
+		case int:
+			switch key {
+			case "winner_lane", "leader_lane", "trailing_lane":
+				value = pr.TrackLane(v)
+			}
+		case map[int]*timing.TimingResults:
+			value = pr.trackResults(v)
+		case results.Decision:
+			value = pr.trackDecision(v)
+		}
+		data[key] = value
+	}
+	data["pair"] = pr.Pair.ID
+	e.Data = data
+	pr.eventBus.Publish(e)
+}
+
+// StartRace starts every pair's race
+func (g *PairGroup) StartRace() error {
+	for _, pr := range g.Races() {
+		if err := pr.orchestrator.StartRace(vehicle.NewSimpleVehicle(1), vehicle.NewSimpleVehicle(2)); err != nil {
+			return fmt.Errorf("pair %s: %v", pr.Pair.ID, err)
+		}
+	}
+	return nil
+}
+
+// Races returns the pairs' races in pair order
+func (g *PairGroup) Races() []*PairRace {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return append([]*PairRace(nil), g.races...)
+}
+
+// Race returns a pair's race
+func (g *PairGroup) Race(pairID string) (*PairRace, bool) {
+	for _, pr := range g.Races() {
+		if pr.Pair.ID == pairID {
+			return pr, true
+		}
+	}
+	return nil, false
+}
+
+// RaceForLane returns the race of the pair a track lane is in, and the
+// lane's pair lane
+func (g *PairGroup) RaceForLane(lane int) (*PairRace, int, bool) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	pr, ok := g.byLane[lane]
+	if !ok {
+		return nil, 0, false
+	}
+	return pr, pr.pairLane(lane), true
+}
+
+// SetStagingBeam passes a pre-stage or stage beam change in a track lane to
+// its pair's tree
+func (g *PairGroup) SetStagingBeam(lane int, beamID beam.BeamID, broken bool) error {
+	pr, pairLane, ok := g.RaceForLane(lane)
+	if !ok {
+		return fmt.Errorf("lane %d is not in a pair", lane)
+	}
+	return pr.orchestrator.SetStagingBeam(pairLane, beamID, broken)
+}
+
+// TriggerBeam reports a timing beam crossing in a track lane to its pair,
+// at the time the beam saw it, or now when at is zero
+func (g *PairGroup) TriggerBeam(lane int, beamID string, at time.Time) error {
+	pr, pairLane, ok := g.RaceForLane(lane)
+	if !ok {
+		return fmt.Errorf("lane %d is not in a pair", lane)
+	}
+	return pr.orchestrator.TriggerBeam(pairLane, beamID, at)
+}
+
+// TriggerChannel reports a controller channel change through the track's
+// hardware map, correcting its calibrated latency. Staging beams light
+// their pair's tree; the others time its race when broken. A tripped
+// boundary sensor reports a boundary violation in its pair's race.
+func (g *PairGroup) TriggerChannel(channel int, broken bool, at time.Time) error {
+	g.mu.RLock()
+	cfg := g.config
+	g.mu.RUnlock()
+	if cfg == nil {
+		return fmt.Errorf("pair group is not initialized")
+	}
+	wiring, ok := cfg.Track().Hardware.Lookup(channel)
+	if !ok || (wiring.Kind != config.ChannelBeam && wiring.Kind != config.ChannelBoundary) {
+		return fmt.Errorf("channel %d is not wired to a beam or boundary sensor", channel)
+	}
+	if !at.IsZero() {
+		at = wiring.Correct(at)
+	}
+
+	if wiring.Kind == config.ChannelBoundary {
+		if !broken {
+			return nil
+		}
+		pr, pairLane, ok := g.RaceForLane(wiring.Lane)
+		if !ok {
+			return fmt.Errorf("lane %d is not in a pair", wiring.Lane)
+		}
+		return pr.orchestrator.ReportBoundarySensor(pairLane, wiring.ID, at)
+	}
+
+	switch beam.BeamID(wiring.ID) {
+	case beam.BeamPreStage, beam.BeamStage:
+		return g.SetStagingBeam(wiring.Lane, beam.BeamID(wiring.ID), broken)
+	}
+	if !broken {
+		return nil
+	}
+	return g.TriggerBeam(wiring.Lane, wiring.ID, at)
+}
+
+// Abort stops every pair's auto-start and aborts its race still running.
+// Once it returns no countdown or staging timeout fires for any pair.
+func (g *PairGroup) Abort(reason string) {
+	for _, pr := range g.Races() {
+		if pr.autoStart != nil {
+			pr.autoStart.Stop(context.Background())
+		}
+		pr.orchestrator.Abort(reason)
+	}
+}
+
+// Results returns every pair's timing results by track lane
+func (g *PairGroup) Results() map[int]*timing.TimingResults {
+	all := make(map[int]*timing.TimingResults)
+	for _, pr := range g.Races() {
+		for lane, result := range pr.Results() {
+			all[lane] = result
+		}
+	}
+	return all
+}
+
+// Decisions returns each pair's decision by pair ID
+func (g *PairGroup) Decisions() map[string]results.Decision {
+	decisions := make(map[string]results.Decision)
+	for _, pr := range g.Races() {
+		decisions[pr.Pair.ID] = pr.Decision()
+	}
+	return decisions
+}
+
+// IsComplete reports whether every pair's race is complete
+func (g *PairGroup) IsComplete() bool {
+	for _, pr := range g.Races() {
+		if !pr.orchestrator.IsRaceComplete() {
+			return false
+		}
+	}
+	return true
+}
+
+// Stop stops every pair's auto-start and race. Once it returns no pair's
+// tree changes a bulb and no lane is timed.
+func (g *PairGroup) Stop() {
+	for _, pr := range g.Races() {
+		if pr.autoStart != nil {
+			pr.autoStart.Stop(context.Background())
+		}
+		pr.orchestrator.Stop()
+	}
+}
+
+// pairConfig is the track as one pair sees it: two lanes, with the beams
+// and bulbs wired to the pair's track lanes
+type pairConfig struct {
+	config.Config
+	pair Pair
+}
+
+func (c pairConfig) Track() config.TrackConfig {
+	track := c.Config.Track()
+	pairLane := func(lane int) int {
+		for i, l := range c.pair.Lanes {
+			if l == lane {
+				return i + 1
+			}
+		}
+		return 0
+	}
+
+	layout := make(map[string]config.BeamConfig, len(track.BeamLayout))
+	for id, beamConfig := range track.BeamLayout {
+		if beamConfig.Lane != 0 {
+			if beamConfig.Lane = pairLane(beamConfig.Lane); beamConfig.Lane == 0 {
+				continue
+			}
+		}
+		layout[id] = beamConfig
+	}
+	channels := make(map[int]config.HardwareChannel)
+	for channel, wiring := range track.Hardware.Channels {
+		if wiring.Lane = pairLane(wiring.Lane); wiring.Lane != 0 {
+			channels[channel] = wiring
+		}
+	}
+
+	track.LaneCount = 2
+	track.BeamLayout = layout
+	track.Hardware.Channels = channels
+	return track
+}
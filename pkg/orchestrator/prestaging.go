@@ -0,0 +1,217 @@
+package orchestrator
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/benharold/libdrag/pkg/beam"
+	"github.com/benharold/libdrag/pkg/events"
+	"github.com/benharold/libdrag/pkg/timers"
+	"github.com/benharold/libdrag/pkg/tree"
+)
+
+// PreStagingConfig sets the phases a race runs between rounds, before
+// staging: the burnout, backing up to the starting line, and the approach
+// to the staging beams. Each duration is the longest its phase runs; the
+// starter can end a phase early with AdvancePhase. A zero duration skips
+// the phase, so the zero config goes straight to staging.
+type PreStagingConfig struct {
+	Burnout  time.Duration `json:"burnout"`
+	Backup   time.Duration `json:"backup"`
+	Approach time.Duration `json:"approach"`
+}
+
+// phases returns the configured phases in order
+func (c PreStagingConfig) phases() []preStagingPhase {
+	var phases []preStagingPhase
+	for _, phase := range []preStagingPhase{
+		{RaceStateBurnout, events.EventRaceBurnout, c.Burnout},
+		{RaceStateBackup, events.EventRaceBackup, c.Backup},
+		{RaceStateApproach, events.EventRaceApproach, c.Approach},
+	} {
+		if phase.duration > 0 {
+			phases = append(phases, phase)
+		}
+	}
+	return phases
+}
+
+// preStagingPhase is one phase of a race's pre-staging
+type preStagingPhase struct {
+	state     RaceState
+	eventType events.EventType
+	duration  time.Duration
+}
+
+// SetPreStaging sets the phases the next race runs before staging
+func (ro *RaceOrchestrator) SetPreStaging(cfg PreStagingConfig) {
+	ro.mu.Lock()
+	defer ro.mu.Unlock()
+	ro.preStaging = cfg
+}
+
+// firstState returns the state a race starts in: its first pre-staging
+// phase, or staging. Caller holds ro.mu.
+func (ro *RaceOrchestrator) firstState() RaceState {
+	if phases := ro.preStaging.phases(); len(phases) > 0 {
+		return phases[0].state
+	}
+	return RaceStateStaging
+}
+
+// inBurnout reports whether state is a phase in which the car may cross the
+// staging beams without approaching them
+func inBurnout(state RaceState) bool {
+	return state == RaceStateBurnout || state == RaceStateBackup
+}
+
+// runPreStaging runs the race's pre-staging phases in order, then moves it
+// to staging. It returns false if the race was aborted meanwhile.
+func (ro *RaceOrchestrator) runPreStaging() bool {
+	ro.mu.RLock()
+	phases := ro.preStaging.phases()
+	ro.mu.RUnlock()
+
+	for _, phase := range phases {
+		if !ro.runPhase(phase) {
+			return false
+		}
+	}
+
+	ro.mu.Lock()
+	if ro.status.State == RaceStateAborted {
+		ro.mu.Unlock()
+		return false
+	}
+	ro.status.State = RaceStateStaging
+	ro.status.PhaseEnds = time.Time{}
+	held := ro.takeHeldStaging()
+	ro.mu.Unlock()
+
+	ro.applyStaging(held)
+	return true
+}
+
+// runPhase enters a phase and waits for it to end: its duration passes, the
+// starter advances it or, approaching, a car pre-stages
+func (ro *RaceOrchestrator) runPhase(phase preStagingPhase) bool {
+	ro.mu.Lock()
+	if ro.status.State == RaceStateAborted {
+		ro.mu.Unlock()
+		return false
+	}
+	ends := timers.Or(ro.clock).Now().Add(phase.duration)
+	ro.status.State = phase.state
+	ro.status.PhaseEnds = ends
+	ro.advancePhase = false
+	var held []stagingChange
+	if !inBurnout(phase.state) {
+		held = ro.takeHeldStaging()
+	}
+	ro.mu.Unlock()
+	ro.applyStaging(held)
+
+	if ro.eventBus != nil {
+		ro.eventBus.Publish(
+			events.NewEvent(phase.eventType).
+				WithRaceID(ro.raceID).
+				WithData("duration", phase.duration).
+				WithData("ends", ends).
+				Build(),
+		)
+	}
+	ro.log().Info("🔥 Pre-staging phase", "phase", phase.state)
+
+	for {
+		ro.mu.RLock()
+		aborted := ro.status.State == RaceStateAborted
+		advanced := ro.advancePhase
+		ro.mu.RUnlock()
+
+		if aborted {
+			return false
+		}
+		if advanced || !timers.Or(ro.clock).Now().Before(ends) {
+			return true
+		}
+		if phase.state == RaceStateApproach && ro.preStaged() {
+			return true
+		}
+		if !ro.sleep(10*time.Millisecond, "orchestrator."+string(phase.state)) {
+			return false
+		}
+	}
+}
+
+// preStaged reports whether any lane has lit its pre-stage bulb
+func (ro *RaceOrchestrator) preStaged() bool {
+	for _, lights := range ro.christmasTree.GetTreeStatus().LightStates {
+		if lights[tree.LightPreStage] == tree.LightOn {
+			return true
+		}
+	}
+	return false
+}
+
+// AdvancePhase ends the race's current pre-staging phase early, say when
+// the starter sees a car finish its burnout
+func (ro *RaceOrchestrator) AdvancePhase() error {
+	ro.mu.Lock()
+	defer ro.mu.Unlock()
+
+	switch ro.status.State {
+	case RaceStateBurnout, RaceStateBackup, RaceStateApproach:
+		ro.advancePhase = true
+		return nil
+	}
+	return fmt.Errorf("race is %s, not in a pre-staging phase", ro.status.State)
+}
+
+// holdStaging keeps a staging beam change seen during the burnout or backup
+// from the tree, to be passed on once the car approaches. Caller holds
+// ro.mu.
+func (ro *RaceOrchestrator) holdStaging(lane int, beamID beam.BeamID, broken bool) {
+	if ro.heldStaging == nil {
+		ro.heldStaging = make(map[int]map[beam.BeamID]bool)
+	}
+	if ro.heldStaging[lane] == nil {
+		ro.heldStaging[lane] = make(map[beam.BeamID]bool)
+	}
+	ro.heldStaging[lane][beamID] = broken
+}
+
+// stagingChange is a staging beam broken during the burnout or backup
+type stagingChange struct {
+	lane   int
+	beamID beam.BeamID
+}
+
+// takeHeldStaging returns the staging beams the burnout left broken, for
+// the tree to light once the car approaches; a car that crossed a beam and
+// backed out of it lights nothing. Caller holds ro.mu.
+func (ro *RaceOrchestrator) takeHeldStaging() []stagingChange {
+	lanes := make([]int, 0, len(ro.heldStaging))
+	for lane := range ro.heldStaging {
+		lanes = append(lanes, lane)
+	}
+	sort.Ints(lanes)
+
+	var changes []stagingChange
+	for _, lane := range lanes {
+		for _, beamID := range []beam.BeamID{beam.BeamPreStage, beam.BeamStage} {
+			if ro.heldStaging[lane][beamID] {
+				changes = append(changes, stagingChange{lane, beamID})
+			}
+		}
+	}
+	ro.heldStaging = nil
+	return changes
+}
+
+// applyStaging lights the staging bulbs of beams broken during the burnout
+func (ro *RaceOrchestrator) applyStaging(changes []stagingChange) {
+	for _, change := range changes {
+		ro.setStagingBulb(change.lane, change.beamID, true)
+	}
+}
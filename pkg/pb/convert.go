@@ -0,0 +1,406 @@
+package pb
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/benharold/libdrag/pkg/component"
+	"github.com/benharold/libdrag/pkg/config"
+	"github.com/benharold/libdrag/pkg/events"
+	"github.com/benharold/libdrag/pkg/orchestrator"
+	"github.com/benharold/libdrag/pkg/results"
+	"github.com/benharold/libdrag/pkg/timers"
+	"github.com/benharold/libdrag/pkg/timing"
+	"github.com/benharold/libdrag/pkg/tree"
+)
+
+// FromEvent converts an event to its wire form. Event data is encoded as
+// JSON, so numeric values decode as float64 just as with the JSON feeds.
+func FromEvent(event events.Event) (*Event, error) {
+	m := &Event{
+		Type:              string(event.Type),
+		TimestampUnixNano: unixNano(event.Timestamp),
+		RaceID:            event.RaceID,
+		Lane:              int32(event.Lane),
+		External:          event.External,
+	}
+	if len(event.Data) > 0 {
+		data, err := json.Marshal(event.Data)
+		if err != nil {
+			return nil, err
+		}
+		m.DataJSON = data
+	}
+	return m, nil
+}
+
+// ToEvent converts a wire event back to an events.Event
+func (m *Event) ToEvent() (events.Event, error) {
+	event := events.Event{
+		Type:      events.EventType(m.Type),
+		Timestamp: fromUnixNano(m.TimestampUnixNano),
+		RaceID:    m.RaceID,
+		Lane:      int(m.Lane),
+		Data:      make(map[string]interface{}),
+		External:  m.External,
+	}
+	if len(m.DataJSON) > 0 {
+		if err := json.Unmarshal(m.DataJSON, &event.Data); err != nil {
+			return events.Event{}, err
+		}
+	}
+	return event, nil
+}
+
+// FromTimingResults converts a lane's timing results to wire form
+func FromTimingResults(results *timing.TimingResults) *TimingResults {
+	m := &TimingResults{
+		Lane:              int32(results.Lane),
+		StartTimeUnixNano: unixNano(results.StartTime),
+		ReactionTime:      copyFloat(results.ReactionTime),
+		SixtyFootTime:     copyFloat(results.SixtyFootTime),
+		EighthMileTime:    copyFloat(results.EighthMileTime),
+		QuarterMileTime:   copyFloat(results.QuarterMileTime),
+		TrapSpeed:         copyFloat(results.TrapSpeed),
+		IsComplete:        results.IsComplete,
+		IsFoul:            results.IsFoul,
+		FoulReason:        results.FoulReason,
+		PerfectLight:      results.PerfectLight,
+		ThreeThirtyTime:   copyFloat(results.ThreeThirtyTime),
+		EighthMileSpeed:   copyFloat(results.EighthMileSpeed),
+		ThousandFtTime:    copyFloat(results.ThousandFtTime),
+		DialIn:            copyFloat(results.DialIn),
+		StartDelay:        results.StartDelay,
+		Breakout:          results.Breakout,
+		TechReview:        append([]string(nil), results.TechReview...),
+	}
+	if len(results.BeamTriggers) > 0 {
+		m.BeamTriggersUnixNano = make(map[string]int64, len(results.BeamTriggers))
+		for beam, at := range results.BeamTriggers {
+			m.BeamTriggersUnixNano[beam] = unixNano(at)
+		}
+	}
+	if manual := results.Manual; manual != nil {
+		m.Manual = &Provenance{
+			EnteredBy:         manual.EnteredBy,
+			Method:            manual.Method,
+			Reason:            manual.Reason,
+			EnteredAtUnixNano: unixNano(manual.EnteredAt),
+			Fields:            append([]string(nil), manual.Fields...),
+		}
+	}
+	if len(results.Timestamps) > 0 {
+		m.Timestamps = make(map[string]Accuracy, len(results.Timestamps))
+		for beam, accuracy := range results.Timestamps {
+			m.Timestamps[beam] = Accuracy{Source: string(accuracy.Source), Uncertainty: accuracy.Uncertainty}
+		}
+	}
+	if len(results.ShutdownSpeeds) > 0 {
+		m.ShutdownSpeeds = make(map[string]float64, len(results.ShutdownSpeeds))
+		for beam, speed := range results.ShutdownSpeeds {
+			m.ShutdownSpeeds[beam] = speed
+		}
+	}
+	if profile := results.TreeProfile; profile != nil {
+		m.TreeProfile = &TreeProfile{
+			Type:                 string(profile.Type),
+			Preset:               string(profile.Preset),
+			AmberDelayNanos:      int64(profile.AmberDelay),
+			GreenDelayNanos:      int64(profile.GreenDelay),
+			PreStageTimeoutNanos: int64(profile.PreStageTimeout),
+			StageTimeoutNanos:    int64(profile.StageTimeout),
+			ArmDelayMinNanos:     int64(profile.ArmDelayMin),
+			ArmDelayMaxNanos:     int64(profile.ArmDelayMax),
+		}
+	}
+	for _, mark := range results.SyncMarks {
+		m.SyncMarks = append(m.SyncMarks, SyncMark{
+			Source:         mark.Source,
+			Label:          mark.Label,
+			Lane:           int32(mark.Lane),
+			AtUnixNano:     unixNano(mark.At),
+			Frame:          mark.Frame,
+			MediaTimeNanos: int64(mark.MediaTime),
+		})
+	}
+	if results.GuardTrip != nil {
+		m.GuardTripUnixNano = unixNano(*results.GuardTrip)
+	}
+	return m
+}
+
+// ToTimingResults converts wire timing results back to timing.TimingResults
+func (m *TimingResults) ToTimingResults() *timing.TimingResults {
+	results := &timing.TimingResults{
+		Lane:            int(m.Lane),
+		StartTime:       fromUnixNano(m.StartTimeUnixNano),
+		ReactionTime:    copyFloat(m.ReactionTime),
+		SixtyFootTime:   copyFloat(m.SixtyFootTime),
+		EighthMileTime:  copyFloat(m.EighthMileTime),
+		QuarterMileTime: copyFloat(m.QuarterMileTime),
+		TrapSpeed:       copyFloat(m.TrapSpeed),
+		IsComplete:      m.IsComplete,
+		IsFoul:          m.IsFoul,
+		FoulReason:      m.FoulReason,
+		PerfectLight:    m.PerfectLight,
+		ThreeThirtyTime: copyFloat(m.ThreeThirtyTime),
+		EighthMileSpeed: copyFloat(m.EighthMileSpeed),
+		ThousandFtTime:  copyFloat(m.ThousandFtTime),
+		DialIn:          copyFloat(m.DialIn),
+		StartDelay:      m.StartDelay,
+		Breakout:        m.Breakout,
+		BeamTriggers:    make(map[string]time.Time, len(m.BeamTriggersUnixNano)),
+		TechReview:      append([]string(nil), m.TechReview...),
+	}
+	for beam, at := range m.BeamTriggersUnixNano {
+		results.BeamTriggers[beam] = fromUnixNano(at)
+	}
+	if manual := m.Manual; manual != nil {
+		results.Manual = &timing.Provenance{
+			EnteredBy: manual.EnteredBy,
+			Method:    manual.Method,
+			Reason:    manual.Reason,
+			EnteredAt: fromUnixNano(manual.EnteredAtUnixNano),
+			Fields:    append([]string(nil), manual.Fields...),
+		}
+	}
+	if len(m.Timestamps) > 0 {
+		results.Timestamps = make(map[string]timers.Accuracy, len(m.Timestamps))
+		for beam, accuracy := range m.Timestamps {
+			results.Timestamps[beam] = timers.Accuracy{Source: timers.Source(accuracy.Source), Uncertainty: accuracy.Uncertainty}
+		}
+	}
+	if len(m.ShutdownSpeeds) > 0 {
+		results.ShutdownSpeeds = make(map[string]float64, len(m.ShutdownSpeeds))
+		for beam, speed := range m.ShutdownSpeeds {
+			results.ShutdownSpeeds[beam] = speed
+		}
+	}
+	if profile := m.TreeProfile; profile != nil {
+		results.TreeProfile = &config.TreeSequenceConfig{
+			Type:            config.TreeSequenceType(profile.Type),
+			Preset:          config.TreePreset(profile.Preset),
+			AmberDelay:      time.Duration(profile.AmberDelayNanos),
+			GreenDelay:      time.Duration(profile.GreenDelayNanos),
+			PreStageTimeout: time.Duration(profile.PreStageTimeoutNanos),
+			StageTimeout:    time.Duration(profile.StageTimeoutNanos),
+			ArmDelayMin:     time.Duration(profile.ArmDelayMinNanos),
+			ArmDelayMax:     time.Duration(profile.ArmDelayMaxNanos),
+		}
+	}
+	for _, mark := range m.SyncMarks {
+		results.SyncMarks = append(results.SyncMarks, timing.SyncMark{
+			Source:    mark.Source,
+			Label:     mark.Label,
+			Lane:      int(mark.Lane),
+			At:        fromUnixNano(mark.AtUnixNano),
+			Frame:     mark.Frame,
+			MediaTime: time.Duration(mark.MediaTimeNanos),
+		})
+	}
+	if m.GuardTripUnixNano != 0 {
+		guardTrip := fromUnixNano(m.GuardTripUnixNano)
+		results.GuardTrip = &guardTrip
+	}
+	return results
+}
+
+// FromDecision converts a race decision to wire form. A zero margin is
+// omitted, as in the JSON feeds.
+func FromDecision(decision results.Decision) *Decision {
+	m := &Decision{
+		WinnerLane:      int32(decision.WinnerLane),
+		Reason:          decision.Reason,
+		UnderReview:     decision.UnderReview,
+		MarginUncertain: decision.MarginUncertain,
+	}
+	if decision.Margin != 0 {
+		margin := decision.Margin
+		m.Margin = &margin
+	}
+	return m
+}
+
+// ToDecision converts a wire decision back to results.Decision. The rule
+// chain, foul ruling and degraded lanes are not carried on the wire.
+func (m *Decision) ToDecision() results.Decision {
+	decision := results.Decision{
+		WinnerLane:      int(m.WinnerLane),
+		Reason:          m.Reason,
+		UnderReview:     m.UnderReview,
+		MarginUncertain: m.MarginUncertain,
+	}
+	if m.Margin != nil {
+		decision.Margin = *m.Margin
+	}
+	return decision
+}
+
+// FromTreeStatus converts a tree status to wire form. Lanes are sorted.
+func FromTreeStatus(status *tree.Status) *TreeStatus {
+	m := &TreeStatus{
+		Armed:                  status.Armed,
+		Activated:              status.Activated,
+		SequenceType:           string(status.SequenceType),
+		LastSequenceUnixNano:   unixNano(status.LastSequence),
+		ArmedTimeUnixNano:      unixNano(status.ArmedTime),
+		ActivationTimeUnixNano: unixNano(status.ActivationTime),
+		StabilityTimerUnixNano: unixNano(status.StabilityTimer),
+	}
+
+	lanes := make([]int, 0, len(status.LightStates))
+	for lane := range status.LightStates {
+		lanes = append(lanes, lane)
+	}
+	sort.Ints(lanes)
+	for _, lane := range lanes {
+		lights := make(map[string]string, len(status.LightStates[lane]))
+		for light, state := range status.LightStates[lane] {
+			lights[string(light)] = string(state)
+		}
+		sequence := status.Lanes[lane]
+		laneLights := LaneLights{Lane: int32(lane), Lights: lights, Phase: string(sequence.Phase), Step: int32(sequence.Step)}
+		for _, transition := range sequence.Transitions {
+			laneLights.Transitions = append(laneLights.Transitions, BulbTransition{
+				Light:        string(transition.Light),
+				State:        string(transition.State),
+				TimeUnixNano: unixNano(transition.Time),
+			})
+		}
+		m.Lanes = append(m.Lanes, laneLights)
+	}
+	return m
+}
+
+// ToTreeStatus converts a wire tree status back to tree.Status
+func (m *TreeStatus) ToTreeStatus() *tree.Status {
+	status := &tree.Status{
+		Armed:          m.Armed,
+		Activated:      m.Activated,
+		SequenceType:   config.TreeSequenceType(m.SequenceType),
+		LightStates:    make(map[int]map[tree.LightType]tree.LightState, len(m.Lanes)),
+		Lanes:          make(map[int]tree.LaneSequence, len(m.Lanes)),
+		LastSequence:   fromUnixNano(m.LastSequenceUnixNano),
+		ArmedTime:      fromUnixNano(m.ArmedTimeUnixNano),
+		ActivationTime: fromUnixNano(m.ActivationTimeUnixNano),
+		StabilityTimer: fromUnixNano(m.StabilityTimerUnixNano),
+	}
+	for _, lane := range m.Lanes {
+		lights := make(map[tree.LightType]tree.LightState, len(lane.Lights))
+		for light, state := range lane.Lights {
+			lights[tree.LightType(light)] = tree.LightState(state)
+		}
+		status.LightStates[int(lane.Lane)] = lights
+
+		sequence := tree.LaneSequence{Phase: tree.SequencePhase(lane.Phase), Step: int(lane.Step)}
+		for _, transition := range lane.Transitions {
+			sequence.Transitions = append(sequence.Transitions, tree.BulbTransition{
+				Light: tree.LightType(transition.Light),
+				State: tree.LightState(transition.State),
+				Time:  fromUnixNano(transition.TimeUnixNano),
+			})
+		}
+		status.Lanes[int(lane.Lane)] = sequence
+	}
+	return status
+}
+
+// FromRaceStatus converts a race status to wire form
+func FromRaceStatus(status orchestrator.RaceStatus) (*RaceStatus, error) {
+	m := &RaceStatus{
+		State:             string(status.State),
+		StartTimeUnixNano: unixNano(status.StartTime),
+		LastError:         errorString(status.LastError),
+	}
+	for _, lane := range status.ActiveLanes {
+		m.ActiveLanes = append(m.ActiveLanes, int32(lane))
+	}
+	if len(status.Components) > 0 {
+		m.Components = make(map[string]ComponentStatus, len(status.Components))
+		for id, cs := range status.Components {
+			wire := ComponentStatus{
+				ID:        cs.ID,
+				Status:    cs.Status,
+				LastError: errorString(cs.LastError),
+			}
+			if len(cs.Metadata) > 0 {
+				metadata, err := json.Marshal(cs.Metadata)
+				if err != nil {
+					return nil, err
+				}
+				wire.MetadataJSON = metadata
+			}
+			m.Components[id] = wire
+		}
+	}
+	return m, nil
+}
+
+// ToRaceStatus converts a wire race status back to orchestrator.RaceStatus.
+// Errors are restored as plain errors carrying the original message.
+func (m *RaceStatus) ToRaceStatus() (orchestrator.RaceStatus, error) {
+	status := orchestrator.RaceStatus{
+		State:       orchestrator.RaceState(m.State),
+		StartTime:   fromUnixNano(m.StartTimeUnixNano),
+		Components:  make(map[string]component.ComponentStatus, len(m.Components)),
+		ActiveLanes: make([]int, 0, len(m.ActiveLanes)),
+		LastError:   stringError(m.LastError),
+	}
+	for _, lane := range m.ActiveLanes {
+		status.ActiveLanes = append(status.ActiveLanes, int(lane))
+	}
+	for id, wire := range m.Components {
+		cs := component.ComponentStatus{
+			ID:        wire.ID,
+			Status:    wire.Status,
+			LastError: stringError(wire.LastError),
+			Metadata:  make(map[string]interface{}),
+		}
+		if len(wire.MetadataJSON) > 0 {
+			if err := json.Unmarshal(wire.MetadataJSON, &cs.Metadata); err != nil {
+				return orchestrator.RaceStatus{}, err
+			}
+		}
+		status.Components[id] = cs
+	}
+	return status, nil
+}
+
+// unixNano maps the zero time to 0 so unset times are omitted on the wire
+func unixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+func fromUnixNano(ns int64) time.Time {
+	if ns == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, ns)
+}
+
+func copyFloat(v *float64) *float64 {
+	if v == nil {
+		return nil
+	}
+	c := *v
+	return &c
+}
+
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+func stringError(s string) error {
+	if s == "" {
+		return nil
+	}
+	return errors.New(s)
+}
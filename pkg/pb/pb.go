@@ -0,0 +1,923 @@
+// Package pb provides compact binary encodings of libdrag events and race
+// state using the protobuf schemas in proto/libdrag/v1/libdrag.proto.
+//
+// The message types are written by hand to match the schema so the library
+// keeps zero protobuf dependencies; the bytes they produce are standard
+// protobuf and interoperate with code generated from the .proto file in any
+// language. Unknown fields are skipped when decoding, so older readers accept
+// messages from newer writers.
+package pb
+
+import (
+	"sort"
+)
+
+// Event is the wire form of events.Event
+type Event struct {
+	Type              string
+	TimestampUnixNano int64
+	RaceID            string
+	Lane              int32
+	DataJSON          []byte
+	External          map[string]string
+}
+
+// TimingResults is the wire form of timing.TimingResults
+type TimingResults struct {
+	Lane                 int32
+	StartTimeUnixNano    int64
+	ReactionTime         *float64
+	SixtyFootTime        *float64
+	EighthMileTime       *float64
+	QuarterMileTime      *float64
+	TrapSpeed            *float64
+	IsComplete           bool
+	IsFoul               bool
+	FoulReason           string
+	BeamTriggersUnixNano map[string]int64
+	PerfectLight         bool
+	ThreeThirtyTime      *float64
+	EighthMileSpeed      *float64
+	ThousandFtTime       *float64
+	DialIn               *float64
+	StartDelay           float64
+	Breakout             bool
+	Manual               *Provenance
+	Timestamps           map[string]Accuracy
+	ShutdownSpeeds       map[string]float64
+	TreeProfile          *TreeProfile
+	SyncMarks            []SyncMark
+	TechReview           []string
+	GuardTripUnixNano    int64
+}
+
+// Provenance is the wire form of timing.Provenance
+type Provenance struct {
+	EnteredBy         string
+	Method            string
+	Reason            string
+	EnteredAtUnixNano int64
+	Fields            []string
+}
+
+// Accuracy is the wire form of timers.Accuracy
+type Accuracy struct {
+	Source      string
+	Uncertainty float64
+}
+
+// TreeProfile is the wire form of config.TreeSequenceConfig, with
+// durations in nanoseconds
+type TreeProfile struct {
+	Type                 string
+	Preset               string
+	AmberDelayNanos      int64
+	GreenDelayNanos      int64
+	PreStageTimeoutNanos int64
+	StageTimeoutNanos    int64
+	ArmDelayMinNanos     int64
+	ArmDelayMaxNanos     int64
+}
+
+// SyncMark is the wire form of timing.SyncMark
+type SyncMark struct {
+	Source         string
+	Label          string
+	Lane           int32
+	AtUnixNano     int64
+	Frame          int64
+	MediaTimeNanos int64
+}
+
+// Decision is the wire form of results.Decision
+type Decision struct {
+	WinnerLane      int32
+	Reason          string
+	Margin          *float64
+	UnderReview     bool
+	MarginUncertain bool
+}
+
+// LaneLights holds the light states and sequence progress for one lane of
+// the tree
+type LaneLights struct {
+	Lane        int32
+	Lights      map[string]string
+	Phase       string
+	Step        int32
+	Transitions []BulbTransition
+}
+
+// BulbTransition is the wire form of tree.BulbTransition
+type BulbTransition struct {
+	Light        string
+	State        string
+	TimeUnixNano int64
+}
+
+// TreeStatus is the wire form of tree.Status
+type TreeStatus struct {
+	Armed                  bool
+	Activated              bool
+	SequenceType           string
+	Lanes                  []LaneLights
+	LastSequenceUnixNano   int64
+	ArmedTimeUnixNano      int64
+	ActivationTimeUnixNano int64
+	StabilityTimerUnixNano int64
+}
+
+// ComponentStatus is the wire form of component.ComponentStatus
+type ComponentStatus struct {
+	ID           string
+	Status       string
+	LastError    string
+	MetadataJSON []byte
+}
+
+// RaceStatus is the wire form of orchestrator.RaceStatus
+type RaceStatus struct {
+	State             string
+	StartTimeUnixNano int64
+	Components        map[string]ComponentStatus
+	ActiveLanes       []int32
+	LastError         string
+}
+
+// Marshal encodes the event
+func (m *Event) Marshal() []byte {
+	var b []byte
+	b = appendString(b, 1, m.Type)
+	b = appendInt(b, 2, m.TimestampUnixNano)
+	b = appendString(b, 3, m.RaceID)
+	b = appendInt(b, 4, int64(m.Lane))
+	b = appendBytes(b, 5, m.DataJSON)
+	for _, name := range sortedKeys(m.External) {
+		var entry []byte
+		entry = appendString(entry, 1, name)
+		entry = appendString(entry, 2, m.External[name])
+		b = appendField(b, 6, entry)
+	}
+	return b
+}
+
+// Unmarshal decodes an event, replacing the contents of m
+func (m *Event) Unmarshal(b []byte) error {
+	*m = Event{}
+	d := decoder{b: b}
+	for !d.done() {
+		num, wireType, err := d.next()
+		if err != nil {
+			return err
+		}
+		switch num {
+		case 1:
+			m.Type, err = d.string(wireType)
+		case 2:
+			m.TimestampUnixNano, err = d.int(wireType)
+		case 3:
+			m.RaceID, err = d.string(wireType)
+		case 4:
+			var v int64
+			v, err = d.int(wireType)
+			m.Lane = int32(v)
+		case 5:
+			var v []byte
+			v, err = d.field(wireType)
+			m.DataJSON = append([]byte(nil), v...)
+		case 6:
+			var entry []byte
+			if entry, err = d.field(wireType); err == nil {
+				var name, id string
+				err = decodeEntry(entry, func(ed *decoder, num, wireType int) (err error) {
+					switch num {
+					case 1:
+						name, err = ed.string(wireType)
+					case 2:
+						id, err = ed.string(wireType)
+					default:
+						err = ed.skip(wireType)
+					}
+					return err
+				})
+				if m.External == nil {
+					m.External = make(map[string]string)
+				}
+				m.External[name] = id
+			}
+		default:
+			err = d.skip(wireType)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Marshal encodes the timing results
+func (m *TimingResults) Marshal() []byte {
+	var b []byte
+	b = appendInt(b, 1, int64(m.Lane))
+	b = appendInt(b, 2, m.StartTimeUnixNano)
+	b = appendDouble(b, 3, m.ReactionTime)
+	b = appendDouble(b, 4, m.SixtyFootTime)
+	b = appendDouble(b, 5, m.EighthMileTime)
+	b = appendDouble(b, 6, m.QuarterMileTime)
+	b = appendDouble(b, 7, m.TrapSpeed)
+	b = appendBool(b, 8, m.IsComplete)
+	b = appendBool(b, 9, m.IsFoul)
+	b = appendString(b, 10, m.FoulReason)
+	for _, beam := range sortedKeys(m.BeamTriggersUnixNano) {
+		var entry []byte
+		entry = appendString(entry, 1, beam)
+		entry = appendInt(entry, 2, m.BeamTriggersUnixNano[beam])
+		b = appendField(b, 11, entry)
+	}
+	b = appendBool(b, 12, m.PerfectLight)
+	b = appendDouble(b, 13, m.ThreeThirtyTime)
+	b = appendDouble(b, 14, m.EighthMileSpeed)
+	b = appendDouble(b, 15, m.ThousandFtTime)
+	b = appendDouble(b, 16, m.DialIn)
+	b = appendFloat(b, 17, m.StartDelay)
+	b = appendBool(b, 18, m.Breakout)
+	if m.Manual != nil {
+		b = appendField(b, 19, m.Manual.Marshal())
+	}
+	for _, beam := range sortedKeys(m.Timestamps) {
+		accuracy := m.Timestamps[beam]
+		var entry []byte
+		entry = appendString(entry, 1, beam)
+		entry = appendField(entry, 2, accuracy.Marshal())
+		b = appendField(b, 20, entry)
+	}
+	for _, beam := range sortedKeys(m.ShutdownSpeeds) {
+		var entry []byte
+		entry = appendString(entry, 1, beam)
+		entry = appendFloat(entry, 2, m.ShutdownSpeeds[beam])
+		b = appendField(b, 21, entry)
+	}
+	if m.TreeProfile != nil {
+		b = appendField(b, 22, m.TreeProfile.Marshal())
+	}
+	for i := range m.SyncMarks {
+		b = appendField(b, 23, m.SyncMarks[i].Marshal())
+	}
+	for _, reason := range m.TechReview {
+		b = appendField(b, 24, []byte(reason))
+	}
+	b = appendInt(b, 25, m.GuardTripUnixNano)
+	return b
+}
+
+// Unmarshal decodes timing results, replacing the contents of m
+func (m *TimingResults) Unmarshal(b []byte) error {
+	*m = TimingResults{}
+	d := decoder{b: b}
+	for !d.done() {
+		num, wireType, err := d.next()
+		if err != nil {
+			return err
+		}
+		switch num {
+		case 1:
+			var v int64
+			v, err = d.int(wireType)
+			m.Lane = int32(v)
+		case 2:
+			m.StartTimeUnixNano, err = d.int(wireType)
+		case 3:
+			m.ReactionTime, err = d.double(wireType)
+		case 4:
+			m.SixtyFootTime, err = d.double(wireType)
+		case 5:
+			m.EighthMileTime, err = d.double(wireType)
+		case 6:
+			m.QuarterMileTime, err = d.double(wireType)
+		case 7:
+			m.TrapSpeed, err = d.double(wireType)
+		case 8:
+			m.IsComplete, err = d.bool(wireType)
+		case 9:
+			m.IsFoul, err = d.bool(wireType)
+		case 10:
+			m.FoulReason, err = d.string(wireType)
+		case 11:
+			var entry []byte
+			if entry, err = d.field(wireType); err == nil {
+				var beam string
+				var at int64
+				err = decodeEntry(entry, func(ed *decoder, num, wireType int) (err error) {
+					switch num {
+					case 1:
+						beam, err = ed.string(wireType)
+					case 2:
+						at, err = ed.int(wireType)
+					default:
+						err = ed.skip(wireType)
+					}
+					return err
+				})
+				if m.BeamTriggersUnixNano == nil {
+					m.BeamTriggersUnixNano = make(map[string]int64)
+				}
+				m.BeamTriggersUnixNano[beam] = at
+			}
+		case 12:
+			m.PerfectLight, err = d.bool(wireType)
+		case 13:
+			m.ThreeThirtyTime, err = d.double(wireType)
+		case 14:
+			m.EighthMileSpeed, err = d.double(wireType)
+		case 15:
+			m.ThousandFtTime, err = d.double(wireType)
+		case 16:
+			m.DialIn, err = d.double(wireType)
+		case 17:
+			m.StartDelay, err = d.float(wireType)
+		case 18:
+			m.Breakout, err = d.bool(wireType)
+		case 19:
+			var v []byte
+			if v, err = d.field(wireType); err == nil {
+				m.Manual = &Provenance{}
+				err = m.Manual.Unmarshal(v)
+			}
+		case 20:
+			var entry []byte
+			if entry, err = d.field(wireType); err == nil {
+				var beam string
+				var accuracy Accuracy
+				err = decodeEntry(entry, func(ed *decoder, num, wireType int) (err error) {
+					switch num {
+					case 1:
+						beam, err = ed.string(wireType)
+					case 2:
+						var v []byte
+						if v, err = ed.field(wireType); err == nil {
+							err = accuracy.Unmarshal(v)
+						}
+					default:
+						err = ed.skip(wireType)
+					}
+					return err
+				})
+				if m.Timestamps == nil {
+					m.Timestamps = make(map[string]Accuracy)
+				}
+				m.Timestamps[beam] = accuracy
+			}
+		case 21:
+			var entry []byte
+			if entry, err = d.field(wireType); err == nil {
+				var beam string
+				var speed float64
+				err = decodeEntry(entry, func(ed *decoder, num, wireType int) (err error) {
+					switch num {
+					case 1:
+						beam, err = ed.string(wireType)
+					case 2:
+						speed, err = ed.float(wireType)
+					default:
+						err = ed.skip(wireType)
+					}
+					return err
+				})
+				if m.ShutdownSpeeds == nil {
+					m.ShutdownSpeeds = make(map[string]float64)
+				}
+				m.ShutdownSpeeds[beam] = speed
+			}
+		case 22:
+			var v []byte
+			if v, err = d.field(wireType); err == nil {
+				m.TreeProfile = &TreeProfile{}
+				err = m.TreeProfile.Unmarshal(v)
+			}
+		case 23:
+			var v []byte
+			if v, err = d.field(wireType); err == nil {
+				var mark SyncMark
+				err = mark.Unmarshal(v)
+				m.SyncMarks = append(m.SyncMarks, mark)
+			}
+		case 24:
+			var reason string
+			reason, err = d.string(wireType)
+			m.TechReview = append(m.TechReview, reason)
+		case 25:
+			m.GuardTripUnixNano, err = d.int(wireType)
+		default:
+			err = d.skip(wireType)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Marshal encodes the provenance
+func (m *Provenance) Marshal() []byte {
+	var b []byte
+	b = appendString(b, 1, m.EnteredBy)
+	b = appendString(b, 2, m.Method)
+	b = appendString(b, 3, m.Reason)
+	b = appendInt(b, 4, m.EnteredAtUnixNano)
+	for _, field := range m.Fields {
+		b = appendField(b, 5, []byte(field))
+	}
+	return b
+}
+
+// Unmarshal decodes a provenance, replacing the contents of m
+func (m *Provenance) Unmarshal(b []byte) error {
+	*m = Provenance{}
+	return decodeEntry(b, func(d *decoder, num, wireType int) (err error) {
+		switch num {
+		case 1:
+			m.EnteredBy, err = d.string(wireType)
+		case 2:
+			m.Method, err = d.string(wireType)
+		case 3:
+			m.Reason, err = d.string(wireType)
+		case 4:
+			m.EnteredAtUnixNano, err = d.int(wireType)
+		case 5:
+			var field string
+			field, err = d.string(wireType)
+			m.Fields = append(m.Fields, field)
+		default:
+			err = d.skip(wireType)
+		}
+		return err
+	})
+}
+
+// Marshal encodes the accuracy
+func (m *Accuracy) Marshal() []byte {
+	var b []byte
+	b = appendString(b, 1, m.Source)
+	b = appendFloat(b, 2, m.Uncertainty)
+	return b
+}
+
+// Unmarshal decodes an accuracy, replacing the contents of m
+func (m *Accuracy) Unmarshal(b []byte) error {
+	*m = Accuracy{}
+	return decodeEntry(b, func(d *decoder, num, wireType int) (err error) {
+		switch num {
+		case 1:
+			m.Source, err = d.string(wireType)
+		case 2:
+			m.Uncertainty, err = d.float(wireType)
+		default:
+			err = d.skip(wireType)
+		}
+		return err
+	})
+}
+
+// Marshal encodes the tree profile
+func (m *TreeProfile) Marshal() []byte {
+	var b []byte
+	b = appendString(b, 1, m.Type)
+	b = appendString(b, 2, m.Preset)
+	b = appendInt(b, 3, m.AmberDelayNanos)
+	b = appendInt(b, 4, m.GreenDelayNanos)
+	b = appendInt(b, 5, m.PreStageTimeoutNanos)
+	b = appendInt(b, 6, m.StageTimeoutNanos)
+	b = appendInt(b, 7, m.ArmDelayMinNanos)
+	b = appendInt(b, 8, m.ArmDelayMaxNanos)
+	return b
+}
+
+// Unmarshal decodes a tree profile, replacing the contents of m
+func (m *TreeProfile) Unmarshal(b []byte) error {
+	*m = TreeProfile{}
+	return decodeEntry(b, func(d *decoder, num, wireType int) (err error) {
+		switch num {
+		case 1:
+			m.Type, err = d.string(wireType)
+		case 2:
+			m.Preset, err = d.string(wireType)
+		case 3:
+			m.AmberDelayNanos, err = d.int(wireType)
+		case 4:
+			m.GreenDelayNanos, err = d.int(wireType)
+		case 5:
+			m.PreStageTimeoutNanos, err = d.int(wireType)
+		case 6:
+			m.StageTimeoutNanos, err = d.int(wireType)
+		case 7:
+			m.ArmDelayMinNanos, err = d.int(wireType)
+		case 8:
+			m.ArmDelayMaxNanos, err = d.int(wireType)
+		default:
+			err = d.skip(wireType)
+		}
+		return err
+	})
+}
+
+// Marshal encodes the sync mark
+func (m *SyncMark) Marshal() []byte {
+	var b []byte
+	b = appendString(b, 1, m.Source)
+	b = appendString(b, 2, m.Label)
+	b = appendInt(b, 3, int64(m.Lane))
+	b = appendInt(b, 4, m.AtUnixNano)
+	b = appendInt(b, 5, m.Frame)
+	b = appendInt(b, 6, m.MediaTimeNanos)
+	return b
+}
+
+// Unmarshal decodes a sync mark, replacing the contents of m
+func (m *SyncMark) Unmarshal(b []byte) error {
+	*m = SyncMark{}
+	return decodeEntry(b, func(d *decoder, num, wireType int) (err error) {
+		switch num {
+		case 1:
+			m.Source, err = d.string(wireType)
+		case 2:
+			m.Label, err = d.string(wireType)
+		case 3:
+			var v int64
+			v, err = d.int(wireType)
+			m.Lane = int32(v)
+		case 4:
+			m.AtUnixNano, err = d.int(wireType)
+		case 5:
+			m.Frame, err = d.int(wireType)
+		case 6:
+			m.MediaTimeNanos, err = d.int(wireType)
+		default:
+			err = d.skip(wireType)
+		}
+		return err
+	})
+}
+
+// Marshal encodes the decision
+func (m *Decision) Marshal() []byte {
+	var b []byte
+	b = appendInt(b, 1, int64(m.WinnerLane))
+	b = appendString(b, 2, m.Reason)
+	b = appendDouble(b, 3, m.Margin)
+	b = appendBool(b, 4, m.UnderReview)
+	b = appendBool(b, 5, m.MarginUncertain)
+	return b
+}
+
+// Unmarshal decodes a decision, replacing the contents of m
+func (m *Decision) Unmarshal(b []byte) error {
+	*m = Decision{}
+	return decodeEntry(b, func(d *decoder, num, wireType int) (err error) {
+		switch num {
+		case 1:
+			var v int64
+			v, err = d.int(wireType)
+			m.WinnerLane = int32(v)
+		case 2:
+			m.Reason, err = d.string(wireType)
+		case 3:
+			m.Margin, err = d.double(wireType)
+		case 4:
+			m.UnderReview, err = d.bool(wireType)
+		case 5:
+			m.MarginUncertain, err = d.bool(wireType)
+		default:
+			err = d.skip(wireType)
+		}
+		return err
+	})
+}
+
+// Marshal encodes the lane lights
+func (m *LaneLights) Marshal() []byte {
+	var b []byte
+	b = appendInt(b, 1, int64(m.Lane))
+	for _, light := range sortedKeys(m.Lights) {
+		var entry []byte
+		entry = appendString(entry, 1, light)
+		entry = appendString(entry, 2, m.Lights[light])
+		b = appendField(b, 2, entry)
+	}
+	b = appendString(b, 3, m.Phase)
+	b = appendInt(b, 4, int64(m.Step))
+	for i := range m.Transitions {
+		b = appendField(b, 5, m.Transitions[i].Marshal())
+	}
+	return b
+}
+
+// Unmarshal decodes lane lights, replacing the contents of m
+func (m *LaneLights) Unmarshal(b []byte) error {
+	*m = LaneLights{}
+	d := decoder{b: b}
+	for !d.done() {
+		num, wireType, err := d.next()
+		if err != nil {
+			return err
+		}
+		switch num {
+		case 1:
+			var v int64
+			v, err = d.int(wireType)
+			m.Lane = int32(v)
+		case 2:
+			var entry []byte
+			if entry, err = d.field(wireType); err == nil {
+				var light, state string
+				err = decodeEntry(entry, func(ed *decoder, num, wireType int) (err error) {
+					switch num {
+					case 1:
+						light, err = ed.string(wireType)
+					case 2:
+						state, err = ed.string(wireType)
+					default:
+						err = ed.skip(wireType)
+					}
+					return err
+				})
+				if m.Lights == nil {
+					m.Lights = make(map[string]string)
+				}
+				m.Lights[light] = state
+			}
+		case 3:
+			m.Phase, err = d.string(wireType)
+		case 4:
+			var v int64
+			v, err = d.int(wireType)
+			m.Step = int32(v)
+		case 5:
+			var v []byte
+			if v, err = d.field(wireType); err == nil {
+				var transition BulbTransition
+				err = transition.Unmarshal(v)
+				m.Transitions = append(m.Transitions, transition)
+			}
+		default:
+			err = d.skip(wireType)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Marshal encodes the bulb transition
+func (m *BulbTransition) Marshal() []byte {
+	var b []byte
+	b = appendString(b, 1, m.Light)
+	b = appendString(b, 2, m.State)
+	b = appendInt(b, 3, m.TimeUnixNano)
+	return b
+}
+
+// Unmarshal decodes a bulb transition, replacing the contents of m
+func (m *BulbTransition) Unmarshal(b []byte) error {
+	*m = BulbTransition{}
+	d := decoder{b: b}
+	for !d.done() {
+		num, wireType, err := d.next()
+		if err != nil {
+			return err
+		}
+		switch num {
+		case 1:
+			m.Light, err = d.string(wireType)
+		case 2:
+			m.State, err = d.string(wireType)
+		case 3:
+			m.TimeUnixNano, err = d.int(wireType)
+		default:
+			err = d.skip(wireType)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Marshal encodes the tree status
+func (m *TreeStatus) Marshal() []byte {
+	var b []byte
+	b = appendBool(b, 1, m.Armed)
+	b = appendBool(b, 2, m.Activated)
+	b = appendString(b, 3, m.SequenceType)
+	for i := range m.Lanes {
+		b = appendField(b, 5, m.Lanes[i].Marshal())
+	}
+	b = appendInt(b, 6, m.LastSequenceUnixNano)
+	b = appendInt(b, 7, m.ArmedTimeUnixNano)
+	b = appendInt(b, 8, m.ActivationTimeUnixNano)
+	b = appendInt(b, 9, m.StabilityTimerUnixNano)
+	return b
+}
+
+// Unmarshal decodes a tree status, replacing the contents of m
+func (m *TreeStatus) Unmarshal(b []byte) error {
+	*m = TreeStatus{}
+	d := decoder{b: b}
+	for !d.done() {
+		num, wireType, err := d.next()
+		if err != nil {
+			return err
+		}
+		switch num {
+		case 1:
+			m.Armed, err = d.bool(wireType)
+		case 2:
+			m.Activated, err = d.bool(wireType)
+		case 3:
+			m.SequenceType, err = d.string(wireType)
+		case 5:
+			var v []byte
+			if v, err = d.field(wireType); err == nil {
+				var lane LaneLights
+				err = lane.Unmarshal(v)
+				m.Lanes = append(m.Lanes, lane)
+			}
+		case 6:
+			m.LastSequenceUnixNano, err = d.int(wireType)
+		case 7:
+			m.ArmedTimeUnixNano, err = d.int(wireType)
+		case 8:
+			m.ActivationTimeUnixNano, err = d.int(wireType)
+		case 9:
+			m.StabilityTimerUnixNano, err = d.int(wireType)
+		default:
+			err = d.skip(wireType)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Marshal encodes the component status
+func (m *ComponentStatus) Marshal() []byte {
+	var b []byte
+	b = appendString(b, 1, m.ID)
+	b = appendString(b, 2, m.Status)
+	b = appendString(b, 3, m.LastError)
+	b = appendBytes(b, 4, m.MetadataJSON)
+	return b
+}
+
+// Unmarshal decodes a component status, replacing the contents of m
+func (m *ComponentStatus) Unmarshal(b []byte) error {
+	*m = ComponentStatus{}
+	d := decoder{b: b}
+	for !d.done() {
+		num, wireType, err := d.next()
+		if err != nil {
+			return err
+		}
+		switch num {
+		case 1:
+			m.ID, err = d.string(wireType)
+		case 2:
+			m.Status, err = d.string(wireType)
+		case 3:
+			m.LastError, err = d.string(wireType)
+		case 4:
+			var v []byte
+			v, err = d.field(wireType)
+			m.MetadataJSON = append([]byte(nil), v...)
+		default:
+			err = d.skip(wireType)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Marshal encodes the race status
+func (m *RaceStatus) Marshal() []byte {
+	var b []byte
+	b = appendString(b, 1, m.State)
+	b = appendInt(b, 2, m.StartTimeUnixNano)
+	for _, id := range sortedKeys(m.Components) {
+		component := m.Components[id]
+		var entry []byte
+		entry = appendString(entry, 1, id)
+		entry = appendField(entry, 2, component.Marshal())
+		b = appendField(b, 3, entry)
+	}
+	if len(m.ActiveLanes) > 0 {
+		var packed []byte
+		for _, lane := range m.ActiveLanes {
+			packed = appendVarint(packed, int64(lane))
+		}
+		b = appendField(b, 4, packed)
+	}
+	b = appendString(b, 5, m.LastError)
+	return b
+}
+
+// Unmarshal decodes a race status, replacing the contents of m
+func (m *RaceStatus) Unmarshal(b []byte) error {
+	*m = RaceStatus{}
+	d := decoder{b: b}
+	for !d.done() {
+		num, wireType, err := d.next()
+		if err != nil {
+			return err
+		}
+		switch num {
+		case 1:
+			m.State, err = d.string(wireType)
+		case 2:
+			m.StartTimeUnixNano, err = d.int(wireType)
+		case 3:
+			var entry []byte
+			if entry, err = d.field(wireType); err == nil {
+				var id string
+				var component ComponentStatus
+				err = decodeEntry(entry, func(ed *decoder, num, wireType int) (err error) {
+					switch num {
+					case 1:
+						id, err = ed.string(wireType)
+					case 2:
+						var v []byte
+						if v, err = ed.field(wireType); err == nil {
+							err = component.Unmarshal(v)
+						}
+					default:
+						err = ed.skip(wireType)
+					}
+					return err
+				})
+				if m.Components == nil {
+					m.Components = make(map[string]ComponentStatus)
+				}
+				m.Components[id] = component
+			}
+		case 4:
+			err = m.unmarshalActiveLanes(&d, wireType)
+		case 5:
+			m.LastError, err = d.string(wireType)
+		default:
+			err = d.skip(wireType)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unmarshalActiveLanes accepts both packed and unpacked repeated encodings
+func (m *RaceStatus) unmarshalActiveLanes(d *decoder, wireType int) error {
+	if wireType == wireVarint {
+		v, err := d.int(wireType)
+		m.ActiveLanes = append(m.ActiveLanes, int32(v))
+		return err
+	}
+	packed, err := d.field(wireType)
+	if err != nil {
+		return err
+	}
+	pd := decoder{b: packed}
+	for !pd.done() {
+		v, err := pd.int(wireVarint)
+		if err != nil {
+			return err
+		}
+		m.ActiveLanes = append(m.ActiveLanes, int32(v))
+	}
+	return nil
+}
+
+// decodeEntry walks the fields of a map entry or a whole message
+func decodeEntry(entry []byte, field func(d *decoder, num, wireType int) error) error {
+	d := decoder{b: entry}
+	for !d.done() {
+		num, wireType, err := d.next()
+		if err != nil {
+			return err
+		}
+		if err := field(&d, num, wireType); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sortedKeys returns map keys in order so encodings are deterministic
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,347 @@
+package pb
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/benharold/libdrag/pkg/component"
+	"github.com/benharold/libdrag/pkg/config"
+	"github.com/benharold/libdrag/pkg/events"
+	"github.com/benharold/libdrag/pkg/orchestrator"
+	"github.com/benharold/libdrag/pkg/results"
+	"github.com/benharold/libdrag/pkg/timers"
+	"github.com/benharold/libdrag/pkg/timing"
+	"github.com/benharold/libdrag/pkg/tree"
+)
+
+func TestEventWireFormat(t *testing.T) {
+	m := &Event{Type: "race.start", Lane: 1}
+	want := append([]byte{0x0a, 10}, "race.start"...)
+	want = append(want, 0x20, 0x01)
+	if got := m.Marshal(); !bytes.Equal(got, want) {
+		t.Fatalf("Expected % x, got % x", want, got)
+	}
+
+	// Negative varints use the full ten-byte encoding
+	var decoded Event
+	if err := decoded.Unmarshal((&Event{Lane: -1}).Marshal()); err != nil || decoded.Lane != -1 {
+		t.Fatalf("Expected lane -1, got %d (%v)", decoded.Lane, err)
+	}
+}
+
+func TestEventRoundTrip(t *testing.T) {
+	event := events.NewEvent(events.EventTimingReaction).
+		WithRaceID("race-1").
+		WithLane(2).
+		WithData("reaction_time", 0.512).
+		Build()
+	event.External = map[string]string{"ems_run": "R-1042"}
+
+	m, err := FromEvent(event)
+	if err != nil {
+		t.Fatalf("FromEvent failed: %v", err)
+	}
+	var decoded Event
+	if err := decoded.Unmarshal(m.Marshal()); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	got, err := decoded.ToEvent()
+	if err != nil {
+		t.Fatalf("ToEvent failed: %v", err)
+	}
+	if got.Type != event.Type || got.RaceID != "race-1" || got.Lane != 2 || !got.Timestamp.Equal(event.Timestamp) {
+		t.Errorf("Event mismatch: %+v", got)
+	}
+	if got.Data["reaction_time"] != 0.512 {
+		t.Errorf("Expected reaction time 0.512, got %v", got.Data["reaction_time"])
+	}
+	if got.External["ems_run"] != "R-1042" {
+		t.Errorf("Expected the external run ID, got %v", got.External)
+	}
+}
+
+func TestUnknownFieldsSkipped(t *testing.T) {
+	b := (&Event{Type: "race.complete"}).Marshal()
+	b = appendInt(b, 99, 7)                           // Varint from a newer schema
+	b = appendString(b, 100, "future")                // Length-delimited
+	b = appendDouble(b, 101, copyFloat(new(float64))) // Fixed64
+	b = append(b, (&Event{RaceID: "race-1"}).Marshal()...)
+
+	var decoded Event
+	if err := decoded.Unmarshal(b); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if decoded.Type != "race.complete" || decoded.RaceID != "race-1" {
+		t.Errorf("Unexpected event %+v", decoded)
+	}
+
+	if err := decoded.Unmarshal(b[:len(b)-2]); err == nil {
+		t.Error("Expected error for truncated message")
+	}
+}
+
+func TestTimingResultsRoundTrip(t *testing.T) {
+	rt, et, mph := 0.5, 7.3, 180.5
+	start := time.Now()
+	results := &timing.TimingResults{
+		Lane:            1,
+		StartTime:       start,
+		ReactionTime:    &rt,
+		QuarterMileTime: &et,
+		TrapSpeed:       &mph,
+		IsComplete:      true,
+		BeamTriggers:    map[string]time.Time{"stage": start, "1320_foot": start.Add(7300 * time.Millisecond)},
+	}
+
+	var decoded TimingResults
+	if err := decoded.Unmarshal(FromTimingResults(results).Marshal()); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	got := decoded.ToTimingResults()
+	if got.SixtyFootTime != nil || *got.ReactionTime != rt || *got.QuarterMileTime != et || *got.TrapSpeed != mph {
+		t.Errorf("Timing mismatch: %+v", got)
+	}
+	if !got.IsComplete || !got.BeamTriggers["1320_foot"].Equal(results.BeamTriggers["1320_foot"]) {
+		t.Errorf("Beam triggers mismatch: %+v", got.BeamTriggers)
+	}
+}
+
+func TestRaceResultsDecisionRoundTrip(t *testing.T) {
+	decision := results.Decision{WinnerLane: 2, Reason: results.ReasonFirstToFinish, Margin: 0.0123, MarginUncertain: true}
+	m := &RaceResults{RaceID: "race-1", Complete: true, Decision: FromDecision(decision)}
+
+	var decoded RaceResults
+	if err := decoded.Unmarshal(m.Marshal()); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if decoded.Decision == nil {
+		t.Fatal("Expected the decision on the wire")
+	}
+	if got := decoded.Decision.ToDecision(); got.WinnerLane != 2 || got.Reason != decision.Reason || got.Margin != decision.Margin || !got.MarginUncertain || got.UnderReview {
+		t.Errorf("Decision mismatch: %+v", got)
+	}
+
+	// A decision held for review has no winner and no margin
+	review := FromDecision(results.Decision{Reason: results.ReasonPhotoFinish, UnderReview: true})
+	var held Decision
+	if err := held.Unmarshal(review.Marshal()); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if held.WinnerLane != 0 || held.Margin != nil || !held.UnderReview || held.Reason != results.ReasonPhotoFinish {
+		t.Errorf("Held decision mismatch: %+v", held)
+	}
+}
+
+// fullTimingResults has every timing result field set, with times as
+// decoded from the wire so they compare equal
+func fullTimingResults() *timing.TimingResults {
+	rt, sixty, threeThirty, eighth, eighthSpeed, thousand, et, mph, dialIn := 0.0, 1.1, 3.1, 4.7, 150.2, 6.1, 7.3, 180.5, 7.35
+	start := time.Unix(1749312000, 0)
+	guardTrip := start.Add(-100 * time.Millisecond)
+	profile := config.TreeSequenceConfig{
+		Type:            config.TreeSequenceSportsman,
+		Preset:          config.TreePresetJrDragster,
+		AmberDelay:      500 * time.Millisecond,
+		GreenDelay:      500 * time.Millisecond,
+		PreStageTimeout: 30 * time.Second,
+		StageTimeout:    10 * time.Second,
+		ArmDelayMin:     600 * time.Millisecond,
+		ArmDelayMax:     1100 * time.Millisecond,
+	}
+	return &timing.TimingResults{
+		Lane:            2,
+		StartTime:       start,
+		ReactionTime:    &rt,
+		PerfectLight:    true,
+		SixtyFootTime:   &sixty,
+		ThreeThirtyTime: &threeThirty,
+		EighthMileTime:  &eighth,
+		EighthMileSpeed: &eighthSpeed,
+		ThousandFtTime:  &thousand,
+		QuarterMileTime: &et,
+		TrapSpeed:       &mph,
+		DialIn:          &dialIn,
+		StartDelay:      0.35,
+		Breakout:        true,
+		IsComplete:      true,
+		IsFoul:          true,
+		FoulReason:      "breakout",
+		BeamTriggers:    map[string]time.Time{"stage": start, "1320_foot": start.Add(7300 * time.Millisecond)},
+		SyncMarks:       []timing.SyncMark{{Source: "finish_line_cam", Label: "finish", Lane: 2, At: start.Add(7300 * time.Millisecond), Frame: 219, MediaTime: 7300 * time.Millisecond}},
+		Manual:          &timing.Provenance{EnteredBy: "chief starter", Method: "stopwatch", Reason: "finish beam out", EnteredAt: start.Add(time.Minute), Fields: []string{"quarter_mile_time"}},
+		ShutdownSpeeds:  map[string]float64{"shutdown_1": 120.5},
+		TechReview:      []string{"over_run"},
+		GuardTrip:       &guardTrip,
+		Timestamps:      map[string]timers.Accuracy{"stage": timers.AccuracyOf(timers.SourceHardware), "1320_foot": timers.AccuracyOf(timers.SourceManual)},
+		TreeProfile:     &profile,
+	}
+}
+
+func TestTimingResultsAllFieldsRoundTrip(t *testing.T) {
+	results := fullTimingResults()
+	var decoded TimingResults
+	if err := decoded.Unmarshal(FromTimingResults(results).Marshal()); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if got := decoded.ToTimingResults(); !reflect.DeepEqual(got, results) {
+		t.Errorf("Timing results mismatch:\n got %+v\nwant %+v", got, results)
+	}
+}
+
+// TestCodecMatchesProto checks the hand-written codec against the .proto
+// schema: every field a fully set message encodes is declared with the same
+// number and wire type, and every declared field is encoded
+func TestCodecMatchesProto(t *testing.T) {
+	full := FromTimingResults(fullTimingResults())
+	margin := 0.012
+	for name, m := range map[string]interface{ Marshal() []byte }{
+		"TimingResults": full,
+		"Provenance":    full.Manual,
+		"Accuracy":      &Accuracy{Source: "host", Uncertainty: 0.001},
+		"TreeProfile":   full.TreeProfile,
+		"SyncMark":      &full.SyncMarks[0],
+		"Decision":      &Decision{WinnerLane: 1, Reason: "first_to_finish", Margin: &margin, UnderReview: true, MarginUncertain: true},
+	} {
+		declared := protoFields(t, name)
+		seen := make(map[int]bool)
+		d := decoder{b: m.Marshal()}
+		for !d.done() {
+			num, wireType, err := d.next()
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			if want, ok := declared[num]; !ok {
+				t.Errorf("%s: field %d is not in the schema", name, num)
+			} else if wireType != want {
+				t.Errorf("%s: field %d has wire type %d, schema says %d", name, num, wireType, want)
+			}
+			seen[num] = true
+			if err := d.skip(wireType); err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+		}
+		for num := range declared {
+			if !seen[num] {
+				t.Errorf("%s: schema field %d is not encoded", name, num)
+			}
+		}
+	}
+}
+
+var protoField = regexp.MustCompile(`^\s*(optional |repeated )?(map<[^>]+>|[\w.]+)\s+\w+\s*=\s*(\d+);`)
+
+// protoFields returns the wire type of each field of a message declared in
+// proto/libdrag/v1, by field number
+func protoFields(t *testing.T, message string) map[int]int {
+	t.Helper()
+	files, _ := filepath.Glob(filepath.Join("..", "..", "proto", "libdrag", "v1", "*.proto"))
+	for _, file := range files {
+		schema, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatalf("Reading %s: %v", file, err)
+		}
+		lines := strings.Split(string(schema), "\n")
+		for i, line := range lines {
+			if strings.TrimSpace(line) != "message "+message+" {" {
+				continue
+			}
+			fields := make(map[int]int)
+			for _, field := range lines[i+1:] {
+				if strings.HasPrefix(field, "}") {
+					return fields
+				}
+				match := protoField.FindStringSubmatch(field)
+				if match == nil {
+					continue
+				}
+				num, _ := strconv.Atoi(match[3])
+				switch match[2] {
+				case "double":
+					fields[num] = wireFixed64
+				case "int32", "int64", "bool":
+					fields[num] = wireVarint
+				default: // Strings, bytes, maps and messages
+					fields[num] = wireBytes
+				}
+				if match[1] == "repeated " {
+					fields[num] = wireBytes // Packed or length-delimited
+				}
+			}
+		}
+	}
+	t.Fatalf("Message %s not found in the schema", message)
+	return nil
+}
+
+func TestTreeStatusRoundTrip(t *testing.T) {
+	status := &tree.Status{
+		Armed:        true,
+		SequenceType: config.TreeSequencePro,
+		LightStates: map[int]map[tree.LightType]tree.LightState{
+			1: {tree.LightStage: tree.LightOn, tree.LightGreen: tree.LightOff},
+			2: {tree.LightStage: tree.LightBlink},
+		},
+		Lanes: map[int]tree.LaneSequence{
+			1: {Phase: tree.PhaseAmber, Step: 2, Transitions: []tree.BulbTransition{
+				{Light: tree.LightAmber1, State: tree.LightOn, Time: time.Unix(0, 1000)},
+				{Light: tree.LightAmber2, State: tree.LightOn, Time: time.Unix(0, 2000)},
+			}},
+			2: {Phase: tree.PhaseIdle},
+		},
+		ArmedTime: time.Now(),
+	}
+
+	var decoded TreeStatus
+	if err := decoded.Unmarshal(FromTreeStatus(status).Marshal()); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	got := decoded.ToTreeStatus()
+	if !reflect.DeepEqual(got.LightStates, status.LightStates) || !got.ArmedTime.Equal(status.ArmedTime) {
+		t.Errorf("Tree status mismatch: %+v", got)
+	}
+	if !reflect.DeepEqual(got.Lanes, status.Lanes) {
+		t.Errorf("Lane sequence mismatch: %+v", got.Lanes)
+	}
+	if !got.Armed || got.SequenceType != config.TreeSequencePro || !got.LastSequence.IsZero() {
+		t.Errorf("Tree status mismatch: %+v", got)
+	}
+}
+
+func TestRaceStatusRoundTrip(t *testing.T) {
+	status := orchestrator.RaceStatus{
+		State:       orchestrator.RaceStateRunning,
+		StartTime:   time.Now(),
+		ActiveLanes: []int{1, 2},
+		LastError:   errors.New("beam fault"),
+		Components: map[string]component.ComponentStatus{
+			"timing": {ID: "timing", Status: "running", Metadata: map[string]interface{}{"lanes": 2.0}},
+		},
+	}
+
+	m, err := FromRaceStatus(status)
+	if err != nil {
+		t.Fatalf("FromRaceStatus failed: %v", err)
+	}
+	var decoded RaceStatus
+	if err := decoded.Unmarshal(m.Marshal()); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	got, err := decoded.ToRaceStatus()
+	if err != nil {
+		t.Fatalf("ToRaceStatus failed: %v", err)
+	}
+	if got.State != status.State || !reflect.DeepEqual(got.ActiveLanes, status.ActiveLanes) || got.LastError.Error() != "beam fault" {
+		t.Errorf("Race status mismatch: %+v", got)
+	}
+	if timingStatus := got.Components["timing"]; timingStatus.Status != "running" || timingStatus.Metadata["lanes"] != 2.0 {
+		t.Errorf("Component status mismatch: %+v", timingStatus)
+	}
+}
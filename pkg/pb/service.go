@@ -0,0 +1,394 @@
+package pb
+
+import "sort"
+
+// Request and response messages of the LibDrag service in
+// proto/libdrag/v1/service.proto
+
+// Empty is the response of control calls
+type Empty struct{}
+
+// StartRaceRequest is the wire form of the commonly used api.RaceOptions
+type StartRaceRequest struct {
+	Class            string
+	SessionID        string
+	RequestID        string
+	Drivers          map[int32]string
+	ExternalIDs      map[string]string
+	AutoStartProfile string
+}
+
+// StartRaceResponse identifies a started race
+type StartRaceResponse struct {
+	RaceID  string
+	ShortID string
+}
+
+// RaceRequest names the race a call applies to
+type RaceRequest struct {
+	RaceID string
+}
+
+// RaceResults holds a race's timing results, ordered by lane, and how it
+// was decided
+type RaceResults struct {
+	RaceID   string
+	Lanes    []TimingResults
+	Complete bool
+	Decision *Decision
+}
+
+// StagingBeamRequest reports a pre-stage or stage beam change in a lane
+type StagingBeamRequest struct {
+	RaceID string
+	Lane   int32
+	BeamID string
+	Broken bool
+}
+
+// ArmTreeRequest arms a race's tree, optionally overriding the track-clear
+// interlock
+type ArmTreeRequest struct {
+	RaceID         string
+	OverrideBy     string
+	OverrideReason string
+}
+
+// StarterOverrideRequest holds or releases a race's automatic start
+type StarterOverrideRequest struct {
+	RaceID  string
+	Enabled bool
+}
+
+// AbortRaceRequest aborts a race
+type AbortRaceRequest struct {
+	RaceID string
+	Reason string
+}
+
+// StreamEventsRequest selects the events to stream; empty fields match all
+type StreamEventsRequest struct {
+	RaceID string
+	Types  []string
+}
+
+// Marshal encodes the empty message
+func (m *Empty) Marshal() []byte {
+	return nil
+}
+
+// Unmarshal skips every field, replacing the contents of m
+func (m *Empty) Unmarshal(b []byte) error {
+	return decodeEntry(b, func(d *decoder, num, wireType int) error {
+		return d.skip(wireType)
+	})
+}
+
+// Marshal encodes the start race request
+func (m *StartRaceRequest) Marshal() []byte {
+	var b []byte
+	b = appendString(b, 1, m.Class)
+	b = appendString(b, 2, m.SessionID)
+	b = appendString(b, 3, m.RequestID)
+	lanes := make([]int32, 0, len(m.Drivers))
+	for lane := range m.Drivers {
+		lanes = append(lanes, lane)
+	}
+	sort.Slice(lanes, func(i, j int) bool { return lanes[i] < lanes[j] })
+	for _, lane := range lanes {
+		var entry []byte
+		entry = appendInt(entry, 1, int64(lane))
+		entry = appendString(entry, 2, m.Drivers[lane])
+		b = appendField(b, 4, entry)
+	}
+	for _, name := range sortedKeys(m.ExternalIDs) {
+		var entry []byte
+		entry = appendString(entry, 1, name)
+		entry = appendString(entry, 2, m.ExternalIDs[name])
+		b = appendField(b, 5, entry)
+	}
+	b = appendString(b, 6, m.AutoStartProfile)
+	return b
+}
+
+// Unmarshal decodes a start race request, replacing the contents of m
+func (m *StartRaceRequest) Unmarshal(b []byte) error {
+	*m = StartRaceRequest{}
+	return decodeEntry(b, func(d *decoder, num, wireType int) (err error) {
+		switch num {
+		case 1:
+			m.Class, err = d.string(wireType)
+		case 2:
+			m.SessionID, err = d.string(wireType)
+		case 3:
+			m.RequestID, err = d.string(wireType)
+		case 4:
+			var entry []byte
+			if entry, err = d.field(wireType); err == nil {
+				var lane int64
+				var driver string
+				err = decodeEntry(entry, func(ed *decoder, num, wireType int) (err error) {
+					switch num {
+					case 1:
+						lane, err = ed.int(wireType)
+					case 2:
+						driver, err = ed.string(wireType)
+					default:
+						err = ed.skip(wireType)
+					}
+					return err
+				})
+				if m.Drivers == nil {
+					m.Drivers = make(map[int32]string)
+				}
+				m.Drivers[int32(lane)] = driver
+			}
+		case 5:
+			var entry []byte
+			if entry, err = d.field(wireType); err == nil {
+				var name, id string
+				err = decodeEntry(entry, func(ed *decoder, num, wireType int) (err error) {
+					switch num {
+					case 1:
+						name, err = ed.string(wireType)
+					case 2:
+						id, err = ed.string(wireType)
+					default:
+						err = ed.skip(wireType)
+					}
+					return err
+				})
+				if m.ExternalIDs == nil {
+					m.ExternalIDs = make(map[string]string)
+				}
+				m.ExternalIDs[name] = id
+			}
+		case 6:
+			m.AutoStartProfile, err = d.string(wireType)
+		default:
+			err = d.skip(wireType)
+		}
+		return err
+	})
+}
+
+// Marshal encodes the start race response
+func (m *StartRaceResponse) Marshal() []byte {
+	var b []byte
+	b = appendString(b, 1, m.RaceID)
+	b = appendString(b, 2, m.ShortID)
+	return b
+}
+
+// Unmarshal decodes a start race response, replacing the contents of m
+func (m *StartRaceResponse) Unmarshal(b []byte) error {
+	*m = StartRaceResponse{}
+	return decodeEntry(b, func(d *decoder, num, wireType int) (err error) {
+		switch num {
+		case 1:
+			m.RaceID, err = d.string(wireType)
+		case 2:
+			m.ShortID, err = d.string(wireType)
+		default:
+			err = d.skip(wireType)
+		}
+		return err
+	})
+}
+
+// Marshal encodes the race request
+func (m *RaceRequest) Marshal() []byte {
+	return appendString(nil, 1, m.RaceID)
+}
+
+// Unmarshal decodes a race request, replacing the contents of m
+func (m *RaceRequest) Unmarshal(b []byte) error {
+	*m = RaceRequest{}
+	return decodeEntry(b, func(d *decoder, num, wireType int) (err error) {
+		switch num {
+		case 1:
+			m.RaceID, err = d.string(wireType)
+		default:
+			err = d.skip(wireType)
+		}
+		return err
+	})
+}
+
+// Marshal encodes the race results
+func (m *RaceResults) Marshal() []byte {
+	var b []byte
+	b = appendString(b, 1, m.RaceID)
+	for i := range m.Lanes {
+		b = appendField(b, 2, m.Lanes[i].Marshal())
+	}
+	b = appendBool(b, 3, m.Complete)
+	if m.Decision != nil {
+		b = appendField(b, 4, m.Decision.Marshal())
+	}
+	return b
+}
+
+// Unmarshal decodes race results, replacing the contents of m
+func (m *RaceResults) Unmarshal(b []byte) error {
+	*m = RaceResults{}
+	return decodeEntry(b, func(d *decoder, num, wireType int) (err error) {
+		switch num {
+		case 1:
+			m.RaceID, err = d.string(wireType)
+		case 2:
+			var v []byte
+			if v, err = d.field(wireType); err == nil {
+				var lane TimingResults
+				err = lane.Unmarshal(v)
+				m.Lanes = append(m.Lanes, lane)
+			}
+		case 3:
+			m.Complete, err = d.bool(wireType)
+		case 4:
+			var v []byte
+			if v, err = d.field(wireType); err == nil {
+				m.Decision = &Decision{}
+				err = m.Decision.Unmarshal(v)
+			}
+		default:
+			err = d.skip(wireType)
+		}
+		return err
+	})
+}
+
+// Marshal encodes the staging beam request
+func (m *StagingBeamRequest) Marshal() []byte {
+	var b []byte
+	b = appendString(b, 1, m.RaceID)
+	b = appendInt(b, 2, int64(m.Lane))
+	b = appendString(b, 3, m.BeamID)
+	b = appendBool(b, 4, m.Broken)
+	return b
+}
+
+// Unmarshal decodes a staging beam request, replacing the contents of m
+func (m *StagingBeamRequest) Unmarshal(b []byte) error {
+	*m = StagingBeamRequest{}
+	return decodeEntry(b, func(d *decoder, num, wireType int) (err error) {
+		switch num {
+		case 1:
+			m.RaceID, err = d.string(wireType)
+		case 2:
+			var v int64
+			v, err = d.int(wireType)
+			m.Lane = int32(v)
+		case 3:
+			m.BeamID, err = d.string(wireType)
+		case 4:
+			m.Broken, err = d.bool(wireType)
+		default:
+			err = d.skip(wireType)
+		}
+		return err
+	})
+}
+
+// Marshal encodes the arm tree request
+func (m *ArmTreeRequest) Marshal() []byte {
+	var b []byte
+	b = appendString(b, 1, m.RaceID)
+	b = appendString(b, 2, m.OverrideBy)
+	b = appendString(b, 3, m.OverrideReason)
+	return b
+}
+
+// Unmarshal decodes an arm tree request, replacing the contents of m
+func (m *ArmTreeRequest) Unmarshal(b []byte) error {
+	*m = ArmTreeRequest{}
+	return decodeEntry(b, func(d *decoder, num, wireType int) (err error) {
+		switch num {
+		case 1:
+			m.RaceID, err = d.string(wireType)
+		case 2:
+			m.OverrideBy, err = d.string(wireType)
+		case 3:
+			m.OverrideReason, err = d.string(wireType)
+		default:
+			err = d.skip(wireType)
+		}
+		return err
+	})
+}
+
+// Marshal encodes the starter override request
+func (m *StarterOverrideRequest) Marshal() []byte {
+	var b []byte
+	b = appendString(b, 1, m.RaceID)
+	b = appendBool(b, 2, m.Enabled)
+	return b
+}
+
+// Unmarshal decodes a starter override request, replacing the contents of m
+func (m *StarterOverrideRequest) Unmarshal(b []byte) error {
+	*m = StarterOverrideRequest{}
+	return decodeEntry(b, func(d *decoder, num, wireType int) (err error) {
+		switch num {
+		case 1:
+			m.RaceID, err = d.string(wireType)
+		case 2:
+			m.Enabled, err = d.bool(wireType)
+		default:
+			err = d.skip(wireType)
+		}
+		return err
+	})
+}
+
+// Marshal encodes the abort race request
+func (m *AbortRaceRequest) Marshal() []byte {
+	var b []byte
+	b = appendString(b, 1, m.RaceID)
+	b = appendString(b, 2, m.Reason)
+	return b
+}
+
+// Unmarshal decodes an abort race request, replacing the contents of m
+func (m *AbortRaceRequest) Unmarshal(b []byte) error {
+	*m = AbortRaceRequest{}
+	return decodeEntry(b, func(d *decoder, num, wireType int) (err error) {
+		switch num {
+		case 1:
+			m.RaceID, err = d.string(wireType)
+		case 2:
+			m.Reason, err = d.string(wireType)
+		default:
+			err = d.skip(wireType)
+		}
+		return err
+	})
+}
+
+// Marshal encodes the stream events request
+func (m *StreamEventsRequest) Marshal() []byte {
+	var b []byte
+	b = appendString(b, 1, m.RaceID)
+	for _, eventType := range m.Types {
+		b = appendField(b, 2, []byte(eventType))
+	}
+	return b
+}
+
+// Unmarshal decodes a stream events request, replacing the contents of m
+func (m *StreamEventsRequest) Unmarshal(b []byte) error {
+	*m = StreamEventsRequest{}
+	return decodeEntry(b, func(d *decoder, num, wireType int) (err error) {
+		switch num {
+		case 1:
+			m.RaceID, err = d.string(wireType)
+		case 2:
+			var eventType string
+			eventType, err = d.string(wireType)
+			m.Types = append(m.Types, eventType)
+		default:
+			err = d.skip(wireType)
+		}
+		return err
+	})
+}
@@ -0,0 +1,204 @@
+package pb
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Protobuf wire types
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+var errTruncated = errors.New("pb: truncated message")
+
+func appendTag(b []byte, num int, wireType int) []byte {
+	return binary.AppendUvarint(b, uint64(num)<<3|uint64(wireType))
+}
+
+// appendVarint writes a bare varint, as used inside packed repeated fields
+func appendVarint(b []byte, v int64) []byte {
+	return binary.AppendUvarint(b, uint64(v))
+}
+
+// appendInt writes a non-zero int32/int64 field. Negative values are sign
+// extended to ten bytes as protobuf requires.
+func appendInt(b []byte, num int, v int64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = appendTag(b, num, wireVarint)
+	return binary.AppendUvarint(b, uint64(v))
+}
+
+func appendBool(b []byte, num int, v bool) []byte {
+	if !v {
+		return b
+	}
+	b = appendTag(b, num, wireVarint)
+	return append(b, 1)
+}
+
+// appendDouble writes an optional double field; nil is omitted
+func appendDouble(b []byte, num int, v *float64) []byte {
+	if v == nil {
+		return b
+	}
+	b = appendTag(b, num, wireFixed64)
+	return binary.LittleEndian.AppendUint64(b, math.Float64bits(*v))
+}
+
+// appendFloat writes a non-zero double field
+func appendFloat(b []byte, num int, v float64) []byte {
+	if v == 0 {
+		return b
+	}
+	return appendDouble(b, num, &v)
+}
+
+func appendBytes(b []byte, num int, v []byte) []byte {
+	if len(v) == 0 {
+		return b
+	}
+	return appendField(b, num, v)
+}
+
+func appendString(b []byte, num int, v string) []byte {
+	if v == "" {
+		return b
+	}
+	return appendField(b, num, []byte(v))
+}
+
+// appendField writes a length-delimited field even when empty, as needed
+// for embedded messages and map entries
+func appendField(b []byte, num int, v []byte) []byte {
+	b = appendTag(b, num, wireBytes)
+	b = binary.AppendUvarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+// decoder walks the fields of a single message
+type decoder struct {
+	b []byte
+}
+
+// next returns the next field's number and wire type
+func (d *decoder) next() (int, int, error) {
+	tag, err := d.varint()
+	if err != nil {
+		return 0, 0, err
+	}
+	num := int(tag >> 3)
+	if num <= 0 {
+		return 0, 0, fmt.Errorf("pb: invalid field number %d", num)
+	}
+	return num, int(tag & 7), nil
+}
+
+func (d *decoder) done() bool {
+	return len(d.b) == 0
+}
+
+func (d *decoder) varint() (uint64, error) {
+	v, n := binary.Uvarint(d.b)
+	if n <= 0 {
+		return 0, errTruncated
+	}
+	d.b = d.b[n:]
+	return v, nil
+}
+
+func (d *decoder) fixed64() (uint64, error) {
+	if len(d.b) < 8 {
+		return 0, errTruncated
+	}
+	v := binary.LittleEndian.Uint64(d.b)
+	d.b = d.b[8:]
+	return v, nil
+}
+
+func (d *decoder) bytes() ([]byte, error) {
+	n, err := d.varint()
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(d.b)) < n {
+		return nil, errTruncated
+	}
+	v := d.b[:n]
+	d.b = d.b[n:]
+	return v, nil
+}
+
+func (d *decoder) int(wireType int) (int64, error) {
+	if wireType != wireVarint {
+		return 0, fmt.Errorf("pb: expected varint, got wire type %d", wireType)
+	}
+	v, err := d.varint()
+	return int64(v), err
+}
+
+func (d *decoder) bool(wireType int) (bool, error) {
+	v, err := d.int(wireType)
+	return v != 0, err
+}
+
+func (d *decoder) double(wireType int) (*float64, error) {
+	if wireType != wireFixed64 {
+		return nil, fmt.Errorf("pb: expected fixed64, got wire type %d", wireType)
+	}
+	bits, err := d.fixed64()
+	if err != nil {
+		return nil, err
+	}
+	v := math.Float64frombits(bits)
+	return &v, nil
+}
+
+func (d *decoder) float(wireType int) (float64, error) {
+	v, err := d.double(wireType)
+	if err != nil {
+		return 0, err
+	}
+	return *v, nil
+}
+
+func (d *decoder) string(wireType int) (string, error) {
+	v, err := d.field(wireType)
+	return string(v), err
+}
+
+// field reads a length-delimited field
+func (d *decoder) field(wireType int) ([]byte, error) {
+	if wireType != wireBytes {
+		return nil, fmt.Errorf("pb: expected length-delimited, got wire type %d", wireType)
+	}
+	return d.bytes()
+}
+
+// skip discards an unknown field so newer peers can add fields safely
+func (d *decoder) skip(wireType int) error {
+	var err error
+	switch wireType {
+	case wireVarint:
+		_, err = d.varint()
+	case wireFixed64:
+		_, err = d.fixed64()
+	case wireBytes:
+		_, err = d.bytes()
+	case wireFixed32:
+		if len(d.b) < 4 {
+			return errTruncated
+		}
+		d.b = d.b[4:]
+	default:
+		err = fmt.Errorf("pb: unsupported wire type %d", wireType)
+	}
+	return err
+}
@@ -0,0 +1,55 @@
+package practice_test
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/benharold/libdrag/pkg/config"
+	"github.com/benharold/libdrag/pkg/events"
+	"github.com/benharold/libdrag/pkg/practice"
+	"github.com/benharold/libdrag/pkg/timers"
+)
+
+// This example runs a practice tree for two drivers on a virtual clock,
+// launches each lane off the green as its button or beam would, and reads
+// the reaction times back from the session.
+func ExampleSession() {
+	bus := events.NewEventBus(false)
+	session, err := practice.NewSession(bus, config.NewDefaultConfig(), practice.Config{
+		Drivers: map[int]string{1: "Alice", 2: "Bob"},
+	})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer session.Stop()
+	wheel := timers.NewVirtualWheel(time.Date(2025, time.June, 7, 18, 0, 0, 0, time.UTC), timers.DefaultTick)
+	session.SetClock(wheel)
+
+	green := make(chan time.Time, 1)
+	bus.Subscribe(events.EventTreeGreenOn, func(e events.Event) {
+		green <- e.Data["green_time"].(time.Time)
+	})
+	bus.Subscribe(events.EventPracticeAttempt, func(e events.Event) {
+		attempt := e.Data["attempt"].(practice.Attempt)
+		fmt.Printf("%s: %.3f red=%t\n", attempt.Driver, *attempt.ReactionTime, attempt.RedLight)
+	})
+
+	if _, err := session.Run(); err != nil {
+		fmt.Println(err)
+		return
+	}
+	wheel.BlockUntil(1) // The pro tree's ambers
+	wheel.Step()
+	at := <-green
+
+	session.Launch(1, at.Add(152*time.Millisecond))
+	session.Launch(2, at.Add(-21*time.Millisecond))
+
+	stats := session.Stats()
+	fmt.Printf("Alice best %.3f, Bob red lights %d\n", *stats[1].Best, stats[2].RedLights)
+	// Output:
+	// Alice: 0.152 red=false
+	// Bob: -0.021 red=true
+	// Alice best 0.152, Bob red lights 1
+}
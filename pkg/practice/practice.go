@@ -0,0 +1,550 @@
+// Package practice runs a practice Christmas tree for reaction time
+// training. Each run brings a tree down on demand and times each lane's
+// launch from its green, from a button, beam or app touch, or from a
+// simulator, and the session keeps every lane's reaction times with their
+// statistics.
+package practice
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/benharold/libdrag/pkg/config"
+	"github.com/benharold/libdrag/pkg/events"
+	"github.com/benharold/libdrag/pkg/logs"
+	"github.com/benharold/libdrag/pkg/simulation"
+	"github.com/benharold/libdrag/pkg/timers"
+	"github.com/benharold/libdrag/pkg/timing"
+	"github.com/benharold/libdrag/pkg/tree"
+	"github.com/google/uuid"
+)
+
+// DefaultLaunchTimeout is how long a lane has to launch after its green
+const DefaultLaunchTimeout = 5 * time.Second
+
+// BucketWidth is the width of a reaction time distribution bucket (seconds)
+const BucketWidth = 0.010
+
+// Attempt statuses
+const (
+	AttemptLaunched = "launched"
+	AttemptNoLaunch = "no_launch" // No launch within the launch timeout
+	AttemptAborted  = "aborted"
+)
+
+// Config configures a practice session
+type Config struct {
+	SessionID string         `json:"session_id,omitempty"` // Recorded on every attempt
+	Lanes     []int          `json:"lanes,omitempty"`      // Lanes practicing; empty is every lane
+	Drivers   map[int]string `json:"drivers,omitempty"`    // Lane -> driver, recorded on attempts
+
+	// Tree overrides the track's tree (e.g. a Pro .4 tree for a driver
+	// moving up). Unset fields keep the track's values.
+	Tree *config.TreeSequenceConfig `json:"tree,omitempty"`
+
+	LaunchTimeout time.Duration `json:"launch_timeout"` // 0 = DefaultLaunchTimeout
+
+	// Simulator launches each lane itself at its pass's reaction time, for
+	// demos and testing a practice setup; nil waits for Launch
+	Simulator simulation.Simulator `json:"-"`
+
+	// Ghosts races simulated opponents beside the drivers: each ghost lane
+	// launches itself from the named simulation preset (e.g. "pro-stock"),
+	// while the other lanes wait for Launch
+	Ghosts map[int]string `json:"ghosts,omitempty"`
+}
+
+// Attempt is one lane's launch on a practice tree run
+type Attempt struct {
+	RunID        string    `json:"run_id"`
+	Run          int       `json:"run"` // Order run in the session
+	SessionID    string    `json:"session_id,omitempty"`
+	Lane         int       `json:"lane"`
+	Driver       string    `json:"driver,omitempty"`
+	Status       string    `json:"status"`
+	GreenAt      time.Time `json:"green_at,omitempty"`
+	LaunchedAt   time.Time `json:"launched_at,omitempty"`
+	ReactionTime *float64  `json:"reaction_time,omitempty"` // Truncated to 0.001s; negative is a red light
+	RedLight     bool      `json:"red_light,omitempty"`
+	PerfectLight bool      `json:"perfect_light,omitempty"`
+}
+
+// Bucket counts the reaction times in [From, From+BucketWidth)
+type Bucket struct {
+	From  float64 `json:"from"`
+	Count int     `json:"count"`
+}
+
+// Stats summarizes a lane's practice. Averages and bests are over legal
+// launches; the distribution includes red lights.
+type Stats struct {
+	Lane            int      `json:"lane"`
+	Driver          string   `json:"driver,omitempty"`
+	Attempts        int      `json:"attempts"` // Runs the lane took part in, aborted ones aside
+	Launches        int      `json:"launches"`
+	RedLights       int      `json:"red_lights"`
+	RedLightPercent float64  `json:"red_light_percent"` // Of launches
+	PerfectLights   int      `json:"perfect_lights"`
+	Average         *float64 `json:"average,omitempty"`
+	Best            *float64 `json:"best,omitempty"` // Closest to .000
+	StdDev          *float64 `json:"std_dev,omitempty"`
+	Distribution    []Bucket `json:"distribution,omitempty"`
+}
+
+// run is a practice tree run in progress
+type run struct {
+	id       string
+	number   int
+	tree     *tree.ChristmasTree
+	timing   *timing.TimingSystem
+	green    time.Time
+	launched map[int]time.Time
+	timeout  *timers.Timer
+}
+
+// Session is a practice tree session. Its runs' tree and timing events
+// carry the run ID as their race ID; practice.attempt and practice.stats
+// carry the session's ID.
+type Session struct {
+	mu            sync.Mutex
+	id            string
+	cfg           Config
+	trackConfig   config.Config
+	lanes         []int
+	launchTimeout time.Duration
+	bus           *events.EventBus
+	clock         timers.Clock // Nil runs on the default wheel
+	logger        *slog.Logger // Nil logs to logs.Default
+	ghosts        simulation.Simulator
+	ghostLanes    []int
+	unsubscribe   func()
+	current       *run
+	runs          int
+	attempts      []Attempt
+	stopped       bool
+}
+
+// treeConfig is the track's configuration with the practice tree
+type treeConfig struct {
+	config.Config
+	tree config.TreeSequenceConfig
+}
+
+func (c treeConfig) Tree() config.TreeSequenceConfig {
+	return c.tree
+}
+
+// NewSession creates a practice session on the track in cfg
+func NewSession(bus *events.EventBus, cfg config.Config, pc Config) (*Session, error) {
+	if bus == nil {
+		return nil, fmt.Errorf("practice needs an event bus")
+	}
+	laneCount := cfg.Track().LaneCount
+	lanes := append([]int(nil), pc.Lanes...)
+	if len(lanes) == 0 {
+		for lane := 1; lane <= laneCount; lane++ {
+			lanes = append(lanes, lane)
+		}
+	}
+	sort.Ints(lanes)
+	for _, lane := range lanes {
+		if lane < 1 || lane > laneCount {
+			return nil, fmt.Errorf("lane %d is not on the track", lane)
+		}
+	}
+	if pc.Tree != nil {
+		switch pc.Tree.Type {
+		case "", config.TreeSequencePro, config.TreeSequenceSportsman:
+		default:
+			return nil, fmt.Errorf("practice needs a pro or sportsman tree, not %q", pc.Tree.Type)
+		}
+		cfg = treeConfig{Config: cfg, tree: cfg.Tree().Override(*pc.Tree)}
+	}
+	launchTimeout := pc.LaunchTimeout
+	if launchTimeout <= 0 {
+		launchTimeout = DefaultLaunchTimeout
+	}
+	var ghosts simulation.Simulator
+	ghostLanes := make([]int, 0, len(pc.Ghosts))
+	if len(pc.Ghosts) > 0 {
+		profiles := make(map[int]simulation.Profile, len(pc.Ghosts))
+		for lane, name := range pc.Ghosts {
+			if i := sort.SearchInts(lanes, lane); i == len(lanes) || lanes[i] != lane {
+				return nil, fmt.Errorf("ghost lane %d is not practicing", lane)
+			}
+			profile, ok := simulation.Preset(name)
+			if !ok {
+				return nil, fmt.Errorf("unknown simulation preset %q", name)
+			}
+			profiles[lane] = profile
+			ghostLanes = append(ghostLanes, lane)
+		}
+		sort.Ints(ghostLanes)
+		sim, err := simulation.NewProfileSimulator(profiles, profiles[ghostLanes[0]], timers.Now().UnixNano())
+		if err != nil {
+			return nil, err
+		}
+		ghosts = sim
+	}
+
+	s := &Session{
+		id:            uuid.New().String(),
+		cfg:           pc,
+		trackConfig:   cfg,
+		lanes:         lanes,
+		launchTimeout: launchTimeout,
+		bus:           bus,
+		ghosts:        ghosts,
+		ghostLanes:    ghostLanes,
+	}
+	s.unsubscribe = bus.Subscribe(events.EventTreeGreenOn, s.onGreen)
+	return s, nil
+}
+
+// ID returns the session ID
+func (s *Session) ID() string {
+	return s.id
+}
+
+// SetClock runs the session's trees and timing on clock instead of the
+// default wheel
+func (s *Session) SetClock(clock timers.Clock) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clock = clock
+}
+
+// SetLogger logs the session, and its trees and timing, to logger instead
+// of logs.Default
+func (s *Session) SetLogger(logger *slog.Logger) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.logger = logger
+}
+
+// Run stages the practicing lanes and brings the tree down, returning the
+// run's ID. The previous run must be done.
+func (s *Session) Run() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stopped {
+		return "", fmt.Errorf("practice stopped")
+	}
+	if s.current != nil {
+		return "", fmt.Errorf("run %d still in progress", s.current.number)
+	}
+
+	s.runs++
+	r := &run{
+		id:       uuid.New().String(),
+		number:   s.runs,
+		tree:     tree.NewChristmasTree(),
+		timing:   timing.NewTimingSystemWithRaceID(""),
+		launched: make(map[int]time.Time),
+	}
+	ctx := context.Background()
+	for _, c := range []interface {
+		SetEventBus(*events.EventBus)
+		SetRaceID(string)
+		SetClock(timers.Clock)
+		SetLogger(*slog.Logger)
+		Initialize(context.Context, config.Config) error
+		Arm(context.Context) error
+	}{r.timing, r.tree} {
+		c.SetEventBus(s.bus)
+		c.SetRaceID(r.id)
+		if s.clock != nil {
+			c.SetClock(s.clock)
+		}
+		if s.logger != nil {
+			c.SetLogger(s.logger)
+		}
+		if err := c.Initialize(ctx, s.trackConfig); err != nil {
+			return "", err
+		}
+		if err := c.Arm(ctx); err != nil {
+			return "", err
+		}
+	}
+	r.timing.SetRedLightHandler(func(lane int, _ float64) {
+		r.tree.SetRedLight(lane)
+	})
+	r.timing.StartRace()
+	r.timing.AddVehicles(s.lanes)
+	for _, lane := range s.lanes {
+		r.tree.SetPreStage(lane, true)
+		r.tree.SetStage(lane, true)
+	}
+
+	s.current = r
+	if err := r.tree.StartSequence(s.trackConfig.Tree().Type); err != nil {
+		s.current = nil
+		return "", err
+	}
+	logs.For(s.logger, "practice", r.id).Info("🎯 Run started", "run", r.number, "lanes", s.lanes)
+	return r.id, nil
+}
+
+// onGreen times the current run from its tree's green
+func (s *Session) onGreen(e events.Event) {
+	green, _ := e.Data["green_time"].(time.Time)
+	s.mu.Lock()
+	r := s.current
+	if r == nil || e.RaceID != r.id || !r.green.IsZero() || green.IsZero() {
+		s.mu.Unlock()
+		return
+	}
+	r.green = green
+	clock, sim := s.clock, s.cfg.Simulator
+	r.timeout = timers.Or(clock).AfterFunc(s.launchTimeout, timers.Label{Name: "practice.launch_timeout", RaceID: r.id}, func() {
+		s.finish(r.id, AttemptNoLaunch)
+	})
+	s.mu.Unlock()
+
+	r.timing.SetGreenLight(green)
+	simulated := s.lanes
+	if sim == nil {
+		sim, simulated = s.ghosts, s.ghostLanes
+	}
+	if sim != nil {
+		now := timers.Or(clock).Now()
+		for _, lane := range simulated {
+			lane, at := lane, green.Add(sim.Pass(lane).ReactionTime)
+			timers.Or(clock).AfterFunc(max(at.Sub(now), 0), timers.Label{Name: "practice.simulated_launch", RaceID: r.id}, func() {
+				s.launch(r.id, lane, at)
+			})
+		}
+	}
+	s.checkDone(r.id)
+}
+
+// Launch reports a lane's launch in the current run, at the current time
+// when at is zero. A launch before the green is a red light.
+func (s *Session) Launch(lane int, at time.Time) error {
+	s.mu.Lock()
+	r := s.current
+	if at.IsZero() {
+		at = timers.Or(s.clock).Now()
+	}
+	s.mu.Unlock()
+
+	if r == nil {
+		return fmt.Errorf("no practice run in progress")
+	}
+	return s.launch(r.id, lane, at)
+}
+
+// launch records a lane's launch in a run
+func (s *Session) launch(runID string, lane int, at time.Time) error {
+	s.mu.Lock()
+	r := s.current
+	if r == nil || r.id != runID {
+		s.mu.Unlock()
+		return fmt.Errorf("run is over")
+	}
+	if !s.practicing(lane) {
+		s.mu.Unlock()
+		return fmt.Errorf("lane %d is not practicing", lane)
+	}
+	if _, done := r.launched[lane]; done {
+		s.mu.Unlock()
+		return fmt.Errorf("lane %d already launched", lane)
+	}
+	r.launched[lane] = at
+	s.mu.Unlock()
+
+	r.timing.TriggerBeam("stage", lane, at)
+	s.checkDone(runID)
+	return nil
+}
+
+// practicing reports whether a lane is in the session. Must be called with
+// s.mu held.
+func (s *Session) practicing(lane int) bool {
+	for _, l := range s.lanes {
+		if l == lane {
+			return true
+		}
+	}
+	return false
+}
+
+// checkDone finishes a run once it has its green and every lane launched
+func (s *Session) checkDone(runID string) {
+	s.mu.Lock()
+	r := s.current
+	done := r != nil && r.id == runID && !r.green.IsZero() && len(r.launched) == len(s.lanes)
+	s.mu.Unlock()
+
+	if done {
+		s.finish(runID, AttemptLaunched)
+	}
+}
+
+// Abort ends the current run; its attempts count in no statistics
+func (s *Session) Abort() error {
+	s.mu.Lock()
+	r := s.current
+	s.mu.Unlock()
+
+	if r == nil {
+		return fmt.Errorf("no practice run in progress")
+	}
+	s.finish(r.id, AttemptAborted)
+	return nil
+}
+
+// finish closes a run, records each lane's attempt and publishes the
+// attempts and the lanes' updated statistics. Lanes that never launched get
+// status; those that did are launched.
+func (s *Session) finish(runID, status string) {
+	s.mu.Lock()
+	r := s.current
+	if r == nil || r.id != runID {
+		s.mu.Unlock()
+		return // Already finished
+	}
+	s.current = nil
+	if r.timeout != nil {
+		r.timeout.Stop()
+	}
+
+	var finished []Attempt
+	for _, lane := range s.lanes {
+		attempt := Attempt{
+			RunID:     r.id,
+			Run:       r.number,
+			SessionID: s.cfg.SessionID,
+			Lane:      lane,
+			Driver:    s.cfg.Drivers[lane],
+			Status:    status,
+			GreenAt:   r.green,
+		}
+		if at, ok := r.launched[lane]; ok && status != AttemptAborted {
+			attempt.Status = AttemptLaunched
+			attempt.LaunchedAt = at
+			if result := r.timing.GetResults(lane); result != nil {
+				attempt.ReactionTime = result.ReactionTime
+				attempt.RedLight = result.IsFoul && result.FoulReason == "red_light"
+				attempt.PerfectLight = result.PerfectLight
+			}
+		}
+		finished = append(finished, attempt)
+	}
+	s.attempts = append(s.attempts, finished...)
+	stats := make([]Stats, 0, len(finished))
+	for _, attempt := range finished {
+		stats = append(stats, s.statsLocked(attempt.Lane))
+	}
+	s.mu.Unlock()
+
+	logs.For(s.logger, "practice", r.id).Info("🎯 Run done", "run", r.number, "status", status)
+	for i, attempt := range finished {
+		s.bus.Publish(
+			events.NewEvent(events.EventPracticeAttempt).
+				WithRaceID(s.id).
+				WithLane(attempt.Lane).
+				WithData("attempt", attempt).
+				Build(),
+		)
+		s.bus.Publish(
+			events.NewEvent(events.EventPracticeStats).
+				WithRaceID(s.id).
+				WithLane(attempt.Lane).
+				WithData("stats", stats[i]).
+				Build(),
+		)
+	}
+}
+
+// Attempts returns every lane's attempts in the order run
+func (s *Session) Attempts() []Attempt {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Attempt(nil), s.attempts...)
+}
+
+// Stats returns each practicing lane's statistics
+func (s *Session) Stats() map[int]Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := make(map[int]Stats, len(s.lanes))
+	for _, lane := range s.lanes {
+		stats[lane] = s.statsLocked(lane)
+	}
+	return stats
+}
+
+// statsLocked summarizes a lane's attempts. Must be called with s.mu held.
+func (s *Session) statsLocked(lane int) Stats {
+	stats := Stats{Lane: lane, Driver: s.cfg.Drivers[lane]}
+	var legal []float64
+	buckets := make(map[int]int)
+	for _, attempt := range s.attempts {
+		if attempt.Lane != lane || attempt.Status == AttemptAborted {
+			continue
+		}
+		stats.Attempts++
+		if attempt.ReactionTime == nil {
+			continue
+		}
+		rt := *attempt.ReactionTime
+		stats.Launches++
+		buckets[int(math.Floor(rt/BucketWidth+1e-9))]++
+		if attempt.PerfectLight {
+			stats.PerfectLights++
+		}
+		if attempt.RedLight {
+			stats.RedLights++
+			continue
+		}
+		legal = append(legal, rt)
+	}
+	if stats.Launches > 0 {
+		stats.RedLightPercent = float64(stats.RedLights) / float64(stats.Launches) * 100
+	}
+	if len(legal) > 0 {
+		sum, best := 0.0, legal[0]
+		for _, rt := range legal {
+			sum += rt
+			best = math.Min(best, rt)
+		}
+		average := sum / float64(len(legal))
+		variance := 0.0
+		for _, rt := range legal {
+			variance += (rt - average) * (rt - average)
+		}
+		stdDev := math.Sqrt(variance / float64(len(legal)))
+		stats.Average, stats.Best, stats.StdDev = &average, &best, &stdDev
+	}
+
+	indexes := make([]int, 0, len(buckets))
+	for index := range buckets {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+	for _, index := range indexes {
+		stats.Distribution = append(stats.Distribution, Bucket{From: float64(index) * BucketWidth, Count: buckets[index]})
+	}
+	return stats
+}
+
+// Stop aborts the run in progress and ends the session
+func (s *Session) Stop() {
+	s.mu.Lock()
+	if s.stopped {
+		s.mu.Unlock()
+		return
+	}
+	s.stopped = true
+	s.mu.Unlock()
+
+	s.Abort()
+	s.unsubscribe()
+}
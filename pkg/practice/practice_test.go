@@ -0,0 +1,218 @@
+package practice
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/benharold/libdrag/pkg/config"
+	"github.com/benharold/libdrag/pkg/events"
+	"github.com/benharold/libdrag/pkg/simulation"
+	"github.com/benharold/libdrag/pkg/timers"
+)
+
+type testSession struct {
+	*Session
+	wheel    *timers.Wheel
+	green    chan time.Time
+	attempts []Attempt
+	stats    []Stats
+}
+
+func newTestSession(t *testing.T, pc Config) *testSession {
+	t.Helper()
+	bus := events.NewEventBus(false)
+	session, err := NewSession(bus, config.NewDefaultConfig(), pc)
+	if err != nil {
+		t.Fatalf("NewSession failed: %v", err)
+	}
+	ts := &testSession{
+		Session: session,
+		wheel:   timers.NewVirtualWheel(time.Now(), timers.DefaultTick),
+		green:   make(chan time.Time, 1),
+	}
+	session.SetClock(ts.wheel)
+	bus.Subscribe(events.EventTreeGreenOn, func(e events.Event) {
+		ts.green <- e.Data["green_time"].(time.Time)
+	})
+	bus.Subscribe(events.EventPracticeAttempt, func(e events.Event) {
+		ts.attempts = append(ts.attempts, e.Data["attempt"].(Attempt))
+	})
+	bus.Subscribe(events.EventPracticeStats, func(e events.Event) {
+		ts.stats = append(ts.stats, e.Data["stats"].(Stats))
+	})
+	return ts
+}
+
+// run starts a run and brings its pro tree down to green
+func (ts *testSession) run(t *testing.T) time.Time {
+	t.Helper()
+	if _, err := ts.Run(); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	ts.wheel.BlockUntil(1)
+	ts.wheel.Step()
+	select {
+	case green := <-ts.green:
+		return green
+	case <-time.After(time.Second):
+		t.Fatal("Tree never went green")
+		return time.Time{}
+	}
+}
+
+func TestManualLaunches(t *testing.T) {
+	ts := newTestSession(t, Config{SessionID: "practice-1", Drivers: map[int]string{1: "Alice"}})
+
+	green := ts.run(t)
+	if _, err := ts.Run(); err == nil {
+		t.Error("Expected a second run to wait for the first")
+	}
+	if err := ts.Launch(1, green.Add(512*time.Millisecond)); err != nil {
+		t.Fatalf("Launch failed: %v", err)
+	}
+	if err := ts.Launch(1, green.Add(600*time.Millisecond)); err == nil {
+		t.Error("Expected a lane to launch once a run")
+	}
+	if len(ts.attempts) != 0 {
+		t.Fatal("Expected the run to wait for lane 2")
+	}
+	ts.Launch(2, green)
+
+	if len(ts.attempts) != 2 {
+		t.Fatalf("Expected an attempt per lane, got %+v", ts.attempts)
+	}
+	alice, lane2 := ts.attempts[0], ts.attempts[1]
+	if alice.Status != AttemptLaunched || *alice.ReactionTime != 0.512 || alice.Driver != "Alice" || alice.SessionID != "practice-1" || alice.Run != 1 {
+		t.Errorf("Unexpected attempt %+v", alice)
+	}
+	if !lane2.PerfectLight || *lane2.ReactionTime != 0 {
+		t.Errorf("Expected a perfect light in lane 2, got %+v", lane2)
+	}
+	if len(ts.stats) != 2 || ts.stats[0].Lane != 1 || *ts.stats[0].Best != 0.512 {
+		t.Errorf("Expected each lane's stats after the run, got %+v", ts.stats)
+	}
+}
+
+func TestRedLightAndNoLaunch(t *testing.T) {
+	ts := newTestSession(t, Config{Lanes: []int{1}})
+
+	// Lane 1 leaves before the tree comes down
+	if _, err := ts.Run(); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	start := ts.wheel.Now()
+	if err := ts.Launch(1, start.Add(300*time.Millisecond)); err != nil {
+		t.Fatalf("Launch failed: %v", err)
+	}
+	ts.wheel.BlockUntil(1)
+	ts.wheel.Step()
+	<-ts.green
+	if len(ts.attempts) != 1 || !ts.attempts[0].RedLight || *ts.attempts[0].ReactionTime != -0.1 {
+		t.Fatalf("Expected a -0.100 red light, got %+v", ts.attempts)
+	}
+
+	// Nobody launches on the next run
+	ts.run(t)
+	ts.wheel.BlockUntil(1)
+	ts.wheel.Advance(DefaultLaunchTimeout)
+	if len(ts.attempts) != 2 || ts.attempts[1].Status != AttemptNoLaunch || ts.attempts[1].ReactionTime != nil {
+		t.Fatalf("Expected a no launch after the timeout, got %+v", ts.attempts)
+	}
+
+	// An aborted run counts for nothing
+	ts.run(t)
+	if err := ts.Abort(); err != nil {
+		t.Fatalf("Abort failed: %v", err)
+	}
+	stats := ts.Stats()[1]
+	if stats.Attempts != 2 || stats.Launches != 1 || stats.RedLights != 1 || stats.RedLightPercent != 100 || stats.Average != nil {
+		t.Errorf("Expected a red light in two attempts and no legal launch, got %+v", stats)
+	}
+	if err := ts.Launch(1, time.Time{}); err == nil {
+		t.Error("Expected no launch between runs")
+	}
+}
+
+func TestSimulatedLaunches(t *testing.T) {
+	ts := newTestSession(t, Config{Simulator: simulation.Reference()})
+
+	for i := 0; i < 3; i++ {
+		ts.run(t)
+		// Both lanes' launches
+		ts.wheel.BlockUntil(3)
+		ts.wheel.Step()
+		ts.wheel.Step()
+	}
+
+	if len(ts.attempts) != 6 {
+		t.Fatalf("Expected three runs of two attempts, got %d", len(ts.attempts))
+	}
+	stats := ts.Stats()
+	left, right := stats[1], stats[2]
+	if left.Launches != 3 || math.Abs(*left.Average-0.4) > 1e-9 || *left.StdDev > 1e-9 || right.RedLightPercent != 0 || *right.Best != 0.45 {
+		t.Errorf("Expected the reference reaction times, got %+v and %+v", left, right)
+	}
+	if len(left.Distribution) != 1 || left.Distribution[0].Count != 3 || left.Distribution[0].From < 0.399 || left.Distribution[0].From > 0.401 {
+		t.Errorf("Expected lane 1's reaction times in one bucket, got %+v", left.Distribution)
+	}
+}
+
+func TestGhostOpponents(t *testing.T) {
+	ts := newTestSession(t, Config{Drivers: map[int]string{1: "Alice"}, Ghosts: map[int]string{2: "pro-stock"}})
+
+	green := ts.run(t)
+	if err := ts.Launch(1, green.Add(480*time.Millisecond)); err != nil {
+		t.Fatalf("Launch failed: %v", err)
+	}
+	// The ghost's launch
+	ts.wheel.BlockUntil(2)
+	ts.wheel.Step()
+
+	if len(ts.attempts) != 2 {
+		t.Fatalf("Expected the ghost to launch lane 2, got %+v", ts.attempts)
+	}
+	alice, ghost := ts.attempts[0], ts.attempts[1]
+	if *alice.ReactionTime != 0.48 || alice.Driver != "Alice" {
+		t.Errorf("Expected Alice's manual launch, got %+v", alice)
+	}
+	if ghost.Lane != 2 || ghost.Status != AttemptLaunched || *ghost.ReactionTime < 0 || *ghost.ReactionTime > 0.1 {
+		t.Errorf("Expected a pro stock reaction time in lane 2, got %+v", ghost)
+	}
+}
+
+func TestStats(t *testing.T) {
+	session := &Session{lanes: []int{1}}
+	for _, rt := range []float64{0.512, 0.498, -0.02, 0.505} {
+		rt := rt
+		session.attempts = append(session.attempts, Attempt{Lane: 1, Status: AttemptLaunched, ReactionTime: &rt, RedLight: rt < 0})
+	}
+	session.attempts = append(session.attempts, Attempt{Lane: 1, Status: AttemptNoLaunch})
+
+	stats := session.Stats()[1]
+	if stats.Attempts != 5 || stats.Launches != 4 || stats.RedLights != 1 || stats.RedLightPercent != 25 {
+		t.Errorf("Unexpected counts %+v", stats)
+	}
+	if *stats.Best != 0.498 || *stats.Average < 0.50499 || *stats.Average > 0.50501 {
+		t.Errorf("Expected best .498 and average .505, got %.3f and %.5f", *stats.Best, *stats.Average)
+	}
+	if len(stats.Distribution) != 4 || stats.Distribution[0].From >= 0 || stats.Distribution[2].Count != 1 {
+		t.Errorf("Expected the red light, .49x, .50x and .51x buckets, got %+v", stats.Distribution)
+	}
+}
+
+func TestNewSessionValidation(t *testing.T) {
+	bus := events.NewEventBus(false)
+	if _, err := NewSession(bus, config.NewDefaultConfig(), Config{Lanes: []int{3}}); err == nil {
+		t.Error("Expected a lane off the track to be rejected")
+	}
+	if _, err := NewSession(bus, config.NewDefaultConfig(), Config{Tree: &config.TreeSequenceConfig{Type: "hybrid"}}); err == nil {
+		t.Error("Expected an unknown tree to be rejected")
+	}
+	if _, err := NewSession(bus, config.NewDefaultConfig(), Config{Lanes: []int{1}, Ghosts: map[int]string{2: "pro-stock"}}); err == nil {
+		t.Error("Expected a ghost in a lane off the session to be rejected")
+	}
+	if _, err := NewSession(bus, config.NewDefaultConfig(), Config{Ghosts: map[int]string{2: "hovercraft"}}); err == nil {
+		t.Error("Expected an unknown preset to be rejected")
+	}
+}
@@ -0,0 +1,334 @@
+// Package records keeps each class's track records, detects new ones as
+// races complete and publishes records board updates for scoreboards and
+// persistence.
+package records
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/benharold/libdrag/pkg/events"
+	"github.com/benharold/libdrag/pkg/logs"
+	"github.com/benharold/libdrag/pkg/timers"
+	"github.com/benharold/libdrag/pkg/timing"
+)
+
+// Record kinds
+const (
+	KindET  = "et"  // Quickest elapsed time
+	KindMPH = "mph" // Fastest trap speed
+)
+
+// Record is a track record, or one that has since been broken
+type Record struct {
+	Class  string    `json:"class"`
+	Kind   string    `json:"kind"`
+	Holder string    `json:"holder"` // Driver registration
+	Value  float64   `json:"value"`  // Seconds or mph, by kind
+	RaceID string    `json:"race_id"`
+	Lane   int       `json:"lane"`
+	Date   string    `json:"date"` // Local date the record was set, "2006-01-02"
+	SetAt  time.Time `json:"set_at"`
+}
+
+// better reports whether value beats the record
+func (r Record) better(value float64) bool {
+	if r.Kind == KindET {
+		return value < r.Value
+	}
+	return value > r.Value
+}
+
+// Entry returns the class and driver registration of a race's lane, or ""
+// for either when the run cannot set a record
+type Entry func(raceID string, lane int) (class string, holder string)
+
+// key identifies a record
+type key struct {
+	class string
+	kind  string
+}
+
+// Book holds the track records. Legal runs (finished, clean, fully
+// electronically timed) that beat a class's ET or MPH record set a new one
+// and publish records.update. Each record keeps the ones it replaced, so a
+// record run disqualified later can be rolled back.
+type Book struct {
+	mu          sync.Mutex
+	bus         *events.EventBus
+	entry       Entry
+	history     map[key][]Record // Current record last
+	unsubscribe func()
+}
+
+// NewBook creates a record book seeded with existing records, such as the
+// History of a previous book loaded from storage
+func NewBook(bus *events.EventBus, entry Entry, existing []Record) *Book {
+	b := &Book{bus: bus, entry: entry, history: make(map[key][]Record)}
+	sorted := append([]Record(nil), existing...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].SetAt.Before(sorted[j].SetAt) })
+	for _, record := range sorted {
+		k := key{record.Class, record.Kind}
+		b.history[k] = append(b.history[k], record)
+	}
+	return b
+}
+
+// Start checks completed races for new records
+func (b *Book) Start() {
+	b.unsubscribe = b.bus.Subscribe(events.EventRaceComplete, b.HandleEvent)
+}
+
+// Stop stops checking races
+func (b *Book) Stop() {
+	if b.unsubscribe != nil {
+		b.unsubscribe()
+	}
+}
+
+// HandleEvent checks a completed race's runs against the records
+func (b *Book) HandleEvent(event events.Event) {
+	results, ok := event.Data["results"].(map[int]*timing.TimingResults)
+	if !ok || b.entry == nil {
+		return
+	}
+	at := event.Timestamp
+	if at.IsZero() {
+		at = timers.Now()
+	}
+
+	lanes := make([]int, 0, len(results))
+	for lane := range results {
+		lanes = append(lanes, lane)
+	}
+	sort.Ints(lanes)
+
+	var updates []events.Event
+	b.mu.Lock()
+	for _, lane := range lanes {
+		result := results[lane]
+		if !legal(result) {
+			continue
+		}
+		class, holder := b.entry(event.RaceID, lane)
+		if class == "" || holder == "" {
+			continue
+		}
+		for _, run := range []struct {
+			kind  string
+			value *float64
+		}{
+			{KindET, result.QuarterMileTime},
+			{KindMPH, result.TrapSpeed},
+		} {
+			if run.value == nil {
+				continue
+			}
+			record := Record{
+				Class:  class,
+				Kind:   run.kind,
+				Holder: holder,
+				Value:  *run.value,
+				RaceID: event.RaceID,
+				Lane:   lane,
+				Date:   at.Local().Format("2006-01-02"),
+				SetAt:  at,
+			}
+			if update, ok := b.set(record); ok {
+				updates = append(updates, update)
+			}
+		}
+	}
+	b.mu.Unlock()
+
+	b.publish(updates)
+}
+
+// legal reports whether a run can set a record
+func legal(result *timing.TimingResults) bool {
+	return result != nil && result.IsComplete && !result.IsFoul && !result.Breakout && result.Manual == nil
+}
+
+// set records a run that beats the current record. Caller holds b.mu.
+func (b *Book) set(record Record) (events.Event, bool) {
+	k := key{record.Class, record.Kind}
+	history := b.history[k]
+	var previous *Record
+	if len(history) > 0 {
+		current := history[len(history)-1]
+		if !current.better(record.Value) {
+			return events.Event{}, false
+		}
+		previous = &current
+	}
+	b.history[k] = append(history, record)
+	logs.For(nil, "records", "").Info("🏆 New track record", "class", record.Class, "kind", record.Kind, "holder", record.Holder, "value", record.Value)
+	return updateEvent(k, &record, previous, false), true
+}
+
+// Rollback removes the records set by a race, such as a record run later
+// disqualified at tech, restoring the records they replaced. A
+// records.update with rollback set is published for each current record
+// changed.
+func (b *Book) Rollback(raceID string) error {
+	var updates []events.Event
+	removed := false
+	b.mu.Lock()
+	for _, k := range b.keys() {
+		history := b.history[k]
+		current := history[len(history)-1]
+		kept := history[:0:0]
+		for _, record := range history {
+			if record.RaceID != raceID {
+				kept = append(kept, record)
+			}
+		}
+		if len(kept) == len(history) {
+			continue
+		}
+		removed = true
+		if len(kept) == 0 {
+			delete(b.history, k)
+		} else {
+			b.history[k] = kept
+		}
+		if current.RaceID == raceID {
+			var restored *Record
+			if len(kept) > 0 {
+				restored = &kept[len(kept)-1]
+			}
+			updates = append(updates, updateEvent(k, restored, &current, true))
+		}
+	}
+	b.mu.Unlock()
+
+	if !removed {
+		return fmt.Errorf("race %s set no records", raceID)
+	}
+	b.publish(updates)
+	return nil
+}
+
+// Forget erases a driver from the book for a privacy request and returns
+// how many records it changed. With a pseudonym, the driver's records are
+// kept under it; without one they are removed, restoring the records they
+// replaced. A records.update with erased set is published for each current
+// record changed; it never carries the erased registration.
+func (b *Book) Forget(holder, pseudonym string) int {
+	if holder == "" {
+		return 0
+	}
+	var updates []events.Event
+	changed := 0
+	b.mu.Lock()
+	for _, k := range b.keys() {
+		history := b.history[k]
+		current := history[len(history)-1]
+		kept := history[:0:0]
+		for _, record := range history {
+			if record.Holder != holder {
+				kept = append(kept, record)
+				continue
+			}
+			changed++
+			if pseudonym != "" {
+				record.Holder = pseudonym
+				kept = append(kept, record)
+			}
+		}
+		if len(kept) == 0 {
+			delete(b.history, k)
+		} else {
+			b.history[k] = kept
+		}
+		if current.Holder == holder {
+			var replacement *Record
+			if len(kept) > 0 {
+				replacement = &kept[len(kept)-1]
+			}
+			update := updateEvent(k, replacement, nil, pseudonym == "")
+			update.Data["erased"] = true
+			updates = append(updates, update)
+		}
+	}
+	b.mu.Unlock()
+
+	b.publish(updates)
+	return changed
+}
+
+// keys returns the records' keys by class, ET before MPH. Caller holds b.mu.
+func (b *Book) keys() []key {
+	keys := make([]key, 0, len(b.history))
+	for k := range b.history {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].class != keys[j].class {
+			return keys[i].class < keys[j].class
+		}
+		return keys[i].kind < keys[j].kind
+	})
+	return keys
+}
+
+// updateEvent builds the records board update for a record, or for a class
+// left without one after a rollback
+func updateEvent(k key, record *Record, previous *Record, rollback bool) events.Event {
+	builder := events.NewEvent(events.EventRecordsUpdate).
+		WithData("class", k.class).
+		WithData("kind", k.kind).
+		WithData("rollback", rollback)
+	if record != nil {
+		builder.WithRaceID(record.RaceID).
+			WithLane(record.Lane).
+			WithData("holder", record.Holder).
+			WithData("value", record.Value).
+			WithData("date", record.Date).
+			WithData("record", *record)
+	}
+	if previous != nil {
+		builder.WithData("previous", *previous)
+	}
+	return builder.Build()
+}
+
+// publish sends updates outside the lock so synchronous buses can
+// redeliver to us
+func (b *Book) publish(updates []events.Event) {
+	if b.bus == nil {
+		return
+	}
+	for _, update := range updates {
+		b.bus.Publish(update)
+	}
+}
+
+// Records returns the current records by class, ET before MPH
+func (b *Book) Records() []Record {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	records := make([]Record, 0, len(b.history))
+	for _, k := range b.keys() {
+		history := b.history[k]
+		records = append(records, history[len(history)-1])
+	}
+	return records
+}
+
+// History returns every record kept, including those since broken, oldest
+// first. Pass it to NewBook to restore the book.
+func (b *Book) History() []Record {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var records []Record
+	for _, k := range b.keys() {
+		records = append(records, b.history[k]...)
+	}
+	sort.SliceStable(records, func(i, j int) bool { return records[i].SetAt.Before(records[j].SetAt) })
+	return records
+}
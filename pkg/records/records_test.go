@@ -0,0 +1,110 @@
+package records
+
+import (
+	"testing"
+	"time"
+
+	"github.com/benharold/libdrag/pkg/events"
+	"github.com/benharold/libdrag/pkg/timing"
+)
+
+func run(et, mph float64) *timing.TimingResults {
+	return &timing.TimingResults{QuarterMileTime: &et, TrapSpeed: &mph, IsComplete: true}
+}
+
+func complete(bus *events.EventBus, raceID string, results map[int]*timing.TimingResults) {
+	bus.Publish(events.NewEvent(events.EventRaceComplete).WithRaceID(raceID).WithData("results", results).Build())
+}
+
+func TestNewRecords(t *testing.T) {
+	bus := events.NewEventBus(false)
+	var updates []events.Event
+	bus.Subscribe(events.EventRecordsUpdate, func(e events.Event) { updates = append(updates, e) })
+
+	drivers := map[string]map[int]string{
+		"race-1": {1: "PS-1", 2: "PS-2"},
+		"race-2": {1: "PS-3", 2: "PS-4"},
+	}
+	entry := func(raceID string, lane int) (string, string) { return "Pro Stock", drivers[raceID][lane] }
+	existing := []Record{{Class: "Pro Stock", Kind: KindET, Holder: "PS-9", Value: 6.55, SetAt: time.Now().Add(-time.Hour)}}
+	book := NewBook(bus, entry, existing)
+	book.Start()
+	defer book.Stop()
+
+	// Lane 1 sets the first MPH record and lane 2 resets the ET record
+	complete(bus, "race-1", map[int]*timing.TimingResults{1: run(6.56, 210.1), 2: run(6.54, 209.8)})
+	if len(updates) != 2 || updates[0].Data["kind"] != KindMPH || updates[0].Data["holder"] != "PS-1" || updates[1].Data["holder"] != "PS-2" {
+		t.Fatalf("Expected MPH and ET records, got %+v", updates)
+	}
+	if previous, _ := updates[1].Data["previous"].(Record); previous.Holder != "PS-9" {
+		t.Errorf("Expected the broken record in the update, got %+v", updates[1].Data["previous"])
+	}
+
+	// A breakout, a foul or a hand-timed run cannot set a record
+	breakout, foul, manual := run(6.40, 215), run(6.41, 215), run(6.42, 215)
+	breakout.Breakout = true
+	foul.IsFoul = true
+	manual.Manual = &timing.Provenance{EnteredBy: "tower"}
+	complete(bus, "race-2", map[int]*timing.TimingResults{1: breakout, 2: foul})
+	complete(bus, "race-2", map[int]*timing.TimingResults{1: manual})
+	if len(updates) != 2 {
+		t.Fatalf("Expected illegal runs to be ignored, got %+v", updates[2:])
+	}
+
+	// Race 1 is disqualified at tech
+	if err := book.Rollback("race-1"); err != nil {
+		t.Fatal(err)
+	}
+	records := book.Records()
+	if len(records) != 1 || records[0].Holder != "PS-9" {
+		t.Fatalf("Expected the previous ET record restored, got %+v", records)
+	}
+	if len(updates) != 4 || updates[2].Data["rollback"] != true || updates[3].Data["record"] != nil {
+		t.Errorf("Expected rollback updates restoring ET and clearing MPH, got %+v", updates[2:])
+	}
+	if err := book.Rollback("race-1"); err == nil {
+		t.Error("Expected an error rolling back a race that set no records")
+	}
+	if history := book.History(); len(history) != 1 {
+		t.Errorf("Expected only the restored record kept, got %+v", history)
+	}
+}
+
+func TestForget(t *testing.T) {
+	bus := events.NewEventBus(false)
+	var updates []events.Event
+	bus.Subscribe(events.EventRecordsUpdate, func(e events.Event) { updates = append(updates, e) })
+
+	at := time.Now().Add(-time.Hour)
+	book := NewBook(bus, nil, []Record{
+		{Class: "Pro Stock", Kind: KindET, Holder: "PS-1", Value: 6.56, RaceID: "race-1", SetAt: at},
+		{Class: "Pro Stock", Kind: KindET, Holder: "PS-2", Value: 6.54, RaceID: "race-2", SetAt: at.Add(time.Minute)},
+		{Class: "Pro Stock", Kind: KindMPH, Holder: "PS-2", Value: 210.1, RaceID: "race-2", SetAt: at.Add(time.Minute)},
+	})
+
+	// Anonymizing keeps the records under the pseudonym
+	if changed := book.Forget("PS-2", "anon-1"); changed != 2 {
+		t.Fatalf("Expected 2 records anonymized, got %d", changed)
+	}
+	records := book.Records()
+	if len(records) != 2 || records[0].Holder != "anon-1" || records[1].Holder != "anon-1" {
+		t.Fatalf("Expected the records kept under the pseudonym, got %+v", records)
+	}
+	if len(updates) != 2 || updates[0].Data["holder"] != "anon-1" || updates[0].Data["erased"] != true || updates[0].Data["previous"] != nil {
+		t.Errorf("Expected erased updates without the registration, got %+v", updates)
+	}
+
+	// Deleting restores the records the driver broke
+	if changed := book.Forget("anon-1", ""); changed != 2 {
+		t.Fatalf("Expected 2 records deleted, got %d", changed)
+	}
+	if records := book.Records(); len(records) != 1 || records[0].Holder != "PS-1" {
+		t.Errorf("Expected PS-1's ET record restored, got %+v", records)
+	}
+	if len(updates) != 4 || updates[2].Data["holder"] != "PS-1" || updates[3].Data["record"] != nil {
+		t.Errorf("Expected updates restoring ET and clearing MPH, got %+v", updates[2:])
+	}
+	if changed := book.Forget("PS-9", ""); changed != 0 || len(updates) != 4 {
+		t.Errorf("Expected nothing erased for a driver without records, got %d", changed)
+	}
+}
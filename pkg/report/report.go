@@ -0,0 +1,438 @@
+// Package report builds the end-of-event report: each class's qualifying
+// sheet, the eliminations round by round with final standings and payouts,
+// the track records set, and the incident log. A report renders as JSON for
+// other systems or as a plain text layout for the printer, one section per
+// page.
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/benharold/libdrag/pkg/audit"
+	"github.com/benharold/libdrag/pkg/eliminations"
+	"github.com/benharold/libdrag/pkg/export"
+	"github.com/benharold/libdrag/pkg/notify"
+	"github.com/benharold/libdrag/pkg/records"
+	"github.com/benharold/libdrag/pkg/timers"
+)
+
+// Format is a format Render writes a report in
+type Format string
+
+const (
+	FormatJSON Format = "json" // The Report, indented
+	FormatText Format = "text" // Fixed-width columns, a page per section
+)
+
+// Purse is what a class's eliminations pay by finish: the winner, the
+// runner-up, each semifinal loser, each quarterfinal loser, and so on back
+// through the rounds. Finishes past the end of the purse are paid nothing.
+type Purse []float64
+
+// Input is what a report is built from
+type Input struct {
+	Event string `json:"event,omitempty"` // Event name, for the heading
+
+	// Qualifying are the qualifying runs, such as LibDragAPI.ExportRaces
+	// with the tags.Qualifying tag. Runs are credited to their driver, or
+	// their car number when the driver was not exported.
+	Qualifying []export.Record `json:"qualifying"`
+
+	// Brackets are the classes' eliminations, and Runs the runs that
+	// decided their pairs. A run is matched to its seat by race ID and
+	// driver registration, so runs must be exported with drivers kept.
+	Brackets []eliminations.State `json:"brackets"`
+	Runs     []export.Record      `json:"runs"`
+
+	// Records is the record book's History; those set since Since are
+	// reported
+	Records []records.Record `json:"records"`
+
+	// Audit is the audit log; entries since Since make up the incident log
+	Audit []audit.Entry `json:"audit"`
+
+	// Purses pays out each class's eliminations, by class
+	Purses map[string]Purse `json:"purses,omitempty"`
+
+	// Since is when the event began. Zero reports every record and audit
+	// entry given.
+	Since time.Time `json:"since,omitempty"`
+}
+
+// Report is the end-of-event report
+type Report struct {
+	Event        string            `json:"event,omitempty"`
+	GeneratedAt  time.Time         `json:"generated_at"`
+	Qualifying   []QualifyingSheet `json:"qualifying"`   // By class
+	Eliminations []Bracket         `json:"eliminations"` // In the order given
+	Records      []RecordSet       `json:"records"`      // Oldest first
+	Incidents    []audit.Entry     `json:"incidents"`    // Oldest first
+	Fouls        []Foul            `json:"fouls"`        // Qualifying, then eliminations
+}
+
+// QualifyingSheet is a class's qualifying order
+type QualifyingSheet struct {
+	Class   string            `json:"class,omitempty"`
+	Entries []QualifyingEntry `json:"entries"` // Quickest first; entrants without a time last
+}
+
+// QualifyingEntry is an entrant's qualifying
+type QualifyingEntry struct {
+	Position   int      `json:"position,omitempty"` // 0 without a qualifying time
+	Entrant    string   `json:"entrant"`            // Driver registration, or car number
+	CarNumber  string   `json:"car_number,omitempty"`
+	Runs       int      `json:"runs"`
+	BestET     *float64 `json:"best_et,omitempty"`
+	Speed      *float64 `json:"speed,omitempty"` // Trap speed of the best ET run
+	BestRaceID string   `json:"best_race_id,omitempty"`
+}
+
+// Bracket is a class's eliminations
+type Bracket struct {
+	Class     string              `json:"class,omitempty"`
+	Ladder    eliminations.Ladder `json:"ladder"`
+	Champion  string              `json:"champion,omitempty"`
+	Rounds    []RoundResult       `json:"rounds"`
+	Standings []Standing          `json:"standings"`
+	Paid      float64             `json:"paid"` // Total paid out
+}
+
+// RoundResult is a round of eliminations
+type RoundResult struct {
+	Number int          `json:"number"`
+	Name   string       `json:"name"` // "Round 1", ..., "Semifinals", "Final"
+	Pairs  []PairResult `json:"pairs"`
+}
+
+// PairResult is a pair of a round and the runs that decided it
+type PairResult struct {
+	ID     string        `json:"id"`
+	Status string        `json:"status"`
+	RaceID string        `json:"race_id,omitempty"`
+	Winner string        `json:"winner,omitempty"`
+	Seats  [2]SeatResult `json:"seats"`
+}
+
+// SeatResult is an entrant's run in a pair. The run is nil for a bye, a
+// seat still to be filled, or a pair not yet run.
+type SeatResult struct {
+	eliminations.Seat
+	Run *export.Record `json:"run,omitempty"`
+}
+
+// Standing is an entrant's finish in eliminations
+type Standing struct {
+	Position     int     `json:"position,omitempty"` // Shared by the losers of a round; 0 while still racing
+	Seed         int     `json:"seed,omitempty"`
+	Registration string  `json:"registration"`
+	Name         string  `json:"name,omitempty"`
+	Round        int     `json:"round"` // Round lost in, or reached while still racing
+	Payout       float64 `json:"payout,omitempty"`
+}
+
+// RecordSet is a track record set at the event
+type RecordSet struct {
+	records.Record
+	Standing bool `json:"standing"` // Not broken again since
+}
+
+// Foul is a lane that fouled
+type Foul struct {
+	Session string `json:"session"` // "qualifying" or "eliminations"
+	RaceID  string `json:"race_id"`
+	Lane    int    `json:"lane"`
+	Class   string `json:"class,omitempty"`
+	Entrant string `json:"entrant,omitempty"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// Foul sessions
+const (
+	SessionQualifying   = "qualifying"
+	SessionEliminations = "eliminations"
+)
+
+// Build builds the report
+func Build(in Input) Report {
+	report := Report{
+		Event:        in.Event,
+		GeneratedAt:  timers.Now(),
+		Qualifying:   qualifying(in.Qualifying),
+		Eliminations: make([]Bracket, 0, len(in.Brackets)),
+		Records:      recordsSet(in.Records, in.Since),
+		Incidents:    make([]audit.Entry, 0),
+		Fouls:        append(fouls(SessionQualifying, in.Qualifying), fouls(SessionEliminations, in.Runs)...),
+	}
+	for _, state := range in.Brackets {
+		report.Eliminations = append(report.Eliminations, bracket(state, in.Runs, in.Purses[state.Class]))
+	}
+	for _, entry := range in.Audit {
+		if !entry.At.Before(in.Since) {
+			report.Incidents = append(report.Incidents, entry)
+		}
+	}
+	sort.SliceStable(report.Incidents, func(i, j int) bool { return report.Incidents[i].At.Before(report.Incidents[j].At) })
+	return report
+}
+
+// Render writes a report as JSON or as printable text
+func Render(report Report, format Format) ([]byte, error) {
+	switch format {
+	case FormatJSON:
+		return json.MarshalIndent(report, "", "  ")
+	case FormatText:
+		return renderText(report), nil
+	default:
+		return nil, fmt.Errorf("unknown report format %q", format)
+	}
+}
+
+// entrant names a run's entrant
+func entrant(run export.Record) string {
+	if run.Driver != "" {
+		return run.Driver
+	}
+	return run.CarNumber
+}
+
+// counts reports whether a run's time stands for qualifying. A red light
+// does not matter with no one in the other lane to race, but a boundary
+// foul or disqualification loses the run.
+func counts(run export.Record) bool {
+	if run.ElapsedTime == nil {
+		return false
+	}
+	return run.FoulReason != "boundary" && run.FoulReason != "disqualified"
+}
+
+// qualifying builds each class's qualifying sheet
+func qualifying(runs []export.Record) []QualifyingSheet {
+	byClass := make(map[string]map[string]*QualifyingEntry)
+	for _, run := range runs {
+		name := entrant(run)
+		if name == "" {
+			continue
+		}
+		entries, ok := byClass[run.Class]
+		if !ok {
+			entries = make(map[string]*QualifyingEntry)
+			byClass[run.Class] = entries
+		}
+		entry, ok := entries[name]
+		if !ok {
+			entry = &QualifyingEntry{Entrant: name, CarNumber: run.CarNumber}
+			entries[name] = entry
+		}
+		entry.Runs++
+		if counts(run) && (entry.BestET == nil || *run.ElapsedTime < *entry.BestET) {
+			entry.BestET, entry.Speed, entry.BestRaceID = run.ElapsedTime, run.Speed, run.RaceID
+		}
+	}
+
+	classes := make([]string, 0, len(byClass))
+	for class := range byClass {
+		classes = append(classes, class)
+	}
+	sort.Strings(classes)
+
+	sheets := make([]QualifyingSheet, 0, len(classes))
+	for _, class := range classes {
+		entries := make([]QualifyingEntry, 0, len(byClass[class]))
+		for _, entry := range byClass[class] {
+			entries = append(entries, *entry)
+		}
+		sort.Slice(entries, func(i, j int) bool {
+			a, b := entries[i], entries[j]
+			if (a.BestET == nil) != (b.BestET == nil) {
+				return a.BestET != nil
+			}
+			if a.BestET != nil && *a.BestET != *b.BestET {
+				return *a.BestET < *b.BestET
+			}
+			// Equal times go to the faster car, as NHRA breaks ties
+			if as, bs := speed(a.Speed), speed(b.Speed); as != bs {
+				return as > bs
+			}
+			return a.Entrant < b.Entrant
+		})
+		for i := range entries {
+			if entries[i].BestET != nil {
+				entries[i].Position = i + 1
+			}
+		}
+		sheets = append(sheets, QualifyingSheet{Class: class, Entries: entries})
+	}
+	return sheets
+}
+
+func speed(mph *float64) float64 {
+	if mph == nil {
+		return 0
+	}
+	return *mph
+}
+
+// roundName names a round of a bracket of rounds rounds
+func roundName(round, rounds int) string {
+	switch rounds - round {
+	case 0:
+		return "Final"
+	case 1:
+		return "Semifinals"
+	case 2:
+		return "Quarterfinals"
+	default:
+		return fmt.Sprintf("Round %d", round)
+	}
+}
+
+// bracket reports a class's eliminations
+func bracket(state eliminations.State, runs []export.Record, purse Purse) Bracket {
+	type seatKey struct {
+		raceID       string
+		registration string
+	}
+	byRace := make(map[seatKey]export.Record, len(runs))
+	for _, run := range runs {
+		if run.Driver != "" {
+			byRace[seatKey{run.RaceID, run.Driver}] = run
+		}
+	}
+
+	b := Bracket{
+		Class:    state.Class,
+		Ladder:   state.Ladder,
+		Champion: state.Champion,
+		Rounds:   make([]RoundResult, 0, len(state.Rounds)),
+	}
+	for _, round := range state.Rounds {
+		result := RoundResult{Number: round.Number, Name: roundName(round.Number, len(state.Rounds)), Pairs: make([]PairResult, 0, len(round.Pairs))}
+		for _, pair := range round.Pairs {
+			pr := PairResult{ID: pair.ID, Status: pair.Status, RaceID: pair.RaceID, Winner: pair.Winner}
+			for i, seat := range pair.Seats {
+				pr.Seats[i].Seat = seat
+				if run, ok := byRace[seatKey{pair.RaceID, seat.Registration}]; ok && pair.RaceID != "" {
+					pr.Seats[i].Run = &run
+				}
+			}
+			result.Pairs = append(result.Pairs, pr)
+		}
+		b.Rounds = append(b.Rounds, result)
+	}
+	b.Standings = standings(state, purse)
+	for _, standing := range b.Standings {
+		b.Paid += standing.Payout
+	}
+	return b
+}
+
+// standings ranks a bracket's entrants by the round they went out in. The
+// losers of a round share a finish: the runner-up is second, the semifinal
+// losers third, the quarterfinal losers fifth, and so on.
+func standings(state eliminations.State, purse Purse) []Standing {
+	rounds := len(state.Rounds)
+	entrants := make(map[string]*Standing)
+	for _, round := range state.Rounds {
+		for _, pair := range round.Pairs {
+			for _, seat := range pair.Seats {
+				if seat.Registration == "" {
+					continue
+				}
+				standing, ok := entrants[seat.Registration]
+				if !ok {
+					standing = &Standing{Seed: seat.Seed, Registration: seat.Registration, Name: seat.Name}
+					entrants[seat.Registration] = standing
+				}
+				if standing.Position == 0 {
+					standing.Round = round.Number
+				}
+			}
+			if pair.Status != eliminations.PairDecided {
+				continue
+			}
+			for _, seat := range pair.Seats {
+				if seat.Registration != "" && seat.Registration != pair.Winner {
+					// The losers of the final go out on finish 1 of the
+					// purse, a round earlier on finish 2, ...
+					entrants[seat.Registration].Position = place(rounds-round.Number+1, purse, entrants[seat.Registration])
+				}
+			}
+		}
+	}
+	if champion, ok := entrants[state.Champion]; ok {
+		champion.Position = place(0, purse, champion)
+	}
+
+	list := make([]Standing, 0, len(entrants))
+	for _, standing := range entrants {
+		list = append(list, *standing)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		a, b := list[i], list[j]
+		if (a.Position == 0) != (b.Position == 0) {
+			return a.Position == 0 // Still racing, ahead of those out
+		}
+		if a.Position != b.Position {
+			return a.Position < b.Position
+		}
+		if a.Round != b.Round {
+			return a.Round > b.Round
+		}
+		return a.Seed < b.Seed
+	})
+	return list
+}
+
+// place sets a standing's payout for finish (0 for the winner, 1 for the
+// runner-up, ...) and returns its position
+func place(finish int, purse Purse, standing *Standing) int {
+	if finish < len(purse) {
+		standing.Payout = purse[finish]
+	}
+	if finish == 0 {
+		return 1
+	}
+	return 1<<(finish-1) + 1
+}
+
+// recordsSet returns the records set since since, noting which still stand
+func recordsSet(history []records.Record, since time.Time) []RecordSet {
+	latest := make(map[[2]string]time.Time)
+	for _, record := range history {
+		k := [2]string{record.Class, record.Kind}
+		if record.SetAt.After(latest[k]) {
+			latest[k] = record.SetAt
+		}
+	}
+	set := make([]RecordSet, 0)
+	for _, record := range history {
+		if record.SetAt.Before(since) {
+			continue
+		}
+		set = append(set, RecordSet{Record: record, Standing: record.SetAt.Equal(latest[[2]string{record.Class, record.Kind}])})
+	}
+	sort.SliceStable(set, func(i, j int) bool { return set[i].SetAt.Before(set[j].SetAt) })
+	return set
+}
+
+// fouls lists the fouled runs
+func fouls(session string, runs []export.Record) []Foul {
+	list := make([]Foul, 0)
+	for _, run := range runs {
+		if run.Result != notify.ResultFoul {
+			continue
+		}
+		list = append(list, Foul{
+			Session: session,
+			RaceID:  run.RaceID,
+			Lane:    run.Lane,
+			Class:   run.Class,
+			Entrant: entrant(run),
+			Reason:  run.FoulReason,
+		})
+	}
+	return list
+}
@@ -0,0 +1,216 @@
+package report
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/benharold/libdrag/pkg/audit"
+	"github.com/benharold/libdrag/pkg/eliminations"
+	"github.com/benharold/libdrag/pkg/events"
+	"github.com/benharold/libdrag/pkg/export"
+	"github.com/benharold/libdrag/pkg/notify"
+	"github.com/benharold/libdrag/pkg/records"
+)
+
+func run(raceID string, lane int, driver string, et, mph float64, result string) export.Record {
+	rt := 0.05
+	return export.Record{
+		RaceID:       raceID,
+		Class:        "Pro Stock",
+		Lane:         lane,
+		Driver:       driver,
+		ReactionTime: &rt,
+		ElapsedTime:  &et,
+		Speed:        &mph,
+		Result:       result,
+	}
+}
+
+// decidedBracket runs a four-car Pro Stock bracket: Q4 upsets Q1, Q2 beats
+// Q3, and Q2 wins the final
+func decidedBracket(t *testing.T) eliminations.State {
+	t.Helper()
+	bus := events.NewEventBus(false)
+	bracket, err := eliminations.NewBracket(bus, "Pro Stock", eliminations.LadderPro, []eliminations.Entry{
+		{Registration: "Q1", Name: "Alice"}, {Registration: "Q2"}, {Registration: "Q3"}, {Registration: "Q4"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bracket.Start()
+	defer bracket.Stop()
+
+	for _, race := range []struct {
+		pair, raceID string
+		lanes        map[int]string
+		winner       int
+	}{
+		{"R1P1", "e-1", map[int]string{1: "Q1", 2: "Q4"}, 2},
+		{"R1P2", "e-2", map[int]string{1: "Q2", 2: "Q3"}, 1},
+		{"R2P1", "e-3", map[int]string{1: "Q2", 2: "Q4"}, 1},
+	} {
+		if err := bracket.AssignRace(race.pair, race.raceID, race.lanes); err != nil {
+			t.Fatal(err)
+		}
+		bus.Publish(events.NewEvent(events.EventRaceComplete).WithRaceID(race.raceID).WithData("winner_lane", race.winner).Build())
+	}
+	return bracket.State()
+}
+
+func TestBuild(t *testing.T) {
+	since := time.Date(2025, time.June, 7, 8, 0, 0, 0, time.UTC)
+	boundary := run("q-3", 2, "Q3", 6.51, 210, notify.ResultFoul)
+	boundary.FoulReason = "boundary"
+	redLight := run("q-2", 1, "Q2", 6.58, 209, notify.ResultFoul)
+	redLight.FoulReason = "red_light"
+
+	report := Build(Input{
+		Event: "Spring Nationals",
+		Qualifying: []export.Record{
+			run("q-1", 1, "Q1", 6.55, 211, notify.ResultWin),
+			run("q-1", 2, "Q2", 6.60, 209, notify.ResultLoss),
+			redLight, // Counts in qualifying
+			run("q-3", 1, "Q4", 6.55, 212, notify.ResultWin),
+			boundary, // Loses the run
+			{RaceID: "q-4", Class: "Pro Stock", Lane: 1, CarNumber: "777", Result: notify.ResultSingle},
+		},
+		Brackets: []eliminations.State{decidedBracket(t)},
+		Runs: []export.Record{
+			run("e-1", 1, "Q1", 6.57, 210, notify.ResultLoss),
+			run("e-1", 2, "Q4", 6.54, 211, notify.ResultWin),
+			run("e-3", 1, "Q2", 6.53, 212, notify.ResultWin),
+		},
+		Records: []records.Record{
+			{Class: "Pro Stock", Kind: records.KindET, Holder: "Q9", Value: 6.56, SetAt: since.Add(-24 * time.Hour)},
+			{Class: "Pro Stock", Kind: records.KindET, Holder: "Q4", Value: 6.54, RaceID: "e-1", SetAt: since.Add(3 * time.Hour)},
+			{Class: "Pro Stock", Kind: records.KindET, Holder: "Q2", Value: 6.53, RaceID: "e-3", SetAt: since.Add(5 * time.Hour)},
+		},
+		Audit: []audit.Entry{
+			{At: since.Add(4 * time.Hour), Action: audit.ActionInterlockOverride, Actor: "starter", RaceID: "e-2"},
+			{At: since.Add(-time.Hour), Action: audit.ActionTrackClear, Actor: "official"},
+		},
+		Purses: map[string]Purse{"Pro Stock": {10000, 5000, 2500}},
+		Since:  since,
+	})
+
+	if len(report.Qualifying) != 1 {
+		t.Fatalf("Expected one qualifying sheet, got %+v", report.Qualifying)
+	}
+	var order []string
+	for _, entry := range report.Qualifying[0].Entries {
+		order = append(order, entry.Entrant)
+	}
+	// Q4 and Q1 tie on ET and Q4 is faster; Q3's only time was lost to the
+	// boundary foul; the car without a driver is credited by car number
+	if strings.Join(order, " ") != "Q4 Q1 Q2 777 Q3" {
+		t.Errorf("Expected qualifying order Q4 Q1 Q2 777 Q3, got %v", order)
+	}
+	if q2 := report.Qualifying[0].Entries[2]; q2.Position != 3 || q2.Runs != 2 || *q2.BestET != 6.58 {
+		t.Errorf("Expected Q2 third on the red-light run, got %+v", q2)
+	}
+	if q3 := report.Qualifying[0].Entries[4]; q3.Position != 0 || q3.BestET != nil {
+		t.Errorf("Expected Q3 without a qualifying time, got %+v", q3)
+	}
+
+	elims := report.Eliminations[0]
+	if elims.Champion != "Q2" || len(elims.Rounds) != 2 || elims.Rounds[0].Name != "Semifinals" || elims.Rounds[1].Name != "Final" {
+		t.Fatalf("Unexpected eliminations %+v", elims)
+	}
+	upset := elims.Rounds[0].Pairs[0]
+	if upset.Seats[1].Run == nil || *upset.Seats[1].Run.ElapsedTime != 6.54 || upset.Seats[0].Name != "Alice" {
+		t.Errorf("Expected the pair's runs matched to their seats, got %+v", upset)
+	}
+	if elims.Rounds[0].Pairs[1].Seats[0].Run != nil {
+		t.Error("Expected no run for a race that was not given")
+	}
+
+	var standings []string
+	for _, standing := range elims.Standings {
+		standings = append(standings, standing.Registration)
+	}
+	if strings.Join(standings, " ") != "Q2 Q4 Q1 Q3" {
+		t.Errorf("Expected standings Q2 Q4 Q1 Q3, got %v", standings)
+	}
+	if s := elims.Standings; s[0].Payout != 10000 || s[1].Position != 2 || s[1].Payout != 5000 || s[2].Position != 3 || s[3].Position != 3 || s[3].Payout != 2500 {
+		t.Errorf("Unexpected standings %+v", s)
+	}
+	if elims.Paid != 20000 {
+		t.Errorf("Expected 20000 paid, got %v", elims.Paid)
+	}
+
+	if len(report.Records) != 2 || report.Records[0].Standing || !report.Records[1].Standing {
+		t.Errorf("Expected two records set, the first broken by the second, got %+v", report.Records)
+	}
+	if len(report.Incidents) != 1 || report.Incidents[0].Action != audit.ActionInterlockOverride {
+		t.Errorf("Expected only the override during the event, got %+v", report.Incidents)
+	}
+	if len(report.Fouls) != 2 || report.Fouls[0].Reason != "red_light" || report.Fouls[1].Entrant != "Q3" {
+		t.Errorf("Unexpected fouls %+v", report.Fouls)
+	}
+}
+
+// TestStandingsInProgress tests that entrants still racing rank ahead of
+// those out, without a finish
+func TestStandingsInProgress(t *testing.T) {
+	bus := events.NewEventBus(false)
+	bracket, err := eliminations.NewBracket(bus, "Super Gas", eliminations.LadderSportsman, []eliminations.Entry{
+		{Registration: "Q1"}, {Registration: "Q2"}, {Registration: "Q3"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bracket.Start()
+	defer bracket.Stop()
+	bracket.AssignRace("R1P1", "e-1", map[int]string{1: "Q1", 2: "Q3"})
+	bus.Publish(events.NewEvent(events.EventRaceComplete).WithRaceID("e-1").WithData("winner_lane", 1).Build())
+
+	standings := Build(Input{Brackets: []eliminations.State{bracket.State()}}).Eliminations[0].Standings
+	if len(standings) != 3 || standings[0].Position != 0 || standings[0].Round != 2 || standings[1].Position != 0 {
+		t.Fatalf("Expected Q1 and Q2 still racing in the final, got %+v", standings)
+	}
+	if out := standings[2]; out.Registration != "Q3" || out.Position != 3 || out.Round != 1 {
+		t.Errorf("Expected Q3 out in the semifinals, got %+v", out)
+	}
+}
+
+func TestRender(t *testing.T) {
+	report := Build(Input{
+		Event:      "Spring Nationals",
+		Qualifying: []export.Record{run("q-1", 1, "Q1", 6.55, 211, notify.ResultSingle)},
+		Brackets:   []eliminations.State{decidedBracket(t)},
+	})
+
+	data, err := Render(report, FormatJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Report
+	if err := json.Unmarshal(data, &decoded); err != nil || decoded.Eliminations[0].Champion != "Q2" {
+		t.Errorf("Expected the report as JSON, got %v: %s", err, data)
+	}
+
+	text, err := Render(report, FormatText)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pages := strings.Split(string(text), pageBreak)
+	if len(pages) != 4 {
+		t.Fatalf("Expected qualifying, eliminations, records and incident pages, got %d:\n%s", len(pages), text)
+	}
+	for _, want := range []string{"EVENT REPORT: Spring Nationals", "QUALIFYING: Pro Stock", "6.550"} {
+		if !strings.Contains(pages[0], want) {
+			t.Errorf("Expected %q on the first page:\n%s", want, pages[0])
+		}
+	}
+	for _, want := range []string{"Semifinals", "Q1 (Alice)", "Standings"} {
+		if !strings.Contains(pages[1], want) {
+			t.Errorf("Expected %q on the eliminations page:\n%s", want, pages[1])
+		}
+	}
+
+	if _, err := Render(report, "pdf"); err == nil {
+		t.Error("Expected an unknown format to be rejected")
+	}
+}
@@ -0,0 +1,217 @@
+package report
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/benharold/libdrag/pkg/audit"
+	"github.com/benharold/libdrag/pkg/eliminations"
+	"github.com/benharold/libdrag/pkg/records"
+)
+
+// pageBreak starts a new page on printers and in PDF converters fed the
+// text report
+const pageBreak = "\f"
+
+// renderText lays a report out as fixed-width text: the heading, then each
+// qualifying sheet, eliminations bracket, the records set and the incident
+// log on pages of their own
+func renderText(report Report) []byte {
+	var pages []string
+	for _, sheet := range report.Qualifying {
+		pages = append(pages, textQualifying(sheet))
+	}
+	for _, b := range report.Eliminations {
+		pages = append(pages, textBracket(b))
+	}
+	pages = append(pages, textRecords(report.Records), textIncidents(report.Incidents, report.Fouls))
+
+	var buf bytes.Buffer
+	title := "EVENT REPORT"
+	if report.Event != "" {
+		title += ": " + report.Event
+	}
+	fmt.Fprintf(&buf, "%s\nGenerated %s\n", title, report.GeneratedAt.Local().Format("2006-01-02 15:04"))
+	for i, page := range pages {
+		if i > 0 {
+			buf.WriteString(pageBreak)
+		}
+		buf.WriteString("\n")
+		buf.WriteString(page)
+	}
+	return buf.Bytes()
+}
+
+// heading underlines a section title
+func heading(title string) string {
+	return title + "\n" + strings.Repeat("=", len(title)) + "\n"
+}
+
+// table lays rows out in aligned columns
+func table(header string, rows []string) string {
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, header)
+	for _, row := range rows {
+		fmt.Fprintln(w, row)
+	}
+	w.Flush()
+	return buf.String()
+}
+
+// seconds formats a time to three places, or "-" when there is none
+func seconds(value *float64) string {
+	if value == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%.3f", *value)
+}
+
+// mph formats a trap speed to two places, or "-" when there is none
+func mph(value *float64) string {
+	if value == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%.2f", *value)
+}
+
+// position formats a place, or "-" for none
+func position(place int) string {
+	if place == 0 {
+		return "-"
+	}
+	return fmt.Sprint(place)
+}
+
+// className names a class, or "Open" for races without one
+func className(class string) string {
+	if class == "" {
+		return "Open"
+	}
+	return class
+}
+
+func textQualifying(sheet QualifyingSheet) string {
+	rows := make([]string, 0, len(sheet.Entries))
+	for _, entry := range sheet.Entries {
+		rows = append(rows, fmt.Sprintf("%s\t%s\t%s\t%d\t%s\t%s\t%s",
+			position(entry.Position), entry.Entrant, entry.CarNumber, entry.Runs, seconds(entry.BestET), mph(entry.Speed), entry.BestRaceID))
+	}
+	return heading("QUALIFYING: "+className(sheet.Class)) + "\n" +
+		table("POS\tENTRANT\tCAR\tRUNS\tET\tMPH\tRACE", rows)
+}
+
+func textBracket(b Bracket) string {
+	var buf bytes.Buffer
+	buf.WriteString(heading(fmt.Sprintf("ELIMINATIONS: %s (%s ladder)", className(b.Class), b.Ladder)))
+	for _, round := range b.Rounds {
+		fmt.Fprintf(&buf, "\n%s\n", round.Name)
+		var rows []string
+		for _, pair := range round.Pairs {
+			for i, seat := range pair.Seats {
+				id := ""
+				if i == 0 {
+					id = pair.ID
+				}
+				rows = append(rows, id+"\t"+textSeat(seat, pair))
+			}
+		}
+		buf.WriteString(table("PAIR\tSEED\tENTRANT\tLANE\tRT\tET\tMPH\tRESULT", rows))
+	}
+
+	fmt.Fprintf(&buf, "\nStandings\n")
+	rows := make([]string, 0, len(b.Standings))
+	for _, standing := range b.Standings {
+		rows = append(rows, fmt.Sprintf("%s\t%s\t%s\t%s\t%.2f",
+			position(standing.Position), position(standing.Seed), seatName(standing.Registration, standing.Name), roundName(standing.Round, len(b.Rounds)), standing.Payout))
+	}
+	buf.WriteString(table("POS\tSEED\tENTRANT\tROUND\tPAYOUT", rows))
+	fmt.Fprintf(&buf, "Paid %.2f\n", b.Paid)
+	return buf.String()
+}
+
+// seatName names an entrant, with their display name when known
+func seatName(registration, name string) string {
+	if name == "" {
+		return registration
+	}
+	return fmt.Sprintf("%s (%s)", registration, name)
+}
+
+// textSeat lays out a seat of a pair, after its pair column
+func textSeat(seat SeatResult, pair PairResult) string {
+	if seat.Registration == "" {
+		if pair.Status == eliminations.PairBye {
+			return "-\tbye\t\t\t\t\t"
+		}
+		return "-\tTBD\t\t\t\t\t"
+	}
+	result := ""
+	if pair.Winner == seat.Registration {
+		result = "WIN"
+	}
+	run := seat.Run
+	if run == nil {
+		return fmt.Sprintf("%s\t%s\t-\t-\t-\t-\t%s", position(seat.Seed), seatName(seat.Registration, seat.Name), result)
+	}
+	if run.FoulReason != "" && result == "" {
+		result = strings.ToUpper(strings.ReplaceAll(run.FoulReason, "_", " "))
+	}
+	return fmt.Sprintf("%s\t%s\t%d\t%s\t%s\t%s\t%s",
+		position(seat.Seed), seatName(seat.Registration, seat.Name), run.Lane, seconds(run.ReactionTime), seconds(run.ElapsedTime), mph(run.Speed), result)
+}
+
+func textRecords(set []RecordSet) string {
+	if len(set) == 0 {
+		return heading("RECORDS SET") + "\nNone\n"
+	}
+	rows := make([]string, 0, len(set))
+	for _, record := range set {
+		value := fmt.Sprintf("%.3f", record.Value)
+		if record.Kind != records.KindET {
+			value = fmt.Sprintf("%.2f", record.Value)
+		}
+		standing := "broken"
+		if record.Standing {
+			standing = "standing"
+		}
+		rows = append(rows, fmt.Sprintf("%s\t%s\t%s\t%s\t%s\t%s\t%s",
+			className(record.Class), strings.ToUpper(record.Kind), value, record.Holder, record.RaceID, timeOfDay(record.SetAt), standing))
+	}
+	return heading("RECORDS SET") + "\n" +
+		table("CLASS\tKIND\tVALUE\tHOLDER\tRACE\tSET AT\tSTATUS", rows)
+}
+
+func textIncidents(incidents []audit.Entry, fouls []Foul) string {
+	var buf bytes.Buffer
+	buf.WriteString(heading("INCIDENT LOG"))
+	if len(incidents) == 0 {
+		buf.WriteString("\nNone\n")
+	} else {
+		rows := make([]string, 0, len(incidents))
+		for _, entry := range incidents {
+			rows = append(rows, fmt.Sprintf("%s\t%s\t%s\t%s\t%s", timeOfDay(entry.At), entry.Action, entry.Actor, entry.RaceID, entry.Detail))
+		}
+		buf.WriteString("\n" + table("TIME\tACTION\tBY\tRACE\tDETAIL", rows))
+	}
+
+	fmt.Fprintf(&buf, "\nFouls\n")
+	if len(fouls) == 0 {
+		buf.WriteString("None\n")
+		return buf.String()
+	}
+	rows := make([]string, 0, len(fouls))
+	for _, foul := range fouls {
+		rows = append(rows, fmt.Sprintf("%s\t%s\t%s\t%d\t%s\t%s", foul.Session, className(foul.Class), foul.RaceID, foul.Lane, foul.Entrant, foul.Reason))
+	}
+	buf.WriteString(table("SESSION\tCLASS\tRACE\tLANE\tENTRANT\tREASON", rows))
+	return buf.String()
+}
+
+// timeOfDay formats a time as the local date and time
+func timeOfDay(at time.Time) string {
+	return at.Local().Format("2006-01-02 15:04:05")
+}
@@ -0,0 +1,62 @@
+package results
+
+import (
+	"fmt"
+
+	"github.com/benharold/libdrag/pkg/handicap"
+	"github.com/benharold/libdrag/pkg/timing"
+)
+
+// feetPerSecondPerMPH converts a trap speed to feet per second
+const feetPerSecondPerMPH = 5280.0 / 3600.0
+
+// MarginFeet converts a margin of victory in seconds to the distance the
+// trailing car was behind at the stripe, assuming it crossed at trapSpeed
+// (mph)
+func MarginFeet(margin float64, trapSpeed float64) float64 {
+	return margin * trapSpeed * feetPerSecondPerMPH
+}
+
+// FormatMargin formats a margin of victory the way boards and slips show it:
+// seconds to four places, with the distance at the trailing car's trap speed
+// when it is known ("0.0123 sec (2.6 ft)"). Distances under a foot are shown
+// in inches.
+func FormatMargin(margin float64, trapSpeed float64) string {
+	seconds := fmt.Sprintf("%.4f sec", margin)
+	if trapSpeed <= 0 {
+		return seconds
+	}
+	feet := MarginFeet(margin, trapSpeed)
+	if feet < 1 {
+		return fmt.Sprintf("%s (%.0f in)", seconds, feet*12)
+	}
+	return fmt.Sprintf("%s (%.1f ft)", seconds, feet)
+}
+
+// FormatDecisionMargin formats a decision's margin using the trap speed of
+// the trailing car. It returns "" when the decision has no winner or no
+// margin, such as a single or a foul.
+func FormatDecisionMargin(decision Decision, results map[int]*timing.TimingResults) string {
+	if decision.WinnerLane == 0 || decision.Margin <= 0 {
+		return ""
+	}
+	var trapSpeed float64
+	for lane, result := range results {
+		if lane != decision.WinnerLane && result != nil && result.TrapSpeed != nil {
+			trapSpeed = *result.TrapSpeed
+		}
+	}
+	return FormatMargin(decision.Margin, trapSpeed)
+}
+
+// Package is a bracket run's total: reaction time plus how far the elapsed
+// time was over the dial-in. A red light or a breakout (elapsed under the
+// dial) has no package, and ok is false.
+func Package(reaction float64, elapsed float64, dial float64) (total float64, ok bool) {
+	return handicap.Package(reaction, elapsed, dial)
+}
+
+// FormatPackage formats a package total ("0.012 total")
+func FormatPackage(total float64) string {
+	return fmt.Sprintf("%.3f total", total)
+}
@@ -0,0 +1,118 @@
+package results
+
+import (
+	"fmt"
+
+	"github.com/benharold/libdrag/pkg/handicap"
+	"github.com/benharold/libdrag/pkg/timing"
+)
+
+// Rule is one step of the foul precedence ruleset
+type Rule string
+
+const (
+	RuleRedLight      Rule = "red_light"       // Left before green; the earlier start loses if both did
+	RuleBoundary      Rule = "boundary"        // Crossed the centerline or lane boundary
+	RuleFoul          Rule = "foul"            // Any other foul (staging, deep stage, ...)
+	RuleBreakout      Rule = "breakout"        // Ran quicker than the dial-in; the bigger breakout loses if both did
+	RuleFirstToFinish Rule = "first_to_finish" // First clean car to the stripe
+	RuleOfficial      Rule = "official"        // An official's ruling (recorded in chains only)
+	RuleFirstOrWorst  Rule = "first_or_worst"  // Cross-lane foul ruling (recorded in chains only)
+	RuleDisqualified  Rule = "disqualified"    // A starter's disqualification (recorded in chains only)
+)
+
+// DefaultPrecedence is the usual sanctioning order: the first foul committed
+// loses, so a red light outranks an opponent's later boundary violation, and
+// any foul outranks a breakout
+var DefaultPrecedence = []Rule{RuleRedLight, RuleBoundary, RuleFoul, RuleBreakout, RuleFirstToFinish}
+
+// Step outcomes
+const (
+	OutcomeClear  = "clear"  // No lane broke the rule
+	OutcomeLoss   = "loss"   // Lanes eliminated by the rule
+	OutcomeWin    = "win"    // Lane declared the winner
+	OutcomeReview = "review" // Finish held for an official
+	OutcomeNone   = "none"   // No lane could be declared the winner
+)
+
+// Step records the evaluation of one rule in a decision
+type Step struct {
+	Rule    Rule   `json:"rule"`
+	Lanes   []int  `json:"lanes,omitempty"`
+	Outcome string `json:"outcome"`
+}
+
+// ParsePrecedence converts configured rule names into a precedence order
+func ParsePrecedence(names []string) ([]Rule, error) {
+	rules := make([]Rule, 0, len(names))
+	seen := make(map[Rule]bool, len(names))
+	for _, name := range names {
+		rule := Rule(name)
+		switch rule {
+		case RuleRedLight, RuleBoundary, RuleFoul, RuleBreakout, RuleFirstToFinish:
+		default:
+			return nil, fmt.Errorf("unknown precedence rule %q", name)
+		}
+		if seen[rule] {
+			return nil, fmt.Errorf("precedence rule %q listed twice", name)
+		}
+		seen[rule] = true
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// losers returns the lanes eliminated by the rule
+func (r Rule) losers(results map[int]*timing.TimingResults, lanes []int, dialIns map[int]float64) []int {
+	var offenders []int
+	for _, lane := range lanes {
+		if r.brokenBy(results[lane], dialIns) {
+			offenders = append(offenders, lane)
+		}
+	}
+	if len(offenders) < 2 {
+		return offenders
+	}
+
+	// When both lanes break a measurable rule, the worse offence loses
+	var severity func(lane int) float64
+	switch r {
+	case RuleRedLight:
+		severity = func(lane int) float64 { return -*results[lane].ReactionTime }
+	case RuleBreakout:
+		severity = func(lane int) float64 {
+			by, _ := handicap.Breakout(*results[lane].QuarterMileTime, dialIns[lane])
+			return by
+		}
+	default:
+		return offenders
+	}
+
+	worst := offenders[0]
+	for _, lane := range offenders[1:] {
+		if severity(lane) > severity(worst) {
+			worst = lane
+		}
+	}
+	return []int{worst}
+}
+
+// brokenBy reports whether a lane's run breaks the rule
+func (r Rule) brokenBy(result *timing.TimingResults, dialIns map[int]float64) bool {
+	switch r {
+	case RuleRedLight:
+		return result.IsFoul && result.FoulReason == "red_light" && result.ReactionTime != nil
+	case RuleBoundary:
+		return result.IsFoul && (result.FoulReason == "boundary" || result.FoulReason == "centerline")
+	case RuleFoul:
+		return result.IsFoul && !RuleRedLight.brokenBy(result, dialIns) && !RuleBoundary.brokenBy(result, dialIns)
+	case RuleBreakout:
+		dial, ok := dialIns[result.Lane]
+		if !ok || result.IsFoul || result.QuarterMileTime == nil {
+			return false
+		}
+		_, broke := handicap.Breakout(*result.QuarterMileTime, dial)
+		return broke
+	}
+	return false
+}
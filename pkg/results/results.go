@@ -0,0 +1,288 @@
+// Package results decides the outcome of a pair from the lanes' timing results.
+package results
+
+import (
+	"sort"
+	"time"
+
+	"github.com/benharold/libdrag/pkg/fouls"
+	"github.com/benharold/libdrag/pkg/timers"
+	"github.com/benharold/libdrag/pkg/timing"
+)
+
+// Decision reasons
+const (
+	ReasonFirstToFinish = "first_to_finish"       // Both ran clean; first to the stripe wins
+	ReasonOpponentFoul  = "opponent_foul"         // The opponent lost on a foul
+	ReasonDisqualified  = "opponent_disqualified" // The starter disqualified the opponent
+	ReasonBreakout      = "opponent_breakout"     // The opponent broke out (or broke out by more)
+	ReasonSingle        = "single"                // Solo run or bye
+	ReasonPhotoFinish   = "photo_finish"          // Too close to call; held for review
+	ReasonOfficial      = "official"              // Winner declared by an official
+	ReasonNoWinner      = "no_winner"             // Nobody finished clean
+	ReasonManualReview  = "manual_review"         // A manual ET cannot be placed at the stripe
+)
+
+// finishBeam is the beam that decides the race
+const finishBeam = "1320_foot"
+
+// Decision is the outcome of a pair
+type Decision struct {
+	WinnerLane  int     `json:"winner_lane,omitempty"` // Zero while under review or with no winner
+	Reason      string  `json:"reason"`
+	Margin      float64 `json:"margin,omitempty"` // Seconds between the cars at the stripe
+	UnderReview bool    `json:"under_review"`     // Held for an official's ruling
+	Chain       []Step  `json:"chain"`            // Rules evaluated, in precedence order
+
+	// Foul is the first-or-worst ruling when more than one lane fouled
+	Foul *fouls.Ruling `json:"foul_ruling,omitempty"`
+
+	// Degraded lists the lanes whose times are less accurate than the
+	// published thousandths (hand-timed, say), so reports can disclose it
+	Degraded []DegradedRun `json:"degraded,omitempty"`
+
+	// MarginUncertain is set when the margin is within the combined
+	// uncertainty of the two finishers' times
+	MarginUncertain bool `json:"margin_uncertain,omitempty"`
+}
+
+// DegradedRun is a lane whose times are of degraded accuracy
+type DegradedRun struct {
+	Lane     int             `json:"lane"`
+	Accuracy timers.Accuracy `json:"accuracy"` // Least accurate source of the lane's times
+}
+
+// Rules configures how a pair is decided
+type Rules struct {
+	Precedence        []Rule          // Evaluation order; empty uses DefaultPrecedence
+	PhotoFinishWindow time.Duration   // Finishes this close are held for review (0 = never)
+	DialIns           map[int]float64 // Lane -> dial-in, for breakout rules
+	Ruling            *fouls.Ruling   // Cross-lane foul ruling, applied before Precedence
+	Disqualified      []int           // Lanes disqualified by the starter, eliminated before anything else
+}
+
+// Decide determines the winner with the default foul precedence. The first
+// clean car to the finish line wins, unless both cars are clean and reach
+// the line within photoFinishWindow of each other, in which case the finish
+// is held for review. A zero window never holds a finish.
+func Decide(results map[int]*timing.TimingResults, photoFinishWindow time.Duration) Decision {
+	return DecideWithRules(results, Rules{PhotoFinishWindow: photoFinishWindow})
+}
+
+// DecideWithRules evaluates the precedence rules in order. The first rule a
+// lane breaks eliminates it; once one lane remains it wins. The chain of
+// rules evaluated is recorded so the decision can be explained. A foul
+// ruling eliminates its losing lane first and forgives the other lane's
+// foul when that leaves a single lane. Lanes the starter disqualified are
+// eliminated before the ruling. Lanes whose times are of degraded
+// accuracy are listed in the decision's Degraded.
+func DecideWithRules(results map[int]*timing.TimingResults, rules Rules) Decision {
+	decision := decideWithRules(results, rules)
+	decision.Degraded = degradedRuns(results)
+	return decision
+}
+
+// decideWithRules decides the pair for DecideWithRules
+func decideWithRules(results map[int]*timing.TimingResults, rules Rules) Decision {
+	precedence := rules.Precedence
+	if len(precedence) == 0 {
+		precedence = DefaultPrecedence
+	}
+
+	remaining := make([]int, 0, len(results))
+	for lane := range results {
+		remaining = append(remaining, lane)
+	}
+	sort.Ints(remaining)
+
+	var chain []Step
+	var disqualified []int
+	for _, lane := range remaining {
+		if containsLane(rules.Disqualified, lane) {
+			disqualified = append(disqualified, lane)
+		}
+	}
+	if len(disqualified) > 0 {
+		chain = append(chain, Step{Rule: RuleDisqualified, Lanes: disqualified, Outcome: OutcomeLoss})
+		remaining = without(remaining, disqualified)
+		switch len(remaining) {
+		case 0:
+			return Decision{Reason: ReasonNoWinner, Chain: chain, Foul: rules.Ruling}
+		case 1:
+			chain = append(chain, Step{Rule: RuleDisqualified, Lanes: remaining, Outcome: OutcomeWin})
+			return Decision{WinnerLane: remaining[0], Reason: ReasonDisqualified, Chain: chain, Foul: rules.Ruling}
+		}
+	}
+
+	if ruling := rules.Ruling; ruling != nil && containsLane(remaining, ruling.LosingLane) {
+		chain = append(chain, Step{Rule: RuleFirstOrWorst, Lanes: []int{ruling.LosingLane}, Outcome: OutcomeLoss})
+		remaining = without(remaining, []int{ruling.LosingLane})
+		if len(remaining) == 1 {
+			chain = append(chain, Step{Rule: RuleFirstOrWorst, Lanes: remaining, Outcome: OutcomeWin})
+			return Decision{WinnerLane: remaining[0], Reason: ReasonOpponentFoul, Chain: chain, Foul: ruling}
+		}
+	}
+
+	decision := decideRemaining(results, remaining, precedence, rules, chain)
+	decision.Foul = rules.Ruling
+	return decision
+}
+
+// decideRemaining evaluates the precedence rules for lanes still in the race
+func decideRemaining(results map[int]*timing.TimingResults, remaining []int, precedence []Rule, rules Rules, chain []Step) Decision {
+	for _, rule := range precedence {
+		if rule == RuleFirstToFinish {
+			break
+		}
+
+		losers := rule.losers(results, remaining, rules.DialIns)
+		if len(losers) == 0 {
+			chain = append(chain, Step{Rule: rule, Outcome: OutcomeClear})
+			continue
+		}
+		chain = append(chain, Step{Rule: rule, Lanes: losers, Outcome: OutcomeLoss})
+		remaining = without(remaining, losers)
+
+		if len(remaining) == 0 {
+			return Decision{Reason: ReasonNoWinner, Chain: chain}
+		}
+		if len(remaining) == 1 {
+			reason := ReasonOpponentFoul
+			if rule == RuleBreakout {
+				reason = ReasonBreakout
+			}
+			chain = append(chain, Step{Rule: rule, Lanes: remaining, Outcome: OutcomeWin})
+			return Decision{WinnerLane: remaining[0], Reason: reason, Chain: chain}
+		}
+	}
+
+	decision := firstToFinish(results, remaining, len(results) == 1, rules.PhotoFinishWindow)
+	step := Step{Rule: RuleFirstToFinish, Outcome: OutcomeWin}
+	switch {
+	case decision.UnderReview:
+		step.Outcome = OutcomeReview
+	case decision.WinnerLane == 0:
+		step.Outcome = OutcomeNone
+	default:
+		step.Lanes = []int{decision.WinnerLane}
+	}
+	decision.Chain = append(chain, step)
+	return decision
+}
+
+// firstToFinish decides between lanes that broke no precedence rule
+func firstToFinish(results map[int]*timing.TimingResults, lanes []int, single bool, photoFinishWindow time.Duration) Decision {
+	type finisher struct {
+		lane int
+		at   time.Time
+	}
+	var clean []finisher
+	unplaced := false
+	for _, lane := range lanes {
+		result := results[lane]
+		if result.IsFoul {
+			continue
+		}
+		if at, ok := finishTime(result); ok {
+			clean = append(clean, finisher{lane, at})
+		} else if result.IsComplete {
+			unplaced = true
+		}
+	}
+
+	if unplaced {
+		// A hand-timed ET without a start time cannot be compared at the stripe
+		return Decision{Reason: ReasonManualReview, UnderReview: true}
+	}
+
+	switch len(clean) {
+	case 0:
+		return Decision{Reason: ReasonNoWinner}
+	case 1:
+		if single {
+			return Decision{WinnerLane: clean[0].lane, Reason: ReasonSingle}
+		}
+		return Decision{WinnerLane: clean[0].lane, Reason: ReasonOpponentFoul}
+	}
+
+	sort.Slice(clean, func(i, j int) bool {
+		if clean[i].at.Equal(clean[j].at) {
+			return clean[i].lane < clean[j].lane
+		}
+		return clean[i].at.Before(clean[j].at)
+	})
+	first, second := clean[0], clean[1]
+	margin := second.at.Sub(first.at)
+
+	decision := Decision{Margin: margin.Seconds()}
+	uncertainty := results[first.lane].Accuracy().Duration() + results[second.lane].Accuracy().Duration()
+	decision.MarginUncertain = margin < uncertainty
+	if photoFinishWindow > 0 && margin <= photoFinishWindow {
+		decision.Reason = ReasonPhotoFinish
+		decision.UnderReview = true
+		return decision
+	}
+	decision.WinnerLane = first.lane
+	decision.Reason = ReasonFirstToFinish
+	return decision
+}
+
+// degradedRuns returns the lanes whose times are of degraded accuracy, in
+// lane order
+func degradedRuns(results map[int]*timing.TimingResults) []DegradedRun {
+	var degraded []DegradedRun
+	for lane, result := range results {
+		if accuracy := result.Accuracy(); accuracy.Degraded() {
+			degraded = append(degraded, DegradedRun{Lane: lane, Accuracy: accuracy})
+		}
+	}
+	sort.Slice(degraded, func(i, j int) bool { return degraded[i].Lane < degraded[j].Lane })
+	return degraded
+}
+
+// finishTime returns when a lane crossed the finish line. A manually entered
+// ET takes precedence over the finish beam and is placed from the start.
+func finishTime(result *timing.TimingResults) (time.Time, bool) {
+	manualET := result.Manual != nil && result.QuarterMileTime != nil
+	if at, ok := result.BeamTriggers[finishBeam]; ok && !manualET {
+		return at, true
+	}
+	if result.QuarterMileTime != nil && !result.StartTime.IsZero() {
+		return result.StartTime.Add(time.Duration(*result.QuarterMileTime * float64(time.Second))), true
+	}
+	return time.Time{}, false
+}
+
+// Resolve records an official's ruling on a finish under review
+func (d Decision) Resolve(winnerLane int) Decision {
+	d.WinnerLane = winnerLane
+	d.Reason = ReasonOfficial
+	d.UnderReview = false
+	d.Chain = append(append([]Step(nil), d.Chain...), Step{Rule: RuleOfficial, Lanes: []int{winnerLane}, Outcome: OutcomeWin})
+	return d
+}
+
+// Same reports whether two decisions have the same outcome
+func (d Decision) Same(other Decision) bool {
+	return d.WinnerLane == other.WinnerLane && d.Reason == other.Reason && d.UnderReview == other.UnderReview
+}
+
+// without returns lanes minus removed
+func without(lanes, removed []int) []int {
+	var kept []int
+	for _, lane := range lanes {
+		if !containsLane(removed, lane) {
+			kept = append(kept, lane)
+		}
+	}
+	return kept
+}
+
+func containsLane(lanes []int, lane int) bool {
+	for _, l := range lanes {
+		if l == lane {
+			return true
+		}
+	}
+	return false
+}
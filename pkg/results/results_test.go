@@ -0,0 +1,278 @@
+package results
+
+import (
+	"testing"
+	"time"
+
+	"github.com/benharold/libdrag/pkg/fouls"
+	"github.com/benharold/libdrag/pkg/timers"
+	"github.com/benharold/libdrag/pkg/timing"
+)
+
+func finish(lane int, at time.Time) *timing.TimingResults {
+	return &timing.TimingResults{Lane: lane, BeamTriggers: map[string]time.Time{"1320_foot": at}}
+}
+
+func TestDecide(t *testing.T) {
+	now := time.Now()
+	window := 500 * time.Microsecond
+
+	tests := []struct {
+		name     string
+		results  map[int]*timing.TimingResults
+		expected Decision
+	}{
+		{
+			name:     "first to finish",
+			results:  map[int]*timing.TimingResults{1: finish(1, now.Add(10*time.Millisecond)), 2: finish(2, now)},
+			expected: Decision{WinnerLane: 2, Reason: ReasonFirstToFinish, Margin: 0.01},
+		},
+		{
+			name:     "photo finish",
+			results:  map[int]*timing.TimingResults{1: finish(1, now), 2: finish(2, now.Add(400*time.Microsecond))},
+			expected: Decision{Reason: ReasonPhotoFinish, Margin: 0.0004, UnderReview: true},
+		},
+		{
+			name:     "dead heat",
+			results:  map[int]*timing.TimingResults{1: finish(1, now), 2: finish(2, now)},
+			expected: Decision{Reason: ReasonPhotoFinish, UnderReview: true},
+		},
+		{
+			name: "opponent foul",
+			results: map[int]*timing.TimingResults{
+				1: {Lane: 1, IsFoul: true, BeamTriggers: map[string]time.Time{"1320_foot": now}},
+				2: finish(2, now.Add(time.Second)),
+			},
+			expected: Decision{WinnerLane: 2, Reason: ReasonOpponentFoul},
+		},
+		{
+			name:     "single",
+			results:  map[int]*timing.TimingResults{1: finish(1, now)},
+			expected: Decision{WinnerLane: 1, Reason: ReasonSingle},
+		},
+		{
+			name:     "no finishers",
+			results:  map[int]*timing.TimingResults{1: {Lane: 1}, 2: {Lane: 2}},
+			expected: Decision{Reason: ReasonNoWinner},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Decide(tt.results, window)
+			if !got.Same(tt.expected) || got.Margin != tt.expected.Margin {
+				t.Errorf("Expected %+v, got %+v", tt.expected, got)
+			}
+		})
+	}
+
+	// A zero window never holds a finish
+	if got := Decide(map[int]*timing.TimingResults{1: finish(1, now), 2: finish(2, now.Add(time.Microsecond))}, 0); got.WinnerLane != 1 {
+		t.Errorf("Expected lane 1 to win without a window, got %+v", got)
+	}
+
+	resolved := Decide(map[int]*timing.TimingResults{1: finish(1, now), 2: finish(2, now)}, window).Resolve(2)
+	if resolved.WinnerLane != 2 || resolved.UnderReview || resolved.Reason != ReasonOfficial {
+		t.Errorf("Unexpected resolved decision %+v", resolved)
+	}
+}
+
+func TestDecideManualResults(t *testing.T) {
+	green := time.Now()
+	et1, et2 := 7.80, 7.75
+
+	// Lane 1's finish beam failed; its hand-timed ET is placed from its start
+	lane1 := &timing.TimingResults{
+		Lane:            1,
+		StartTime:       green.Add(400 * time.Millisecond),
+		QuarterMileTime: &et1,
+		IsComplete:      true,
+		Manual:          &timing.Provenance{EnteredBy: "chief", Method: timing.ManualHandTimed},
+		BeamTriggers:    map[string]time.Time{},
+	}
+	lane2 := finish(2, green.Add(500*time.Millisecond+7750*time.Millisecond))
+	lane2.StartTime = green.Add(500 * time.Millisecond)
+	lane2.QuarterMileTime = &et2
+
+	got := Decide(map[int]*timing.TimingResults{1: lane1, 2: lane2}, 500*time.Microsecond)
+	if got.WinnerLane != 1 || got.Reason != ReasonFirstToFinish {
+		t.Errorf("Expected lane 1 to win on package, got %+v", got)
+	}
+
+	// The hand-timed run is disclosed, and its 0.2s uncertainty swamps the
+	// 0.05s margin
+	if len(got.Degraded) != 1 || got.Degraded[0].Lane != 1 || got.Degraded[0].Accuracy.Source != timers.SourceManual {
+		t.Errorf("Expected lane 1 flagged as degraded, got %+v", got.Degraded)
+	}
+	if !got.MarginUncertain {
+		t.Error("Expected the margin flagged as within the timing uncertainty")
+	}
+
+	// Without a start, a manual ET cannot be compared at the stripe
+	lane1.StartTime = time.Time{}
+	got = Decide(map[int]*timing.TimingResults{1: lane1, 2: lane2}, 500*time.Microsecond)
+	if !got.UnderReview || got.Reason != ReasonManualReview {
+		t.Errorf("Expected manual review, got %+v", got)
+	}
+}
+
+func TestDecidePrecedence(t *testing.T) {
+	now := time.Now()
+	rt := func(v float64) *float64 { return &v }
+	foul := func(lane int, reason string, reaction float64) *timing.TimingResults {
+		result := finish(lane, now)
+		result.IsFoul = true
+		result.FoulReason = reason
+		result.ReactionTime = rt(reaction)
+		return result
+	}
+	ran := func(lane int, et float64) *timing.TimingResults {
+		result := finish(lane, now.Add(time.Duration(et*float64(time.Second))))
+		result.QuarterMileTime = rt(et)
+		return result
+	}
+
+	tests := []struct {
+		name       string
+		results    map[int]*timing.TimingResults
+		rules      Rules
+		winnerLane int
+		reason     string
+	}{
+		{
+			name:       "red light outranks boundary",
+			results:    map[int]*timing.TimingResults{1: foul(1, "red_light", -0.010), 2: foul(2, "boundary", 0.050)},
+			winnerLane: 2,
+			reason:     ReasonOpponentFoul,
+		},
+		{
+			name:       "worse red light loses",
+			results:    map[int]*timing.TimingResults{1: foul(1, "red_light", -0.010), 2: foul(2, "red_light", -0.002)},
+			winnerLane: 2,
+			reason:     ReasonOpponentFoul,
+		},
+		{
+			name:       "double boundary",
+			results:    map[int]*timing.TimingResults{1: foul(1, "centerline", 0.05), 2: foul(2, "boundary", 0.05)},
+			winnerLane: 0,
+			reason:     ReasonNoWinner,
+		},
+		{
+			name:       "breakout loses to slower car",
+			results:    map[int]*timing.TimingResults{1: ran(1, 9.85), 2: ran(2, 10.10)},
+			rules:      Rules{DialIns: map[int]float64{1: 9.90, 2: 10.05}},
+			winnerLane: 2,
+			reason:     ReasonBreakout,
+		},
+		{
+			name:       "bigger breakout loses",
+			results:    map[int]*timing.TimingResults{1: ran(1, 9.85), 2: ran(2, 10.03)},
+			rules:      Rules{DialIns: map[int]float64{1: 9.90, 2: 10.05}},
+			winnerLane: 2,
+			reason:     ReasonBreakout,
+		},
+		{
+			name:       "custom order rules boundary first",
+			results:    map[int]*timing.TimingResults{1: foul(1, "red_light", -0.010), 2: foul(2, "boundary", 0.050)},
+			rules:      Rules{Precedence: []Rule{RuleBoundary, RuleRedLight, RuleFirstToFinish}},
+			winnerLane: 1,
+			reason:     ReasonOpponentFoul,
+		},
+		{
+			name:       "first or worst ruling forgives the red light",
+			results:    map[int]*timing.TimingResults{1: foul(1, "red_light", -0.010), 2: foul(2, "boundary", 0.050)},
+			rules:      Rules{Ruling: &fouls.Ruling{LosingLane: 2, Rule: fouls.RuleWorst}},
+			winnerLane: 1,
+			reason:     ReasonOpponentFoul,
+		},
+		{
+			name:       "disqualified lane loses over a red light",
+			results:    map[int]*timing.TimingResults{1: ran(1, 9.95), 2: foul(2, "red_light", -0.010)},
+			rules:      Rules{Disqualified: []int{1}, Ruling: &fouls.Ruling{LosingLane: 2, Rule: fouls.RuleFirst}},
+			winnerLane: 2,
+			reason:     ReasonDisqualified,
+		},
+		{
+			name:       "both lanes disqualified",
+			results:    map[int]*timing.TimingResults{1: ran(1, 9.95), 2: ran(2, 10.10)},
+			rules:      Rules{Disqualified: []int{1, 2}},
+			winnerLane: 0,
+			reason:     ReasonNoWinner,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := DecideWithRules(tt.results, tt.rules)
+			if got.WinnerLane != tt.winnerLane || got.Reason != tt.reason {
+				t.Errorf("Expected lane %d (%s), got %+v", tt.winnerLane, tt.reason, got)
+			}
+		})
+	}
+
+	// The chain explains each rule in order
+	got := DecideWithRules(map[int]*timing.TimingResults{1: foul(1, "red_light", -0.010), 2: foul(2, "boundary", 0.050)}, Rules{})
+	expected := []Step{
+		{Rule: RuleRedLight, Lanes: []int{1}, Outcome: OutcomeLoss},
+		{Rule: RuleRedLight, Lanes: []int{2}, Outcome: OutcomeWin},
+	}
+	if len(got.Chain) != len(expected) {
+		t.Fatalf("Expected chain %+v, got %+v", expected, got.Chain)
+	}
+	for i, step := range expected {
+		if got.Chain[i].Rule != step.Rule || got.Chain[i].Outcome != step.Outcome || got.Chain[i].Lanes[0] != step.Lanes[0] {
+			t.Errorf("Step %d: expected %+v, got %+v", i, step, got.Chain[i])
+		}
+	}
+
+	clean := DecideWithRules(map[int]*timing.TimingResults{1: ran(1, 7.5), 2: ran(2, 7.6)}, Rules{})
+	if n := len(clean.Chain); n != len(DefaultPrecedence) || clean.Chain[n-1].Rule != RuleFirstToFinish {
+		t.Errorf("Expected every rule in the chain, got %+v", clean.Chain)
+	}
+}
+
+func TestParsePrecedence(t *testing.T) {
+	rules, err := ParsePrecedence([]string{"boundary", "red_light", "first_to_finish"})
+	if err != nil || len(rules) != 3 || rules[0] != RuleBoundary {
+		t.Errorf("Unexpected precedence %v (%v)", rules, err)
+	}
+	if _, err := ParsePrecedence([]string{"burnout"}); err == nil {
+		t.Error("Expected an error for an unknown rule")
+	}
+	if _, err := ParsePrecedence([]string{"foul", "foul"}); err == nil {
+		t.Error("Expected an error for a duplicate rule")
+	}
+}
+
+func TestFormatting(t *testing.T) {
+	if got := FormatMargin(0.0123, 0); got != "0.0123 sec" {
+		t.Errorf("Expected seconds only without a trap speed, got %q", got)
+	}
+	// 0.0123s at 200 mph is about 3.6 feet
+	if got := FormatMargin(0.0123, 200); got != "0.0123 sec (3.6 ft)" {
+		t.Errorf("Unexpected margin %q", got)
+	}
+	if got := FormatMargin(0.0020, 150); got != "0.0020 sec (5 in)" {
+		t.Errorf("Expected a margin under a foot in inches, got %q", got)
+	}
+
+	if total, ok := Package(0.007, 10.505, 10.50); !ok || FormatPackage(total) != "0.012 total" {
+		t.Errorf("Expected 0.012 total, got %v %v", total, ok)
+	}
+	if _, ok := Package(0.007, 10.49, 10.50); ok {
+		t.Error("Expected a breakout to have no package")
+	}
+	if _, ok := Package(-0.010, 10.55, 10.50); ok {
+		t.Error("Expected a red light to have no package")
+	}
+
+	speed := 190.0
+	decision := Decision{WinnerLane: 1, Margin: 0.01}
+	runs := map[int]*timing.TimingResults{1: {Lane: 1}, 2: {Lane: 2, TrapSpeed: &speed}}
+	if got := FormatDecisionMargin(decision, runs); got != "0.0100 sec (2.8 ft)" {
+		t.Errorf("Expected the margin at the trailing car's speed, got %q", got)
+	}
+	if got := FormatDecisionMargin(Decision{WinnerLane: 1, Reason: ReasonSingle}, runs); got != "" {
+		t.Errorf("Expected no margin for a single, got %q", got)
+	}
+}
@@ -0,0 +1,208 @@
+// Package rules defines racing classes declaratively: the tree a class runs
+// on and its timing preset, whether it may deep stage, its auto-start timing, and how dial-ins and
+// breakouts work for it. Components look a class up in an Engine instead of
+// keeping their own lists of class names; Default holds the standard NHRA
+// and IHRA classes, and tracks can define their own.
+package rules
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/benharold/libdrag/pkg/config"
+)
+
+// DeepStagePolicy is whether a class may roll through the pre-stage beam
+type DeepStagePolicy string
+
+const (
+	DeepStageAllowed    DeepStagePolicy = "allowed"
+	DeepStageProhibited DeepStagePolicy = "prohibited" // Published for the starter to rule on
+)
+
+// BreakoutRule is how a class's dial-ins and breakouts work
+type BreakoutRule string
+
+const (
+	BreakoutNone   BreakoutRule = "none"    // Heads-up: no dial-ins, quickest car wins
+	BreakoutDialIn BreakoutRule = "dial_in" // Each driver chooses a dial-in
+	BreakoutIndex  BreakoutRule = "index"   // Every car runs on the class index
+)
+
+// AutoStart is a class's auto-start timing. Zero fields keep the auto-start
+// system's current setting.
+type AutoStart struct {
+	StagingTimeout       time.Duration `json:"staging_timeout,omitempty"`
+	MinStagingDuration   time.Duration `json:"min_staging_duration,omitempty"`
+	RandomDelayMin       time.Duration `json:"random_delay_min,omitempty"`
+	RandomDelayMax       time.Duration `json:"random_delay_max,omitempty"`
+	EnabledForTimeTrials bool          `json:"enabled_for_timetrials,omitempty"`
+}
+
+// Class is a racing class's rules
+type Class struct {
+	Name string                  `json:"name"`
+	Tree config.TreeSequenceType `json:"tree"`
+	// TreePreset is the tree timing the class races on, which must be a
+	// Tree type tree; empty keeps the track's
+	TreePreset config.TreePreset `json:"tree_preset,omitempty"`
+	DeepStage  DeepStagePolicy   `json:"deep_stage"`
+	AutoStart  AutoStart         `json:"auto_start"`
+	Breakout   BreakoutRule      `json:"breakout"`
+	Index      float64           `json:"index,omitempty"`       // Dial-in of a BreakoutIndex class; 0 when each car has its own
+	MinDialIn  float64           `json:"min_dial_in,omitempty"` // Quickest dial-in allowed; 0 for no limit
+	MaxDialIn  float64           `json:"max_dial_in,omitempty"` // Slowest dial-in allowed; 0 for no limit
+}
+
+// Validate checks the class's policies and dial-in limits
+func (c Class) Validate() error {
+	if c.Name == "" {
+		return fmt.Errorf("class name is required")
+	}
+	switch c.Tree {
+	case config.TreeSequencePro, config.TreeSequenceSportsman, config.TreeSequenceStartSignal:
+	default:
+		return fmt.Errorf("class %q: unknown tree type %q", c.Name, c.Tree)
+	}
+	if c.TreePreset != "" {
+		preset, err := config.TreePresetConfig(c.TreePreset)
+		if err != nil {
+			return fmt.Errorf("class %q: %v", c.Name, err)
+		}
+		if preset.Type != c.Tree {
+			return fmt.Errorf("class %q: tree preset %q is a %s tree, not %s", c.Name, c.TreePreset, preset.Type, c.Tree)
+		}
+	}
+	switch c.DeepStage {
+	case DeepStageAllowed, DeepStageProhibited:
+	default:
+		return fmt.Errorf("class %q: unknown deep stage policy %q", c.Name, c.DeepStage)
+	}
+	switch c.Breakout {
+	case BreakoutNone, BreakoutDialIn, BreakoutIndex:
+	default:
+		return fmt.Errorf("class %q: unknown breakout rule %q", c.Name, c.Breakout)
+	}
+	if c.Index < 0 || c.MinDialIn < 0 || c.MaxDialIn < 0 {
+		return fmt.Errorf("class %q: index and dial-in limits cannot be negative", c.Name)
+	}
+	if c.MaxDialIn > 0 && c.MinDialIn > c.MaxDialIn {
+		return fmt.Errorf("class %q: min_dial_in %.3f is over max_dial_in %.3f", c.Name, c.MinDialIn, c.MaxDialIn)
+	}
+	if c.AutoStart.RandomDelayMax > 0 && c.AutoStart.RandomDelayMin > c.AutoStart.RandomDelayMax {
+		return fmt.Errorf("class %q: random_delay_min is over random_delay_max", c.Name)
+	}
+	return nil
+}
+
+// ValidateDialIn reports whether dial is a legal dial-in for the class
+func (c Class) ValidateDialIn(dial float64) error {
+	switch c.Breakout {
+	case BreakoutNone:
+		return fmt.Errorf("%s races heads-up without dial-ins", c.Name)
+	case BreakoutIndex:
+		// Indexes are published to the hundredth
+		if c.Index > 0 && math.Abs(dial-c.Index) > 0.0005 {
+			return fmt.Errorf("%s runs on its %.2f index, not %.3f", c.Name, c.Index, dial)
+		}
+	}
+	if c.MinDialIn > 0 && dial < c.MinDialIn {
+		return fmt.Errorf("%s dial-ins cannot be quicker than %.2f", c.Name, c.MinDialIn)
+	}
+	if c.MaxDialIn > 0 && dial > c.MaxDialIn {
+		return fmt.Errorf("%s dial-ins cannot be slower than %.2f", c.Name, c.MaxDialIn)
+	}
+	return nil
+}
+
+// Engine answers rules questions by class name. A class the engine does not
+// know has no restrictions.
+type Engine struct {
+	mu      sync.RWMutex
+	classes map[string]Class
+}
+
+// NewEngine creates an engine with the given classes
+func NewEngine(classes ...Class) (*Engine, error) {
+	e := &Engine{classes: make(map[string]Class, len(classes))}
+	for _, class := range classes {
+		if err := e.Define(class); err != nil {
+			return nil, err
+		}
+	}
+	return e, nil
+}
+
+var defaultEngine, _ = NewEngine(Standard()...)
+
+// Default returns the process-wide engine, holding the Standard classes
+// unless a class was redefined
+func Default() *Engine {
+	return defaultEngine
+}
+
+// Or returns engine, or the default engine when engine is nil. Components
+// keep an optional injected engine and read it through Or.
+func Or(engine *Engine) *Engine {
+	if engine != nil {
+		return engine
+	}
+	return defaultEngine
+}
+
+// Define adds a class, replacing any class of the same name
+func (e *Engine) Define(class Class) error {
+	if err := class.Validate(); err != nil {
+		return err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.classes[class.Name] = class
+	return nil
+}
+
+// Class returns a class's rules
+func (e *Engine) Class(name string) (Class, bool) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	class, ok := e.classes[name]
+	return class, ok
+}
+
+// Classes returns every class, sorted by name
+func (e *Engine) Classes() []Class {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	classes := make([]Class, 0, len(e.classes))
+	for _, class := range e.classes {
+		classes = append(classes, class)
+	}
+	sort.Slice(classes, func(i, j int) bool { return classes[i].Name < classes[j].Name })
+	return classes
+}
+
+// TreePreset returns the tree preset a class races on, or "" when the
+// class has none or is unknown
+func (e *Engine) TreePreset(name string) config.TreePreset {
+	class, _ := e.Class(name)
+	return class.TreePreset
+}
+
+// DeepStageProhibited reports whether a class prohibits deep staging
+func (e *Engine) DeepStageProhibited(name string) bool {
+	class, ok := e.Class(name)
+	return ok && class.DeepStage == DeepStageProhibited
+}
+
+// ValidateDialIn reports whether dial is a legal dial-in for a class
+func (e *Engine) ValidateDialIn(name string, dial float64) error {
+	class, ok := e.Class(name)
+	if !ok {
+		return nil
+	}
+	return class.ValidateDialIn(dial)
+}
@@ -0,0 +1,100 @@
+package rules
+
+import (
+	"testing"
+
+	"github.com/benharold/libdrag/pkg/config"
+)
+
+func TestStandardClasses(t *testing.T) {
+	for _, class := range Standard() {
+		if err := class.Validate(); err != nil {
+			t.Errorf("Standard class invalid: %v", err)
+		}
+	}
+
+	engine := Default()
+	for class, prohibited := range map[string]bool{
+		"Super Gas":    true,
+		"Super Stock":  true,
+		"Super Street": true,
+		"Top Fuel":     false,
+		"Bracket":      false,
+		"Unknown":      false,
+	} {
+		if got := engine.DeepStageProhibited(class); got != prohibited {
+			t.Errorf("%s: expected deep staging prohibited=%v, got %v", class, prohibited, got)
+		}
+	}
+	if topFuel, ok := engine.Class("Top Fuel"); !ok || topFuel.Tree != config.TreeSequencePro || topFuel.Breakout != BreakoutNone {
+		t.Errorf("Expected Top Fuel heads-up on a pro tree, got %+v", topFuel)
+	}
+	for class, preset := range map[string]config.TreePreset{
+		"Top Fuel":        config.TreePresetPro400,
+		"Pro Modified":    config.TreePresetProMod400,
+		"Bracket":         config.TreePresetSportsman500,
+		"Junior Dragster": config.TreePresetJrDragster,
+		"Unknown":         "",
+	} {
+		if got := engine.TreePreset(class); got != preset {
+			t.Errorf("%s: expected tree preset %q, got %q", class, preset, got)
+		}
+	}
+}
+
+func TestValidateDialIn(t *testing.T) {
+	engine := Default()
+	tests := []struct {
+		class string
+		dial  float64
+		ok    bool
+	}{
+		{"Bracket", 11.25, true},
+		{"Top Fuel", 3.70, false}, // Heads-up
+		{"Super Gas", 9.90, true},
+		{"Super Gas", 9.85, false}, // Off the index
+		{"Super Stock", 10.35, true},
+		{"Junior Dragster", 8.90, true},
+		{"Junior Dragster", 7.50, false}, // Quicker than the quickest bracket
+		{"Unknown", 12.00, true},
+	}
+	for _, test := range tests {
+		err := engine.ValidateDialIn(test.class, test.dial)
+		if (err == nil) != test.ok {
+			t.Errorf("%s dial %.2f: expected ok=%v, got %v", test.class, test.dial, test.ok, err)
+		}
+	}
+}
+
+func TestDefine(t *testing.T) {
+	engine, err := NewEngine()
+	if err != nil {
+		t.Fatalf("NewEngine failed: %v", err)
+	}
+	if err := engine.Define(Class{Name: "Street", Tree: "christmas", DeepStage: DeepStageAllowed, Breakout: BreakoutDialIn}); err == nil {
+		t.Error("Expected an unknown tree type to be rejected")
+	}
+	if err := engine.Define(Class{Name: "Street", Tree: config.TreeSequenceSportsman, TreePreset: config.TreePresetPro400, DeepStage: DeepStageAllowed, Breakout: BreakoutDialIn}); err == nil {
+		t.Error("Expected a pro tree preset on a sportsman class to be rejected")
+	}
+	if err := engine.Define(Class{Name: "Street", Tree: config.TreeSequenceSportsman, DeepStage: DeepStageAllowed, Breakout: BreakoutDialIn, MinDialIn: 12, MaxDialIn: 10}); err == nil {
+		t.Error("Expected inverted dial-in limits to be rejected")
+	}
+
+	street := Class{Name: "Street", Tree: config.TreeSequenceSportsman, DeepStage: DeepStageProhibited, Breakout: BreakoutDialIn, MaxDialIn: 17.99}
+	if err := engine.Define(street); err != nil {
+		t.Fatalf("Define failed: %v", err)
+	}
+	if !engine.DeepStageProhibited("Street") || engine.DeepStageProhibited("Super Gas") {
+		t.Error("Expected only the engine's own classes to apply")
+	}
+	if err := engine.ValidateDialIn("Street", 18.50); err == nil {
+		t.Error("Expected a dial-in over the class limit to be rejected")
+	}
+	if classes := engine.Classes(); len(classes) != 1 || classes[0].Name != "Street" {
+		t.Errorf("Expected only Street, got %+v", classes)
+	}
+	if Or(nil) != Default() || Or(engine) != engine {
+		t.Error("Expected Or to fall back to the default engine")
+	}
+}
@@ -0,0 +1,63 @@
+package rules
+
+import (
+	"time"
+
+	"github.com/benharold/libdrag/pkg/config"
+)
+
+// Auto-start timing shared by groups of classes
+var (
+	proAutoStart = AutoStart{
+		StagingTimeout:     7 * time.Second,
+		MinStagingDuration: 500 * time.Millisecond,
+		RandomDelayMin:     600 * time.Millisecond,
+		RandomDelayMax:     1100 * time.Millisecond,
+	}
+	proModAutoStart = AutoStart{
+		StagingTimeout:     10 * time.Second,
+		MinStagingDuration: 500 * time.Millisecond,
+	}
+	sportsmanAutoStart = AutoStart{
+		StagingTimeout:     15 * time.Second,
+		MinStagingDuration: 600 * time.Millisecond,
+		RandomDelayMin:     600 * time.Millisecond,
+		RandomDelayMax:     1400 * time.Millisecond,
+	}
+)
+
+// Standard returns the standard NHRA and IHRA classes
+func Standard() []Class {
+	pro := func(name string, preset config.TreePreset, autoStart AutoStart) Class {
+		return Class{Name: name, Tree: config.TreeSequencePro, TreePreset: preset, DeepStage: DeepStageAllowed, AutoStart: autoStart, Breakout: BreakoutNone}
+	}
+	sportsman := func(name string, deepStage DeepStagePolicy, breakout BreakoutRule, index float64) Class {
+		return Class{Name: name, Tree: config.TreeSequenceSportsman, TreePreset: config.TreePresetSportsman500, DeepStage: deepStage, AutoStart: sportsmanAutoStart, Breakout: breakout, Index: index}
+	}
+	return []Class{
+		pro("Top Fuel", config.TreePresetPro400, proAutoStart),
+		pro("Funny Car", config.TreePresetPro400, proAutoStart),
+		pro("Pro Stock", config.TreePresetPro400, proAutoStart),
+		pro("Pro Modified", config.TreePresetProMod400, proModAutoStart),
+		pro("Pro Stock Motorcycle", config.TreePresetProMod400, proModAutoStart),
+		sportsman("Bracket", DeepStageAllowed, BreakoutDialIn, 0),
+		sportsman("Super Class", DeepStageAllowed, BreakoutDialIn, 0),
+		sportsman("Super Comp", DeepStageAllowed, BreakoutIndex, 8.90),
+		sportsman("Super Gas", DeepStageProhibited, BreakoutIndex, 9.90),
+		sportsman("Super Street", DeepStageProhibited, BreakoutIndex, 10.90),
+		sportsman("Super Stock", DeepStageProhibited, BreakoutIndex, 0), // Each combination has its own index
+		{
+			Name:       "Junior Dragster",
+			Tree:       config.TreeSequenceSportsman,
+			TreePreset: config.TreePresetJrDragster,
+			DeepStage:  DeepStageAllowed,
+			AutoStart: AutoStart{
+				StagingTimeout:       15 * time.Second,
+				MinStagingDuration:   1000 * time.Millisecond,
+				EnabledForTimeTrials: true, // More forgiving for learning
+			},
+			Breakout:  BreakoutDialIn,
+			MinDialIn: 7.90, // Quickest age bracket
+		},
+	}
+}
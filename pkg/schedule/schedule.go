@@ -0,0 +1,262 @@
+// Package schedule opens and closes racing sessions at configured times of
+// day, such as gates at 5:00, time trials from 6:00 to 8:00 and
+// eliminations at 8:30 on a test-and-tune night.
+package schedule
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/benharold/libdrag/pkg/config"
+	"github.com/benharold/libdrag/pkg/events"
+	"github.com/benharold/libdrag/pkg/timers"
+)
+
+// Session is a scheduled session and the profile races started in it use
+type Session struct {
+	ID    string `json:"id"`
+	Open  string `json:"open"`            // Time of day, "15:04"
+	Close string `json:"close,omitempty"` // Defaults to the next session's open, or midnight for the last
+
+	// Class and Tree are the config profile armed for races started in the
+	// session without their own; empty for sessions with no racing (gates)
+	Class string                     `json:"class,omitempty"`
+	Tree  *config.TreeSequenceConfig `json:"tree,omitempty"`
+}
+
+// Config is a daily session schedule
+type Config struct {
+	Sessions []Session      `json:"sessions"`
+	Location *time.Location `json:"-"` // Defaults to time.Local
+}
+
+// slot is a session's window as offsets from midnight
+type slot struct {
+	session Session
+	open    time.Duration
+	close   time.Duration
+}
+
+// Validate checks that every session has an ID and valid times and that no
+// sessions overlap
+func (c Config) Validate() error {
+	_, err := c.slots()
+	return err
+}
+
+// slots returns the sessions' windows in order
+func (c Config) slots() ([]slot, error) {
+	slots := make([]slot, 0, len(c.Sessions))
+	ids := make(map[string]bool)
+	for _, session := range c.Sessions {
+		if session.ID == "" {
+			return nil, fmt.Errorf("session ID is required")
+		}
+		if ids[session.ID] {
+			return nil, fmt.Errorf("duplicate session %q", session.ID)
+		}
+		ids[session.ID] = true
+
+		open, err := parseTimeOfDay(session.Open)
+		if err != nil {
+			return nil, fmt.Errorf("session %s: invalid open time: %v", session.ID, err)
+		}
+		close := time.Duration(-1)
+		if session.Close != "" {
+			if close, err = parseTimeOfDay(session.Close); err != nil {
+				return nil, fmt.Errorf("session %s: invalid close time: %v", session.ID, err)
+			}
+			if close <= open {
+				return nil, fmt.Errorf("session %s closes before it opens", session.ID)
+			}
+		}
+		slots = append(slots, slot{session: session, open: open, close: close})
+	}
+
+	sort.SliceStable(slots, func(i, j int) bool { return slots[i].open < slots[j].open })
+	for i := range slots {
+		next := 24 * time.Hour
+		if i+1 < len(slots) {
+			next = slots[i+1].open
+		}
+		if slots[i].close < 0 {
+			slots[i].close = next
+		}
+		if slots[i].close > next {
+			return nil, fmt.Errorf("session %s overlaps session %s", slots[i].session.ID, slots[i+1].session.ID)
+		}
+	}
+	return slots, nil
+}
+
+// parseTimeOfDay parses "15:04" into an offset from midnight
+func parseTimeOfDay(value string) (time.Duration, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// Scheduler opens and closes the sessions of a schedule every day,
+// publishing session.open and session.close. Its timers run on the shared
+// timer wheel.
+type Scheduler struct {
+	mu       sync.Mutex
+	bus      *events.EventBus
+	slots    []slot
+	location *time.Location
+	current  int // Index of the open session's slot, or -1
+	timer    *timers.Timer
+	running  bool
+}
+
+// NewScheduler creates a scheduler for a valid schedule
+func NewScheduler(bus *events.EventBus, cfg Config) (*Scheduler, error) {
+	slots, err := cfg.slots()
+	if err != nil {
+		return nil, err
+	}
+	location := cfg.Location
+	if location == nil {
+		location = time.Local
+	}
+	return &Scheduler{bus: bus, slots: slots, location: location, current: -1}, nil
+}
+
+// Start opens the session scheduled for now, if any, and follows the
+// schedule from then on
+func (s *Scheduler) Start() {
+	s.mu.Lock()
+	s.running = true
+	published := s.update(timers.Now())
+	s.mu.Unlock()
+
+	s.publish(published)
+}
+
+// Stop stops following the schedule and closes the open session
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	s.running = false
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	var published []events.Event
+	if s.current >= 0 {
+		published = append(published, s.sessionEvent(events.EventSessionClose, s.slots[s.current]))
+		s.current = -1
+	}
+	s.mu.Unlock()
+
+	s.publish(published)
+}
+
+// Current returns the open session
+func (s *Scheduler) Current() (Session, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.current < 0 {
+		return Session{}, false
+	}
+	return s.slots[s.current].session, true
+}
+
+// update opens the session scheduled at now, closing any other, and arms the
+// timer for the next transition. It returns the events to publish.
+func (s *Scheduler) update(now time.Time) []events.Event {
+	now = now.In(s.location)
+	active := -1
+	for i, slot := range s.slots {
+		if !now.Before(at(now, 0, slot.open)) && now.Before(at(now, 0, slot.close)) {
+			active = i
+		}
+	}
+
+	var published []events.Event
+	if active != s.current {
+		if s.current >= 0 {
+			published = append(published, s.sessionEvent(events.EventSessionClose, s.slots[s.current]))
+		}
+		if active >= 0 {
+			published = append(published, s.sessionEvent(events.EventSessionOpen, s.slots[active]))
+		}
+		s.current = active
+	}
+
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+	if next, ok := s.nextTransition(now); ok {
+		s.timer = timers.Default().AfterFunc(next.Sub(timers.Now()), timers.Label{Name: "schedule.transition"}, func() {
+			s.mu.Lock()
+			if !s.running {
+				s.mu.Unlock()
+				return
+			}
+			// The wheel may fire up to a tick early; act as of the transition
+			current := timers.Now()
+			if current.Before(next) {
+				current = next
+			}
+			published := s.update(current)
+			s.mu.Unlock()
+
+			s.publish(published)
+		})
+	}
+	return published
+}
+
+// nextTransition returns the first session open or close after now
+func (s *Scheduler) nextTransition(now time.Time) (time.Time, bool) {
+	for day := 0; day <= 1; day++ {
+		for _, slot := range s.slots {
+			for _, offset := range []time.Duration{slot.open, slot.close} {
+				if t := at(now, day, offset); t.After(now) {
+					return t, true // Slots are in order and within the day
+				}
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// at returns the time offset from midnight, days after now's date
+func at(now time.Time, days int, offset time.Duration) time.Time {
+	year, month, day := now.Date()
+	return time.Date(year, month, day+days, int(offset/time.Hour), int(offset%time.Hour/time.Minute), 0, 0, now.Location())
+}
+
+// sessionEvent builds a session.open or session.close event
+func (s *Scheduler) sessionEvent(eventType events.EventType, slot slot) events.Event {
+	builder := events.NewEvent(eventType).
+		WithData("session_id", slot.session.ID).
+		WithData("open", slot.session.Open).
+		WithData("close", formatTimeOfDay(slot.close))
+	if slot.session.Class != "" {
+		builder.WithData("class", slot.session.Class)
+	}
+	if slot.session.Tree != nil && slot.session.Tree.Type != "" {
+		builder.WithData("tree_type", string(slot.session.Tree.Type))
+	}
+	return builder.Build()
+}
+
+// formatTimeOfDay formats an offset from midnight as "15:04", midnight
+// closing as "24:00"
+func formatTimeOfDay(offset time.Duration) string {
+	return fmt.Sprintf("%02d:%02d", int(offset/time.Hour), int(offset%time.Hour/time.Minute))
+}
+
+func (s *Scheduler) publish(published []events.Event) {
+	if s.bus == nil {
+		return
+	}
+	for _, event := range published {
+		s.bus.Publish(event)
+	}
+}
@@ -0,0 +1,106 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	"github.com/benharold/libdrag/pkg/config"
+	"github.com/benharold/libdrag/pkg/events"
+	"github.com/benharold/libdrag/pkg/timers"
+)
+
+func testNight() Config {
+	return Config{
+		Location: time.UTC,
+		Sessions: []Session{
+			{ID: "eliminations", Open: "20:30", Class: "Super Pro", Tree: &config.TreeSequenceConfig{Type: config.TreeSequencePro}},
+			{ID: "gates", Open: "17:00"},
+			{ID: "time-trials", Open: "18:00", Close: "20:00", Class: "Super Pro"},
+		},
+	}
+}
+
+func TestSchedulerFollowsSessions(t *testing.T) {
+	wheel := timers.NewVirtualWheel(time.Date(2025, time.June, 7, 16, 0, 0, 0, time.UTC), timers.DefaultTick)
+	defer timers.SetDefault(wheel)()
+
+	bus := events.NewEventBus(false)
+	var log []string
+	bus.SubscribeAll(func(event events.Event) {
+		log = append(log, string(event.Type)+" "+event.Data["session_id"].(string))
+	})
+
+	scheduler, err := NewScheduler(bus, testNight())
+	if err != nil {
+		t.Fatalf("NewScheduler failed: %v", err)
+	}
+	scheduler.Start()
+	defer scheduler.Stop()
+
+	expectCurrent := func(at string, id string) {
+		t.Helper()
+		session, ok := scheduler.Current()
+		if session.ID != id || ok != (id != "") {
+			t.Errorf("At %s expected session %q, got %q", at, id, session.ID)
+		}
+	}
+
+	expectCurrent("16:00", "")
+	wheel.Advance(90 * time.Minute)
+	expectCurrent("17:30", "gates")
+	wheel.Advance(time.Hour)
+	expectCurrent("18:30", "time-trials")
+	if session, _ := scheduler.Current(); session.Class != "Super Pro" {
+		t.Errorf("Expected the time trials profile, got %+v", session)
+	}
+	wheel.Advance(90 * time.Minute)
+	expectCurrent("20:00", "")
+	wheel.Advance(time.Hour)
+	expectCurrent("21:00", "eliminations")
+	wheel.Advance(3 * time.Hour)
+	expectCurrent("00:00", "")
+	wheel.Advance(17*time.Hour + time.Minute)
+	expectCurrent("17:01 the next day", "gates")
+
+	expected := []string{
+		"session.open gates", "session.close gates",
+		"session.open time-trials", "session.close time-trials",
+		"session.open eliminations", "session.close eliminations",
+		"session.open gates",
+	}
+	if len(log) != len(expected) {
+		t.Fatalf("Expected events %v, got %v", expected, log)
+	}
+	for i := range expected {
+		if log[i] != expected[i] {
+			t.Errorf("Event %d: expected %q, got %q", i, expected[i], log[i])
+		}
+	}
+
+	scheduler.Stop()
+	expectCurrent("stop", "")
+	if last := log[len(log)-1]; last != "session.close gates" {
+		t.Errorf("Expected the open session closed on stop, got %q", last)
+	}
+}
+
+func TestScheduleValidation(t *testing.T) {
+	tests := []struct {
+		name     string
+		sessions []Session
+	}{
+		{"missing ID", []Session{{Open: "09:00"}}},
+		{"duplicate ID", []Session{{ID: "a", Open: "09:00"}, {ID: "a", Open: "10:00"}}},
+		{"bad time", []Session{{ID: "a", Open: "9am"}}},
+		{"closes before open", []Session{{ID: "a", Open: "11:00", Close: "09:00"}}},
+		{"overlap", []Session{{ID: "a", Open: "09:00", Close: "11:00"}, {ID: "b", Open: "10:00"}}},
+	}
+	for _, tt := range tests {
+		if err := (Config{Sessions: tt.sessions}).Validate(); err == nil {
+			t.Errorf("%s: expected validation error", tt.name)
+		}
+	}
+	if err := testNight().Validate(); err != nil {
+		t.Errorf("Expected valid schedule, got %v", err)
+	}
+}
@@ -0,0 +1,295 @@
+// Package scoreboard drives the per-lane scoreboards from the event stream.
+package scoreboard
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/benharold/libdrag/pkg/config"
+	"github.com/benharold/libdrag/pkg/events"
+	"github.com/benharold/libdrag/pkg/results"
+)
+
+// LaneDisplay is what a single lane's scoreboard shows
+type LaneDisplay struct {
+	Lane         int      `json:"lane"`
+	DialIn       *float64 `json:"dial_in,omitempty"`
+	ReactionTime *float64 `json:"reaction_time,omitempty"`
+	ElapsedTime  *float64 `json:"elapsed_time,omitempty"`
+	Speed        *float64 `json:"speed,omitempty"`
+	Package      string   `json:"package,omitempty"` // Bracket total once the run is in, "0.012 total"
+	WinLight     bool     `json:"win_light"`
+	Margin       string   `json:"margin,omitempty"` // Margin of victory, shown with the win light
+}
+
+// LaneMap maps timing-system lanes to the lane positions a scoreboard
+// output is addressed with. Lanes missing from the map pass through unchanged.
+type LaneMap map[int]int
+
+// MirrorLanes returns the map for boards wired left/right opposite to the
+// timing system
+func MirrorLanes() LaneMap {
+	return LaneMap{1: 2, 2: 1}
+}
+
+// Scoreboard follows the pair currently on the track and publishes an
+// EventScoreboardUpdate whenever a lane's display changes. Dial-ins are shown
+// once the lane stages, matching real dial boards, and updated in place if an
+// official changes a dial before the run.
+//
+// A lane that fouls keeps showing its times unless SetFoulDisplay blanks
+// them, following the track's convention.
+//
+// Each Scoreboard drives one output. Use SetOutput when an output's lanes are
+// addressed differently from the timing system; run one Scoreboard per output
+// when several boards need different mappings.
+type Scoreboard struct {
+	mu          sync.Mutex
+	bus         *events.EventBus
+	output      string  // Output name included in updates, if set
+	lanes       LaneMap // Timing lane -> output lane
+	foulDisplay config.FoulDisplay
+	raceID      string
+	dialIns     map[int]float64 // Dial-ins received for the current race
+	staged      map[int]bool
+	fouled      map[int]bool
+	displays    map[int]*LaneDisplay
+	unsubscribe func()
+}
+
+// NewScoreboard creates a scoreboard publishing updates to bus
+func NewScoreboard(bus *events.EventBus) *Scoreboard {
+	sb := &Scoreboard{bus: bus}
+	sb.reset("")
+	return sb
+}
+
+// SetOutput names the output this scoreboard drives and sets its lane
+// mapping. Updates are published with the output's lane numbering; Display
+// and Displays keep using timing-system lanes.
+func (sb *Scoreboard) SetOutput(name string, lanes LaneMap) error {
+	seen := make(map[int]int, len(lanes))
+	for lane, outputLane := range lanes {
+		if outputLane <= 0 {
+			return fmt.Errorf("invalid output lane %d for lane %d", outputLane, lane)
+		}
+		if other, ok := seen[outputLane]; ok {
+			return fmt.Errorf("lanes %d and %d both map to output lane %d", other, lane, outputLane)
+		}
+		seen[outputLane] = lane
+	}
+
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	sb.output = name
+	sb.lanes = make(LaneMap, len(lanes))
+	for lane, outputLane := range lanes {
+		sb.lanes[lane] = outputLane
+	}
+	return nil
+}
+
+// SetFoulDisplay sets what the board shows for a lane that fouls. With
+// config.FoulDisplayBlank its ET, speed and package are blanked, including
+// times already shown when the foul comes after the finish (a boundary
+// foul, say); the reaction time stays up to show a red light.
+func (sb *Scoreboard) SetFoulDisplay(display config.FoulDisplay) {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	sb.foulDisplay = display
+}
+
+// Start subscribes the scoreboard to the bus
+func (sb *Scoreboard) Start() {
+	sb.unsubscribe = sb.bus.SubscribeAll(sb.HandleEvent)
+}
+
+// Stop unsubscribes the scoreboard from the bus
+func (sb *Scoreboard) Stop() {
+	if sb.unsubscribe != nil {
+		sb.unsubscribe()
+	}
+}
+
+// RaceID returns the race currently on the board
+func (sb *Scoreboard) RaceID() string {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	return sb.raceID
+}
+
+// Display returns a copy of a lane's display
+func (sb *Scoreboard) Display(lane int) LaneDisplay {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	if d, ok := sb.displays[lane]; ok {
+		return d.copy()
+	}
+	return LaneDisplay{Lane: lane}
+}
+
+// Displays returns a copy of all lane displays
+func (sb *Scoreboard) Displays() map[int]LaneDisplay {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+
+	result := make(map[int]LaneDisplay, len(sb.displays))
+	for lane, d := range sb.displays {
+		result[lane] = d.copy()
+	}
+	return result
+}
+
+// HandleEvent updates the board from a single event
+func (sb *Scoreboard) HandleEvent(event events.Event) {
+	sb.mu.Lock()
+	update, ok := sb.apply(event)
+	sb.mu.Unlock()
+
+	// Publish outside the lock so synchronous buses can redeliver to us
+	if ok {
+		sb.bus.Publish(update)
+	}
+}
+
+// apply updates the board and returns the update event for a changed lane
+func (sb *Scoreboard) apply(event events.Event) (events.Event, bool) {
+	if event.Type == events.EventRaceStart {
+		sb.reset(event.RaceID)
+		return events.Event{}, false
+	}
+	if event.RaceID == "" || event.RaceID != sb.raceID {
+		return events.Event{}, false
+	}
+
+	lane := event.Lane
+	switch event.Type {
+	case events.EventRaceDialIn:
+		dial, ok := event.Data["dial_in"].(float64)
+		if !ok {
+			return events.Event{}, false
+		}
+		sb.dialIns[lane] = dial
+		if !sb.staged[lane] {
+			return events.Event{}, false
+		}
+		sb.display(lane).DialIn = &dial
+
+	case events.EventTreeStage:
+		broken, _ := event.Data["beam_broken"].(bool)
+		if !broken || sb.staged[lane] {
+			return events.Event{}, false
+		}
+		sb.staged[lane] = true
+		dial, ok := sb.dialIns[lane]
+		if !ok {
+			return events.Event{}, false
+		}
+		sb.display(lane).DialIn = &dial
+
+	case events.EventTimingReaction:
+		rt, ok := event.Data["reaction_time"].(float64)
+		if !ok {
+			return events.Event{}, false
+		}
+		sb.display(lane).ReactionTime = &rt
+
+	case events.EventTimingQuarterMile:
+		et, ok := event.Data["time"].(float64)
+		if !ok || sb.blanked(lane) {
+			return events.Event{}, false
+		}
+		d := sb.display(lane)
+		d.ElapsedTime = &et
+		if speed, ok := event.Data["trap_speed"].(float64); ok {
+			d.Speed = &speed
+		}
+		if d.DialIn != nil && d.ReactionTime != nil {
+			if total, ok := results.Package(*d.ReactionTime, et, *d.DialIn); ok {
+				d.Package = results.FormatPackage(total)
+			}
+		}
+
+	case events.EventRaceFoul:
+		sb.fouled[lane] = true
+		d, ok := sb.displays[lane]
+		if !ok || !sb.blanked(lane) || (d.ElapsedTime == nil && d.Speed == nil && d.Package == "") {
+			return events.Event{}, false
+		}
+		d.ElapsedTime, d.Speed, d.Package = nil, nil, ""
+
+	case events.EventRaceWinner:
+		// Photo finishes publish no winner until resolved, holding the light
+		d := sb.display(lane)
+		d.WinLight = true
+		d.Margin, _ = event.Data["margin_display"].(string)
+
+	default:
+		return events.Event{}, false
+	}
+
+	return sb.updateEvent(lane), true
+}
+
+// updateEvent builds the scoreboard update for a lane, addressed to the
+// output's lane numbering
+func (sb *Scoreboard) updateEvent(lane int) events.Event {
+	display := sb.display(lane).copy()
+	if outputLane, ok := sb.lanes[lane]; ok {
+		display.Lane = outputLane
+	}
+
+	builder := events.NewEvent(events.EventScoreboardUpdate).
+		WithRaceID(sb.raceID).
+		WithLane(display.Lane).
+		WithData("display", display).
+		WithData("timing_lane", lane)
+	if sb.output != "" {
+		builder = builder.WithData("output", sb.output)
+	}
+	return builder.Build()
+}
+
+// blanked reports whether the lane fouled and its times are to be blanked
+func (sb *Scoreboard) blanked(lane int) bool {
+	return sb.fouled[lane] && sb.foulDisplay.Blanks()
+}
+
+// display returns the lane's display, creating it if needed
+func (sb *Scoreboard) display(lane int) *LaneDisplay {
+	d, ok := sb.displays[lane]
+	if !ok {
+		d = &LaneDisplay{Lane: lane}
+		sb.displays[lane] = d
+	}
+	return d
+}
+
+// reset clears the board for a new race
+func (sb *Scoreboard) reset(raceID string) {
+	sb.raceID = raceID
+	sb.dialIns = make(map[int]float64)
+	sb.staged = make(map[int]bool)
+	sb.fouled = make(map[int]bool)
+	sb.displays = make(map[int]*LaneDisplay)
+}
+
+// copy returns a deep copy of the display
+func (d *LaneDisplay) copy() LaneDisplay {
+	c := LaneDisplay{Lane: d.Lane, Package: d.Package, WinLight: d.WinLight, Margin: d.Margin}
+	for _, pair := range []struct {
+		dst **float64
+		src *float64
+	}{
+		{&c.DialIn, d.DialIn},
+		{&c.ReactionTime, d.ReactionTime},
+		{&c.ElapsedTime, d.ElapsedTime},
+		{&c.Speed, d.Speed},
+	} {
+		if pair.src != nil {
+			v := *pair.src
+			*pair.dst = &v
+		}
+	}
+	return c
+}
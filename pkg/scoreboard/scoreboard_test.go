@@ -0,0 +1,185 @@
+package scoreboard
+
+import (
+	"testing"
+
+	"github.com/benharold/libdrag/pkg/config"
+	"github.com/benharold/libdrag/pkg/events"
+)
+
+func TestDialInShownAtStaging(t *testing.T) {
+	bus := events.NewEventBus(false)
+	board := NewScoreboard(bus)
+	board.Start()
+	defer board.Stop()
+
+	var updates []events.Event
+	bus.Subscribe(events.EventScoreboardUpdate, func(e events.Event) {
+		updates = append(updates, e)
+	})
+
+	dialIn := func(lane int, dial float64) {
+		bus.Publish(events.NewEvent(events.EventRaceDialIn).WithRaceID("race-1").WithLane(lane).WithData("dial_in", dial).Build())
+	}
+	stage := func(lane int) {
+		bus.Publish(events.NewEvent(events.EventTreeStage).WithRaceID("race-1").WithLane(lane).WithData("beam_broken", true).Build())
+	}
+
+	bus.Publish(events.NewEvent(events.EventRaceStart).WithRaceID("race-1").Build())
+	dialIn(1, 10.50)
+	if board.Display(1).DialIn != nil || len(updates) != 0 {
+		t.Fatal("Dial-in should not be shown before the lane stages")
+	}
+
+	stage(1)
+	if d := board.Display(1); d.DialIn == nil || *d.DialIn != 10.50 {
+		t.Fatalf("Expected dial 10.50 at staging, got %+v", d)
+	}
+
+	// An official changes the dial before the run
+	dialIn(1, 10.45)
+	if d := board.Display(1); *d.DialIn != 10.45 {
+		t.Fatalf("Expected updated dial 10.45, got %v", *d.DialIn)
+	}
+	if len(updates) != 2 {
+		t.Fatalf("Expected 2 scoreboard updates, got %d", len(updates))
+	}
+
+	// A new pair clears the board
+	bus.Publish(events.NewEvent(events.EventRaceStart).WithRaceID("race-2").Build())
+	if board.Display(1).DialIn != nil {
+		t.Fatal("Board should clear for the next pair")
+	}
+}
+
+func TestResultsShownAfterRun(t *testing.T) {
+	bus := events.NewEventBus(false)
+	board := NewScoreboard(bus)
+	board.Start()
+	defer board.Stop()
+
+	bus.Publish(events.NewEvent(events.EventRaceStart).WithRaceID("race-1").Build())
+	bus.Publish(events.NewEvent(events.EventTimingReaction).WithRaceID("race-1").WithLane(2).WithData("reaction_time", 0.012).Build())
+	bus.Publish(events.NewEvent(events.EventTimingQuarterMile).WithRaceID("race-1").WithLane(2).
+		WithData("time", 10.512).WithData("trap_speed", 128.4).Build())
+
+	d := board.Display(2)
+	if d.ReactionTime == nil || *d.ReactionTime != 0.012 || d.ElapsedTime == nil || *d.ElapsedTime != 10.512 || d.Speed == nil {
+		t.Fatalf("Unexpected lane 2 display %+v", d)
+	}
+	if d.Package != "" {
+		t.Errorf("Expected no package without a dial-in, got %q", d.Package)
+	}
+
+	// A bracket run shows its package once the ET is in
+	bus.Publish(events.NewEvent(events.EventRaceStart).WithRaceID("race-2").Build())
+	bus.Publish(events.NewEvent(events.EventRaceDialIn).WithRaceID("race-2").WithLane(1).WithData("dial_in", 10.50).Build())
+	bus.Publish(events.NewEvent(events.EventTreeStage).WithRaceID("race-2").WithLane(1).WithData("beam_broken", true).Build())
+	bus.Publish(events.NewEvent(events.EventTimingReaction).WithRaceID("race-2").WithLane(1).WithData("reaction_time", 0.008).Build())
+	bus.Publish(events.NewEvent(events.EventTimingQuarterMile).WithRaceID("race-2").WithLane(1).WithData("time", 10.504).Build())
+	if d := board.Display(1); d.Package != "0.012 total" {
+		t.Errorf("Expected package 0.012 total, got %q", d.Package)
+	}
+}
+
+func TestMirroredOutput(t *testing.T) {
+	bus := events.NewEventBus(false)
+	board := NewScoreboard(bus)
+	if err := board.SetOutput("tower", MirrorLanes()); err != nil {
+		t.Fatalf("SetOutput failed: %v", err)
+	}
+	board.Start()
+	defer board.Stop()
+
+	var updates []events.Event
+	bus.Subscribe(events.EventScoreboardUpdate, func(e events.Event) {
+		updates = append(updates, e)
+	})
+
+	bus.Publish(events.NewEvent(events.EventRaceStart).WithRaceID("race-1").Build())
+	bus.Publish(events.NewEvent(events.EventTimingReaction).WithRaceID("race-1").WithLane(1).WithData("reaction_time", 0.45).Build())
+
+	if len(updates) != 1 {
+		t.Fatalf("Expected 1 update, got %d", len(updates))
+	}
+	update := updates[0]
+	display := update.Data["display"].(LaneDisplay)
+	if update.Lane != 2 || display.Lane != 2 || update.Data["timing_lane"] != 1 || update.Data["output"] != "tower" {
+		t.Errorf("Expected lane 1 addressed to output lane 2, got %+v", update)
+	}
+	if board.Display(1).ReactionTime == nil {
+		t.Error("Display should stay keyed by timing lane")
+	}
+
+	if err := board.SetOutput("bad", LaneMap{1: 1, 2: 1}); err == nil {
+		t.Error("Expected error for lanes sharing an output lane")
+	}
+}
+
+func TestWinLight(t *testing.T) {
+	bus := events.NewEventBus(false)
+	board := NewScoreboard(bus)
+	board.Start()
+	defer board.Stop()
+
+	bus.Publish(events.NewEvent(events.EventRaceStart).WithRaceID("race-1").Build())
+	bus.Publish(events.NewEvent(events.EventFinishUnderReview).WithRaceID("race-1").Build())
+	if board.Display(1).WinLight || board.Display(2).WinLight {
+		t.Fatal("Win lights should be held while the finish is under review")
+	}
+
+	bus.Publish(events.NewEvent(events.EventRaceWinner).WithRaceID("race-1").WithLane(2).
+		WithData("margin_display", "0.0123 sec (2.3 ft)").Build())
+	if board.Display(1).WinLight || !board.Display(2).WinLight {
+		t.Fatal("Expected win light in lane 2 only")
+	}
+	if margin := board.Display(2).Margin; margin != "0.0123 sec (2.3 ft)" {
+		t.Errorf("Expected the margin with the win light, got %q", margin)
+	}
+}
+
+func TestFoulDisplay(t *testing.T) {
+	for _, display := range []config.FoulDisplay{config.FoulDisplayShow, config.FoulDisplayBlank} {
+		t.Run(string(display), func(t *testing.T) {
+			bus := events.NewEventBus(false)
+			board := NewScoreboard(bus)
+			board.SetFoulDisplay(display)
+			board.Start()
+			defer board.Stop()
+
+			var updates []events.Event
+			bus.Subscribe(events.EventScoreboardUpdate, func(e events.Event) {
+				updates = append(updates, e)
+			})
+			run := func(lane int, rt, et float64) {
+				bus.Publish(events.NewEvent(events.EventTimingReaction).WithRaceID("race-1").WithLane(lane).WithData("reaction_time", rt).Build())
+				bus.Publish(events.NewEvent(events.EventTimingQuarterMile).WithRaceID("race-1").WithLane(lane).
+					WithData("time", et).WithData("trap_speed", 128.4).Build())
+			}
+			foul := func(lane int, reason string) {
+				bus.Publish(events.NewEvent(events.EventRaceFoul).WithRaceID("race-1").WithLane(lane).WithData("reason", reason).Build())
+			}
+
+			// Lane 1 red-lights before its run; lane 2 crosses the centerline after its finish
+			bus.Publish(events.NewEvent(events.EventRaceStart).WithRaceID("race-1").Build())
+			foul(1, "red_light")
+			run(1, -0.021, 10.498)
+			run(2, 0.034, 10.512)
+			foul(2, "boundary")
+
+			for lane := 1; lane <= 2; lane++ {
+				d := board.Display(lane)
+				if d.ReactionTime == nil {
+					t.Errorf("Expected lane %d's reaction time shown, got %+v", lane, d)
+				}
+				if shown := d.ElapsedTime != nil && d.Speed != nil; shown == display.Blanks() {
+					t.Errorf("Expected lane %d's ET shown %v, got %+v", lane, !display.Blanks(), d)
+				}
+			}
+			// Blanking lane 1 skips its ET update and adds one clearing lane 2's
+			if len(updates) != 4 {
+				t.Errorf("Expected 4 updates, got %d", len(updates))
+			}
+		})
+	}
+}
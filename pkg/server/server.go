@@ -0,0 +1,932 @@
+// Package server exposes a LibDragAPI over HTTP with a WebSocket event stream.
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/benharold/libdrag/pkg/api"
+	"github.com/benharold/libdrag/pkg/autostart"
+	"github.com/benharold/libdrag/pkg/calibration"
+	"github.com/benharold/libdrag/pkg/eliminations"
+	"github.com/benharold/libdrag/pkg/events"
+	"github.com/benharold/libdrag/pkg/export"
+	"github.com/benharold/libdrag/pkg/orchestrator"
+	"github.com/benharold/libdrag/pkg/report"
+	"github.com/benharold/libdrag/pkg/snapshot"
+	"github.com/benharold/libdrag/pkg/tags"
+	"github.com/benharold/libdrag/pkg/timetrial"
+	"github.com/benharold/libdrag/pkg/timing"
+)
+
+// Server serves the libdrag API over HTTP
+type Server struct {
+	api      *api.LibDragAPI
+	facility string
+	mux      *http.ServeMux
+
+	mu      sync.RWMutex
+	session string // Session applied to races started without one
+}
+
+// NewServer creates an HTTP server for an initialized API
+func NewServer(libdragAPI *api.LibDragAPI, facility string) *Server {
+	s := &Server{
+		api:      libdragAPI,
+		facility: facility,
+		mux:      http.NewServeMux(),
+	}
+
+	s.mux.HandleFunc("/api/version", s.handleVersion)
+	s.mux.HandleFunc("/api/session", s.handleSession)
+	s.mux.HandleFunc("/api/races", s.handleRaces)
+	s.mux.HandleFunc("/api/races/", s.handleRace)
+	s.mux.HandleFunc("/api/export", s.handleExport)
+	s.mux.HandleFunc("/api/events", s.handleEvents)
+	s.mux.HandleFunc("/api/track", s.handleTrack)
+	s.mux.HandleFunc("/api/audit", s.handleAudit)
+	s.mux.HandleFunc("/api/timers", s.handleTimers)
+	s.mux.HandleFunc("/api/autostart/profiles", s.handleAutoStartProfiles)
+	s.mux.HandleFunc("/api/autostart/profiles/", s.handleAutoStartProfile)
+	s.mux.HandleFunc("/api/eliminations", s.handleEliminations)
+	s.mux.HandleFunc("/api/report", s.handleReport)
+	s.mux.HandleFunc("/api/calibration", s.handleCalibration)
+	s.mux.HandleFunc("/api/calibration/signal", s.handleCalibrationSignal)
+	s.mux.HandleFunc("/api/timetrials", s.handleTimeTrials)
+	s.mux.HandleFunc("/api/timetrials/", s.handleTimeTrialAction)
+	s.mux.HandleFunc("/api/slips", s.handleSlips)
+	s.mux.HandleFunc("/api/slips/", s.handleSlipReprint)
+
+	return s
+}
+
+// ServeHTTP implements http.Handler
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// SetSession sets the session applied to newly started races
+func (s *Server) SetSession(sessionID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.session = sessionID
+}
+
+// Session returns the current session
+func (s *Server) Session() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.session
+}
+
+// handleVersion reports the library version and facility name
+func (s *Server) handleVersion(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{
+		"version":  api.Version(),
+		"facility": s.facility,
+	})
+}
+
+// handleSession reads (GET) or replaces (PUT/POST) the current session. A
+// session set here takes precedence over the API's session schedule.
+func (s *Server) handleSession(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut, http.MethodPost:
+		var body struct {
+			SessionID string `json:"session_id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		s.SetSession(body.SessionID)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+	sessionID := s.Session()
+	if sessionID == "" {
+		if scheduled, ok := s.api.CurrentSession(); ok {
+			sessionID = scheduled.ID // Races started now join the scheduled session
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"session_id": sessionID})
+}
+
+// handleTrack reports (GET) or confirms (POST) the track-clear flag
+func (s *Server) handleTrack(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var body struct {
+			Source string `json:"source"`
+			SetBy  string `json:"set_by"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if body.Source == "" {
+			body.Source = api.TrackClearOfficial
+		}
+		if err := s.api.SetTrackClear(body.Source, body.SetBy); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	default:
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+	writeJSON(w, http.StatusOK, s.api.GetTrackClearStatus())
+}
+
+// handleAudit returns the safety audit log
+func (s *Server) handleAudit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+	writeJSON(w, http.StatusOK, s.api.GetAuditLog())
+}
+
+// handleTimers returns the pending race timers and timer wheel metrics
+func (s *Server) handleTimers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+	writeJSON(w, http.StatusOK, s.api.GetTimers())
+}
+
+// handleAutoStartProfiles lists (GET) or saves (POST) autostart profiles
+func (s *Server) handleAutoStartProfiles(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		profiles, err := s.api.ListAutoStartProfiles()
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, profiles)
+	case http.MethodPost:
+		var profile autostart.Profile
+		if err := json.NewDecoder(r.Body).Decode(&profile); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if err := s.api.PutAutoStartProfile(profile); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, profile)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+	}
+}
+
+// handleAutoStartProfile reads (GET), replaces (PUT) or deletes (DELETE)
+// /api/autostart/profiles/{name}
+func (s *Server) handleAutoStartProfile(w http.ResponseWriter, r *http.Request) {
+	name := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/autostart/profiles/"), "/")
+
+	switch r.Method {
+	case http.MethodGet:
+		profile, err := s.api.GetAutoStartProfile(name)
+		if err != nil {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, profile)
+	case http.MethodPut:
+		var profile autostart.Profile
+		if err := json.NewDecoder(r.Body).Decode(&profile); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		profile.Name = name
+		if err := s.api.PutAutoStartProfile(profile); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, profile)
+	case http.MethodDelete:
+		if err := s.api.DeleteAutoStartProfile(name); err != nil {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"name": name, "action": "delete"})
+	default:
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+	}
+}
+
+// handleEliminations reads (GET) or starts (POST) the eliminations bracket
+func (s *Server) handleEliminations(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		bracket, ok := s.api.GetBracket()
+		if !ok {
+			writeError(w, http.StatusNotFound, fmt.Errorf("no bracket running"))
+			return
+		}
+		writeJSON(w, http.StatusOK, bracket.State())
+	case http.MethodPost:
+		var body struct {
+			Class  string               `json:"class"`
+			Ladder eliminations.Ladder  `json:"ladder"`
+			Field  []eliminations.Entry `json:"field"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		bracket, err := s.api.StartEliminations(body.Class, body.Ladder, body.Field)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, bracket.State())
+	default:
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+	}
+}
+
+// handleReport builds the end-of-event report. GET takes the event name and
+// format (json or text) as query parameters; POST takes them in the body
+// with each class's purse.
+func (s *Server) handleReport(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Event  string                  `json:"event"`
+		Format report.Format           `json:"format"`
+		Purses map[string]report.Purse `json:"purses"`
+	}
+	switch r.Method {
+	case http.MethodGet:
+		body.Event = r.URL.Query().Get("event")
+		body.Format = report.Format(r.URL.Query().Get("format"))
+	case http.MethodPost:
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	default:
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+	if body.Format == "" {
+		body.Format = report.FormatJSON
+	}
+
+	event, err := s.api.EventReport(body.Event, body.Purses)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	data, err := report.Render(event, body.Format)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if body.Format == report.FormatText {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	w.Write(data)
+}
+
+// handleCalibration reads the last report (GET) or starts the calibration
+// wizard (POST)
+func (s *Server) handleCalibration(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		report, err := s.api.GetCalibrationReport()
+		if err != nil {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, report)
+	case http.MethodPost:
+		var cfg calibration.Config
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil {
+				writeError(w, http.StatusBadRequest, err)
+				return
+			}
+		}
+		wizard, err := s.api.StartCalibration(cfg)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		step, _ := wizard.Current()
+		writeJSON(w, http.StatusCreated, step)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+	}
+}
+
+// handleCalibrationSignal passes a raw channel transition to the
+// calibration wizard
+func (s *Server) handleCalibrationSignal(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+	var body struct {
+		Channel int       `json:"channel"`
+		Broken  bool      `json:"broken"`
+		At      time.Time `json:"at"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := s.api.CalibrationSignal(body.Channel, body.Broken, body.At); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"channel": body.Channel, "broken": body.Broken})
+}
+
+// handleTimeTrials reads (GET) or starts (POST) the time trial session
+func (s *Server) handleTimeTrials(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		session, ok := s.api.GetTimeTrials()
+		if !ok {
+			writeError(w, http.StatusNotFound, fmt.Errorf("no time trials running"))
+			return
+		}
+		writeJSON(w, http.StatusOK, timeTrialState(session))
+	case http.MethodPost:
+		var cfg timetrial.Config
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil {
+				writeError(w, http.StatusBadRequest, err)
+				return
+			}
+		}
+		if cfg.SessionID == "" {
+			cfg.SessionID = s.Session()
+		}
+		session, err := s.api.StartTimeTrials(cfg)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, timeTrialState(session))
+	default:
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+	}
+}
+
+// handleTimeTrialAction serves POST /api/timetrials/{action}?lane=N for
+// stage, green, beam and abort
+func (s *Server) handleTimeTrialAction(w http.ResponseWriter, r *http.Request) {
+	action := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/timetrials/"), "/")
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+	session, ok := s.api.GetTimeTrials()
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no time trials running"))
+		return
+	}
+	lane, err := strconv.Atoi(r.URL.Query().Get("lane"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid lane: %v", err))
+		return
+	}
+
+	switch action {
+	case "stage":
+		run, err := session.Stage(lane, r.URL.Query().Get("registration"))
+		if err != nil {
+			writeError(w, http.StatusConflict, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, run)
+		return
+	case "green":
+		err = session.Green(lane, time.Time{})
+	case "beam":
+		var body struct {
+			BeamID string    `json:"beam_id"`
+			At     time.Time `json:"at"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		err = session.TriggerBeam(body.BeamID, lane, body.At)
+	case "abort":
+		err = session.Abort(lane)
+	default:
+		writeError(w, http.StatusNotFound, fmt.Errorf("unknown action %q", action))
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"lane": lane, "action": action})
+}
+
+// timeTrialState is the time trial session as served over HTTP
+func timeTrialState(session *timetrial.Session) map[string]interface{} {
+	return map[string]interface{}{
+		"id":     session.ID(),
+		"active": session.Active(),
+		"runs":   session.Runs(),
+	}
+}
+
+// handleSlips lists the spooled ET slips (GET)
+func (s *Server) handleSlips(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+	spooler, ok := s.api.GetSlipSpooler()
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("slip printing not started"))
+		return
+	}
+	writeJSON(w, http.StatusOK, spooler.Jobs())
+}
+
+// handleSlipReprint serves POST /api/slips/{run_number}/reprint
+func (s *Server) handleSlipReprint(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/slips/"), "/"), "/")
+	if len(parts) != 2 || parts[1] != "reprint" {
+		writeError(w, http.StatusNotFound, fmt.Errorf("unknown slip path %s", r.URL.Path))
+		return
+	}
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+	runNumber, err := strconv.Atoi(parts[0])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid run number: %v", err))
+		return
+	}
+	if err := s.api.ReprintSlip(runNumber); err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]interface{}{"run_number": runNumber, "status": "queued"})
+}
+
+// handleRaces lists races (GET) or starts a new race (POST)
+func (s *Server) handleRaces(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		query, err := parseRaceQuery(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, s.api.QueryRaces(query))
+
+	case http.MethodPost:
+		var opts api.RaceOptions
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&opts); err != nil {
+				writeError(w, http.StatusBadRequest, err)
+				return
+			}
+		}
+		if opts.SessionID == "" {
+			opts.SessionID = s.Session()
+		}
+		if opts.RequestID == "" {
+			opts.RequestID = r.Header.Get("Idempotency-Key")
+		}
+		raceID, err := s.api.StartRaceWithOptions(opts)
+		if err != nil {
+			writeError(w, http.StatusConflict, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, map[string]string{
+			"race_id":  raceID,
+			"short_id": s.api.GetShortRaceID(raceID),
+		})
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+	}
+}
+
+// handleExport exports the runs of the races matching the race list's query
+// parameters (GET), say ?tag=qualifying
+func (s *Server) handleExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+	query, err := parseRaceQuery(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	// Published results never carry personal driver data
+	records, err := s.api.ExportRaces(query, export.PublicConfig())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, records)
+}
+
+// handleRace serves /api/races/{id}[/{resource}]
+func (s *Server) handleRace(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/races/"), "/"), "/")
+	raceID := parts[0]
+	resource := ""
+	if len(parts) > 1 {
+		resource = parts[1]
+	}
+
+	if !s.api.RaceExists(raceID) {
+		writeError(w, http.StatusNotFound, fmt.Errorf("race %s not found", raceID))
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		switch resource {
+		case "state":
+			s.handleStateStream(w, r, raceID)
+		case "":
+			s.writeDocument(w, r, raceID, api.DocumentRaceStatus)
+		case "tree":
+			if r.URL.Query().Get("format") == "canvas" {
+				s.writeDocument(w, r, raceID, api.DocumentTreeCanvas)
+				return
+			}
+			s.writeDocument(w, r, raceID, api.DocumentTreeStatus)
+		case "results":
+			s.writeDocument(w, r, raceID, api.DocumentResults)
+		case "staging":
+			motion, err := s.api.GetStagingMotionByID(raceID)
+			if err != nil {
+				writeError(w, http.StatusNotFound, err)
+				return
+			}
+			writeJSON(w, http.StatusOK, motion)
+		case "autostart":
+			cfg, err := s.api.GetAutoStartConfigByID(raceID)
+			if err != nil {
+				writeError(w, http.StatusNotFound, err)
+				return
+			}
+			writeJSON(w, http.StatusOK, cfg)
+		case "export":
+			// Published results never carry personal driver data
+			records, err := s.api.ExportRaceByID(raceID, export.PublicConfig())
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, err)
+				return
+			}
+			writeJSON(w, http.StatusOK, records)
+		default:
+			writeError(w, http.StatusNotFound, fmt.Errorf("unknown resource %q", resource))
+		}
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+
+	if resource == "tags" {
+		values := r.URL.Query()
+		raceTags, err := s.api.TagRaceByID(raceID, tags.Split(values.Get("add")), tags.Split(values.Get("remove")))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"race_id": raceID, "tags": raceTags})
+		return
+	}
+
+	var err error
+	switch resource {
+	case "arm":
+		var override *api.SafetyOverride
+		if by := r.URL.Query().Get("override_by"); by != "" {
+			override = &api.SafetyOverride{By: by, Reason: r.URL.Query().Get("reason")}
+		}
+		err = s.api.ArmTreeWithOverrideByID(raceID, override)
+	case "disarm":
+		err = s.api.DisarmTreeByID(raceID)
+	case "override":
+		err = s.api.SetStarterOverrideByID(raceID, r.URL.Query().Get("enabled") != "false")
+	case "trigger":
+		err = s.api.TriggerTreeByID(raceID)
+	case "advance":
+		err = s.api.AdvancePhaseByID(raceID)
+	case "abort":
+		reason := r.URL.Query().Get("reason")
+		if reason == "" {
+			reason = "aborted via HTTP"
+		}
+		err = s.api.AbortRaceByID(raceID, reason)
+	case "hold":
+		lane, convErr := strconv.Atoi(r.URL.Query().Get("lane"))
+		if convErr != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid lane: %v", convErr))
+			return
+		}
+		err = s.api.HoldLaneByID(raceID, lane, r.URL.Query().Get("held") != "false")
+	case "disqualify":
+		lane, convErr := strconv.Atoi(r.URL.Query().Get("lane"))
+		if convErr != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid lane: %v", convErr))
+			return
+		}
+		reason := r.URL.Query().Get("reason")
+		if reason == "" {
+			reason = "disqualified via HTTP"
+		}
+		err = s.api.DisqualifyLaneByID(raceID, lane, reason)
+	case "resolve":
+		lane, convErr := strconv.Atoi(r.URL.Query().Get("lane"))
+		if convErr != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid lane: %v", convErr))
+			return
+		}
+		err = s.api.ResolveFinishByID(raceID, lane)
+	case "start_signal":
+		err = s.api.StartSignalByID(raceID, time.Time{})
+	case "boundary":
+		lane, convErr := strconv.Atoi(r.URL.Query().Get("lane"))
+		if convErr != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid lane: %v", convErr))
+			return
+		}
+		if boundary := r.URL.Query().Get("boundary"); boundary != "" {
+			err = s.api.ReportBoundarySensorByID(raceID, lane, boundary, time.Time{})
+		} else {
+			err = s.api.ReportBoundaryFoulByID(raceID, lane)
+		}
+	case "position":
+		lane, convErr := strconv.Atoi(r.URL.Query().Get("lane"))
+		if convErr != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid lane: %v", convErr))
+			return
+		}
+		offset, convErr := strconv.ParseFloat(r.URL.Query().Get("offset"), 64)
+		if convErr != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid offset: %v", convErr))
+			return
+		}
+		err = s.api.ReportLateralPositionByID(raceID, lane, offset, time.Time{})
+	case "manual":
+		var entry timing.ManualResult
+		if err := json.NewDecoder(r.Body).Decode(&entry); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		err = s.api.EnterManualResultByID(raceID, entry)
+	case "sync":
+		var mark timing.SyncMark
+		if err := json.NewDecoder(r.Body).Decode(&mark); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		err = s.api.AddSyncMarkByID(raceID, mark)
+	default:
+		writeError(w, http.StatusNotFound, fmt.Errorf("unknown action %q", resource))
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"race_id": raceID, "action": resource})
+}
+
+// handleEvents streams events as JSON text frames over a WebSocket. The
+// optional race_id query parameter limits the stream to a single race,
+// starting with the race's events already published so a client
+// reconnecting mid-race catches up.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	ws, err := upgradeWebSocket(w, r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	defer ws.Close()
+
+	raceID := r.URL.Query().Get("race_id")
+	outbox := make(chan []byte, 256)
+
+	handler := func(e events.Event) {
+		data, err := json.Marshal(e)
+		if err != nil {
+			return
+		}
+		select {
+		case outbox <- data:
+		default:
+			// Slow client, drop the event rather than block the bus
+		}
+	}
+	var unsubscribe func()
+	if raceID != "" {
+		unsubscribe = s.api.SubscribeWithReplay(raceID, handler)
+	} else {
+		unsubscribe = s.api.SubscribeAll(handler)
+	}
+	defer unsubscribe()
+
+	for {
+		select {
+		case data := <-outbox:
+			if err := ws.WriteText(data); err != nil {
+				return
+			}
+		case <-ws.Closed():
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// handleStateStream streams a race's tree and staging state over a WebSocket
+// as periodic snapshots plus JSON Patch diffs. The snapshot_ms and diff_ms
+// query parameters set the rates; any client message forces a snapshot.
+func (s *Server) handleStateStream(w http.ResponseWriter, r *http.Request, raceID string) {
+	values := r.URL.Query()
+	var intervals [2]time.Duration
+	for i, name := range []string{"snapshot_ms", "diff_ms"} {
+		if v := values.Get(name); v != "" {
+			ms, err := strconv.Atoi(v)
+			if err != nil || ms <= 0 {
+				writeError(w, http.StatusBadRequest, fmt.Errorf("invalid %s: %q", name, v))
+				return
+			}
+			intervals[i] = time.Duration(ms) * time.Millisecond
+		}
+	}
+
+	ws, err := upgradeWebSocket(w, r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	defer ws.Close()
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	go func() {
+		select {
+		case <-ws.Closed():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	stream := snapshot.NewStream(s.stateSource(raceID), intervals[0], intervals[1])
+
+	stream.Run(ctx, ws.Received(), func(frame snapshot.Frame) error {
+		data, err := json.Marshal(frame)
+		if err != nil {
+			return err
+		}
+		return ws.WriteText(data)
+	})
+}
+
+// stateSource reads a race's live tree and staging state for a state
+// stream, from the race itself rather than through the polled documents
+func (s *Server) stateSource(raceID string) snapshot.Source {
+	return func() ([]byte, error) {
+		state, err := s.api.GetLiveStateByID(raceID)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(state)
+	}
+}
+
+// parseRaceQuery builds a RaceQuery from URL parameters
+func parseRaceQuery(r *http.Request) (api.RaceQuery, error) {
+	values := r.URL.Query()
+	query := api.RaceQuery{
+		Class:     values.Get("class"),
+		SessionID: values.Get("session"),
+	}
+	for _, state := range values["state"] {
+		query.States = append(query.States, orchestrator.RaceState(state))
+	}
+	for _, external := range values["external"] {
+		name, id, ok := strings.Cut(external, ":")
+		if !ok {
+			return query, fmt.Errorf("invalid external ID %q, want name:id", external)
+		}
+		if query.External == nil {
+			query.External = make(map[string]string)
+		}
+		query.External[name] = id
+	}
+	for _, list := range values["tag"] {
+		query.Tags.Tags = append(query.Tags.Tags, tags.Split(list)...)
+	}
+	for _, list := range values["exclude_tag"] {
+		query.Tags.Exclude = append(query.Tags.Exclude, tags.Split(list)...)
+	}
+
+	var err error
+	if v := values.Get("offset"); v != "" {
+		if query.Offset, err = strconv.Atoi(v); err != nil {
+			return query, fmt.Errorf("invalid offset: %v", err)
+		}
+	}
+	if v := values.Get("limit"); v != "" {
+		if query.Limit, err = strconv.Atoi(v); err != nil {
+			return query, fmt.Errorf("invalid limit: %v", err)
+		}
+	}
+	return query, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeDocument serves a race document polled by the requesting host. Its
+// version is the ETag, so a client sending it back in If-None-Match gets
+// 304 Not Modified until the document changes. Its poll metadata goes out
+// as headers, and a host polling over quota is pointed at the streaming
+// endpoint with a Link header.
+func (s *Server) writeDocument(w http.ResponseWriter, r *http.Request, raceID string, doc api.Document) {
+	client, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		client = r.RemoteAddr
+	}
+	data, info, err := s.api.GetDocumentByID(raceID, doc, client)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+
+	etag := fmt.Sprintf("\"%d\"", info.Version)
+	w.Header().Set("ETag", etag)
+	w.Header().Set("X-Libdrag-Polls", strconv.Itoa(info.Polls))
+	if info.Cached {
+		w.Header().Set("X-Libdrag-Cache", "hit")
+	} else {
+		w.Header().Set("X-Libdrag-Cache", "miss")
+	}
+	if info.Throttled {
+		w.Header().Set("X-Libdrag-Throttled", "true")
+	}
+	switch info.Stream {
+	case api.StreamEvents:
+		w.Header().Set("Link", fmt.Sprintf("</api/events?race_id=%s>; rel=\"alternate\"", raceID))
+	case api.StreamState:
+		w.Header().Set("Link", fmt.Sprintf("</api/races/%s/state>; rel=\"alternate\"", raceID))
+	}
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	writeRawJSON(w, string(data))
+}
+
+// etagMatches reports whether an If-None-Match header lists etag. Weak
+// validators match, as a GET compares them weakly.
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+func writeRawJSON(w http.ResponseWriter, data string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(data))
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,372 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/benharold/libdrag/pkg/api"
+	"github.com/benharold/libdrag/pkg/beam"
+	"github.com/benharold/libdrag/pkg/events"
+	"github.com/benharold/libdrag/pkg/snapshot"
+)
+
+func newTestServer(t *testing.T) (*api.LibDragAPI, *httptest.Server) {
+	libdragAPI := api.NewLibDragAPI()
+	if err := libdragAPI.Initialize(); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	srv := httptest.NewServer(NewServer(libdragAPI, "Test Dragway"))
+	t.Cleanup(func() {
+		srv.Close()
+		libdragAPI.Stop()
+	})
+	return libdragAPI, srv
+}
+
+func TestStartAndQueryRaces(t *testing.T) {
+	_, srv := newTestServer(t)
+
+	resp, err := http.Post(srv.URL+"/api/session", "application/json", strings.NewReader(`{"session_id":"elims-1"}`))
+	if err != nil {
+		t.Fatalf("Set session failed: %v", err)
+	}
+	resp.Body.Close()
+
+	resp, err = http.Post(srv.URL+"/api/races", "application/json", strings.NewReader(`{"class":"Super Gas"}`))
+	if err != nil {
+		t.Fatalf("Start race failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d", resp.StatusCode)
+	}
+	var started map[string]string
+	json.NewDecoder(resp.Body).Decode(&started)
+
+	resp, err = http.Get(srv.URL + "/api/races?session=elims-1&class=Super+Gas")
+	if err != nil {
+		t.Fatalf("Query races failed: %v", err)
+	}
+	defer resp.Body.Close()
+	var page api.RacePage
+	json.NewDecoder(resp.Body).Decode(&page)
+	if page.Total != 1 || page.Races[0].RaceID != started["race_id"] {
+		t.Fatalf("Expected started race in query results, got %+v", page)
+	}
+
+	resp, err = http.Get(srv.URL + "/api/races/" + started["race_id"] + "/tree")
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("Get tree status failed: %v", err)
+	}
+	resp.Body.Close()
+
+	resp, err = http.Get(srv.URL + "/api/races/missing")
+	if err != nil {
+		t.Fatalf("Get missing race failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("Expected status 404, got %d", resp.StatusCode)
+	}
+}
+
+func TestTagRaces(t *testing.T) {
+	_, srv := newTestServer(t)
+
+	start := func(body string) string {
+		resp, err := http.Post(srv.URL+"/api/races", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("Start race failed: %v", err)
+		}
+		defer resp.Body.Close()
+		var started map[string]string
+		json.NewDecoder(resp.Body).Decode(&started)
+		return started["race_id"]
+	}
+	qualifying := start(`{"tags":["Qualifying"]}`)
+	testPass := start(`{"tags":["test-pass"]}`)
+
+	resp, err := http.Post(srv.URL+"/api/races/"+qualifying+"/tags?add=rain-shortened", "application/json", nil)
+	if err != nil {
+		t.Fatalf("Tag race failed: %v", err)
+	}
+	var tagged struct {
+		Tags []string `json:"tags"`
+	}
+	json.NewDecoder(resp.Body).Decode(&tagged)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || strings.Join(tagged.Tags, ",") != "qualifying,rain-shortened" {
+		t.Fatalf("Expected the race tagged, got %d %v", resp.StatusCode, tagged.Tags)
+	}
+
+	query := func(params string) []string {
+		resp, err := http.Get(srv.URL + "/api/races?" + params)
+		if err != nil {
+			t.Fatalf("Query races failed: %v", err)
+		}
+		defer resp.Body.Close()
+		var page api.RacePage
+		json.NewDecoder(resp.Body).Decode(&page)
+		var ids []string
+		for _, race := range page.Races {
+			ids = append(ids, race.RaceID)
+		}
+		return ids
+	}
+	if ids := query("tag=rain-shortened"); len(ids) != 1 || ids[0] != qualifying {
+		t.Errorf("Expected the rain-shortened race, got %v", ids)
+	}
+	if ids := query("exclude_tag=qualifying,exhibition"); len(ids) != 1 || ids[0] != testPass {
+		t.Errorf("Expected the test pass, got %v", ids)
+	}
+
+	resp, err = http.Get(srv.URL + "/api/export?tag=qualifying")
+	if err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected status 200 from the export, got %d", resp.StatusCode)
+	}
+}
+
+func TestPollingHeaders(t *testing.T) {
+	libdragAPI, srv := newTestServer(t)
+	libdragAPI.SetPollingConfig(api.PollingConfig{Window: time.Minute, MaxRate: 2})
+
+	resp, err := http.Post(srv.URL+"/api/races", "application/json", strings.NewReader(`{"live_beams":true}`))
+	if err != nil {
+		t.Fatalf("Start race failed: %v", err)
+	}
+	var started map[string]string
+	json.NewDecoder(resp.Body).Decode(&started)
+	resp.Body.Close()
+
+	var headers []http.Header
+	for i := 0; i < 3; i++ {
+		resp, err := http.Get(srv.URL + "/api/races/" + started["race_id"] + "/results")
+		if err != nil || resp.StatusCode != http.StatusOK {
+			t.Fatalf("Get results failed: %v", err)
+		}
+		resp.Body.Close()
+		headers = append(headers, resp.Header)
+	}
+	if headers[0].Get("X-Libdrag-Cache") != "miss" || headers[1].Get("X-Libdrag-Cache") != "hit" || headers[1].Get("Link") != "" {
+		t.Errorf("Expected the unchanged results cached, got %v and %v", headers[0], headers[1])
+	}
+	if link := headers[2].Get("Link"); headers[2].Get("X-Libdrag-Polls") != "3" || link != "</api/events?race_id="+started["race_id"]+">; rel=\"alternate\"" {
+		t.Errorf("Expected a poller over quota pointed at the event stream, got %v", headers[2])
+	}
+}
+
+func TestConditionalFetch(t *testing.T) {
+	libdragAPI, srv := newTestServer(t)
+
+	raceID, err := libdragAPI.StartRaceWithOptions(api.RaceOptions{LiveBeams: true})
+	if err != nil {
+		t.Fatalf("StartRaceWithOptions failed: %v", err)
+	}
+	get := func(etag string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+"/api/races/"+raceID+"/tree", nil)
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Get tree status failed: %v", err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	first := get("")
+	etag := first.Header.Get("ETag")
+	if first.StatusCode != http.StatusOK || etag != `"1"` {
+		t.Fatalf("Expected the first version, got %d with ETag %q", first.StatusCode, etag)
+	}
+	if resp := get(etag); resp.StatusCode != http.StatusNotModified {
+		t.Errorf("Expected 304 for an unchanged tree, got %d", resp.StatusCode)
+	}
+
+	libdragAPI.SetStagingBeamByID(raceID, 1, beam.BeamPreStage, true)
+	if resp := get(etag); resp.StatusCode != http.StatusOK || resp.Header.Get("ETag") != `"2"` {
+		t.Errorf("Expected the changed tree as version 2, got %d with ETag %q", resp.StatusCode, resp.Header.Get("ETag"))
+	}
+}
+
+// dialWebSocket opens a WebSocket to path and returns the connection and reader
+func dialWebSocket(t *testing.T, srv *httptest.Server, path string) (net.Conn, *bufio.Reader) {
+	t.Helper()
+	conn, err := net.Dial("tcp", strings.TrimPrefix(srv.URL, "http://"))
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	fmt.Fprintf(conn, "GET %s HTTP/1.1\r\nHost: test\r\nConnection: Upgrade\r\nUpgrade: websocket\r\nSec-WebSocket-Version: 13\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n\r\n", path)
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatalf("Handshake failed: %v", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("Expected status 101, got %d", resp.StatusCode)
+	}
+	if accept := resp.Header.Get("Sec-WebSocket-Accept"); accept != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("Unexpected accept key %q", accept)
+	}
+	return conn, reader
+}
+
+// readTextFrame reads a single unfragmented text frame
+func readTextFrame(t *testing.T, conn net.Conn, reader *bufio.Reader) []byte {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		t.Fatalf("Read frame failed: %v", err)
+	}
+	if header[0] != 0x81 {
+		t.Fatalf("Expected final text frame, got %#x", header[0])
+	}
+	length := int(header[1] & 0x7F)
+	if length == 126 {
+		ext := make([]byte, 2)
+		if _, err := io.ReadFull(reader, ext); err != nil {
+			t.Fatalf("Read length failed: %v", err)
+		}
+		length = int(ext[0])<<8 | int(ext[1])
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		t.Fatalf("Read payload failed: %v", err)
+	}
+	return payload
+}
+
+func TestEventStream(t *testing.T) {
+	libdragAPI, srv := newTestServer(t)
+	conn, reader := dialWebSocket(t, srv, "/api/events")
+
+	// Give the handler time to subscribe before publishing
+	time.Sleep(50 * time.Millisecond)
+	libdragAPI.PublishEvent(events.NewEvent(events.EventRaceStart).WithRaceID("race-1").Build())
+
+	var event events.Event
+	if err := json.Unmarshal(readTextFrame(t, conn, reader), &event); err != nil {
+		t.Fatalf("Invalid event JSON: %v", err)
+	}
+	if event.Type != events.EventRaceStart || event.RaceID != "race-1" {
+		t.Fatalf("Unexpected event %+v", event)
+	}
+}
+
+func TestStateStream(t *testing.T) {
+	libdragAPI, srv := newTestServer(t)
+	raceID, err := libdragAPI.StartRaceWithID()
+	if err != nil {
+		t.Fatalf("Start race failed: %v", err)
+	}
+	conn, reader := dialWebSocket(t, srv, "/api/races/"+raceID+"/state?snapshot_ms=60000&diff_ms=10")
+
+	var frame snapshot.Frame
+	if err := json.Unmarshal(readTextFrame(t, conn, reader), &frame); err != nil {
+		t.Fatalf("Invalid frame JSON: %v", err)
+	}
+	if frame.Type != snapshot.FrameSnapshot || frame.Seq != 1 || len(frame.State) == 0 {
+		t.Fatalf("Expected initial snapshot, got %+v", frame)
+	}
+	var state api.LiveState
+	if err := json.Unmarshal(frame.State, &state); err != nil || state.Tree == nil || state.Race.State == "" || state.Staging == nil {
+		t.Fatalf("Expected the race, tree and staging state in the snapshot, got %s (%v)", frame.State, err)
+	}
+}
+
+func TestUDPStateFeed(t *testing.T) {
+	libdragAPI := api.NewLibDragAPI()
+	if err := libdragAPI.Initialize(); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	defer libdragAPI.Stop()
+	raceID, err := libdragAPI.StartRaceWithOptions(api.RaceOptions{LiveBeams: true})
+	if err != nil {
+		t.Fatalf("Start race failed: %v", err)
+	}
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	defer conn.Close()
+	feed := NewServer(libdragAPI, "Test Dragway").NewUDPFeed(conn)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go feed.Serve(ctx)
+
+	client, err := net.Dial("udp", conn.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer client.Close()
+	read := func() snapshot.Frame {
+		t.Helper()
+		client.SetReadDeadline(time.Now().Add(5 * time.Second))
+		buf := make([]byte, 64*1024)
+		n, err := client.Read(buf)
+		if err != nil {
+			t.Fatalf("Read failed: %v", err)
+		}
+		var frame snapshot.Frame
+		if err := json.Unmarshal(buf[:n], &frame); err != nil {
+			t.Fatalf("Invalid frame %s: %v", buf[:n], err)
+		}
+		return frame
+	}
+
+	fmt.Fprintf(client, `{"race_id": %q, "snapshot_ms": 60000, "diff_ms": 10}`, raceID)
+	if frame := read(); frame.Type != snapshot.FrameSnapshot || frame.Seq != 1 {
+		t.Fatalf("Expected an initial snapshot, got %+v", frame)
+	}
+
+	// Staging arrives as a diff of the staging state
+	libdragAPI.SetStagingBeamByID(raceID, 1, beam.BeamPreStage, true)
+	frame := read()
+	if frame.Type != snapshot.FrameDiff || frame.Seq != 2 || len(frame.Patch) == 0 {
+		t.Fatalf("Expected a diff after pre-staging, got %+v", frame)
+	}
+
+	// Subscribing again resyncs with a snapshot
+	fmt.Fprintf(client, `{"race_id": %q}`, raceID)
+	for {
+		if frame := read(); frame.Type == snapshot.FrameSnapshot {
+			var state api.LiveState
+			if err := json.Unmarshal(frame.State, &state); err != nil || state.Tree.LightStates[1]["pre_stage"] != "on" {
+				t.Fatalf("Expected a snapshot with lane 1 pre-staged, got %s (%v)", frame.State, err)
+			}
+			break
+		}
+	}
+
+	fmt.Fprint(client, `{"race_id": "no-such-race"}`)
+	client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := client.Read(buf)
+		if err != nil {
+			t.Fatalf("Expected an error for an unknown race: %v", err)
+		}
+		if strings.Contains(string(buf[:n]), "not found") {
+			break
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/benharold/libdrag/pkg/logs"
+	"github.com/benharold/libdrag/pkg/snapshot"
+)
+
+// DefaultUDPClientTimeout is how long a UDP state client is streamed to
+// without sending anything
+const DefaultUDPClientTimeout = 30 * time.Second
+
+// maxUDPRequest bounds a subscription datagram
+const maxUDPRequest = 1024
+
+// UDPSubscription is the datagram a client sends to a UDP state feed to
+// stream a race's state, at the given rates (the defaults when zero)
+type UDPSubscription struct {
+	RaceID     string `json:"race_id"`
+	SnapshotMS int    `json:"snapshot_ms,omitempty"`
+	DiffMS     int    `json:"diff_ms,omitempty"`
+}
+
+// udpClient is a client streamed a race's state
+type udpClient struct {
+	raceID string
+	resync chan struct{}
+	cancel context.CancelFunc
+	seen   time.Time
+}
+
+// UDPFeed streams races' tree and staging state over UDP as the same
+// snapshot and JSON Patch frames as the WebSocket state stream, one frame
+// per datagram. A client subscribes by sending a UDPSubscription; sending
+// it again (or any datagram) forces a snapshot, which is how a client that
+// lost a frame resyncs, and keeps the subscription alive. A client that
+// sends nothing for the timeout is dropped.
+type UDPFeed struct {
+	server  *Server
+	conn    net.PacketConn
+	timeout time.Duration
+	logger  *slog.Logger
+
+	mu      sync.Mutex
+	clients map[string]*udpClient
+}
+
+// NewUDPFeed creates a UDP state feed for the server's races on conn
+func (s *Server) NewUDPFeed(conn net.PacketConn) *UDPFeed {
+	return &UDPFeed{
+		server:  s,
+		conn:    conn,
+		timeout: DefaultUDPClientTimeout,
+		clients: make(map[string]*udpClient),
+	}
+}
+
+// SetClientTimeout drops clients that send nothing for timeout. Call it
+// before Serve.
+func (f *UDPFeed) SetClientTimeout(timeout time.Duration) {
+	f.timeout = timeout
+}
+
+// SetLogger logs subscriptions to logger instead of logs.Default
+func (f *UDPFeed) SetLogger(logger *slog.Logger) {
+	f.logger = logger
+}
+
+// Serve reads subscriptions until ctx is done or the connection fails,
+// then stops every stream
+func (f *UDPFeed) Serve(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		<-ctx.Done()
+		f.conn.SetReadDeadline(time.Now())
+	}()
+
+	buf := make([]byte, maxUDPRequest)
+	for {
+		n, addr, err := f.conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		var sub UDPSubscription
+		if err := json.Unmarshal(buf[:n], &sub); err != nil || sub.RaceID == "" {
+			f.reply(addr, fmt.Errorf("invalid subscription, want {\"race_id\": ...}"))
+			continue
+		}
+		f.subscribe(ctx, addr, sub)
+	}
+}
+
+// subscribe starts streaming a race to a client, or resyncs a client
+// already streamed it
+func (f *UDPFeed) subscribe(ctx context.Context, addr net.Addr, sub UDPSubscription) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	key := addr.String()
+	if client, ok := f.clients[key]; ok {
+		client.seen = time.Now()
+		if client.raceID == sub.RaceID {
+			select {
+			case client.resync <- struct{}{}:
+			default: // A snapshot is already due
+			}
+			return
+		}
+		client.cancel()
+	}
+	if !f.server.api.RaceExists(sub.RaceID) {
+		delete(f.clients, key)
+		go f.reply(addr, fmt.Errorf("race %s not found", sub.RaceID))
+		return
+	}
+
+	streamCtx, cancel := context.WithCancel(ctx)
+	client := &udpClient{raceID: sub.RaceID, resync: make(chan struct{}, 1), cancel: cancel, seen: time.Now()}
+	f.clients[key] = client
+	logs.For(f.logger, "server", sub.RaceID).Info("📡 UDP state client subscribed", "addr", key)
+
+	stream := snapshot.NewStream(f.server.stateSource(sub.RaceID),
+		time.Duration(sub.SnapshotMS)*time.Millisecond, time.Duration(sub.DiffMS)*time.Millisecond)
+	go func() {
+		stream.Run(streamCtx, client.resync, func(frame snapshot.Frame) error {
+			if f.expired(key, client) {
+				return fmt.Errorf("client timed out")
+			}
+			data, err := json.Marshal(frame)
+			if err != nil {
+				return err
+			}
+			_, err = f.conn.WriteTo(data, addr)
+			return err
+		})
+		f.drop(key, client)
+	}()
+}
+
+// expired reports whether a client has sent nothing for the timeout
+func (f *UDPFeed) expired(key string, client *udpClient) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.clients[key] != client || time.Since(client.seen) > f.timeout
+}
+
+// drop forgets a client whose stream ended
+func (f *UDPFeed) drop(key string, client *udpClient) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	client.cancel()
+	if f.clients[key] == client {
+		delete(f.clients, key)
+	}
+}
+
+// reply sends a client an error datagram
+func (f *UDPFeed) reply(addr net.Addr, err error) {
+	data, _ := json.Marshal(map[string]string{"error": err.Error()})
+	f.conn.WriteTo(data, addr)
+}
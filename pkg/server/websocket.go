@@ -0,0 +1,189 @@
+package server
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// websocketGUID is the fixed key suffix from RFC 6455
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// WebSocket opcodes used by the server
+const (
+	opText  = 0x1
+	opClose = 0x8
+	opPing  = 0x9
+	opPong  = 0xA
+)
+
+// wsConn is a minimal server-side WebSocket connection for pushing text
+// messages. Client data frames are discarded after signalling Received.
+type wsConn struct {
+	conn     net.Conn
+	rw       *bufio.ReadWriter
+	mu       sync.Mutex
+	closed   chan struct{}
+	received chan struct{}
+	once     sync.Once
+}
+
+// upgradeWebSocket performs the RFC 6455 opening handshake
+func upgradeWebSocket(w http.ResponseWriter, r *http.Request) (*wsConn, error) {
+	if !headerContains(r.Header, "Connection", "upgrade") || !headerContains(r.Header, "Upgrade", "websocket") {
+		return nil, fmt.Errorf("not a websocket handshake")
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		return nil, fmt.Errorf("missing Sec-WebSocket-Key")
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		return nil, fmt.Errorf("connection does not support hijacking")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	accept := base64.StdEncoding.EncodeToString(sum[:])
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n", accept)
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	ws := &wsConn{conn: conn, rw: rw, closed: make(chan struct{}), received: make(chan struct{}, 1)}
+	go ws.readLoop()
+	return ws, nil
+}
+
+// WriteText sends a single unfragmented text frame
+func (ws *wsConn) WriteText(payload []byte) error {
+	return ws.writeFrame(opText, payload)
+}
+
+// Closed is closed once the client disconnects
+func (ws *wsConn) Closed() <-chan struct{} {
+	return ws.closed
+}
+
+// Received signals when the client sends a text message
+func (ws *wsConn) Received() <-chan struct{} {
+	return ws.received
+}
+
+// Close sends a close frame and closes the connection
+func (ws *wsConn) Close() error {
+	ws.writeFrame(opClose, nil)
+	ws.once.Do(func() { close(ws.closed) })
+	return ws.conn.Close()
+}
+
+func (ws *wsConn) writeFrame(opcode byte, payload []byte) error {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	header := []byte{0x80 | opcode}
+	switch n := len(payload); {
+	case n < 126:
+		header = append(header, byte(n))
+	case n <= 0xFFFF:
+		header = append(header, 126, 0, 0)
+		binary.BigEndian.PutUint16(header[2:], uint16(n))
+	default:
+		header = append(header, 127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(header[2:], uint64(n))
+	}
+
+	if _, err := ws.rw.Write(header); err != nil {
+		return err
+	}
+	if _, err := ws.rw.Write(payload); err != nil {
+		return err
+	}
+	return ws.rw.Flush()
+}
+
+// readLoop consumes client frames, answering pings and detecting close
+func (ws *wsConn) readLoop() {
+	defer ws.once.Do(func() { close(ws.closed) })
+
+	header := make([]byte, 2)
+	for {
+		if _, err := io.ReadFull(ws.rw, header); err != nil {
+			return
+		}
+		opcode := header[0] & 0x0F
+		masked := header[1]&0x80 != 0
+		length := uint64(header[1] & 0x7F)
+
+		switch length {
+		case 126:
+			ext := make([]byte, 2)
+			if _, err := io.ReadFull(ws.rw, ext); err != nil {
+				return
+			}
+			length = uint64(binary.BigEndian.Uint16(ext))
+		case 127:
+			ext := make([]byte, 8)
+			if _, err := io.ReadFull(ws.rw, ext); err != nil {
+				return
+			}
+			length = binary.BigEndian.Uint64(ext)
+		}
+
+		var mask [4]byte
+		if masked {
+			if _, err := io.ReadFull(ws.rw, mask[:]); err != nil {
+				return
+			}
+		}
+
+		// Control frames are small; data frames from clients are ignored
+		if opcode == opPing && length <= 125 {
+			payload := make([]byte, length)
+			if _, err := io.ReadFull(ws.rw, payload); err != nil {
+				return
+			}
+			for i := range payload {
+				payload[i] ^= mask[i%4]
+			}
+			ws.writeFrame(opPong, payload)
+			continue
+		}
+		if _, err := io.CopyN(io.Discard, ws.rw, int64(length)); err != nil {
+			return
+		}
+		if opcode == opClose {
+			return
+		}
+		if opcode == opText {
+			select {
+			case ws.received <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// headerContains reports whether a comma-separated header contains token
+func headerContains(h http.Header, name, token string) bool {
+	for _, value := range h.Values(name) {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,354 @@
+package simulation
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Physical constants and unit conversions. Vehicles are described in the
+// units drag racers use; the model runs in SI.
+const (
+	gravity     = 9.80665 // m/s²
+	kgPerLb     = 0.45359237
+	nmPerLbFt   = 1.3558179
+	metersPerIn = 0.0254
+	metersPerFt = 0.3048
+	sqmPerSqFt  = 0.09290304
+	mphPerMps   = 2.2369363
+
+	// physicsStep is the model's integration step
+	physicsStep = time.Millisecond
+
+	// maxPhysicsRun is the longest run modeled; a car that has not covered
+	// the distance by then stops where it is
+	maxPhysicsRun = time.Minute
+
+	// trapLength is the NHRA speed trap (feet before the finish) over which
+	// modeled trap speeds are averaged
+	trapLength = 66.0
+)
+
+// Defaults for optional vehicle fields
+const (
+	DefaultEfficiency        = 0.85  // Driveline
+	DefaultRollingResistance = 0.015 // Drag slicks on a prepped surface
+	DefaultAirDensity        = 1.2   // kg/m³, about sea level on a mild day
+	DefaultRollout           = 11.5  // Inches from staged to clearing the stage beam
+)
+
+// TorquePoint is a point on an engine's torque curve
+type TorquePoint struct {
+	RPM    float64 `json:"rpm"`
+	Torque float64 `json:"torque"` // lb-ft at the crank
+}
+
+// Vehicle is a physical model of a car and its driver. A run is modeled
+// from the torque curve through the gearing to the tires, limited by the
+// tires' grip and slowed by aero drag and rolling resistance, giving a
+// continuous trace from which every beam's split and the trap speed follow.
+type Vehicle struct {
+	Name string `json:"name"`
+
+	Weight      float64       `json:"weight"`       // lb, with driver
+	TorqueCurve []TorquePoint `json:"torque_curve"` // By rising rpm; torque is linear between points
+	LaunchRPM   float64       `json:"launch_rpm"`   // The converter or clutch slips to hold it until the tires catch up
+	ShiftRPM    float64       `json:"shift_rpm"`
+	ShiftTime   time.Duration `json:"shift_time,omitempty"` // Without drive during each shift
+	Gears       []float64     `json:"gears"`
+	FinalDrive  float64       `json:"final_drive"`
+	Efficiency  float64       `json:"efficiency,omitempty"` // Driveline; zero uses DefaultEfficiency
+
+	TireDiameter float64 `json:"tire_diameter"` // Inches
+
+	// Traction is the tires' grip: the drive is limited to Traction times
+	// the weight on the driven wheels, a fraction DrivenWeight (zero is
+	// all of it) of the car's weight as it launches
+	Traction     float64 `json:"traction"`
+	DrivenWeight float64 `json:"driven_weight,omitempty"`
+
+	DragCoefficient   float64 `json:"drag_coefficient"`
+	FrontalArea       float64 `json:"frontal_area"`                 // sq ft
+	RollingResistance float64 `json:"rolling_resistance,omitempty"` // Zero uses DefaultRollingResistance
+	AirDensity        float64 `json:"air_density,omitempty"`        // kg/m³; zero uses DefaultAirDensity
+
+	// Rollout is how far (inches) the car moves before it clears the stage
+	// beam and its timed run starts; zero uses DefaultRollout
+	Rollout float64 `json:"rollout,omitempty"`
+
+	// ReactionTime is the driver's, from the green to the car moving; the
+	// timed reaction time adds the rollout. ReactionSpread is its standard
+	// deviation.
+	ReactionTime   time.Duration `json:"reaction_time"`
+	ReactionSpread time.Duration `json:"reaction_spread,omitempty"`
+
+	// Variability is the run-to-run variation of power and grip (track and
+	// air conditions, tune), as a fraction
+	Variability float64 `json:"variability,omitempty"`
+}
+
+// Validate checks the vehicle can be modeled
+func (v Vehicle) Validate() error {
+	if v.Weight <= 0 || v.TireDiameter <= 0 || v.FinalDrive <= 0 || v.Traction <= 0 {
+		return fmt.Errorf("vehicle %q: weight, tire diameter, final drive and traction must be positive", v.Name)
+	}
+	if len(v.TorqueCurve) == 0 {
+		return fmt.Errorf("vehicle %q: no torque curve", v.Name)
+	}
+	for i, point := range v.TorqueCurve {
+		if point.Torque < 0 || (i > 0 && point.RPM <= v.TorqueCurve[i-1].RPM) {
+			return fmt.Errorf("vehicle %q: torque curve must run by rising rpm with no negative torque", v.Name)
+		}
+	}
+	if len(v.Gears) == 0 {
+		return fmt.Errorf("vehicle %q: no gears", v.Name)
+	}
+	for _, ratio := range v.Gears {
+		if ratio <= 0 {
+			return fmt.Errorf("vehicle %q: gear ratios must be positive", v.Name)
+		}
+	}
+	if v.ShiftRPM <= 0 && len(v.Gears) > 1 {
+		return fmt.Errorf("vehicle %q: shift rpm must be positive", v.Name)
+	}
+	if v.DrivenWeight < 0 || v.DrivenWeight > 1 || v.Efficiency < 0 || v.Efficiency > 1 {
+		return fmt.Errorf("vehicle %q: driven weight and efficiency are fractions", v.Name)
+	}
+	if v.DragCoefficient < 0 || v.FrontalArea < 0 || v.RollingResistance < 0 || v.AirDensity < 0 ||
+		v.Rollout < 0 || v.ShiftTime < 0 || v.ReactionSpread < 0 || v.Variability < 0 {
+		return fmt.Errorf("vehicle %q: drag, rolling resistance, rollout, shift time and spreads cannot be negative", v.Name)
+	}
+	return nil
+}
+
+// torque returns the engine's torque (lb-ft) at rpm, held at the curve's
+// ends outside it
+func (v Vehicle) torque(rpm float64) float64 {
+	curve := v.TorqueCurve
+	i := sort.Search(len(curve), func(i int) bool { return curve[i].RPM >= rpm })
+	switch i {
+	case 0:
+		return curve[0].Torque
+	case len(curve):
+		return curve[len(curve)-1].Torque
+	}
+	lo, hi := curve[i-1], curve[i]
+	return lo.Torque + (hi.Torque-lo.Torque)*(rpm-lo.RPM)/(hi.RPM-lo.RPM)
+}
+
+// TracePoint is the state of a modeled run
+type TracePoint struct {
+	At       time.Duration `json:"at"`       // From the car moving
+	Position float64       `json:"position"` // Feet from where it staged
+	Speed    float64       `json:"speed"`    // mph
+	Gear     int           `json:"gear"`     // From 1
+}
+
+// Trace is a modeled run, a point per step
+type Trace []TracePoint
+
+// Run models a run from a standing start until the car has covered
+// distance feet, or a minute has passed
+func (v Vehicle) Run(distance float64) Trace {
+	efficiency := orDefault(v.Efficiency, DefaultEfficiency)
+	rolling := orDefault(v.RollingResistance, DefaultRollingResistance)
+	density := orDefault(v.AirDensity, DefaultAirDensity)
+	driven := orDefault(v.DrivenWeight, 1)
+
+	mass := v.Weight * kgPerLb
+	radius := v.TireDiameter * metersPerIn / 2
+	grip := v.Traction * mass * gravity * driven
+	dragFactor := 0.5 * density * v.DragCoefficient * v.FrontalArea * sqmPerSqFt
+	target := distance * metersPerFt
+	dt := physicsStep.Seconds()
+
+	trace := Trace{{Gear: 1}}
+	var speed, position float64
+	gear := 0
+	shifting := time.Duration(0)
+	for at := physicsStep; at <= maxPhysicsRun && position < target; at += physicsStep {
+		ratio := v.Gears[gear] * v.FinalDrive
+		rpm := speed / radius * ratio * 60 / (2 * math.Pi)
+		if gear == 0 && rpm < v.LaunchRPM {
+			rpm = v.LaunchRPM
+		}
+		if gear < len(v.Gears)-1 && rpm >= v.ShiftRPM && shifting == 0 {
+			gear++
+			shifting = v.ShiftTime
+		}
+
+		drive := 0.0
+		if shifting > 0 {
+			shifting -= physicsStep
+		} else {
+			drive = v.torque(rpm) * nmPerLbFt * ratio * efficiency / radius
+			drive = math.Min(drive, grip)
+		}
+		resistance := dragFactor*speed*speed + rolling*mass*gravity
+		accel := (drive - resistance) / mass
+		if speed == 0 && accel < 0 {
+			accel = 0 // Resistance does not push a car backwards
+		}
+		speed = math.Max(speed+accel*dt, 0)
+		position += speed * dt
+
+		trace = append(trace, TracePoint{
+			At:       at,
+			Position: position / metersPerFt,
+			Speed:    speed * mphPerMps,
+			Gear:     gear + 1,
+		})
+	}
+	return trace
+}
+
+// TimeAt returns when the run reached position (feet), interpolating
+// between steps. It returns false if the run never got there.
+func (t Trace) TimeAt(position float64) (time.Duration, bool) {
+	i := sort.Search(len(t), func(i int) bool { return t[i].Position >= position })
+	switch {
+	case i == len(t):
+		return 0, false
+	case i == 0:
+		return t[0].At, true
+	}
+	lo, hi := t[i-1], t[i]
+	fraction := (position - lo.Position) / (hi.Position - lo.Position)
+	return lo.At + time.Duration(fraction*float64(hi.At-lo.At)), true
+}
+
+// Pass returns the timed pass the trace makes: splits from the car clearing
+// the stage beam, rollout inches from where it staged, and the trap speeds
+// averaged over the speed traps before the eighth mile and the finish. Beams the run never reached are not
+// crossed. The reaction time is the rollout time alone.
+func (t Trace) Pass(rollout float64) Pass {
+	start, ok := t.TimeAt(rollout / 12)
+	if !ok {
+		return Pass{}
+	}
+	split := func(feet float64) time.Duration {
+		at, ok := t.TimeAt(rollout/12 + feet)
+		if !ok {
+			return 0
+		}
+		return (at - start).Round(time.Millisecond)
+	}
+	pass := Pass{
+		ReactionTime: start,
+		SixtyFoot:    split(60),
+		ThreeThirty:  split(330),
+		EighthMile:   split(660),
+		ThousandFoot: split(1000),
+		QuarterMile:  split(1320),
+	}
+	if enter, finish := split(660-trapLength), pass.EighthMile; enter > 0 && finish > enter {
+		pass.EighthSpeed = trapLength / (finish - enter).Seconds() * 0.681818
+	}
+	if enter, finish := split(1320-trapLength), pass.QuarterMile; enter > 0 && finish > enter {
+		pass.TrapSpeed = trapLength / (finish - enter).Seconds() * 0.681818
+	}
+	return pass
+}
+
+// Profile models a run without variation and returns it as a profile,
+// for simulators that replay passes rather than model each one
+func (v Vehicle) Profile() (Profile, error) {
+	if err := v.Validate(); err != nil {
+		return Profile{}, err
+	}
+	rollout := orDefault(v.Rollout, DefaultRollout)
+	pass := v.Run(rollout/12 + 1320).Pass(rollout)
+	if pass.QuarterMile == 0 {
+		return Profile{}, fmt.Errorf("vehicle %q does not reach the finish line", v.Name)
+	}
+	return Profile{
+		Name:           v.Name,
+		ReactionTime:   (v.ReactionTime + pass.ReactionTime).Round(time.Millisecond),
+		ReactionSpread: v.ReactionSpread,
+		SixtyFoot:      pass.SixtyFoot,
+		ThreeThirty:    pass.ThreeThirty,
+		EighthMile:     pass.EighthMile,
+		ThousandFoot:   pass.ThousandFoot,
+		QuarterMile:    pass.QuarterMile,
+		TrapSpeed:      pass.TrapSpeed,
+		EighthSpeed:    pass.EighthSpeed,
+		Variability:    v.Variability,
+	}, nil
+}
+
+// PhysicsSimulator simulates each lane by modeling its vehicle's run
+type PhysicsSimulator struct {
+	mu       sync.Mutex
+	vehicles map[int]Vehicle
+	fallback Vehicle
+	rng      *rand.Rand
+}
+
+// NewPhysicsSimulator simulates lanes with their vehicles, and lanes
+// without one with fallback. Variation is drawn from a source seeded with
+// seed, so a seed replays the same passes.
+func NewPhysicsSimulator(vehicles map[int]Vehicle, fallback Vehicle, seed int64) (*PhysicsSimulator, error) {
+	copied := make(map[int]Vehicle, len(vehicles))
+	for lane, vehicle := range vehicles {
+		if err := vehicle.Validate(); err != nil {
+			return nil, err
+		}
+		copied[lane] = vehicle
+	}
+	if err := fallback.Validate(); err != nil {
+		return nil, err
+	}
+	return &PhysicsSimulator{
+		vehicles: copied,
+		fallback: fallback,
+		rng:      rand.New(rand.NewSource(seed)),
+	}, nil
+}
+
+// Staging returns DefaultStaging
+func (s *PhysicsSimulator) Staging(lane int) Staging {
+	return DefaultStaging(lane)
+}
+
+// Pass models a run of the lane's vehicle, with its power and grip varied
+// together by the vehicle's variability
+func (s *PhysicsSimulator) Pass(lane int) Pass {
+	s.mu.Lock()
+	vehicle, ok := s.vehicles[lane]
+	if !ok {
+		vehicle = s.fallback
+	}
+	reaction := vehicle.ReactionTime
+	if vehicle.ReactionSpread > 0 {
+		reaction += time.Duration(s.rng.NormFloat64() * float64(vehicle.ReactionSpread))
+	}
+	factor := 1.0
+	if vehicle.Variability > 0 {
+		factor = max(1+s.rng.NormFloat64()*vehicle.Variability, 0.5)
+	}
+	s.mu.Unlock()
+
+	if factor != 1 {
+		curve := make([]TorquePoint, len(vehicle.TorqueCurve))
+		for i, point := range vehicle.TorqueCurve {
+			curve[i] = TorquePoint{RPM: point.RPM, Torque: point.Torque * factor}
+		}
+		vehicle.TorqueCurve = curve
+		vehicle.Traction *= factor
+	}
+	rollout := orDefault(vehicle.Rollout, DefaultRollout)
+	pass := vehicle.Run(rollout/12 + 1320).Pass(rollout)
+	pass.ReactionTime = (reaction + pass.ReactionTime).Round(time.Millisecond)
+	return pass
+}
+
+// orDefault returns value, or fallback when value is zero
+func orDefault(value, fallback float64) float64 {
+	if value == 0 {
+		return fallback
+	}
+	return value
+}
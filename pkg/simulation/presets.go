@@ -0,0 +1,155 @@
+package simulation
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// presetsJSON holds the presets shipped with the library
+//
+//go:embed presets.json
+var presetsJSON []byte
+
+// presetFile is a preset as written in a presets file, with times in
+// seconds
+type presetFile struct {
+	Name           string  `json:"name"`
+	Description    string  `json:"description,omitempty"`
+	ReactionTime   float64 `json:"reaction_time"`
+	ReactionSpread float64 `json:"reaction_spread,omitempty"`
+	SixtyFoot      float64 `json:"sixty_foot"`
+	ThreeThirty    float64 `json:"three_thirty,omitempty"`
+	EighthMile     float64 `json:"eighth_mile,omitempty"`
+	ThousandFoot   float64 `json:"thousand_foot,omitempty"`
+	QuarterMile    float64 `json:"quarter_mile"`
+	TrapSpeed      float64 `json:"trap_speed,omitempty"`
+	EighthSpeed    float64 `json:"eighth_speed,omitempty"`
+	Variability    float64 `json:"variability,omitempty"`
+}
+
+func (p presetFile) profile() Profile {
+	seconds := func(s float64) time.Duration {
+		return time.Duration(math.Round(s * float64(time.Second)))
+	}
+	return Profile{
+		Name:           p.Name,
+		Description:    p.Description,
+		ReactionTime:   seconds(p.ReactionTime),
+		ReactionSpread: seconds(p.ReactionSpread),
+		SixtyFoot:      seconds(p.SixtyFoot),
+		ThreeThirty:    seconds(p.ThreeThirty),
+		EighthMile:     seconds(p.EighthMile),
+		ThousandFoot:   seconds(p.ThousandFoot),
+		QuarterMile:    seconds(p.QuarterMile),
+		TrapSpeed:      p.TrapSpeed,
+		EighthSpeed:    p.EighthSpeed,
+		Variability:    p.Variability,
+	}
+}
+
+var (
+	presetsMu sync.RWMutex
+	presets   = make(map[string]Profile)
+)
+
+func init() {
+	if err := parsePresets(presetsJSON); err != nil {
+		panic(fmt.Sprintf("simulation: embedded presets: %v", err))
+	}
+}
+
+// LoadPresets adds the presets in a JSON array of profiles, with times in
+// seconds as in the embedded presets.json, replacing presets of the same
+// name. Nothing is added when any preset is invalid.
+func LoadPresets(r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	return parsePresets(data)
+}
+
+func parsePresets(data []byte) error {
+	var files []presetFile
+	if err := json.Unmarshal(data, &files); err != nil {
+		return err
+	}
+	profiles := make([]Profile, 0, len(files))
+	for _, file := range files {
+		profile := file.profile()
+		if profile.Name == "" {
+			return fmt.Errorf("preset name is required")
+		}
+		if err := profile.Validate(); err != nil {
+			return err
+		}
+		profiles = append(profiles, profile)
+	}
+
+	presetsMu.Lock()
+	defer presetsMu.Unlock()
+	for _, profile := range profiles {
+		presets[profile.Name] = profile
+	}
+	return nil
+}
+
+// RegisterPreset adds a preset, replacing any preset of the same name
+func RegisterPreset(profile Profile) error {
+	if profile.Name == "" {
+		return fmt.Errorf("preset name is required")
+	}
+	if err := profile.Validate(); err != nil {
+		return err
+	}
+	presetsMu.Lock()
+	defer presetsMu.Unlock()
+	presets[profile.Name] = profile
+	return nil
+}
+
+// Preset returns a preset profile by name: "top-fuel", "funny-car",
+// "pro-stock", "super-comp" and "street" ship with the library
+func Preset(name string) (Profile, bool) {
+	presetsMu.RLock()
+	defer presetsMu.RUnlock()
+	profile, ok := presets[name]
+	return profile, ok
+}
+
+// Presets returns every preset, sorted by name
+func Presets() []Profile {
+	presetsMu.RLock()
+	defer presetsMu.RUnlock()
+
+	profiles := make([]Profile, 0, len(presets))
+	for _, profile := range presets {
+		profiles = append(profiles, profile)
+	}
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].Name < profiles[j].Name })
+	return profiles
+}
+
+// NewMatchup simulates a matchup of presets by name, the first in lane 1,
+// the second in lane 2 and so on; lanes past the last run the last preset.
+// Variation is drawn from a source seeded with seed.
+func NewMatchup(seed int64, names ...string) (*ProfileSimulator, error) {
+	if len(names) == 0 {
+		return nil, fmt.Errorf("a matchup needs at least one preset")
+	}
+	profiles := make(map[int]Profile, len(names))
+	for i, name := range names {
+		profile, ok := Preset(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown simulation preset %q", name)
+		}
+		profiles[i+1] = profile
+	}
+	return NewProfileSimulator(profiles, profiles[len(names)], seed)
+}
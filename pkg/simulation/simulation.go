@@ -0,0 +1,231 @@
+// Package simulation decides how simulated vehicles stage and run, for races
+// played without real beams: demos, tests and practice. A Simulator gives
+// the orchestrator each lane's staging times and pass; ProfileSimulator draws
+// passes from vehicle performance profiles with run-to-run variation.
+package simulation
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Beam IDs a simulated pass crosses, in track order
+const (
+	BeamStage        = "stage"
+	BeamSixtyFoot    = "60_foot"
+	BeamThreeThirty  = "330_foot"
+	BeamEighthTrap   = "eighth_trap"
+	BeamEighthMile   = "660_foot"
+	BeamThousandFoot = "1000_foot"
+	BeamSpeedTrap    = "speed_trap"
+	BeamQuarterMile  = "1320_foot"
+)
+
+// Staging is when a simulated lane breaks the staging beams, measured from
+// the start of the race
+type Staging struct {
+	PreStage time.Duration `json:"pre_stage"`
+	Stage    time.Duration `json:"stage"`
+}
+
+// Pass is one lane's simulated pass. Splits are measured from leaving the
+// starting line; a zero split is not crossed (a car that broke or lifted).
+type Pass struct {
+	ReactionTime time.Duration `json:"reaction_time"` // From the lane's green; negative leaves early (red light)
+	SixtyFoot    time.Duration `json:"sixty_foot,omitempty"`
+	ThreeThirty  time.Duration `json:"three_thirty,omitempty"`
+	EighthMile   time.Duration `json:"eighth_mile,omitempty"`
+	ThousandFoot time.Duration `json:"thousand_foot,omitempty"`
+	QuarterMile  time.Duration `json:"quarter_mile,omitempty"`
+	TrapSpeed    float64       `json:"trap_speed,omitempty"`   // Through the speed trap (mph)
+	EighthSpeed  float64       `json:"eighth_speed,omitempty"` // Through the eighth-mile speed trap (mph)
+}
+
+// Split is a beam crossing of a pass
+type Split struct {
+	BeamID string
+	At     time.Duration // From leaving the starting line
+}
+
+// Splits returns the downtrack beams the pass crosses, in track order. The
+// speed trap entries are placed from the trap speeds when trapLength (feet)
+// is positive.
+func (p Pass) Splits(trapLength float64) []Split {
+	var splits []Split
+	add := func(beamID string, at time.Duration) {
+		if at > 0 {
+			splits = append(splits, Split{BeamID: beamID, At: at})
+		}
+	}
+	add(BeamSixtyFoot, p.SixtyFoot)
+	add(BeamThreeThirty, p.ThreeThirty)
+	if trapLength > 0 && p.EighthSpeed > 0 && p.EighthMile > 0 {
+		feetPerSecond := p.EighthSpeed / 0.681818
+		add(BeamEighthTrap, p.EighthMile-time.Duration(trapLength/feetPerSecond*float64(time.Second)))
+	}
+	add(BeamEighthMile, p.EighthMile)
+	add(BeamThousandFoot, p.ThousandFoot)
+	if trapLength > 0 && p.TrapSpeed > 0 && p.QuarterMile > 0 {
+		feetPerSecond := p.TrapSpeed / 0.681818
+		add(BeamSpeedTrap, p.QuarterMile-time.Duration(trapLength/feetPerSecond*float64(time.Second)))
+	}
+	add(BeamQuarterMile, p.QuarterMile)
+	return splits
+}
+
+// Simulator decides how simulated vehicles stage and run. Pass is called
+// once per lane per race.
+type Simulator interface {
+	Staging(lane int) Staging
+	Pass(lane int) Pass
+}
+
+// DefaultStaging is the staging simulated races have always used: lane 1
+// pre-stages half a second into the race and each lane follows the one
+// before, then the lanes stage in the same order
+func DefaultStaging(lane int) Staging {
+	return Staging{
+		PreStage: 500*time.Millisecond + time.Duration(lane-1)*200*time.Millisecond,
+		Stage:    1200*time.Millisecond + time.Duration(lane-1)*300*time.Millisecond,
+	}
+}
+
+// Profile describes how a vehicle performs. Times are averages; the
+// spreads are standard deviations.
+type Profile struct {
+	Name           string        `json:"name"`
+	Description    string        `json:"description,omitempty"`
+	ReactionTime   time.Duration `json:"reaction_time"`
+	ReactionSpread time.Duration `json:"reaction_spread,omitempty"`
+	SixtyFoot      time.Duration `json:"sixty_foot"`
+	ThreeThirty    time.Duration `json:"three_thirty,omitempty"`
+	EighthMile     time.Duration `json:"eighth_mile,omitempty"`
+	ThousandFoot   time.Duration `json:"thousand_foot,omitempty"`
+	QuarterMile    time.Duration `json:"quarter_mile"` // Elapsed time
+	TrapSpeed      float64       `json:"trap_speed,omitempty"`
+	EighthSpeed    float64       `json:"eighth_speed,omitempty"`
+
+	// Variability is the run-to-run variation of the splits and trap
+	// speed, as a fraction (0.01 varies an ET by about 1%)
+	Variability float64 `json:"variability,omitempty"`
+}
+
+// Validate checks the profile's splits run in track order
+func (p Profile) Validate() error {
+	if p.QuarterMile <= 0 {
+		return fmt.Errorf("profile %q: elapsed time must be positive", p.Name)
+	}
+	if p.ReactionSpread < 0 || p.Variability < 0 || p.TrapSpeed < 0 || p.EighthSpeed < 0 {
+		return fmt.Errorf("profile %q: spreads and trap speed cannot be negative", p.Name)
+	}
+	previous := time.Duration(0)
+	for _, split := range []time.Duration{p.SixtyFoot, p.ThreeThirty, p.EighthMile, p.ThousandFoot, p.QuarterMile} {
+		if split == 0 {
+			continue
+		}
+		if split <= previous {
+			return fmt.Errorf("profile %q: splits must increase down the track", p.Name)
+		}
+		previous = split
+	}
+	return nil
+}
+
+// ProfileSimulator simulates each lane from its vehicle profile
+type ProfileSimulator struct {
+	mu       sync.Mutex
+	profiles map[int]Profile
+	fallback Profile
+	rng      *rand.Rand
+}
+
+// NewProfileSimulator simulates lanes with their profiles, and lanes
+// without one with fallback. Variation is drawn from a source seeded with
+// seed, so a seed replays the same passes.
+func NewProfileSimulator(profiles map[int]Profile, fallback Profile, seed int64) (*ProfileSimulator, error) {
+	for _, profile := range profiles {
+		if err := profile.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	if err := fallback.Validate(); err != nil {
+		return nil, err
+	}
+	copied := make(map[int]Profile, len(profiles))
+	for lane, profile := range profiles {
+		copied[lane] = profile
+	}
+	return &ProfileSimulator{
+		profiles: copied,
+		fallback: fallback,
+		rng:      rand.New(rand.NewSource(seed)),
+	}, nil
+}
+
+// Staging returns DefaultStaging
+func (s *ProfileSimulator) Staging(lane int) Staging {
+	return DefaultStaging(lane)
+}
+
+// Pass draws a pass from the lane's profile. The splits vary together, so
+// a quicker run is quicker at every beam.
+func (s *ProfileSimulator) Pass(lane int) Pass {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	profile, ok := s.profiles[lane]
+	if !ok {
+		profile = s.fallback
+	}
+	reaction := profile.ReactionTime
+	if profile.ReactionSpread > 0 {
+		reaction += time.Duration(s.rng.NormFloat64() * float64(profile.ReactionSpread))
+	}
+	factor := 1.0
+	if profile.Variability > 0 {
+		factor += s.rng.NormFloat64() * profile.Variability
+		factor = max(factor, 0.5) // A pass can be slow, but never backwards
+	}
+	scale := func(split time.Duration) time.Duration {
+		return time.Duration(float64(split) * factor).Round(time.Millisecond)
+	}
+	return Pass{
+		ReactionTime: reaction.Round(time.Millisecond),
+		SixtyFoot:    scale(profile.SixtyFoot),
+		ThreeThirty:  scale(profile.ThreeThirty),
+		EighthMile:   scale(profile.EighthMile),
+		ThousandFoot: scale(profile.ThousandFoot),
+		QuarterMile:  scale(profile.QuarterMile),
+		TrapSpeed:    profile.TrapSpeed / factor,
+		EighthSpeed:  profile.EighthSpeed / factor,
+	}
+}
+
+// Reference profiles are the fixed passes simulated races have always
+// run: lane 1 slightly quicker than lane 2, with no variation
+var (
+	ReferenceLeft = Profile{
+		Name:         "reference-left",
+		ReactionTime: 400 * time.Millisecond,
+		SixtyFoot:    950 * time.Millisecond,
+		EighthMile:   4200 * time.Millisecond,
+		QuarterMile:  7300 * time.Millisecond,
+	}
+	ReferenceRight = Profile{
+		Name:         "reference-right",
+		ReactionTime: 450 * time.Millisecond,
+		SixtyFoot:    980 * time.Millisecond,
+		EighthMile:   4350 * time.Millisecond,
+		QuarterMile:  7500 * time.Millisecond,
+	}
+)
+
+// Reference returns a simulator running the reference profiles, lane 1 on
+// the left and every other lane on the right. Its passes are the same
+// every race.
+func Reference() Simulator {
+	sim, _ := NewProfileSimulator(map[int]Profile{1: ReferenceLeft}, ReferenceRight, 0)
+	return sim
+}
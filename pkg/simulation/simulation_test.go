@@ -0,0 +1,297 @@
+package simulation
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReference(t *testing.T) {
+	sim := Reference()
+
+	for i := 0; i < 3; i++ {
+		left := sim.Pass(1)
+		if left.ReactionTime != 400*time.Millisecond || left.QuarterMile != 7300*time.Millisecond {
+			t.Errorf("Expected the reference left pass, got %+v", left)
+		}
+		right := sim.Pass(2)
+		if right.ReactionTime != 450*time.Millisecond || right.QuarterMile != 7500*time.Millisecond {
+			t.Errorf("Expected the reference right pass, got %+v", right)
+		}
+	}
+
+	if staging := sim.Staging(2); staging.PreStage != 700*time.Millisecond || staging.Stage != 1500*time.Millisecond {
+		t.Errorf("Expected lane 2 to pre-stage at 0.7s and stage at 1.5s, got %+v", staging)
+	}
+}
+
+func TestProfileSimulator(t *testing.T) {
+	profile := Profile{
+		Name:           "bracket",
+		ReactionTime:   500 * time.Millisecond,
+		ReactionSpread: 20 * time.Millisecond,
+		SixtyFoot:      1600 * time.Millisecond,
+		ThreeThirty:    4400 * time.Millisecond,
+		EighthMile:     6900 * time.Millisecond,
+		ThousandFoot:   9100 * time.Millisecond,
+		QuarterMile:    10900 * time.Millisecond,
+		TrapSpeed:      122,
+		Variability:    0.01,
+	}
+
+	first, err := NewProfileSimulator(nil, profile, 42)
+	if err != nil {
+		t.Fatalf("NewProfileSimulator failed: %v", err)
+	}
+	second, _ := NewProfileSimulator(nil, profile, 42)
+
+	varied := false
+	for i := 0; i < 20; i++ {
+		a, b := first.Pass(1), second.Pass(1)
+		if a != b {
+			t.Fatalf("Expected the same seed to replay the same passes, got %+v and %+v", a, b)
+		}
+		if a.QuarterMile != profile.QuarterMile {
+			varied = true
+		}
+		previous := time.Duration(0)
+		for _, split := range a.Splits(0) {
+			if split.At <= previous {
+				t.Fatalf("Expected splits to increase down the track, got %+v", a.Splits(0))
+			}
+			previous = split.At
+		}
+		// A quicker run traps faster
+		if a.QuarterMile < profile.QuarterMile && a.TrapSpeed <= profile.TrapSpeed {
+			t.Errorf("Expected trap speed to follow elapsed time, got %v at %.2f mph", a.QuarterMile, a.TrapSpeed)
+		}
+	}
+	if !varied {
+		t.Error("Expected passes to vary with variability set")
+	}
+
+	steady := profile
+	steady.ReactionSpread, steady.Variability = 0, 0
+	exact, _ := NewProfileSimulator(map[int]Profile{2: steady}, profile, 1)
+	if pass := exact.Pass(2); pass.ReactionTime != steady.ReactionTime || pass.QuarterMile != steady.QuarterMile || pass.TrapSpeed != steady.TrapSpeed {
+		t.Errorf("Expected a profile without variation to run exactly, got %+v", pass)
+	}
+}
+
+func TestProfileValidate(t *testing.T) {
+	cases := map[string]Profile{
+		"no elapsed time":     {Name: "a", SixtyFoot: time.Second},
+		"splits out of order": {Name: "b", SixtyFoot: 5 * time.Second, EighthMile: 4 * time.Second, QuarterMile: 7 * time.Second},
+		"negative spread":     {Name: "c", QuarterMile: 7 * time.Second, Variability: -0.1},
+	}
+	for name, profile := range cases {
+		if err := profile.Validate(); err == nil {
+			t.Errorf("Expected %s to be rejected", name)
+		}
+		if _, err := NewProfileSimulator(nil, profile, 0); err == nil {
+			t.Errorf("Expected NewProfileSimulator to reject %s", name)
+		}
+	}
+	if err := ReferenceLeft.Validate(); err != nil {
+		t.Errorf("Expected the reference profile to be valid, got %v", err)
+	}
+}
+
+func TestSplits(t *testing.T) {
+	pass := Pass{
+		SixtyFoot:   time.Second,
+		EighthMile:  4 * time.Second,
+		QuarterMile: 7 * time.Second,
+		TrapSpeed:   200,
+	}
+
+	splits := pass.Splits(0)
+	if len(splits) != 3 || splits[2].BeamID != BeamQuarterMile {
+		t.Fatalf("Expected 60 foot, eighth mile and quarter mile splits, got %+v", splits)
+	}
+
+	splits = pass.Splits(66)
+	if len(splits) != 4 || splits[2].BeamID != BeamSpeedTrap {
+		t.Fatalf("Expected a speed trap split before the finish, got %+v", splits)
+	}
+	// 66 feet at 200 mph (293.3 ft/s) takes 225ms
+	if got := pass.QuarterMile - splits[2].At; got < 224*time.Millisecond || got > 226*time.Millisecond {
+		t.Errorf("Expected the speed trap 225ms before the finish, got %v", got)
+	}
+
+	pass.EighthSpeed = 150
+	splits = pass.Splits(66)
+	if len(splits) != 5 || splits[1].BeamID != BeamEighthTrap {
+		t.Fatalf("Expected an eighth-mile trap split before the eighth mile, got %+v", splits)
+	}
+	// 66 feet at 150 mph (220 ft/s) takes 300ms
+	if got := pass.EighthMile - splits[1].At; got < 299*time.Millisecond || got > 301*time.Millisecond {
+		t.Errorf("Expected the eighth-mile trap 300ms before the eighth mile, got %v", got)
+	}
+}
+
+// streetCar is a mid-13s street car on drag radials
+var streetCar = Vehicle{
+	Name:   "street",
+	Weight: 3600,
+	TorqueCurve: []TorquePoint{
+		{RPM: 1000, Torque: 300},
+		{RPM: 2500, Torque: 380},
+		{RPM: 4000, Torque: 420},
+		{RPM: 5500, Torque: 390},
+		{RPM: 6500, Torque: 330},
+	},
+	LaunchRPM:       2500,
+	ShiftRPM:        6200,
+	ShiftTime:       150 * time.Millisecond,
+	Gears:           []float64{2.66, 1.78, 1.30, 1.0},
+	FinalDrive:      3.73,
+	TireDiameter:    27,
+	Traction:        0.9,
+	DrivenWeight:    0.55,
+	DragCoefficient: 0.35,
+	FrontalArea:     22,
+	ReactionTime:    200 * time.Millisecond,
+}
+
+func TestVehicleRun(t *testing.T) {
+	trace := streetCar.Run(1400)
+	for i := 1; i < len(trace); i++ {
+		if trace[i].Position < trace[i-1].Position || trace[i].Gear < trace[i-1].Gear {
+			t.Fatalf("Expected the car to move forward through the gears, got %+v then %+v", trace[i-1], trace[i])
+		}
+	}
+	if last := trace[len(trace)-1]; last.Position < 1400 || last.Gear != 4 {
+		t.Errorf("Expected the run to end past 1400 ft in top gear, got %+v", last)
+	}
+
+	pass := trace.Pass(DefaultRollout)
+	if pass.QuarterMile < 12500*time.Millisecond || pass.QuarterMile > 14500*time.Millisecond {
+		t.Errorf("Expected a mid-13s ET, got %v", pass.QuarterMile)
+	}
+	if pass.TrapSpeed < 100 || pass.TrapSpeed > 120 {
+		t.Errorf("Expected a trap speed around 110 mph, got %.1f", pass.TrapSpeed)
+	}
+	splits := pass.Splits(0)
+	if len(splits) != 5 || splits[1].BeamID != BeamThreeThirty || splits[3].BeamID != BeamThousandFoot {
+		t.Fatalf("Expected a split at every beam, got %+v", splits)
+	}
+	for i := 1; i < len(splits); i++ {
+		if splits[i].At <= splits[i-1].At {
+			t.Errorf("Expected splits to increase down the track, got %+v", splits)
+		}
+	}
+
+	if short := streetCar.Run(500).Pass(DefaultRollout); short.SixtyFoot == 0 || short.EighthMile != 0 || short.QuarterMile != 0 {
+		t.Errorf("Expected a run that stops short to miss the later beams, got %+v", short)
+	}
+
+	// Less grip spins the tires away at the launch
+	loose := streetCar
+	loose.Traction = 0.5
+	if slow := loose.Run(1400).Pass(DefaultRollout); slow.SixtyFoot <= pass.SixtyFoot {
+		t.Errorf("Expected less traction to slow the 60 foot, got %v against %v", slow.SixtyFoot, pass.SixtyFoot)
+	}
+}
+
+func TestVehicleProfile(t *testing.T) {
+	profile, err := streetCar.Profile()
+	if err != nil {
+		t.Fatalf("Profile failed: %v", err)
+	}
+	if err := profile.Validate(); err != nil {
+		t.Errorf("Expected a valid profile, got %v", err)
+	}
+	// The timed reaction adds the rollout to the driver's
+	if profile.ReactionTime <= streetCar.ReactionTime {
+		t.Errorf("Expected the rollout added to the reaction time, got %v", profile.ReactionTime)
+	}
+
+	stalled := streetCar
+	stalled.TorqueCurve = []TorquePoint{{RPM: 1000, Torque: 1}}
+	if _, err := stalled.Profile(); err == nil {
+		t.Error("Expected a car that cannot finish to have no profile")
+	}
+}
+
+func TestPhysicsSimulator(t *testing.T) {
+	varied := streetCar
+	varied.ReactionSpread = 15 * time.Millisecond
+	varied.Variability = 0.02
+
+	first, err := NewPhysicsSimulator(map[int]Vehicle{1: varied}, streetCar, 9)
+	if err != nil {
+		t.Fatalf("NewPhysicsSimulator failed: %v", err)
+	}
+	second, _ := NewPhysicsSimulator(map[int]Vehicle{1: varied}, streetCar, 9)
+
+	steady := first.Pass(2)
+	ets := make(map[time.Duration]bool)
+	for i := 0; i < 5; i++ {
+		a, b := first.Pass(1), second.Pass(1)
+		if a != b {
+			t.Fatalf("Expected the same seed to replay the same passes, got %+v and %+v", a, b)
+		}
+		ets[a.QuarterMile] = true
+	}
+	if len(ets) < 2 {
+		t.Error("Expected passes to vary with variability set")
+	}
+	if again := first.Pass(2); again != steady {
+		t.Errorf("Expected a vehicle without variation to repeat its pass, got %+v and %+v", steady, again)
+	}
+
+	broken := streetCar
+	broken.Gears = nil
+	if _, err := NewPhysicsSimulator(nil, broken, 0); err == nil {
+		t.Error("Expected a vehicle without gears to be rejected")
+	}
+}
+
+func TestPresets(t *testing.T) {
+	for name, quarter := range map[string]time.Duration{
+		"top-fuel":  3700 * time.Millisecond,
+		"pro-stock": 6500 * time.Millisecond,
+		"street":    13900 * time.Millisecond,
+	} {
+		profile, ok := Preset(name)
+		if !ok || profile.QuarterMile != quarter {
+			t.Errorf("Expected the %s preset to run %v, got %+v", name, quarter, profile)
+		}
+	}
+	if topFuel, _ := Preset("top-fuel"); topFuel.TrapSpeed != 330 {
+		t.Errorf("Expected Top Fuel at 330 mph, got %.1f", topFuel.TrapSpeed)
+	}
+
+	matchup, err := NewMatchup(7, "pro-stock", "street")
+	if err != nil {
+		t.Fatalf("NewMatchup failed: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		proStock, street := matchup.Pass(1), matchup.Pass(2)
+		if proStock.QuarterMile > 7*time.Second || street.QuarterMile < 13*time.Second {
+			t.Fatalf("Expected Pro Stock in lane 1 and the street car in lane 2, got %v and %v", proStock.QuarterMile, street.QuarterMile)
+		}
+		if lane3 := matchup.Pass(3); lane3.QuarterMile < 13*time.Second {
+			t.Fatalf("Expected lanes past the matchup to run the last preset, got %v", lane3.QuarterMile)
+		}
+	}
+	if _, err := NewMatchup(1, "top-fuel", "jet-car"); err == nil {
+		t.Error("Expected an unknown preset to be rejected")
+	}
+
+	// Tracks add their own presets, in the same format
+	err = LoadPresets(strings.NewReader(`[{"name": "test-bracket", "reaction_time": 0.5, "sixty_foot": 1.6, "quarter_mile": 10.9, "trap_speed": 122}]`))
+	if err != nil {
+		t.Fatalf("LoadPresets failed: %v", err)
+	}
+	if bracket, ok := Preset("test-bracket"); !ok || bracket.QuarterMile != 10900*time.Millisecond {
+		t.Errorf("Expected the loaded preset, got %+v", bracket)
+	}
+	if err := LoadPresets(strings.NewReader(`[{"name": "backwards", "sixty_foot": 2.0, "eighth_mile": 1.0, "quarter_mile": 3.0}]`)); err == nil {
+		t.Error("Expected a preset with splits out of order to be rejected")
+	}
+	if _, ok := Preset("backwards"); ok {
+		t.Error("Expected an invalid preset not to be added")
+	}
+}
@@ -0,0 +1,273 @@
+// Package slips spools ET slips to the tower's slip printer. Slips print in
+// the order they are queued; a printer error is retried with a growing
+// delay, and a slip that still fails publishes slips.failed so tower staff
+// notice before the racer leaves the track. Slips are kept by run number
+// for reprints.
+package slips
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/benharold/libdrag/pkg/events"
+	"github.com/benharold/libdrag/pkg/logs"
+	"github.com/benharold/libdrag/pkg/notify"
+	"github.com/benharold/libdrag/pkg/timers"
+)
+
+// Defaults for Config fields left zero
+const (
+	DefaultRetries    = 3
+	DefaultRetryDelay = 2 * time.Second
+	DefaultHistory    = 500
+)
+
+// Slip statuses
+const (
+	StatusQueued  = "queued"
+	StatusPrinted = "printed"
+	StatusFailed  = "failed" // Gave up after the retries
+)
+
+// Slip is an ET slip for one lane of a run
+type Slip struct {
+	notify.RunSummary
+	RunNumber int    `json:"run_number"` // Printed on the slip; used to reprint it
+	CarNumber string `json:"car_number,omitempty"`
+	Reprint   bool   `json:"reprint,omitempty"`
+}
+
+// Printer prints a slip. An error leaves the slip queued for a retry.
+type Printer interface {
+	Print(slip Slip) error
+}
+
+// PrinterFunc adapts a function to the Printer interface
+type PrinterFunc func(slip Slip) error
+
+// Print calls f(slip)
+func (f PrinterFunc) Print(slip Slip) error {
+	return f(slip)
+}
+
+// Config configures the spooler
+type Config struct {
+	Retries    int           `json:"retries"`     // Retries after a failed print (0 = DefaultRetries)
+	RetryDelay time.Duration `json:"retry_delay"` // Before the first retry, doubling for each one after (0 = DefaultRetryDelay)
+	History    int           `json:"history"`     // Slips kept for reprints (0 = DefaultHistory)
+}
+
+// Job is a slip's place in the spooler
+type Job struct {
+	Slip      Slip      `json:"slip"`
+	Status    string    `json:"status"`
+	Attempts  int       `json:"attempts"`
+	LastError string    `json:"last_error,omitempty"`
+	QueuedAt  time.Time `json:"queued_at"`
+	PrintedAt time.Time `json:"printed_at,omitempty"`
+}
+
+// Spooler queues slips for a printer, printing one at a time
+type Spooler struct {
+	mu       sync.Mutex
+	bus      *events.EventBus
+	printer  Printer
+	cfg      Config
+	clock    timers.Clock // Nil runs on the default wheel
+	logger   *slog.Logger // Nil logs to logs.Default
+	queue    []*Job
+	jobs     map[int]*Job // Run number -> latest job for it
+	numbers  []int        // Run numbers in the order spooled, for trimming history
+	next     int
+	printing bool // A worker is draining the queue or waiting to retry
+	retry    *timers.Timer
+	stopped  bool
+}
+
+// NewSpooler creates a spooler for a printer
+func NewSpooler(bus *events.EventBus, printer Printer, cfg Config) (*Spooler, error) {
+	if printer == nil {
+		return nil, fmt.Errorf("printer is required")
+	}
+	if cfg.Retries <= 0 {
+		cfg.Retries = DefaultRetries
+	}
+	if cfg.RetryDelay <= 0 {
+		cfg.RetryDelay = DefaultRetryDelay
+	}
+	if cfg.History <= 0 {
+		cfg.History = DefaultHistory
+	}
+	return &Spooler{
+		bus:     bus,
+		printer: printer,
+		cfg:     cfg,
+		jobs:    make(map[int]*Job),
+	}, nil
+}
+
+// SetClock runs retries on clock instead of the default wheel
+func (s *Spooler) SetClock(clock timers.Clock) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clock = clock
+}
+
+// SetLogger logs print failures to logger instead of logs.Default
+func (s *Spooler) SetLogger(logger *slog.Logger) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.logger = logger
+}
+
+// Enqueue queues a slip for each summary, assigning their run numbers.
+// carNumbers maps lanes to car numbers and may be nil.
+func (s *Spooler) Enqueue(summaries []notify.RunSummary, carNumbers map[int]string) []Slip {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	slips := make([]Slip, 0, len(summaries))
+	for _, summary := range summaries {
+		s.next++
+		slip := Slip{RunSummary: summary, RunNumber: s.next, CarNumber: carNumbers[summary.Lane]}
+		s.push(slip)
+		s.numbers = append(s.numbers, slip.RunNumber)
+		slips = append(slips, slip)
+	}
+	s.trimHistory()
+	return slips
+}
+
+// Reprint queues another copy of a run's slip
+func (s *Spooler) Reprint(runNumber int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.jobs[runNumber]
+	if !ok {
+		return fmt.Errorf("no slip for run %d", runNumber)
+	}
+	if job.Status == StatusQueued {
+		return fmt.Errorf("run %d is still queued", runNumber)
+	}
+	slip := job.Slip
+	slip.Reprint = true
+	s.push(slip)
+	return nil
+}
+
+// Jobs returns the kept slips by run number
+func (s *Spooler) Jobs() []Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	jobs := make([]Job, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		jobs = append(jobs, *job)
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].Slip.RunNumber < jobs[j].Slip.RunNumber })
+	return jobs
+}
+
+// Stop stops printing. Queued slips are dropped.
+func (s *Spooler) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.stopped = true
+	s.queue = nil
+	if s.retry != nil {
+		s.retry.Stop()
+	}
+}
+
+// push queues a slip and starts a worker if none is running. Must be
+// called with s.mu held.
+func (s *Spooler) push(slip Slip) {
+	if s.stopped {
+		return
+	}
+	job := &Job{Slip: slip, Status: StatusQueued, QueuedAt: timers.Or(s.clock).Now()}
+	s.jobs[slip.RunNumber] = job
+	s.queue = append(s.queue, job)
+	if !s.printing {
+		s.printing = true
+		go s.drain()
+	}
+}
+
+// trimHistory forgets the oldest finished slips beyond the history limit.
+// Must be called with s.mu held.
+func (s *Spooler) trimHistory() {
+	for len(s.numbers) > s.cfg.History {
+		if job := s.jobs[s.numbers[0]]; job != nil && job.Status == StatusQueued {
+			return
+		}
+		delete(s.jobs, s.numbers[0])
+		s.numbers = s.numbers[1:]
+	}
+}
+
+// drain prints queued slips in order until the queue is empty, or a print
+// fails and a retry is scheduled
+func (s *Spooler) drain() {
+	for {
+		s.mu.Lock()
+		if s.stopped || len(s.queue) == 0 {
+			s.printing = false
+			s.mu.Unlock()
+			return
+		}
+		job := s.queue[0]
+		slip := job.Slip
+		s.mu.Unlock()
+
+		err := s.printer.Print(slip)
+
+		s.mu.Lock()
+		job.Attempts++
+		if err == nil {
+			job.Status = StatusPrinted
+			job.LastError = ""
+			job.PrintedAt = timers.Or(s.clock).Now()
+			s.queue = s.queue[1:]
+			s.mu.Unlock()
+			s.publish(events.EventSlipPrinted, *job)
+			continue
+		}
+
+		job.LastError = err.Error()
+		if job.Attempts <= s.cfg.Retries {
+			delay := s.cfg.RetryDelay << (job.Attempts - 1)
+			s.retry = timers.Or(s.clock).AfterFunc(delay, timers.Label{Name: "slips.retry", RaceID: slip.RaceID}, s.drain)
+			s.mu.Unlock()
+			logs.For(s.logger, "slips", slip.RaceID).Warn("⚠️ Slip failed to print, retrying", "run", slip.RunNumber, "error", err, "retry_in", delay)
+			return
+		}
+		job.Status = StatusFailed
+		s.queue = s.queue[1:]
+		s.mu.Unlock()
+		logs.For(s.logger, "slips", slip.RaceID).Error("🚨 Slip failed to print", "run", slip.RunNumber, "attempts", job.Attempts, "error", err)
+		s.publish(events.EventSlipFailed, *job)
+	}
+}
+
+func (s *Spooler) publish(eventType events.EventType, job Job) {
+	if s.bus == nil {
+		return
+	}
+	builder := events.NewEvent(eventType).
+		WithRaceID(job.Slip.RaceID).
+		WithLane(job.Slip.Lane).
+		WithData("run_number", job.Slip.RunNumber).
+		WithData("registration", job.Slip.Registration).
+		WithData("attempts", job.Attempts).
+		WithData("reprint", job.Slip.Reprint)
+	if job.Status == StatusFailed {
+		builder.WithData("error", job.LastError)
+	}
+	s.bus.Publish(builder.Build())
+}
@@ -0,0 +1,168 @@
+package slips
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/benharold/libdrag/pkg/events"
+	"github.com/benharold/libdrag/pkg/notify"
+	"github.com/benharold/libdrag/pkg/timers"
+)
+
+// testPrinter fails its first failures prints, or every print when failures
+// is negative
+type testPrinter struct {
+	mu       sync.Mutex
+	failures int
+	printed  []Slip
+}
+
+func (p *testPrinter) Print(slip Slip) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.failures != 0 {
+		p.failures--
+		return errors.New("out of paper")
+	}
+	p.printed = append(p.printed, slip)
+	return nil
+}
+
+func (p *testPrinter) setFailures(n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.failures = n
+}
+
+func (p *testPrinter) slips() []Slip {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]Slip(nil), p.printed...)
+}
+
+func newTestSpooler(t *testing.T, printer Printer, cfg Config) (*Spooler, *timers.Wheel, *events.EventBus) {
+	t.Helper()
+	bus := events.NewEventBus(false)
+	spooler, err := NewSpooler(bus, printer, cfg)
+	if err != nil {
+		t.Fatalf("NewSpooler failed: %v", err)
+	}
+	wheel := timers.NewVirtualWheel(time.Now(), timers.DefaultTick)
+	spooler.SetClock(wheel)
+	t.Cleanup(spooler.Stop)
+	return spooler, wheel, bus
+}
+
+// waitForJob waits for a run's job to reach the given attempts and status
+func waitForJob(t *testing.T, spooler *Spooler, runNumber, attempts int, status string) Job {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		for _, job := range spooler.Jobs() {
+			if job.Slip.RunNumber == runNumber && job.Attempts == attempts && job.Status == status {
+				return job
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Run %d never reached %d attempts %s, jobs %+v", runNumber, attempts, status, spooler.Jobs())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSpoolerPrintsInOrder(t *testing.T) {
+	printer := &testPrinter{}
+	spooler, _, bus := newTestSpooler(t, printer, Config{})
+
+	var mu sync.Mutex
+	var printed []int
+	bus.Subscribe(events.EventSlipPrinted, func(e events.Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		printed = append(printed, e.Data["run_number"].(int))
+	})
+
+	queued := spooler.Enqueue([]notify.RunSummary{
+		{RaceID: "race-1", Lane: 1, Registration: "DRV-1"},
+		{RaceID: "race-1", Lane: 2},
+	}, map[int]string{1: "1234"})
+	if len(queued) != 2 || queued[0].RunNumber != 1 || queued[1].RunNumber != 2 {
+		t.Fatalf("Expected run numbers 1 and 2, got %+v", queued)
+	}
+	waitForJob(t, spooler, 2, 1, StatusPrinted)
+
+	slips := printer.slips()
+	if len(slips) != 2 || slips[0].Lane != 1 || slips[1].Lane != 2 {
+		t.Fatalf("Expected both lanes printed in order, got %+v", slips)
+	}
+	if slips[0].CarNumber != "1234" || slips[1].CarNumber != "" {
+		t.Errorf("Expected lane 1's car number on its slip, got %+v", slips)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(printed) != 2 || printed[0] != 1 || printed[1] != 2 {
+		t.Errorf("Expected slips.printed for runs 1 and 2, got %v", printed)
+	}
+}
+
+func TestSpoolerRetries(t *testing.T) {
+	printer := &testPrinter{failures: 2}
+	spooler, wheel, _ := newTestSpooler(t, printer, Config{Retries: 2, RetryDelay: time.Second})
+
+	spooler.Enqueue([]notify.RunSummary{{RaceID: "race-1", Lane: 1}}, nil)
+	job := waitForJob(t, spooler, 1, 1, StatusQueued)
+	if job.LastError != "out of paper" {
+		t.Errorf("Expected the printer error recorded, got %q", job.LastError)
+	}
+
+	// The second retry waits twice as long as the first
+	wheel.Advance(time.Second + timers.DefaultTick)
+	waitForJob(t, spooler, 1, 2, StatusQueued)
+	wheel.Advance(time.Second)
+	waitForJob(t, spooler, 1, 2, StatusQueued)
+	wheel.Advance(time.Second + timers.DefaultTick)
+	job = waitForJob(t, spooler, 1, 3, StatusPrinted)
+	if job.LastError != "" || len(printer.slips()) != 1 {
+		t.Errorf("Expected the slip printed on the last retry, got %+v", job)
+	}
+}
+
+func TestSpoolerFailureAndReprint(t *testing.T) {
+	printer := &testPrinter{failures: -1}
+	spooler, wheel, bus := newTestSpooler(t, printer, Config{Retries: 1, RetryDelay: time.Second})
+
+	failed := make(chan events.Event, 1)
+	bus.Subscribe(events.EventSlipFailed, func(e events.Event) { failed <- e })
+
+	spooler.Enqueue([]notify.RunSummary{{RaceID: "race-1", Lane: 2, Registration: "DRV-2"}}, nil)
+	waitForJob(t, spooler, 1, 1, StatusQueued)
+	if err := spooler.Reprint(1); err == nil {
+		t.Error("Expected a reprint of a queued slip to be rejected")
+	}
+	wheel.Advance(time.Second + timers.DefaultTick)
+	waitForJob(t, spooler, 1, 2, StatusFailed)
+
+	select {
+	case e := <-failed:
+		if e.RaceID != "race-1" || e.Lane != 2 || e.Data["registration"] != "DRV-2" || e.Data["error"] != "out of paper" {
+			t.Errorf("Unexpected slips.failed event %+v", e)
+		}
+	default:
+		t.Fatal("Expected slips.failed once the retries ran out")
+	}
+
+	// Tower staff fix the printer and reprint the run
+	printer.setFailures(0)
+	if err := spooler.Reprint(1); err != nil {
+		t.Fatalf("Reprint failed: %v", err)
+	}
+	waitForJob(t, spooler, 1, 1, StatusPrinted)
+	if slips := printer.slips(); len(slips) != 1 || !slips[0].Reprint || slips[0].RunNumber != 1 {
+		t.Errorf("Expected run 1 reprinted, got %+v", slips)
+	}
+	if err := spooler.Reprint(99); err == nil {
+		t.Error("Expected a reprint of an unknown run to be rejected")
+	}
+}
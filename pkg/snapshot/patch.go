@@ -0,0 +1,170 @@
+package snapshot
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// JSON Patch (RFC 6902) operations produced by Diff
+const (
+	OpAdd     = "add"
+	OpRemove  = "remove"
+	OpReplace = "replace"
+)
+
+// Operation is a single JSON Patch operation
+type Operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// Diff returns the JSON Patch that turns document from into document to.
+// Both must be JSON documents. Objects are diffed member by member; arrays
+// and scalars that differ are replaced whole, which keeps patches simple for
+// the small arrays found in race state.
+func Diff(from, to []byte) ([]Operation, error) {
+	var a, b interface{}
+	if err := json.Unmarshal(from, &a); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(to, &b); err != nil {
+		return nil, err
+	}
+	var ops []Operation
+	if err := diffValues("", a, b, &ops); err != nil {
+		return nil, err
+	}
+	return ops, nil
+}
+
+func diffValues(path string, a, b interface{}, ops *[]Operation) error {
+	objA, okA := a.(map[string]interface{})
+	objB, okB := b.(map[string]interface{})
+	if !okA || !okB {
+		if reflect.DeepEqual(a, b) {
+			return nil
+		}
+		return appendOp(ops, OpReplace, path, b)
+	}
+
+	keys := make([]string, 0, len(objA)+len(objB))
+	for k := range objA {
+		keys = append(keys, k)
+	}
+	for k := range objB {
+		if _, ok := objA[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		child := path + "/" + escapePointer(k)
+		va, inA := objA[k]
+		vb, inB := objB[k]
+		var err error
+		switch {
+		case !inB:
+			*ops = append(*ops, Operation{Op: OpRemove, Path: child})
+		case !inA:
+			err = appendOp(ops, OpAdd, child, vb)
+		default:
+			err = diffValues(child, va, vb, ops)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func appendOp(ops *[]Operation, op, path string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	*ops = append(*ops, Operation{Op: op, Path: path, Value: data})
+	return nil
+}
+
+// Apply applies a patch produced by Diff to a JSON document and returns the
+// patched document. Clients use it to keep their copy of the state current.
+func Apply(doc []byte, patch []Operation) ([]byte, error) {
+	var root interface{}
+	if err := json.Unmarshal(doc, &root); err != nil {
+		return nil, err
+	}
+
+	for _, op := range patch {
+		var value interface{}
+		if op.Op != OpRemove {
+			if err := json.Unmarshal(op.Value, &value); err != nil {
+				return nil, fmt.Errorf("%s %s: %v", op.Op, op.Path, err)
+			}
+		}
+		if op.Path == "" {
+			if op.Op == OpRemove {
+				return nil, fmt.Errorf("cannot remove the document root")
+			}
+			root = value
+			continue
+		}
+
+		tokens := strings.Split(op.Path, "/")[1:]
+		parent := root
+		for _, token := range tokens[:len(tokens)-1] {
+			next, err := child(parent, unescapePointer(token))
+			if err != nil {
+				return nil, fmt.Errorf("%s %s: %v", op.Op, op.Path, err)
+			}
+			parent = next
+		}
+
+		obj, ok := parent.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s %s: parent is not an object", op.Op, op.Path)
+		}
+		key := unescapePointer(tokens[len(tokens)-1])
+		switch op.Op {
+		case OpAdd, OpReplace:
+			obj[key] = value
+		case OpRemove:
+			delete(obj, key)
+		default:
+			return nil, fmt.Errorf("unsupported operation %q", op.Op)
+		}
+	}
+	return json.Marshal(root)
+}
+
+// child looks up an object member or array element
+func child(v interface{}, token string) (interface{}, error) {
+	switch node := v.(type) {
+	case map[string]interface{}:
+		c, ok := node[token]
+		if !ok {
+			return nil, fmt.Errorf("member %q not found", token)
+		}
+		return c, nil
+	case []interface{}:
+		i, err := strconv.Atoi(token)
+		if err != nil || i < 0 || i >= len(node) {
+			return nil, fmt.Errorf("index %q out of range", token)
+		}
+		return node[i], nil
+	}
+	return nil, fmt.Errorf("cannot descend into %q", token)
+}
+
+var (
+	pointerEscaper   = strings.NewReplacer("~", "~0", "/", "~1")
+	pointerUnescaper = strings.NewReplacer("~1", "/", "~0", "~")
+)
+
+func escapePointer(s string) string   { return pointerEscaper.Replace(s) }
+func unescapePointer(s string) string { return pointerUnescaper.Replace(s) }
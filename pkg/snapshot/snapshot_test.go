@@ -0,0 +1,81 @@
+package snapshot
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDiffAndApply(t *testing.T) {
+	from := []byte(`{"armed":false,"light_states":{"1":{"stage":"off"},"2":{"stage":"off"}},"step":0,"a/b":1}`)
+	to := []byte(`{"armed":true,"light_states":{"1":{"stage":"on"},"2":{"stage":"off"}},"lanes":[1,2],"a/b":1}`)
+
+	patch, err := Diff(from, to)
+	if err != nil {
+		t.Fatalf("Diff failed: %v", err)
+	}
+	want := []Operation{
+		{Op: OpReplace, Path: "/armed", Value: json.RawMessage(`true`)},
+		{Op: OpAdd, Path: "/lanes", Value: json.RawMessage(`[1,2]`)},
+		{Op: OpReplace, Path: "/light_states/1/stage", Value: json.RawMessage(`"on"`)},
+		{Op: OpRemove, Path: "/step"},
+	}
+	if !reflect.DeepEqual(patch, want) {
+		t.Fatalf("Unexpected patch %+v", patch)
+	}
+
+	patched, err := Apply(from, patch)
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	var got, expected interface{}
+	json.Unmarshal(patched, &got)
+	json.Unmarshal(to, &expected)
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Patched document %s does not match %s", patched, to)
+	}
+}
+
+func TestStreamFrames(t *testing.T) {
+	state := `{"armed":false}`
+	stream := NewStream(func() ([]byte, error) { return []byte(state), nil }, time.Hour, time.Hour)
+
+	first, err := stream.Snapshot()
+	if err != nil || first.Seq != 1 || first.Type != FrameSnapshot {
+		t.Fatalf("Unexpected snapshot %+v (%v)", first, err)
+	}
+
+	if _, changed, _ := stream.Diff(); changed {
+		t.Error("Expected no diff for unchanged state")
+	}
+
+	state = `{"armed":true}`
+	diff, changed, err := stream.Diff()
+	if err != nil || !changed || diff.Seq != 2 || diff.Type != FrameDiff || len(diff.Patch) != 1 {
+		t.Fatalf("Unexpected diff %+v (%v)", diff, err)
+	}
+}
+
+func TestStreamRun(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	resync := make(chan struct{}, 1)
+	resync <- struct{}{}
+
+	var frames []Frame
+	NewStream(func() ([]byte, error) { return []byte(`{}`), nil }, time.Hour, time.Hour).
+		Run(ctx, resync, func(frame Frame) error {
+			frames = append(frames, frame)
+			if len(frames) == 2 {
+				cancel()
+			}
+			return nil
+		})
+
+	if len(frames) != 2 || frames[1].Type != FrameSnapshot || frames[1].Seq != 2 {
+		t.Errorf("Expected initial and resync snapshots, got %+v", frames)
+	}
+}
@@ -0,0 +1,147 @@
+// Package snapshot streams state to bandwidth-constrained clients as full
+// snapshots at a low rate and JSON Patch diffs at a high rate.
+//
+// Every frame carries a sequence number. A diff applies to the state as of
+// the previous sequence number, so a client that sees a gap discards its copy
+// and waits for the next snapshot (or asks for one) to resync.
+package snapshot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// Frame types
+const (
+	FrameSnapshot = "snapshot"
+	FrameDiff     = "diff"
+)
+
+// Default rates
+const (
+	DefaultSnapshotInterval = 5 * time.Second
+	DefaultDiffInterval     = 100 * time.Millisecond
+)
+
+// Frame is one message of a snapshot stream
+type Frame struct {
+	Seq   uint64          `json:"seq"`
+	Type  string          `json:"type"`
+	State json.RawMessage `json:"state,omitempty"` // Full state (snapshot frames)
+	Patch []Operation     `json:"patch,omitempty"` // Changes since Seq-1 (diff frames)
+}
+
+// Source returns the current state as a JSON document
+type Source func() ([]byte, error)
+
+// Stream turns a polled Source into snapshot and diff frames
+type Stream struct {
+	source           Source
+	snapshotInterval time.Duration
+	diffInterval     time.Duration
+	seq              uint64
+	last             []byte
+}
+
+// NewStream creates a stream. Zero intervals use the defaults.
+func NewStream(source Source, snapshotInterval, diffInterval time.Duration) *Stream {
+	if snapshotInterval <= 0 {
+		snapshotInterval = DefaultSnapshotInterval
+	}
+	if diffInterval <= 0 {
+		diffInterval = DefaultDiffInterval
+	}
+	return &Stream{
+		source:           source,
+		snapshotInterval: snapshotInterval,
+		diffInterval:     diffInterval,
+	}
+}
+
+// Run emits a snapshot immediately, then diffs whenever the state changes
+// and snapshots on the snapshot interval, until ctx is done or emit fails.
+// Sending on resync forces an immediate snapshot; it may be nil.
+func (s *Stream) Run(ctx context.Context, resync <-chan struct{}, emit func(Frame) error) error {
+	snapshots := time.NewTicker(s.snapshotInterval)
+	defer snapshots.Stop()
+	diffs := time.NewTicker(s.diffInterval)
+	defer diffs.Stop()
+
+	if err := s.emitSnapshot(emit); err != nil {
+		return err
+	}
+
+	for {
+		var err error
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-resync:
+			err = s.emitSnapshot(emit)
+		case <-snapshots.C:
+			err = s.emitSnapshot(emit)
+		case <-diffs.C:
+			err = s.emitDiff(emit)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Snapshot returns a snapshot frame of the current state
+func (s *Stream) Snapshot() (Frame, error) {
+	state, err := s.source()
+	if err != nil {
+		return Frame{}, err
+	}
+	s.seq++
+	s.last = state
+	return Frame{Seq: s.seq, Type: FrameSnapshot, State: state}, nil
+}
+
+// Diff returns a diff frame against the last frame, or false if the state
+// has not changed
+func (s *Stream) Diff() (Frame, bool, error) {
+	if s.last == nil {
+		frame, err := s.Snapshot()
+		return frame, err == nil, err
+	}
+
+	state, err := s.source()
+	if err != nil {
+		return Frame{}, false, err
+	}
+	if bytes.Equal(state, s.last) {
+		return Frame{}, false, nil
+	}
+	patch, err := Diff(s.last, state)
+	if err != nil {
+		return Frame{}, false, err
+	}
+	s.last = state
+	if len(patch) == 0 {
+		// Only formatting or key order changed
+		return Frame{}, false, nil
+	}
+	s.seq++
+	return Frame{Seq: s.seq, Type: FrameDiff, Patch: patch}, true, nil
+}
+
+func (s *Stream) emitSnapshot(emit func(Frame) error) error {
+	frame, err := s.Snapshot()
+	if err != nil {
+		return err
+	}
+	return emit(frame)
+}
+
+func (s *Stream) emitDiff(emit func(Frame) error) error {
+	frame, changed, err := s.Diff()
+	if err != nil || !changed {
+		return err
+	}
+	return emit(frame)
+}
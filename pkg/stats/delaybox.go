@@ -0,0 +1,216 @@
+package stats
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/benharold/libdrag/pkg/events"
+	"github.com/benharold/libdrag/pkg/tags"
+	"github.com/benharold/libdrag/pkg/timers"
+)
+
+// DelayBoxConfig tunes the reaction-time clustering heuristic. Human
+// reaction times scatter by a few hundredths; an electronic delay box holds
+// them within a few thousandths run after run.
+type DelayBoxConfig struct {
+	MinRuns   int     `json:"min_runs"`   // Legal runs needed before an entry can be flagged
+	Window    int     `json:"window"`     // Most recent legal runs considered
+	MaxSpread float64 `json:"max_spread"` // Flag when the RT standard deviation is at or below this (seconds)
+
+	// Tags limits the runs analyzed to races whose tags pass the filter,
+	// say excluding tags.TestPass. The entry func applies it, as races'
+	// tags are known only to their owner.
+	Tags tags.Filter `json:"tags"`
+}
+
+// DefaultDelayBoxConfig returns conservative thresholds that rarely flag
+// consistent but legitimate drivers
+func DefaultDelayBoxConfig() DelayBoxConfig {
+	return DelayBoxConfig{
+		MinRuns:   6,
+		Window:    10,
+		MaxSpread: 0.004,
+	}
+}
+
+// TechFlag is an advisory flag recommending an entry for tech inspection.
+// It is not a foul and does not affect results.
+type TechFlag struct {
+	Entry     string    `json:"entry"` // Driver registration
+	Runs      int       `json:"runs"`  // Legal runs analyzed
+	MeanRT    float64   `json:"mean_rt"`
+	StdDevRT  float64   `json:"stddev_rt"`
+	Reason    string    `json:"reason"`
+	FlaggedAt time.Time `json:"flagged_at"`
+}
+
+// Tech flag reasons
+const (
+	FlagReasonRTClustering = "rt_clustering" // Reaction times suspiciously tightly clustered
+)
+
+// DelayBoxAnalyzer watches reaction times for entries in classes where delay
+// boxes are prohibited and publishes EventTechFlag the first time an entry's
+// reaction times cluster suspiciously tightly
+type DelayBoxAnalyzer struct {
+	mu          sync.Mutex
+	bus         *events.EventBus
+	config      DelayBoxConfig
+	entry       func(raceID string, lane int) string
+	rts         map[string][]float64 // Entry -> recent legal reaction times
+	flags       map[string]TechFlag
+	unsubscribe func()
+}
+
+// NewDelayBoxAnalyzer creates an analyzer. entry returns the registration of
+// the driver in a race's lane, or "" when the race is not subject to the
+// delay box rule (or the lane has no registered driver).
+func NewDelayBoxAnalyzer(bus *events.EventBus, config DelayBoxConfig, entry func(raceID string, lane int) string) *DelayBoxAnalyzer {
+	defaults := DefaultDelayBoxConfig()
+	if config.MinRuns <= 1 {
+		config.MinRuns = defaults.MinRuns
+	}
+	if config.Window < config.MinRuns {
+		config.Window = config.MinRuns
+	}
+	if config.MaxSpread <= 0 {
+		config.MaxSpread = defaults.MaxSpread
+	}
+	return &DelayBoxAnalyzer{
+		bus:    bus,
+		config: config,
+		entry:  entry,
+		rts:    make(map[string][]float64),
+		flags:  make(map[string]TechFlag),
+	}
+}
+
+// Start subscribes the analyzer to reaction time events
+func (da *DelayBoxAnalyzer) Start() {
+	da.unsubscribe = da.bus.Subscribe(events.EventTimingReaction, da.HandleEvent)
+}
+
+// Stop unsubscribes from the bus
+func (da *DelayBoxAnalyzer) Stop() {
+	if da.unsubscribe != nil {
+		da.unsubscribe()
+	}
+}
+
+// Flags returns the entries flagged so far, ordered by entry
+func (da *DelayBoxAnalyzer) Flags() []TechFlag {
+	da.mu.Lock()
+	defer da.mu.Unlock()
+
+	flags := make([]TechFlag, 0, len(da.flags))
+	for _, flag := range da.flags {
+		flags = append(flags, flag)
+	}
+	sort.Slice(flags, func(i, j int) bool { return flags[i].Entry < flags[j].Entry })
+	return flags
+}
+
+// HandleEvent records a reaction time
+func (da *DelayBoxAnalyzer) HandleEvent(event events.Event) {
+	da.mu.Lock()
+	flag, ok := da.record(event)
+	da.mu.Unlock()
+
+	// Publish outside the lock so synchronous buses can redeliver to us
+	if ok && da.bus != nil {
+		da.bus.Publish(
+			events.NewEvent(events.EventTechFlag).
+				WithRaceID(event.RaceID).
+				WithLane(event.Lane).
+				WithData("entry", flag.Entry).
+				WithData("reason", flag.Reason).
+				WithData("runs", flag.Runs).
+				WithData("mean_rt", flag.MeanRT).
+				WithData("stddev_rt", flag.StdDevRT).
+				Build(),
+		)
+	}
+}
+
+// Forget erases a driver for a privacy request, keeping their reaction
+// times and any flag under pseudonym, or dropping them when pseudonym is
+// empty. It reports whether the analyzer had seen the driver.
+func (da *DelayBoxAnalyzer) Forget(entry, pseudonym string) bool {
+	da.mu.Lock()
+	defer da.mu.Unlock()
+
+	rts, seen := da.rts[entry]
+	if !seen || entry == "" {
+		return false
+	}
+	flag, flagged := da.flags[entry]
+	delete(da.rts, entry)
+	delete(da.flags, entry)
+	if pseudonym != "" {
+		da.rts[pseudonym] = rts
+		if flagged {
+			flag.Entry = pseudonym
+			da.flags[pseudonym] = flag
+		}
+	}
+	return true
+}
+
+// record adds a legal reaction time and returns a flag when the entry is
+// newly flagged
+func (da *DelayBoxAnalyzer) record(event events.Event) (TechFlag, bool) {
+	if event.Type != events.EventTimingReaction || da.entry == nil {
+		return TechFlag{}, false
+	}
+	rt, ok := event.Data["reaction_time"].(float64)
+	if !ok || rt < 0 {
+		// Red lights say nothing about a delay box's consistency
+		return TechFlag{}, false
+	}
+	entry := da.entry(event.RaceID, event.Lane)
+	if entry == "" {
+		return TechFlag{}, false
+	}
+
+	rts := append(da.rts[entry], rt)
+	if len(rts) > da.config.Window {
+		rts = rts[len(rts)-da.config.Window:]
+	}
+	da.rts[entry] = rts
+
+	if _, flagged := da.flags[entry]; flagged || len(rts) < da.config.MinRuns {
+		return TechFlag{}, false
+	}
+	mean, stddev := meanStdDev(rts)
+	if stddev > da.config.MaxSpread {
+		return TechFlag{}, false
+	}
+
+	flag := TechFlag{
+		Entry:     entry,
+		Runs:      len(rts),
+		MeanRT:    mean,
+		StdDevRT:  stddev,
+		Reason:    FlagReasonRTClustering,
+		FlaggedAt: timers.Now(),
+	}
+	da.flags[entry] = flag
+	return flag, true
+}
+
+// meanStdDev returns the mean and population standard deviation of values
+func meanStdDev(values []float64) (float64, float64) {
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	mean := sum / float64(len(values))
+
+	var squares float64
+	for _, v := range values {
+		squares += (v - mean) * (v - mean)
+	}
+	return mean, math.Sqrt(squares / float64(len(values)))
+}
@@ -0,0 +1,276 @@
+package stats
+
+import (
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/benharold/libdrag/pkg/events"
+	"github.com/benharold/libdrag/pkg/tags"
+	"github.com/benharold/libdrag/pkg/timers"
+)
+
+// LeaderboardConfig sizes the reaction-time leaderboards
+type LeaderboardConfig struct {
+	Size    int `json:"size"`     // Drivers ranked on each board
+	MinRuns int `json:"min_runs"` // Legal runs needed to rank for consistency
+
+	// Tags limits the runs ranked to races whose tags pass the filter, say
+	// tags.Qualifying only. The entry func applies it, as races' tags are
+	// known only to their owner.
+	Tags tags.Filter `json:"tags"`
+}
+
+// DefaultLeaderboardConfig returns a top ten with three runs to rank for
+// consistency
+func DefaultLeaderboardConfig() LeaderboardConfig {
+	return LeaderboardConfig{
+		Size:    10,
+		MinRuns: 3,
+	}
+}
+
+// LeaderboardEntry is one driver's reaction times for the day
+type LeaderboardEntry struct {
+	Entry      string  `json:"entry"` // Driver registration
+	Runs       int     `json:"runs"`  // Legal runs
+	BestRT     float64 `json:"best_rt"`
+	BestRaceID string  `json:"best_race_id"`
+	MeanRT     float64 `json:"mean_rt"`
+	StdDevRT   float64 `json:"stddev_rt"`
+}
+
+// Leaderboards are the current rankings
+type Leaderboards struct {
+	SessionID   string             `json:"session_id,omitempty"`
+	Day         string             `json:"day"`         // Local date, "2006-01-02"
+	BestRT      []LeaderboardEntry `json:"best_rt"`     // Quickest legal reaction first
+	Consistency []LeaderboardEntry `json:"consistency"` // Smallest reaction time spread first
+}
+
+// rtRecord accumulates one driver's legal reaction times
+type rtRecord struct {
+	rts        []float64
+	best       float64
+	bestRaceID string
+}
+
+// Leaderboard ranks drivers by their best reaction time of the day and by
+// how consistent their reaction times are, from timing.reaction events. Red
+// lights do not count. The boards start over on the first run of a new day,
+// and session.leaderboard is published with them whenever they change.
+type Leaderboard struct {
+	mu          sync.Mutex
+	bus         *events.EventBus
+	sessionID   string
+	config      LeaderboardConfig
+	entry       func(raceID string, lane int) string
+	day         string
+	records     map[string]*rtRecord // Entry -> reaction times today
+	boards      Leaderboards
+	unsubscribe func()
+}
+
+// NewLeaderboard creates leaderboards labeled with sessionID (empty for all
+// sessions). entry returns the registration of the driver in a race's lane,
+// or "" when the run should not be ranked.
+func NewLeaderboard(bus *events.EventBus, sessionID string, config LeaderboardConfig, entry func(raceID string, lane int) string) *Leaderboard {
+	defaults := DefaultLeaderboardConfig()
+	if config.Size <= 0 {
+		config.Size = defaults.Size
+	}
+	if config.MinRuns <= 1 {
+		config.MinRuns = defaults.MinRuns
+	}
+	return &Leaderboard{
+		bus:       bus,
+		sessionID: sessionID,
+		config:    config,
+		entry:     entry,
+		records:   make(map[string]*rtRecord),
+		boards:    Leaderboards{SessionID: sessionID, BestRT: []LeaderboardEntry{}, Consistency: []LeaderboardEntry{}},
+	}
+}
+
+// Start subscribes the leaderboard to reaction time events
+func (lb *Leaderboard) Start() {
+	lb.unsubscribe = lb.bus.Subscribe(events.EventTimingReaction, lb.HandleEvent)
+}
+
+// Stop unsubscribes from the bus
+func (lb *Leaderboard) Stop() {
+	if lb.unsubscribe != nil {
+		lb.unsubscribe()
+	}
+}
+
+// Boards returns the current rankings
+func (lb *Leaderboard) Boards() Leaderboards {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+
+	boards := lb.boards
+	boards.BestRT = append([]LeaderboardEntry(nil), lb.boards.BestRT...)
+	boards.Consistency = append([]LeaderboardEntry(nil), lb.boards.Consistency...)
+	return boards
+}
+
+// HandleEvent records a reaction time
+func (lb *Leaderboard) HandleEvent(event events.Event) {
+	lb.mu.Lock()
+	changed := lb.record(event)
+	boards := lb.boards
+	lb.mu.Unlock()
+
+	// Publish outside the lock so synchronous buses can redeliver to us
+	if changed {
+		lb.publish(event.RaceID, boards)
+	}
+}
+
+// Forget erases a driver from today's boards for a privacy request,
+// keeping their reaction times under pseudonym, or dropping them when
+// pseudonym is empty. It reports whether the driver had any runs, and
+// publishes session.leaderboard when the boards change.
+func (lb *Leaderboard) Forget(entry, pseudonym string) bool {
+	lb.mu.Lock()
+	record, ok := lb.records[entry]
+	if !ok || entry == "" {
+		lb.mu.Unlock()
+		return false
+	}
+	delete(lb.records, entry)
+	if pseudonym != "" {
+		lb.records[pseudonym] = record
+	}
+	boards := lb.rank()
+	changed := !sameBoard(boards.BestRT, lb.boards.BestRT) || !sameBoard(boards.Consistency, lb.boards.Consistency)
+	lb.boards = boards
+	lb.mu.Unlock()
+
+	if changed {
+		lb.publish("", boards)
+	}
+	return true
+}
+
+// publish sends session.leaderboard with the boards
+func (lb *Leaderboard) publish(raceID string, boards Leaderboards) {
+	if lb.bus == nil {
+		return
+	}
+	lb.bus.Publish(
+		events.NewEvent(events.EventLeaderboardUpdate).
+			WithRaceID(raceID).
+			WithData("session_id", boards.SessionID).
+			WithData("day", boards.Day).
+			WithData("best_rt", boards.BestRT).
+			WithData("consistency", boards.Consistency).
+			Build(),
+	)
+}
+
+// record adds a legal reaction time and reports whether the rankings changed
+func (lb *Leaderboard) record(event events.Event) bool {
+	if event.Type != events.EventTimingReaction || lb.entry == nil {
+		return false
+	}
+	rt, ok := event.Data["reaction_time"].(float64)
+	if !ok || rt < 0 {
+		return false
+	}
+	entry := lb.entry(event.RaceID, event.Lane)
+	if entry == "" {
+		return false
+	}
+
+	at := event.Timestamp
+	if at.IsZero() {
+		at = timers.Now()
+	}
+	if day := at.Local().Format("2006-01-02"); day != lb.day {
+		lb.day = day
+		lb.records = make(map[string]*rtRecord)
+	}
+
+	record, ok := lb.records[entry]
+	if !ok {
+		record = &rtRecord{best: math.Inf(1)}
+		lb.records[entry] = record
+	}
+	record.rts = append(record.rts, rt)
+	if rt < record.best {
+		record.best = rt
+		record.bestRaceID = event.RaceID
+	}
+
+	boards := lb.rank()
+	changed := !sameBoard(boards.BestRT, lb.boards.BestRT) || !sameBoard(boards.Consistency, lb.boards.Consistency)
+	lb.boards = boards
+	return changed
+}
+
+// rank builds the boards from today's records
+func (lb *Leaderboard) rank() Leaderboards {
+	all := make([]LeaderboardEntry, 0, len(lb.records))
+	for entry, record := range lb.records {
+		mean, stddev := meanStdDev(record.rts)
+		all = append(all, LeaderboardEntry{
+			Entry:      entry,
+			Runs:       len(record.rts),
+			BestRT:     record.best,
+			BestRaceID: record.bestRaceID,
+			MeanRT:     mean,
+			StdDevRT:   stddev,
+		})
+	}
+
+	best := append([]LeaderboardEntry(nil), all...)
+	sort.Slice(best, func(i, j int) bool {
+		if best[i].BestRT != best[j].BestRT {
+			return best[i].BestRT < best[j].BestRT
+		}
+		return best[i].Entry < best[j].Entry
+	})
+
+	consistency := make([]LeaderboardEntry, 0, len(all))
+	for _, entry := range all {
+		if entry.Runs >= lb.config.MinRuns {
+			consistency = append(consistency, entry)
+		}
+	}
+	sort.Slice(consistency, func(i, j int) bool {
+		if consistency[i].StdDevRT != consistency[j].StdDevRT {
+			return consistency[i].StdDevRT < consistency[j].StdDevRT
+		}
+		return consistency[i].Entry < consistency[j].Entry
+	})
+
+	return Leaderboards{
+		SessionID:   lb.sessionID,
+		Day:         lb.day,
+		BestRT:      truncate(best, lb.config.Size),
+		Consistency: truncate(consistency, lb.config.Size),
+	}
+}
+
+func truncate(entries []LeaderboardEntry, size int) []LeaderboardEntry {
+	if len(entries) > size {
+		return entries[:size]
+	}
+	return entries
+}
+
+// sameBoard reports whether two boards rank the same drivers with the same
+// figures
+func sameBoard(a, b []LeaderboardEntry) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,248 @@
+package stats
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/benharold/libdrag/pkg/events"
+	"github.com/benharold/libdrag/pkg/tags"
+)
+
+// How the tree was fired
+const (
+	TriggerAuto   = "auto"   // Released automatically once staged
+	TriggerManual = "manual" // Fired by the starter from the console
+)
+
+// StarterConfig limits the runs audited
+type StarterConfig struct {
+	// Tags limits the runs audited to races whose tags pass the filter. The
+	// run func applies it, as races' tags are known only to their owner.
+	Tags tags.Filter `json:"tags"`
+}
+
+// StarterRun is one run's wait between the last car staging and the tree
+// firing
+type StarterRun struct {
+	RaceID    string        `json:"race_id"`
+	Starter   string        `json:"starter,omitempty"`
+	SessionID string        `json:"session_id,omitempty"`
+	Trigger   string        `json:"trigger"` // TriggerAuto or TriggerManual
+	StagedAt  time.Time     `json:"staged_at"`
+	FiredAt   time.Time     `json:"fired_at"`
+	Delay     time.Duration `json:"delay"` // FiredAt - StagedAt
+}
+
+// StarterDistribution summarizes the staged-to-fire delays of one starter
+// in one session
+type StarterDistribution struct {
+	Starter   string        `json:"starter,omitempty"`
+	SessionID string        `json:"session_id,omitempty"`
+	Runs      int           `json:"runs"`
+	Manual    int           `json:"manual"` // Runs fired from the console
+	Min       time.Duration `json:"min"`
+	Median    time.Duration `json:"median"`
+	P90       time.Duration `json:"p90"`
+	Max       time.Duration `json:"max"`
+	Mean      time.Duration `json:"mean"`
+	StdDev    time.Duration `json:"stddev"`
+}
+
+// starterRace tracks a race until its tree fires
+type starterRace struct {
+	staged map[int]time.Time // Lane -> when it staged
+	manual bool              // starter.trigger seen
+}
+
+// StarterAuditor records the time from every car being staged to the tree
+// firing, automatically or from the starter's console, for every run, and
+// summarizes it per starter and session. A late arm or a quick trigger
+// shows up as an outlier against the starter's other runs. starter.audit is
+// published for each run.
+type StarterAuditor struct {
+	mu          sync.Mutex
+	bus         *events.EventBus
+	config      StarterConfig
+	run         func(raceID string) (starter, sessionID string, ok bool)
+	races       map[string]*starterRace
+	runs        []StarterRun
+	unsubscribe func()
+}
+
+// NewStarterAuditor creates an auditor. run returns the starter working a
+// race's tree and the race's session, or false when the race should not be
+// audited.
+func NewStarterAuditor(bus *events.EventBus, config StarterConfig, run func(raceID string) (starter, sessionID string, ok bool)) *StarterAuditor {
+	return &StarterAuditor{
+		bus:    bus,
+		config: config,
+		run:    run,
+		races:  make(map[string]*starterRace),
+	}
+}
+
+// Start subscribes the auditor to the bus
+func (sa *StarterAuditor) Start() {
+	sa.unsubscribe = sa.bus.SubscribeAll(sa.HandleEvent)
+}
+
+// Stop unsubscribes from the bus
+func (sa *StarterAuditor) Stop() {
+	if sa.unsubscribe != nil {
+		sa.unsubscribe()
+	}
+}
+
+// Runs returns the runs audited so far, oldest first
+func (sa *StarterAuditor) Runs() []StarterRun {
+	sa.mu.Lock()
+	defer sa.mu.Unlock()
+	return append([]StarterRun(nil), sa.runs...)
+}
+
+// Distributions returns the delays of the runs audited so far per starter
+// and session, ordered by starter then session
+func (sa *StarterAuditor) Distributions() []StarterDistribution {
+	sa.mu.Lock()
+	defer sa.mu.Unlock()
+
+	type key struct{ starter, sessionID string }
+	groups := make(map[key][]StarterRun)
+	for _, run := range sa.runs {
+		k := key{run.Starter, run.SessionID}
+		groups[k] = append(groups[k], run)
+	}
+
+	distributions := make([]StarterDistribution, 0, len(groups))
+	for k, runs := range groups {
+		distributions = append(distributions, distribute(k.starter, k.sessionID, runs))
+	}
+	sort.Slice(distributions, func(i, j int) bool {
+		if distributions[i].Starter != distributions[j].Starter {
+			return distributions[i].Starter < distributions[j].Starter
+		}
+		return distributions[i].SessionID < distributions[j].SessionID
+	})
+	return distributions
+}
+
+// HandleEvent updates the auditor from a single event
+func (sa *StarterAuditor) HandleEvent(event events.Event) {
+	sa.mu.Lock()
+	run, ok := sa.record(event)
+	sa.mu.Unlock()
+
+	// Publish outside the lock so synchronous buses can redeliver to us
+	if ok && sa.bus != nil {
+		sa.bus.Publish(
+			events.NewEvent(events.EventStarterAudit).
+				WithRaceID(run.RaceID).
+				WithData("starter", run.Starter).
+				WithData("session_id", run.SessionID).
+				WithData("trigger", run.Trigger).
+				WithData("delay", run.Delay.Seconds()).
+				Build(),
+		)
+	}
+}
+
+// record tracks staging and returns the run once its tree fires
+func (sa *StarterAuditor) record(event events.Event) (StarterRun, bool) {
+	if event.RaceID == "" {
+		return StarterRun{}, false
+	}
+	race := sa.races[event.RaceID]
+
+	switch event.Type {
+	case events.EventTreeStage:
+		if race == nil {
+			race = &starterRace{staged: make(map[int]time.Time)}
+			sa.races[event.RaceID] = race
+		}
+		if broken, _ := event.Data["beam_broken"].(bool); broken {
+			race.staged[event.Lane] = event.Timestamp
+		} else {
+			delete(race.staged, event.Lane)
+		}
+
+	case events.EventStarterTrigger:
+		if race != nil {
+			race.manual = true
+		}
+
+	case events.EventRaceComplete, events.EventRaceAbort:
+		delete(sa.races, event.RaceID)
+
+	case events.EventTreeSequenceStart:
+		delete(sa.races, event.RaceID) // The tree fires once per race
+		if race == nil || len(race.staged) == 0 || sa.run == nil {
+			return StarterRun{}, false
+		}
+		starter, sessionID, ok := sa.run(event.RaceID)
+		if !ok {
+			return StarterRun{}, false
+		}
+
+		// The wait starts when the last car staged
+		var stagedAt time.Time
+		for _, at := range race.staged {
+			if at.After(stagedAt) {
+				stagedAt = at
+			}
+		}
+		run := StarterRun{
+			RaceID:    event.RaceID,
+			Starter:   starter,
+			SessionID: sessionID,
+			Trigger:   TriggerAuto,
+			StagedAt:  stagedAt,
+			FiredAt:   event.Timestamp,
+			Delay:     event.Timestamp.Sub(stagedAt),
+		}
+		if race.manual {
+			run.Trigger = TriggerManual
+		}
+		sa.runs = append(sa.runs, run)
+		return run, true
+	}
+	return StarterRun{}, false
+}
+
+// distribute summarizes one starter's runs in a session
+func distribute(starter, sessionID string, runs []StarterRun) StarterDistribution {
+	delays := make([]float64, 0, len(runs))
+	manual := 0
+	for _, run := range runs {
+		delays = append(delays, run.Delay.Seconds())
+		if run.Trigger == TriggerManual {
+			manual++
+		}
+	}
+	sort.Float64s(delays)
+	mean, stddev := meanStdDev(delays)
+
+	seconds := func(s float64) time.Duration { return time.Duration(math.Round(s * float64(time.Second))) }
+	return StarterDistribution{
+		Starter:   starter,
+		SessionID: sessionID,
+		Runs:      len(runs),
+		Manual:    manual,
+		Min:       seconds(delays[0]),
+		Median:    seconds(percentile(delays, 0.5)),
+		P90:       seconds(percentile(delays, 0.9)),
+		Max:       seconds(delays[len(delays)-1]),
+		Mean:      seconds(mean),
+		StdDev:    seconds(stddev),
+	}
+}
+
+// percentile returns the nearest-rank percentile p (0-1) of sorted values
+func percentile(sorted []float64, p float64) float64 {
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return sorted[rank]
+}
@@ -0,0 +1,192 @@
+// Package stats collects session-level throughput statistics from the event
+// stream and publishes periodic summaries for operations staff.
+package stats
+
+import (
+	"sync"
+	"time"
+
+	"github.com/benharold/libdrag/pkg/events"
+	"github.com/benharold/libdrag/pkg/timers"
+)
+
+// SessionSummary is a point-in-time view of a session's throughput
+type SessionSummary struct {
+	SessionID         string         `json:"session_id"`
+	RunsStarted       int            `json:"runs_started"`
+	RunsCompleted     int            `json:"runs_completed"`
+	RunsAborted       int            `json:"runs_aborted"`
+	AverageTurnaround time.Duration  `json:"average_turnaround"` // Race complete to next pair staged
+	FaultCounts       map[string]int `json:"fault_counts"`       // Fault type -> count
+	StartedAt         time.Time      `json:"started_at"`
+	GeneratedAt       time.Time      `json:"generated_at"`
+}
+
+// SessionStats accumulates statistics for races belonging to one session
+type SessionStats struct {
+	mu             sync.Mutex
+	sessionID      string
+	belongs        func(raceID string) bool
+	races          map[string]bool // Race IDs seen for this session
+	summary        SessionSummary
+	turnaround     *turnaroundTracker
+	turnaroundSum  time.Duration
+	turnaroundRuns int
+}
+
+// NewSessionStats creates a collector. belongs reports whether a race is part
+// of the session; it is consulted once when the race starts.
+func NewSessionStats(sessionID string, belongs func(raceID string) bool) *SessionStats {
+	return &SessionStats{
+		sessionID:  sessionID,
+		belongs:    belongs,
+		races:      make(map[string]bool),
+		turnaround: newTurnaroundTracker(2),
+		summary: SessionSummary{
+			SessionID:   sessionID,
+			FaultCounts: make(map[string]int),
+			StartedAt:   timers.Now(),
+		},
+	}
+}
+
+// HandleEvent updates the statistics from a single event
+func (ss *SessionStats) HandleEvent(event events.Event) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	if event.Type == events.EventRaceStart {
+		if event.RaceID == "" || (ss.belongs != nil && !ss.belongs(event.RaceID)) {
+			return
+		}
+		ss.races[event.RaceID] = true
+		ss.summary.RunsStarted++
+		return
+	}
+
+	if !ss.races[event.RaceID] {
+		return
+	}
+
+	if turnaround, ok := ss.turnaround.handle(event); ok {
+		ss.turnaroundSum += turnaround
+		ss.turnaroundRuns++
+	}
+
+	switch event.Type {
+	case events.EventRaceComplete:
+		ss.summary.RunsCompleted++
+	case events.EventRaceAbort:
+		ss.summary.RunsAborted++
+	default:
+		if fault := faultType(event); fault != "" {
+			ss.summary.FaultCounts[fault]++
+		}
+	}
+}
+
+// Summary returns a copy of the current statistics
+func (ss *SessionStats) Summary() SessionSummary {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	summary := ss.summary
+	summary.FaultCounts = make(map[string]int, len(ss.summary.FaultCounts))
+	for fault, count := range ss.summary.FaultCounts {
+		summary.FaultCounts[fault] = count
+	}
+	if ss.turnaroundRuns > 0 {
+		summary.AverageTurnaround = ss.turnaroundSum / time.Duration(ss.turnaroundRuns)
+	}
+	summary.GeneratedAt = timers.Now()
+	return summary
+}
+
+// faultType classifies fault events, returning "" for other events
+func faultType(event events.Event) string {
+	switch event.Type {
+	case events.EventRaceFoul:
+		if reason, ok := event.Data["reason"].(string); ok && reason != "" {
+			return reason
+		}
+		return "foul"
+	case events.EventStagingTimeoutFoul:
+		return "staging_timeout"
+	case events.EventAutoStartFault:
+		return "autostart_fault"
+	case events.EventTreeDeepStageViolation:
+		return "deep_stage_violation"
+	case events.EventTreeStagingViolation:
+		return "staging_violation"
+	}
+	return ""
+}
+
+// Emitter subscribes a SessionStats to a bus and periodically publishes
+// EventSessionSummary events
+type Emitter struct {
+	stats       *SessionStats
+	bus         *events.EventBus
+	interval    time.Duration
+	unsubscribe func()
+	done        chan struct{}
+	wg          sync.WaitGroup
+	stopOnce    sync.Once
+}
+
+// NewEmitter creates an emitter publishing a summary every interval
+func NewEmitter(bus *events.EventBus, stats *SessionStats, interval time.Duration) *Emitter {
+	return &Emitter{
+		stats:    stats,
+		bus:      bus,
+		interval: interval,
+		done:     make(chan struct{}),
+	}
+}
+
+// Start subscribes to the bus and begins periodic publishing
+func (em *Emitter) Start() {
+	em.unsubscribe = em.bus.SubscribeAll(em.stats.HandleEvent)
+
+	em.wg.Add(1)
+	go func() {
+		defer em.wg.Done()
+		ticker := timers.Default().NewTicker(em.interval, timers.Label{Name: "stats.summary"})
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				em.Publish()
+			case <-em.done:
+				return
+			}
+		}
+	}()
+}
+
+// Publish immediately publishes the current summary
+func (em *Emitter) Publish() {
+	summary := em.stats.Summary()
+	em.bus.Publish(
+		events.NewEvent(events.EventSessionSummary).
+			WithData("session_id", summary.SessionID).
+			WithData("summary", summary).
+			WithData("runs_completed", summary.RunsCompleted).
+			WithData("average_turnaround", summary.AverageTurnaround.Seconds()).
+			WithData("fault_counts", summary.FaultCounts).
+			Build(),
+	)
+}
+
+// Stop publishes a final summary and unsubscribes from the bus
+func (em *Emitter) Stop() {
+	em.stopOnce.Do(func() {
+		close(em.done)
+		em.wg.Wait()
+		if em.unsubscribe != nil {
+			em.unsubscribe()
+		}
+		em.Publish()
+	})
+}
@@ -0,0 +1,352 @@
+package stats
+
+import (
+	"testing"
+	"time"
+
+	"github.com/benharold/libdrag/pkg/events"
+)
+
+func TestSessionStatsSummary(t *testing.T) {
+	ss := NewSessionStats("elims-1", func(raceID string) bool {
+		return raceID != "other-session"
+	})
+
+	start := time.Now()
+	publish := func(eventType events.EventType, raceID string, offset time.Duration, data map[string]interface{}) {
+		builder := events.NewEvent(eventType).WithRaceID(raceID)
+		for k, v := range data {
+			builder.WithData(k, v)
+		}
+		e := builder.Build()
+		e.Timestamp = start.Add(offset)
+		ss.HandleEvent(e)
+	}
+	stagePair := func(raceID string, offset time.Duration) {
+		for lane := 1; lane <= 2; lane++ {
+			e := events.NewEvent(events.EventTreeStage).WithRaceID(raceID).WithLane(lane).WithData("beam_broken", true).Build()
+			e.Timestamp = start.Add(offset)
+			ss.HandleEvent(e)
+		}
+	}
+
+	publish(events.EventRaceStart, "race-1", 0, nil)
+	publish(events.EventRaceFoul, "race-1", time.Second, map[string]interface{}{"reason": "red_light"})
+	publish(events.EventRaceComplete, "race-1", 10*time.Second, nil)
+	publish(events.EventRaceStart, "race-2", 60*time.Second, nil)
+	stagePair("race-2", 50*time.Second)
+	publish(events.EventTreeDeepStageViolation, "race-2", 66*time.Second, nil)
+	publish(events.EventRaceComplete, "race-2", 80*time.Second, nil)
+	publish(events.EventRaceStart, "race-3", 110*time.Second, nil)
+	stagePair("race-3", 120*time.Second)
+
+	// Races from other sessions are ignored
+	publish(events.EventRaceStart, "other-session", 111*time.Second, nil)
+	publish(events.EventRaceFoul, "other-session", 112*time.Second, map[string]interface{}{"reason": "red_light"})
+
+	summary := ss.Summary()
+	if summary.RunsStarted != 3 || summary.RunsCompleted != 2 {
+		t.Fatalf("Expected 3 started and 2 completed runs, got %d and %d", summary.RunsStarted, summary.RunsCompleted)
+	}
+	if summary.AverageTurnaround != 40*time.Second {
+		t.Fatalf("Expected average turnaround 40s, got %v", summary.AverageTurnaround)
+	}
+	if summary.FaultCounts["red_light"] != 1 || summary.FaultCounts["deep_stage_violation"] != 1 {
+		t.Fatalf("Unexpected fault counts %v", summary.FaultCounts)
+	}
+}
+
+func TestEmitterPublishesSummaries(t *testing.T) {
+	bus := events.NewEventBus(false)
+	received := make(chan events.Event, 10)
+	bus.Subscribe(events.EventSessionSummary, func(e events.Event) {
+		received <- e
+	})
+
+	emitter := NewEmitter(bus, NewSessionStats("elims-1", nil), 10*time.Millisecond)
+	emitter.Start()
+
+	select {
+	case e := <-received:
+		if e.Data["session_id"] != "elims-1" {
+			t.Fatalf("Expected session elims-1, got %v", e.Data["session_id"])
+		}
+	case <-time.After(time.Second):
+		t.Fatal("No session summary published")
+	}
+	emitter.Stop()
+}
+
+func TestTurnaroundTimer(t *testing.T) {
+	bus := events.NewEventBus(false)
+	timer := NewTurnaroundTimer(bus, 20*time.Millisecond, nil)
+	timer.Start()
+	defer timer.Stop()
+
+	alerts := make(chan events.Event, 10)
+	turnarounds := make(chan events.Event, 10)
+	bus.Subscribe(events.EventTurnaroundAlert, func(e events.Event) { alerts <- e })
+	bus.Subscribe(events.EventTurnaround, func(e events.Event) { turnarounds <- e })
+
+	stage := func(raceID string, lane int) {
+		bus.Publish(events.NewEvent(events.EventTreeStage).WithRaceID(raceID).WithLane(lane).WithData("beam_broken", true).Build())
+	}
+
+	bus.Publish(events.NewEvent(events.EventRaceStart).WithRaceID("race-1").Build())
+	stage("race-1", 1)
+	stage("race-1", 2)
+	bus.Publish(events.NewEvent(events.EventRaceComplete).WithRaceID("race-1").Build())
+
+	// The next pair is late, so an alert fires before they stage
+	select {
+	case <-alerts:
+	case <-time.After(time.Second):
+		t.Fatal("Expected turnaround alert")
+	}
+
+	bus.Publish(events.NewEvent(events.EventRaceStart).WithRaceID("race-2").Build())
+	stage("race-2", 1)
+	if len(turnarounds) != 0 {
+		t.Fatal("Turnaround should not complete until both lanes stage")
+	}
+	stage("race-2", 2)
+
+	select {
+	case e := <-turnarounds:
+		if e.Data["threshold_exceeded"] != true {
+			t.Fatalf("Expected threshold exceeded, got %v", e.Data)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected turnaround event")
+	}
+
+	metrics := timer.Metrics()
+	if metrics.Count != 1 || metrics.Exceeded != 1 || metrics.Last < 20*time.Millisecond {
+		t.Fatalf("Unexpected metrics %+v", metrics)
+	}
+}
+
+func TestDelayBoxAnalyzer(t *testing.T) {
+	bus := events.NewEventBus(false)
+	flagged := make(chan events.Event, 10)
+	bus.Subscribe(events.EventTechFlag, func(e events.Event) {
+		flagged <- e
+	})
+
+	// Lane 1 is a bracket racer in a no-box class; lane 2 races in a box class
+	analyzer := NewDelayBoxAnalyzer(bus, DelayBoxConfig{MinRuns: 5, Window: 8, MaxSpread: 0.004}, func(raceID string, lane int) string {
+		if lane == 2 {
+			return ""
+		}
+		return "1234" + raceID[:1]
+	})
+
+	react := func(raceID string, lane int, rt float64) {
+		analyzer.HandleEvent(events.NewEvent(events.EventTimingReaction).WithRaceID(raceID).WithLane(lane).WithData("reaction_time", rt).Build())
+	}
+	tight := []float64{0.011, 0.012, 0.010, -0.004, 0.011, 0.013}
+	human := []float64{0.045, 0.012, 0.090, 0.031, 0.060, 0.020}
+	for i := range tight {
+		react("a", 1, tight[i])
+		react("b", 1, human[i])
+		react("a", 2, tight[i])
+	}
+
+	flags := analyzer.Flags()
+	if len(flags) != 1 || flags[0].Entry != "1234a" || flags[0].Runs != 5 || flags[0].Reason != FlagReasonRTClustering {
+		t.Fatalf("Expected entry 1234a flagged after 5 legal runs, got %+v", flags)
+	}
+	select {
+	case e := <-flagged:
+		if e.Data["entry"] != "1234a" {
+			t.Errorf("Unexpected tech flag event %+v", e)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected a tech flag event")
+	}
+
+	// An entry is only flagged once
+	react("a", 1, 0.011)
+	select {
+	case e := <-flagged:
+		t.Errorf("Unexpected repeat flag %+v", e)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestLeaderboard(t *testing.T) {
+	bus := events.NewEventBus(false)
+	var updates []events.Event
+	bus.Subscribe(events.EventLeaderboardUpdate, func(e events.Event) {
+		updates = append(updates, e)
+	})
+
+	drivers := map[int]string{1: "1234", 2: "5678"}
+	leaderboard := NewLeaderboard(bus, "test-and-tune", LeaderboardConfig{Size: 2, MinRuns: 2}, func(raceID string, lane int) string {
+		return drivers[lane]
+	})
+	day := time.Date(2025, time.June, 7, 19, 0, 0, 0, time.Local)
+	react := func(raceID string, lane int, rt float64, at time.Time) {
+		event := events.NewEvent(events.EventTimingReaction).WithRaceID(raceID).WithLane(lane).WithData("reaction_time", rt).Build()
+		event.Timestamp = at
+		leaderboard.HandleEvent(event)
+	}
+
+	react("a", 1, 0.021, day)
+	react("a", 2, 0.009, day)
+	react("b", 1, 0.023, day)
+	react("b", 2, -0.015, day) // Red lights do not count
+	react("c", 2, 0.080, day)
+	react("d", 3, 0.001, day) // No registered driver
+
+	boards := leaderboard.Boards()
+	if len(boards.BestRT) != 2 || boards.BestRT[0].Entry != "5678" || boards.BestRT[0].BestRaceID != "a" || boards.BestRT[1].Entry != "1234" {
+		t.Fatalf("Unexpected best RT board %+v", boards.BestRT)
+	}
+	if len(boards.Consistency) != 2 || boards.Consistency[0].Entry != "1234" || boards.Consistency[0].Runs != 2 {
+		t.Errorf("Expected 1234 most consistent, got %+v", boards.Consistency)
+	}
+	if boards.SessionID != "test-and-tune" || boards.Day != "2025-06-07" {
+		t.Errorf("Unexpected board labels %+v", boards)
+	}
+	if len(updates) != 4 {
+		t.Errorf("Expected an update for each ranked run, got %d", len(updates))
+	}
+
+	// The next day starts over
+	react("e", 1, 0.050, day.Add(24*time.Hour))
+	boards = leaderboard.Boards()
+	if len(boards.BestRT) != 1 || boards.BestRT[0].BestRT != 0.050 || len(boards.Consistency) != 0 {
+		t.Errorf("Expected fresh boards on a new day, got %+v", boards)
+	}
+}
+
+func TestStarterAuditor(t *testing.T) {
+	bus := events.NewEventBus(false)
+	var audits []events.Event
+	bus.Subscribe(events.EventStarterAudit, func(e events.Event) {
+		audits = append(audits, e)
+	})
+
+	starters := map[string]string{"a": "pat", "b": "pat", "c": "sam", "d": "pat"}
+	auditor := NewStarterAuditor(bus, StarterConfig{}, func(raceID string) (string, string, bool) {
+		if raceID == "x" {
+			return "", "", false // Filtered out, say a test pass
+		}
+		return starters[raceID], "elims-1", true
+	})
+	start := time.Now()
+	at := func(event events.Event, offset time.Duration) {
+		event.Timestamp = start.Add(offset)
+		auditor.HandleEvent(event)
+	}
+	stage := func(raceID string, lane int, broken bool, offset time.Duration) {
+		at(events.NewEvent(events.EventTreeStage).WithRaceID(raceID).WithLane(lane).WithData("beam_broken", broken).Build(), offset)
+	}
+	fire := func(raceID string, offset time.Duration) {
+		at(events.NewEvent(events.EventTreeSequenceStart).WithRaceID(raceID).Build(), offset)
+	}
+
+	// The wait runs from the last car staging, after lane 2 backs out and re-stages
+	stage("a", 1, true, 0)
+	stage("a", 2, true, 100*time.Millisecond)
+	stage("a", 2, false, 200*time.Millisecond)
+	stage("a", 2, true, 300*time.Millisecond)
+	fire("a", 800*time.Millisecond)
+
+	stage("b", 1, true, 0)
+	stage("b", 2, true, 0)
+	at(events.NewEvent(events.EventStarterTrigger).WithRaceID("b").Build(), 2*time.Second)
+	fire("b", 2*time.Second)
+	fire("b", 3*time.Second) // The tree fires once per race
+
+	stage("c", 1, true, 0)
+	stage("c", 2, true, 0)
+	fire("c", 700*time.Millisecond)
+
+	stage("d", 1, true, 0)
+	stage("d", 2, true, 0)
+	at(events.NewEvent(events.EventRaceAbort).WithRaceID("d").Build(), time.Second)
+	fire("d", 2*time.Second) // Aborted before firing
+
+	stage("x", 1, true, 0)
+	fire("x", time.Second)
+
+	runs := auditor.Runs()
+	if len(runs) != 3 {
+		t.Fatalf("Expected 3 audited runs, got %+v", runs)
+	}
+	if runs[0].RaceID != "a" || runs[0].Delay != 500*time.Millisecond || runs[0].Trigger != TriggerAuto {
+		t.Errorf("Unexpected run %+v", runs[0])
+	}
+	if runs[1].RaceID != "b" || runs[1].Delay != 2*time.Second || runs[1].Trigger != TriggerManual {
+		t.Errorf("Unexpected run %+v", runs[1])
+	}
+	if len(audits) != 3 || audits[1].Data["trigger"] != TriggerManual || audits[1].Data["delay"] != 2.0 {
+		t.Errorf("Expected a starter.audit event per run, got %+v", audits)
+	}
+
+	distributions := auditor.Distributions()
+	if len(distributions) != 2 {
+		t.Fatalf("Expected a distribution per starter, got %+v", distributions)
+	}
+	pat := distributions[0]
+	if pat.Starter != "pat" || pat.SessionID != "elims-1" || pat.Runs != 2 || pat.Manual != 1 ||
+		pat.Min != 500*time.Millisecond || pat.Median != 500*time.Millisecond || pat.Max != 2*time.Second ||
+		pat.P90 != 2*time.Second || pat.Mean != 1250*time.Millisecond || pat.StdDev != 750*time.Millisecond {
+		t.Errorf("Unexpected distribution %+v", pat)
+	}
+	if distributions[1].Starter != "sam" || distributions[1].Runs != 1 || distributions[1].Median != 700*time.Millisecond {
+		t.Errorf("Unexpected distribution %+v", distributions[1])
+	}
+}
+
+func TestForgetDriver(t *testing.T) {
+	bus := events.NewEventBus(false)
+	var updates []events.Event
+	bus.Subscribe(events.EventLeaderboardUpdate, func(e events.Event) {
+		updates = append(updates, e)
+	})
+	drivers := map[int]string{1: "1234", 2: "5678"}
+	entry := func(raceID string, lane int) string { return drivers[lane] }
+	leaderboard := NewLeaderboard(bus, "", LeaderboardConfig{}, entry)
+	analyzer := NewDelayBoxAnalyzer(bus, DelayBoxConfig{MinRuns: 2, Window: 2, MaxSpread: 0.004}, entry)
+	rts := map[int][]float64{1: {0.011, 0.012}, 2: {0.045, 0.020}}
+	for i, raceID := range []string{"a", "b"} {
+		for lane := 1; lane <= 2; lane++ {
+			event := events.NewEvent(events.EventTimingReaction).WithRaceID(raceID).WithLane(lane).WithData("reaction_time", rts[lane][i]).Build()
+			leaderboard.HandleEvent(event)
+			analyzer.HandleEvent(event)
+		}
+	}
+
+	// Anonymizing keeps the driver's runs under the pseudonym
+	published := len(updates)
+	if !leaderboard.Forget("1234", "anon-1") || !analyzer.Forget("1234", "anon-1") {
+		t.Fatal("Expected 1234 to be known")
+	}
+	boards := leaderboard.Boards()
+	if boards.BestRT[0].Entry != "anon-1" || boards.BestRT[0].Runs != 2 {
+		t.Errorf("Expected the runs kept under the pseudonym, got %+v", boards.BestRT)
+	}
+	if len(updates) != published+1 {
+		t.Errorf("Expected the changed boards published, got %d updates", len(updates)-published)
+	}
+	if flags := analyzer.Flags(); len(flags) != 1 || flags[0].Entry != "anon-1" {
+		t.Errorf("Expected the flag kept under the pseudonym, got %+v", flags)
+	}
+
+	// Deleting drops them
+	if !leaderboard.Forget("anon-1", "") || !analyzer.Forget("anon-1", "") {
+		t.Fatal("Expected anon-1 to be known")
+	}
+	if boards := leaderboard.Boards(); len(boards.BestRT) != 1 || boards.BestRT[0].Entry != "5678" {
+		t.Errorf("Expected only 5678 ranked, got %+v", boards.BestRT)
+	}
+	if flags := analyzer.Flags(); len(flags) != 0 {
+		t.Errorf("Expected the flag dropped, got %+v", flags)
+	}
+	if leaderboard.Forget("1234", "") || analyzer.Forget("1234", "") {
+		t.Error("Expected a forgotten driver to be unknown")
+	}
+}
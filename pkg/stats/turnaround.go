@@ -0,0 +1,194 @@
+package stats
+
+import (
+	"sync"
+	"time"
+
+	"github.com/benharold/libdrag/pkg/events"
+	"github.com/benharold/libdrag/pkg/timers"
+)
+
+// turnaroundTracker measures the time from one race finishing to the next
+// pair being fully staged
+type turnaroundTracker struct {
+	lanes        int
+	lastComplete time.Time
+	lastRaceID   string
+	staged       map[string]map[int]bool // raceID -> lane -> staged
+}
+
+func newTurnaroundTracker(lanes int) *turnaroundTracker {
+	return &turnaroundTracker{
+		lanes:  lanes,
+		staged: make(map[string]map[int]bool),
+	}
+}
+
+// waiting reports whether a pair has finished and the next is not yet staged
+func (tt *turnaroundTracker) waiting() bool {
+	return !tt.lastComplete.IsZero()
+}
+
+// handle updates the tracker and returns a turnaround when an event completes one
+func (tt *turnaroundTracker) handle(event events.Event) (time.Duration, bool) {
+	switch event.Type {
+	case events.EventRaceComplete, events.EventRaceAbort:
+		tt.lastComplete = event.Timestamp
+		tt.lastRaceID = event.RaceID
+		delete(tt.staged, event.RaceID)
+
+	case events.EventTreeStage:
+		broken, _ := event.Data["beam_broken"].(bool)
+		lanes := tt.staged[event.RaceID]
+		if lanes == nil {
+			lanes = make(map[int]bool)
+			tt.staged[event.RaceID] = lanes
+		}
+		if !broken {
+			delete(lanes, event.Lane)
+			return 0, false
+		}
+		lanes[event.Lane] = true
+
+		if len(lanes) >= tt.lanes && tt.waiting() && event.RaceID != tt.lastRaceID {
+			turnaround := event.Timestamp.Sub(tt.lastComplete)
+			tt.lastComplete = time.Time{}
+			return turnaround, true
+		}
+	}
+	return 0, false
+}
+
+// TurnaroundMetrics summarizes measured turnarounds
+type TurnaroundMetrics struct {
+	Count    int           `json:"count"`
+	Last     time.Duration `json:"last"`
+	Average  time.Duration `json:"average"`
+	Max      time.Duration `json:"max"`
+	Exceeded int           `json:"exceeded"` // Turnarounds longer than the threshold
+}
+
+// TurnaroundTimer publishes EventTurnaround for every pair change and
+// EventTurnaroundAlert as soon as the next pair is late to stage
+type TurnaroundTimer struct {
+	mu          sync.Mutex
+	bus         *events.EventBus
+	threshold   time.Duration
+	belongs     func(raceID string) bool
+	races       map[string]bool
+	tracker     *turnaroundTracker
+	metrics     TurnaroundMetrics
+	total       time.Duration
+	alertTimer  *timers.Timer
+	unsubscribe func()
+}
+
+// NewTurnaroundTimer creates a timer for two-lane pairs. A zero threshold
+// disables alerts. belongs filters races (nil accepts all).
+func NewTurnaroundTimer(bus *events.EventBus, threshold time.Duration, belongs func(raceID string) bool) *TurnaroundTimer {
+	return &TurnaroundTimer{
+		bus:       bus,
+		threshold: threshold,
+		belongs:   belongs,
+		races:     make(map[string]bool),
+		tracker:   newTurnaroundTracker(2),
+	}
+}
+
+// Start subscribes the timer to the bus
+func (tt *TurnaroundTimer) Start() {
+	tt.unsubscribe = tt.bus.SubscribeAll(tt.HandleEvent)
+}
+
+// Stop unsubscribes from the bus and cancels any pending alert
+func (tt *TurnaroundTimer) Stop() {
+	if tt.unsubscribe != nil {
+		tt.unsubscribe()
+	}
+	tt.mu.Lock()
+	defer tt.mu.Unlock()
+	tt.cancelAlert()
+}
+
+// Metrics returns the turnaround metrics measured so far
+func (tt *TurnaroundTimer) Metrics() TurnaroundMetrics {
+	tt.mu.Lock()
+	defer tt.mu.Unlock()
+	return tt.metrics
+}
+
+// HandleEvent updates the timer from a single event
+func (tt *TurnaroundTimer) HandleEvent(event events.Event) {
+	tt.mu.Lock()
+	measured, ok := tt.record(event)
+	tt.mu.Unlock()
+
+	// Publish outside the lock so synchronous buses can redeliver to us
+	if ok {
+		tt.bus.Publish(measured)
+	}
+}
+
+// record updates the metrics and returns a turnaround event when one completes
+func (tt *TurnaroundTimer) record(event events.Event) (events.Event, bool) {
+	if event.Type == events.EventRaceStart {
+		if event.RaceID != "" && (tt.belongs == nil || tt.belongs(event.RaceID)) {
+			tt.races[event.RaceID] = true
+		}
+		return events.Event{}, false
+	}
+	if !tt.races[event.RaceID] {
+		return events.Event{}, false
+	}
+
+	turnaround, ok := tt.tracker.handle(event)
+	if event.Type == events.EventRaceComplete || event.Type == events.EventRaceAbort {
+		delete(tt.races, event.RaceID)
+		tt.scheduleAlert(event.RaceID)
+	}
+	if !ok {
+		return events.Event{}, false
+	}
+
+	tt.cancelAlert()
+	exceeded := tt.threshold > 0 && turnaround > tt.threshold
+	tt.metrics.Count++
+	tt.metrics.Last = turnaround
+	tt.total += turnaround
+	tt.metrics.Average = tt.total / time.Duration(tt.metrics.Count)
+	if turnaround > tt.metrics.Max {
+		tt.metrics.Max = turnaround
+	}
+	if exceeded {
+		tt.metrics.Exceeded++
+	}
+
+	return events.NewEvent(events.EventTurnaround).
+		WithRaceID(event.RaceID).
+		WithData("turnaround", turnaround.Seconds()).
+		WithData("threshold_exceeded", exceeded).
+		Build(), true
+}
+
+// scheduleAlert arms an alert for when the next pair is late to stage
+func (tt *TurnaroundTimer) scheduleAlert(previousRaceID string) {
+	tt.cancelAlert()
+	if tt.threshold <= 0 {
+		return
+	}
+	tt.alertTimer = timers.Default().AfterFunc(tt.threshold, timers.Label{Name: "turnaround.alert", RaceID: previousRaceID}, func() {
+		tt.bus.Publish(
+			events.NewEvent(events.EventTurnaroundAlert).
+				WithRaceID(previousRaceID).
+				WithData("threshold", tt.threshold.Seconds()).
+				Build(),
+		)
+	})
+}
+
+func (tt *TurnaroundTimer) cancelAlert() {
+	if tt.alertTimer != nil {
+		tt.alertTimer.Stop()
+		tt.alertTimer = nil
+	}
+}
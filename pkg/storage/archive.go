@@ -0,0 +1,146 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DirArchive keeps objects as files under a directory, keys mapping to
+// relative paths
+type DirArchive struct {
+	dir string
+}
+
+// NewDirArchive creates an archive rooted at dir
+func NewDirArchive(dir string) *DirArchive {
+	return &DirArchive{dir: dir}
+}
+
+// PutObject implements Archive
+func (a *DirArchive) PutObject(_ context.Context, key string, data []byte) error {
+	if err := validKey(key); err != nil {
+		return err
+	}
+	path := filepath.Join(a.dir, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
+
+// GetObject implements Archive
+func (a *DirArchive) GetObject(_ context.Context, key string) ([]byte, error) {
+	if err := validKey(key); err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(filepath.Join(a.dir, filepath.FromSlash(key)))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return data, err
+}
+
+// ListObjects implements Archive
+func (a *DirArchive) ListObjects(_ context.Context, prefix string) ([]string, error) {
+	keys := make([]string, 0)
+	err := filepath.WalkDir(a.dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) && path == a.dir {
+				return filepath.SkipDir // Nothing archived yet
+			}
+			return err
+		}
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".tmp-") {
+			return nil
+		}
+		rel, err := filepath.Rel(a.dir, path)
+		if err != nil {
+			return err
+		}
+		if key := filepath.ToSlash(rel); strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	sort.Strings(keys)
+	return keys, err
+}
+
+// DeleteObject implements Archive
+func (a *DirArchive) DeleteObject(_ context.Context, key string) error {
+	if err := validKey(key); err != nil {
+		return err
+	}
+	err := os.Remove(filepath.Join(a.dir, filepath.FromSlash(key)))
+	if errors.Is(err, fs.ErrNotExist) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// ObjectClient is the part of an object storage SDK an archive needs.
+// Adapt the S3 or GCS client to it; GetObject and DeleteObject must return
+// ErrNotFound for missing keys. libdrag has no cloud SDK dependency of its own.
+type ObjectClient interface {
+	PutObject(ctx context.Context, bucket, key string, data []byte) error
+	GetObject(ctx context.Context, bucket, key string) ([]byte, error)
+	ListObjects(ctx context.Context, bucket, prefix string) ([]string, error)
+	DeleteObject(ctx context.Context, bucket, key string) error
+}
+
+// BucketArchive keeps objects in an S3 or GCS bucket under an optional key
+// prefix (e.g. "track-12/")
+type BucketArchive struct {
+	client ObjectClient
+	bucket string
+	prefix string
+}
+
+// NewBucketArchive creates an archive in bucket through client
+func NewBucketArchive(client ObjectClient, bucket, prefix string) *BucketArchive {
+	return &BucketArchive{client: client, bucket: bucket, prefix: prefix}
+}
+
+// PutObject implements Archive
+func (a *BucketArchive) PutObject(ctx context.Context, key string, data []byte) error {
+	if err := validKey(key); err != nil {
+		return err
+	}
+	return a.client.PutObject(ctx, a.bucket, a.prefix+key, data)
+}
+
+// GetObject implements Archive
+func (a *BucketArchive) GetObject(ctx context.Context, key string) ([]byte, error) {
+	if err := validKey(key); err != nil {
+		return nil, err
+	}
+	return a.client.GetObject(ctx, a.bucket, a.prefix+key)
+}
+
+// ListObjects implements Archive. Keys are returned without the archive's
+// prefix.
+func (a *BucketArchive) ListObjects(ctx context.Context, prefix string) ([]string, error) {
+	keys, err := a.client.ListObjects(ctx, a.bucket, a.prefix+prefix)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]string, 0, len(keys))
+	for _, key := range keys {
+		result = append(result, strings.TrimPrefix(key, a.prefix))
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// DeleteObject implements Archive
+func (a *BucketArchive) DeleteObject(ctx context.Context, key string) error {
+	if err := validKey(key); err != nil {
+		return err
+	}
+	return a.client.DeleteObject(ctx, a.bucket, a.prefix+key)
+}
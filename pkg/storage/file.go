@@ -0,0 +1,192 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FileStore is the embedded store: one JSON file per race in a directory,
+// and profiles under profiles/{kind}/{name}.json. Everything is loaded into
+// memory when the store opens, which suits a single track's history.
+type FileStore struct {
+	dir    string
+	memory *MemoryStore
+}
+
+// OpenFileStore opens (creating if needed) a file store in dir
+func OpenFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	s := &FileStore{dir: dir, memory: NewMemoryStore()}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		var record Record
+		if err := json.Unmarshal(data, &record); err != nil {
+			return nil, fmt.Errorf("%s: %v", entry.Name(), err)
+		}
+		s.memory.put(record)
+	}
+	if err := s.loadProfiles(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// loadProfiles reads every profile file into memory
+func (s *FileStore) loadProfiles() error {
+	paths, err := filepath.Glob(filepath.Join(s.dir, "profiles", "*", "*.json"))
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		var profile Profile
+		if err := json.Unmarshal(data, &profile); err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		s.memory.profiles[profile.Kind+"/"+profile.Name] = profile
+	}
+	return nil
+}
+
+// PutRace implements Store. The file is replaced atomically.
+func (s *FileStore) PutRace(ctx context.Context, record Record) error {
+	if err := validKey(record.RaceID); err != nil || strings.Contains(record.RaceID, "/") {
+		return fmt.Errorf("invalid race ID %q", record.RaceID)
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(filepath.Join(s.dir, record.RaceID+".json"), data); err != nil {
+		return err
+	}
+	return s.memory.PutRace(ctx, record)
+}
+
+// GetRace implements Store
+func (s *FileStore) GetRace(ctx context.Context, raceID string) (Record, error) {
+	return s.memory.GetRace(ctx, raceID)
+}
+
+// ListRaces implements Store
+func (s *FileStore) ListRaces(ctx context.Context, filter Filter) ([]Record, error) {
+	return s.memory.ListRaces(ctx, filter)
+}
+
+// DeleteRace implements Store
+func (s *FileStore) DeleteRace(ctx context.Context, raceID string) error {
+	if err := validKey(raceID); err != nil || strings.Contains(raceID, "/") {
+		return fmt.Errorf("invalid race ID %q", raceID)
+	}
+	if err := s.memory.DeleteRace(ctx, raceID); err != nil {
+		return err
+	}
+	return os.Remove(filepath.Join(s.dir, raceID+".json"))
+}
+
+// PutProfile implements ProfileStore. The file is replaced atomically.
+func (s *FileStore) PutProfile(ctx context.Context, profile Profile) error {
+	path, err := s.profilePath(profile.Kind, profile.Name)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(profile)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(path, data); err != nil {
+		return err
+	}
+	return s.memory.PutProfile(ctx, profile)
+}
+
+// GetProfile implements ProfileStore
+func (s *FileStore) GetProfile(ctx context.Context, kind, name string) (Profile, error) {
+	return s.memory.GetProfile(ctx, kind, name)
+}
+
+// ListProfiles implements ProfileStore
+func (s *FileStore) ListProfiles(ctx context.Context, kind string) ([]Profile, error) {
+	return s.memory.ListProfiles(ctx, kind)
+}
+
+// DeleteProfile implements ProfileStore
+func (s *FileStore) DeleteProfile(ctx context.Context, kind, name string) error {
+	path, err := s.profilePath(kind, name)
+	if err != nil {
+		return err
+	}
+	if err := s.memory.DeleteProfile(ctx, kind, name); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// profilePath returns the file a profile is kept in
+func (s *FileStore) profilePath(kind, name string) (string, error) {
+	for _, part := range []string{kind, name} {
+		if err := validKey(part); err != nil || strings.Contains(part, "/") {
+			return "", fmt.Errorf("invalid profile %s/%s", kind, name)
+		}
+	}
+	return filepath.Join(s.dir, "profiles", kind, name+".json"), nil
+}
+
+// Close implements Store
+func (s *FileStore) Close() error {
+	return nil
+}
+
+// validKey rejects keys that would escape the store's directory
+func validKey(key string) error {
+	if key == "" {
+		return fmt.Errorf("key is required")
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." || strings.Contains(part, `\`) {
+			return fmt.Errorf("invalid key %q", key)
+		}
+	}
+	return nil
+}
+
+// writeFileAtomic writes data to a temporary file and renames it into place
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
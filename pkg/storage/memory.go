@@ -0,0 +1,182 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// MemoryStore keeps records in memory, for tests and short-lived tools
+type MemoryStore struct {
+	mu       sync.RWMutex
+	records  map[string]Record
+	tagged   map[string]map[string]bool // Tag -> race IDs, for tag filters
+	profiles map[string]Profile         // "{kind}/{name}" -> profile
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		records:  make(map[string]Record),
+		tagged:   make(map[string]map[string]bool),
+		profiles: make(map[string]Profile),
+	}
+}
+
+// put stores a record and indexes its tags. Caller holds s.mu.
+func (s *MemoryStore) put(record Record) {
+	s.remove(record.RaceID)
+	s.records[record.RaceID] = record
+	for _, tag := range record.Tags {
+		tag = strings.ToLower(tag)
+		if s.tagged[tag] == nil {
+			s.tagged[tag] = make(map[string]bool)
+		}
+		s.tagged[tag][record.RaceID] = true
+	}
+}
+
+// remove drops a record and its tags from the index. Caller holds s.mu.
+func (s *MemoryStore) remove(raceID string) {
+	for _, tag := range s.records[raceID].Tags {
+		tag = strings.ToLower(tag)
+		delete(s.tagged[tag], raceID)
+		if len(s.tagged[tag]) == 0 {
+			delete(s.tagged, tag)
+		}
+	}
+	delete(s.records, raceID)
+}
+
+// PutRace implements Store
+func (s *MemoryStore) PutRace(_ context.Context, record Record) error {
+	if record.RaceID == "" {
+		return fmt.Errorf("race ID is required")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.put(record)
+	return nil
+}
+
+// GetRace implements Store
+func (s *MemoryStore) GetRace(_ context.Context, raceID string) (Record, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	record, ok := s.records[raceID]
+	if !ok {
+		return Record{}, ErrNotFound
+	}
+	return record, nil
+}
+
+// ListRaces implements Store
+func (s *MemoryStore) ListRaces(_ context.Context, filter Filter) ([]Record, error) {
+	s.mu.RLock()
+	var records []Record
+	if len(filter.Tags.Tags) > 0 {
+		// Only races with the filter's first tag can match
+		tagged := s.tagged[strings.ToLower(strings.TrimSpace(filter.Tags.Tags[0]))]
+		records = make([]Record, 0, len(tagged))
+		for raceID := range tagged {
+			records = append(records, s.records[raceID])
+		}
+	} else {
+		records = make([]Record, 0, len(s.records))
+		for _, record := range s.records {
+			records = append(records, record)
+		}
+	}
+	s.mu.RUnlock()
+	return page(records, filter), nil
+}
+
+// DeleteRace implements Store
+func (s *MemoryStore) DeleteRace(_ context.Context, raceID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.records[raceID]; !ok {
+		return ErrNotFound
+	}
+	s.remove(raceID)
+	return nil
+}
+
+// Close implements Store
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+// PutProfile implements ProfileStore
+func (s *MemoryStore) PutProfile(_ context.Context, profile Profile) error {
+	if profile.Kind == "" || profile.Name == "" {
+		return fmt.Errorf("profile kind and name are required")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.profiles[profile.Kind+"/"+profile.Name] = profile
+	return nil
+}
+
+// GetProfile implements ProfileStore
+func (s *MemoryStore) GetProfile(_ context.Context, kind, name string) (Profile, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	profile, ok := s.profiles[kind+"/"+name]
+	if !ok {
+		return Profile{}, ErrNotFound
+	}
+	return profile, nil
+}
+
+// ListProfiles implements ProfileStore
+func (s *MemoryStore) ListProfiles(_ context.Context, kind string) ([]Profile, error) {
+	s.mu.RLock()
+	profiles := make([]Profile, 0)
+	for _, profile := range s.profiles {
+		if profile.Kind == kind {
+			profiles = append(profiles, profile)
+		}
+	}
+	s.mu.RUnlock()
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].Name < profiles[j].Name })
+	return profiles, nil
+}
+
+// DeleteProfile implements ProfileStore
+func (s *MemoryStore) DeleteProfile(_ context.Context, kind, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.profiles[kind+"/"+name]; !ok {
+		return ErrNotFound
+	}
+	delete(s.profiles, kind+"/"+name)
+	return nil
+}
+
+// page filters, sorts (oldest first, then by race ID) and pages records
+func page(records []Record, filter Filter) []Record {
+	matched := make([]Record, 0, len(records))
+	for _, record := range records {
+		if filter.matches(record) {
+			matched = append(matched, record)
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		if !matched[i].CreatedAt.Equal(matched[j].CreatedAt) {
+			return matched[i].CreatedAt.Before(matched[j].CreatedAt)
+		}
+		return matched[i].RaceID < matched[j].RaceID
+	})
+
+	if filter.Offset >= len(matched) {
+		return []Record{}
+	}
+	matched = matched[filter.Offset:]
+	if filter.Limit > 0 && filter.Limit < len(matched) {
+		matched = matched[:filter.Limit]
+	}
+	return matched
+}
@@ -0,0 +1,283 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// PostgresSchema creates the races, race tags and profiles tables. PostgresStore.Init
+// runs it; it is exported for services that manage migrations with their
+// own tooling.
+const PostgresSchema = `CREATE TABLE IF NOT EXISTS libdrag_races (
+	race_id    TEXT PRIMARY KEY,
+	track      TEXT NOT NULL DEFAULT '',
+	session_id TEXT NOT NULL DEFAULT '',
+	class      TEXT NOT NULL DEFAULT '',
+	state      TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMPTZ NOT NULL,
+	data       JSONB NOT NULL
+);
+CREATE INDEX IF NOT EXISTS libdrag_races_track_created ON libdrag_races (track, created_at, race_id);
+CREATE INDEX IF NOT EXISTS libdrag_races_session ON libdrag_races (session_id);
+CREATE TABLE IF NOT EXISTS libdrag_race_tags (
+	race_id TEXT NOT NULL REFERENCES libdrag_races (race_id) ON DELETE CASCADE,
+	tag     TEXT NOT NULL,
+	PRIMARY KEY (race_id, tag)
+);
+CREATE INDEX IF NOT EXISTS libdrag_race_tags_tag ON libdrag_race_tags (tag, race_id);
+CREATE TABLE IF NOT EXISTS libdrag_profiles (
+	kind       TEXT NOT NULL,
+	name       TEXT NOT NULL,
+	updated_at TIMESTAMPTZ NOT NULL,
+	data       JSONB NOT NULL,
+	PRIMARY KEY (kind, name)
+);`
+
+// PostgresStore keeps races in Postgres for hosted, multi-track services.
+// It uses database/sql with whichever Postgres driver the application
+// registers (lib/pq, pgx stdlib); libdrag does not import one.
+type PostgresStore struct {
+	db *sql.DB
+}
+
+// NewPostgresStore creates a store on an open database. Call Init once to
+// create the table.
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+// Init creates the tables and indexes if they do not exist
+func (s *PostgresStore) Init(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, PostgresSchema)
+	return err
+}
+
+// recordColumns selects a race record, its tags aggregated as a JSON array
+const recordColumns = "race_id, track, session_id, class, state, created_at, data, " +
+	"(SELECT COALESCE(json_agg(tag ORDER BY tag), '[]')::text FROM libdrag_race_tags t WHERE t.race_id = libdrag_races.race_id)"
+
+// PutRace implements Store. The race and its tags are written in one
+// transaction.
+func (s *PostgresStore) PutRace(ctx context.Context, record Record) error {
+	if record.RaceID == "" {
+		return fmt.Errorf("race ID is required")
+	}
+	data := record.Data
+	if len(data) == 0 {
+		data = []byte("null")
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `INSERT INTO libdrag_races (race_id, track, session_id, class, state, created_at, data)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+ON CONFLICT (race_id) DO UPDATE SET track = EXCLUDED.track, session_id = EXCLUDED.session_id,
+	class = EXCLUDED.class, state = EXCLUDED.state, created_at = EXCLUDED.created_at, data = EXCLUDED.data`,
+		record.RaceID, record.Track, record.SessionID, record.Class, record.State, record.CreatedAt, string(data)); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM libdrag_race_tags WHERE race_id = $1`, record.RaceID); err != nil {
+		return err
+	}
+	for _, tag := range record.Tags {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO libdrag_race_tags (race_id, tag) VALUES ($1, $2)
+ON CONFLICT DO NOTHING`, record.RaceID, tag); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetRace implements Store
+func (s *PostgresStore) GetRace(ctx context.Context, raceID string) (Record, error) {
+	row := s.db.QueryRowContext(ctx, "SELECT "+recordColumns+`
+FROM libdrag_races WHERE race_id = $1`, raceID)
+	record, err := scanRecord(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Record{}, ErrNotFound
+	}
+	return record, err
+}
+
+// ListRaces implements Store
+func (s *PostgresStore) ListRaces(ctx context.Context, filter Filter) ([]Record, error) {
+	query, args := listQuery(filter)
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := make([]Record, 0)
+	for rows.Next() {
+		record, err := scanRecord(rows)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+// DeleteRace implements Store
+func (s *PostgresStore) DeleteRace(ctx context.Context, raceID string) error {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM libdrag_races WHERE race_id = $1`, raceID)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// PutProfile implements ProfileStore
+func (s *PostgresStore) PutProfile(ctx context.Context, profile Profile) error {
+	if profile.Kind == "" || profile.Name == "" {
+		return fmt.Errorf("profile kind and name are required")
+	}
+	data := profile.Data
+	if len(data) == 0 {
+		data = []byte("null")
+	}
+	_, err := s.db.ExecContext(ctx, `INSERT INTO libdrag_profiles (kind, name, updated_at, data)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (kind, name) DO UPDATE SET updated_at = EXCLUDED.updated_at, data = EXCLUDED.data`,
+		profile.Kind, profile.Name, profile.UpdatedAt, string(data))
+	return err
+}
+
+// GetProfile implements ProfileStore
+func (s *PostgresStore) GetProfile(ctx context.Context, kind, name string) (Profile, error) {
+	row := s.db.QueryRowContext(ctx, `SELECT kind, name, updated_at, data
+FROM libdrag_profiles WHERE kind = $1 AND name = $2`, kind, name)
+	profile, err := scanProfile(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Profile{}, ErrNotFound
+	}
+	return profile, err
+}
+
+// ListProfiles implements ProfileStore
+func (s *PostgresStore) ListProfiles(ctx context.Context, kind string) ([]Profile, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT kind, name, updated_at, data
+FROM libdrag_profiles WHERE kind = $1 ORDER BY name`, kind)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	profiles := make([]Profile, 0)
+	for rows.Next() {
+		profile, err := scanProfile(rows)
+		if err != nil {
+			return nil, err
+		}
+		profiles = append(profiles, profile)
+	}
+	return profiles, rows.Err()
+}
+
+// DeleteProfile implements ProfileStore
+func (s *PostgresStore) DeleteProfile(ctx context.Context, kind, name string) error {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM libdrag_profiles WHERE kind = $1 AND name = $2`, kind, name)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Close implements Store. The database itself belongs to the caller.
+func (s *PostgresStore) Close() error {
+	return nil
+}
+
+// listQuery builds the SELECT for a filter with numbered placeholders
+func listQuery(filter Filter) (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+	add := func(condition string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+	if filter.Track != "" {
+		add("track = $%d", filter.Track)
+	}
+	if filter.SessionID != "" {
+		add("session_id = $%d", filter.SessionID)
+	}
+	if filter.Class != "" {
+		add("class = $%d", filter.Class)
+	}
+	for _, tag := range filter.Tags.Tags {
+		add("race_id IN (SELECT race_id FROM libdrag_race_tags WHERE tag = $%d)", normalTag(tag))
+	}
+	for _, tag := range filter.Tags.Exclude {
+		add("race_id NOT IN (SELECT race_id FROM libdrag_race_tags WHERE tag = $%d)", normalTag(tag))
+	}
+	if !filter.Since.IsZero() {
+		add("created_at >= $%d", filter.Since)
+	}
+
+	query := "SELECT " + recordColumns + " FROM libdrag_races"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY created_at, race_id"
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+	if filter.Offset > 0 {
+		args = append(args, filter.Offset)
+		query += fmt.Sprintf(" OFFSET $%d", len(args))
+	}
+	return query, args
+}
+
+// scanner is satisfied by *sql.Row and *sql.Rows
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// normalTag is a tag as stored, for filters given in any case
+func normalTag(tag string) string {
+	return strings.ToLower(strings.TrimSpace(tag))
+}
+
+func scanRecord(row scanner) (Record, error) {
+	var record Record
+	var data, tags string
+	if err := row.Scan(&record.RaceID, &record.Track, &record.SessionID, &record.Class, &record.State, &record.CreatedAt, &data, &tags); err != nil {
+		return Record{}, err
+	}
+	record.Data = []byte(data)
+	if err := json.Unmarshal([]byte(tags), &record.Tags); err != nil {
+		return Record{}, err
+	}
+	if len(record.Tags) == 0 {
+		record.Tags = nil
+	}
+	return record, nil
+}
+
+func scanProfile(row scanner) (Profile, error) {
+	var profile Profile
+	var data string
+	if err := row.Scan(&profile.Kind, &profile.Name, &profile.UpdatedAt, &data); err != nil {
+		return Profile{}, err
+	}
+	profile.Data = []byte(data)
+	return profile, nil
+}
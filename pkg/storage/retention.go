@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Retention is how long race records are kept. A class listed in Classes
+// keeps its races for that long; other races are kept for MaxAge. Zero
+// keeps races forever.
+type Retention struct {
+	MaxAge  time.Duration            `json:"max_age,omitempty"`
+	Classes map[string]time.Duration `json:"classes,omitempty"`
+}
+
+// Validate reports negative retention periods
+func (r Retention) Validate() error {
+	if r.MaxAge < 0 {
+		return fmt.Errorf("max_age cannot be negative")
+	}
+	for class, age := range r.Classes {
+		if age < 0 {
+			return fmt.Errorf("retention for class %q cannot be negative", class)
+		}
+	}
+	return nil
+}
+
+// expired reports whether a record is past its retention period at now
+func (r Retention) expired(record Record, now time.Time) bool {
+	age, ok := r.Classes[record.Class]
+	if !ok {
+		age = r.MaxAge
+	}
+	return age > 0 && now.Sub(record.CreatedAt) > age
+}
+
+// Prune deletes the records in store matching filter that are past their
+// retention period at now, and returns the IDs of the races deleted, oldest
+// first, so their archived journals can be removed too. The filter's paging
+// is ignored.
+func Prune(ctx context.Context, store Store, filter Filter, retention Retention, now time.Time) ([]string, error) {
+	if err := retention.Validate(); err != nil {
+		return nil, err
+	}
+	pruned := make([]string, 0)
+	for offset := 0; ; offset += migratePageSize {
+		filter.Offset, filter.Limit = offset, migratePageSize
+		page, err := store.ListRaces(ctx, filter)
+		if err != nil {
+			return nil, err
+		}
+		for _, record := range page {
+			if retention.expired(record, now) {
+				pruned = append(pruned, record.RaceID)
+			}
+		}
+		if len(page) < migratePageSize {
+			break
+		}
+	}
+	// Delete once the listing is done, so deletions do not shift the pages
+	for i, raceID := range pruned {
+		if err := store.DeleteRace(ctx, raceID); err != nil && !errors.Is(err, ErrNotFound) {
+			return pruned[:i], err
+		}
+	}
+	return pruned, nil
+}
@@ -0,0 +1,152 @@
+// Package storage defines where finished races and their archives are
+// kept. A Store holds queryable race records: the embedded file store for a
+// single track, or Postgres for hosted multi-track services. An Archive
+// holds cold blobs such as event journals and exports: a local directory,
+// or an S3/GCS bucket through the application's SDK client. Every Store
+// here is also a ProfileStore for named settings such as autostart
+// profiles. Migrate and MigrateArchive copy everything from one backend to
+// another, and Prune deletes races past their Retention period.
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/benharold/libdrag/pkg/tags"
+)
+
+// ErrNotFound is returned when a race or object does not exist
+var ErrNotFound = errors.New("not found")
+
+// Record is a stored race. Data holds the race document (status, results,
+// decision) as JSON; the other fields are indexed for queries.
+type Record struct {
+	RaceID    string          `json:"race_id"`
+	Track     string          `json:"track,omitempty"` // Facility the race ran at, for multi-track stores
+	SessionID string          `json:"session_id,omitempty"`
+	Class     string          `json:"class,omitempty"`
+	State     string          `json:"state"`
+	Tags      []string        `json:"tags,omitempty"` // Normalized run tags (see pkg/tags)
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// Filter selects races, oldest first. Empty fields match everything.
+type Filter struct {
+	Track     string
+	SessionID string
+	Class     string
+	Tags      tags.Filter // Tags the race must have, and must not
+	Since     time.Time   // Created at or after
+	Offset    int
+	Limit     int // Zero for no limit
+}
+
+// matches reports whether a record passes the filter's field conditions
+func (f Filter) matches(r Record) bool {
+	return (f.Track == "" || r.Track == f.Track) &&
+		(f.SessionID == "" || r.SessionID == f.SessionID) &&
+		(f.Class == "" || r.Class == f.Class) &&
+		f.Tags.Matches(r.Tags) &&
+		(f.Since.IsZero() || !r.CreatedAt.Before(f.Since))
+}
+
+// TagRace adds and removes a stored race's tags, returning the updated
+// record
+func TagRace(ctx context.Context, store Store, raceID string, add, remove []string) (Record, error) {
+	record, err := store.GetRace(ctx, raceID)
+	if err != nil {
+		return Record{}, err
+	}
+	if record.Tags, err = tags.Update(record.Tags, add, remove); err != nil {
+		return Record{}, err
+	}
+	if err := store.PutRace(ctx, record); err != nil {
+		return Record{}, err
+	}
+	return record, nil
+}
+
+// Store keeps race records. PutRace replaces any record with the same race
+// ID; DeleteRace returns ErrNotFound for a race that is not stored.
+type Store interface {
+	PutRace(ctx context.Context, record Record) error
+	GetRace(ctx context.Context, raceID string) (Record, error)
+	ListRaces(ctx context.Context, filter Filter) ([]Record, error)
+	DeleteRace(ctx context.Context, raceID string) error
+	Close() error
+}
+
+// Profile is a named settings document edited by race directors, such as
+// an autostart profile. Kind groups profiles ("autostart"); Data holds the
+// settings as JSON.
+type Profile struct {
+	Kind      string          `json:"kind"`
+	Name      string          `json:"name"`
+	UpdatedAt time.Time       `json:"updated_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// ProfileStore keeps profiles. PutProfile replaces any profile of the same
+// kind and name, and ListProfiles returns a kind's profiles by name.
+type ProfileStore interface {
+	PutProfile(ctx context.Context, profile Profile) error
+	GetProfile(ctx context.Context, kind, name string) (Profile, error)
+	ListProfiles(ctx context.Context, kind string) ([]Profile, error)
+	DeleteProfile(ctx context.Context, kind, name string) error
+}
+
+// Archive keeps blobs by key, e.g. "journals/{race}.json". DeleteObject
+// returns ErrNotFound for a missing key.
+type Archive interface {
+	PutObject(ctx context.Context, key string, data []byte) error
+	GetObject(ctx context.Context, key string) ([]byte, error)
+	ListObjects(ctx context.Context, prefix string) ([]string, error)
+	DeleteObject(ctx context.Context, key string) error
+}
+
+// migratePageSize is how many records Migrate reads at a time
+const migratePageSize = 500
+
+// Migrate copies every race record from src to dst and returns how many
+// were copied. Records already in dst are overwritten, so an interrupted
+// migration can simply be run again.
+func Migrate(ctx context.Context, src, dst Store) (int, error) {
+	copied := 0
+	for {
+		page, err := src.ListRaces(ctx, Filter{Offset: copied, Limit: migratePageSize})
+		if err != nil {
+			return copied, err
+		}
+		for _, record := range page {
+			if err := dst.PutRace(ctx, record); err != nil {
+				return copied, err
+			}
+			copied++
+		}
+		if len(page) < migratePageSize {
+			return copied, nil
+		}
+	}
+}
+
+// MigrateArchive copies every object under prefix from src to dst and
+// returns how many were copied
+func MigrateArchive(ctx context.Context, src, dst Archive, prefix string) (int, error) {
+	keys, err := src.ListObjects(ctx, prefix)
+	if err != nil {
+		return 0, err
+	}
+	for i, key := range keys {
+		data, err := src.GetObject(ctx, key)
+		if err != nil {
+			return i, err
+		}
+		if err := dst.PutObject(ctx, key, data); err != nil {
+			return i, err
+		}
+	}
+	return len(keys), nil
+}
@@ -0,0 +1,333 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/benharold/libdrag/pkg/tags"
+)
+
+func testRecords(n int) []Record {
+	start := time.Date(2025, time.June, 7, 18, 0, 0, 0, time.UTC)
+	records := make([]Record, n)
+	for i := range records {
+		records[i] = Record{
+			RaceID:    fmt.Sprintf("race-%03d", i),
+			Track:     "track-1",
+			SessionID: fmt.Sprintf("session-%d", i%2),
+			Class:     "Super Pro",
+			State:     "complete",
+			CreatedAt: start.Add(time.Duration(i) * time.Minute),
+			Data:      json.RawMessage(fmt.Sprintf(`{"pair":%d}`, i)),
+		}
+	}
+	return records
+}
+
+func TestFileStorePersists(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store, err := OpenFileStore(dir)
+	if err != nil {
+		t.Fatalf("OpenFileStore failed: %v", err)
+	}
+	for _, record := range testRecords(5) {
+		if err := store.PutRace(ctx, record); err != nil {
+			t.Fatalf("PutRace failed: %v", err)
+		}
+	}
+	if err := store.PutRace(ctx, Record{RaceID: "../escape"}); err == nil {
+		t.Error("Expected error for a race ID outside the store")
+	}
+
+	reopened, err := OpenFileStore(dir)
+	if err != nil {
+		t.Fatalf("Reopen failed: %v", err)
+	}
+	record, err := reopened.GetRace(ctx, "race-003")
+	if err != nil || string(record.Data) != `{"pair":3}` {
+		t.Errorf("Expected race-003 after reopening, got %+v, %v", record, err)
+	}
+	if _, err := reopened.GetRace(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+
+	page, _ := reopened.ListRaces(ctx, Filter{SessionID: "session-1", Limit: 1, Offset: 1})
+	if len(page) != 1 || page[0].RaceID != "race-003" {
+		t.Errorf("Expected the second session-1 race, got %+v", page)
+	}
+}
+
+func TestTagRace(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store, err := OpenFileStore(dir)
+	if err != nil {
+		t.Fatalf("OpenFileStore failed: %v", err)
+	}
+	for _, record := range testRecords(4) {
+		if err := store.PutRace(ctx, record); err != nil {
+			t.Fatalf("PutRace failed: %v", err)
+		}
+	}
+	for _, raceID := range []string{"race-000", "race-001", "race-002"} {
+		if _, err := TagRace(ctx, store, raceID, []string{"Qualifying"}, nil); err != nil {
+			t.Fatalf("TagRace failed: %v", err)
+		}
+	}
+	record, err := TagRace(ctx, store, "race-001", []string{"rain-shortened"}, nil)
+	if err != nil || !reflect.DeepEqual(record.Tags, []string{"qualifying", "rain-shortened"}) {
+		t.Errorf("Expected race-001 tagged, got %v, %v", record.Tags, err)
+	}
+	if _, err := TagRace(ctx, store, "race-002", nil, []string{"qualifying"}); err != nil {
+		t.Fatalf("TagRace failed: %v", err)
+	}
+	if _, err := TagRace(ctx, store, "missing", []string{"qualifying"}, nil); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+
+	reopened, err := OpenFileStore(dir)
+	if err != nil {
+		t.Fatalf("Reopen failed: %v", err)
+	}
+	raceIDs := func(filter Filter) []string {
+		records, _ := reopened.ListRaces(ctx, filter)
+		var ids []string
+		for _, record := range records {
+			ids = append(ids, record.RaceID)
+		}
+		return ids
+	}
+	if ids := raceIDs(Filter{Tags: tags.Filter{Tags: []string{"QUALIFYING"}}}); !reflect.DeepEqual(ids, []string{"race-000", "race-001"}) {
+		t.Errorf("Expected the qualifying races, got %v", ids)
+	}
+	if ids := raceIDs(Filter{Tags: tags.Filter{Tags: []string{"qualifying"}, Exclude: []string{"rain-shortened"}}}); !reflect.DeepEqual(ids, []string{"race-000"}) {
+		t.Errorf("Expected the full-length qualifying race, got %v", ids)
+	}
+	if ids := raceIDs(Filter{Tags: tags.Filter{Exclude: []string{"qualifying"}}}); !reflect.DeepEqual(ids, []string{"race-002", "race-003"}) {
+		t.Errorf("Expected the untagged races, got %v", ids)
+	}
+}
+
+func TestFileStoreProfiles(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store, err := OpenFileStore(dir)
+	if err != nil {
+		t.Fatalf("OpenFileStore failed: %v", err)
+	}
+	for _, name := range []string{"test-and-tune", "bracket"} {
+		profile := Profile{Kind: "autostart", Name: name, Data: json.RawMessage(`{"name":"` + name + `"}`)}
+		if err := store.PutProfile(ctx, profile); err != nil {
+			t.Fatalf("PutProfile failed: %v", err)
+		}
+	}
+	if err := store.PutProfile(ctx, Profile{Kind: "autostart", Name: "../escape"}); err == nil {
+		t.Error("Expected error for a profile outside the store")
+	}
+
+	reopened, err := OpenFileStore(dir)
+	if err != nil {
+		t.Fatalf("Reopen failed: %v", err)
+	}
+	profiles, _ := reopened.ListProfiles(ctx, "autostart")
+	if len(profiles) != 2 || profiles[0].Name != "bracket" || string(profiles[1].Data) != `{"name":"test-and-tune"}` {
+		t.Fatalf("Expected both profiles by name after reopening, got %+v", profiles)
+	}
+	if races, _ := reopened.ListRaces(ctx, Filter{}); len(races) != 0 {
+		t.Errorf("Profiles should not be read as races, got %+v", races)
+	}
+
+	if err := reopened.DeleteProfile(ctx, "autostart", "bracket"); err != nil {
+		t.Fatalf("DeleteProfile failed: %v", err)
+	}
+	if _, err := reopened.GetProfile(ctx, "autostart", "bracket"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound after delete, got %v", err)
+	}
+	if err := reopened.DeleteProfile(ctx, "autostart", "bracket"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound deleting twice, got %v", err)
+	}
+	if again, _ := OpenFileStore(dir); len(again.memory.profiles) != 1 {
+		t.Error("Expected the deleted profile's file removed")
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	ctx := context.Background()
+	src := NewMemoryStore()
+	records := testRecords(migratePageSize + 20)
+	for _, record := range records {
+		src.PutRace(ctx, record)
+	}
+
+	dst, err := OpenFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("OpenFileStore failed: %v", err)
+	}
+	copied, err := Migrate(ctx, src, dst)
+	if err != nil || copied != len(records) {
+		t.Fatalf("Expected %d races migrated, got %d, %v", len(records), copied, err)
+	}
+	all, _ := dst.ListRaces(ctx, Filter{})
+	if !reflect.DeepEqual(all, records) {
+		t.Error("Migrated races differ from the source")
+	}
+}
+
+// memoryObjects is an ObjectClient standing in for an S3/GCS SDK
+type memoryObjects struct {
+	mu      sync.Mutex
+	objects map[string][]byte // bucket/key -> data
+}
+
+func (m *memoryObjects) PutObject(_ context.Context, bucket, key string, data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.objects[bucket+"/"+key] = data
+	return nil
+}
+
+func (m *memoryObjects) GetObject(_ context.Context, bucket, key string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, ok := m.objects[bucket+"/"+key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return data, nil
+}
+
+func (m *memoryObjects) DeleteObject(_ context.Context, bucket, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.objects[bucket+"/"+key]; !ok {
+		return ErrNotFound
+	}
+	delete(m.objects, bucket+"/"+key)
+	return nil
+}
+
+func (m *memoryObjects) ListObjects(_ context.Context, bucket, prefix string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var keys []string
+	for path := range m.objects {
+		if key := strings.TrimPrefix(path, bucket+"/"); key != path && strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func TestMigrateArchiveToBucket(t *testing.T) {
+	ctx := context.Background()
+	src := NewDirArchive(t.TempDir())
+	if keys, err := src.ListObjects(ctx, ""); err != nil || len(keys) != 0 {
+		t.Fatalf("Expected an empty archive, got %v, %v", keys, err)
+	}
+	src.PutObject(ctx, "journals/race-1.json", []byte(`[1]`))
+	src.PutObject(ctx, "journals/race-2.json", []byte(`[2]`))
+	src.PutObject(ctx, "exports/race-1.json", []byte(`{}`))
+	if err := src.PutObject(ctx, "../outside", nil); err == nil {
+		t.Error("Expected error for a key outside the archive")
+	}
+
+	client := &memoryObjects{objects: make(map[string][]byte)}
+	dst := NewBucketArchive(client, "archive", "track-1/")
+	copied, err := MigrateArchive(ctx, src, dst, "journals/")
+	if err != nil || copied != 2 {
+		t.Fatalf("Expected 2 journals migrated, got %d, %v", copied, err)
+	}
+	if data, err := dst.GetObject(ctx, "journals/race-2.json"); err != nil || string(data) != `[2]` {
+		t.Errorf("Expected journal in the bucket, got %s, %v", data, err)
+	}
+	if _, ok := client.objects["archive/track-1/journals/race-1.json"]; !ok {
+		t.Error("Expected objects stored under the archive prefix")
+	}
+	if keys, _ := dst.ListObjects(ctx, ""); !reflect.DeepEqual(keys, []string{"journals/race-1.json", "journals/race-2.json"}) {
+		t.Errorf("Unexpected bucket keys %v", keys)
+	}
+	if err := dst.DeleteObject(ctx, "journals/race-1.json"); err != nil {
+		t.Fatalf("DeleteObject failed: %v", err)
+	}
+	if err := dst.DeleteObject(ctx, "journals/race-1.json"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound deleting twice, got %v", err)
+	}
+	if err := src.DeleteObject(ctx, "journals/race-2.json"); err != nil {
+		t.Fatalf("DeleteObject failed: %v", err)
+	}
+	if _, err := src.GetObject(ctx, "journals/race-2.json"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected the journal file removed, got %v", err)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store, err := OpenFileStore(dir)
+	if err != nil {
+		t.Fatalf("OpenFileStore failed: %v", err)
+	}
+	records := testRecords(4)
+	records[1].Class = "Junior Dragster"
+	records[3].Class = "Junior Dragster"
+	for _, record := range records {
+		store.PutRace(ctx, record)
+	}
+
+	// Junior Dragster races are kept 90 seconds, everything else 3 minutes
+	retention := Retention{MaxAge: 3 * time.Minute, Classes: map[string]time.Duration{"Junior Dragster": 90 * time.Second}}
+	now := records[0].CreatedAt.Add(3*time.Minute + time.Second)
+	pruned, err := Prune(ctx, store, Filter{Track: "track-1"}, retention, now)
+	if err != nil || !reflect.DeepEqual(pruned, []string{"race-000", "race-001"}) {
+		t.Fatalf("Expected race-000 and race-001 pruned, got %v, %v", pruned, err)
+	}
+	reopened, _ := OpenFileStore(dir)
+	if races, _ := reopened.ListRaces(ctx, Filter{}); len(races) != 2 || races[0].RaceID != "race-002" {
+		t.Errorf("Expected the pruned files removed, got %+v", races)
+	}
+	if err := store.DeleteRace(ctx, "race-000"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound deleting a pruned race, got %v", err)
+	}
+
+	if pruned, _ := Prune(ctx, store, Filter{}, Retention{}, now.Add(24*time.Hour)); len(pruned) != 0 {
+		t.Errorf("Expected no retention period to keep everything, got %v", pruned)
+	}
+	if _, err := Prune(ctx, store, Filter{}, Retention{MaxAge: -time.Hour}, now); err == nil {
+		t.Error("Expected a negative retention period to be rejected")
+	}
+}
+
+func TestPostgresListQuery(t *testing.T) {
+	since := time.Date(2025, time.June, 7, 0, 0, 0, 0, time.UTC)
+	query, args := listQuery(Filter{Track: "track-1", Class: "Super Pro", Since: since, Limit: 50, Offset: 100})
+
+	expected := "SELECT " + recordColumns + " FROM libdrag_races" +
+		" WHERE track = $1 AND class = $2 AND created_at >= $3 ORDER BY created_at, race_id LIMIT $4 OFFSET $5"
+	if query != expected {
+		t.Errorf("Unexpected query:\n%s", query)
+	}
+	if !reflect.DeepEqual(args, []interface{}{"track-1", "Super Pro", since, 50, 100}) {
+		t.Errorf("Unexpected args %v", args)
+	}
+
+	query, args = listQuery(Filter{Tags: tags.Filter{Tags: []string{"Qualifying"}, Exclude: []string{"rain-shortened"}}})
+	expected = "SELECT " + recordColumns + " FROM libdrag_races" +
+		" WHERE race_id IN (SELECT race_id FROM libdrag_race_tags WHERE tag = $1)" +
+		" AND race_id NOT IN (SELECT race_id FROM libdrag_race_tags WHERE tag = $2) ORDER BY created_at, race_id"
+	if query != expected {
+		t.Errorf("Unexpected tag query:\n%s", query)
+	}
+	if !reflect.DeepEqual(args, []interface{}{"qualifying", "rain-shortened"}) {
+		t.Errorf("Unexpected tag args %v", args)
+	}
+}
@@ -0,0 +1,113 @@
+// Package tags labels runs with free-form tags (a test pass, qualifying, an
+// exhibition, a rain-shortened session) and selects runs by them. Tags are
+// compared in their normal form: trimmed and lower case, so "Qualifying"
+// and " qualifying" are the same tag. It depends only on the standard
+// library, so storage, exports and analytics can share it.
+package tags
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Tags in common use. Any other tag is accepted.
+const (
+	TestPass      = "test-pass"
+	Qualifying    = "qualifying"
+	Exhibition    = "exhibition"
+	RainShortened = "rain-shortened"
+)
+
+// Normalize returns tags trimmed, lower case, sorted and without
+// duplicates. A tag that is empty or holds a comma (the separator in query
+// strings) is rejected.
+func Normalize(tags []string) ([]string, error) {
+	if len(tags) == 0 {
+		return nil, nil
+	}
+	seen := make(map[string]bool, len(tags))
+	normal := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" {
+			return nil, fmt.Errorf("tags cannot be empty")
+		}
+		if strings.Contains(tag, ",") {
+			return nil, fmt.Errorf("tag %q cannot contain a comma", tag)
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			normal = append(normal, tag)
+		}
+	}
+	sort.Strings(normal)
+	return normal, nil
+}
+
+// Split parses a comma-separated list of tags, as given in a query string
+func Split(list string) []string {
+	if strings.TrimSpace(list) == "" {
+		return nil
+	}
+	return strings.Split(list, ",")
+}
+
+// Update returns tags with add added and remove removed, normalized
+func Update(tags, add, remove []string) ([]string, error) {
+	removed, err := Normalize(remove)
+	if err != nil {
+		return nil, err
+	}
+	updated, err := Normalize(append(append([]string(nil), tags...), add...))
+	if err != nil {
+		return nil, err
+	}
+	kept := updated[:0]
+	for _, tag := range updated {
+		if !Has(removed, tag) {
+			kept = append(kept, tag)
+		}
+	}
+	if len(kept) == 0 {
+		return nil, nil
+	}
+	return kept, nil
+}
+
+// Has reports whether tags holds tag, in any case
+func Has(tags []string, tag string) bool {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	for _, t := range tags {
+		if strings.ToLower(strings.TrimSpace(t)) == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// Filter selects runs by their tags. The zero Filter matches every run.
+type Filter struct {
+	Tags    []string `json:"tags,omitempty"`         // The run must have every one of these
+	Exclude []string `json:"exclude_tags,omitempty"` // The run must have none of these
+}
+
+// IsZero reports whether the filter matches every run
+func (f Filter) IsZero() bool {
+	return len(f.Tags) == 0 && len(f.Exclude) == 0
+}
+
+// Matches reports whether a run with tags passes the filter
+func (f Filter) Matches(tags []string) bool {
+	for _, tag := range f.Tags {
+		if !Has(tags, tag) {
+			return false
+		}
+	}
+	for _, tag := range f.Exclude {
+		if Has(tags, tag) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,56 @@
+package tags
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	normal, err := Normalize([]string{" Qualifying", "exhibition", "qualifying", "Rain-Shortened"})
+	if err != nil {
+		t.Fatalf("Normalize failed: %v", err)
+	}
+	if expected := []string{Exhibition, Qualifying, RainShortened}; !reflect.DeepEqual(normal, expected) {
+		t.Errorf("Expected %v, got %v", expected, normal)
+	}
+	for _, bad := range [][]string{{""}, {"  "}, {"test,pass"}} {
+		if _, err := Normalize(bad); err == nil {
+			t.Errorf("Expected %q to be rejected", bad)
+		}
+	}
+	if normal, _ := Normalize(Split("")); normal != nil {
+		t.Errorf("Expected no tags from an empty list, got %v", normal)
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	updated, err := Update([]string{Qualifying, TestPass}, []string{"Exhibition"}, []string{"TEST-PASS"})
+	if err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if expected := []string{Exhibition, Qualifying}; !reflect.DeepEqual(updated, expected) {
+		t.Errorf("Expected %v, got %v", expected, updated)
+	}
+	if updated, _ := Update([]string{Qualifying}, nil, []string{Qualifying}); updated != nil {
+		t.Errorf("Expected no tags left, got %v", updated)
+	}
+}
+
+func TestFilter(t *testing.T) {
+	run := []string{Qualifying, RainShortened}
+	tests := []struct {
+		filter  Filter
+		matches bool
+	}{
+		{Filter{}, true},
+		{Filter{Tags: []string{"Qualifying"}}, true},
+		{Filter{Tags: []string{Qualifying, Exhibition}}, false},
+		{Filter{Exclude: []string{TestPass}}, true},
+		{Filter{Tags: []string{Qualifying}, Exclude: []string{RainShortened}}, false},
+	}
+	for _, test := range tests {
+		if got := test.filter.Matches(run); got != test.matches {
+			t.Errorf("%+v: expected %v, got %v", test.filter, test.matches, got)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package timers
+
+import "time"
+
+// Clock is the time source and timer scheduler libdrag components run on.
+// A wheel from NewWheel is the real clock; a wheel from NewVirtualWheel is
+// a simulated one that only moves when advanced, so races run
+// deterministically and faster than real time.
+type Clock interface {
+	Now() time.Time
+	AfterFunc(d time.Duration, label Label, f func()) *Timer
+	Sleep(d time.Duration, label Label)
+	NewTicker(interval time.Duration, label Label) *Ticker
+}
+
+var _ Clock = (*Wheel)(nil)
+
+// Or returns clock, or the default wheel when clock is nil. Components keep
+// an optional injected clock and read it through Or, so one without a clock
+// follows SetDefault.
+func Or(clock Clock) Clock {
+	if clock != nil {
+		return clock
+	}
+	return Default()
+}
+
+// SleepOrDone blocks for d on clock as a labeled timer, like Sleep, or until
+// done is closed, whichever comes first. It reports whether the whole of d
+// elapsed; a sleep cut short stops its timer, so nothing is left pending.
+func SleepOrDone(clock Clock, d time.Duration, label Label, done <-chan struct{}) bool {
+	select {
+	case <-done:
+		return false
+	default:
+	}
+	elapsed := make(chan struct{})
+	timer := clock.AfterFunc(d, label, func() { close(elapsed) })
+	select {
+	case <-elapsed:
+		return true
+	case <-done:
+		timer.Stop()
+		return false
+	}
+}
@@ -0,0 +1,55 @@
+package timers
+
+import "time"
+
+// Source says where a beam or timing timestamp came from
+type Source string
+
+const (
+	SourceHardware  Source = "hardware"  // Latched by the timing controller when the beam changed
+	SourceHost      Source = "host"      // Read from the host clock when the input arrived
+	SourceSimulated Source = "simulated" // Generated by a simulation
+	SourceManual    Source = "manual"    // Entered by an official (hand-timed or backup times)
+)
+
+// DegradedUncertainty is the most a timestamp may be off and still be as
+// accurate as the thousandths results are published in (seconds)
+const DegradedUncertainty = 0.001
+
+// Default uncertainties of each source (seconds)
+var defaultUncertainty = map[Source]float64{
+	SourceHardware:  0.0001,
+	SourceHost:      0.001,
+	SourceSimulated: 0,
+	SourceManual:    0.2, // A stopwatch is only as quick as the official's thumb
+}
+
+// Accuracy labels timestamps with their source and estimated uncertainty
+type Accuracy struct {
+	Source      Source  `json:"source"`
+	Uncertainty float64 `json:"uncertainty"` // Seconds either side of the true time
+}
+
+// AccuracyOf returns a source's accuracy with its default uncertainty
+func AccuracyOf(source Source) Accuracy {
+	return Accuracy{Source: source, Uncertainty: defaultUncertainty[source]}
+}
+
+// Degraded reports whether timestamps may be off by more than the
+// published resolution
+func (a Accuracy) Degraded() bool {
+	return a.Uncertainty > DegradedUncertainty
+}
+
+// Duration returns the uncertainty as a duration
+func (a Accuracy) Duration() time.Duration {
+	return time.Duration(a.Uncertainty * float64(time.Second))
+}
+
+// Worst returns the less accurate of a and b
+func Worst(a, b Accuracy) Accuracy {
+	if b.Uncertainty > a.Uncertainty || a.Source == "" {
+		return b
+	}
+	return a
+}
@@ -0,0 +1,56 @@
+package timers
+
+import (
+	"sync"
+	"time"
+)
+
+// Ticker delivers the wheel's time on C every interval. Like time.Ticker it
+// drops ticks a slow reader misses.
+type Ticker struct {
+	C <-chan time.Time
+
+	c        chan time.Time
+	wheel    *Wheel
+	interval time.Duration
+	label    Label
+
+	mu      sync.Mutex
+	timer   *Timer
+	stopped bool
+}
+
+// NewTicker starts a ticker on the wheel
+func (w *Wheel) NewTicker(interval time.Duration, label Label) *Ticker {
+	if interval <= 0 {
+		panic("timers: non-positive interval for NewTicker")
+	}
+	c := make(chan time.Time, 1)
+	t := &Ticker{C: c, c: c, wheel: w, interval: interval, label: label}
+	t.mu.Lock()
+	t.timer = w.AfterFunc(interval, label, t.tick)
+	t.mu.Unlock()
+	return t
+}
+
+// Stop turns off the ticker. No more ticks are sent after it returns.
+func (t *Ticker) Stop() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.stopped = true
+	t.timer.Stop()
+}
+
+// tick sends the current time and schedules the next tick
+func (t *Ticker) tick() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.stopped {
+		return
+	}
+	select {
+	case t.c <- t.wheel.Now():
+	default:
+	}
+	t.timer = t.wheel.AfterFunc(t.interval, t.label, t.tick)
+}
@@ -0,0 +1,542 @@
+// Package timers provides a shared hierarchical timer wheel for the many
+// short race timers (staging timeouts, random start delays, tree steps,
+// beam debounce). One goroutine drives every timer on a wheel instead of a
+// runtime timer per use, and pending timers can be listed for dashboards.
+//
+// A virtual wheel (NewVirtualWheel) has no goroutine and its own clock,
+// moved only by Advance or Step, so tests installing it with SetDefault run
+// the staging, tree and timing flow without real sleeps.
+package timers
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultTick is the resolution of the default wheel
+const DefaultTick = time.Millisecond
+
+// Wheel geometry: a 256-slot first level, then three 64-slot levels, each
+// slot spanning a full turn of the level below. With a 1 ms tick the wheel
+// covers about 18 hours; longer timers are re-placed as the wheel turns.
+const (
+	level0Bits = 8
+	levelBits  = 6
+	levels     = 4
+	level0Size = 1 << level0Bits
+	levelSize  = 1 << levelBits
+	maxSpan    = 1 << (level0Bits + (levels-1)*levelBits)
+)
+
+// Label identifies what a timer is for
+type Label struct {
+	Name   string `json:"name"`              // e.g. "autostart.staging_timeout"
+	RaceID string `json:"race_id,omitempty"` // Race the timer belongs to, if any
+}
+
+// Info describes a pending timer
+type Info struct {
+	ID        uint64        `json:"id"`
+	Label     Label         `json:"label"`
+	Deadline  time.Time     `json:"deadline"`
+	Remaining time.Duration `json:"remaining"`
+}
+
+// Metrics summarizes a wheel's activity since it was created
+type Metrics struct {
+	Scheduled   uint64        `json:"scheduled"`
+	Fired       uint64        `json:"fired"`
+	Canceled    uint64        `json:"canceled"`
+	Pending     int           `json:"pending"`
+	MaxLateness time.Duration `json:"max_lateness"` // Worst delay between a deadline and its callback
+}
+
+// Timer is a single scheduled callback
+type Timer struct {
+	wheel    *Wheel
+	id       uint64
+	label    Label
+	deadline time.Time
+	expires  uint64 // Tick the timer fires on
+	f        func()
+	done     bool // Fired or stopped
+}
+
+// Stop cancels the timer. It returns false if the timer already fired or
+// was stopped.
+func (t *Timer) Stop() bool {
+	if t == nil {
+		return false
+	}
+	w := t.wheel
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if t.done {
+		return false
+	}
+	t.done = true
+	delete(w.pending, t.id)
+	w.metrics.Canceled++
+	return true
+}
+
+// Wheel schedules timers on a hierarchical timing wheel driven by a single
+// goroutine. Callbacks run one at a time on that goroutine, so they must
+// not block; hand long work to a goroutine of its own.
+type Wheel struct {
+	mu      sync.Mutex
+	tick    time.Duration
+	start   time.Time
+	virtual bool
+	now     time.Time  // Virtual clock
+	added   *sync.Cond // Signaled as timers are scheduled, for BlockUntil
+	next    uint64     // Next tick to process
+	slots   [levels][][]*Timer
+	count0  int // Entries in the first level, so empty turns can be skipped
+	pending map[uint64]*Timer
+	nextID  uint64
+	metrics Metrics
+	running bool
+	hook    func(Label) // Called after each callback, for tests
+	wake    chan struct{}
+	done    chan struct{}
+}
+
+// NewWheel creates a wheel with the given tick resolution. Its goroutine
+// starts with the first timer.
+func NewWheel(tick time.Duration) *Wheel {
+	if tick <= 0 {
+		tick = DefaultTick
+	}
+	w := &Wheel{
+		tick:    tick,
+		start:   time.Now(),
+		pending: make(map[uint64]*Timer),
+		wake:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+	w.added = sync.NewCond(&w.mu)
+	w.slots[0] = make([][]*Timer, level0Size)
+	for level := 1; level < levels; level++ {
+		w.slots[level] = make([][]*Timer, levelSize)
+	}
+	return w
+}
+
+// NewVirtualWheel creates a wheel whose clock starts at start and only
+// moves when Advance or Step is called. Timers fire on the goroutine
+// calling Advance or Step.
+func NewVirtualWheel(start time.Time, tick time.Duration) *Wheel {
+	w := NewWheel(tick)
+	w.virtual = true
+	w.start = start
+	w.now = start
+	return w
+}
+
+var defaultWheel atomic.Pointer[Wheel]
+
+// Default returns the process-wide wheel shared by libdrag components
+func Default() *Wheel {
+	if w := defaultWheel.Load(); w != nil {
+		return w
+	}
+	defaultWheel.CompareAndSwap(nil, NewWheel(DefaultTick))
+	return defaultWheel.Load()
+}
+
+// SetDefault replaces the process-wide wheel, typically with a virtual
+// wheel in tests, and returns a function restoring the previous one.
+// Timers already scheduled stay on the wheel they were scheduled on.
+func SetDefault(w *Wheel) (restore func()) {
+	previous := defaultWheel.Swap(w)
+	return func() {
+		defaultWheel.Store(previous)
+	}
+}
+
+// Now returns the current time on the default wheel's clock
+func Now() time.Time {
+	return Default().Now()
+}
+
+// Now returns the wheel's current time: the wall clock, or the virtual
+// clock of a virtual wheel
+func (w *Wheel) Now() time.Time {
+	if !w.virtual {
+		return time.Now()
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.now
+}
+
+// clock returns the current time. Caller holds w.mu.
+func (w *Wheel) clock() time.Time {
+	if w.virtual {
+		return w.now
+	}
+	return time.Now()
+}
+
+// AfterFunc calls f on the wheel goroutine once d has elapsed
+func (w *Wheel) AfterFunc(d time.Duration, label Label, f func()) *Timer {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.nextID++
+	deadline := w.clock().Add(d)
+	t := &Timer{
+		wheel:    w,
+		id:       w.nextID,
+		label:    label,
+		deadline: deadline,
+		expires:  w.tickFor(deadline),
+		f:        f,
+	}
+	w.pending[t.id] = t
+	w.metrics.Scheduled++
+	w.place(t)
+	w.added.Broadcast()
+
+	if w.virtual {
+		return t
+	}
+	if !w.running {
+		w.running = true
+		go w.run()
+	}
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+	return t
+}
+
+// Sleep blocks the calling goroutine for d as a labeled timer, so sequences
+// written as straight-line code still show up in Pending. On a virtual
+// wheel it returns once another goroutine advances the clock past d.
+func (w *Wheel) Sleep(d time.Duration, label Label) {
+	done := make(chan struct{})
+	w.AfterFunc(d, label, func() { close(done) })
+	<-done
+}
+
+// Pending lists the timers waiting to fire, soonest first
+func (w *Wheel) Pending() []Info {
+	w.mu.Lock()
+	infos := make([]Info, 0, len(w.pending))
+	for _, t := range w.pending {
+		infos = append(infos, Info{ID: t.id, Label: t.label, Deadline: t.deadline})
+	}
+	now := w.clock()
+	w.mu.Unlock()
+
+	for i := range infos {
+		infos[i].Remaining = infos[i].Deadline.Sub(now)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Deadline.Before(infos[j].Deadline)
+	})
+	return infos
+}
+
+// Metrics returns the wheel's counters
+func (w *Wheel) Metrics() Metrics {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	metrics := w.metrics
+	metrics.Pending = len(w.pending)
+	return metrics
+}
+
+// Advance moves a virtual wheel's clock forward by d, firing every timer
+// due on the way in deadline order with the clock set to its tick. Timers
+// scheduled by those callbacks fire too if they fall within d.
+func (w *Wheel) Advance(d time.Duration) {
+	if !w.virtual {
+		panic("timers: Advance on a wheel driven by the wall clock")
+	}
+	w.mu.Lock()
+	target := w.now.Add(d)
+	w.mu.Unlock()
+
+	for w.step(target, true) {
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if target.After(w.now) {
+		w.now = target
+	}
+}
+
+// Step moves a virtual wheel's clock to the soonest pending timer and fires
+// the timers due then. It returns false if nothing was pending.
+func (w *Wheel) Step() bool {
+	if !w.virtual {
+		panic("timers: Step on a wheel driven by the wall clock")
+	}
+	return w.step(time.Time{}, false)
+}
+
+// step fires the timers due at the soonest pending tick, unless bounded
+// and that is after limit
+func (w *Wheel) step(limit time.Time, bounded bool) bool {
+	w.mu.Lock()
+	soonest, ok := w.earliest()
+	if !ok || (bounded && soonest.After(limit)) {
+		w.mu.Unlock()
+		return false
+	}
+	if soonest.After(w.now) {
+		w.now = soonest
+	}
+	now := w.now
+	fired := w.advance(w.dueTick(now))
+	w.mu.Unlock()
+
+	w.fire(fired, now)
+	return true
+}
+
+// SetFireHook calls hook on the firing goroutine after each callback, before
+// the next. A test driving a virtual wheel uses it to let the goroutines a
+// callback woke settle, so timers due at the same time play out one at a
+// time, in label order.
+func (w *Wheel) SetFireHook(hook func(Label)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.hook = hook
+}
+
+// BlockUntil waits until at least n timers are pending, so a test knows the
+// goroutines it started have reached their next sleep before advancing
+func (w *Wheel) BlockUntil(n int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for len(w.pending) < n {
+		w.added.Wait()
+	}
+}
+
+// Stop ends the wheel goroutine. Pending timers never fire.
+func (w *Wheel) Stop() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	select {
+	case <-w.done:
+	default:
+		close(w.done)
+	}
+}
+
+// tickFor returns the first tick at or after t
+func (w *Wheel) tickFor(t time.Time) uint64 {
+	elapsed := t.Sub(w.start)
+	if elapsed <= 0 {
+		return 0
+	}
+	return uint64((elapsed + w.tick - 1) / w.tick)
+}
+
+// dueTick returns the last tick at or before now. A timer fires once its
+// tick is due, so never before its deadline and at most a tick late.
+func (w *Wheel) dueTick(now time.Time) uint64 {
+	elapsed := now.Sub(w.start)
+	if elapsed <= 0 {
+		return 0
+	}
+	return uint64(elapsed / w.tick)
+}
+
+// place puts a timer in the slot for its expiry. Caller holds w.mu.
+func (w *Wheel) place(t *Timer) {
+	expires := t.expires
+	if expires < w.next {
+		expires = w.next // Already due; fire on the next tick processed
+	}
+	delta := expires - w.next
+	if delta >= maxSpan {
+		expires = w.next + maxSpan - 1 // Re-placed when the top level cascades
+		delta = maxSpan - 1
+	}
+
+	if delta < level0Size {
+		index := expires & (level0Size - 1)
+		w.slots[0][index] = append(w.slots[0][index], t)
+		w.count0++
+		return
+	}
+	for level := 1; level < levels; level++ {
+		shift := uint(level0Bits + (level-1)*levelBits)
+		if delta < 1<<(shift+levelBits) || level == levels-1 {
+			index := (expires >> shift) & (levelSize - 1)
+			w.slots[level][index] = append(w.slots[level][index], t)
+			return
+		}
+	}
+}
+
+// advance processes every tick up to and including target and returns the
+// timers that fired. Caller holds w.mu.
+func (w *Wheel) advance(target uint64) []*Timer {
+	var fired []*Timer
+	for w.next <= target {
+		if len(w.pending) == 0 {
+			w.next = target + 1 // Nothing scheduled; skip idle ticks
+			break
+		}
+		tick := w.next
+
+		// Jump to the end of the turn when the first level is empty
+		if w.count0 == 0 && tick&(level0Size-1) != 0 {
+			w.next = (tick | (level0Size - 1)) + 1
+			if w.next > target+1 {
+				w.next = target + 1
+			}
+			continue
+		}
+
+		// Cascade higher levels down as each lower level completes a turn
+		if tick&(level0Size-1) == 0 {
+			for level := 1; level < levels; level++ {
+				shift := uint(level0Bits + (level-1)*levelBits)
+				index := (tick >> shift) & (levelSize - 1)
+				w.cascade(level, int(index))
+				if index != 0 {
+					break
+				}
+			}
+		}
+
+		index := tick & (level0Size - 1)
+		slot := w.slots[0][index]
+		w.slots[0][index] = nil
+		w.count0 -= len(slot)
+		for _, t := range slot {
+			if t.done {
+				continue
+			}
+			if t.expires > tick {
+				w.place(t)
+				continue
+			}
+			t.done = true
+			delete(w.pending, t.id)
+			fired = append(fired, t)
+		}
+		w.next++
+	}
+	return fired
+}
+
+// cascade re-places the timers of a higher-level slot. Caller holds w.mu.
+func (w *Wheel) cascade(level, index int) {
+	slot := w.slots[level][index]
+	w.slots[level][index] = nil
+	for _, t := range slot {
+		if !t.done {
+			w.place(t)
+		}
+	}
+}
+
+// earliest returns when the soonest pending timer's tick is due. Caller
+// holds w.mu.
+func (w *Wheel) earliest() (time.Time, bool) {
+	if len(w.pending) == 0 {
+		return time.Time{}, false
+	}
+	var soonest uint64
+	first := true
+	for _, t := range w.pending {
+		if first || t.expires < soonest {
+			soonest, first = t.expires, false
+		}
+	}
+	if soonest < w.next {
+		soonest = w.next // Placed on the next tick processed
+	}
+	return w.start.Add(time.Duration(soonest) * w.tick), true
+}
+
+// run drives the wheel, sleeping until the soonest deadline
+func (w *Wheel) run() {
+	sleep := time.NewTimer(time.Hour)
+	defer sleep.Stop()
+
+	for {
+		w.mu.Lock()
+		now := time.Now()
+		fired := w.advance(w.dueTick(now))
+		soonest, ok := w.earliest()
+		w.mu.Unlock()
+
+		w.fire(fired, now)
+
+		wait := time.Hour
+		if ok {
+			wait = time.Until(soonest)
+			if wait <= 0 {
+				wait = w.tick
+			}
+		}
+		if !sleep.Stop() {
+			select {
+			case <-sleep.C:
+			default:
+			}
+		}
+		sleep.Reset(wait)
+
+		select {
+		case <-sleep.C:
+		case <-w.wake:
+		case <-w.done:
+			return
+		}
+	}
+}
+
+// fire runs callbacks in deadline order and records their lateness
+func (w *Wheel) fire(fired []*Timer, now time.Time) {
+	if len(fired) == 0 {
+		return
+	}
+	w.mu.Lock()
+	hook := w.hook
+	w.mu.Unlock()
+
+	// With a hook, timers due together fire in label order rather than the
+	// order racing goroutines happened to schedule them
+	sort.SliceStable(fired, func(i, j int) bool {
+		a, b := fired[i], fired[j]
+		if !a.deadline.Equal(b.deadline) || hook == nil {
+			return a.deadline.Before(b.deadline)
+		}
+		if a.label.Name != b.label.Name {
+			return a.label.Name < b.label.Name
+		}
+		return a.label.RaceID < b.label.RaceID
+	})
+
+	w.mu.Lock()
+	w.metrics.Fired += uint64(len(fired))
+	for _, t := range fired {
+		if late := now.Sub(t.deadline); late > w.metrics.MaxLateness {
+			w.metrics.MaxLateness = late
+		}
+	}
+	w.mu.Unlock()
+
+	for _, t := range fired {
+		t.f()
+		if hook != nil {
+			hook(t.label)
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package timers
+
+import (
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+)
+
+// schedule places a timer expiring on the given tick without a goroutine
+func schedule(w *Wheel, expires uint64) *Timer {
+	w.nextID++
+	t := &Timer{wheel: w, id: w.nextID, expires: expires, f: func() {}}
+	w.pending[t.id] = t
+	w.place(t)
+	return t
+}
+
+func TestAdvanceFiresOnExpiryTick(t *testing.T) {
+	w := NewWheel(time.Millisecond)
+	rng := rand.New(rand.NewSource(1))
+
+	expected := make(map[uint64]uint64) // Timer ID -> expiry tick
+	for i := 0; i < 2000; i++ {
+		// Spread timers over every level of the wheel
+		expires := uint64(rng.Int63n(1 << (level0Bits + uint(rng.Intn(levels))*levelBits + 1)))
+		expected[schedule(w, expires).id] = expires
+	}
+	overflow := schedule(w, maxSpan+1234)
+	expected[overflow.id] = overflow.expires
+
+	var previous uint64
+	for len(w.pending) > 0 {
+		target := previous + uint64(rng.Int63n(5000))
+		for _, timer := range w.advance(target) {
+			expires := expected[timer.id]
+			if expires > target || (previous > 0 && expires <= previous) {
+				t.Fatalf("Timer expiring on tick %d fired advancing %d -> %d", expires, previous, target)
+			}
+			delete(expected, timer.id)
+		}
+		previous = target
+		if target > maxSpan*2 {
+			t.Fatal("Wheel never fired every timer")
+		}
+	}
+	if len(expected) != 0 {
+		t.Errorf("%d timers never fired", len(expected))
+	}
+}
+
+func TestAdvanceSkipsStoppedTimers(t *testing.T) {
+	w := NewWheel(time.Millisecond)
+	kept := schedule(w, 300)
+	stopped := schedule(w, 300)
+	if !stopped.Stop() || stopped.Stop() {
+		t.Error("Stop should succeed only once")
+	}
+
+	fired := w.advance(1000)
+	if len(fired) != 1 || fired[0] != kept {
+		t.Errorf("Expected only the kept timer to fire, got %d", len(fired))
+	}
+	if metrics := w.Metrics(); metrics.Canceled != 1 || metrics.Pending != 0 {
+		t.Errorf("Unexpected metrics %+v", metrics)
+	}
+}
+
+func TestAfterFunc(t *testing.T) {
+	w := NewWheel(100 * time.Microsecond)
+	defer w.Stop()
+
+	var mu sync.Mutex
+	var order []string
+	done := make(chan struct{})
+	start := time.Now()
+	record := func(name string, after time.Duration) func() {
+		return func() {
+			if elapsed := time.Since(start); elapsed < after {
+				t.Errorf("%s fired early after %v", name, elapsed)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			order = append(order, name)
+			if len(order) == 3 {
+				close(done)
+			}
+		}
+	}
+
+	w.AfterFunc(60*time.Millisecond, Label{Name: "long", RaceID: "race-1"}, record("long", 60*time.Millisecond))
+	w.AfterFunc(5*time.Millisecond, Label{Name: "short"}, record("short", 5*time.Millisecond))
+	w.AfterFunc(30*time.Millisecond, Label{Name: "medium"}, record("medium", 30*time.Millisecond))
+	canceled := w.AfterFunc(10*time.Millisecond, Label{Name: "canceled"}, func() { t.Error("Stopped timer fired") })
+	canceled.Stop()
+
+	pending := w.Pending()
+	if len(pending) != 3 || pending[0].Label.Name != "short" || pending[2].Label.RaceID != "race-1" {
+		t.Errorf("Unexpected pending timers %+v", pending)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timers did not fire")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if order[0] != "short" || order[1] != "medium" || order[2] != "long" {
+		t.Errorf("Expected timers in deadline order, got %v", order)
+	}
+
+	metrics := w.Metrics()
+	if metrics.Scheduled != 4 || metrics.Fired != 3 || metrics.Canceled != 1 || metrics.Pending != 0 {
+		t.Errorf("Unexpected metrics %+v", metrics)
+	}
+}
+
+func TestSleep(t *testing.T) {
+	w := NewWheel(DefaultTick)
+	defer w.Stop()
+
+	start := time.Now()
+	w.Sleep(20*time.Millisecond, Label{Name: "sleep"})
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Errorf("Sleep returned after %v", elapsed)
+	}
+}
+
+func TestVirtualWheel(t *testing.T) {
+	start := time.Date(2025, time.January, 1, 12, 0, 0, 0, time.UTC)
+	w := NewVirtualWheel(start, DefaultTick)
+
+	var firedAt []time.Duration
+	record := func() { firedAt = append(firedAt, w.Now().Sub(start)) }
+	w.AfterFunc(100*time.Millisecond, Label{Name: "late"}, record)
+	w.AfterFunc(50*time.Millisecond, Label{Name: "early"}, func() {
+		record()
+		w.AfterFunc(5*time.Millisecond, Label{Name: "chained"}, record)
+	})
+
+	w.Advance(60 * time.Millisecond)
+	if len(firedAt) != 2 || firedAt[0] != 50*time.Millisecond || firedAt[1] != 55*time.Millisecond {
+		t.Fatalf("Expected timers at 50ms and 55ms, got %v", firedAt)
+	}
+	if got := w.Now().Sub(start); got != 60*time.Millisecond {
+		t.Errorf("Expected clock at 60ms, got %v", got)
+	}
+
+	if !w.Step() || firedAt[2] != 100*time.Millisecond {
+		t.Errorf("Expected Step to fire the 100ms timer, got %v", firedAt)
+	}
+	if w.Step() {
+		t.Error("Step should report an empty wheel")
+	}
+}
+
+func TestFireHook(t *testing.T) {
+	start := time.Date(2025, time.January, 1, 12, 0, 0, 0, time.UTC)
+	w := NewVirtualWheel(start, DefaultTick)
+
+	var order []string
+	w.AfterFunc(10*time.Millisecond, Label{Name: "second"}, func() { order = append(order, "second") })
+	w.AfterFunc(10*time.Millisecond, Label{Name: "first"}, func() { order = append(order, "first") })
+	w.SetFireHook(func(label Label) { order = append(order, "after "+label.Name) })
+
+	w.Step()
+	want := []string{"first", "after first", "second", "after second"}
+	if len(order) != len(want) {
+		t.Fatalf("Expected %v, got %v", want, order)
+	}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("Expected %v, got %v", want, order)
+		}
+	}
+}
+
+func TestVirtualSleepAndTicker(t *testing.T) {
+	start := time.Date(2025, time.January, 1, 12, 0, 0, 0, time.UTC)
+	w := NewVirtualWheel(start, DefaultTick)
+
+	woke := make(chan time.Time)
+	go func() {
+		w.Sleep(time.Hour, Label{Name: "sleep"})
+		woke <- w.Now()
+	}()
+	w.BlockUntil(1)
+	w.Advance(time.Hour)
+	if got := <-woke; !got.Equal(start.Add(time.Hour)) {
+		t.Errorf("Sleeper woke at %v", got)
+	}
+
+	ticker := w.NewTicker(10*time.Millisecond, Label{Name: "ticker"})
+	w.Advance(35 * time.Millisecond)
+	ticker.Stop()
+	if got := <-ticker.C; got.Sub(start) != time.Hour+10*time.Millisecond {
+		t.Errorf("Expected the first tick kept, got %v", got.Sub(start))
+	}
+	if metrics := w.Metrics(); metrics.Fired != 4 || metrics.Pending != 0 {
+		t.Errorf("Expected sleep and three ticks fired, got %+v", metrics)
+	}
+}
+
+func TestSleepOrDone(t *testing.T) {
+	w := NewVirtualWheel(time.Unix(0, 0), time.Millisecond)
+	done := make(chan struct{})
+
+	slept := make(chan bool)
+	go func() { slept <- SleepOrDone(w, time.Second, Label{Name: "full"}, done) }()
+	w.BlockUntil(1)
+	w.Advance(time.Second)
+	if !<-slept {
+		t.Error("Expected the full sleep to elapse")
+	}
+
+	go func() { slept <- SleepOrDone(w, time.Second, Label{Name: "cut"}, done) }()
+	w.BlockUntil(1)
+	close(done)
+	if <-slept {
+		t.Error("Expected the sleep cut short")
+	}
+	if pending := w.Pending(); len(pending) != 0 {
+		t.Errorf("Expected the cut sleep's timer stopped, got %+v", pending)
+	}
+	if SleepOrDone(w, time.Second, Label{Name: "after"}, done) {
+		t.Error("Expected no sleep once done is closed")
+	}
+}
@@ -0,0 +1,345 @@
+// Package timetrial runs time trials as continuous solo runs. Each lane
+// runs on its own: a car stages, leaves on its lane's green and is timed to
+// the finish, and the next car can stage in that lane as soon as the run is
+// done, whatever the other lane is doing. Every run produces its own result
+// record.
+package timetrial
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/benharold/libdrag/pkg/config"
+	"github.com/benharold/libdrag/pkg/events"
+	"github.com/benharold/libdrag/pkg/logs"
+	"github.com/benharold/libdrag/pkg/timers"
+	"github.com/benharold/libdrag/pkg/timing"
+	"github.com/google/uuid"
+)
+
+// DefaultRunTimeout is how long a run has to finish after its green
+const DefaultRunTimeout = 30 * time.Second
+
+// Run statuses
+const (
+	RunStaged   = "staged"    // Waiting for the lane's green
+	RunRunning  = "running"   // Green given, not yet finished
+	RunComplete = "complete"  // Finished, or fouled without leaving
+	RunTimedOut = "timed_out" // No finish within the run timeout
+	RunAborted  = "aborted"
+)
+
+// Config configures a time trial session
+type Config struct {
+	SessionID  string        `json:"session_id,omitempty"` // Recorded on every run
+	Class      string        `json:"class,omitempty"`
+	RunTimeout time.Duration `json:"run_timeout"` // 0 = DefaultRunTimeout
+}
+
+// Run is a solo run's result record
+type Run struct {
+	ID           string                `json:"id"`
+	SessionID    string                `json:"session_id,omitempty"`
+	Class        string                `json:"class,omitempty"`
+	Lane         int                   `json:"lane"`
+	Number       int                   `json:"number"` // Order staged in the session
+	Registration string                `json:"registration,omitempty"`
+	Status       string                `json:"status"`
+	StagedAt     time.Time             `json:"staged_at"`
+	GreenAt      time.Time             `json:"green_at,omitempty"`
+	CompletedAt  time.Time             `json:"completed_at,omitempty"`
+	Results      *timing.TimingResults `json:"results,omitempty"`
+}
+
+// Session runs time trials on every lane of the track. It has its own
+// timing system, whose events carry the session's ID as their race ID;
+// timetrial.staged and timetrial.complete carry the run ID and the run.
+type Session struct {
+	mu         sync.Mutex
+	id         string
+	cfg        Config
+	runTimeout time.Duration
+	bus        *events.EventBus
+	timing     *timing.TimingSystem
+	laneCount  int
+	clock      timers.Clock             // Nil runs on the default wheel
+	logger     *slog.Logger             // Nil logs to logs.Default
+	active     map[int]*Run             // Lane -> run in progress
+	timeouts   map[string]*timers.Timer // Run ID -> run timeout
+	runs       []Run                    // Finished runs, in the order they finished
+	staged     int
+	stopped    bool
+}
+
+// NewSession creates a time trial session on the track in cfg
+func NewSession(bus *events.EventBus, cfg config.Config, ttc Config) (*Session, error) {
+	id := uuid.New().String()
+	timingSystem := timing.NewTimingSystemWithRaceID(id)
+	timingSystem.SetEventBus(bus)
+	if err := timingSystem.Initialize(context.Background(), cfg); err != nil {
+		return nil, err
+	}
+	if err := timingSystem.Arm(context.Background()); err != nil {
+		return nil, err
+	}
+
+	runTimeout := ttc.RunTimeout
+	if runTimeout <= 0 {
+		runTimeout = DefaultRunTimeout
+	}
+	return &Session{
+		id:         id,
+		cfg:        ttc,
+		runTimeout: runTimeout,
+		bus:        bus,
+		timing:     timingSystem,
+		laneCount:  cfg.Track().LaneCount,
+		active:     make(map[int]*Run),
+		timeouts:   make(map[string]*timers.Timer),
+	}, nil
+}
+
+// ID returns the session ID
+func (s *Session) ID() string {
+	return s.id
+}
+
+// SetClock runs the session and its timing on clock instead of the default
+// wheel
+func (s *Session) SetClock(clock timers.Clock) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clock = clock
+	s.timing.SetClock(clock)
+}
+
+// SetLogger logs the session and its timing to logger instead of
+// logs.Default
+func (s *Session) SetLogger(logger *slog.Logger) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.logger = logger
+	s.timing.SetLogger(logger)
+}
+
+// Stage starts a run for the car staged in a lane. The lane's previous run
+// must be done.
+func (s *Session) Stage(lane int, registration string) (Run, error) {
+	s.mu.Lock()
+	if s.stopped {
+		s.mu.Unlock()
+		return Run{}, fmt.Errorf("time trials stopped")
+	}
+	if lane < 1 || lane > s.laneCount {
+		s.mu.Unlock()
+		return Run{}, fmt.Errorf("lane %d is not on the track", lane)
+	}
+	if current, busy := s.active[lane]; busy {
+		s.mu.Unlock()
+		return Run{}, fmt.Errorf("lane %d is %s", lane, current.Status)
+	}
+	s.staged++
+	run := &Run{
+		ID:           uuid.New().String(),
+		SessionID:    s.cfg.SessionID,
+		Class:        s.cfg.Class,
+		Lane:         lane,
+		Number:       s.staged,
+		Registration: registration,
+		Status:       RunStaged,
+		StagedAt:     timers.Or(s.clock).Now(),
+	}
+	s.active[lane] = run
+	s.timing.StartLane(lane)
+	staged := *run
+	s.mu.Unlock()
+
+	s.publish(events.EventTimeTrialStaged, staged)
+	return staged, nil
+}
+
+// Green records the green of a lane's run, from the lane's tree or the
+// starter, at the current time when at is zero. A car that already left
+// red-lights.
+func (s *Session) Green(lane int, at time.Time) error {
+	s.mu.Lock()
+	run, ok := s.active[lane]
+	if !ok || run.Status != RunStaged {
+		s.mu.Unlock()
+		return fmt.Errorf("no car staged in lane %d", lane)
+	}
+	if at.IsZero() {
+		at = timers.Or(s.clock).Now()
+	}
+	run.Status = RunRunning
+	run.GreenAt = at
+	runID := run.ID
+	s.timeouts[runID] = timers.Or(s.clock).AfterFunc(s.runTimeout, timers.Label{Name: "timetrial.run_timeout", RaceID: s.id}, func() {
+		s.finish(lane, runID, RunTimedOut)
+	})
+	s.mu.Unlock()
+
+	if err := s.timing.SetLaneGreen(lane, at); err != nil {
+		return err
+	}
+	s.checkSettled(lane, runID)
+	return nil
+}
+
+// TriggerBeam reports a beam trigger in a lane, at the current time when at
+// is zero. A run is complete once its car finishes, or fouls without leaving
+// the line.
+func (s *Session) TriggerBeam(beamID string, lane int, at time.Time) error {
+	s.mu.Lock()
+	run, ok := s.active[lane]
+	if !ok {
+		s.mu.Unlock()
+		return fmt.Errorf("no run in lane %d", lane)
+	}
+	runID := run.ID
+	if at.IsZero() {
+		at = timers.Or(s.clock).Now()
+	}
+	s.mu.Unlock()
+
+	s.timing.TriggerBeam(beamID, lane, at)
+	s.checkSettled(lane, runID)
+	return nil
+}
+
+// Abort ends a lane's run without a finish
+func (s *Session) Abort(lane int) error {
+	s.mu.Lock()
+	run, ok := s.active[lane]
+	s.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("no run in lane %d", lane)
+	}
+	s.finish(lane, run.ID, RunAborted)
+	return nil
+}
+
+// Active returns the runs in progress by lane
+func (s *Session) Active() map[int]Run {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	active := make(map[int]Run, len(s.active))
+	for lane, run := range s.active {
+		active[lane] = *run
+	}
+	return active
+}
+
+// Runs returns the finished runs in the order they finished
+func (s *Session) Runs() []Run {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Run(nil), s.runs...)
+}
+
+// Forget erases a driver's finished runs for a privacy request, keeping
+// them under pseudonym, or removing them when pseudonym is empty. A run in
+// progress finishes unregistered when deleting. It returns how many runs
+// changed.
+func (s *Session) Forget(registration, pseudonym string) int {
+	if registration == "" {
+		return 0
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	changed := 0
+	kept := s.runs[:0]
+	for _, run := range s.runs {
+		if run.Registration != registration {
+			kept = append(kept, run)
+			continue
+		}
+		changed++
+		if pseudonym != "" {
+			run.Registration = pseudonym
+			kept = append(kept, run)
+		}
+	}
+	s.runs = kept
+	for _, run := range s.active {
+		if run.Registration == registration {
+			run.Registration = pseudonym
+			changed++
+		}
+	}
+	return changed
+}
+
+// Stop aborts the runs in progress and ends the session
+func (s *Session) Stop() {
+	s.mu.Lock()
+	s.stopped = true
+	lanes := make([]int, 0, len(s.active))
+	for lane := range s.active {
+		lanes = append(lanes, lane)
+	}
+	s.mu.Unlock()
+
+	sort.Ints(lanes)
+	for _, lane := range lanes {
+		s.Abort(lane)
+	}
+}
+
+// checkSettled finishes a running lane once timing expects no more beams
+func (s *Session) checkSettled(lane int, runID string) {
+	s.mu.Lock()
+	run, ok := s.active[lane]
+	running := ok && run.ID == runID && run.Status == RunRunning
+	s.mu.Unlock()
+
+	if running && s.timing.LaneSettled(lane) {
+		s.finish(lane, runID, RunComplete)
+	}
+}
+
+// finish closes a lane's run, records its results and publishes it
+func (s *Session) finish(lane int, runID, status string) {
+	s.mu.Lock()
+	run, ok := s.active[lane]
+	if !ok || run.ID != runID {
+		s.mu.Unlock()
+		return // Already finished
+	}
+	if timeout := s.timeouts[runID]; timeout != nil {
+		timeout.Stop()
+		delete(s.timeouts, runID)
+	}
+	delete(s.active, lane)
+	s.timing.FinalizeLane(lane)
+	run.Status = status
+	run.CompletedAt = timers.Or(s.clock).Now()
+	run.Results = s.timing.GetResults(lane)
+	s.runs = append(s.runs, *run)
+	finished := *run
+	s.mu.Unlock()
+
+	logs.For(s.logger, "timetrial", finished.ID).Info("⏱️ Run done", logs.KeyLane, lane, "run", finished.Number, "status", status)
+	s.publish(events.EventTimeTrialComplete, finished)
+}
+
+func (s *Session) publish(eventType events.EventType, run Run) {
+	if s.bus == nil {
+		return
+	}
+	s.bus.Publish(
+		events.NewEvent(eventType).
+			WithRaceID(run.ID).
+			WithLane(run.Lane).
+			WithData("session", s.id).
+			WithData("run", run).
+			Build(),
+	)
+}
@@ -0,0 +1,118 @@
+package timetrial
+
+import (
+	"testing"
+	"time"
+
+	"github.com/benharold/libdrag/pkg/config"
+	"github.com/benharold/libdrag/pkg/events"
+	"github.com/benharold/libdrag/pkg/timers"
+)
+
+func newTestSession(t *testing.T, ttc Config) (*Session, *timers.Wheel, *[]Run) {
+	t.Helper()
+	bus := events.NewEventBus(false)
+	var completed []Run
+	bus.Subscribe(events.EventTimeTrialComplete, func(e events.Event) {
+		completed = append(completed, e.Data["run"].(Run))
+	})
+	session, err := NewSession(bus, config.NewDefaultConfig(), ttc)
+	if err != nil {
+		t.Fatalf("NewSession failed: %v", err)
+	}
+	wheel := timers.NewVirtualWheel(time.Now(), timers.DefaultTick)
+	session.SetClock(wheel)
+	return session, wheel, &completed
+}
+
+func TestContinuousSoloRuns(t *testing.T) {
+	session, wheel, completed := newTestSession(t, Config{SessionID: "tt-1", Class: "Super Pro"})
+	start := wheel.Now()
+	at := func(ms int) time.Time { return start.Add(time.Duration(ms) * time.Millisecond) }
+
+	// Lane 2 leaves while lane 1 is still staging
+	if _, err := session.Stage(2, "DRV-2"); err != nil {
+		t.Fatalf("Stage failed: %v", err)
+	}
+	if err := session.Green(2, at(0)); err != nil {
+		t.Fatalf("Green failed: %v", err)
+	}
+	session.TriggerBeam("stage", 2, at(450))
+	first, err := session.Stage(1, "DRV-1")
+	if err != nil {
+		t.Fatalf("Stage failed: %v", err)
+	}
+	if _, err := session.Stage(2, "DRV-3"); err == nil {
+		t.Error("Expected lane 2 to be busy mid-run")
+	}
+
+	session.Green(1, at(2000))
+	session.TriggerBeam("stage", 1, at(2400))
+	session.TriggerBeam("1320_foot", 2, at(450+7600))
+	if runs := session.Runs(); len(runs) != 1 || runs[0].Lane != 2 || runs[0].Status != RunComplete {
+		t.Fatalf("Expected lane 2's run complete on its own, got %+v", runs)
+	}
+	if active := session.Active(); len(active) != 1 || active[1].ID != first.ID {
+		t.Errorf("Expected lane 1 still running, got %+v", active)
+	}
+
+	// The next car stages in lane 2 while lane 1 is mid-run
+	second, err := session.Stage(2, "DRV-3")
+	if err != nil {
+		t.Fatalf("Stage failed: %v", err)
+	}
+	session.TriggerBeam("1320_foot", 1, at(2400+7300))
+
+	runs := session.Runs()
+	if len(runs) != 2 || runs[1].ID != first.ID {
+		t.Fatalf("Expected lane 1's run second, got %+v", runs)
+	}
+	lane2, lane1 := runs[0], runs[1]
+	if *lane2.Results.ReactionTime != 0.45 || *lane1.Results.ReactionTime != 0.4 {
+		t.Errorf("Expected each lane timed from its own green, got %.3f and %.3f",
+			*lane2.Results.ReactionTime, *lane1.Results.ReactionTime)
+	}
+	if lane1.Registration != "DRV-1" || lane1.SessionID != "tt-1" || lane1.Class != "Super Pro" {
+		t.Errorf("Unexpected run record %+v", lane1)
+	}
+	if len(*completed) != 2 {
+		t.Errorf("Expected a timetrial.complete per run, got %d", len(*completed))
+	}
+	if active := session.Active(); active[2].ID != second.ID || active[2].Results != nil {
+		t.Errorf("Expected lane 2's new run staged with fresh results, got %+v", active[2])
+	}
+}
+
+func TestRunTimeoutAndRedLight(t *testing.T) {
+	session, wheel, _ := newTestSession(t, Config{RunTimeout: 10 * time.Second})
+	green := wheel.Now()
+
+	// Lane 1 leaves early and never reaches the finish
+	session.Stage(1, "")
+	session.TriggerBeam("stage", 1, green.Add(-50*time.Millisecond))
+	session.Green(1, green)
+	wheel.Advance(10*time.Second + timers.DefaultTick)
+
+	runs := session.Runs()
+	if len(runs) != 1 || runs[0].Status != RunTimedOut {
+		t.Fatalf("Expected the run closed at the timeout, got %+v", runs)
+	}
+	if !runs[0].Results.IsFoul || runs[0].Results.FoulReason != "red_light" {
+		t.Errorf("Expected a red light, got %+v", runs[0].Results)
+	}
+	if err := session.TriggerBeam("1320_foot", 1, green.Add(11*time.Second)); err == nil {
+		t.Error("Expected a late finish with no run to be rejected")
+	}
+
+	if _, err := session.Stage(3, ""); err == nil {
+		t.Error("Expected lane 3 to be rejected on a two-lane track")
+	}
+	session.Stage(2, "")
+	session.Stop()
+	if runs := session.Runs(); len(runs) != 2 || runs[1].Status != RunAborted {
+		t.Errorf("Expected Stop to abort lane 2's run, got %+v", runs)
+	}
+	if _, err := session.Stage(2, ""); err == nil {
+		t.Error("Expected staging to be rejected after Stop")
+	}
+}
@@ -0,0 +1,51 @@
+package timing
+
+import (
+	"sort"
+	"time"
+
+	"github.com/benharold/libdrag/pkg/events"
+)
+
+// publishDeltas publishes timing.delta between result's lane and each lane
+// that has already crossed beamID, for broadcast graphics showing who is
+// ahead mid-run. The gap is between the crossings, so it is the order on
+// the track, reaction and handicap start included; the elapsed delta
+// compares the lanes' times from their own starts. Caller holds ts.mu.
+func (ts *TimingSystem) publishDeltas(beamID string, result *TimingResults, triggerTime time.Time) {
+	if ts.eventBus == nil {
+		return
+	}
+
+	lanes := make([]int, 0, len(ts.results))
+	for lane := range ts.results {
+		lanes = append(lanes, lane)
+	}
+	sort.Ints(lanes)
+	for _, lane := range lanes {
+		other := ts.results[lane]
+		crossed, ok := other.BeamTriggers[beamID]
+		if lane == result.Lane || !ok || other.StartTime.IsZero() {
+			continue
+		}
+
+		// Triggers can arrive out of order, so the leader is whichever
+		// crossed first
+		leader, leaderTime, trailer, trailerTime := other, crossed, result, triggerTime
+		if triggerTime.Before(crossed) {
+			leader, leaderTime, trailer, trailerTime = result, triggerTime, other, crossed
+		}
+		elapsed := trailerTime.Sub(trailer.StartTime) - leaderTime.Sub(leader.StartTime)
+		ts.eventBus.Publish(
+			events.NewEvent(events.EventTimingDelta).
+				WithRaceID(ts.raceID).
+				WithLane(trailer.Lane).
+				WithData("beam_id", beamID).
+				WithData("leader_lane", leader.Lane).
+				WithData("trailing_lane", trailer.Lane).
+				WithData("gap", trailerTime.Sub(leaderTime).Seconds()).
+				WithData("elapsed_delta", elapsed.Seconds()).
+				Build(),
+		)
+	}
+}
@@ -0,0 +1,147 @@
+package timing
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/benharold/libdrag/pkg/events"
+	"github.com/benharold/libdrag/pkg/timers"
+)
+
+// Manual timing methods
+const (
+	ManualHandTimed = "hand_timed" // Stopwatch or hand-held timer
+	ManualBackup    = "backup"     // Backup timing system
+	ManualPartial   = "partial"    // Only some increments were recovered
+)
+
+// ManualAccuracy returns the accuracy of times taken by a manual timing
+// method. A backup timing system is electronic; anything else is as good as
+// a stopwatch.
+func ManualAccuracy(method string) timers.Accuracy {
+	accuracy := timers.AccuracyOf(timers.SourceManual)
+	if method == ManualBackup {
+		accuracy.Uncertainty = timers.DegradedUncertainty
+	}
+	return accuracy
+}
+
+// Provenance records who entered manual times, how they were taken and why
+type Provenance struct {
+	EnteredBy string    `json:"entered_by"`
+	Method    string    `json:"method"`
+	Reason    string    `json:"reason,omitempty"`
+	EnteredAt time.Time `json:"entered_at"`
+	Fields    []string  `json:"fields"` // Result fields that were entered manually
+}
+
+// ManualResult is an official's entry for a lane whose beams failed. Nil
+// times are left as the timing system recorded them.
+type ManualResult struct {
+	Lane            int      `json:"lane"`
+	ReactionTime    *float64 `json:"reaction_time,omitempty"`
+	SixtyFootTime   *float64 `json:"sixty_foot_time,omitempty"`
+	EighthMileTime  *float64 `json:"eighth_mile_time,omitempty"`
+	QuarterMileTime *float64 `json:"quarter_mile_time,omitempty"`
+	TrapSpeed       *float64 `json:"trap_speed,omitempty"`
+	EnteredBy       string   `json:"entered_by"`
+	Method          string   `json:"method"`
+	Reason          string   `json:"reason,omitempty"`
+}
+
+// EnterManualResult applies manually timed increments to a lane's results
+// and flags them as manual. An ET completes the run. A manual reaction time
+// places the lane's start relative to green when the stage beam missed it,
+// so the results engine can still work out who reached the stripe first.
+func (ts *TimingSystem) EnterManualResult(entry ManualResult) error {
+	if entry.EnteredBy == "" || entry.Method == "" {
+		return fmt.Errorf("manual results require who entered them and how they were timed")
+	}
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	result, exists := ts.results[entry.Lane]
+	if !exists {
+		return fmt.Errorf("no run in lane %d", entry.Lane)
+	}
+
+	var fields []string
+	for _, field := range []struct {
+		name string
+		dst  **float64
+		src  *float64
+	}{
+		{"reaction_time", &result.ReactionTime, entry.ReactionTime},
+		{"sixty_foot_time", &result.SixtyFootTime, entry.SixtyFootTime},
+		{"eighth_mile_time", &result.EighthMileTime, entry.EighthMileTime},
+		{"quarter_mile_time", &result.QuarterMileTime, entry.QuarterMileTime},
+		{"trap_speed", &result.TrapSpeed, entry.TrapSpeed},
+	} {
+		if field.src == nil {
+			continue
+		}
+		if *field.src < 0 && field.name != "reaction_time" {
+			return fmt.Errorf("%s cannot be negative", field.name)
+		}
+		v := *field.src
+		*field.dst = &v
+		fields = append(fields, field.name)
+	}
+	if len(fields) == 0 {
+		return fmt.Errorf("manual result for lane %d has no times", entry.Lane)
+	}
+
+	if entry.ReactionTime != nil {
+		setReactionTime(result, time.Duration(*entry.ReactionTime*float64(time.Second)))
+	}
+	if entry.ReactionTime != nil && result.StartTime.IsZero() && ts.hasGreen(entry.Lane) {
+		result.StartTime = ts.laneGreen(entry.Lane).Add(time.Duration(*entry.ReactionTime * float64(time.Second)))
+	}
+	if entry.QuarterMileTime != nil {
+		result.IsComplete = true
+		result.Breakout = false
+		ts.checkBreakout(result)
+	}
+
+	if result.Manual != nil {
+		// Keep earlier manually entered fields flagged
+		for _, field := range result.Manual.Fields {
+			if !containsString(fields, field) {
+				fields = append(fields, field)
+			}
+		}
+	}
+	result.Manual = &Provenance{
+		EnteredBy: entry.EnteredBy,
+		Method:    entry.Method,
+		Reason:    entry.Reason,
+		EnteredAt: timers.Or(ts.clock).Now(),
+		Fields:    fields,
+	}
+
+	if ts.eventBus != nil {
+		ts.eventBus.Publish(
+			events.NewEvent(events.EventTimingManualEntry).
+				WithRaceID(ts.raceID).
+				WithLane(entry.Lane).
+				WithData("entered_by", entry.EnteredBy).
+				WithData("method", entry.Method).
+				WithData("reason", entry.Reason).
+				WithData("fields", fields).
+				WithData("timestamp_source", string(timers.SourceManual)).
+				WithData("uncertainty", ManualAccuracy(entry.Method).Uncertainty).
+				Build(),
+		)
+	}
+	return nil
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,33 @@
+package timing
+
+import "time"
+
+// ReactionTimeResolution is the sanctioned resolution of a reaction time
+const ReactionTimeResolution = time.Millisecond
+
+// TruncateReactionTime converts a raw start-to-green interval into the
+// sanctioned reaction time. Times are truncated to the thousandth, never
+// rounded, so a .0009 light reads .000. A red light is truncated away from
+// zero so that it never reads as .000 and always shows negative.
+func TruncateReactionTime(raw time.Duration) float64 {
+	truncated := raw.Truncate(ReactionTimeResolution)
+	if raw < 0 && truncated != raw {
+		truncated -= ReactionTimeResolution
+	}
+	return truncated.Seconds()
+}
+
+// IsPerfectLight reports whether a sanctioned reaction time is a perfect
+// light: a legal start that truncates to exactly .000
+func IsPerfectLight(reactionTime float64) bool {
+	return reactionTime == 0
+}
+
+// setReactionTime records a lane's sanctioned reaction time and whether it
+// was a perfect light. Caller holds ts.mu.
+func setReactionTime(result *TimingResults, raw time.Duration) float64 {
+	reactionTime := TruncateReactionTime(raw)
+	result.ReactionTime = &reactionTime
+	result.PerfectLight = raw >= 0 && IsPerfectLight(reactionTime)
+	return reactionTime
+}
@@ -0,0 +1,57 @@
+package timing
+
+import (
+	"time"
+
+	"github.com/benharold/libdrag/pkg/events"
+	"github.com/benharold/libdrag/pkg/logs"
+)
+
+// feetPerSecondToMPH converts ft/s to mph
+const feetPerSecondToMPH = 0.681818
+
+// checkShutdown records the speed a car carried into a shutdown-area beam,
+// averaged from the lane's previous beam, and alerts the safety crew when
+// it has not slowed below the beam's limit. Caller holds ts.mu.
+func (ts *TimingSystem) checkShutdown(result *TimingResults, beam *TimingBeam, triggerTime time.Time) {
+	var (
+		prev     *TimingBeam
+		prevTime time.Time
+	)
+	for id, at := range result.BeamTriggers {
+		candidate, exists := ts.beams[id]
+		if !exists || candidate.Position >= beam.Position || !at.Before(triggerTime) {
+			continue
+		}
+		if prev == nil || candidate.Position > prev.Position {
+			prev, prevTime = candidate, at
+		}
+	}
+	if prev == nil {
+		return
+	}
+
+	speed := (beam.Position - prev.Position) / triggerTime.Sub(prevTime).Seconds() * feetPerSecondToMPH
+	if result.ShutdownSpeeds == nil {
+		result.ShutdownSpeeds = make(map[string]float64)
+	}
+	result.ShutdownSpeeds[beam.ID] = speed
+
+	if beam.MaxSpeed <= 0 || speed <= beam.MaxSpeed {
+		return
+	}
+
+	ts.log().Warn("⚠️ Shutdown overrun", logs.KeyLane, result.Lane, "speed", speed, "beam_id", beam.ID, "max_speed", beam.MaxSpeed)
+	if ts.eventBus != nil {
+		ts.eventBus.Publish(
+			events.NewEvent(events.EventShutdownOverrun).
+				WithRaceID(ts.raceID).
+				WithLane(result.Lane).
+				WithData("beam_id", beam.ID).
+				WithData("position", beam.Position).
+				WithData("speed", speed).
+				WithData("max_speed", beam.MaxSpeed).
+				Build(),
+		)
+	}
+}
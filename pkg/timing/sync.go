@@ -0,0 +1,112 @@
+package timing
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/benharold/libdrag/pkg/events"
+)
+
+// Sync mark labels recorded automatically by the timing system
+const (
+	SyncLabelGreen  = "green"
+	SyncLabelFinish = "finish"
+)
+
+// SyncMark ties a moment in a run to a position in an external recording so
+// review software can jump to the exact frames of a disputed finish
+type SyncMark struct {
+	Source    string        `json:"source"`         // Recorder ID, e.g. "finish_line_cam"
+	Label     string        `json:"label"`          // Moment marked, e.g. "green" or "finish"
+	Lane      int           `json:"lane,omitempty"` // Zero applies to every lane in the run
+	At        time.Time     `json:"at"`             // Timing-system time of the moment
+	Frame     int64         `json:"frame,omitempty"`
+	MediaTime time.Duration `json:"media_time"` // Offset into the recording
+}
+
+// SyncRecorder is implemented by external recorders (video, photo finish)
+// that want a sync mark at green and at each lane's finish. SyncMark is
+// called with the timing system locked and must not call back into it.
+type SyncRecorder interface {
+	SyncMark(label string, lane int, at time.Time) (SyncMark, bool)
+}
+
+// AddSyncRecorder registers a recorder to be marked at green and finish
+func (ts *TimingSystem) AddSyncRecorder(recorder SyncRecorder) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.recorders = append(ts.recorders, recorder)
+}
+
+// AddSyncMark stores a mark from an external recorder with the run's results
+func (ts *TimingSystem) AddSyncMark(mark SyncMark) error {
+	if mark.Source == "" || mark.Label == "" {
+		return fmt.Errorf("sync mark requires a source and label")
+	}
+	if mark.At.IsZero() {
+		return fmt.Errorf("sync mark requires a time")
+	}
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	return ts.addSyncMark(mark)
+}
+
+// GetSyncMarks returns the marks stored for a lane
+func (ts *TimingSystem) GetSyncMarks(lane int) []SyncMark {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+
+	if result, exists := ts.results[lane]; exists {
+		return append([]SyncMark(nil), result.SyncMarks...)
+	}
+	return nil
+}
+
+// markRecorders asks each registered recorder for a mark. Caller holds ts.mu.
+func (ts *TimingSystem) markRecorders(label string, lane int, at time.Time) {
+	for _, recorder := range ts.recorders {
+		mark, ok := recorder.SyncMark(label, lane, at)
+		if !ok {
+			continue
+		}
+		if mark.Label == "" {
+			mark.Label = label
+		}
+		if mark.At.IsZero() {
+			mark.At = at
+		}
+		mark.Lane = lane
+		ts.addSyncMark(mark)
+	}
+}
+
+// addSyncMark stores a mark on its lane, or every lane. Caller holds ts.mu.
+func (ts *TimingSystem) addSyncMark(mark SyncMark) error {
+	stored := false
+	for lane, result := range ts.results {
+		if mark.Lane != 0 && mark.Lane != lane {
+			continue
+		}
+		result.SyncMarks = append(result.SyncMarks, mark)
+		stored = true
+	}
+	if !stored {
+		return fmt.Errorf("no run in lane %d", mark.Lane)
+	}
+
+	if ts.eventBus != nil {
+		ts.eventBus.Publish(
+			events.NewEvent(events.EventTimingSyncMark).
+				WithRaceID(ts.raceID).
+				WithLane(mark.Lane).
+				WithData("source", mark.Source).
+				WithData("label", mark.Label).
+				WithData("at", mark.At).
+				WithData("frame", mark.Frame).
+				WithData("media_time", mark.MediaTime.Seconds()).
+				Build(),
+		)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package timing
+
+import (
+	"github.com/benharold/libdrag/pkg/events"
+	"github.com/benharold/libdrag/pkg/logs"
+)
+
+// Tech review reasons
+const (
+	TechReviewClassSpeed   = "class_max_trap_speed"   // Faster than the class is expected to run
+	TechReviewLicenseSpeed = "license_max_trap_speed" // Faster than the driver's license allows
+)
+
+// SetLicenses sets each lane's driver license category, checked against
+// Timing().LicenseMaxTrapSpeed. Licenses carry over between races.
+func (ts *TimingSystem) SetLicenses(licenses map[int]string) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	ts.licenses = make(map[int]string, len(licenses))
+	for lane, license := range licenses {
+		ts.licenses[lane] = license
+	}
+}
+
+// checkTrapSpeed flags a run for tech review when its trap speed exceeds the
+// class or license limit. Caller holds ts.mu.
+func (ts *TimingSystem) checkTrapSpeed(result *TimingResults, trapSpeed float64) {
+	if ts.config == nil {
+		return
+	}
+	timingConfig := ts.config.Timing()
+
+	class := ts.config.RacingClass()
+	if limit := timingConfig.MaxTrapSpeedFor(class); limit > 0 && trapSpeed > limit {
+		ts.flagTechReview(result, TechReviewClassSpeed, trapSpeed, limit, class)
+	}
+	if license, ok := ts.licenses[result.Lane]; ok {
+		if limit := timingConfig.LicenseMaxTrapSpeed[license]; limit > 0 && trapSpeed > limit {
+			ts.flagTechReview(result, TechReviewLicenseSpeed, trapSpeed, limit, license)
+		}
+	}
+}
+
+// flagTechReview records a tech review reason on the run and alerts the tower
+func (ts *TimingSystem) flagTechReview(result *TimingResults, reason string, trapSpeed, limit float64, category string) {
+	result.TechReview = append(result.TechReview, reason)
+
+	ts.log().Warn("⚠️ Trap speed over the limit", logs.KeyLane, result.Lane, "trap_speed", trapSpeed, "limit", limit, "reason", reason, "category", category)
+	if ts.eventBus != nil {
+		ts.eventBus.Publish(
+			events.NewEvent(events.EventTimingTechReview).
+				WithRaceID(ts.raceID).
+				WithLane(result.Lane).
+				WithData("reason", reason).
+				WithData("category", category).
+				WithData("trap_speed", trapSpeed).
+				WithData("limit", limit).
+				Build(),
+		)
+	}
+}
@@ -3,27 +3,49 @@ package timing
 import (
 	"context"
 	"fmt"
-	"sync"
+	"log/slog"
+	"sort"
 	"time"
 
 	"github.com/benharold/libdrag/pkg/component"
 	"github.com/benharold/libdrag/pkg/config"
 	"github.com/benharold/libdrag/pkg/events"
+	"github.com/benharold/libdrag/pkg/handicap"
+	"github.com/benharold/libdrag/pkg/logs"
+	"github.com/benharold/libdrag/pkg/timers"
 )
 
 // TimingResults holds race timing data
 type TimingResults struct {
 	Lane            int                  `json:"lane"`
 	StartTime       time.Time            `json:"start_time"`
-	ReactionTime    *float64             `json:"reaction_time,omitempty"`
+	ReactionTime    *float64             `json:"reaction_time,omitempty"` // Truncated to 0.001s
+	PerfectLight    bool                 `json:"perfect_light,omitempty"` // Legal start reading exactly .000
 	SixtyFootTime   *float64             `json:"sixty_foot_time,omitempty"`
+	ThreeThirtyTime *float64             `json:"three_thirty_time,omitempty"`
 	EighthMileTime  *float64             `json:"eighth_mile_time,omitempty"`
+	EighthMileSpeed *float64             `json:"eighth_mile_speed,omitempty"` // Through the eighth-mile speed trap
+	ThousandFtTime  *float64             `json:"thousand_foot_time,omitempty"`
 	QuarterMileTime *float64             `json:"quarter_mile_time,omitempty"`
-	TrapSpeed       *float64             `json:"trap_speed,omitempty"`
+	TrapSpeed       *float64             `json:"trap_speed,omitempty"`  // Through the quarter-mile speed trap
+	DialIn          *float64             `json:"dial_in,omitempty"`     // Bracket dial-in the lane ran on
+	StartDelay      float64              `json:"start_delay,omitempty"` // Handicap: seconds the lane's green came after the tree's
+	Breakout        bool                 `json:"breakout,omitempty"`    // Ran quicker than the dial-in
 	IsComplete      bool                 `json:"is_complete"`
 	IsFoul          bool                 `json:"is_foul"`
 	FoulReason      string               `json:"foul_reason,omitempty"`
 	BeamTriggers    map[string]time.Time `json:"beam_triggers"`
+	SyncMarks       []SyncMark           `json:"sync_marks,omitempty"`      // External recorder sync points
+	Manual          *Provenance          `json:"manual,omitempty"`          // Set when any time was entered by hand
+	ShutdownSpeeds  map[string]float64   `json:"shutdown_speeds,omitempty"` // Shutdown beam -> speed approaching it (mph)
+	TechReview      []string             `json:"tech_review,omitempty"`     // Reasons the run was flagged for tech review
+	GuardTrip       *time.Time           `json:"guard_trip,omitempty"`      // First guard beam trip before the lane's green
+
+	// Timestamps labels each beam trigger with where its time came from and
+	// how far off it may be (see Accuracy)
+	Timestamps map[string]timers.Accuracy `json:"timestamps,omitempty"`
+
+	TreeProfile *config.TreeSequenceConfig `json:"tree_profile,omitempty"` // Effective tree the run was started on
 }
 
 // BeamStatus represents the state of a timing beam
@@ -44,13 +66,23 @@ type TimingBeam struct {
 	IsTriggered bool
 	LastTrigger time.Time
 	IsActive    bool
+	Shutdown    bool    // Past the finish line
+	MaxSpeed    float64 // Over-run threshold at a shutdown beam (mph)
+
+	// triggerData holds the beam's timing.beam_trigger event data by
+	// timestamp accuracy, built once and shared so triggers don't allocate
+	triggerData map[timers.Accuracy]map[string]interface{}
 }
 
+// maxTriggerData bounds the trigger data kept per beam, should a source
+// report a different uncertainty with every trigger
+const maxTriggerData = 8
+
 // TimingSystem implements the timing system component
 type TimingSystem struct {
 	id             string
 	config         config.Config
-	mu             sync.RWMutex
+	mu             component.VersionedMutex
 	beams          map[string]*TimingBeam
 	results        map[int]*TimingResults
 	running        bool
@@ -59,6 +91,16 @@ type TimingSystem struct {
 	testMode       bool
 	greenLightTime time.Time
 	eventBus       *events.EventBus
+	recorders      []SyncRecorder
+	licenses       map[int]string        // Lane -> driver license category
+	finalized      bool                  // Results are final; later beam triggers are ignored
+	startDelays    map[int]time.Duration // Lane -> handicap delay of its green
+	laneGreens     map[int]time.Time     // Lane -> green of a solo run (zero until lit)
+	finalizedLanes map[int]bool          // Solo runs whose results are final
+	clock          timers.Clock          // Nil runs on the default wheel
+	logger         *slog.Logger          // Nil logs to logs.Default
+	source         timers.Accuracy       // Accuracy of TriggerBeam's trigger times
+	onRedLight     func(lane int, reactionTime float64)
 }
 
 func NewTimingSystem() *TimingSystem {
@@ -72,6 +114,7 @@ func NewTimingSystemWithRaceID(raceID string) *TimingSystem {
 		results:  make(map[int]*TimingResults),
 		raceID:   raceID,
 		testMode: false,
+		source:   timers.AccuracyOf(timers.SourceHost),
 		status: component.ComponentStatus{
 			ID:       "timing_system",
 			Status:   "stopped",
@@ -80,7 +123,51 @@ func NewTimingSystemWithRaceID(raceID string) *TimingSystem {
 	}
 }
 
+// SetRedLightHandler sets the callback for each lane flagged as leaving
+// before its green, with its (negative) reaction time, to light the lane's
+// red bulb on the tree. It is called with the timing system locked, so it
+// must not call back into it.
+func (ts *TimingSystem) SetRedLightHandler(handler func(lane int, reactionTime float64)) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.onRedLight = handler
+}
+
+// SetClock stamps manual entries with clock instead of the default wheel.
+// Beam triggers carry their own times.
+func (ts *TimingSystem) SetClock(clock timers.Clock) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.clock = clock
+}
+
+// SetLogger logs the timing system's runs and fouls to logger instead of
+// logs.Default
+func (ts *TimingSystem) SetLogger(logger *slog.Logger) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.logger = logger
+}
+
+// log returns the timing system's logger for its race. Callers need not
+// hold ts.mu, as the logger and race are set before the race runs.
+func (ts *TimingSystem) log() *slog.Logger {
+	return logs.For(ts.logger, "timing", ts.raceID)
+}
+
+// SetTimestampSource sets where the trigger times passed to TriggerBeam
+// come from (host clock by default). Inputs with their own source use
+// TriggerBeamFrom.
+func (ts *TimingSystem) SetTimestampSource(accuracy timers.Accuracy) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.source = accuracy
+}
+
 // SetTestMode enables or disables test mode (fast execution)
+//
+// Deprecated: timing has no delays to skip; run races on a virtual clock
+// to make them deterministic.
 func (ts *TimingSystem) SetTestMode(enabled bool) {
 	ts.mu.Lock()
 	defer ts.mu.Unlock()
@@ -102,6 +189,8 @@ func (ts *TimingSystem) Initialize(ctx context.Context, cfg config.Config) error
 			Position: beamConfig.Position,
 			Lane:     beamConfig.Lane,
 			IsActive: true,
+			Shutdown: beamConfig.Shutdown,
+			MaxSpeed: beamConfig.MaxSpeed,
 		}
 	}
 
@@ -152,11 +241,15 @@ func (ts *TimingSystem) StartRace() {
 	ts.mu.Lock()
 	defer ts.mu.Unlock()
 
-	fmt.Println("🔍 libdrag Timing System: Race started, resetting timers")
+	ts.log().Info("🔍 Race started, resetting timers")
 
 	// Reset timing results
 	ts.results = make(map[int]*TimingResults)
 	ts.greenLightTime = time.Time{}
+	ts.finalized = false
+	ts.startDelays = nil
+	ts.laneGreens = nil
+	ts.finalizedLanes = nil
 
 	// Reset beam states
 	for _, beam := range ts.beams {
@@ -170,14 +263,133 @@ func (ts *TimingSystem) AddVehicles(lanes []int) {
 	defer ts.mu.Unlock()
 
 	for _, lane := range lanes {
-		ts.results[lane] = &TimingResults{
-			Lane:         lane,
-			StartTime:    time.Time{}, // Will be set when vehicle actually starts
-			BeamTriggers: make(map[string]time.Time),
-			IsComplete:   false,
-			IsFoul:       false,
+		ts.results[lane] = ts.newResult(lane)
+	}
+}
+
+// newResult creates a lane's empty results. Must be called with ts.mu held.
+func (ts *TimingSystem) newResult(lane int) *TimingResults {
+	result := &TimingResults{
+		Lane:         lane,
+		StartTime:    time.Time{}, // Will be set when vehicle actually starts
+		BeamTriggers: make(map[string]time.Time),
+		IsComplete:   false,
+		IsFoul:       false,
+	}
+	if ts.config != nil {
+		profile := ts.config.Tree()
+		result.TreeProfile = &profile
+	}
+	return result
+}
+
+// StartLane begins a solo run in a lane, clearing the lane's last run
+// without touching the others, so a new car can stage in one lane while
+// another is mid-run. The run's green is set with SetLaneGreen rather than
+// the race's green light.
+func (ts *TimingSystem) StartLane(lane int) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	ts.results[lane] = ts.newResult(lane)
+	if ts.laneGreens == nil {
+		ts.laneGreens = make(map[int]time.Time)
+	}
+	ts.laneGreens[lane] = time.Time{}
+	delete(ts.startDelays, lane)
+	delete(ts.finalizedLanes, lane)
+}
+
+// SetLaneGreen records the green of a lane's solo run, classifying a car
+// that already left as a red light
+func (ts *TimingSystem) SetLaneGreen(lane int, greenTime time.Time) error {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	result, exists := ts.results[lane]
+	if _, solo := ts.laneGreens[lane]; !exists || !solo {
+		return fmt.Errorf("no solo run in lane %d", lane)
+	}
+	ts.laneGreens[lane] = greenTime
+	ts.markRecorders(SyncLabelGreen, lane, greenTime)
+	ts.classifyEarlyStart(result)
+	return nil
+}
+
+// FinalizeLane marks a solo run's results final. Like Finalize, later beam
+// triggers in the lane are ignored until its next run starts.
+func (ts *TimingSystem) FinalizeLane(lane int) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if ts.finalizedLanes == nil {
+		ts.finalizedLanes = make(map[int]bool)
+	}
+	ts.finalizedLanes[lane] = true
+}
+
+// LaneSettled reports whether a lane has finished, or fouled without
+// leaving the line (see Settled)
+func (ts *TimingSystem) LaneSettled(lane int) bool {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+
+	result, exists := ts.results[lane]
+	return exists && result.settled()
+}
+
+// HandicapDelays returns each lane's start delay for a bracket race: the
+// lane with the slowest dial-in gets the tree's green and every other lane
+// waits out the difference. It returns nil unless every lane has a dial-in.
+// See handicap.StartDelays.
+func HandicapDelays(dialIns map[int]float64, lanes []int) map[int]time.Duration {
+	return handicap.StartDelays(dialIns, lanes)
+}
+
+// SetDialIns sets the lanes' dial-ins for a bracket race and returns the
+// handicap start delays they give (see HandicapDelays), which the tree must
+// run with. Reaction times are measured from each lane's own green and a
+// finish quicker than the dial is flagged as a breakout. Call before the
+// green light.
+func (ts *TimingSystem) SetDialIns(dialIns map[int]float64) map[int]time.Duration {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	lanes := make([]int, 0, len(ts.results))
+	for lane, result := range ts.results {
+		lanes = append(lanes, lane)
+		result.DialIn = nil
+		if dial, ok := dialIns[lane]; ok {
+			result.DialIn = &dial
 		}
 	}
+	sort.Ints(lanes)
+
+	ts.startDelays = HandicapDelays(dialIns, lanes)
+	delays := make(map[int]time.Duration, len(ts.startDelays))
+	for lane, delay := range ts.startDelays {
+		ts.results[lane].StartDelay = delay.Seconds()
+		delays[lane] = delay
+	}
+	return delays
+}
+
+// laneGreen returns when a lane's green lit, allowing for its handicap.
+// Must be called with ts.mu held.
+func (ts *TimingSystem) laneGreen(lane int) time.Time {
+	if green, solo := ts.laneGreens[lane]; solo {
+		return green
+	}
+	return ts.greenLightTime.Add(ts.startDelays[lane])
+}
+
+// hasGreen reports whether a lane's green time is known. Must be called
+// with ts.mu held.
+func (ts *TimingSystem) hasGreen(lane int) bool {
+	if green, solo := ts.laneGreens[lane]; solo {
+		return !green.IsZero()
+	}
+	return !ts.greenLightTime.IsZero()
 }
 
 func (ts *TimingSystem) SetGreenLight(greenTime time.Time) {
@@ -185,30 +397,64 @@ func (ts *TimingSystem) SetGreenLight(greenTime time.Time) {
 	defer ts.mu.Unlock()
 
 	ts.greenLightTime = greenTime
-	fmt.Printf("🟢 libdrag Timing System: Green light at %v\n", ts.greenLightTime)
+	ts.log().Info("🟢 Green light", "at", ts.greenLightTime)
+	ts.markRecorders(SyncLabelGreen, 0, greenTime)
 
 	// Check for existing early starts (red light fouls)
-	for _, result := range ts.results {
-		if !result.StartTime.IsZero() {
-			// Vehicle already left starting line before green light
-			reactionTime := result.StartTime.Sub(ts.greenLightTime).Seconds()
-			result.ReactionTime = &reactionTime
-
-			if reactionTime < 0 {
-				result.IsFoul = true
-				result.FoulReason = "red_light"
-				fmt.Printf("🚨 libdrag: Red light foul detected for lane %d (RT: %.3fs)\n", result.Lane, reactionTime)
-			}
+	for lane, result := range ts.results {
+		if _, solo := ts.laneGreens[lane]; !solo {
+			ts.classifyEarlyStart(result)
 		}
 	}
 }
 
+// classifyEarlyStart red-lights a lane that left, or rolled through the
+// guard beam, before its green was known. Must be called with ts.mu held.
+func (ts *TimingSystem) classifyEarlyStart(result *TimingResults) {
+	if result.GuardTrip != nil {
+		// Rolled through the guard beam before the tree came down
+		ts.guardFoul(result, *result.GuardTrip)
+	}
+	if !result.StartTime.IsZero() {
+		// Vehicle already left starting line before green light
+		reactionTime := setReactionTime(result, result.StartTime.Sub(ts.laneGreen(result.Lane)))
+
+		if reactionTime < 0 && !result.IsFoul {
+			result.IsFoul = true
+			result.FoulReason = "red_light"
+			ts.log().Warn("🚨 Red light", logs.KeyLane, result.Lane, "reaction_time", reactionTime)
+			ts.publishRedLight(result.Lane, reactionTime, result.StartTime)
+		}
+	}
+}
+
+// TriggerBeam records a beam trigger in a lane, its time taken from the
+// system's timestamp source (see SetTimestampSource)
 func (ts *TimingSystem) TriggerBeam(beamID string, lane int, triggerTime time.Time) {
 	ts.mu.Lock()
 	defer ts.mu.Unlock()
+	ts.triggerBeam(beamID, lane, triggerTime, ts.source)
+}
+
+// TriggerBeamFrom records a beam trigger whose time came from the given
+// source, such as a hardware timestamp or a simulation
+func (ts *TimingSystem) TriggerBeamFrom(beamID string, lane int, triggerTime time.Time, accuracy timers.Accuracy) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.triggerBeam(beamID, lane, triggerTime, accuracy)
+}
+
+// triggerBeam records a beam trigger. Must be called with ts.mu held.
+func (ts *TimingSystem) triggerBeam(beamID string, lane int, triggerTime time.Time, accuracy timers.Accuracy) {
+
+	if ts.finalized || ts.finalizedLanes[lane] {
+		ts.log().Warn("⚠️ Ignoring trigger, results are final", logs.KeyLane, lane, "beam_id", beamID)
+		return
+	}
 
 	// Update beam state
-	if beam, exists := ts.beams[beamID]; exists {
+	beam := ts.beams[beamID]
+	if beam != nil {
 		beam.IsTriggered = true
 		beam.LastTrigger = triggerTime
 	}
@@ -216,50 +462,38 @@ func (ts *TimingSystem) TriggerBeam(beamID string, lane int, triggerTime time.Ti
 	// Update timing results if lane exists
 	if result, exists := ts.results[lane]; exists {
 		result.BeamTriggers[beamID] = triggerTime
-
-		// Publish beam trigger event
-		if ts.eventBus != nil {
-			ts.eventBus.Publish(
-				events.NewEvent(events.EventTimingBeamTrigger).
-					WithRaceID(ts.raceID).
-					WithLane(lane).
-					WithData("beam_id", beamID).
-					WithData("trigger_time", triggerTime).
-					Build(),
-			)
+		if result.Timestamps == nil {
+			result.Timestamps = make(map[string]timers.Accuracy)
+		}
+		result.Timestamps[beamID] = accuracy
+
+		// Publish beam trigger event. This runs for every trigger at hardware
+		// polling rates, so it is skipped when nobody listens and allocates
+		// nothing when someone does: the trigger time is the event's
+		// timestamp and the data is shared between the beam's events.
+		if ts.eventBus != nil && ts.eventBus.HasSubscribers(events.EventTimingBeamTrigger) {
+			ts.eventBus.Publish(events.Event{
+				Type:      events.EventTimingBeamTrigger,
+				Timestamp: triggerTime,
+				RaceID:    ts.raceID,
+				Lane:      lane,
+				Data:      beamTriggerData(beam, beamID, accuracy),
+			})
 		}
 
 		// Calculate timing splits based on beam
 		switch beamID {
 		case "stage":
 			// Vehicle left starting line - calculate reaction time
-			if !ts.greenLightTime.IsZero() {
-				reactionTime := triggerTime.Sub(ts.greenLightTime).Seconds()
-				result.ReactionTime = &reactionTime
+			if ts.hasGreen(lane) {
+				reactionTime := setReactionTime(result, triggerTime.Sub(ts.laneGreen(lane)))
 				result.StartTime = triggerTime
 
 				// Check for red light (negative reaction time)
 				if reactionTime < 0 {
 					result.IsFoul = true
 					result.FoulReason = "red_light"
-
-					// Publish red light event
-					if ts.eventBus != nil {
-						ts.eventBus.Publish(
-							events.NewEvent(events.EventTreeRedLight).
-								WithRaceID(ts.raceID).
-								WithLane(lane).
-								WithData("reaction_time", reactionTime).
-								Build(),
-						)
-						ts.eventBus.Publish(
-							events.NewEvent(events.EventRaceFoul).
-								WithRaceID(ts.raceID).
-								WithLane(lane).
-								WithData("reason", "red_light").
-								Build(),
-						)
-					}
+					ts.publishRedLight(lane, reactionTime, triggerTime)
 				}
 
 				// Publish reaction time event
@@ -269,6 +503,9 @@ func (ts *TimingSystem) TriggerBeam(beamID string, lane int, triggerTime time.Ti
 							WithRaceID(ts.raceID).
 							WithLane(lane).
 							WithData("reaction_time", reactionTime).
+							WithData("perfect_light", result.PerfectLight).
+							WithData("timestamp_source", string(accuracy.Source)).
+							WithData("uncertainty", accuracy.Uncertainty).
 							Build(),
 					)
 				}
@@ -290,17 +527,19 @@ func (ts *TimingSystem) TriggerBeam(beamID string, lane int, triggerTime time.Ti
 							WithRaceID(ts.raceID).
 							WithLane(lane).
 							WithData("time", sixtyFootTime).
+							WithData("timestamp_source", string(accuracy.Source)).
+							WithData("uncertainty", accuracy.Uncertainty).
 							Build(),
 					)
 				}
+				ts.publishDeltas(beamID, result, triggerTime)
 			}
 
 		case "330_foot":
 			// Calculate 330-foot time from start line
 			if !result.StartTime.IsZero() {
 				time330 := triggerTime.Sub(result.StartTime).Seconds()
-				// Note: Could add ThreeThirtyFootTime field if needed
-				_ = time330
+				result.ThreeThirtyTime = &time330
 
 				// Publish 330-foot event
 				if ts.eventBus != nil {
@@ -309,9 +548,12 @@ func (ts *TimingSystem) TriggerBeam(beamID string, lane int, triggerTime time.Ti
 							WithRaceID(ts.raceID).
 							WithLane(lane).
 							WithData("time", time330).
+							WithData("timestamp_source", string(accuracy.Source)).
+							WithData("uncertainty", accuracy.Uncertainty).
 							Build(),
 					)
 				}
+				ts.publishDeltas(beamID, result, triggerTime)
 			}
 
 		case "660_foot":
@@ -319,6 +561,10 @@ func (ts *TimingSystem) TriggerBeam(beamID string, lane int, triggerTime time.Ti
 			if !result.StartTime.IsZero() {
 				eighthMileTime := triggerTime.Sub(result.StartTime).Seconds()
 				result.EighthMileTime = &eighthMileTime
+				if speed, ok := ts.trapSpeed(result, beamID, triggerTime); ok {
+					result.EighthMileSpeed = &speed
+					ts.publishTrapSpeed(lane, beamID, speed)
+				}
 
 				// Publish eighth-mile event
 				if ts.eventBus != nil {
@@ -327,9 +573,33 @@ func (ts *TimingSystem) TriggerBeam(beamID string, lane int, triggerTime time.Ti
 							WithRaceID(ts.raceID).
 							WithLane(lane).
 							WithData("time", eighthMileTime).
+							WithData("timestamp_source", string(accuracy.Source)).
+							WithData("uncertainty", accuracy.Uncertainty).
 							Build(),
 					)
 				}
+				ts.publishDeltas(beamID, result, triggerTime)
+			}
+
+		case "1000_foot":
+			// Calculate 1000-foot time from start line
+			if !result.StartTime.IsZero() {
+				time1000 := triggerTime.Sub(result.StartTime).Seconds()
+				result.ThousandFtTime = &time1000
+
+				// Publish 1000-foot event
+				if ts.eventBus != nil {
+					ts.eventBus.Publish(
+						events.NewEvent(events.EventTiming1000Foot).
+							WithRaceID(ts.raceID).
+							WithLane(lane).
+							WithData("time", time1000).
+							WithData("timestamp_source", string(accuracy.Source)).
+							WithData("uncertainty", accuracy.Uncertainty).
+							Build(),
+					)
+				}
+				ts.publishDeltas(beamID, result, triggerTime)
 			}
 
 		case "1320_foot":
@@ -338,10 +608,19 @@ func (ts *TimingSystem) TriggerBeam(beamID string, lane int, triggerTime time.Ti
 				quarterMileTime := triggerTime.Sub(result.StartTime).Seconds()
 				result.QuarterMileTime = &quarterMileTime
 				result.IsComplete = true
-
-				// Calculate trap speed (simplified calculation)
-				trapSpeed := 1320.0 / quarterMileTime * 0.681818 // Convert ft/s to mph
+				ts.markRecorders(SyncLabelFinish, lane, triggerTime)
+
+				// Speed through the trap, or on a layout without one the
+				// average over the whole run
+				trapSpeed, measured := ts.trapSpeed(result, beamID, triggerTime)
+				if measured {
+					ts.publishTrapSpeed(lane, beamID, trapSpeed)
+				} else {
+					trapSpeed = 1320.0 / quarterMileTime * feetPerSecondToMPH
+				}
 				result.TrapSpeed = &trapSpeed
+				ts.checkTrapSpeed(result, trapSpeed)
+				ts.checkBreakout(result)
 
 				// Publish quarter-mile event
 				if ts.eventBus != nil {
@@ -351,14 +630,291 @@ func (ts *TimingSystem) TriggerBeam(beamID string, lane int, triggerTime time.Ti
 							WithLane(lane).
 							WithData("time", quarterMileTime).
 							WithData("trap_speed", trapSpeed).
+							WithData("timestamp_source", string(accuracy.Source)).
+							WithData("uncertainty", accuracy.Uncertainty).
 							Build(),
 					)
 				}
 			}
+
+		case "guard":
+			ts.checkGuardTrip(result, triggerTime, accuracy)
+
+		default:
+			if beam != nil && beam.Shutdown {
+				ts.checkShutdown(result, beam, triggerTime)
+			}
+		}
+	}
+}
+
+// beamTriggerData returns the data of a timing.beam_trigger event: the beam
+// and the trigger's timestamp source and uncertainty. It is built once per
+// beam and accuracy and shared by every such event, so handlers must not
+// modify it. Must be called with ts.mu held.
+func beamTriggerData(beam *TimingBeam, beamID string, accuracy timers.Accuracy) map[string]interface{} {
+	if beam != nil {
+		if data, ok := beam.triggerData[accuracy]; ok {
+			return data
+		}
+	}
+	data := map[string]interface{}{
+		"beam_id":          beamID,
+		"timestamp_source": string(accuracy.Source),
+		"uncertainty":      accuracy.Uncertainty,
+	}
+	if beam != nil && len(beam.triggerData) < maxTriggerData {
+		if beam.triggerData == nil {
+			beam.triggerData = make(map[timers.Accuracy]map[string]interface{})
+		}
+		beam.triggerData[accuracy] = data
+	}
+	return data
+}
+
+// checkGuardTrip classifies a guard beam trip. After the lane's green the
+// car is simply leaving; before it, the car has rolled in too deep and
+// red-lights, as soon as the green time is known. Must be called with ts.mu
+// held.
+func (ts *TimingSystem) checkGuardTrip(result *TimingResults, at time.Time, accuracy timers.Accuracy) {
+	beforeGreen := !ts.hasGreen(result.Lane) || at.Before(ts.laneGreen(result.Lane))
+	if ts.eventBus != nil {
+		ts.eventBus.Publish(
+			events.NewEvent(events.EventTimingGuardTrip).
+				WithRaceID(ts.raceID).
+				WithLane(result.Lane).
+				WithData("trigger_time", at).
+				WithData("before_green", beforeGreen).
+				WithData("timestamp_source", string(accuracy.Source)).
+				WithData("uncertainty", accuracy.Uncertainty).
+				Build(),
+		)
+	}
+	if !beforeGreen || result.GuardTrip != nil {
+		return
+	}
+	result.GuardTrip = &at
+	if ts.hasGreen(result.Lane) {
+		ts.guardFoul(result, at)
+	}
+}
+
+// guardFoul red-lights a lane that tripped the guard beam before its green.
+// Must be called with ts.mu held.
+func (ts *TimingSystem) guardFoul(result *TimingResults, at time.Time) {
+	if result.IsFoul {
+		return
+	}
+	reactionTime := at.Sub(ts.laneGreen(result.Lane)).Seconds()
+	result.IsFoul = true
+	result.FoulReason = "red_light"
+	ts.log().Warn("🚨 Guard beam red light", logs.KeyLane, result.Lane, "reaction_time", reactionTime)
+	ts.publishRedLight(result.Lane, reactionTime, at)
+}
+
+// publishRedLight reports a lane leaving before its green at the given time
+// to the red-light handler and publishes it. Must be called with ts.mu held.
+func (ts *TimingSystem) publishRedLight(lane int, reactionTime float64, at time.Time) {
+	if ts.onRedLight != nil {
+		ts.onRedLight(lane, reactionTime)
+	}
+	if ts.eventBus == nil {
+		return
+	}
+	ts.eventBus.Publish(
+		events.NewEvent(events.EventTreeRedLight).
+			WithRaceID(ts.raceID).
+			WithLane(lane).
+			WithData("reaction_time", reactionTime).
+			WithData("at", at).
+			Build(),
+	)
+	ts.eventBus.Publish(
+		events.NewEvent(events.EventRaceFoul).
+			WithRaceID(ts.raceID).
+			WithLane(lane).
+			WithData("reason", "red_light").
+			WithData("at", at).
+			Build(),
+	)
+}
+
+// StagingTimeoutFoul red-lights a lane that failed to stage before the
+// auto-start staging timeout, elapsed after the staging clock started. The
+// lane has no reaction time, so the foul is decided as a foul rather than
+// against an opponent's red light. A lane that has already fouled keeps its
+// foul.
+func (ts *TimingSystem) StagingTimeoutFoul(lane int, elapsed time.Duration, at time.Time) error {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	result, exists := ts.results[lane]
+	if !exists {
+		return fmt.Errorf("no run in lane %d", lane)
+	}
+	if result.IsFoul {
+		return nil
+	}
+	result.IsFoul = true
+	result.FoulReason = "red_light"
+	ts.log().Warn("🚨 Staging timeout red light", logs.KeyLane, lane, "elapsed", elapsed)
+
+	if ts.eventBus != nil {
+		ts.eventBus.Publish(
+			events.NewEvent(events.EventRaceFoul).
+				WithRaceID(ts.raceID).
+				WithLane(lane).
+				WithData("reason", "red_light").
+				WithData("detail", "staging_timeout").
+				WithData("elapsed_staging", elapsed.Seconds()).
+				WithData("at", at).
+				Build(),
+		)
+	}
+	return nil
+}
+
+// ReportBoundaryFoul records a lane crossing the centerline or its outside
+// boundary at the given time, reported by boundary sensors or an official.
+// A boundary foul is worse than a red light, so it replaces one as the
+// lane's foul reason. Like manual entries, it is accepted after the results
+// are final.
+func (ts *TimingSystem) ReportBoundaryFoul(lane int, at time.Time) error {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	result, exists := ts.results[lane]
+	if !exists {
+		return fmt.Errorf("no run in lane %d", lane)
+	}
+	if result.IsFoul && result.FoulReason == "boundary" {
+		return nil
+	}
+	result.IsFoul = true
+	result.FoulReason = "boundary"
+	ts.log().Warn("🚨 Boundary foul", logs.KeyLane, lane)
+
+	if ts.eventBus != nil {
+		ts.eventBus.Publish(
+			events.NewEvent(events.EventRaceFoul).
+				WithRaceID(ts.raceID).
+				WithLane(lane).
+				WithData("reason", "boundary").
+				WithData("at", at).
+				Build(),
+		)
+	}
+	return nil
+}
+
+// Disqualify records a starter's disqualification of a lane at the given
+// time, for a lane that is not allowed to race or is excluded from the
+// result. It replaces any other foul as the lane's foul reason.
+func (ts *TimingSystem) Disqualify(lane int, reason string, at time.Time) error {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	result, exists := ts.results[lane]
+	if !exists {
+		return fmt.Errorf("no run in lane %d", lane)
+	}
+	if result.IsFoul && result.FoulReason == "disqualified" {
+		return nil
+	}
+	result.IsFoul = true
+	result.FoulReason = "disqualified"
+	ts.log().Warn("🚫 Disqualified", logs.KeyLane, lane, "reason", reason)
+
+	if ts.eventBus != nil {
+		ts.eventBus.Publish(
+			events.NewEvent(events.EventRaceFoul).
+				WithRaceID(ts.raceID).
+				WithLane(lane).
+				WithData("reason", "disqualified").
+				WithData("detail", reason).
+				WithData("at", at).
+				Build(),
+		)
+	}
+	return nil
+}
+
+// checkBreakout flags a finish quicker than the lane's dial-in. Must be
+// called with ts.mu held.
+func (ts *TimingSystem) checkBreakout(result *TimingResults) {
+	if result.DialIn == nil || result.QuarterMileTime == nil {
+		return
+	}
+	by, broke := handicap.Breakout(*result.QuarterMileTime, *result.DialIn)
+	if !broke {
+		return
+	}
+	result.Breakout = true
+	ts.log().Info("⚠️ Breakout", logs.KeyLane, result.Lane, "by", by, "dial_in", *result.DialIn)
+
+	if ts.eventBus != nil {
+		ts.eventBus.Publish(
+			events.NewEvent(events.EventTimingBreakout).
+				WithRaceID(ts.raceID).
+				WithLane(result.Lane).
+				WithData("dial_in", *result.DialIn).
+				WithData("elapsed_time", *result.QuarterMileTime).
+				WithData("by", by).
+				Build(),
+		)
+	}
+}
+
+// Finalize marks the race's results final. Beam triggers arriving later
+// (a late finish beam, a car coasting through the traps) are ignored until
+// the next race; manual entries are still accepted as official corrections.
+func (ts *TimingSystem) Finalize() {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.finalized = true
+}
+
+// IsFinalized reports whether the race's results are final
+func (ts *TimingSystem) IsFinalized() bool {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	return ts.finalized
+}
+
+// Settled reports whether every lane has finished, or fouled without
+// leaving the line, so no more beam data is expected. A fouled lane that
+// left, or rolled through the guard beam, still runs to the stripe for its
+// time slip.
+func (ts *TimingSystem) Settled() bool {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+
+	for _, result := range ts.results {
+		if !result.settled() {
+			return false
 		}
+	}
+	return true
+}
 
-		fmt.Printf("🏁 libdrag Timing: Lane %d triggered %s beam at %v\n", lane, beamID, triggerTime)
+// Accuracy returns the least accurate source of the run's times: its beam
+// timestamps and any manually entered times. A run whose accuracy is
+// Degraded should be disclosed as such.
+func (r *TimingResults) Accuracy() timers.Accuracy {
+	var worst timers.Accuracy
+	for _, accuracy := range r.Timestamps {
+		worst = timers.Worst(worst, accuracy)
+	}
+	if r.Manual != nil {
+		worst = timers.Worst(worst, ManualAccuracy(r.Manual.Method))
 	}
+	return worst
+}
+
+// settled reports whether a lane expects no more beam data. Caller holds
+// ts.mu.
+func (r *TimingResults) settled() bool {
+	return r.IsComplete || (r.IsFoul && r.StartTime.IsZero() && r.GuardTrip == nil)
 }
 
 func (ts *TimingSystem) GetResults(lane int) *TimingResults {
@@ -366,19 +922,53 @@ func (ts *TimingSystem) GetResults(lane int) *TimingResults {
 	defer ts.mu.RUnlock()
 
 	if result, exists := ts.results[lane]; exists {
-		return result
+		return result.clone()
 	}
 	return nil
 }
 
+// Version returns the version of the timing results, which moves whenever
+// they may have changed. Take it before GetAllResults.
+func (ts *TimingSystem) Version() uint64 {
+	return ts.mu.Version()
+}
+
 func (ts *TimingSystem) GetAllResults() map[int]*TimingResults {
 	ts.mu.RLock()
 	defer ts.mu.RUnlock()
 
-	// Return a copy to avoid race conditions
+	// Return copies to avoid race conditions
 	results := make(map[int]*TimingResults)
 	for lane, result := range ts.results {
-		results[lane] = result
+		results[lane] = result.clone()
 	}
 	return results
 }
+
+// clone copies a result so callers can read it while the race continues.
+// Pointer fields are replaced rather than written through, so only maps
+// and slices need copying. Caller holds ts.mu.
+func (r *TimingResults) clone() *TimingResults {
+	c := *r
+	if r.BeamTriggers != nil {
+		c.BeamTriggers = make(map[string]time.Time, len(r.BeamTriggers))
+		for beamID, t := range r.BeamTriggers {
+			c.BeamTriggers[beamID] = t
+		}
+	}
+	if r.ShutdownSpeeds != nil {
+		c.ShutdownSpeeds = make(map[string]float64, len(r.ShutdownSpeeds))
+		for beamID, speed := range r.ShutdownSpeeds {
+			c.ShutdownSpeeds[beamID] = speed
+		}
+	}
+	if r.Timestamps != nil {
+		c.Timestamps = make(map[string]timers.Accuracy, len(r.Timestamps))
+		for beamID, accuracy := range r.Timestamps {
+			c.Timestamps[beamID] = accuracy
+		}
+	}
+	c.SyncMarks = append([]SyncMark(nil), r.SyncMarks...)
+	c.TechReview = append([]string(nil), r.TechReview...)
+	return &c
+}
@@ -2,10 +2,13 @@ package timing
 
 import (
 	"context"
+	"math"
 	"testing"
 	"time"
 
 	"github.com/benharold/libdrag/pkg/config"
+	"github.com/benharold/libdrag/pkg/events"
+	"github.com/benharold/libdrag/pkg/timers"
 )
 
 func TestNewTimingSystem(t *testing.T) {
@@ -177,6 +180,9 @@ func TestRedLightDetection(t *testing.T) {
 	}
 
 	// Arm race and add vehicles
+	redLights := make(map[int]float64)
+	ts.SetRedLightHandler(func(lane int, reactionTime float64) { redLights[lane] = reactionTime })
+
 	ts.StartRace()
 	ts.AddVehicles([]int{1, 2})
 
@@ -202,4 +208,550 @@ func TestRedLightDetection(t *testing.T) {
 	if result.FoulReason != "red_light" {
 		t.Fatalf("Expected foul reason 'red_light', got '%s'", result.FoulReason)
 	}
+	if len(redLights) != 1 || redLights[1] != -0.1 {
+		t.Fatalf("Expected the red-light handler called for lane 1 at -0.100, got %v", redLights)
+	}
+}
+
+// frameRecorder maps timing-system time to frames of a 60 fps recording
+type frameRecorder struct {
+	started time.Time
+}
+
+func (r frameRecorder) SyncMark(label string, lane int, at time.Time) (SyncMark, bool) {
+	offset := at.Sub(r.started)
+	return SyncMark{
+		Source:    "finish_cam",
+		Frame:     int64(offset.Seconds() * 60),
+		MediaTime: offset,
+	}, true
+}
+
+func TestSyncMarks(t *testing.T) {
+	ts := NewTimingSystem()
+	ts.Initialize(context.Background(), config.NewDefaultConfig())
+
+	start := time.Now()
+	ts.AddSyncRecorder(frameRecorder{started: start})
+	ts.StartRace()
+	ts.AddVehicles([]int{1, 2})
+
+	green := start.Add(10 * time.Second)
+	ts.SetGreenLight(green)
+	ts.TriggerBeam("stage", 1, green.Add(500*time.Millisecond))
+	ts.TriggerBeam("1320_foot", 1, green.Add(8*time.Second))
+
+	marks := ts.GetSyncMarks(1)
+	if len(marks) != 2 {
+		t.Fatalf("Expected green and finish marks for lane 1, got %+v", marks)
+	}
+	if marks[0].Label != SyncLabelGreen || marks[0].Frame != 600 {
+		t.Errorf("Unexpected green mark %+v", marks[0])
+	}
+	if marks[1].Label != SyncLabelFinish || marks[1].Lane != 1 || marks[1].Frame != 1080 {
+		t.Errorf("Unexpected finish mark %+v", marks[1])
+	}
+	if len(ts.GetSyncMarks(2)) != 1 {
+		t.Errorf("Expected only the green mark for lane 2, got %+v", ts.GetSyncMarks(2))
+	}
+
+	// Marks registered by review software after the fact
+	if err := ts.AddSyncMark(SyncMark{Source: "tower_cam", Label: "finish", Lane: 2, At: green.Add(8 * time.Second), Frame: 4321}); err != nil {
+		t.Fatalf("AddSyncMark failed: %v", err)
+	}
+	if err := ts.AddSyncMark(SyncMark{Source: "tower_cam", Label: "finish", Lane: 3, At: green}); err == nil {
+		t.Error("Expected error for a lane without a run")
+	}
+	if results := ts.GetResults(2); len(results.SyncMarks) != 2 {
+		t.Errorf("Expected marks stored with lane 2 results, got %+v", results.SyncMarks)
+	}
+}
+
+func TestManualResults(t *testing.T) {
+	ts := NewTimingSystem()
+	ts.Initialize(context.Background(), config.NewDefaultConfig())
+	ts.StartRace()
+	ts.AddVehicles([]int{1, 2})
+
+	green := time.Now()
+	ts.SetGreenLight(green)
+	ts.TriggerBeam("stage", 1, green.Add(450*time.Millisecond))
+
+	et := 7.812
+	if err := ts.EnterManualResult(ManualResult{Lane: 1, QuarterMileTime: &et}); err == nil {
+		t.Fatal("Expected error without provenance")
+	}
+	if err := ts.EnterManualResult(ManualResult{Lane: 1, EnteredBy: "chief", Method: ManualHandTimed}); err == nil {
+		t.Fatal("Expected error for an entry without times")
+	}
+
+	if err := ts.EnterManualResult(ManualResult{Lane: 1, QuarterMileTime: &et, EnteredBy: "chief", Method: ManualHandTimed, Reason: "finish beam down"}); err != nil {
+		t.Fatalf("EnterManualResult failed: %v", err)
+	}
+	result := ts.GetResults(1)
+	if !result.IsComplete || *result.QuarterMileTime != et || *result.ReactionTime != 0.45 {
+		t.Errorf("Unexpected lane 1 results %+v", result)
+	}
+	if result.Manual == nil || result.Manual.EnteredBy != "chief" || len(result.Manual.Fields) != 1 || result.Manual.Fields[0] != "quarter_mile_time" {
+		t.Errorf("Unexpected provenance %+v", result.Manual)
+	}
+
+	// Lane 2 never broke the stage beam; a manual RT places its start
+	rt := 0.5
+	if err := ts.EnterManualResult(ManualResult{Lane: 2, ReactionTime: &rt, EnteredBy: "chief", Method: ManualBackup}); err != nil {
+		t.Fatalf("EnterManualResult failed: %v", err)
+	}
+	if err := ts.EnterManualResult(ManualResult{Lane: 2, QuarterMileTime: &et, EnteredBy: "chief", Method: ManualBackup}); err != nil {
+		t.Fatalf("EnterManualResult failed: %v", err)
+	}
+	result = ts.GetResults(2)
+	if !result.StartTime.Equal(green.Add(500*time.Millisecond)) || len(result.Manual.Fields) != 2 {
+		t.Errorf("Unexpected lane 2 results %+v (%+v)", result, result.Manual)
+	}
+}
+
+func TestTruncateReactionTime(t *testing.T) {
+	tests := []struct {
+		raw      time.Duration
+		expected float64
+	}{
+		{500 * time.Millisecond, 0.5},
+		{4999 * time.Microsecond, 0.004},
+		{900 * time.Microsecond, 0},
+		{0, 0},
+		{-100 * time.Microsecond, -0.001},
+		{-1 * time.Millisecond, -0.001},
+		{-1500 * time.Microsecond, -0.002},
+	}
+	for _, tt := range tests {
+		if got := TruncateReactionTime(tt.raw); got != tt.expected {
+			t.Errorf("TruncateReactionTime(%v): expected %v, got %v", tt.raw, tt.expected, got)
+		}
+	}
+}
+
+func TestPerfectLight(t *testing.T) {
+	ts := NewTimingSystem()
+	if err := ts.Initialize(context.Background(), config.NewDefaultConfig()); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	ts.StartRace()
+	ts.AddVehicles([]int{1, 2})
+
+	green := time.Now()
+	ts.SetGreenLight(green)
+	ts.TriggerBeam("stage", 1, green.Add(700*time.Microsecond))
+	ts.TriggerBeam("stage", 2, green.Add(-300*time.Microsecond))
+
+	if result := ts.GetResults(1); *result.ReactionTime != 0 || !result.PerfectLight || result.IsFoul {
+		t.Errorf("Expected a perfect light in lane 1, got %+v", result)
+	}
+	if result := ts.GetResults(2); *result.ReactionTime != -0.001 || result.PerfectLight || !result.IsFoul {
+		t.Errorf("Expected a red light in lane 2, got %+v", result)
+	}
+}
+
+func TestShutdownOverrun(t *testing.T) {
+	ts := NewTimingSystem()
+	ts.Initialize(context.Background(), config.NewDefaultConfig())
+	bus := events.NewEventBus(false)
+	var overruns []events.Event
+	bus.Subscribe(events.EventShutdownOverrun, func(e events.Event) { overruns = append(overruns, e) })
+	ts.SetEventBus(bus)
+	ts.StartRace()
+	ts.AddVehicles([]int{1})
+
+	green := time.Now()
+	ts.SetGreenLight(green)
+	ts.TriggerBeam("stage", 1, green.Add(500*time.Millisecond))
+	ts.TriggerBeam("1320_foot", 1, green.Add(8*time.Second))
+	// 1000 ft in 10 s is ~68 mph, under the 100 mph shutdown limit
+	ts.TriggerBeam("shutdown", 1, green.Add(18*time.Second))
+	// 500 ft in 5 s is still ~68 mph at the 40 mph turnout
+	ts.TriggerBeam("turnout", 1, green.Add(23*time.Second))
+
+	speeds := ts.GetResults(1).ShutdownSpeeds
+	if math.Abs(speeds["shutdown"]-68.18) > 0.01 || math.Abs(speeds["turnout"]-68.18) > 0.01 {
+		t.Errorf("Unexpected shutdown speeds %+v", speeds)
+	}
+	if len(overruns) != 1 || overruns[0].Data["beam_id"] != "turnout" || overruns[0].Lane != 1 {
+		t.Fatalf("Expected a single turnout over-run, got %+v", overruns)
+	}
+}
+
+func TestSpeedTraps(t *testing.T) {
+	ts := NewTimingSystem()
+	ts.Initialize(context.Background(), config.NewDefaultConfig())
+	bus := events.NewEventBus(false)
+	var traps []events.Event
+	bus.Subscribe(events.EventTimingTrapSpeed, func(e events.Event) { traps = append(traps, e) })
+	ts.SetEventBus(bus)
+	ts.StartRace()
+	ts.AddVehicles([]int{1, 2})
+
+	green := time.Now()
+	ts.SetGreenLight(green)
+	ts.TriggerBeam("stage", 1, green.Add(500*time.Millisecond))
+	ts.TriggerBeam("stage", 2, green.Add(500*time.Millisecond))
+	// 66 feet in 0.5 s is 90 mph, and in 0.3 s 150 mph
+	ts.TriggerBeam("eighth_trap", 1, green.Add(6*time.Second))
+	ts.TriggerBeam("660_foot", 1, green.Add(6500*time.Millisecond))
+	ts.TriggerBeam("speed_trap", 1, green.Add(10*time.Second))
+	ts.TriggerBeam("1320_foot", 1, green.Add(10300*time.Millisecond))
+	// Lane 2's trap beams never saw it
+	ts.TriggerBeam("660_foot", 2, green.Add(6500*time.Millisecond))
+	ts.TriggerBeam("1320_foot", 2, green.Add(10500*time.Millisecond))
+
+	lane1, lane2 := ts.GetResults(1), ts.GetResults(2)
+	if lane1.EighthMileSpeed == nil || math.Abs(*lane1.EighthMileSpeed-90) > 0.01 {
+		t.Errorf("Expected a 90 mph eighth-mile speed, got %v", lane1.EighthMileSpeed)
+	}
+	if lane1.TrapSpeed == nil || math.Abs(*lane1.TrapSpeed-150) > 0.01 {
+		t.Errorf("Expected a 150 mph trap speed, got %v", lane1.TrapSpeed)
+	}
+	if len(traps) != 2 || traps[1].Data["beam_id"] != "1320_foot" || traps[1].Data["trap_length"] != 66.0 {
+		t.Errorf("Expected a trap speed event per trap, got %+v", traps)
+	}
+	// Without its trap crossings the lane falls back to its average speed
+	if lane2.EighthMileSpeed != nil || lane2.TrapSpeed == nil || math.Abs(*lane2.TrapSpeed-90) > 0.01 {
+		t.Errorf("Expected lane 2's 1320 ft in 10 s to average 90 mph, got %v", lane2.TrapSpeed)
+	}
+}
+
+func TestTrapSpeedTechReview(t *testing.T) {
+	cfg := config.NewDefaultConfig()
+	cfg.TimingConfig.ClassMaxTrapSpeed = map[string]float64{"Sportsman": 110}
+	cfg.TimingConfig.LicenseMaxTrapSpeed = map[string]float64{"A": 200, "E": 125}
+
+	ts := NewTimingSystem()
+	ts.Initialize(context.Background(), cfg)
+	bus := events.NewEventBus(false)
+	var alerts []events.Event
+	bus.Subscribe(events.EventTimingTechReview, func(e events.Event) { alerts = append(alerts, e) })
+	ts.SetEventBus(bus)
+	ts.SetLicenses(map[int]string{1: "A", 2: "E"})
+	ts.StartRace()
+	ts.AddVehicles([]int{1, 2})
+
+	green := time.Now()
+	ts.SetGreenLight(green)
+	// Lane 1: 1320 ft in 7.5 s traps ~120 mph, over the class limit only
+	ts.TriggerBeam("stage", 1, green.Add(500*time.Millisecond))
+	ts.TriggerBeam("1320_foot", 1, green.Add(8*time.Second))
+	// Lane 2: 1320 ft in 7 s traps ~129 mph, over both limits
+	ts.TriggerBeam("stage", 2, green.Add(500*time.Millisecond))
+	ts.TriggerBeam("1320_foot", 2, green.Add(7500*time.Millisecond))
+
+	if review := ts.GetResults(1).TechReview; len(review) != 1 || review[0] != TechReviewClassSpeed {
+		t.Errorf("Expected lane 1 flagged for class speed, got %v", review)
+	}
+	if review := ts.GetResults(2).TechReview; len(review) != 2 || review[1] != TechReviewLicenseSpeed {
+		t.Errorf("Expected lane 2 flagged for class and license speed, got %v", review)
+	}
+	if len(alerts) != 3 || alerts[2].Data["category"] != "E" || alerts[2].Data["limit"] != 125.0 {
+		t.Errorf("Unexpected tech review alerts %+v", alerts)
+	}
+}
+
+// BenchmarkTriggerBeam measures the per-trigger cost of the beam -> timing
+// -> event path at hardware polling rates
+func BenchmarkTriggerBeam(b *testing.B) {
+	ts := NewTimingSystem()
+	ts.Initialize(context.Background(), config.NewDefaultConfig())
+	bus := events.NewEventBus(false)
+	bus.Subscribe(events.EventTimingBeamTrigger, func(events.Event) {})
+	ts.SetEventBus(bus)
+	ts.StartRace()
+	ts.AddVehicles([]int{1})
+	now := time.Now()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ts.TriggerBeam("330_foot", 1, now)
+	}
+}
+
+// TestTriggerBeamAllocations checks the beam trigger path allocates nothing
+// with a subscriber listening, and that the events it publishes can still be
+// kept by handlers
+func TestTriggerBeamAllocations(t *testing.T) {
+	ts := NewTimingSystem()
+	ts.Initialize(context.Background(), config.NewDefaultConfig())
+	bus := events.NewEventBus(false)
+	var kept []events.Event
+	bus.Subscribe(events.EventTimingBeamTrigger, func(e events.Event) {
+		if len(kept) < 2 {
+			kept = append(kept, e)
+		}
+	})
+	ts.SetEventBus(bus)
+	ts.SetRaceID("race-1")
+	ts.StartRace()
+	ts.AddVehicles([]int{1})
+	start := time.Now()
+
+	// Fill the race's replay buffer so appending to it no longer grows it
+	for i := 0; i < events.DefaultReplayEvents+1; i++ {
+		ts.TriggerBeam("330_foot", 1, start.Add(time.Duration(i)*time.Millisecond))
+	}
+	now := start
+	if allocs := testing.AllocsPerRun(1000, func() {
+		now = now.Add(time.Millisecond)
+		ts.TriggerBeam("330_foot", 1, now)
+	}); allocs != 0 {
+		t.Errorf("Expected no allocations per trigger, got %v", allocs)
+	}
+
+	if len(kept) != 2 || !kept[0].Timestamp.Equal(start) || !kept[1].Timestamp.Equal(start.Add(time.Millisecond)) {
+		t.Fatalf("Expected each trigger's time as its event's timestamp, got %+v", kept)
+	}
+	if kept[1].Data["beam_id"] != "330_foot" || kept[1].Data["timestamp_source"] != "host" || kept[1].RaceID != "race-1" {
+		t.Errorf("Unexpected beam trigger event %+v", kept[1])
+	}
+}
+
+func TestFinalize(t *testing.T) {
+	ts := NewTimingSystem()
+	ts.Initialize(context.Background(), config.NewDefaultConfig())
+	ts.StartRace()
+	ts.AddVehicles([]int{1, 2})
+
+	green := time.Now()
+	ts.SetGreenLight(green)
+	ts.TriggerBeam("stage", 1, green.Add(500*time.Millisecond))
+	ts.TriggerBeam("1320_foot", 1, green.Add(8*time.Second))
+	if ts.Settled() {
+		t.Fatal("Expected lane 2 to still be expected")
+	}
+
+	// A red-lit lane that left is still expected at the stripe
+	ts.TriggerBeam("stage", 2, green.Add(-100*time.Millisecond))
+	if ts.Settled() {
+		t.Fatal("Expected a red-lit lane that left to still be expected at the stripe")
+	}
+	ts.TriggerBeam("1320_foot", 2, green.Add(9*time.Second))
+	if !ts.Settled() {
+		t.Fatal("Expected both lanes settled once both finished")
+	}
+
+	ts.Finalize()
+	ts.TriggerBeam("1320_foot", 1, green.Add(12*time.Second))
+	if !ts.IsFinalized() || *ts.GetResults(1).QuarterMileTime != 7.5 {
+		t.Errorf("Expected a late finish trigger to be ignored, got %.3f", *ts.GetResults(1).QuarterMileTime)
+	}
+
+	// Manual corrections are still accepted
+	et := 7.6
+	if err := ts.EnterManualResult(ManualResult{Lane: 1, QuarterMileTime: &et, EnteredBy: "tower", Method: ManualBackup}); err != nil {
+		t.Fatalf("Expected a manual entry after finalizing, got %v", err)
+	}
+
+	ts.StartRace()
+	if ts.IsFinalized() {
+		t.Error("Expected the next race to accept beam data")
+	}
+}
+
+func TestHandicapStart(t *testing.T) {
+	if delays := HandicapDelays(map[int]float64{1: 10.50}, []int{1, 2}); delays != nil {
+		t.Errorf("Expected no handicap unless every lane has a dial, got %v", delays)
+	}
+
+	bus := events.NewEventBus(false)
+	var breakouts []events.Event
+	bus.Subscribe(events.EventTimingBreakout, func(e events.Event) { breakouts = append(breakouts, e) })
+
+	ts := NewTimingSystem()
+	ts.Initialize(context.Background(), config.NewDefaultConfig())
+	ts.SetEventBus(bus)
+	ts.StartRace()
+	ts.AddVehicles([]int{1, 2})
+
+	// The quicker dial waits out the 0.70 difference
+	delays := ts.SetDialIns(map[int]float64{1: 10.50, 2: 11.20})
+	if delays[1] != 700*time.Millisecond || delays[2] != 0 {
+		t.Fatalf("Expected lane 1 to start 0.7s late, got %v", delays)
+	}
+
+	green := time.Now()
+	ts.SetGreenLight(green)
+	ts.TriggerBeam("stage", 2, green.Add(30*time.Millisecond))
+	ts.TriggerBeam("stage", 1, green.Add(720*time.Millisecond))
+	lane1, lane2 := ts.GetResults(1), ts.GetResults(2)
+	if lane1.IsFoul || *lane1.ReactionTime != 0.02 || *lane2.ReactionTime != 0.03 {
+		t.Fatalf("Expected reaction times from each lane's own green, got %v and %v", *lane1.ReactionTime, *lane2.ReactionTime)
+	}
+	if lane1.StartDelay != 0.7 || *lane1.DialIn != 10.50 {
+		t.Errorf("Expected lane 1's dial and delay on its results, got %+v", lane1)
+	}
+
+	// Lane 1 runs under its dial
+	ts.TriggerBeam("1320_foot", 1, green.Add(720*time.Millisecond+10490*time.Millisecond))
+	ts.TriggerBeam("1320_foot", 2, green.Add(30*time.Millisecond+11250*time.Millisecond))
+	if !ts.GetResults(1).Breakout || ts.GetResults(2).Breakout {
+		t.Errorf("Expected only lane 1 to break out")
+	}
+	if len(breakouts) != 1 || breakouts[0].Lane != 1 {
+		t.Errorf("Expected a breakout event for lane 1, got %+v", breakouts)
+	}
+}
+
+func TestLaneDeltas(t *testing.T) {
+	ts := NewTimingSystem()
+	ts.Initialize(context.Background(), config.NewDefaultConfig())
+	bus := events.NewEventBus(false)
+	var deltas []events.Event
+	bus.Subscribe(events.EventTimingDelta, func(e events.Event) { deltas = append(deltas, e) })
+	ts.SetEventBus(bus)
+	ts.StartRace()
+	ts.AddVehicles([]int{1, 2})
+
+	green := time.Now()
+	ts.SetGreenLight(green)
+	ts.TriggerBeam("stage", 1, green.Add(100*time.Millisecond))
+	ts.TriggerBeam("stage", 2, green.Add(50*time.Millisecond))
+	// Lane 2 left first and leads at 60 feet despite the slower 60-foot time
+	ts.TriggerBeam("60_foot", 2, green.Add(1050*time.Millisecond))
+	if len(deltas) != 0 {
+		t.Fatalf("Expected no delta until both lanes cross, got %+v", deltas)
+	}
+	ts.TriggerBeam("60_foot", 1, green.Add(1080*time.Millisecond))
+	// Lane 1 reports the eighth mile first, with a later trigger time
+	ts.TriggerBeam("660_foot", 1, green.Add(4100*time.Millisecond))
+	ts.TriggerBeam("660_foot", 2, green.Add(4000*time.Millisecond))
+
+	if len(deltas) != 2 {
+		t.Fatalf("Expected a delta per shared beam, got %+v", deltas)
+	}
+	sixty := deltas[0].Data
+	if sixty["beam_id"] != "60_foot" || sixty["leader_lane"] != 2 || sixty["trailing_lane"] != 1 || deltas[0].Lane != 1 {
+		t.Errorf("Expected lane 2 ahead at 60 feet, got %+v", sixty)
+	}
+	if math.Abs(sixty["gap"].(float64)-0.03) > 1e-9 || math.Abs(sixty["elapsed_delta"].(float64)+0.02) > 1e-9 {
+		t.Errorf("Expected a .030 gap with lane 1 .020 quicker from its start, got %+v", sixty)
+	}
+	if eighth := deltas[1].Data; eighth["leader_lane"] != 2 || math.Abs(eighth["gap"].(float64)-0.1) > 1e-9 {
+		t.Errorf("Expected lane 2 ahead by .100 at the eighth mile, got %+v", eighth)
+	}
+}
+
+func TestGuardBeamTrip(t *testing.T) {
+	ts := NewTimingSystem()
+	if err := ts.Initialize(context.Background(), config.NewDefaultConfig()); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	bus := events.NewEventBus(false)
+	ts.SetEventBus(bus)
+	var trips []events.Event
+	redLights := make(map[int]events.Event)
+	bus.Subscribe(events.EventTimingGuardTrip, func(e events.Event) { trips = append(trips, e) })
+	bus.Subscribe(events.EventTreeRedLight, func(e events.Event) { redLights[e.Lane] = e })
+
+	ts.StartRace()
+	ts.AddVehicles([]int{1, 2})
+	green := time.Now()
+
+	// Lane 1 rolls through the guard beam while the tree is coming down
+	ts.TriggerBeam("guard", 1, green.Add(-300*time.Millisecond))
+	ts.TriggerBeam("guard", 1, green.Add(-200*time.Millisecond))
+	if result := ts.GetResults(1); result.IsFoul || result.GuardTrip == nil {
+		t.Fatalf("Expected the guard trip held until green, got %+v", result)
+	}
+	if ts.Settled() {
+		t.Error("A lane that rolled through the guard beam has not settled")
+	}
+
+	ts.SetGreenLight(green)
+	result := ts.GetResults(1)
+	if !result.IsFoul || result.FoulReason != "red_light" {
+		t.Fatalf("Expected a guard beam red light, got %+v", result)
+	}
+	if at := redLights[1].Data["at"]; at != green.Add(-300*time.Millisecond) {
+		t.Errorf("Expected the red light at the first guard trip, got %v", at)
+	}
+
+	// Lane 2 trips it leaving on green
+	ts.TriggerBeam("stage", 2, green.Add(450*time.Millisecond))
+	ts.TriggerBeam("guard", 2, green.Add(500*time.Millisecond))
+	if result := ts.GetResults(2); result.IsFoul || result.GuardTrip != nil {
+		t.Errorf("A guard trip after green is not a foul, got %+v", result)
+	}
+	if len(trips) != 3 || trips[2].Data["before_green"] != false {
+		t.Errorf("Expected three guard trip events, the last after green, got %+v", trips)
+	}
+	if _, ok := redLights[2]; ok {
+		t.Error("Lane 2 should not red-light")
+	}
+}
+
+func TestTimestampSources(t *testing.T) {
+	ts := NewTimingSystem()
+	ts.Initialize(context.Background(), config.NewDefaultConfig())
+	bus := events.NewEventBus(false)
+	ts.SetEventBus(bus)
+	var triggers []events.Event
+	bus.Subscribe(events.EventTimingBeamTrigger, func(e events.Event) { triggers = append(triggers, e) })
+
+	ts.StartRace()
+	ts.AddVehicles([]int{1, 2})
+	green := time.Now()
+	ts.SetGreenLight(green)
+
+	hardware := timers.AccuracyOf(timers.SourceHardware)
+	ts.TriggerBeamFrom("stage", 1, green.Add(450*time.Millisecond), hardware)
+	ts.TriggerBeam("stage", 2, green.Add(500*time.Millisecond))
+
+	if got := ts.GetResults(1).Timestamps["stage"]; got != hardware {
+		t.Errorf("Expected a hardware timestamp, got %+v", got)
+	}
+	if got := ts.GetResults(2).Accuracy(); got.Source != timers.SourceHost || got.Degraded() {
+		t.Errorf("Expected an accurate host timestamp by default, got %+v", got)
+	}
+	if len(triggers) != 2 || triggers[0].Data["timestamp_source"] != "hardware" || triggers[1].Data["timestamp_source"] != "host" {
+		t.Errorf("Expected beam trigger events labeled with their source, got %+v", triggers)
+	}
+
+	// A hand-timed ET degrades the run
+	et := 7.9
+	if err := ts.EnterManualResult(ManualResult{Lane: 1, QuarterMileTime: &et, EnteredBy: "chief", Method: ManualHandTimed}); err != nil {
+		t.Fatalf("EnterManualResult failed: %v", err)
+	}
+	if got := ts.GetResults(1).Accuracy(); got.Source != timers.SourceManual || !got.Degraded() {
+		t.Errorf("Expected a degraded manual run, got %+v", got)
+	}
+}
+
+func TestStagingTimeoutFoul(t *testing.T) {
+	ts := NewTimingSystem()
+	if err := ts.Initialize(context.Background(), config.NewDefaultConfig()); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	bus := events.NewEventBus(false)
+	ts.SetEventBus(bus)
+	var fouls []events.Event
+	bus.Subscribe(events.EventRaceFoul, func(e events.Event) { fouls = append(fouls, e) })
+
+	ts.StartRace()
+	ts.AddVehicles([]int{1, 2})
+	if err := ts.StagingTimeoutFoul(3, 10*time.Second, time.Now()); err == nil {
+		t.Error("Expected an error for a lane without a run")
+	}
+
+	if err := ts.StagingTimeoutFoul(2, 10*time.Second, time.Now()); err != nil {
+		t.Fatalf("StagingTimeoutFoul failed: %v", err)
+	}
+	if result := ts.GetResults(2); !result.IsFoul || result.FoulReason != "red_light" || result.ReactionTime != nil {
+		t.Errorf("Expected a red light without a reaction time, got %+v", result)
+	}
+	if len(fouls) != 1 || fouls[0].Lane != 2 || fouls[0].Data["detail"] != "staging_timeout" || fouls[0].Data["elapsed_staging"] != 10.0 {
+		t.Fatalf("Expected one staging timeout foul event, got %+v", fouls)
+	}
+
+	// A lane already fouled keeps its foul
+	ts.Disqualify(1, "no helmet", time.Now())
+	ts.StagingTimeoutFoul(1, 10*time.Second, time.Now())
+	if result := ts.GetResults(1); result.FoulReason != "disqualified" || len(fouls) != 2 {
+		t.Errorf("Expected the disqualification to stand, got %+v", result)
+	}
 }
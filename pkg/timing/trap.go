@@ -0,0 +1,51 @@
+package timing
+
+import (
+	"time"
+
+	"github.com/benharold/libdrag/pkg/events"
+)
+
+// trapEntries maps each speed trap's exit beam to the beam that opens it.
+// A trap's speed is averaged over the window between the two, 66 feet on a
+// standard layout.
+var trapEntries = map[string]string{
+	"660_foot":  "eighth_trap",
+	"1320_foot": "speed_trap",
+}
+
+// trapSpeed returns the speed (mph) through the trap ending at exitID, from
+// the lane's crossing of the trap's entry beam. It returns false when the
+// layout has no trap there or the lane never crossed its entry. Caller
+// holds ts.mu.
+func (ts *TimingSystem) trapSpeed(result *TimingResults, exitID string, exitTime time.Time) (float64, bool) {
+	entryID := trapEntries[exitID]
+	entry, exit := ts.beams[entryID], ts.beams[exitID]
+	if entry == nil || exit == nil || exit.Position <= entry.Position {
+		return 0, false
+	}
+	entered, ok := result.BeamTriggers[entryID]
+	if !ok || !entered.Before(exitTime) {
+		return 0, false
+	}
+	return (exit.Position - entry.Position) / exitTime.Sub(entered).Seconds() * feetPerSecondToMPH, true
+}
+
+// publishTrapSpeed publishes a speed measured through a trap. Caller holds
+// ts.mu.
+func (ts *TimingSystem) publishTrapSpeed(lane int, exitID string, speed float64) {
+	if ts.eventBus == nil {
+		return
+	}
+	entryID := trapEntries[exitID]
+	ts.eventBus.Publish(
+		events.NewEvent(events.EventTimingTrapSpeed).
+			WithRaceID(ts.raceID).
+			WithLane(lane).
+			WithData("beam_id", exitID).
+			WithData("trap_beam_id", entryID).
+			WithData("trap_length", ts.beams[exitID].Position-ts.beams[entryID].Position).
+			WithData("speed", speed).
+			Build(),
+	)
+}
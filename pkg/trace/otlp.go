@@ -0,0 +1,196 @@
+package trace
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// scopeName identifies libdrag as the instrumentation scope in OTLP
+const scopeName = "github.com/benharold/libdrag/pkg/trace"
+
+// OTLP span kind and status codes
+const (
+	otlpSpanKindInternal = 1
+	otlpStatusOK         = 1
+	otlpStatusError      = 2
+)
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Links             []otlpLink     `json:"links,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpLink struct {
+	TraceID    string         `json:"traceId"`
+	SpanID     string         `json:"spanId"`
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"` // OTLP/JSON encodes 64-bit ints as strings
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+}
+
+// OTLPJSON encodes traces as an OTLP/JSON ExportTraceServiceRequest, the
+// body an OpenTelemetry collector accepts on /v1/traces
+func OTLPJSON(serviceName string, traces ...*Trace) ([]byte, error) {
+	spans := make([]otlpSpan, 0)
+	for _, t := range traces {
+		for _, span := range t.Spans {
+			spans = append(spans, toOTLP(t, span))
+		}
+	}
+	request := otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: []otlpKeyValue{keyValue("service.name", serviceName)}},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: scopeName}, Spans: spans}},
+	}}}
+	return json.Marshal(request)
+}
+
+func toOTLP(t *Trace, span Span) otlpSpan {
+	s := otlpSpan{
+		TraceID:           span.TraceID,
+		SpanID:            span.SpanID,
+		ParentSpanID:      span.ParentSpanID,
+		Name:              span.Name,
+		Kind:              otlpSpanKindInternal,
+		StartTimeUnixNano: unixNano(span.Start),
+		EndTimeUnixNano:   unixNano(span.End),
+		Status:            otlpStatus{Code: otlpStatusOK},
+	}
+
+	keys := make([]string, 0, len(span.Attributes))
+	for key := range span.Attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		s.Attributes = append(s.Attributes, keyValue(key, span.Attributes[key]))
+	}
+
+	for _, link := range span.Links {
+		s.Links = append(s.Links, otlpLink{
+			TraceID: link.TraceID,
+			SpanID:  link.SpanID,
+			Attributes: []otlpKeyValue{
+				keyValue("libdrag.race_id", t.RaceID),
+				keyValue("libdrag.journal.seq", link.Seq),
+				keyValue("libdrag.event.type", string(link.EventType)),
+			},
+		})
+	}
+
+	if span.Error != "" {
+		s.Status = otlpStatus{Code: otlpStatusError, Message: span.Error}
+	}
+	return s
+}
+
+func unixNano(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+// keyValue converts an attribute to its OTLP form. Values of other types
+// are recorded as strings.
+func keyValue(key string, value interface{}) otlpKeyValue {
+	var v otlpValue
+	switch value := value.(type) {
+	case string:
+		v.StringValue = &value
+	case bool:
+		v.BoolValue = &value
+	case int:
+		s := strconv.Itoa(value)
+		v.IntValue = &s
+	case int64:
+		s := strconv.FormatInt(value, 10)
+		v.IntValue = &s
+	case float64:
+		v.DoubleValue = &value
+	default:
+		s := fmt.Sprint(value)
+		v.StringValue = &s
+	}
+	return otlpKeyValue{Key: key, Value: v}
+}
+
+// HTTPExporter posts each trace as OTLP/JSON to an OpenTelemetry
+// collector's OTLP/HTTP endpoint, e.g. http://localhost:4318/v1/traces
+type HTTPExporter struct {
+	Endpoint    string
+	ServiceName string       // Defaults to "libdrag"
+	Client      *http.Client // Defaults to a client with a 5 second timeout
+}
+
+// ExportTrace implements Exporter
+func (e *HTTPExporter) ExportTrace(t *Trace) error {
+	serviceName := e.ServiceName
+	if serviceName == "" {
+		serviceName = "libdrag"
+	}
+	body, err := OTLPJSON(serviceName, t)
+	if err != nil {
+		return err
+	}
+
+	client := e.Client
+	if client == nil {
+		client = &http.Client{Timeout: 5 * time.Second}
+	}
+	resp, err := client.Post(e.Endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("collector returned %s", resp.Status)
+	}
+	return nil
+}
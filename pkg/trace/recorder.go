@@ -0,0 +1,122 @@
+package trace
+
+import (
+	"sync"
+
+	"github.com/benharold/libdrag/pkg/events"
+	"github.com/benharold/libdrag/pkg/logs"
+)
+
+// DefaultMaxTraces is how many finished traces a Recorder keeps by default
+const DefaultMaxTraces = 100
+
+// Exporter receives each race's trace once the race completes or aborts
+type Exporter interface {
+	ExportTrace(t *Trace) error
+}
+
+// ExporterFunc adapts a function to Exporter
+type ExporterFunc func(t *Trace) error
+
+// ExportTrace implements Exporter
+func (f ExporterFunc) ExportTrace(t *Trace) error {
+	return f(t)
+}
+
+// Recorder journals every race's events from the bus and builds the race's
+// trace when it completes or aborts. The most recent traces are kept for
+// lookup and each is handed to the exporter, if any.
+type Recorder struct {
+	mu          sync.Mutex
+	bus         *events.EventBus
+	exporter    Exporter
+	maxTraces   int
+	journals    map[string][]Entry // Race ID -> events so far
+	traces      map[string]*Trace  // Finished races
+	order       []string           // Finished race IDs, oldest first
+	unsubscribe func()
+}
+
+// NewRecorder creates a recorder for races on bus. exporter may be nil to
+// only keep traces for lookup.
+func NewRecorder(bus *events.EventBus, exporter Exporter) *Recorder {
+	return &Recorder{
+		bus:       bus,
+		exporter:  exporter,
+		maxTraces: DefaultMaxTraces,
+		journals:  make(map[string][]Entry),
+		traces:    make(map[string]*Trace),
+	}
+}
+
+// SetMaxTraces sets how many finished traces are kept for lookup
+func (r *Recorder) SetMaxTraces(max int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if max > 0 {
+		r.maxTraces = max
+	}
+}
+
+// Start subscribes to the bus
+func (r *Recorder) Start() {
+	r.unsubscribe = r.bus.SubscribeAll(r.HandleEvent)
+}
+
+// Stop unsubscribes from the bus
+func (r *Recorder) Stop() {
+	if r.unsubscribe != nil {
+		r.unsubscribe()
+	}
+}
+
+// HandleEvent journals an event and finishes the race's trace on
+// race.complete or race.abort
+func (r *Recorder) HandleEvent(event events.Event) {
+	if event.RaceID == "" {
+		return
+	}
+
+	r.mu.Lock()
+	if _, finished := r.traces[event.RaceID]; finished {
+		r.mu.Unlock()
+		return // Late events such as race.winner follow completion
+	}
+	journal := append(r.journals[event.RaceID], Entry{Seq: len(r.journals[event.RaceID]) + 1, Event: event})
+	r.journals[event.RaceID] = journal
+
+	if event.Type != events.EventRaceComplete && event.Type != events.EventRaceAbort {
+		r.mu.Unlock()
+		return
+	}
+	t := Build(event.RaceID, journal)
+	delete(r.journals, event.RaceID)
+	r.traces[event.RaceID] = t
+	r.order = append(r.order, event.RaceID)
+	for len(r.order) > r.maxTraces {
+		delete(r.traces, r.order[0])
+		r.order = r.order[1:]
+	}
+	exporter := r.exporter
+	r.mu.Unlock()
+
+	if exporter != nil {
+		if err := exporter.ExportTrace(t); err != nil {
+			logs.For(nil, "trace", event.RaceID).Warn("⚠️ Trace export failed", "error", err)
+		}
+	}
+}
+
+// Trace returns a finished race's trace, or a partial trace of a race still
+// running
+func (r *Recorder) Trace(raceID string) (*Trace, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if t, ok := r.traces[raceID]; ok {
+		return t, true
+	}
+	if journal, ok := r.journals[raceID]; ok {
+		return Build(raceID, append([]Entry(nil), journal...)), true
+	}
+	return nil, false
+}
@@ -0,0 +1,244 @@
+// Package trace turns a race's event journal into an OpenTelemetry-style
+// trace: a root span for the race with child spans for staging, the tree
+// countdown, each lane's splits and completion, so operators can inspect
+// the latency between phases in standard tracing UIs. Spans link back to
+// the journal entries that opened and closed them.
+package trace
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/benharold/libdrag/pkg/events"
+)
+
+// Span names
+const (
+	SpanRace       = "race"
+	SpanStaging    = "staging"
+	SpanCountdown  = "countdown"
+	SpanCompletion = "completion"
+)
+
+// Entry is one event in a race's journal. Seq numbers a race's events from
+// 1 in the order they were published.
+type Entry struct {
+	Seq   int          `json:"seq"`
+	Event events.Event `json:"event"`
+}
+
+// Link points from a span to the journal entry it was derived from
+type Link struct {
+	TraceID   string           `json:"trace_id"`
+	SpanID    string           `json:"span_id"` // Entry's ID from EntrySpanID
+	Seq       int              `json:"seq"`
+	EventType events.EventType `json:"event_type"`
+}
+
+// Span is a timed phase of a race
+type Span struct {
+	TraceID      string                 `json:"trace_id"`
+	SpanID       string                 `json:"span_id"`
+	ParentSpanID string                 `json:"parent_span_id,omitempty"`
+	Name         string                 `json:"name"`
+	Start        time.Time              `json:"start"`
+	End          time.Time              `json:"end"`
+	Attributes   map[string]interface{} `json:"attributes,omitempty"`
+	Links        []Link                 `json:"links,omitempty"`
+	Error        string                 `json:"error,omitempty"` // Set when the race was aborted in this phase
+}
+
+// Duration returns how long the span lasted
+func (s Span) Duration() time.Duration {
+	return s.End.Sub(s.Start)
+}
+
+// Trace is the span tree for one race, root span first, with the journal
+// its links point into
+type Trace struct {
+	RaceID  string  `json:"race_id"`
+	TraceID string  `json:"trace_id"`
+	Spans   []Span  `json:"spans"`
+	Journal []Entry `json:"journal"`
+}
+
+// Span returns the first span with the given name
+func (t *Trace) Span(name string) (Span, bool) {
+	for _, span := range t.Spans {
+		if span.Name == name {
+			return span, true
+		}
+	}
+	return Span{}, false
+}
+
+// TraceID returns the 16-byte trace ID for a race as hex. UUID race IDs are
+// used as-is so the trace can be found by race ID.
+func TraceID(raceID string) string {
+	if id := strings.ReplaceAll(raceID, "-", ""); len(id) == 32 {
+		if _, err := hex.DecodeString(id); err == nil {
+			return strings.ToLower(id)
+		}
+	}
+	return hashID(raceID, 16)
+}
+
+// EntrySpanID returns the 8-byte ID a journal entry is linked by as hex
+func EntrySpanID(raceID string, seq int) string {
+	return hashID(fmt.Sprintf("%s/journal/%d", raceID, seq), 8)
+}
+
+// spanID returns a stable 8-byte span ID as hex
+func spanID(raceID, name string) string {
+	return hashID(raceID+"/span/"+name, 8)
+}
+
+func hashID(s string, size int) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:size])
+}
+
+// splitEvents are the per-lane timing events that close a split span, in
+// track order
+var splitEvents = []struct {
+	eventType events.EventType
+	name      string
+}{
+	{events.EventTimingReaction, "reaction"},
+	{events.EventTiming60Foot, "60_foot"},
+	{events.EventTiming330Foot, "330_foot"},
+	{events.EventTimingEighthMile, "eighth_mile"},
+	{events.EventTiming1000Foot, "1000_foot"},
+	{events.EventTimingQuarterMile, "quarter_mile"},
+}
+
+// Build derives a race's trace from its journal. Phases that never happened
+// (an abort during staging, a lane that never left) produce no span.
+func Build(raceID string, journal []Entry) *Trace {
+	t := &Trace{RaceID: raceID, TraceID: TraceID(raceID), Journal: journal}
+	if len(journal) == 0 {
+		return t
+	}
+
+	root := spanID(raceID, SpanRace)
+	newSpan := func(name string, from, to Entry) Span {
+		return Span{
+			TraceID:      t.TraceID,
+			SpanID:       spanID(raceID, name),
+			ParentSpanID: root,
+			Name:         name,
+			Start:        from.Event.Timestamp,
+			End:          to.Event.Timestamp,
+			Links:        []Link{t.link(from), t.link(to)},
+		}
+	}
+
+	first, last := journal[0], journal[len(journal)-1]
+	var sequenceStart, green, end *Entry
+	lastSplit := make(map[int]Entry) // Lane -> entry that closed its last split
+	var spans []Span
+
+	for i := range journal {
+		entry := journal[i]
+		switch entry.Event.Type {
+		case events.EventTreeSequenceStart:
+			if sequenceStart == nil {
+				sequenceStart = &journal[i]
+				spans = append(spans, newSpan(SpanStaging, first, entry))
+			}
+		case events.EventTreeGreenOn:
+			if green == nil {
+				green = &journal[i]
+				if sequenceStart != nil {
+					spans = append(spans, newSpan(SpanCountdown, *sequenceStart, entry))
+				}
+			}
+		case events.EventRaceComplete, events.EventRaceAbort:
+			if end == nil {
+				end = &journal[i]
+			}
+		}
+
+		for _, split := range splitEvents {
+			if entry.Event.Type != split.eventType || green == nil {
+				continue
+			}
+			lane := entry.Event.Lane
+			from, ok := lastSplit[lane]
+			if !ok {
+				from = *green
+			}
+			span := newSpan(fmt.Sprintf("lane %d %s", lane, split.name), from, entry)
+			span.Attributes = map[string]interface{}{"libdrag.lane": lane}
+			if value, ok := entry.Event.Data["time"]; ok {
+				span.Attributes["libdrag.elapsed_time"] = value
+			}
+			if value, ok := entry.Event.Data["reaction_time"]; ok {
+				span.Attributes["libdrag.reaction_time"] = value
+			}
+			spans = append(spans, span)
+			lastSplit[lane] = entry
+		}
+	}
+
+	if end == nil {
+		end = &last // Still running
+	} else {
+		// Completion runs from the last split (or green) to the end
+		from := first
+		if green != nil {
+			from = *green
+		}
+		for _, entry := range lastSplit {
+			if entry.Seq > from.Seq {
+				from = entry
+			}
+		}
+		completion := newSpan(SpanCompletion, from, *end)
+		if end.Event.Type == events.EventRaceAbort {
+			completion.Error = abortReason(end.Event)
+		}
+		spans = append(spans, completion)
+	}
+
+	rootSpan := Span{
+		TraceID:    t.TraceID,
+		SpanID:     root,
+		Name:       SpanRace,
+		Start:      first.Event.Timestamp,
+		End:        end.Event.Timestamp,
+		Attributes: map[string]interface{}{"libdrag.race_id": raceID},
+		Links:      []Link{t.link(first), t.link(*end)},
+	}
+	if end.Event.Type == events.EventRaceAbort {
+		rootSpan.Error = abortReason(end.Event)
+	}
+	if end.Event.Type == events.EventRaceComplete {
+		if lane, ok := end.Event.Data["winner_lane"].(int); ok && lane > 0 {
+			rootSpan.Attributes["libdrag.winner_lane"] = lane
+			rootSpan.Attributes["libdrag.margin"] = end.Event.Data["margin"]
+		}
+	}
+	t.Spans = append([]Span{rootSpan}, spans...)
+	return t
+}
+
+// link points at a journal entry of this trace's race
+func (t *Trace) link(entry Entry) Link {
+	return Link{
+		TraceID:   t.TraceID,
+		SpanID:    EntrySpanID(t.RaceID, entry.Seq),
+		Seq:       entry.Seq,
+		EventType: entry.Event.Type,
+	}
+}
+
+func abortReason(event events.Event) string {
+	if reason, ok := event.Data["reason"].(string); ok && reason != "" {
+		return "aborted: " + reason
+	}
+	return "aborted"
+}
@@ -0,0 +1,163 @@
+package trace
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/benharold/libdrag/pkg/events"
+)
+
+const raceID = "0f8fad5b-d9cb-469f-a165-70867728950e"
+
+// raceEvents publishes a complete race on bus, one event per 100ms
+func raceEvents(bus *events.EventBus, end events.EventType) {
+	start := time.Date(2025, time.January, 1, 12, 0, 0, 0, time.UTC)
+	steps := []struct {
+		eventType events.EventType
+		lane      int
+		data      map[string]interface{}
+	}{
+		{events.EventRaceStart, 0, nil},
+		{events.EventTreeStage, 1, nil},
+		{events.EventTreeSequenceStart, 0, nil},
+		{events.EventTreeGreenOn, 0, nil},
+		{events.EventTimingReaction, 1, map[string]interface{}{"reaction_time": 0.042}},
+		{events.EventTimingReaction, 2, map[string]interface{}{"reaction_time": 0.051}},
+		{events.EventTiming60Foot, 1, map[string]interface{}{"time": 0.95}},
+		{events.EventTimingQuarterMile, 1, map[string]interface{}{"time": 7.3}},
+		{end, 0, map[string]interface{}{"reason": "oil down", "winner_lane": 1, "margin": 0.2}},
+		{events.EventRaceWinner, 1, nil},
+	}
+	for i, step := range steps {
+		builder := events.NewEvent(step.eventType).WithRaceID(raceID).WithLane(step.lane)
+		for key, value := range step.data {
+			builder.WithData(key, value)
+		}
+		event := builder.Build()
+		event.Timestamp = start.Add(time.Duration(i) * 100 * time.Millisecond)
+		bus.Publish(event)
+	}
+}
+
+func TestRecorderBuildsTrace(t *testing.T) {
+	bus := events.NewEventBus(false)
+	exported := make(chan *Trace, 1)
+	recorder := NewRecorder(bus, ExporterFunc(func(t *Trace) error {
+		exported <- t
+		return nil
+	}))
+	recorder.Start()
+	defer recorder.Stop()
+
+	raceEvents(bus, events.EventRaceComplete)
+
+	tr := <-exported
+	if tr.TraceID != "0f8fad5bd9cb469fa16570867728950e" {
+		t.Errorf("Expected the race ID as trace ID, got %s", tr.TraceID)
+	}
+	if len(tr.Journal) != 9 {
+		t.Errorf("Expected 9 journaled events before completion, got %d", len(tr.Journal))
+	}
+
+	root := tr.Spans[0]
+	if root.Name != SpanRace || root.ParentSpanID != "" || root.Duration() != 800*time.Millisecond {
+		t.Errorf("Unexpected root span %+v", root)
+	}
+	if root.Attributes["libdrag.winner_lane"] != 1 || root.Attributes["libdrag.margin"] != 0.2 {
+		t.Errorf("Expected the winner and margin on the root span, got %+v", root.Attributes)
+	}
+	expected := map[string]time.Duration{
+		SpanStaging:           200 * time.Millisecond,
+		SpanCountdown:         100 * time.Millisecond,
+		"lane 1 reaction":     100 * time.Millisecond,
+		"lane 2 reaction":     200 * time.Millisecond,
+		"lane 1 60_foot":      200 * time.Millisecond,
+		"lane 1 quarter_mile": 100 * time.Millisecond,
+		SpanCompletion:        100 * time.Millisecond,
+	}
+	for name, duration := range expected {
+		span, ok := tr.Span(name)
+		if !ok {
+			t.Errorf("Missing span %q", name)
+			continue
+		}
+		if span.Duration() != duration || span.ParentSpanID != root.SpanID {
+			t.Errorf("Span %q: expected %v under the root, got %v", name, duration, span.Duration())
+		}
+	}
+
+	countdown, _ := tr.Span(SpanCountdown)
+	if countdown.Links[0].Seq != 3 || countdown.Links[1].EventType != events.EventTreeGreenOn ||
+		countdown.Links[1].SpanID != EntrySpanID(raceID, 4) {
+		t.Errorf("Expected countdown linked to journal entries 3 and 4, got %+v", countdown.Links)
+	}
+	if got, ok := recorder.Trace(raceID); !ok || got != tr {
+		t.Error("Expected the finished trace kept for lookup")
+	}
+}
+
+func TestAbortedRaceTrace(t *testing.T) {
+	bus := events.NewEventBus(false)
+	recorder := NewRecorder(bus, nil)
+	recorder.Start()
+	defer recorder.Stop()
+
+	raceEvents(bus, events.EventRaceAbort)
+
+	tr, ok := recorder.Trace(raceID)
+	if !ok {
+		t.Fatal("Expected a trace for the aborted race")
+	}
+	if tr.Spans[0].Error != "aborted: oil down" {
+		t.Errorf("Expected the abort on the root span, got %q", tr.Spans[0].Error)
+	}
+	if completion, _ := tr.Span(SpanCompletion); completion.Error == "" {
+		t.Error("Expected the abort on the completion span")
+	}
+}
+
+func TestHTTPExporter(t *testing.T) {
+	var request struct {
+		ResourceSpans []struct {
+			ScopeSpans []struct {
+				Spans []struct {
+					TraceID           string `json:"traceId"`
+					Name              string `json:"name"`
+					StartTimeUnixNano string `json:"startTimeUnixNano"`
+					Links             []struct {
+						SpanID string `json:"spanId"`
+					} `json:"links"`
+					Status struct {
+						Code int `json:"code"`
+					} `json:"status"`
+				} `json:"spans"`
+			} `json:"scopeSpans"`
+		} `json:"resourceSpans"`
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Errorf("Invalid OTLP/JSON: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	bus := events.NewEventBus(false)
+	recorder := NewRecorder(bus, &HTTPExporter{Endpoint: server.URL + "/v1/traces"})
+	recorder.Start()
+	defer recorder.Stop()
+	raceEvents(bus, events.EventRaceAbort)
+
+	spans := request.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 8 || spans[0].Name != SpanRace || spans[0].TraceID != "0f8fad5bd9cb469fa16570867728950e" {
+		t.Fatalf("Unexpected spans %+v", spans)
+	}
+	if spans[0].StartTimeUnixNano != "1735732800000000000" || spans[0].Status.Code != otlpStatusError {
+		t.Errorf("Unexpected root span %+v", spans[0])
+	}
+	if len(spans[1].Links) != 2 || spans[1].Links[0].SpanID != EntrySpanID(raceID, 1) {
+		t.Errorf("Expected staging linked to the journal, got %+v", spans[1].Links)
+	}
+}
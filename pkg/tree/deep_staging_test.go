@@ -6,6 +6,7 @@ import (
 
 	"github.com/benharold/libdrag/pkg/config"
 	"github.com/benharold/libdrag/pkg/events"
+	"github.com/benharold/libdrag/pkg/rules"
 )
 
 // TestConfig for testing deep staging scenarios
@@ -487,4 +488,37 @@ func TestForwardMotionRule_PreStageBacking(t *testing.T) {
 	if len(violationEvents) != 0 {
 		t.Errorf("Pre-stage backing before stage beam should not generate violations, got %d", len(violationEvents))
 	}
-}
\ No newline at end of file
+}
+// Test: a tree given its own rules engine follows that engine's classes
+func TestDeepStagingCustomRules(t *testing.T) {
+	engine, err := rules.NewEngine(rules.Class{
+		Name:      "Street",
+		Tree:      config.TreeSequenceSportsman,
+		DeepStage: rules.DeepStageProhibited,
+		Breakout:  rules.BreakoutDialIn,
+	})
+	if err != nil {
+		t.Fatalf("NewEngine failed: %v", err)
+	}
+
+	for class, prohibited := range map[string]bool{"Street": true, "Super Gas": false} {
+		tree := NewChristmasTree()
+		eventBus := events.NewEventBus(false)
+		tree.SetEventBus(eventBus)
+		tree.SetRules(engine)
+
+		var violations []events.Event
+		eventBus.Subscribe(events.EventTreeDeepStageViolation, func(e events.Event) {
+			violations = append(violations, e)
+		})
+		tree.Initialize(context.Background(), newTestConfig(class))
+
+		tree.SetPreStage(1, true)
+		tree.SetStage(1, true)
+		tree.SetPreStage(1, false) // Deep stage
+
+		if got := len(violations) == 1; got != prohibited {
+			t.Errorf("Class %s: expected violation=%v, got %d events", class, prohibited, len(violations))
+		}
+	}
+}
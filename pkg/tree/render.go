@@ -0,0 +1,177 @@
+package tree
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// RenderStyle selects the bulb characters used by Render and RenderLane
+type RenderStyle int
+
+const (
+	StyleEmoji RenderStyle = iota // Colored emoji bulbs, for terminals
+	StyleASCII                    // Plain ASCII, for logs and dumb terminals
+)
+
+// treeLights are the bulbs from the top of the tree down
+var treeLights = []LightType{LightPreStage, LightStage, LightAmber1, LightAmber2, LightAmber3, LightGreen, LightRed}
+
+// lightLabels are the row labels of a rendered tree
+var lightLabels = map[LightType]string{
+	LightPreStage: "PRE",
+	LightStage:    "STG",
+	LightAmber1:   "A1",
+	LightAmber2:   "A2",
+	LightAmber3:   "A3",
+	LightGreen:    "GRN",
+	LightRed:      "RED",
+}
+
+// LightColor returns the lens color of a light: "yellow" (pre-stage and
+// stage bulbs), "amber", "green" or "red"
+func LightColor(light LightType) string {
+	switch light {
+	case LightPreStage, LightStage:
+		return "yellow"
+	case LightAmber1, LightAmber2, LightAmber3:
+		return "amber"
+	case LightGreen:
+		return "green"
+	case LightRed:
+		return "red"
+	default:
+		return ""
+	}
+}
+
+// bulb renders one light in a style
+func bulb(light LightType, state LightState, style RenderStyle) string {
+	if style == StyleASCII {
+		switch state {
+		case LightOn:
+			return strings.ToUpper(LightColor(light)[:1])
+		case LightBlink:
+			return "*"
+		default:
+			return "."
+		}
+	}
+
+	switch state {
+	case LightOn:
+		switch LightColor(light) {
+		case "yellow":
+			return "🟡"
+		case "amber":
+			return "🟠"
+		case "green":
+			return "🟢"
+		default:
+			return "🔴"
+		}
+	case LightBlink:
+		return "✴️"
+	default:
+		return "⚫"
+	}
+}
+
+// RenderLane renders one lane's lights on a single line, staging bulbs,
+// ambers, then green and red: "🟡 🟡  🟠🟠🟠  🟢 ⚫"
+func RenderLane(lights map[LightType]LightState, style RenderStyle) string {
+	b := func(light LightType) string { return bulb(light, lights[light], style) }
+	return fmt.Sprintf("%s %s  %s%s%s  %s %s",
+		b(LightPreStage), b(LightStage),
+		b(LightAmber1), b(LightAmber2), b(LightAmber3),
+		b(LightGreen), b(LightRed))
+}
+
+// Render draws the tree with a column per lane, top bulb first:
+//
+//	     L1  L2
+//	PRE  Y   Y
+//	STG  Y   .
+//	A1   A   .
+//	...
+//
+// In the ASCII style lit bulbs show their color's initial (Y, A, G, R),
+// blinking bulbs "*" and dark bulbs ".".
+func Render(status *Status, style RenderStyle) string {
+	lanes := statusLanes(status)
+	var out strings.Builder
+
+	line := "    "
+	for _, lane := range lanes {
+		line += fmt.Sprintf(" L%-2d", lane)
+	}
+	out.WriteString(strings.TrimRight(line, " ") + "\n")
+
+	for _, light := range treeLights {
+		line = fmt.Sprintf("%-4s", lightLabels[light])
+		for _, lane := range lanes {
+			cell := bulb(light, status.LightStates[lane][light], style)
+			if style == StyleASCII {
+				cell += " " // Emoji bulbs are two columns wide already
+			}
+			line += " " + cell + " "
+		}
+		out.WriteString(strings.TrimRight(line, " ") + "\n")
+	}
+	return out.String()
+}
+
+// statusLanes returns the lanes of a status in order
+func statusLanes(status *Status) []int {
+	lanes := make([]int, 0, len(status.LightStates))
+	for lane := range status.LightStates {
+		lanes = append(lanes, lane)
+	}
+	sort.Ints(lanes)
+	return lanes
+}
+
+// CanvasBulb is one bulb of a tree canvas, at a column and row of a grid
+type CanvasBulb struct {
+	Lane   int        `json:"lane"`
+	Column int        `json:"column"` // Lane position, from 0 at the left
+	Row    int        `json:"row"`    // From 0 at the top (pre-stage)
+	Light  LightType  `json:"light"`
+	Color  string     `json:"color"`
+	State  LightState `json:"state"`
+}
+
+// Canvas is a tree laid out on a grid for simple web UIs, which only need
+// to draw each bulb at its column and row in its color when lit
+type Canvas struct {
+	Columns int          `json:"columns"`
+	Rows    int          `json:"rows"`
+	Bulbs   []CanvasBulb `json:"bulbs"`
+}
+
+// NewCanvas lays out a tree status on a grid
+func NewCanvas(status *Status) Canvas {
+	lanes := statusLanes(status)
+	canvas := Canvas{
+		Columns: len(lanes),
+		Rows:    len(treeLights),
+		Bulbs:   make([]CanvasBulb, 0, len(lanes)*len(treeLights)),
+	}
+	for row, light := range treeLights {
+		for column, lane := range lanes {
+			state := status.LightStates[lane][light]
+			if state == "" {
+				state = LightOff
+			}
+			canvas.Bulbs = append(canvas.Bulbs, CanvasBulb{
+				Lane:   lane,
+				Column: column,
+				Row:    row,
+				Light:  light,
+				Color:  LightColor(light),
+				State:  state,
+			})
+		}
+	}
+	return canvas
+}
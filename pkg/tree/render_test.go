@@ -0,0 +1,46 @@
+package tree
+
+import "testing"
+
+func renderStatus() *Status {
+	return &Status{LightStates: map[int]map[LightType]LightState{
+		1: {LightPreStage: LightOn, LightStage: LightOn, LightAmber1: LightOn, LightAmber2: LightOn, LightAmber3: LightOn, LightGreen: LightOn},
+		2: {LightPreStage: LightOn, LightStage: LightBlink, LightRed: LightOn},
+	}}
+}
+
+func TestRender(t *testing.T) {
+	expected := "     L1  L2\n" +
+		"PRE  Y   Y\n" +
+		"STG  Y   *\n" +
+		"A1   A   .\n" +
+		"A2   A   .\n" +
+		"A3   A   .\n" +
+		"GRN  G   .\n" +
+		"RED  .   R\n"
+	if got := Render(renderStatus(), StyleASCII); got != expected {
+		t.Errorf("Unexpected ASCII tree:\n%s\nexpected:\n%s", got, expected)
+	}
+
+	if got := RenderLane(renderStatus().LightStates[2], StyleEmoji); got != "🟡 ✴️  ⚫⚫⚫  ⚫ 🔴" {
+		t.Errorf("Unexpected lane rendering %q", got)
+	}
+}
+
+func TestCanvas(t *testing.T) {
+	canvas := NewCanvas(renderStatus())
+	if canvas.Columns != 2 || canvas.Rows != 7 || len(canvas.Bulbs) != 14 {
+		t.Fatalf("Unexpected canvas size %d x %d with %d bulbs", canvas.Columns, canvas.Rows, len(canvas.Bulbs))
+	}
+
+	for _, b := range canvas.Bulbs {
+		if b.Lane == 2 && b.Light == LightRed {
+			if b.Column != 1 || b.Row != 6 || b.Color != "red" || b.State != LightOn {
+				t.Errorf("Unexpected lane 2 red bulb %+v", b)
+			}
+		}
+		if b.Lane == 2 && b.Light == LightGreen && b.State != LightOff {
+			t.Errorf("Expected unset lights to be off, got %+v", b)
+		}
+	}
+}
@@ -4,12 +4,17 @@ import (
 	"context"
 	"fmt"
 	"github.com/google/uuid"
+	"log/slog"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/benharold/libdrag/pkg/component"
 	"github.com/benharold/libdrag/pkg/config"
 	"github.com/benharold/libdrag/pkg/events"
+	"github.com/benharold/libdrag/pkg/logs"
+	"github.com/benharold/libdrag/pkg/rules"
+	"github.com/benharold/libdrag/pkg/timers"
 )
 
 // LightType defines different lights on the Christmas tree
@@ -39,33 +44,88 @@ type Status struct {
 	Armed          bool                             `json:"armed"`     // starter has enabled auto-start system to take control
 	Activated      bool                             `json:"activated"` // auto-start system detected staging conditions and started sequence
 	SequenceType   config.TreeSequenceType          `json:"sequence_type"`
-	CurrentStep    int                              `json:"current_step"`
 	LightStates    map[int]map[LightType]LightState `json:"light_states"` // lane -> light -> state
+	Lanes          map[int]LaneSequence             `json:"lanes"`        // lane -> sequence progress
 	LastSequence   time.Time                        `json:"last_sequence,omitempty"`
 	ArmedTime      time.Time                        `json:"armed_time,omitempty"`      // when starter armed the tree
 	ActivationTime time.Time                        `json:"activation_time,omitempty"` // when auto-start activated sequence
 	StabilityTimer time.Time                        `json:"stability_timer,omitempty"` // for 0.6s stability requirement
 }
 
+// SequencePhase is where a lane is in its run on the tree
+type SequencePhase string
+
+const (
+	PhaseIdle      SequencePhase = "idle"       // No staging bulbs lit
+	PhasePreStaged SequencePhase = "pre_staged" // Pre-stage bulb only
+	PhaseStaged    SequencePhase = "staged"     // Stage bulb lit
+	PhaseAmber     SequencePhase = "amber"      // Ambers counting down
+	PhaseGreen     SequencePhase = "green"
+	PhaseRed       SequencePhase = "red"     // Lane left before its green
+	PhaseStopped   SequencePhase = "stopped" // Emergency stop
+)
+
+// BulbTransition is a bulb changing state
+type BulbTransition struct {
+	Light LightType  `json:"light"`
+	State LightState `json:"state"`
+	Time  time.Time  `json:"time"`
+}
+
+// LaneSequence is one lane's progress through the run, so lanes on
+// different starts (handicap, one lane red) are reported separately
+type LaneSequence struct {
+	Phase       SequencePhase    `json:"phase"`
+	Step        int              `json:"step"`        // Ambers lit (0-3), 4 at green
+	Transitions []BulbTransition `json:"transitions"` // Every bulb change of the run, oldest first
+}
+
+// DefaultMotionHistoryLimit is how many staging motions each lane keeps
+const DefaultMotionHistoryLimit = 32
+
+// Staging motion types
+const (
+	MotionEnterStage       = "enter_stage"
+	MotionBackOutStage     = "back_out_stage"
+	MotionReEnterViolation = "re_enter_stage_VIOLATION"
+	MotionBackOutComplete  = "back_out_complete" // Left both beams; the forward motion rule starts over
+)
+
+// Motion is one staging beam movement of a lane
+type Motion struct {
+	Type string    `json:"type"`
+	Time time.Time `json:"time"`
+}
+
 // StagingMotionState tracks the staging motion sequence for a lane
 type StagingMotionState struct {
-	ReachedStage    bool // Has this lane ever reached the stage beam?
-	LastStageState  bool // Last state of stage beam (to detect backing)
-	MotionHistory   []string // Track sequence of motions for debugging
+	ReachedStage   bool     `json:"reached_stage"`    // Has this lane reached the stage beam since it last backed out completely?
+	LastStageState bool     `json:"last_stage_state"` // Last state of stage beam (to detect backing)
+	MotionHistory  []Motion `json:"motion_history"`   // Motions of the run for protest review, oldest first
+	Pruned         int      `json:"pruned,omitempty"` // Older motions dropped to stay within the limit
 }
 
 // ChristmasTree implements the Christmas tree component
 type ChristmasTree struct {
 	id             string
 	config         config.Config
-	mu             sync.RWMutex
+	mu             component.VersionedMutex
 	status         Status
 	compStatus     component.ComponentStatus
 	lanesPreStaged map[int]bool
 	lanesStaged    map[int]bool
 	stagingMotion  map[int]*StagingMotionState // Track staging motion per lane
+	motionLimit    int                         // Motions kept per lane
 	eventBus       *events.EventBus
 	raceID         string
+	startDelays    map[int]time.Duration // Lane -> handicap delay of its countdown
+	clock          timers.Clock          // Nil runs on the default wheel
+	logger         *slog.Logger          // Nil logs to logs.Default
+	rules          *rules.Engine         // Nil uses rules.Default
+	autoStarted    bool                  // Activated by auto-start, its sequence not yet started
+	halt           chan struct{}         // Closed by Halt to end running sequences
+	halted         bool                  // No sequence step runs until the tree is armed again
+	sequences      sync.WaitGroup        // Running sequences, waited out by Halt
 }
 
 func NewChristmasTree() *ChristmasTree {
@@ -76,6 +136,7 @@ func NewChristmasTree() *ChristmasTree {
 			Armed:       false,
 			Activated:   false,
 			LightStates: make(map[int]map[LightType]LightState),
+			Lanes:       make(map[int]LaneSequence),
 		},
 		compStatus: component.ComponentStatus{
 			ID:       id,
@@ -85,6 +146,8 @@ func NewChristmasTree() *ChristmasTree {
 		lanesPreStaged: make(map[int]bool),
 		lanesStaged:    make(map[int]bool),
 		stagingMotion:  make(map[int]*StagingMotionState),
+		motionLimit:    DefaultMotionHistoryLimit,
+		halt:           make(chan struct{}),
 	}
 }
 
@@ -94,6 +157,9 @@ func (ct *ChristmasTree) GetID() string {
 
 func (ct *ChristmasTree) Initialize(_ context.Context, cfg config.Config) error {
 	ct.config = cfg
+	if limit := cfg.Safety().MotionHistoryLimit; limit > 0 {
+		ct.motionLimit = limit
+	}
 
 	// Initialize light states for all lanes
 	trackConfig := cfg.Track()
@@ -102,12 +168,13 @@ func (ct *ChristmasTree) Initialize(_ context.Context, cfg config.Config) error
 		for _, lightType := range []LightType{LightPreStage, LightStage, LightAmber1, LightAmber2, LightAmber3, LightGreen, LightRed} {
 			ct.status.LightStates[lane][lightType] = LightOff
 		}
+		ct.status.Lanes[lane] = LaneSequence{Phase: PhaseIdle, Transitions: make([]BulbTransition, 0)}
 		
 		// Initialize staging motion tracking for each lane
 		ct.stagingMotion[lane] = &StagingMotionState{
 			ReachedStage:  false,
 			LastStageState: false,
-			MotionHistory: make([]string, 0),
+			MotionHistory: make([]Motion, 0),
 		}
 	}
 
@@ -120,9 +187,14 @@ func (ct *ChristmasTree) Arm(_ context.Context) error {
 	defer ct.mu.Unlock()
 
 	ct.status.Armed = true
-	ct.status.ArmedTime = time.Now()
+	ct.status.ArmedTime = timers.Or(ct.clock).Now()
 	ct.compStatus.Status = "armed"
-	fmt.Println("💪 libdrag Christmas Tree: Armed by starter - Auto-start system enabled")
+	if ct.halted {
+		// Re-armed after a halt, so sequences can run again
+		ct.halt = make(chan struct{})
+		ct.halted = false
+	}
+	ct.log().Info("💪 Armed by starter, auto-start enabled")
 
 	// Publish armed event
 	if ct.eventBus != nil {
@@ -148,11 +220,12 @@ func (ct *ChristmasTree) DisarmTree() {
 
 	ct.status.Armed = false
 	ct.status.Activated = false
+	ct.autoStarted = false
 	ct.status.ArmedTime = time.Time{}
 	ct.status.ActivationTime = time.Time{}
 	ct.status.StabilityTimer = time.Time{}
 	ct.compStatus.Status = "ready"
-	fmt.Println("💪 libdrag Christmas Tree: DISARMED by starter")
+	ct.log().Info("💪 Disarmed by starter")
 
 	// Publish disarmed event
 	if ct.eventBus != nil {
@@ -177,9 +250,10 @@ func (ct *ChristmasTree) ActivateAutoStart() error {
 	}
 
 	ct.status.Activated = true
-	ct.status.ActivationTime = time.Now()
+	ct.status.ActivationTime = timers.Or(ct.clock).Now()
 	ct.compStatus.Status = "activated"
-	fmt.Println("⏳ libdrag Christmas Tree: Auto-start system activated - staging conditions detected")
+	ct.autoStarted = true
+	ct.log().Info("⏳ Auto-start activated, staging conditions met")
 
 	// Publish activation event
 	if ct.eventBus != nil {
@@ -200,28 +274,39 @@ func (ct *ChristmasTree) Activate() error {
 
 	ct.status.Activated = true
 	ct.compStatus.Status = "activated"
-	fmt.Println("⏳ libdrag Christmas Tree: Activated")
+	ct.log().Info("⏳ Activated")
 	return nil
 }
 
+// EmergencyStop halts the tree (see Halt) and blinks every lane's red
 func (ct *ChristmasTree) EmergencyStop() error {
+	ct.emergencyStop()
+	ct.sequences.Wait()
+	return nil
+}
+
+// emergencyStop stops the tree and puts out every light but the blinking
+// reds, leaving any running sequence to be waited out
+func (ct *ChristmasTree) emergencyStop() {
 	ct.mu.Lock()
 	defer ct.mu.Unlock()
 
+	ct.haltSequences()
 	ct.status.Armed = false
 	ct.status.Activated = false
+	ct.autoStarted = false
 	ct.compStatus.Status = "emergency_stopped"
 
 	// Clear all lights first
 	trackConfig := ct.config.Track()
 	for lane := 1; lane <= trackConfig.LaneCount; lane++ {
-		for _, lightType := range []LightType{LightPreStage, LightStage, LightAmber1, LightAmber2, LightAmber3, LightGreen, LightRed} {
-			ct.status.LightStates[lane][lightType] = LightOff
-			ct.status.LightStates[lane][LightRed] = LightBlink
+		for _, lightType := range []LightType{LightPreStage, LightStage, LightAmber1, LightAmber2, LightAmber3, LightGreen} {
+			ct.setBulb(lane, lightType, LightOff)
 		}
+		ct.setBulb(lane, LightRed, LightBlink)
 	}
 
-	fmt.Println("🚨 libdrag Christmas Tree: EMERGENCY STOP")
+	ct.log().Warn("🚨 Emergency stop")
 
 	// Publish emergency stop event
 	if ct.eventBus != nil {
@@ -231,8 +316,57 @@ func (ct *ChristmasTree) EmergencyStop() error {
 				Build(),
 		)
 	}
+}
+
+// Halt ends any running sequence: no bulb changes and no sequence event is
+// published once it returns, so a green cannot fire after a race is stopped
+// with its ambers lit. The lights are left as they are. Until the tree is
+// armed again no sequence starts and no bulb changes, whether from staging
+// beams, red lights or stage flashes. Halt must not be called from a
+// handler of the tree's own sequence events on a synchronous bus, as it
+// waits for the sequence that published them.
+func (ct *ChristmasTree) Halt() {
+	ct.mu.Lock()
+	ct.haltSequences()
+	ct.mu.Unlock()
+	ct.sequences.Wait()
+}
+
+// haltSequences stops running sequences at their next step. Must be called
+// with ct.mu held.
+func (ct *ChristmasTree) haltSequences() {
+	if !ct.halted {
+		ct.halted = true
+		close(ct.halt)
+	}
+}
 
-	return nil
+// pause sleeps between sequence steps, returning false if the tree is halted
+// first
+func (ct *ChristmasTree) pause(d time.Duration, name string) bool {
+	ct.mu.RLock()
+	halt := ct.halt
+	ct.mu.RUnlock()
+	return timers.SleepOrDone(timers.Or(ct.clock), d, timers.Label{Name: name, RaceID: ct.raceID}, halt)
+}
+
+// sequenceStep puts out the off bulbs and lights the on bulbs of lanes, or
+// of every lane when lanes is nil, as one step of a sequence. It changes
+// nothing and returns false once the tree is halted.
+func (ct *ChristmasTree) sequenceStep(lanes []int, off []LightType, on ...LightType) bool {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+
+	if ct.halted {
+		return false
+	}
+	for _, lightType := range off {
+		ct.setLanes(lanes, lightType, LightOff)
+	}
+	for _, lightType := range on {
+		ct.setLanes(lanes, lightType, LightOn)
+	}
+	return true
 }
 
 func (ct *ChristmasTree) GetStatus() component.ComponentStatus {
@@ -241,10 +375,81 @@ func (ct *ChristmasTree) GetStatus() component.ComponentStatus {
 	return ct.compStatus
 }
 
+// Version returns the version of the tree's state, which moves whenever
+// the state may have changed. Take it before GetTreeStatus.
+func (ct *ChristmasTree) Version() uint64 {
+	return ct.mu.Version()
+}
+
 func (ct *ChristmasTree) GetTreeStatus() Status {
 	ct.mu.RLock()
 	defer ct.mu.RUnlock()
-	return ct.status
+
+	// Copy the light map so callers can read it while the sequence runs
+	status := ct.status
+	status.LightStates = make(map[int]map[LightType]LightState, len(ct.status.LightStates))
+	for lane, lights := range ct.status.LightStates {
+		status.LightStates[lane] = make(map[LightType]LightState, len(lights))
+		for light, state := range lights {
+			status.LightStates[lane][light] = state
+		}
+	}
+	status.Lanes = make(map[int]LaneSequence, len(ct.status.Lanes))
+	for lane, sequence := range ct.status.Lanes {
+		sequence.Transitions = append([]BulbTransition(nil), sequence.Transitions...)
+		status.Lanes[lane] = sequence
+	}
+	return status
+}
+
+// ChannelStates returns the state of every bulb wired in the track's
+// hardware map, by controller channel, for output drivers to write
+func (ct *ChristmasTree) ChannelStates() map[int]LightState {
+	ct.mu.RLock()
+	defer ct.mu.RUnlock()
+
+	states := make(map[int]LightState)
+	if ct.config == nil {
+		return states
+	}
+	for channel, wiring := range ct.config.Track().Hardware.Channels {
+		if wiring.Kind != config.ChannelBulb {
+			continue
+		}
+		if state, ok := ct.status.LightStates[wiring.Lane][LightType(wiring.ID)]; ok {
+			states[channel] = state
+		}
+	}
+	return states
+}
+
+// SetClock runs the tree on clock instead of the default wheel. Call it
+// before the tree is armed.
+func (ct *ChristmasTree) SetClock(clock timers.Clock) {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	ct.clock = clock
+}
+
+// SetLogger logs the tree's lights and state changes to logger instead of
+// logs.Default
+func (ct *ChristmasTree) SetLogger(logger *slog.Logger) {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	ct.logger = logger
+}
+
+// log returns the tree's logger for its race. Callers need not hold ct.mu,
+// as the logger and race are set before the tree runs.
+func (ct *ChristmasTree) log() *slog.Logger {
+	return logs.For(ct.logger, "tree", ct.raceID)
+}
+
+// SetRules looks class rules up in engine instead of rules.Default
+func (ct *ChristmasTree) SetRules(engine *rules.Engine) {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	ct.rules = engine
 }
 
 // SetEventBus sets the event bus for publishing events
@@ -265,17 +470,21 @@ func (ct *ChristmasTree) SetPreStage(lane int, beamBroken bool) {
 	ct.mu.Lock()
 	defer ct.mu.Unlock()
 
+	if ct.halted {
+		return
+	}
+
 	if beamBroken {
-		ct.status.LightStates[lane][LightPreStage] = LightOn
+		ct.setLight(lane, LightPreStage, LightOn)
 		ct.lanesPreStaged[lane] = true
-		fmt.Printf("🟡 libdrag: Pre-stage light ON for lane %d\n", lane)
+		ct.log().Debug("🟡 Pre-stage light on", logs.KeyLane, lane)
 	} else {
-		ct.status.LightStates[lane][LightPreStage] = LightOff
+		ct.setLight(lane, LightPreStage, LightOff)
 		ct.lanesPreStaged[lane] = false
-		fmt.Printf("⚫ libdrag: Pre-stage light OFF for lane %d\n", lane)
+		ct.log().Debug("⚫ Pre-stage light off", logs.KeyLane, lane)
 		
 		// Check if vehicle has completely backed out (both beams clear)
-		stageBeamClear := ct.status.LightStates[lane][LightStage] == LightOff
+		stageBeamClear := ct.status.LightStates[lane][LightStage] != LightOn // A flashing stage bulb is still clear
 		if stageBeamClear {
 			// Complete back-out - reset staging motion tracking
 			ct.resetStagingMotion(lane)
@@ -301,17 +510,21 @@ func (ct *ChristmasTree) SetStage(lane int, beamBroken bool) {
 	ct.mu.Lock()
 	defer ct.mu.Unlock()
 
+	if ct.halted {
+		return
+	}
+
 	// Track staging motion before updating state
 	ct.trackStagingMotion(lane, beamBroken)
 
 	if beamBroken {
-		ct.status.LightStates[lane][LightStage] = LightOn
+		ct.setLight(lane, LightStage, LightOn)
 		ct.lanesStaged[lane] = true
-		fmt.Printf("🟡 libdrag: Stage light ON for lane %d\n", lane)
+		ct.log().Debug("🟡 Stage light on", logs.KeyLane, lane)
 	} else {
-		ct.status.LightStates[lane][LightStage] = LightOff
+		ct.setLight(lane, LightStage, LightOff)
 		ct.lanesStaged[lane] = false
-		fmt.Printf("⚫ libdrag: Stage light OFF for lane %d\n", lane)
+		ct.log().Debug("⚫ Stage light off", logs.KeyLane, lane)
 	}
 
 	// Check for deep staging when stage changes
@@ -358,17 +571,12 @@ func (ct *ChristmasTree) handleDeepStaging(lane int) {
 
 // isDeepStagingProhibited checks if deep staging is prohibited for the given class
 func (ct *ChristmasTree) isDeepStagingProhibited(class string) bool {
-	prohibitedClasses := map[string]bool{
-		"Super Gas":    true,
-		"Super Stock":  true,
-		"Super Street": true,
-	}
-	return prohibitedClasses[class]
+	return rules.Or(ct.rules).DeepStageProhibited(class)
 }
 
 // handleDeepStagingViolation processes a deep staging violation
 func (ct *ChristmasTree) handleDeepStagingViolation(lane int, class string) {
-	fmt.Printf("⚠️  libdrag: Deep staging detected in lane %d (Class: %s - PROHIBITED)\n", lane, class)
+	ct.log().Warn("⚠️ Deep staging prohibited", logs.KeyLane, lane, "class", class)
 	
 	// Publish event for starter/officials to decide
 	if ct.eventBus != nil {
@@ -385,7 +593,7 @@ func (ct *ChristmasTree) handleDeepStagingViolation(lane int, class string) {
 
 // handleDeepStagingAllowed processes allowed deep staging
 func (ct *ChristmasTree) handleDeepStagingAllowed(lane int) {
-	fmt.Printf("🔵 libdrag: Deep staging detected in lane %d (Allowed)\n", lane)
+	ct.log().Info("🔵 Deep staged", logs.KeyLane, lane)
 	
 	// Informational only
 	if ct.eventBus != nil {
@@ -410,7 +618,7 @@ func (ct *ChristmasTree) trackStagingMotion(lane int, beamBroken bool) {
 	if !motionState.ReachedStage && beamBroken {
 		motionState.ReachedStage = true
 		motionState.LastStageState = true
-		motionState.MotionHistory = append(motionState.MotionHistory, "enter_stage")
+		ct.recordMotion(lane, MotionEnterStage)
 		return
 	}
 
@@ -419,14 +627,14 @@ func (ct *ChristmasTree) trackStagingMotion(lane int, beamBroken bool) {
 		// Detect backing out of stage beam
 		if motionState.LastStageState && !beamBroken {
 			motionState.LastStageState = false
-			motionState.MotionHistory = append(motionState.MotionHistory, "back_out_stage")
+			ct.recordMotion(lane, MotionBackOutStage)
 			return
 		}
 		
 		// Detect re-entering stage beam after backing out (VIOLATION)
 		if !motionState.LastStageState && beamBroken {
 			motionState.LastStageState = true
-			motionState.MotionHistory = append(motionState.MotionHistory, "re_enter_stage_VIOLATION")
+			ct.recordMotion(lane, MotionReEnterViolation)
 			ct.handleStagingMotionViolation(lane)
 			return
 		}
@@ -435,7 +643,7 @@ func (ct *ChristmasTree) trackStagingMotion(lane int, beamBroken bool) {
 
 // handleStagingMotionViolation processes backward staging motion violations
 func (ct *ChristmasTree) handleStagingMotionViolation(lane int) {
-	fmt.Printf("⚠️  libdrag: Staging motion violation in lane %d - vehicle backed out and re-entered stage beam\n", lane)
+	ct.log().Warn("⚠️ Staging motion violation, backed out and re-entered the stage beam", logs.KeyLane, lane)
 	
 	// Publish staging violation event
 	if ct.eventBus != nil {
@@ -445,22 +653,66 @@ func (ct *ChristmasTree) handleStagingMotionViolation(lane int) {
 				WithRaceID(ct.raceID).
 				WithLane(lane).
 				WithData("violation_type", "backward_staging_motion").
-				WithData("motion_history", motionState.MotionHistory).
+				WithData("motion_history", motionTypes(motionState.MotionHistory)).
 				WithData("rule", "last_motion_must_be_forward").
 				Build(),
 		)
 	}
 }
 
-// resetStagingMotion resets the staging motion tracking for a lane (when completely backing out)
+// resetStagingMotion resets the staging motion tracking for a lane (when
+// completely backing out). The history is kept for review.
 func (ct *ChristmasTree) resetStagingMotion(lane int) {
-	if ct.stagingMotion[lane] != nil {
+	if ct.stagingMotion[lane] != nil && ct.stagingMotion[lane].ReachedStage {
 		ct.stagingMotion[lane].ReachedStage = false
 		ct.stagingMotion[lane].LastStageState = false
-		ct.stagingMotion[lane].MotionHistory = make([]string, 0)
+		ct.recordMotion(lane, MotionBackOutComplete)
 	}
 }
 
+// recordMotion appends a motion to a lane's history, dropping the oldest
+// beyond the limit. Must be called with ct.mu held.
+func (ct *ChristmasTree) recordMotion(lane int, motionType string) {
+	motionState := ct.stagingMotion[lane]
+	motionState.MotionHistory = append(motionState.MotionHistory, Motion{Type: motionType, Time: timers.Or(ct.clock).Now()})
+	if excess := len(motionState.MotionHistory) - ct.motionLimit; excess > 0 {
+		motionState.MotionHistory = append([]Motion(nil), motionState.MotionHistory[excess:]...)
+		motionState.Pruned += excess
+	}
+}
+
+// motionTypes lists the types of a motion history
+func motionTypes(history []Motion) []string {
+	types := make([]string, len(history))
+	for i, motion := range history {
+		types[i] = motion.Type
+	}
+	return types
+}
+
+// SetMotionHistoryLimit sets how many staging motions each lane keeps
+func (ct *ChristmasTree) SetMotionHistoryLimit(limit int) {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	if limit > 0 {
+		ct.motionLimit = limit
+	}
+}
+
+// GetStagingMotion returns a copy of each lane's staging motion state
+func (ct *ChristmasTree) GetStagingMotion() map[int]StagingMotionState {
+	ct.mu.RLock()
+	defer ct.mu.RUnlock()
+
+	motion := make(map[int]StagingMotionState, len(ct.stagingMotion))
+	for lane, motionState := range ct.stagingMotion {
+		state := *motionState
+		state.MotionHistory = append([]Motion(nil), motionState.MotionHistory...)
+		motion[lane] = state
+	}
+	return motion
+}
+
 func (ct *ChristmasTree) IsArmed() bool {
 	ct.mu.RLock()
 	defer ct.mu.RUnlock()
@@ -488,19 +740,24 @@ func (ct *ChristmasTree) StartSequence(sequenceType config.TreeSequenceType) err
 	ct.mu.Lock()
 	defer ct.mu.Unlock()
 
+	if ct.halted {
+		return fmt.Errorf("tree is halted")
+	}
 	if !ct.status.Armed {
 		return fmt.Errorf("tree is not armed")
 	}
 
-	if ct.status.Activated {
+	// A tree activated by auto-start runs the sequence auto-start releases
+	if ct.status.Activated && !ct.autoStarted {
 		return fmt.Errorf("tree is not activated")
 	}
 
 	ct.status.Activated = true
+	ct.autoStarted = false
 	ct.status.SequenceType = sequenceType
-	ct.status.LastSequence = time.Now()
+	ct.status.LastSequence = timers.Or(ct.clock).Now()
 
-	fmt.Printf("🎄 libdrag: Starting %s sequence\n", sequenceType)
+	ct.log().Info("🎄 Starting sequence", "sequence", sequenceType)
 
 	// Publish sequence start event
 	if ct.eventBus != nil {
@@ -513,12 +770,14 @@ func (ct *ChristmasTree) StartSequence(sequenceType config.TreeSequenceType) err
 	}
 
 	// run the sequence in a goroutine
+	ct.sequences.Add(1)
 	go ct.runSequence(sequenceType)
 
 	return nil
 }
 
 func (ct *ChristmasTree) runSequence(sequenceType config.TreeSequenceType) time.Time {
+	defer ct.sequences.Done()
 	defer func() {
 		ct.mu.Lock()
 		ct.status.Activated = false
@@ -535,55 +794,108 @@ func (ct *ChristmasTree) runSequence(sequenceType config.TreeSequenceType) time.
 		}
 	}()
 
-	treeConfig := ct.config.Tree()
+	return ct.runLanes(sequenceType, ct.config.Tree())
+}
+
+// SetStartDelays sets each lane's handicap: how long its countdown starts
+// after the tree's, so the quicker dial-in in a bracket race gets the later
+// green. Lanes without a delay start with the tree. Pass nil to clear.
+func (ct *ChristmasTree) SetStartDelays(delays map[int]time.Duration) {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
 
-	switch sequenceType {
-	case config.TreeSequencePro:
-		return ct.runProSequence(treeConfig)
-	case config.TreeSequenceSportsman:
-		return ct.runSportsmanSequence(treeConfig)
-	default:
-		return ct.runProSequence(treeConfig)
+	ct.startDelays = make(map[int]time.Duration, len(delays))
+	for lane, delay := range delays {
+		if delay > 0 {
+			ct.startDelays[lane] = delay
+		}
 	}
 }
 
-func (ct *ChristmasTree) runProSequence(cfg config.TreeSequenceConfig) time.Time {
-	fmt.Println("🟡🟡🟡 libdrag: All three ambers ON")
+// runLanes runs the sequence, on every lane at once or, with a handicap,
+// once per group of lanes sharing a start delay. It returns the first green.
+func (ct *ChristmasTree) runLanes(sequenceType config.TreeSequenceType, cfg config.TreeSequenceConfig) time.Time {
+	run := ct.runProSequence
+	if sequenceType == config.TreeSequenceSportsman {
+		run = ct.runSportsmanSequence
+	}
+
+	ct.mu.RLock()
+	groups := make(map[time.Duration][]int)
+	for lane := 1; lane <= ct.config.Track().LaneCount; lane++ {
+		delay := ct.startDelays[lane]
+		groups[delay] = append(groups[delay], lane)
+	}
+	ct.mu.RUnlock()
+
+	if len(groups) <= 1 {
+		return run(cfg, nil)
+	}
 
+	delays := make([]time.Duration, 0, len(groups))
+	for delay := range groups {
+		delays = append(delays, delay)
+	}
+	sort.Slice(delays, func(i, j int) bool { return delays[i] < delays[j] })
+
+	greens := make([]time.Time, len(delays))
+	var wg sync.WaitGroup
+	for i, delay := range delays {
+		i, delay, lanes := i, delay, groups[delay]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if delay > 0 {
+				ct.log().Debug("⏳ Handicap start", "lanes", lanes, "delay", delay)
+				if !ct.pause(delay, "tree.handicap_delay") {
+					return
+				}
+			}
+			greens[i] = run(cfg, lanes)
+		}()
+	}
+	wg.Wait()
+	return greens[0]
+}
+
+// runProSequence runs a pro tree on lanes, or every lane when lanes is nil
+func (ct *ChristmasTree) runProSequence(cfg config.TreeSequenceConfig, lanes []int) time.Time {
 	// All three ambers simultaneously
-	ct.setAllLights(LightAmber1, LightOn)
-	ct.setAllLights(LightAmber2, LightOn)
-	ct.setAllLights(LightAmber3, LightOn)
+	if !ct.sequenceStep(lanes, nil, LightAmber1, LightAmber2, LightAmber3) {
+		return time.Time{}
+	}
+	ct.log().Debug("🟡🟡🟡 All three ambers on")
 
 	// Publish amber event
 	if ct.eventBus != nil {
 		ct.eventBus.Publish(
-			events.NewEvent(events.EventTreeAmberOn).
+			withLanes(events.NewEvent(events.EventTreeAmberOn).
 				WithRaceID(ct.raceID).
 				WithData("count", 3).
-				WithData("sequence", "pro").
+				WithData("sequence", "pro"), lanes).
 				Build(),
 		)
 	}
 
 	// Wait for green delay
-	time.Sleep(cfg.GreenDelay)
+	if !ct.pause(cfg.GreenDelay, "tree.green_delay") {
+		return time.Time{}
+	}
 
 	// Turn off ambers and turn on green
-	ct.setAllLights(LightAmber1, LightOff)
-	ct.setAllLights(LightAmber2, LightOff)
-	ct.setAllLights(LightAmber3, LightOff)
-	ct.setAllLights(LightGreen, LightOn)
+	if !ct.sequenceStep(lanes, []LightType{LightAmber1, LightAmber2, LightAmber3}, LightGreen) {
+		return time.Time{}
+	}
 
-	greenTime := time.Now()
-	fmt.Println("🟢 libdrag: GREEN LIGHT! GO GO GO!")
+	greenTime := timers.Or(ct.clock).Now()
+	ct.log().Info("🟢 Green light")
 
 	// Publish green light event
 	if ct.eventBus != nil {
 		ct.eventBus.Publish(
-			events.NewEvent(events.EventTreeGreenOn).
+			withLanes(events.NewEvent(events.EventTreeGreenOn).
 				WithRaceID(ct.raceID).
-				WithData("green_time", greenTime).
+				WithData("green_time", greenTime), lanes).
 				Build(),
 		)
 	}
@@ -591,48 +903,53 @@ func (ct *ChristmasTree) runProSequence(cfg config.TreeSequenceConfig) time.Time
 	return greenTime
 }
 
-func (ct *ChristmasTree) runSportsmanSequence(cfg config.TreeSequenceConfig) time.Time {
+// runSportsmanSequence runs a sportsman tree on lanes, or every lane when
+// lanes is nil
+func (ct *ChristmasTree) runSportsmanSequence(cfg config.TreeSequenceConfig, lanes []int) time.Time {
 	// Sequential ambers
 	amberLights := []LightType{LightAmber1, LightAmber2, LightAmber3}
 
 	for i, light := range amberLights {
-		fmt.Printf("🟡 libdrag: Amber %d ON\n", i+1)
-		ct.setAllLights(light, LightOn)
+		if !ct.sequenceStep(lanes, nil, light) {
+			return time.Time{}
+		}
+		ct.log().Debug("🟡 Amber on", "amber", i+1)
 
 		// Publish amber event for each light
 		if ct.eventBus != nil {
 			ct.eventBus.Publish(
-				events.NewEvent(events.EventTreeAmberOn).
+				withLanes(events.NewEvent(events.EventTreeAmberOn).
 					WithRaceID(ct.raceID).
 					WithData("amber_number", i+1).
-					WithData("sequence", "sportsman").
+					WithData("sequence", "sportsman"), lanes).
 					Build(),
 			)
 		}
 
-		if i < len(amberLights)-1 {
-			time.Sleep(cfg.AmberDelay)
+		if i < len(amberLights)-1 && !ct.pause(cfg.AmberDelay, "tree.amber_delay") {
+			return time.Time{}
 		}
 	}
 
 	// Wait for green delay after last amber
-	time.Sleep(cfg.GreenDelay)
+	if !ct.pause(cfg.GreenDelay, "tree.green_delay") {
+		return time.Time{}
+	}
 
 	// Turn off ambers and turn on green
-	for _, light := range amberLights {
-		ct.setAllLights(light, LightOff)
+	if !ct.sequenceStep(lanes, amberLights, LightGreen) {
+		return time.Time{}
 	}
-	ct.setAllLights(LightGreen, LightOn)
 
-	greenTime := time.Now()
-	fmt.Println("🟢 libdrag: GREEN LIGHT! GO GO GO!")
+	greenTime := timers.Or(ct.clock).Now()
+	ct.log().Info("🟢 Green light")
 
 	// Publish green light event
 	if ct.eventBus != nil {
 		ct.eventBus.Publish(
-			events.NewEvent(events.EventTreeGreenOn).
+			withLanes(events.NewEvent(events.EventTreeGreenOn).
 				WithRaceID(ct.raceID).
-				WithData("green_time", greenTime).
+				WithData("green_time", greenTime), lanes).
 				Build(),
 		)
 	}
@@ -640,10 +957,134 @@ func (ct *ChristmasTree) runSportsmanSequence(cfg config.TreeSequenceConfig) tim
 	return greenTime
 }
 
+// withLanes addresses a sequence event to the lanes it covers when the tree
+// is running a handicap start; events for every lane carry no lanes
+func withLanes(builder *events.EventBuilder, lanes []int) *events.EventBuilder {
+	if lanes == nil {
+		return builder
+	}
+	if len(lanes) == 1 {
+		builder = builder.WithLane(lanes[0])
+	}
+	return builder.WithData("lanes", lanes)
+}
+
 func (ct *ChristmasTree) setAllLights(lightType LightType, state LightState) {
-	trackConfig := ct.config.Track()
-	for lane := 1; lane <= trackConfig.LaneCount; lane++ {
-		ct.status.LightStates[lane][lightType] = state
+	ct.setLights(nil, lightType, state)
+}
+
+// setLights changes a bulb on lanes, or on every lane when lanes is nil
+func (ct *ChristmasTree) setLights(lanes []int, lightType LightType, state LightState) {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	ct.setLanes(lanes, lightType, state)
+}
+
+// setLanes changes a bulb on lanes, or on every lane when lanes is nil. Must
+// be called with ct.mu held.
+func (ct *ChristmasTree) setLanes(lanes []int, lightType LightType, state LightState) {
+	if lanes == nil {
+		for lane := 1; lane <= ct.config.Track().LaneCount; lane++ {
+			lanes = append(lanes, lane)
+		}
+	}
+	for _, lane := range lanes {
+		if lightType == LightGreen && state == LightOn && ct.status.LightStates[lane][LightRed] == LightOn {
+			continue // A lane that left early keeps its red instead
+		}
+		ct.setLight(lane, lightType, state)
+	}
+}
+
+// SetRedLight lights a lane's red bulb when it left before its green. The
+// lane's green stays dark; other lanes are unaffected.
+func (ct *ChristmasTree) SetRedLight(lane int) {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+
+	ct.setLight(lane, LightGreen, LightOff)
+	ct.setLight(lane, LightRed, LightOn)
+}
+
+// FlashStage flashes the stage bulb of a lane that has not staged, warning
+// its driver that the staging timeout is running out. The bulb lights
+// steady once the lane stages.
+func (ct *ChristmasTree) FlashStage(lane int) {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+
+	if ct.lanesStaged[lane] {
+		return
+	}
+	ct.setLight(lane, LightStage, LightBlink)
+	ct.log().Debug("⏱️ Stage light flashing", logs.KeyLane, lane)
+}
+
+// StopStageFlash turns off every flashing stage bulb, once the staging
+// timeout no longer applies
+func (ct *ChristmasTree) StopStageFlash() {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+
+	for lane, lights := range ct.status.LightStates {
+		if lights[LightStage] == LightBlink {
+			ct.setLight(lane, LightStage, LightOff)
+		}
+	}
+}
+
+// setLight changes one bulb, recording the transition and the lane's phase.
+// A halted tree's bulbs are left as they are. Must be called with ct.mu
+// held.
+func (ct *ChristmasTree) setLight(lane int, lightType LightType, state LightState) {
+	if ct.halted {
+		return
+	}
+	ct.setBulb(lane, lightType, state)
+}
+
+// setBulb changes one bulb even on a halted tree, as an emergency stop
+// does. Must be called with ct.mu held.
+func (ct *ChristmasTree) setBulb(lane int, lightType LightType, state LightState) {
+	lights, ok := ct.status.LightStates[lane]
+	if !ok || lights[lightType] == state {
+		return
+	}
+	lights[lightType] = state
+
+	sequence := ct.status.Lanes[lane]
+	sequence.Transitions = append(sequence.Transitions, BulbTransition{Light: lightType, State: state, Time: timers.Or(ct.clock).Now()})
+	sequence.Phase, sequence.Step = ct.lanePhase(lights, sequence.Step)
+	ct.status.Lanes[lane] = sequence
+}
+
+// lanePhase derives a lane's phase and step from its bulbs
+func (ct *ChristmasTree) lanePhase(lights map[LightType]LightState, step int) (SequencePhase, int) {
+	ambers := 0
+	for _, light := range []LightType{LightAmber1, LightAmber2, LightAmber3} {
+		if lights[light] == LightOn {
+			ambers++
+		}
+	}
+	if ambers > step {
+		step = ambers // Ambers go dark at green, so keep the highest count
+	}
+
+	switch {
+	case ct.compStatus.Status == "emergency_stopped":
+		return PhaseStopped, step
+	case lights[LightRed] == LightOn:
+		return PhaseRed, step
+	case lights[LightGreen] == LightOn:
+		return PhaseGreen, 4
+	case ambers > 0:
+		return PhaseAmber, step
+	case lights[LightStage] == LightOn:
+		return PhaseStaged, step
+	case lights[LightPreStage] == LightOn:
+		return PhasePreStaged, step
+	default:
+		return PhaseIdle, step
 	}
 }
 
@@ -652,6 +1093,9 @@ func (ct *ChristmasTree) StartStagingProcess(sequenceType config.TreeSequenceTyp
 	ct.mu.Lock()
 	defer ct.mu.Unlock()
 
+	if ct.halted {
+		return fmt.Errorf("tree is halted")
+	}
 	if !ct.status.Armed {
 		return fmt.Errorf("tree is not armed")
 	}
@@ -661,10 +1105,10 @@ func (ct *ChristmasTree) StartStagingProcess(sequenceType config.TreeSequenceTyp
 	}
 
 	ct.status.SequenceType = sequenceType
-	ct.status.LastSequence = time.Now()
+	ct.status.LastSequence = timers.Or(ct.clock).Now()
 	ct.compStatus.Status = "staging_process"
 
-	fmt.Printf("🎄 libdrag: Starting staging process - %s sequence\n", sequenceType)
+	ct.log().Info("🎄 Starting staging process", "sequence", sequenceType)
 
 	// Publish staging process start event
 	if ct.eventBus != nil {
@@ -677,12 +1121,14 @@ func (ct *ChristmasTree) StartStagingProcess(sequenceType config.TreeSequenceTyp
 	}
 
 	// run the sequence in a goroutine
+	ct.sequences.Add(1)
 	go ct.runStagingSequence(sequenceType)
 
 	return nil
 }
 
 func (ct *ChristmasTree) runStagingSequence(sequenceType config.TreeSequenceType) time.Time {
+	defer ct.sequences.Done()
 	defer func() {
 		ct.mu.Lock()
 		ct.mu.Unlock()
@@ -698,14 +1144,5 @@ func (ct *ChristmasTree) runStagingSequence(sequenceType config.TreeSequenceType
 		}
 	}()
 
-	treeConfig := ct.config.Tree()
-
-	switch sequenceType {
-	case config.TreeSequencePro:
-		return ct.runProSequence(treeConfig)
-	case config.TreeSequenceSportsman:
-		return ct.runSportsmanSequence(treeConfig)
-	default:
-		return ct.runProSequence(treeConfig)
-	}
+	return ct.runLanes(sequenceType, ct.config.Tree())
 }
@@ -3,7 +3,12 @@ package tree
 import (
 	"context"
 	"github.com/benharold/libdrag/pkg/config"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/benharold/libdrag/pkg/events"
+	"github.com/benharold/libdrag/pkg/timers"
 )
 
 func TestNewChristmasTree(t *testing.T) {
@@ -103,6 +108,7 @@ func TestPreStage(t *testing.T) {
 	tree.SetPreStage(2, true)
 
 	// Verify pre-stage light is on for lane 2
+	status = tree.GetTreeStatus()
 	if status.LightStates[2][LightPreStage] != LightOn {
 		t.Fatal("Pre-stage light should be on for lane 2")
 	}
@@ -445,3 +451,234 @@ func TestChristmasTreeDisarmTree(t *testing.T) {
 		t.Fatal("Tree should not be armed after calling DisarmTree()")
 	}
 }
+
+// TestLaneSequence tests that each lane reports its own phase and bulb history
+func TestLaneSequence(t *testing.T) {
+	tree := NewChristmasTree()
+	tree.Initialize(context.Background(), config.NewDefaultConfig())
+
+	tree.SetPreStage(1, true)
+	tree.SetStage(1, true)
+	tree.SetPreStage(2, true)
+
+	status := tree.GetTreeStatus()
+	if status.Lanes[1].Phase != PhaseStaged || status.Lanes[2].Phase != PhasePreStaged {
+		t.Fatalf("Expected lane 1 staged and lane 2 pre-staged, got %+v", status.Lanes)
+	}
+	if len(status.Lanes[1].Transitions) != 2 || status.Lanes[1].Transitions[1].Light != LightStage || status.Lanes[1].Transitions[1].Time.IsZero() {
+		t.Errorf("Expected lane 1's pre-stage and stage transitions, got %+v", status.Lanes[1].Transitions)
+	}
+
+	tree.SetStage(2, true)
+	tree.setAllLights(LightAmber1, LightOn)
+	tree.setAllLights(LightAmber2, LightOn)
+	if step := tree.GetTreeStatus().Lanes[2].Step; step != 2 {
+		t.Errorf("Expected step 2 with two ambers lit, got %d", step)
+	}
+
+	// Lane 2 leaves early: its red lights and its green stays dark
+	tree.SetRedLight(2)
+	tree.setAllLights(LightAmber3, LightOn)
+	for _, light := range []LightType{LightAmber1, LightAmber2, LightAmber3} {
+		tree.setAllLights(light, LightOff)
+	}
+	tree.setAllLights(LightGreen, LightOn)
+
+	status = tree.GetTreeStatus()
+	if status.Lanes[1].Phase != PhaseGreen || status.Lanes[1].Step != 4 {
+		t.Errorf("Expected lane 1 green at step 4, got %+v", status.Lanes[1])
+	}
+	if status.Lanes[2].Phase != PhaseRed || status.LightStates[2][LightGreen] != LightOff {
+		t.Errorf("Expected lane 2 red with its green dark, got %+v", status.Lanes[2])
+	}
+
+	tree.EmergencyStop()
+	if phase := tree.GetTreeStatus().Lanes[1].Phase; phase != PhaseStopped {
+		t.Errorf("Expected lane 1 stopped, got %s", phase)
+	}
+}
+
+// TestStagingMotionHistory tests that staging motions are kept for review
+// within the history limit
+func TestStagingMotionHistory(t *testing.T) {
+	cfg := config.NewDefaultConfig()
+	cfg.SafetyConfig.MotionHistoryLimit = 4
+	tree := NewChristmasTree()
+	tree.Initialize(context.Background(), cfg)
+
+	tree.SetPreStage(1, true)
+	tree.SetStage(1, true)
+	tree.SetStage(1, false)
+	tree.SetStage(1, true) // Violation: backed out and re-entered
+
+	motion := tree.GetStagingMotion()[1]
+	expected := []string{MotionEnterStage, MotionBackOutStage, MotionReEnterViolation}
+	if got := motionTypes(motion.MotionHistory); len(got) != len(expected) || got[2] != expected[2] {
+		t.Fatalf("Expected motions %v, got %v", expected, got)
+	}
+
+	// Backing out completely restarts the rule but keeps the history
+	tree.SetStage(1, false)
+	tree.SetPreStage(1, false)
+	tree.SetPreStage(1, true)
+	tree.SetStage(1, true)
+
+	motion = tree.GetStagingMotion()[1]
+	if len(motion.MotionHistory) != 4 || motion.Pruned != 2 {
+		t.Fatalf("Expected 4 motions with 2 pruned, got %d with %d pruned", len(motion.MotionHistory), motion.Pruned)
+	}
+	if got := motionTypes(motion.MotionHistory); got[2] != MotionBackOutComplete || got[3] != MotionEnterStage {
+		t.Errorf("Expected a complete back-out then a fresh entry, got %v", got)
+	}
+	if !motion.ReachedStage || motion.MotionHistory[3].Time.IsZero() {
+		t.Errorf("Unexpected motion state %+v", motion)
+	}
+}
+
+// TestHandicapStart tests that a lane with a start delay gets its countdown
+// and green that much later
+func TestHandicapStart(t *testing.T) {
+	wheel := timers.NewVirtualWheel(time.Now(), timers.DefaultTick)
+	defer timers.SetDefault(wheel)()
+
+	bus := events.NewEventBus(false)
+	greens := make(chan events.Event, 2)
+	bus.Subscribe(events.EventTreeGreenOn, func(e events.Event) { greens <- e })
+
+	tree := NewChristmasTree()
+	tree.Initialize(context.Background(), config.NewDefaultConfig())
+	tree.SetEventBus(bus)
+	tree.Arm(context.Background())
+	tree.SetStartDelays(map[int]time.Duration{1: 700 * time.Millisecond, 2: 0})
+	if err := tree.StartSequence(config.TreeSequencePro); err != nil {
+		t.Fatalf("StartSequence failed: %v", err)
+	}
+
+	// Lane 2 counts down while lane 1 waits out its handicap
+	wheel.BlockUntil(2)
+	wheel.Advance(400 * time.Millisecond)
+	first := <-greens
+	if first.Lane != 2 {
+		t.Fatalf("Expected lane 2 green first, got lane %d", first.Lane)
+	}
+	if lights := tree.GetTreeStatus().LightStates[1]; lights[LightAmber1] != LightOff || lights[LightGreen] != LightOff {
+		t.Fatalf("Expected lane 1 dark during its handicap, got %v", lights)
+	}
+
+	wheel.Advance(300 * time.Millisecond)
+	wheel.BlockUntil(1)
+	wheel.Advance(400 * time.Millisecond)
+	second := <-greens
+	if second.Lane != 1 {
+		t.Fatalf("Expected lane 1 green second, got lane %d", second.Lane)
+	}
+	if gap := second.Timestamp.Sub(first.Timestamp); gap != 700*time.Millisecond {
+		t.Errorf("Expected the greens 0.7s apart, got %v", gap)
+	}
+}
+
+func TestHaltSequence(t *testing.T) {
+	stops := map[string]func(*ChristmasTree){
+		"emergency stop": func(tree *ChristmasTree) { tree.EmergencyStop() },
+		"halt":           (*ChristmasTree).Halt,
+	}
+	for name, stop := range stops {
+		t.Run(name, func(t *testing.T) {
+			wheel := timers.NewVirtualWheel(time.Now(), timers.DefaultTick)
+			defer timers.SetDefault(wheel)()
+
+			bus := events.NewEventBus(false)
+			var mu sync.Mutex
+			stopped := false
+			var late []events.EventType
+			bus.SubscribeAll(func(e events.Event) {
+				mu.Lock()
+				defer mu.Unlock()
+				if stopped {
+					late = append(late, e.Type)
+				}
+			})
+
+			tree := NewChristmasTree()
+			tree.Initialize(context.Background(), config.NewDefaultConfig())
+			tree.SetEventBus(bus)
+			tree.Arm(context.Background())
+			if err := tree.StartSequence(config.TreeSequenceSportsman); err != nil {
+				t.Fatalf("StartSequence failed: %v", err)
+			}
+
+			// Stop with the first amber lit and the second pending
+			wheel.BlockUntil(1)
+			stop(tree)
+			mu.Lock()
+			stopped = true
+			mu.Unlock()
+			transitions := len(tree.GetTreeStatus().Lanes[1].Transitions)
+
+			wheel.Advance(5 * time.Second)
+			status := tree.GetTreeStatus()
+			if got := len(status.Lanes[1].Transitions); got != transitions {
+				t.Errorf("Expected no bulb changes after stopping, got %v", status.Lanes[1].Transitions[transitions:])
+			}
+			if status.LightStates[1][LightAmber2] != LightOff || status.LightStates[1][LightGreen] != LightOff {
+				t.Errorf("Expected the countdown cut short, got %v", status.LightStates[1])
+			}
+			if len(late) != 0 {
+				t.Errorf("Expected no events after stopping, got %v", late)
+			}
+			if pending := wheel.Pending(); len(pending) != 0 {
+				t.Errorf("Expected no timers left, got %+v", pending)
+			}
+
+			// Halted, the tree refuses sequences and bulb changes
+			if err := tree.StartSequence(config.TreeSequencePro); err == nil {
+				t.Error("Expected StartSequence refused on a halted tree")
+			}
+			tree.SetPreStage(2, true)
+			tree.SetStage(2, true)
+			tree.SetRedLight(2)
+			tree.FlashStage(2)
+			wheel.Advance(time.Second)
+			if got := tree.GetTreeStatus(); len(got.Lanes[2].Transitions) != len(status.Lanes[2].Transitions) {
+				t.Errorf("Expected no bulb changes on a halted tree, got %v", got.Lanes[2].Transitions[len(status.Lanes[2].Transitions):])
+			}
+			if len(late) != 0 {
+				t.Errorf("Expected no events on a halted tree, got %v", late)
+			}
+
+			// Armed again, the tree runs a full sequence
+			tree.Arm(context.Background())
+			if err := tree.StartSequence(config.TreeSequencePro); err != nil {
+				t.Fatalf("StartSequence failed: %v", err)
+			}
+			wheel.BlockUntil(1)
+			wheel.Advance(time.Second)
+			deadline := time.Now().Add(time.Second)
+			for tree.GetTreeStatus().LightStates[1][LightGreen] != LightOn {
+				if time.Now().After(deadline) {
+					t.Fatal("Expected a green once armed again")
+				}
+				time.Sleep(time.Millisecond)
+			}
+		})
+	}
+}
+
+func TestChannelStates(t *testing.T) {
+	cfg := config.NewDefaultConfig()
+	cfg.TrackConfig.Hardware = config.HardwareMap{Channels: map[int]config.HardwareChannel{
+		1:  {Kind: config.ChannelBeam, Lane: 1, ID: "pre_stage"},
+		16: {Kind: config.ChannelBulb, Lane: 1, ID: "pre_stage"},
+		17: {Kind: config.ChannelBulb, Lane: 2, ID: "pre_stage"},
+	}}
+	tree := NewChristmasTree()
+	if err := tree.Initialize(context.Background(), cfg); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+
+	tree.SetPreStage(1, true)
+	states := tree.ChannelStates()
+	if len(states) != 2 || states[16] != LightOn || states[17] != LightOff {
+		t.Errorf("Expected channel 16 on and 17 off, got %+v", states)
+	}
+}
@@ -0,0 +1,409 @@
+// Package webhook posts selected libdrag events to outbound HTTP webhooks,
+// so event-management platforms can follow races without holding a
+// connection to the timing system. Deliveries are signed with an HMAC of
+// the body, sent to each endpoint in order, and retried with a growing
+// delay; a delivery that still fails publishes webhook.failed.
+//
+// A delivery is a POST of the event's JSON with these headers:
+//
+//	X-Libdrag-Event:     race.complete
+//	X-Libdrag-Delivery:  delivery ID, the same on every attempt
+//	X-Libdrag-Timestamp: Unix seconds the attempt was sent
+//	X-Libdrag-Signature: sha256=hex(HMAC-SHA256(secret, timestamp + "." + body))
+//
+// Receivers check the signature with Verify and should reject stale
+// timestamps to stop replays.
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/benharold/libdrag/pkg/events"
+	"github.com/benharold/libdrag/pkg/logs"
+	"github.com/benharold/libdrag/pkg/timers"
+	"github.com/google/uuid"
+)
+
+// Defaults for Config fields left zero
+const (
+	DefaultRetries    = 5
+	DefaultRetryDelay = 2 * time.Second
+	DefaultTimeout    = 10 * time.Second
+	DefaultHistory    = 500
+)
+
+// Delivery headers
+const (
+	HeaderEvent     = "X-Libdrag-Event"
+	HeaderDelivery  = "X-Libdrag-Delivery"
+	HeaderTimestamp = "X-Libdrag-Timestamp"
+	HeaderSignature = "X-Libdrag-Signature"
+)
+
+// Delivery statuses
+const (
+	StatusQueued    = "queued"
+	StatusDelivered = "delivered"
+	StatusFailed    = "failed" // Rejected by the endpoint, or gave up after the retries
+)
+
+// Event selections for endpoints
+var (
+	// RaceEvents are races decided and photo finishes resolved
+	RaceEvents = []events.EventType{events.EventRaceComplete, events.EventFinishResolved}
+
+	// RecordEvents are track records set or rolled back
+	RecordEvents = []events.EventType{events.EventRecordsUpdate}
+
+	// IncidentEvents are races stopped short and safety interventions
+	IncidentEvents = []events.EventType{
+		events.EventRaceAbort,
+		events.EventTreeEmergencyStop,
+		events.EventInterlockOverride,
+		events.EventShutdownOverrun,
+		events.EventAutoStartFault,
+	}
+
+	// DefaultEvents are sent to endpoints that select none
+	DefaultEvents = concat(RaceEvents, RecordEvents, IncidentEvents)
+)
+
+// Endpoint is a webhook receiver
+type Endpoint struct {
+	URL    string             `json:"url"`
+	Secret string             `json:"secret,omitempty"` // Signs deliveries; unsigned when empty
+	Events []events.EventType `json:"events,omitempty"` // Empty = DefaultEvents
+}
+
+// Config configures the dispatcher
+type Config struct {
+	Endpoints  []Endpoint    `json:"endpoints"`
+	Retries    int           `json:"retries"`     // Retries after a failed attempt (0 = DefaultRetries)
+	RetryDelay time.Duration `json:"retry_delay"` // Before the first retry, doubling for each one after (0 = DefaultRetryDelay)
+	Timeout    time.Duration `json:"timeout"`     // Per attempt (0 = DefaultTimeout)
+	History    int           `json:"history"`     // Deliveries kept for review (0 = DefaultHistory)
+
+	// Client sends the deliveries; nil uses a client with Timeout
+	Client *http.Client `json:"-"`
+}
+
+// Validate checks every endpoint has an HTTP(S) URL
+func (c Config) Validate() error {
+	if len(c.Endpoints) == 0 {
+		return fmt.Errorf("no webhook endpoints")
+	}
+	for _, endpoint := range c.Endpoints {
+		u, err := url.Parse(endpoint.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid webhook URL %q", endpoint.URL)
+		}
+	}
+	return nil
+}
+
+// Delivery is an event's delivery to an endpoint
+type Delivery struct {
+	ID          string       `json:"id"`
+	URL         string       `json:"url"`
+	Event       events.Event `json:"event"`
+	Status      string       `json:"status"`
+	Attempts    int          `json:"attempts"`
+	StatusCode  int          `json:"status_code,omitempty"` // Of the last response
+	LastError   string       `json:"last_error,omitempty"`
+	QueuedAt    time.Time    `json:"queued_at"`
+	DeliveredAt time.Time    `json:"delivered_at,omitempty"`
+}
+
+// endpoint is an endpoint's queue; deliveries to it are sent one at a time
+type endpoint struct {
+	Endpoint
+	events  map[events.EventType]bool
+	queue   []*Delivery
+	sending bool // A worker is draining the queue or waiting to retry
+	retry   *timers.Timer
+}
+
+// Dispatcher delivers events from the bus to the endpoints. One endpoint
+// being down never holds up the others.
+type Dispatcher struct {
+	mu          sync.Mutex
+	bus         *events.EventBus
+	cfg         Config
+	client      *http.Client
+	clock       timers.Clock // Nil runs on the default wheel
+	logger      *slog.Logger // Nil logs to logs.Default
+	endpoints   []*endpoint
+	history     []*Delivery
+	unsubscribe func()
+	stopped     bool
+}
+
+// NewDispatcher creates a dispatcher and starts following the bus
+func NewDispatcher(bus *events.EventBus, cfg Config) (*Dispatcher, error) {
+	if bus == nil {
+		return nil, fmt.Errorf("webhooks need an event bus")
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	if cfg.Retries <= 0 {
+		cfg.Retries = DefaultRetries
+	}
+	if cfg.RetryDelay <= 0 {
+		cfg.RetryDelay = DefaultRetryDelay
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	if cfg.History <= 0 {
+		cfg.History = DefaultHistory
+	}
+	client := cfg.Client
+	if client == nil {
+		client = &http.Client{Timeout: cfg.Timeout}
+	}
+
+	d := &Dispatcher{bus: bus, cfg: cfg, client: client}
+	for _, e := range cfg.Endpoints {
+		selected := e.Events
+		if len(selected) == 0 {
+			selected = DefaultEvents
+		}
+		ep := &endpoint{Endpoint: e, events: make(map[events.EventType]bool, len(selected))}
+		for _, eventType := range selected {
+			ep.events[eventType] = true
+		}
+		d.endpoints = append(d.endpoints, ep)
+	}
+	d.unsubscribe = bus.SubscribeAll(d.handle)
+	return d, nil
+}
+
+// SetClock runs retries on clock instead of the default wheel
+func (d *Dispatcher) SetClock(clock timers.Clock) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.clock = clock
+}
+
+// SetLogger logs delivery failures to logger instead of logs.Default
+func (d *Dispatcher) SetLogger(logger *slog.Logger) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.logger = logger
+}
+
+// Deliveries returns the kept deliveries, oldest first
+func (d *Dispatcher) Deliveries() []Delivery {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	deliveries := make([]Delivery, len(d.history))
+	for i, delivery := range d.history {
+		deliveries[i] = *delivery
+	}
+	return deliveries
+}
+
+// Stop stops following the bus. Queued deliveries are dropped.
+func (d *Dispatcher) Stop() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.stopped {
+		return
+	}
+	d.stopped = true
+	d.unsubscribe()
+	for _, ep := range d.endpoints {
+		ep.queue = nil
+		if ep.retry != nil {
+			ep.retry.Stop()
+		}
+	}
+}
+
+// handle queues an event for every endpoint that selected it
+func (d *Dispatcher) handle(e events.Event) {
+	if e.Type == events.EventWebhookFailed {
+		return // Never report a failure to the endpoint that failed
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.stopped {
+		return
+	}
+	for _, ep := range d.endpoints {
+		if !ep.events[e.Type] {
+			continue
+		}
+		delivery := &Delivery{
+			ID:       uuid.New().String(),
+			URL:      ep.URL,
+			Event:    e,
+			Status:   StatusQueued,
+			QueuedAt: timers.Or(d.clock).Now(),
+		}
+		ep.queue = append(ep.queue, delivery)
+		d.history = append(d.history, delivery)
+		if !ep.sending {
+			ep.sending = true
+			go d.drain(ep)
+		}
+	}
+	d.trimHistory()
+}
+
+// trimHistory forgets the oldest finished deliveries beyond the history
+// limit. Must be called with d.mu held.
+func (d *Dispatcher) trimHistory() {
+	for len(d.history) > d.cfg.History && d.history[0].Status != StatusQueued {
+		d.history = d.history[1:]
+	}
+}
+
+// drain sends an endpoint's deliveries in order until its queue is empty,
+// or an attempt fails and a retry is scheduled
+func (d *Dispatcher) drain(ep *endpoint) {
+	for {
+		d.mu.Lock()
+		if d.stopped || len(ep.queue) == 0 {
+			ep.sending = false
+			d.mu.Unlock()
+			return
+		}
+		delivery := ep.queue[0]
+		id, event := delivery.ID, delivery.Event
+		d.mu.Unlock()
+
+		code, err := d.send(ep.Endpoint, id, event)
+
+		d.mu.Lock()
+		if d.stopped {
+			ep.sending = false
+			d.mu.Unlock()
+			return
+		}
+		delivery.Attempts++
+		delivery.StatusCode = code
+		if err == nil {
+			delivery.Status = StatusDelivered
+			delivery.LastError = ""
+			delivery.DeliveredAt = timers.Or(d.clock).Now()
+			ep.queue = ep.queue[1:]
+			d.trimHistory()
+			d.mu.Unlock()
+			continue
+		}
+
+		delivery.LastError = err.Error()
+		if retryable(code) && delivery.Attempts <= d.cfg.Retries {
+			delay := d.cfg.RetryDelay << (delivery.Attempts - 1)
+			ep.retry = timers.Or(d.clock).AfterFunc(delay, timers.Label{Name: "webhook.retry", RaceID: event.RaceID}, func() { d.drain(ep) })
+			d.mu.Unlock()
+			logs.For(d.logger, "webhook", event.RaceID).Warn("⚠️ Delivery failed, retrying", "event", event.Type, "url", ep.URL, "error", err, "retry_in", delay)
+			return
+		}
+		delivery.Status = StatusFailed
+		ep.queue = ep.queue[1:]
+		failed := *delivery
+		d.trimHistory()
+		d.mu.Unlock()
+		logs.For(d.logger, "webhook", event.RaceID).Error("🚨 Delivery failed", "event", event.Type, "url", ep.URL, "attempts", failed.Attempts, "error", err)
+		d.publishFailed(failed)
+	}
+}
+
+// send makes one delivery attempt, returning the response's status code
+func (d *Dispatcher) send(ep Endpoint, id string, event events.Event) (int, error) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode event: %v", err)
+	}
+	req, err := http.NewRequest(http.MethodPost, ep.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := timers.Or(d.clock).Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "libdrag-webhook")
+	req.Header.Set(HeaderEvent, string(event.Type))
+	req.Header.Set(HeaderDelivery, id)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	if ep.Secret != "" {
+		req.Header.Set(HeaderSignature, Sign(ep.Secret, timestamp, body))
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("endpoint returned %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// retryable reports whether an attempt that got status code (0 for no
+// response) may succeed later. Other client errors are the request's fault
+// and would fail again.
+func retryable(code int) bool {
+	return code == 0 || code == http.StatusRequestTimeout || code == http.StatusTooManyRequests || code >= 500
+}
+
+func (d *Dispatcher) publishFailed(delivery Delivery) {
+	builder := events.NewEvent(events.EventWebhookFailed).
+		WithRaceID(delivery.Event.RaceID).
+		WithData("delivery_id", delivery.ID).
+		WithData("url", delivery.URL).
+		WithData("event_type", string(delivery.Event.Type)).
+		WithData("attempts", delivery.Attempts).
+		WithData("error", delivery.LastError)
+	if delivery.StatusCode != 0 {
+		builder.WithData("status_code", delivery.StatusCode)
+	}
+	d.bus.Publish(builder.Build())
+}
+
+// Sign returns the signature header value for a delivery body sent at
+// timestamp (Unix seconds)
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks a delivery's signature and timestamp headers against its
+// body
+func Verify(secret, signature, timestamp string, body []byte) bool {
+	sent, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || !strings.HasPrefix(signature, "sha256=") {
+		return false
+	}
+	return hmac.Equal([]byte(signature), []byte(Sign(secret, sent, body)))
+}
+
+func concat(lists ...[]events.EventType) []events.EventType {
+	var all []events.EventType
+	for _, list := range lists {
+		all = append(all, list...)
+	}
+	return all
+}
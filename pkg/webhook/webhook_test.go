@@ -0,0 +1,170 @@
+package webhook
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/benharold/libdrag/pkg/events"
+	"github.com/benharold/libdrag/pkg/timers"
+)
+
+// receiver is a webhook endpoint that answers with the queued status codes,
+// then 200
+type receiver struct {
+	mu       sync.Mutex
+	codes    []int
+	requests []*http.Request
+	bodies   [][]byte
+	received chan struct{}
+}
+
+func newReceiver(t *testing.T, codes ...int) (*receiver, string) {
+	r := &receiver{codes: codes, received: make(chan struct{}, 16)}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		r.mu.Lock()
+		r.requests = append(r.requests, req)
+		r.bodies = append(r.bodies, body)
+		code := http.StatusOK
+		if len(r.codes) > 0 {
+			code, r.codes = r.codes[0], r.codes[1:]
+		}
+		r.mu.Unlock()
+		w.WriteHeader(code)
+		r.received <- struct{}{}
+	}))
+	t.Cleanup(server.Close)
+	return r, server.URL
+}
+
+func (r *receiver) wait(t *testing.T) {
+	t.Helper()
+	select {
+	case <-r.received:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected a delivery")
+	}
+}
+
+func TestSignedDelivery(t *testing.T) {
+	r, url := newReceiver(t)
+	bus := events.NewEventBus(false)
+	d, err := NewDispatcher(bus, Config{Endpoints: []Endpoint{{URL: url, Secret: "s3cret"}}})
+	if err != nil {
+		t.Fatalf("NewDispatcher failed: %v", err)
+	}
+	defer d.Stop()
+
+	bus.Publish(events.NewEvent(events.EventTreeGreenOn).WithRaceID("race-1").Build())
+	bus.Publish(events.NewEvent(events.EventRaceComplete).WithRaceID("race-1").WithData("winner_lane", 1).Build())
+	r.wait(t)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.requests) != 1 {
+		t.Fatalf("Expected only race.complete delivered, got %d requests", len(r.requests))
+	}
+	req, body := r.requests[0], r.bodies[0]
+	if req.Header.Get(HeaderEvent) != "race.complete" || req.Header.Get(HeaderDelivery) == "" {
+		t.Errorf("Unexpected headers %v", req.Header)
+	}
+	if !Verify("s3cret", req.Header.Get(HeaderSignature), req.Header.Get(HeaderTimestamp), body) {
+		t.Error("Expected the signature to verify")
+	}
+	if Verify("wrong", req.Header.Get(HeaderSignature), req.Header.Get(HeaderTimestamp), body) {
+		t.Error("Expected another secret's signature to fail")
+	}
+	var event events.Event
+	if err := json.Unmarshal(body, &event); err != nil || event.RaceID != "race-1" || event.Data["winner_lane"] != float64(1) {
+		t.Errorf("Expected the event as the body, got %s (%v)", body, err)
+	}
+}
+
+func TestRetries(t *testing.T) {
+	r, url := newReceiver(t, http.StatusServiceUnavailable, http.StatusBadGateway)
+	bus := events.NewEventBus(false)
+	wheel := timers.NewVirtualWheel(time.Now(), timers.DefaultTick)
+	d, err := NewDispatcher(bus, Config{Endpoints: []Endpoint{{URL: url, Events: IncidentEvents}}})
+	if err != nil {
+		t.Fatalf("NewDispatcher failed: %v", err)
+	}
+	d.SetClock(wheel)
+	defer d.Stop()
+
+	bus.Publish(events.NewEvent(events.EventRaceAbort).WithRaceID("race-1").Build())
+	r.wait(t)
+	wheel.BlockUntil(1)
+	wheel.Advance(DefaultRetryDelay)
+	r.wait(t)
+	// The retry delay doubles
+	wheel.BlockUntil(1)
+	wheel.Advance(DefaultRetryDelay)
+	select {
+	case <-r.received:
+		t.Fatal("Expected the second retry to wait twice as long")
+	case <-time.After(50 * time.Millisecond):
+	}
+	wheel.Advance(DefaultRetryDelay)
+	r.wait(t)
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) && d.Deliveries()[0].Status == StatusQueued {
+		time.Sleep(5 * time.Millisecond)
+	}
+	delivery := d.Deliveries()[0]
+	if delivery.Status != StatusDelivered || delivery.Attempts != 3 || delivery.StatusCode != http.StatusOK {
+		t.Errorf("Expected delivery on the third attempt, got %+v", delivery)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.requests[0].Header.Get(HeaderDelivery) != r.requests[2].Header.Get(HeaderDelivery) {
+		t.Error("Expected every attempt to carry the same delivery ID")
+	}
+}
+
+func TestFailedDelivery(t *testing.T) {
+	r, url := newReceiver(t, http.StatusBadRequest)
+	bus := events.NewEventBus(false)
+	failed := make(chan events.Event, 1)
+	bus.Subscribe(events.EventWebhookFailed, func(e events.Event) { failed <- e })
+	d, err := NewDispatcher(bus, Config{Endpoints: []Endpoint{{URL: url, Events: RecordEvents}}})
+	if err != nil {
+		t.Fatalf("NewDispatcher failed: %v", err)
+	}
+	defer d.Stop()
+
+	bus.Publish(events.NewEvent(events.EventRecordsUpdate).Build())
+	r.wait(t)
+	select {
+	case e := <-failed:
+		if e.Data["status_code"] != http.StatusBadRequest || e.Data["attempts"] != 1 || e.Data["event_type"] != "records.update" {
+			t.Errorf("Expected a rejected delivery not to be retried, got %+v", e.Data)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected webhook.failed")
+	}
+	if delivery := d.Deliveries()[0]; delivery.Status != StatusFailed {
+		t.Errorf("Expected the delivery failed, got %+v", delivery)
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	invalid := map[string]Config{
+		"no endpoints": {},
+		"no scheme":    {Endpoints: []Endpoint{{URL: "example.com/hook"}}},
+		"ftp":          {Endpoints: []Endpoint{{URL: "ftp://example.com/hook"}}},
+	}
+	for name, cfg := range invalid {
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("Expected %s to be rejected", name)
+		}
+	}
+	if _, err := NewDispatcher(events.NewEventBus(false), Config{Endpoints: []Endpoint{{URL: "https://example.com/hook"}}}); err != nil {
+		t.Errorf("Expected an HTTPS endpoint to be accepted, got %v", err)
+	}
+}